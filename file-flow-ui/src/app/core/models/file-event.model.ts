@@ -0,0 +1,9 @@
+import { FileStatus } from './file-status.model';
+
+export interface FileEvent {
+  id: string;
+  type: string;
+  occurredAt: string;
+  file: FileStatus;
+  error?: string;
+}
@@ -7,4 +7,5 @@ export interface FileStatus {
   emailSentAt: string;
   emailRecipent: string;
   errorMessage: string;
+  status: string;
 }
@@ -70,6 +70,12 @@ export class ApiService {
     return this.http.put<T>(this.getUrl(apiPrefix, apiName), body, { headers });
   }
 
+  eventSource(apiPrefix: ApiPrefix, apiName: string) {
+    return new EventSource(this.getUrl(apiPrefix, apiName), {
+      withCredentials: true,
+    });
+  }
+
   private handleError(err: HttpErrorResponse) {
     return throwError(err);
   }
@@ -3,12 +3,14 @@ import {
   AfterViewInit,
   ChangeDetectorRef,
   Component,
+  OnDestroy,
   ViewChild,
 } from '@angular/core';
 import { MatPaginator, PageEvent } from '@angular/material/paginator';
 import { MatSnackBar } from '@angular/material/snack-bar';
 import { MatTableDataSource } from '@angular/material/table';
 import { GetFileStatusResponse } from 'src/app/core/models/GetFileStatusResponse';
+import { FileEvent } from 'src/app/core/models/file-event.model';
 import { FileStatus } from 'src/app/core/models/file-status.model';
 import { ApiPrefix, ApiService } from 'src/app/core/services/api.service';
 
@@ -17,11 +19,12 @@ import { ApiPrefix, ApiService } from 'src/app/core/services/api.service';
   templateUrl: './file-status.component.html',
   styleUrls: ['./file-status.component.scss'],
 })
-export class FileStatusComponent implements AfterViewInit {
+export class FileStatusComponent implements AfterViewInit, OnDestroy {
   displayedColumns: string[] = [
     'name',
     'size',
     'createdAt',
+    'status',
     'emailSent',
     'emailRecipient',
     'errorMessage',
@@ -33,6 +36,7 @@ export class FileStatusComponent implements AfterViewInit {
   isLoadingResults = false;
   limit = 10;
   private lastID = 0;
+  private events?: EventSource;
 
   @ViewChild(MatPaginator) paginator!: MatPaginator;
 
@@ -45,6 +49,11 @@ export class FileStatusComponent implements AfterViewInit {
   ngAfterViewInit() {
     this.toggleSpinner();
     this.getFiles(this.lastID, this.limit);
+    this.listenStatus();
+  }
+
+  ngOnDestroy() {
+    this.events?.close();
   }
 
   onPageChange(event: PageEvent) {
@@ -72,6 +81,37 @@ export class FileStatusComponent implements AfterViewInit {
     this.changeDetectorRef.detectChanges();
   }
 
+  // listenStatus updates the rows as the status of the files changes on the server
+  private listenStatus() {
+    this.events = this.apiSvc.eventSource(
+      ApiPrefix.USER_UPLOADED_FILES,
+      'events'
+    );
+
+    const refresh = () => this.getFiles(this.lastID, this.limit);
+    const update = (message: MessageEvent) => {
+      const event: FileEvent = JSON.parse(message.data);
+      this.dataSource.data = this.dataSource.data.map((file) =>
+        file.id === event.file.id
+          ? {
+              ...file,
+              status: event.file.status,
+              emailSent: event.file.emailSent,
+              emailSentAt: event.file.emailSentAt,
+              errorMessage: event.error ?? file.errorMessage,
+            }
+          : file
+      );
+      this.changeDetectorRef.detectChanges();
+    };
+
+    this.events.addEventListener('created', refresh);
+    this.events.addEventListener('deleted', refresh);
+    this.events.addEventListener('scanning', update);
+    this.events.addEventListener('emailed', update);
+    this.events.addEventListener('failed', update);
+  }
+
   private getFiles(lastID: number, limit: number) {
     this.apiSvc
       .get<GetFileStatusResponse>(ApiPrefix.USER_UPLOADED_FILES, '', {
@@ -27,5 +27,10 @@ func main() {
 		log.Fatalf("Config error: %v", err)
 	}
 
+	// operator subcommands share the configuration of the server
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		os.Exit(app.RunDLQ(cfg, os.Args[2:]))
+	}
+
 	app.Run(cfg)
 }
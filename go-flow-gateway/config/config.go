@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -14,7 +15,18 @@ type Config struct {
 	Log      LogConfig      `yaml:"log"`
 	Redis    RedisConfig    `yaml:"redis"`
 	RabbitMQ RabbitMQConfig `yaml:"rabbitmq"`
-	MailHog  MailHogConfig  `yaml:"mailhog"`
+	Mail     MailConfig     `yaml:"mail"`
+	Scanner  ScannerConfig  `yaml:"scanner"`
+	Upload   UploadConfig   `yaml:"upload"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Password PasswordConfig `yaml:"password"`
+	Login    LoginConfig    `yaml:"login"`
+	Session  SessionConfig  `yaml:"session"`
+	OAuth    OAuthConfig    `yaml:"oauth"`
+
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	TwoFactor         TwoFactorConfig         `yaml:"two_factor"`
 }
 
 // AppConfig holds general application configurations
@@ -26,7 +38,8 @@ type AppConfig struct {
 
 // HTTPConfig holds the configuration for the HTTP server
 type HTTPConfig struct {
-	Port string `yaml:"port" env:"HTTP_PORT" env-default:"8080"`
+	Port           string   `yaml:"port" env:"HTTP_PORT" env-default:"8080"`
+	TrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES" env-default:"127.0.0.1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"` // proxies whose X-Forwarded-For is believed for the client IP
 }
 
 // PostgresConfig holds the configuration for the PostgreSQL database
@@ -53,9 +66,181 @@ type RabbitMQConfig struct {
 	Password string `yaml:"password" env-default:"guest"`
 }
 
-type MailHogConfig struct {
-	Host string `yaml:"host" env-default:"localhost"`
-	Port string `yaml:"port" env-default:"1025"`
+// MailConfig holds the configuration for outgoing email
+type MailConfig struct {
+	Transport string            `yaml:"transport" env:"MAIL_TRANSPORT" env-default:"smtp"` // smtp or file
+	From      string            `yaml:"from" env:"MAIL_FROM" env-default:"bgg@mail.com"`
+	SMTP      SMTPConfig        `yaml:"smtp"`
+	FileDrop  FileDropConfig    `yaml:"file_drop"`
+	Archive   ArchiveConfig     `yaml:"archive"`
+	Webhook   MailWebhookConfig `yaml:"webhook"`
+}
+
+// SMTPConfig holds the configuration for the SMTP transport
+type SMTPConfig struct {
+	Host           string        `yaml:"host" env:"SMTP_HOST" env-default:"localhost"`
+	Port           int           `yaml:"port" env:"SMTP_PORT" env-default:"1025"`
+	Username       string        `yaml:"username" env:"SMTP_USERNAME" env-default:""`
+	Password       string        `yaml:"password" env:"SMTP_PASSWORD" env-default:""`
+	Encryption     string        `yaml:"encryption" env:"SMTP_ENCRYPTION" env-default:"none"` // none, ssl or starttls
+	KeepAlive      bool          `yaml:"keep_alive" env-default:"true"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env-default:"10s"`
+	SendTimeout    time.Duration `yaml:"send_timeout" env-default:"30s"`
+}
+
+// FileDropConfig holds the configuration for the .eml file-drop transport
+type FileDropConfig struct {
+	Dir string `yaml:"dir" env:"MAIL_FILE_DROP_DIR" env-default:"./mail-drop"`
+}
+
+// ArchiveConfig holds the configuration for bundling the files of a delivery into a zip archive
+type ArchiveConfig struct {
+	MinFiles int  `yaml:"min_files" env:"MAIL_ARCHIVE_MIN_FILES" env-default:"0"` // bundle deliveries with at least this many files, 0 disables bundling
+	Encrypt  bool `yaml:"encrypt" env:"MAIL_ARCHIVE_ENCRYPT" env-default:"false"` // protect the archive with a generated password sent in a separate email
+}
+
+// MailWebhookConfig holds the configuration for the delivery status callbacks of the mail provider
+type MailWebhookConfig struct {
+	Secret    string        `yaml:"secret" env:"MAIL_WEBHOOK_SECRET" env-default:""` // HMAC key shared with the provider, callbacks are refused while empty
+	Tolerance time.Duration `yaml:"tolerance" env-default:"5m"`                      // accepted age of a signed timestamp
+}
+
+// ScannerConfig holds the configuration for the content scanning stage
+type ScannerConfig struct {
+	Provider string       `yaml:"provider" env:"SCANNER_PROVIDER" env-default:"none"` // none or clamav
+	ClamAV   ClamAVConfig `yaml:"clamav"`
+}
+
+// ClamAVConfig holds the configuration for the clamd client
+type ClamAVConfig struct {
+	Address string        `yaml:"address" env:"CLAMAV_ADDRESS" env-default:"localhost:3310"`
+	Timeout time.Duration `yaml:"timeout" env-default:"30s"`
+}
+
+// UploadConfig holds the policy applied to uploaded files
+type UploadConfig struct {
+	AllowedTypes      []string         `yaml:"allowed_types" env:"UPLOAD_ALLOWED_TYPES" env-default:""`
+	BlockedExtensions []string         `yaml:"blocked_extensions" env:"UPLOAD_BLOCKED_EXTENSIONS" env-default:".exe,.bat,.cmd,.com,.scr,.msi,.js,.vbs,.ps1,.jar"`
+	MaxSize           int64            `yaml:"max_size" env:"UPLOAD_MAX_SIZE" env-default:"26214400"` // bytes
+	MaxSizeByType     map[string]int64 `yaml:"max_size_by_type"`                                      // bytes, keyed by media type pattern
+	Deduplicate       bool             `yaml:"deduplicate" env:"UPLOAD_DEDUPLICATE" env-default:"false"`
+	MaxBatchFiles     int              `yaml:"max_batch_files" env:"UPLOAD_MAX_BATCH_FILES" env-default:"20"`
+	Quota             QuotaConfig      `yaml:"quota"`
+	Resumable         ResumableConfig  `yaml:"resumable"`
+	Schedule          ScheduleConfig   `yaml:"schedule"`
+	Retention         RetentionConfig  `yaml:"retention"`
+}
+
+// QuotaConfig holds the per-user upload quotas, 0 means unlimited
+type QuotaConfig struct {
+	MaxBytes          int64 `yaml:"max_bytes" env:"QUOTA_MAX_BYTES" env-default:"0"`
+	MaxFiles          int64 `yaml:"max_files" env:"QUOTA_MAX_FILES" env-default:"0"`
+	MaxUploadsPerHour int64 `yaml:"max_uploads_per_hour" env:"QUOTA_MAX_UPLOADS_PER_HOUR" env-default:"0"`
+	MaxResendsPerHour int64 `yaml:"max_resends_per_hour" env:"QUOTA_MAX_RESENDS_PER_HOUR" env-default:"0"`
+	MaxUploadSessions int64 `yaml:"max_upload_sessions" env:"QUOTA_MAX_UPLOAD_SESSIONS" env-default:"0"` // open resumable uploads
+}
+
+// ResumableConfig holds the configuration for resumable chunked uploads
+type ResumableConfig struct {
+	SessionTTL    time.Duration `yaml:"session_ttl" env:"UPLOAD_SESSION_TTL" env-default:"24h"`           // idle time before a session expires
+	MaxChunkSize  int64         `yaml:"max_chunk_size" env:"UPLOAD_MAX_CHUNK_SIZE" env-default:"8388608"` // bytes
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"10m"`
+}
+
+// ScheduleConfig holds the configuration for scheduled deliveries
+type ScheduleConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"SCHEDULE_POLL_INTERVAL" env-default:"30s"` // how often due deliveries are published
+}
+
+// RetentionConfig holds how long uploaded content is kept, 0 means forever
+type RetentionConfig struct {
+	Default       time.Duration `yaml:"default" env:"UPLOAD_RETENTION_DEFAULT" env-default:"0"` // applied when the user does not choose an expiry
+	Max           time.Duration `yaml:"max" env:"UPLOAD_RETENTION_MAX" env-default:"0"`         // latest expiry a user can choose
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// WebhookConfig holds the configuration for the webhooks notifying users about file events
+type WebhookConfig struct {
+	Timeout      time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" env-default:"10s"`             // time an endpoint has to answer
+	MaxAttempts  int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" env-default:"8"`     // attempts before a delivery is given up
+	BackoffBase  time.Duration `yaml:"backoff_base" env-default:"30s"`                              // wait before the first retry, doubled for every further one
+	BackoffMax   time.Duration `yaml:"backoff_max" env-default:"6h"`                                // longest wait between two attempts
+	DisableAfter int           `yaml:"disable_after" env:"WEBHOOK_DISABLE_AFTER" env-default:"20"`  // consecutive failed attempts before an endpoint is disabled, 0 never disables
+	PollInterval time.Duration `yaml:"poll_interval" env:"WEBHOOK_POLL_INTERVAL" env-default:"10s"` // how often due deliveries are sent
+	AllowHTTP    bool          `yaml:"allow_http" env:"WEBHOOK_ALLOW_HTTP" env-default:"false"`     // accept plain http endpoints besides https
+}
+
+// AdminConfig holds the configuration for the operator endpoints
+type AdminConfig struct {
+	Token string `yaml:"token" env:"ADMIN_TOKEN" env-default:""` // sent in the X-Admin-Token header, admin requests are refused while empty
+}
+
+// PasswordConfig holds the policy applied to the passwords users choose
+type PasswordConfig struct {
+	MinLength      int                     `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"10"`
+	MaxLength      int                     `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" env-default:"72"` // bytes, bcrypt refuses longer passwords
+	RequireUpper   bool                    `yaml:"require_upper" env-default:"false"`
+	RequireLower   bool                    `yaml:"require_lower" env-default:"false"`
+	RequireDigit   bool                    `yaml:"require_digit" env-default:"false"`
+	RequireSymbol  bool                    `yaml:"require_symbol" env-default:"false"`
+	ForbidUsername bool                    `yaml:"forbid_username" env-default:"true"`
+	MinStrength    float64                 `yaml:"min_strength" env:"PASSWORD_MIN_STRENGTH" env-default:"40"` // estimated entropy in bits, 0 disables the check
+	Breached       BreachedPasswordsConfig `yaml:"breached"`
+	Reset          PasswordResetConfig     `yaml:"reset"`
+}
+
+// PasswordResetConfig holds the reset of forgotten passwords through a link sent by email
+type PasswordResetConfig struct {
+	TokenTTL        time.Duration `yaml:"token_ttl" env:"PASSWORD_RESET_TOKEN_TTL" env-default:"1h"`
+	RequestInterval time.Duration `yaml:"request_interval" env-default:"1m"`           // shortest time between two links sent to a user
+	URL             string        `yaml:"url" env:"PASSWORD_RESET_URL" env-default:""` // page of the app choosing the new password, the reset-password page of the domain url while empty
+}
+
+// BreachedPasswordsConfig holds the configuration for screening passwords against breached password datasets
+type BreachedPasswordsConfig struct {
+	Dataset  string `yaml:"dataset" env:"PASSWORD_BREACHED_DATASET" env-default:""`      // directory of Pwned Passwords files split by hash prefix, the bundled list of common passwords is used while empty
+	MinCount int    `yaml:"min_count" env:"PASSWORD_BREACHED_MIN_COUNT" env-default:"1"` // times a password must have been seen in breaches to be rejected, 0 disables the check
+}
+
+// LoginConfig holds the protection of password logins against brute force, failures are counted in redis
+type LoginConfig struct {
+	FreeAttempts     int           `yaml:"free_attempts" env-default:"3"`                                        // failures on a username before each further one blocks it for a while
+	DelayBase        time.Duration `yaml:"delay_base" env-default:"1s"`                                          // block after the first delayed failure, doubled for every further one
+	DelayMax         time.Duration `yaml:"delay_max" env-default:"1m"`                                           // longest progressive block
+	MaxFailures      int           `yaml:"max_failures" env:"LOGIN_MAX_FAILURES" env-default:"10"`               // failures on a username that lock it, 0 never locks
+	MaxFailuresPerIP int           `yaml:"max_failures_per_ip" env:"LOGIN_MAX_FAILURES_PER_IP" env-default:"50"` // failures from an IP that lock it, 0 never locks
+	LockDuration     time.Duration `yaml:"lock_duration" env:"LOGIN_LOCK_DURATION" env-default:"15m"`
+	Window           time.Duration `yaml:"window" env-default:"1h"` // failures are forgotten once this passes without another one
+}
+
+// EmailVerificationConfig holds the verification of the emails of local accounts
+type EmailVerificationConfig struct {
+	TokenTTL         time.Duration `yaml:"token_ttl" env:"EMAIL_VERIFICATION_TOKEN_TTL" env-default:"24h"`
+	ResendInterval   time.Duration `yaml:"resend_interval" env-default:"1m"`                                                   // shortest time between two links sent to a user
+	RequiredToUpload bool          `yaml:"required_to_upload" env:"EMAIL_VERIFICATION_REQUIRED_TO_UPLOAD" env-default:"false"` // local accounts may not upload before verifying their email
+}
+
+// TwoFactorConfig holds the second factor of logins, an authenticator app generating TOTP codes
+type TwoFactorConfig struct {
+	Issuer        string        `yaml:"issuer" env:"TWO_FACTOR_ISSUER" env-default:""` // name shown by authenticator apps, the app name while empty
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`                // time to give the second factor after the first one passed
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`                  // wrong codes after which the login starts over, 0 never
+	RecoveryCodes int           `yaml:"recovery_codes" env-default:"10"`
+}
+
+// SessionConfig holds the login sessions and the cookie carrying them
+type SessionConfig struct {
+	MaxAge   time.Duration `yaml:"max_age" env:"SESSION_MAX_AGE" env-default:"720h"` // lifetime of a session from its login
+	Path     string        `yaml:"path" env-default:"/"`
+	Domain   string        `yaml:"domain" env:"SESSION_COOKIE_DOMAIN" env-default:""`
+	Secure   bool          `yaml:"secure" env:"SESSION_COOKIE_SECURE" env-default:"false"` // send the cookie over HTTPS only
+	HttpOnly bool          `yaml:"http_only" env-default:"true"`
+	SameSite string        `yaml:"same_site" env:"SESSION_COOKIE_SAME_SITE" env-default:"lax"` // lax, strict or none, none requires secure, strict loses the session on the way back from LINE login
+}
+
+// OAuthConfig holds the logins through an OAuth provider such as LINE
+type OAuthConfig struct {
+	StateTTL time.Duration `yaml:"state_ttl" env-default:"10m"` // time to come back from the provider before the login has to start over
 }
 
 // NewConfig reads application configuration and returns it
@@ -15,55 +15,117 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/auth/line-callback": {
+        "/admin/dead-letters": {
             "get": {
-                "description": "Handler the redirect from Line Login and set user session",
+                "description": "List the events whose consumer failed with the reason of the failure, the oldest first. The events themselves are left out",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "Auth"
+                    "Admin"
                 ],
-                "summary": "Line Callback",
+                "summary": "Get dead letters",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Authorization code returned from Line Login",
-                        "name": "code",
-                        "in": "query",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "limit",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "302": {
-                        "description": "Redirect URL",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/entity.DeadLetter"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/auth/line-login": {
-            "get": {
-                "description": "Redirect to Line Login",
+            },
+            "delete": {
+                "description": "Remove the events whose consumer failed before the given time",
                 "produces": [
-                    "text/html"
+                    "application/json"
                 ],
                 "tags": [
-                    "Auth"
+                    "Admin"
+                ],
+                "summary": "Purge dead letters",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time",
+                        "name": "before",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
-                "summary": "Line Login",
                 "responses": {
-                    "302": {
-                        "description": "Redirect URL",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/v1.purgeDeadLettersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
                         }
                     }
                 }
             }
         },
-        "/auth/login": {
+        "/admin/dead-letters/replay": {
             "post": {
-                "description": "Login",
+                "description": "Publish the selected events again, every queue bound to an event receives it. IDs that are not found are ignored",
                 "consumes": [
                     "application/json"
                 ],
@@ -71,78 +133,112 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Auth"
+                    "Admin"
                 ],
-                "summary": "Login",
+                "summary": "Replay dead letters",
                 "parameters": [
                     {
-                        "description": "login information",
-                        "name": "LoginRequest",
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "dead letter ids",
+                        "name": "replayDeadLettersRequest",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/v1.LoginRequest"
+                            "$ref": "#/definitions/v1.replayDeadLettersRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.replayDeadLettersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
                     }
                 }
             }
         },
-        "/auth/logout": {
+        "/admin/dead-letters/{id}": {
             "get": {
-                "description": "Logout",
-                "tags": [
-                    "Auth"
-                ],
-                "summary": "Logout",
-                "responses": {
-                    "204": {
-                        "description": "No content"
-                    }
-                }
-            }
-        },
-        "/auth/register": {
-            "post": {
-                "description": "Register",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Get an event whose consumer failed together with the event",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Auth"
+                    "Admin"
                 ],
-                "summary": "Register",
+                "summary": "Get dead letter",
                 "parameters": [
                     {
-                        "description": "register information",
-                        "name": "RegisterRequest",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/v1.RegisterRequest"
-                        }
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "dead letter id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Succesfully registered",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/v1.RegisterResponse"
+                            "$ref": "#/definitions/entity.DeadLetter"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
                         }
                     }
                 }
             }
         },
-        "/user-profiles": {
+        "/admin/user-uploaded-files/requeue-failed": {
             "post": {
-                "description": "Create UserProfileRoutes",
+                "description": "Queue the emails and deliveries again whose last attempt failed within the window, emails being sent in the meantime are skipped",
                 "consumes": [
                     "application/json"
                 ],
@@ -150,17 +246,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "UserProfileRoutes"
+                    "Admin"
                 ],
-                "summary": "Create UserProfileRoutes",
+                "summary": "Requeue failed emails",
                 "parameters": [
                     {
-                        "description": "UserProfileRoutes information",
-                        "name": "createUserProfileRequest",
+                        "type": "string",
+                        "description": "admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "failure window",
+                        "name": "requeueFailedRequest",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/v1.createUserProfileRequest"
+                            "$ref": "#/definitions/v1.requeueFailedRequest"
                         }
                     }
                 ],
@@ -168,7 +271,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/v1.userProfileResponse"
+                            "$ref": "#/definitions/dto.RequeueResult"
                         }
                     },
                     "400": {
@@ -176,37 +279,61 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/v1.errorResponse"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
                     }
                 }
             }
         },
-        "/user-profiles/{userId}": {
+        "/auth/line-callback": {
             "get": {
-                "description": "Get UserProfileRoutes",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
+                "description": "Handler the redirect from Line Login and set user session, users with two-factor authentication enabled are redirected with twoFactorRequired=true to give their code first. The state must be the one of the login started in this session before it expired. Logins Line reports as failed, such as when the user cancels, are redirected with lineLoginError set to the Line error code",
                 "tags": [
-                    "UserProfileRoutes"
+                    "Auth"
                 ],
-                "summary": "Get UserProfileRoutes",
+                "summary": "Line Callback",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "user id",
-                        "name": "userId",
-                        "in": "path",
+                        "description": "Authorization code returned from Line Login",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "State of the login, as sent to Line Login",
+                        "name": "state",
+                        "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Error code returned from Line Login instead of a code",
+                        "name": "error",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Description of the error returned from Line Login",
+                        "name": "error_description",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "302": {
+                        "description": "Redirect URL",
                         "schema": {
-                            "$ref": "#/definitions/v1.userProfileResponse"
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -214,134 +341,2224 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/v1.errorResponse"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
                     }
                 }
             }
         },
-        "/user-uploaded-files": {
+        "/auth/line-login": {
             "get": {
-                "description": "Get paginated files",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Redirect to Line Login. The state, nonce and PKCE code verifier of the login are kept in the session until Line redirects back",
                 "produces": [
-                    "application/json"
+                    "text/html"
                 ],
                 "tags": [
-                    "User Uploaded File"
-                ],
-                "summary": "Get paginated files",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "last ID of the last record",
-                        "name": "lastID",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "description": "limit",
-                        "name": "limit",
-                        "in": "query"
-                    }
+                    "Auth"
                 ],
+                "summary": "Line Login",
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "302": {
+                        "description": "Redirect URL",
                         "schema": {
-                            "$ref": "#/definitions/v1.getPaginatedFilesResponse"
+                            "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/v1.errorResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/auth/login": {
             "post": {
-                "description": "Create user uploaded file",
+                "description": "Login. Users with two-factor authentication enabled are only logged in once they give a code to /auth/two-factor/verify",
                 "consumes": [
-                    "multipart/form-data"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "User Uploaded File"
+                    "Auth"
                 ],
-                "summary": "Create user uploaded file",
+                "summary": "Login",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "email recipient",
-                        "name": "emailRecipient",
-                        "in": "formData",
-                        "required": true
+                        "description": "login information",
+                        "name": "LoginRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Password accepted, waiting for the second factor",
+                        "schema": {
+                            "$ref": "#/definitions/v1.LoginResponse"
+                        }
+                    },
+                    "204": {
+                        "description": "No content"
+                    },
+                    "401": {
+                        "description": "Invalid username or password",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
                     },
+                    "429": {
+                        "description": "Too many failed attempts, retry after the Retry-After header",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout": {
+            "get": {
+                "description": "Logout",
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Logout",
+                "responses": {
+                    "204": {
+                        "description": "No content"
+                    }
+                }
+            }
+        },
+        "/auth/password/change": {
+            "post": {
+                "description": "Change the password knowing the current one, the other sessions of the user are logged out",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Change Password",
+                "parameters": [
                     {
-                        "type": "file",
-                        "description": "file",
-                        "name": "file",
-                        "in": "formData",
-                        "required": true
+                        "description": "current and new password",
+                        "name": "ChangePasswordRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.ChangePasswordRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "204": {
-                        "description": "No Content"
+                        "description": "No content"
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid request or password rejected by the policy",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "The current password is incorrect",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The account signs in through an OAuth provider and has no password",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/password/forgot": {
+            "post": {
+                "description": "Email a link resetting the password to the account with the email. The response is the same whether an account has the email or not",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Forgot Password",
+                "parameters": [
+                    {
+                        "description": "email of the account",
+                        "name": "ForgotPasswordRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.ForgotPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/password/reset": {
+            "post": {
+                "description": "Choose a new password with the token of a reset link, every session of the user is logged out",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Reset Password",
+                "parameters": [
+                    {
+                        "description": "token of the reset link and new password",
+                        "name": "ResetPasswordRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.ResetPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No content"
+                    },
+                    "400": {
+                        "description": "Invalid request, invalid or expired token, or password rejected by the policy",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/register": {
+            "post": {
+                "description": "Register a local account, a link verifying the email is sent to it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Register",
+                "parameters": [
+                    {
+                        "description": "register information",
+                        "name": "RegisterRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Succesfully registered",
+                        "schema": {
+                            "$ref": "#/definitions/v1.RegisterResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or password rejected by the policy",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/two-factor/confirm": {
+            "post": {
+                "description": "Enable two-factor authentication with a first code of the enrolled app. The recovery codes returned are not shown again",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Two-Factor"
+                ],
+                "summary": "Confirm Authenticator App",
+                "parameters": [
+                    {
+                        "description": "code of the authenticator app",
+                        "name": "TwoFactorCodeRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.RecoveryCodesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or code",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No app is enrolled",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/two-factor/disable": {
+            "post": {
+                "description": "Remove the authenticator app and the recovery codes, given a code of either",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Two-Factor"
+                ],
+                "summary": "Disable Two-Factor Authentication",
+                "parameters": [
+                    {
+                        "description": "code of the authenticator app or recovery code",
+                        "name": "TwoFactorCodeRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No content"
+                    },
+                    "400": {
+                        "description": "Invalid request or code",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Two-factor authentication is not enabled",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed attempts, retry after the Retry-After header",
                         "schema": {
                             "$ref": "#/definitions/v1.errorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "entity.UserUploadedFile": {
+        },
+        "/auth/two-factor/enroll": {
+            "post": {
+                "description": "Generate the secret of an authenticator app, two-factor authentication is enabled once a first code is confirmed. Enrolling again before confirming replaces the secret",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Two-Factor"
+                ],
+                "summary": "Enroll Authenticator App",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.TOTPEnrollment"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/two-factor/verify": {
+            "post": {
+                "description": "Finish a login waiting for its second factor, given a code of the authenticator app or a recovery code. Too many wrong codes end the login, it then starts over",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Two-Factor"
+                ],
+                "summary": "Verify Second Factor",
+                "parameters": [
+                    {
+                        "description": "code of the authenticator app or recovery code",
+                        "name": "TwoFactorCodeRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.TwoFactorCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid code, or no login is waiting for a second factor",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed attempts, retry after the Retry-After header",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/verify-email": {
+            "get": {
+                "description": "Open the link sent by email to verify it, then redirect to the app with emailVerified set to true or false",
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Verify Email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token of the verification link",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "307": {
+                        "description": "Redirect URL",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/verify-email/resend": {
+            "post": {
+                "description": "Send a new link verifying the email of the account, the earlier links stop working",
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Resend Email Verification",
+                "responses": {
+                    "204": {
+                        "description": "No content"
+                    },
+                    "404": {
+                        "description": "The account has no email",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The email is already verified",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "A link was sent recently, retry after the Retry-After header",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deliveries/{id}": {
+            "patch": {
+                "description": "Move the send time of a scheduled delivery, only deliveries that have not been sent yet can be rescheduled",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Delivery"
+                ],
+                "summary": "Reschedule delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "delivery id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "new send time",
+                        "name": "rescheduleDeliveryRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.rescheduleDeliveryRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deliveries/{id}/cancel": {
+            "post": {
+                "description": "Cancel a scheduled delivery, only deliveries that have not been sent yet can be cancelled",
+                "tags": [
+                    "Delivery"
+                ],
+                "summary": "Cancel delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "delivery id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/sessions": {
+            "get": {
+                "description": "List the active sessions of the current user with their device, the address they were last seen from and when, the session making the request is flagged as current",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Me"
+                ],
+                "summary": "List sessions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.listSessionsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Log out every session of the current user except the one making the request",
+                "tags": [
+                    "Me"
+                ],
+                "summary": "Revoke other sessions",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/sessions/{id}": {
+            "delete": {
+                "description": "Log out one session of the current user, revoking the current session logs the request out as well",
+                "tags": [
+                    "Me"
+                ],
+                "summary": "Revoke session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "session id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/tokens": {
+            "get": {
+                "description": "List the personal access tokens of the current user with their scopes and last use, the tokens themselves are not shown",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Me"
+                ],
+                "summary": "List personal access tokens",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.listPersonalAccessTokensResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Issue a token for scripts and integrations, sent as \"Authorization: Bearer \u003ctoken\u003e\". The response carries the token, it is not shown again",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Me"
+                ],
+                "summary": "Create personal access token",
+                "parameters": [
+                    {
+                        "description": "token",
+                        "name": "createPersonalAccessTokenRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.createPersonalAccessTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreatedPersonalAccessToken"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/tokens/{id}": {
+            "delete": {
+                "description": "Delete a personal access token of the current user, requests sent with it are refused from then on",
+                "tags": [
+                    "Me"
+                ],
+                "summary": "Revoke personal access token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "token id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/usage": {
+            "get": {
+                "description": "Get the storage usage of the current user against each upload quota, a limit of 0 means unlimited",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Me"
+                ],
+                "summary": "Get usage",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserUsage"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-profiles": {
+            "post": {
+                "description": "Create UserProfileRoutes",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "UserProfileRoutes"
+                ],
+                "summary": "Create UserProfileRoutes",
+                "parameters": [
+                    {
+                        "description": "UserProfileRoutes information",
+                        "name": "createUserProfileRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.createUserProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.userProfileResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-profiles/{userId}": {
+            "get": {
+                "description": "Get UserProfileRoutes",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "UserProfileRoutes"
+                ],
+                "summary": "Get UserProfileRoutes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.userProfileResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files": {
+            "get": {
+                "description": "Get paginated files",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Get paginated files",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "last ID of the last record",
+                        "name": "lastID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "limit",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.getPaginatedFilesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create user uploaded file",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Create user uploaded file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "email recipient",
+                        "name": "emailRecipient",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "send the email at this RFC 3339 time instead of right away",
+                        "name": "sendAt",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "purge the content at this RFC 3339 time instead of after the default retention",
+                        "name": "expiresAt",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "the email is scheduled",
+                        "schema": {
+                            "$ref": "#/definitions/v1.createBatchResponse"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "507": {
+                        "description": "Insufficient Storage",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/batch": {
+            "post": {
+                "description": "Upload several files at once, the accepted files are sent together in one email",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Create batch upload",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "email recipients",
+                        "name": "emailRecipients",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "files",
+                        "name": "files",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "send the email at this RFC 3339 time instead of right away",
+                        "name": "sendAt",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "purge the content at this RFC 3339 time instead of after the default retention",
+                        "name": "expiresAt",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/v1.createBatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "no file was accepted",
+                        "schema": {
+                            "$ref": "#/definitions/v1.createBatchResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/events": {
+            "get": {
+                "description": "Server-sent events about the status transitions of the files of the user. The event name is created, scanning, emailed, failed or deleted and the data is the file event",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Stream file status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.FileEvent"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/uploads": {
+            "post": {
+                "description": "Start a resumable upload, chunks are then sent to the returned location",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Resumable Upload"
+                ],
+                "summary": "Create upload session",
+                "parameters": [
+                    {
+                        "description": "file to upload",
+                        "name": "createUploadSessionRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.createUploadSessionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/entity.UploadSession"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the upload session"
+                            },
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "bytes received so far"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "507": {
+                        "description": "Insufficient Storage",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/uploads/{id}": {
+            "head": {
+                "description": "Report how many bytes of a resumable upload have been received",
+                "tags": [
+                    "Resumable Upload"
+                ],
+                "summary": "Get upload offset",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "upload session id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "Upload-Length": {
+                                "type": "integer",
+                                "description": "declared size"
+                            },
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "bytes received so far"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            },
+            "patch": {
+                "description": "Append a chunk to a resumable upload, Upload-Offset must equal the offset reported by HEAD",
+                "consumes": [
+                    "application/offset+octet-stream"
+                ],
+                "tags": [
+                    "Resumable Upload"
+                ],
+                "summary": "Upload chunk",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "upload session id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "offset of the chunk",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "headers": {
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "bytes received so far"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/uploads/{id}/finalize": {
+            "post": {
+                "description": "Turn a complete resumable upload into a user uploaded file and send it to the recipient",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Resumable Upload"
+                ],
+                "summary": "Finalize upload session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "upload session id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.UserUploadedFile"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "507": {
+                        "description": "Insufficient Storage",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/{id}": {
+            "delete": {
+                "description": "Delete user uploaded file, stored content is released once no other upload shares it",
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Delete user uploaded file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user uploaded file id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/{id}/content": {
+            "get": {
+                "description": "Download the content of a user uploaded file, the content is gone once the file has expired",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Download user uploaded file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user uploaded file id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "the file is quarantined",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "the file has expired",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user-uploaded-files/{id}/resend": {
+            "post": {
+                "description": "Queue another copy of the email of the file, optionally to new recipients. A file sent with others is sent again with its whole delivery",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Uploaded File"
+                ],
+                "summary": "Resend user uploaded file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user uploaded file id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "new recipients",
+                        "name": "resendRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/v1.resendRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhook-endpoints": {
+            "get": {
+                "description": "List the webhook endpoints of the user, endpoints disabled after failing too often show enabled false",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "List webhook endpoints",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.listWebhookEndpointsResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register an https URL notified about file events. The response carries the secret the payloads are signed with, it is not shown again",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Create webhook endpoint",
+                "parameters": [
+                    {
+                        "description": "endpoint",
+                        "name": "createWebhookEndpointRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.createWebhookEndpointRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/entity.WebhookEndpoint"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhook-endpoints/{id}": {
+            "delete": {
+                "description": "Delete a webhook endpoint together with its delivery log",
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Delete webhook endpoint",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "webhook endpoint id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhook-endpoints/{id}/deliveries": {
+            "get": {
+                "description": "Get the delivery log of a webhook endpoint with the outcome of the last attempt of each event",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Get paginated webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "webhook endpoint id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "last ID of the last record",
+                        "name": "lastID",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "limit",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/v1.getPaginatedWebhookDeliveriesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhook-endpoints/{id}/enable": {
+            "post": {
+                "description": "Enable a webhook endpoint again after it was disabled for failing too often, its pending deliveries are sent again",
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Enable webhook endpoint",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "webhook endpoint id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/mail-events": {
+            "post": {
+                "description": "Delivery, bounce and complaint callbacks of the mail provider. The body is signed with HMAC-SHA256 over \"\u003ctimestamp\u003e.\u003cbody\u003e\" using the shared secret",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Receive mail events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "unix timestamp of the signature",
+                        "name": "X-Webhook-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "sha256=\u003chex encoded HMAC\u003e",
+                        "name": "X-Webhook-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "mail events",
+                        "name": "mailEventsRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/v1.mailEventsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.errorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "dto.CreatedPersonalAccessToken": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "nil never expires",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "token": {
+                    "description": "Sent as \"Authorization: Bearer \u003ctoken\u003e\"",
+                    "type": "string",
+                    "example": "gfg_pat_3q2-7wAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+                },
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.DeliveryFileResult": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Set when the file has been rejected",
+                    "type": "string",
+                    "example": "extension_blocked"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "files with extension .exe are not allowed"
+                },
+                "id": {
+                    "description": "Set when the file has been accepted",
+                    "type": "integer",
+                    "example": 1
+                },
+                "name": {
+                    "type": "string",
+                    "example": "report.pdf"
+                }
+            }
+        },
+        "dto.QuotaUsage": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer",
+                    "example": 104857600
+                },
+                "used": {
+                    "type": "integer",
+                    "example": 1024
+                }
+            }
+        },
+        "dto.RequeueResult": {
+            "type": "object",
+            "properties": {
+                "deliveries": {
+                    "description": "Deliveries, each sending all of its files",
+                    "type": "integer",
+                    "example": 1
+                },
+                "files": {
+                    "description": "Files sent on their own",
+                    "type": "integer",
+                    "example": 3
+                },
+                "skipped": {
+                    "description": "Emails being sent in the meantime",
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "dto.TOTPEnrollment": {
+            "type": "object",
+            "properties": {
+                "otpauthUri": {
+                    "description": "For apps opening the link",
+                    "type": "string",
+                    "example": "otpauth://totp/GoFlowGatewayApp:hank?issuer=GoFlowGatewayApp\u0026secret=JBSWY3DPEHPK3PXP"
+                },
+                "qrPayload": {
+                    "description": "Text to encode in the QR code scanned by the app",
+                    "type": "string",
+                    "example": "otpauth://totp/GoFlowGatewayApp:hank?issuer=GoFlowGatewayApp\u0026secret=JBSWY3DPEHPK3PXP"
+                },
+                "secret": {
+                    "description": "For apps where the secret is typed in",
+                    "type": "string",
+                    "example": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+                }
+            }
+        },
+        "dto.UserUsage": {
+            "type": "object",
+            "properties": {
+                "bytesReserved": {
+                    "description": "declared by open upload sessions, counted against bytesStored",
+                    "type": "integer",
+                    "example": 2048
+                },
+                "bytesStored": {
+                    "$ref": "#/definitions/dto.QuotaUsage"
+                },
+                "fileCount": {
+                    "$ref": "#/definitions/dto.QuotaUsage"
+                },
+                "uploadSessions": {
+                    "$ref": "#/definitions/dto.QuotaUsage"
+                },
+                "uploadsPerHour": {
+                    "$ref": "#/definitions/dto.QuotaUsage"
+                }
+            }
+        },
+        "entity.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "description": "The event, only set when a single dead letter is requested",
+                    "type": "object"
+                },
+                "error": {
+                    "description": "Reason of the failure",
+                    "type": "string"
+                },
+                "event": {
+                    "description": "Name of the event, it is replayed with it",
+                    "type": "string"
+                },
+                "failedAt": {
+                    "description": "When the consumer failed",
+                    "type": "string"
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "queue": {
+                    "description": "Queue whose consumer failed",
+                    "type": "string"
+                }
+            }
+        },
+        "entity.FileEvent": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Why the email failed, only set for file.email_failed",
+                    "type": "string"
+                },
+                "file": {
+                    "$ref": "#/definitions/entity.UserUploadedFile"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "occurredAt": {
+                    "type": "string"
+                },
+                "type": {
+                    "description": "See FileEvent constants",
+                    "type": "string"
+                }
+            }
+        },
+        "entity.PersonalAccessToken": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "nil never expires",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "entity.RecipientStatus": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string"
+                },
+                "recipient": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.UploadSession": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "emailRecipient": {
+                    "description": "The email address of the recipient once the upload is finalised",
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "Abandoned sessions are purged after this timestamp",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Random token identifying the session in upload URLs",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "offset": {
+                    "description": "Number of bytes received so far",
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "Declared total size in bytes",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "open or finalizing",
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "entity.UserSession": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "current": {
+                    "description": "the session making the request",
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "c2Vzc2lvbi1pZA"
+                },
+                "ip": {
+                    "description": "address the session was last seen from",
+                    "type": "string",
+                    "example": "203.0.113.7"
+                },
+                "lastSeenAt": {
+                    "type": "string"
+                },
+                "userAgent": {
+                    "type": "string",
+                    "example": "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)"
+                }
+            }
+        },
+        "entity.UserUploadedFile": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "description": "Hex encoded SHA-256 of the content",
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "contentType": {
+                    "description": "Media type sniffed from the content",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "deliveryId": {
+                    "description": "Set when the file is sent together with others",
+                    "type": "integer"
+                },
+                "emailRecipient": {
+                    "description": "The email address of the recipient",
+                    "type": "string"
+                },
+                "emailSent": {
+                    "description": "Indicates if the email was sent successfully",
+                    "type": "boolean"
+                },
+                "emailSentAt": {
+                    "description": "The timestamp when the email was sent",
+                    "type": "string"
+                },
+                "emailStatus": {
+                    "description": "Delivery state of the email, see EmailStatus constants",
+                    "type": "string"
+                },
+                "errorMessage": {
+                    "description": "// Error message if the email was not sent successfully",
+                    "type": "string"
+                },
+                "expiredAt": {
+                    "description": "The timestamp when the content was purged",
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "The content is purged after this time, nil keeps it forever",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "recipients": {
+                    "description": "Delivery state reported for each recipient",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.RecipientStatus"
+                    }
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "Processing status of the file, see FileStatus constants",
+                    "type": "string"
+                },
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "entity.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "deliveredAt": {
+                    "type": "string"
+                },
+                "endpointId": {
+                    "type": "integer"
+                },
+                "eventId": {
+                    "type": "string"
+                },
+                "eventType": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastError": {
+                    "type": "string"
+                },
+                "lastStatusCode": {
+                    "description": "HTTP status of the last attempt, nil when no response was received",
+                    "type": "integer"
+                },
+                "nextAttemptAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "See WebhookDelivery constants",
+                    "type": "string"
+                }
+            }
+        },
+        "entity.WebhookEndpoint": {
             "type": "object",
             "properties": {
-                "content": {
-                    "type": "string"
+                "consecutiveFailures": {
+                    "type": "integer"
                 },
                 "createdAt": {
                     "type": "string"
                 },
-                "emailRecipient": {
-                    "description": "The email address of the recipient",
+                "disabledAt": {
+                    "description": "Set when the endpoint was disabled after failing too often",
                     "type": "string"
                 },
-                "emailSent": {
-                    "description": "Indicates if the email was sent successfully",
+                "enabled": {
                     "type": "boolean"
                 },
-                "emailSentAt": {
-                    "description": "The timestamp when the email was sent",
-                    "type": "string"
-                },
-                "errorMessage": {
-                    "description": "// Error message if the email was not sent successfully",
-                    "type": "string"
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
                 "id": {
                     "type": "integer"
                 },
-                "name": {
+                "secret": {
+                    "description": "HMAC key the payloads are signed with, only returned on creation",
                     "type": "string"
                 },
-                "size": {
-                    "type": "integer"
+                "url": {
+                    "type": "string"
                 },
                 "userId": {
                     "type": "integer"
                 }
             }
         },
+        "v1.ChangePasswordRequest": {
+            "type": "object",
+            "required": [
+                "currentPassword",
+                "newPassword"
+            ],
+            "properties": {
+                "currentPassword": {
+                    "type": "string",
+                    "example": "password"
+                },
+                "newPassword": {
+                    "type": "string",
+                    "example": "new password"
+                }
+            }
+        },
+        "v1.ForgotPasswordRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "billyang@mail.com"
+                }
+            }
+        },
         "v1.LoginRequest": {
             "type": "object",
             "required": [
@@ -359,9 +2576,34 @@ const docTemplate = `{
                 }
             }
         },
+        "v1.LoginResponse": {
+            "type": "object",
+            "properties": {
+                "twoFactorRequired": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "v1.RecoveryCodesResponse": {
+            "type": "object",
+            "properties": {
+                "recoveryCodes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "abcd-efgh",
+                        "ijkl-mnop"
+                    ]
+                }
+            }
+        },
         "v1.RegisterRequest": {
             "type": "object",
             "required": [
+                "email",
                 "password",
                 "username"
             ],
@@ -370,6 +2612,11 @@ const docTemplate = `{
                     "type": "string",
                     "example": "billyang"
                 },
+                "email": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "billyang@mail.com"
+                },
                 "password": {
                     "type": "string",
                     "example": "password"
@@ -389,6 +2636,111 @@ const docTemplate = `{
                 }
             }
         },
+        "v1.ResetPasswordRequest": {
+            "type": "object",
+            "required": [
+                "password",
+                "token"
+            ],
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "password"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "token"
+                }
+            }
+        },
+        "v1.TwoFactorCodeRequest": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "description": "TOTP code of the authenticator app, or a recovery code",
+                    "type": "string",
+                    "example": "123456"
+                }
+            }
+        },
+        "v1.createBatchResponse": {
+            "type": "object",
+            "properties": {
+                "deliveryId": {
+                    "type": "integer"
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.DeliveryFileResult"
+                    }
+                },
+                "sendAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "v1.createPersonalAccessTokenRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "expiresInDays": {
+                    "description": "0 never expires",
+                    "type": "integer",
+                    "maximum": 365,
+                    "minimum": 0,
+                    "example": 90
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "nightly backup"
+                },
+                "scopes": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "files:read",
+                        "files:write"
+                    ]
+                }
+            }
+        },
+        "v1.createUploadSessionRequest": {
+            "type": "object",
+            "required": [
+                "emailRecipient",
+                "name",
+                "size"
+            ],
+            "properties": {
+                "emailRecipient": {
+                    "type": "string",
+                    "example": "johndoe@email.com"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "report.pdf"
+                },
+                "size": {
+                    "type": "integer",
+                    "minimum": 1,
+                    "example": 10485760
+                }
+            }
+        },
         "v1.createUserProfileRequest": {
             "type": "object",
             "required": [
@@ -406,9 +2758,37 @@ const docTemplate = `{
                 }
             }
         },
+        "v1.createWebhookEndpointRequest": {
+            "type": "object",
+            "required": [
+                "events",
+                "url"
+            ],
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "file.created",
+                        "file.emailed"
+                    ]
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/files"
+                }
+            }
+        },
         "v1.errorResponse": {
             "type": "object",
             "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "code"
+                },
                 "fieldErrs": {
                     "type": "object",
                     "additionalProperties": {
@@ -435,6 +2815,184 @@ const docTemplate = `{
                 }
             }
         },
+        "v1.getPaginatedWebhookDeliveriesResponse": {
+            "type": "object",
+            "properties": {
+                "deliveries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.WebhookDelivery"
+                    }
+                },
+                "totalRecords": {
+                    "type": "integer"
+                }
+            }
+        },
+        "v1.listPersonalAccessTokensResponse": {
+            "type": "object",
+            "properties": {
+                "tokens": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.PersonalAccessToken"
+                    }
+                }
+            }
+        },
+        "v1.listSessionsResponse": {
+            "type": "object",
+            "properties": {
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.UserSession"
+                    }
+                }
+            }
+        },
+        "v1.listWebhookEndpointsResponse": {
+            "type": "object",
+            "properties": {
+                "endpoints": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.WebhookEndpoint"
+                    }
+                }
+            }
+        },
+        "v1.mailEventRequest": {
+            "type": "object",
+            "required": [
+                "messageId",
+                "occurredAt",
+                "recipient",
+                "type"
+            ],
+            "properties": {
+                "messageId": {
+                    "type": "string",
+                    "example": "3f2a9c@mail.com"
+                },
+                "occurredAt": {
+                    "type": "string",
+                    "example": "2024-01-01T09:00:00Z"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "550 5.1.1 mailbox does not exist"
+                },
+                "recipient": {
+                    "type": "string",
+                    "example": "johndoe@email.com"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "delivered",
+                        "bounced",
+                        "complained"
+                    ],
+                    "example": "bounced"
+                }
+            }
+        },
+        "v1.mailEventsRequest": {
+            "type": "object",
+            "required": [
+                "events"
+            ],
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/v1.mailEventRequest"
+                    }
+                }
+            }
+        },
+        "v1.purgeDeadLettersResponse": {
+            "type": "object",
+            "properties": {
+                "purged": {
+                    "type": "integer",
+                    "example": 10
+                }
+            }
+        },
+        "v1.replayDeadLettersRequest": {
+            "type": "object",
+            "required": [
+                "ids"
+            ],
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "maxItems": 1000,
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "v1.replayDeadLettersResponse": {
+            "type": "object",
+            "properties": {
+                "replayed": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "v1.requeueFailedRequest": {
+            "type": "object",
+            "required": [
+                "from"
+            ],
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "to": {
+                    "description": "defaults to now",
+                    "type": "string",
+                    "example": "2024-01-02T00:00:00Z"
+                }
+            }
+        },
+        "v1.rescheduleDeliveryRequest": {
+            "type": "object",
+            "required": [
+                "sendAt"
+            ],
+            "properties": {
+                "sendAt": {
+                    "type": "string",
+                    "example": "2024-01-01T09:00:00Z"
+                }
+            }
+        },
+        "v1.resendRequest": {
+            "type": "object",
+            "properties": {
+                "emailRecipients": {
+                    "description": "replaces the recipients when set",
+                    "type": "array",
+                    "maxItems": 10,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "johndoe@email.com"
+                    ]
+                }
+            }
+        },
         "v1.userProfileResponse": {
             "type": "object",
             "properties": {
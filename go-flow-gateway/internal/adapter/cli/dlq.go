@@ -0,0 +1,149 @@
+// Package cli implements the operator subcommands of the gateway binary.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+)
+
+// ErrUsage is returned when the arguments of a subcommand are invalid, the usage has been printed.
+var ErrUsage = errors.New("cli - invalid usage")
+
+const _dlqUsage = `usage: go-flow-gateway dlq <command> [arguments]
+
+commands:
+  list [-limit n]                    list dead letters, the oldest first
+  show <id>                          print a dead letter with its event
+  replay <id>...                     publish dead letters again
+  purge -older-than <duration>       remove dead letters that failed before now minus the duration
+  purge -before <RFC 3339 time>      remove dead letters that failed before the time
+`
+
+type DLQCommand struct {
+	deadLetter usecase.DeadLetter
+	out        io.Writer
+}
+
+func NewDLQCommand(dl usecase.DeadLetter, out io.Writer) *DLQCommand {
+	return &DLQCommand{deadLetter: dl, out: out}
+}
+
+// Run executes the dlq subcommand named by the first argument.
+func (c *DLQCommand) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return c.usage()
+	}
+
+	switch args[0] {
+	case "list":
+		return c.list(ctx, args[1:])
+	case "show":
+		return c.show(ctx, args[1:])
+	case "replay":
+		return c.replay(ctx, args[1:])
+	case "purge":
+		return c.purge(ctx, args[1:])
+	default:
+		return c.usage()
+	}
+}
+
+func (c *DLQCommand) usage() error {
+	fmt.Fprint(c.out, _dlqUsage)
+	return ErrUsage
+}
+
+func (c *DLQCommand) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("dlq "+name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func (c *DLQCommand) list(ctx context.Context, args []string) error {
+	fs := c.flags("list")
+	limit := fs.Int("limit", 50, "")
+	if err := fs.Parse(args); err != nil || *limit < 1 || fs.NArg() > 0 {
+		return c.usage()
+	}
+
+	letters, err := c.deadLetter.List(ctx, *limit)
+	if err != nil {
+		return fmt.Errorf("DLQCommand - list - deadLetter.List: %w", err)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEVENT\tQUEUE\tFAILED AT\tERROR")
+	for _, dl := range letters {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", dl.ID, dl.Event, dl.Queue, dl.FailedAt.Format(time.RFC3339), oneLine(dl.Error))
+	}
+	return w.Flush()
+}
+
+func (c *DLQCommand) show(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return c.usage()
+	}
+
+	letter, err := c.deadLetter.Get(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("DLQCommand - show - deadLetter.Get: %w", err)
+	}
+
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(letter)
+}
+
+func (c *DLQCommand) replay(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return c.usage()
+	}
+
+	replayed, err := c.deadLetter.Replay(ctx, args)
+	if err != nil {
+		return fmt.Errorf("DLQCommand - replay - deadLetter.Replay: %w", err)
+	}
+
+	fmt.Fprintf(c.out, "replayed %d of %d dead letters\n", replayed, len(args))
+	return nil
+}
+
+func (c *DLQCommand) purge(ctx context.Context, args []string) error {
+	fs := c.flags("purge")
+	olderThan := fs.Duration("older-than", 0, "")
+	before := fs.String("before", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || (*olderThan > 0) == (*before != "") {
+		return c.usage()
+	}
+
+	cutoff := time.Now().Add(-*olderThan)
+	if *before != "" {
+		var err error
+		cutoff, err = time.Parse(time.RFC3339, *before)
+		if err != nil {
+			return c.usage()
+		}
+	}
+
+	purged, err := c.deadLetter.Purge(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("DLQCommand - purge - deadLetter.Purge: %w", err)
+	}
+
+	fmt.Fprintf(c.out, "purged %d dead letters that failed before %s\n", purged, cutoff.Format(time.RFC3339))
+	return nil
+}
+
+// oneLine keeps an error message on its row of the table.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
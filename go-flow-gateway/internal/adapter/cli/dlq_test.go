@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+)
+
+type fakeDeadLetter struct {
+	letters  []entity.DeadLetter
+	replayed []string
+	before   time.Time
+}
+
+func (f *fakeDeadLetter) List(ctx context.Context, limit int) ([]entity.DeadLetter, error) {
+	return f.letters[:min(limit, len(f.letters))], nil
+}
+
+func (f *fakeDeadLetter) Get(ctx context.Context, id string) (entity.DeadLetter, error) {
+	for _, dl := range f.letters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+	return entity.DeadLetter{}, errors.New("not found")
+}
+
+func (f *fakeDeadLetter) Replay(ctx context.Context, ids []string) (int, error) {
+	f.replayed = ids
+	return len(ids), nil
+}
+
+func (f *fakeDeadLetter) Purge(ctx context.Context, before time.Time) (int, error) {
+	f.before = before
+	return 1, nil
+}
+
+func TestDLQCommand_Run(t *testing.T) {
+
+	failedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	newFake := func() *fakeDeadLetter {
+		return &fakeDeadLetter{letters: []entity.DeadLetter{
+			{ID: "a", Event: "file.uploaded", Queue: "scan", Error: "scanner\nunavailable", FailedAt: failedAt},
+			{ID: "b", Event: "file.scanned", Queue: "email", Error: "smtp timeout", FailedAt: failedAt},
+		}}
+	}
+
+	t.Run("list prints a row per dead letter", func(t *testing.T) {
+		// Arrange
+		var out bytes.Buffer
+		cmd := NewDLQCommand(newFake(), &out)
+
+		// Act
+		err := cmd.Run(context.Background(), []string{"list", "-limit", "1"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected a header and one row, got %q", out.String())
+		}
+		if !strings.Contains(lines[1], "scanner unavailable") {
+			t.Errorf("expected the error on one line, got %q", lines[1])
+		}
+	})
+
+	t.Run("show prints the dead letter", func(t *testing.T) {
+		// Arrange
+		var out bytes.Buffer
+		cmd := NewDLQCommand(newFake(), &out)
+
+		// Act
+		err := cmd.Run(context.Background(), []string{"show", "b"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "smtp timeout") {
+			t.Errorf("expected the dead letter, got %q", out.String())
+		}
+	})
+
+	t.Run("replay passes every ID", func(t *testing.T) {
+		// Arrange
+		fake := newFake()
+		cmd := NewDLQCommand(fake, &bytes.Buffer{})
+
+		// Act
+		err := cmd.Run(context.Background(), []string{"replay", "a", "b"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Join(fake.replayed, ",") != "a,b" {
+			t.Errorf("expected a and b to be replayed, got %v", fake.replayed)
+		}
+	})
+
+	t.Run("purge parses the cutoff", func(t *testing.T) {
+		// Arrange
+		fake := newFake()
+		cmd := NewDLQCommand(fake, &bytes.Buffer{})
+
+		// Act
+		err := cmd.Run(context.Background(), []string{"purge", "-before", "2024-01-02T00:00:00Z"})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !fake.before.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected cutoff %v", fake.before)
+		}
+	})
+
+	t.Run("rejects invalid usage", func(t *testing.T) {
+		for _, args := range [][]string{
+			nil,
+			{"unknown"},
+			{"show"},
+			{"replay"},
+			{"purge"},
+			{"purge", "-older-than", "1h", "-before", "2024-01-02T00:00:00Z"},
+		} {
+			err := NewDLQCommand(newFake(), &bytes.Buffer{}).Run(context.Background(), args)
+			if !errors.Is(err, ErrUsage) {
+				t.Errorf("%v: expected ErrUsage, got %v", args, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package event
+
+import (
+	"context"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+type DeliveryConsumer struct {
+	userUploadedFile usecase.UserUploadedFile
+	logger           logger.Logger
+	bus              eventbus.Subscriber
+	queue            string
+}
+
+func NewDeliveryConsumer(u usecase.UserUploadedFile, bus eventbus.Subscriber, queue string, l logger.Logger) *DeliveryConsumer {
+	return &DeliveryConsumer{userUploadedFile: u, bus: bus, queue: queue, logger: l}
+}
+
+func (cs *DeliveryConsumer) StartConsume() {
+	cs.logger.Info("DeliveryConsumer - StartConsume: start consuming messages", "queue", cs.queue)
+
+	err := cs.bus.Subscribe(context.Background(), cs.queue, eventbus.HandlerOf(cs.processMessage))
+	if err != nil {
+		cs.logger.Error("DeliveryConsumer - StartConsume - bus.Subscribe: stopped consuming messages", "error", err)
+	}
+}
+
+func (cs *DeliveryConsumer) processMessage(ctx context.Context, delivery entity.Delivery) error {
+	cs.logger.Info("DeliveryConsumer - processMessage: received message", "deliveryID", delivery.ID)
+
+	err := cs.userUploadedFile.SendDeliveryEmail(ctx, delivery.ID)
+	if err != nil {
+		if apperrors.IsNothingDeliverableError(err) {
+			cs.logger.Warn("DeliveryConsumer - processMessage - userUploadedFile.SendDeliveryEmail: no deliverable file, email blocked", "deliveryID", delivery.ID, "error", err)
+			return nil
+		}
+		cs.logger.Error("DeliveryConsumer - processMessage - userUploadedFile.SendDeliveryEmail: failed to send email", "error", err)
+		return err
+	}
+	cs.logger.Info("DeliveryConsumer - processMessage: successfully sent email", "deliveryID", delivery.ID)
+	return nil
+}
@@ -0,0 +1,37 @@
+package event
+
+import (
+	"context"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// FileStatusConsumer passes the status transitions of files to the streams opened on this instance. The
+// queue is declared per instance, so every replica sees every event.
+type FileStatusConsumer struct {
+	fileStatus usecase.FileStatus
+	logger     logger.Logger
+	bus        eventbus.Subscriber
+	queue      string
+}
+
+func NewFileStatusConsumer(fs usecase.FileStatus, bus eventbus.Subscriber, queue string, l logger.Logger) *FileStatusConsumer {
+	return &FileStatusConsumer{fileStatus: fs, bus: bus, queue: queue, logger: l}
+}
+
+func (cs *FileStatusConsumer) StartConsume() {
+	cs.logger.Info("FileStatusConsumer - StartConsume: start consuming messages", "queue", cs.queue)
+
+	err := cs.bus.Subscribe(context.Background(), cs.queue, eventbus.HandlerOf(cs.processMessage))
+	if err != nil {
+		cs.logger.Error("FileStatusConsumer - StartConsume - bus.Subscribe: stopped consuming messages", "error", err)
+	}
+}
+
+func (cs *FileStatusConsumer) processMessage(ctx context.Context, event entity.FileEvent) error {
+	cs.fileStatus.Notify(ctx, event)
+	return nil
+}
@@ -0,0 +1,41 @@
+package event
+
+import (
+	"context"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// WebhookConsumer queues webhook deliveries for the file events published on the bus.
+type WebhookConsumer struct {
+	webhook usecase.Webhook
+	logger  logger.Logger
+	bus     eventbus.Subscriber
+	queue   string
+}
+
+func NewWebhookConsumer(w usecase.Webhook, bus eventbus.Subscriber, queue string, l logger.Logger) *WebhookConsumer {
+	return &WebhookConsumer{webhook: w, bus: bus, queue: queue, logger: l}
+}
+
+func (cs *WebhookConsumer) StartConsume() {
+	cs.logger.Info("WebhookConsumer - StartConsume: start consuming messages", "queue", cs.queue)
+
+	err := cs.bus.Subscribe(context.Background(), cs.queue, eventbus.HandlerOf(cs.processMessage))
+	if err != nil {
+		cs.logger.Error("WebhookConsumer - StartConsume - bus.Subscribe: stopped consuming messages", "error", err)
+	}
+}
+
+func (cs *WebhookConsumer) processMessage(ctx context.Context, event entity.FileEvent) error {
+	err := cs.webhook.Enqueue(ctx, event)
+	if err != nil {
+		cs.logger.Error("WebhookConsumer - processMessage - webhook.Enqueue: failed to queue webhook deliveries", "error", err)
+		return err
+	}
+	cs.logger.Info("WebhookConsumer - processMessage: successfully queued webhook deliveries", "eventID", event.ID, "type", event.Type)
+	return nil
+}
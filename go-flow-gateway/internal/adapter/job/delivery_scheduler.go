@@ -0,0 +1,42 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// DeliveryScheduler periodically publishes scheduled deliveries once their send time has passed.
+// The schedule lives in Postgres, so deliveries that fall due while the worker is down go out on the next tick.
+type DeliveryScheduler struct {
+	userUploadedFile usecase.UserUploadedFile
+	interval         time.Duration
+	logger           logger.Logger
+}
+
+func NewDeliveryScheduler(u usecase.UserUploadedFile, interval time.Duration, l logger.Logger) *DeliveryScheduler {
+	return &DeliveryScheduler{userUploadedFile: u, interval: interval, logger: l}
+}
+
+// Start publishes due deliveries on every tick until the context is cancelled.
+func (j *DeliveryScheduler) Start(ctx context.Context) {
+	j.logger.Info("DeliveryScheduler - Start: publishing due deliveries", "interval", j.interval.String())
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("DeliveryScheduler - Start: stopped")
+			return
+		case <-ticker.C:
+			err := j.userUploadedFile.PublishDueDeliveries(ctx)
+			if err != nil {
+				j.logger.Error("DeliveryScheduler - Start - userUploadedFile.PublishDueDeliveries: failed to publish due deliveries", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// RetentionJanitor periodically purges the content of uploaded files whose retention period is over.
+type RetentionJanitor struct {
+	userUploadedFile usecase.UserUploadedFile
+	interval         time.Duration
+	logger           logger.Logger
+}
+
+func NewRetentionJanitor(u usecase.UserUploadedFile, interval time.Duration, l logger.Logger) *RetentionJanitor {
+	return &RetentionJanitor{userUploadedFile: u, interval: interval, logger: l}
+}
+
+// Start purges expired files on every tick until the context is cancelled.
+func (j *RetentionJanitor) Start(ctx context.Context) {
+	j.logger.Info("RetentionJanitor - Start: purging expired files", "interval", j.interval.String())
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("RetentionJanitor - Start: stopped")
+			return
+		case <-ticker.C:
+			err := j.userUploadedFile.PurgeExpiredFiles(ctx)
+			if err != nil {
+				j.logger.Error("RetentionJanitor - Start - userUploadedFile.PurgeExpiredFiles: failed to purge expired files", "error", err)
+			}
+		}
+	}
+}
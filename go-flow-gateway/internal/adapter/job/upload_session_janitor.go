@@ -0,0 +1,41 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// UploadSessionJanitor periodically purges abandoned resumable upload sessions.
+type UploadSessionJanitor struct {
+	uploadSession usecase.UploadSession
+	interval      time.Duration
+	logger        logger.Logger
+}
+
+func NewUploadSessionJanitor(u usecase.UploadSession, interval time.Duration, l logger.Logger) *UploadSessionJanitor {
+	return &UploadSessionJanitor{uploadSession: u, interval: interval, logger: l}
+}
+
+// Start purges expired sessions on every tick until the context is cancelled.
+func (j *UploadSessionJanitor) Start(ctx context.Context) {
+	j.logger.Info("UploadSessionJanitor - Start: purging expired upload sessions", "interval", j.interval.String())
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("UploadSessionJanitor - Start: stopped")
+			return
+		case <-ticker.C:
+			err := j.uploadSession.PurgeExpired(ctx)
+			if err != nil {
+				j.logger.Error("UploadSessionJanitor - Start - uploadSession.PurgeExpired: failed to purge expired upload sessions", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// WebhookDispatcher periodically sends the webhook deliveries that are due, first attempts as well as retries.
+type WebhookDispatcher struct {
+	webhook  usecase.Webhook
+	interval time.Duration
+	logger   logger.Logger
+}
+
+func NewWebhookDispatcher(w usecase.Webhook, interval time.Duration, l logger.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{webhook: w, interval: interval, logger: l}
+}
+
+// Start sends due webhook deliveries on every tick until the context is cancelled.
+func (j *WebhookDispatcher) Start(ctx context.Context) {
+	j.logger.Info("WebhookDispatcher - Start: dispatching webhook deliveries", "interval", j.interval.String())
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("WebhookDispatcher - Start: stopped")
+			return
+		case <-ticker.C:
+			err := j.webhook.DispatchDue(ctx)
+			if err != nil {
+				j.logger.Error("WebhookDispatcher - Start - webhook.DispatchDue: failed to dispatch webhook deliveries", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const _adminTokenHeader = "X-Admin-Token"
+
+// _defaultDeadLetterLimit is the number of dead letters listed when no limit is given.
+const _defaultDeadLetterLimit = 50
+
+type adminRoutes struct {
+	userUploadFile usecase.UserUploadedFile
+	deadLetter     usecase.DeadLetter
+	logger         logger.Logger
+}
+
+// NewAdminRoutes registers the operator endpoints. They act on the files of every user and are
+// authenticated with the admin token instead of a session.
+func NewAdminRoutes(handler *gin.RouterGroup, uu usecase.UserUploadedFile, dl usecase.DeadLetter, cfg config.AdminConfig, l logger.Logger) {
+
+	r := &adminRoutes{uu, dl, l}
+
+	h := handler.Group("/admin")
+	{
+		h.Use(CheckAdminTokenMiddleware(cfg.Token))
+		h.POST("/user-uploaded-files/requeue-failed", r.requeueFailed)
+		h.GET("/dead-letters", r.getDeadLetters)
+		h.GET("/dead-letters/:id", r.getDeadLetter)
+		h.POST("/dead-letters/replay", r.replayDeadLetters)
+		h.DELETE("/dead-letters", r.purgeDeadLetters)
+	}
+}
+
+// CheckAdminTokenMiddleware only lets requests through that carry the admin token. Every request is
+// refused while no token is configured.
+func CheckAdminTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !validAdminToken(token, c.GetHeader(_adminTokenHeader)) {
+			sendErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func validAdminToken(token, presented string) bool {
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(presented)) == 1
+}
+
+type requeueFailedRequest struct {
+	From *time.Time `json:"from" example:"2024-01-01T00:00:00Z" binding:"required"`
+	To   *time.Time `json:"to" example:"2024-01-02T00:00:00Z"` // defaults to now
+}
+
+// requeue failed emails godoc
+//
+//	@Summary		Requeue failed emails
+//	@Description	Queue the emails and deliveries again whose last attempt failed within the window, emails being sent in the meantime are skipped
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Admin-Token			header	string					true	"admin token"
+//	@Param			requeueFailedRequest	body	requeueFailedRequest	true	"failure window"
+//	@Success		200	{object}	dto.RequeueResult
+//	@Failure		400	{object}	errorResponse
+//	@Failure		401	{object}	errorResponse
+//	@Failure		500	{object}	errorResponse
+//	@Router			/admin/user-uploaded-files/requeue-failed [post]
+func (r *adminRoutes) requeueFailed(c *gin.Context) {
+	var request requeueFailedRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		r.logger.Error("AdminRoutes - requeueFailed: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	to := time.Now()
+	if request.To != nil {
+		to = *request.To
+	}
+	if !request.From.Before(to) {
+		sendErrorResponse(c, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	result, err := r.userUploadFile.RequeueFailed(c.Request.Context(), *request.From, to)
+	if err != nil {
+		r.logger.Error("AdminRoutes - requeueFailed: failed to requeue failed emails", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to requeue failed emails")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// get dead letters godoc
+//
+//	@Summary		Get dead letters
+//	@Description	List the events whose consumer failed with the reason of the failure, the oldest first. The events themselves are left out
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"admin token"
+//	@Param			limit			query		int		false	"limit"
+//	@Success		200				{array}		entity.DeadLetter
+//	@Failure		400				{object}	errorResponse
+//	@Failure		401				{object}	errorResponse
+//	@Failure		500				{object}	errorResponse
+//	@Router			/admin/dead-letters [get]
+func (r *adminRoutes) getDeadLetters(c *gin.Context) {
+	limit := _defaultDeadLetterLimit
+	if q := c.Query("limit"); q != "" {
+		var err error
+		limit, err = strconv.Atoi(q)
+		if err != nil || limit < 1 {
+			r.logger.Error("AdminRoutes - getDeadLetters : invalid limit query parameter", err)
+			sendErrorResponse(c, http.StatusBadRequest, "invalid query parameter")
+			return
+		}
+	}
+
+	letters, err := r.deadLetter.List(c.Request.Context(), limit)
+	if err != nil {
+		r.logger.Error("AdminRoutes - getDeadLetters: failed to list dead letters", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to list dead letters")
+		return
+	}
+
+	c.JSON(http.StatusOK, letters)
+}
+
+// get dead letter godoc
+//
+//	@Summary		Get dead letter
+//	@Description	Get an event whose consumer failed together with the event
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"admin token"
+//	@Param			id				path		string	true	"dead letter id"
+//	@Success		200				{object}	entity.DeadLetter
+//	@Failure		401				{object}	errorResponse
+//	@Failure		404				{object}	errorResponse
+//	@Failure		500				{object}	errorResponse
+//	@Router			/admin/dead-letters/{id} [get]
+func (r *adminRoutes) getDeadLetter(c *gin.Context) {
+	letter, err := r.deadLetter.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		r.logger.Error("AdminRoutes - getDeadLetter: failed to get dead letter", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "dead letter not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to get dead letter")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, letter)
+}
+
+type replayDeadLettersRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=1000"`
+}
+
+type replayDeadLettersResponse struct {
+	Replayed int `json:"replayed" example:"2"`
+}
+
+// replay dead letters godoc
+//
+//	@Summary		Replay dead letters
+//	@Description	Publish the selected events again, every queue bound to an event receives it. IDs that are not found are ignored
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Admin-Token				header		string						true	"admin token"
+//	@Param			replayDeadLettersRequest	body		replayDeadLettersRequest	true	"dead letter ids"
+//	@Success		200							{object}	replayDeadLettersResponse
+//	@Failure		400							{object}	errorResponse
+//	@Failure		401							{object}	errorResponse
+//	@Failure		500							{object}	errorResponse
+//	@Router			/admin/dead-letters/replay [post]
+func (r *adminRoutes) replayDeadLetters(c *gin.Context) {
+	var request replayDeadLettersRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		r.logger.Error("AdminRoutes - replayDeadLetters: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	replayed, err := r.deadLetter.Replay(c.Request.Context(), request.IDs)
+	if err != nil {
+		r.logger.Error("AdminRoutes - replayDeadLetters: failed to replay dead letters", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to replay dead letters")
+		return
+	}
+
+	c.JSON(http.StatusOK, replayDeadLettersResponse{Replayed: replayed})
+}
+
+type purgeDeadLettersResponse struct {
+	Purged int `json:"purged" example:"10"`
+}
+
+// purge dead letters godoc
+//
+//	@Summary		Purge dead letters
+//	@Description	Remove the events whose consumer failed before the given time
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"admin token"
+//	@Param			before			query		string	true	"RFC 3339 time"
+//	@Success		200				{object}	purgeDeadLettersResponse
+//	@Failure		400				{object}	errorResponse
+//	@Failure		401				{object}	errorResponse
+//	@Failure		500				{object}	errorResponse
+//	@Router			/admin/dead-letters [delete]
+func (r *adminRoutes) purgeDeadLetters(c *gin.Context) {
+	before, err := time.Parse(time.RFC3339, c.Query("before"))
+	if err != nil {
+		r.logger.Error("AdminRoutes - purgeDeadLetters : invalid before query parameter", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid query parameter")
+		return
+	}
+
+	purged, err := r.deadLetter.Purge(c.Request.Context(), before)
+	if err != nil {
+		r.logger.Error("AdminRoutes - purgeDeadLetters: failed to purge dead letters", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to purge dead letters")
+		return
+	}
+
+	c.JSON(http.StatusOK, purgeDeadLettersResponse{Purged: purged})
+}
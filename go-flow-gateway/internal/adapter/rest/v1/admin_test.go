@@ -0,0 +1,26 @@
+package v1
+
+import "testing"
+
+func TestValidAdminToken(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		token     string
+		presented string
+		expected  bool
+	}{
+		{"accepts the configured token", "secret", "secret", true},
+		{"rejects another token", "secret", "other", false},
+		{"rejects a missing token", "secret", "", false},
+		{"rejects everything without a configured token", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validAdminToken(tt.token, tt.presented); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
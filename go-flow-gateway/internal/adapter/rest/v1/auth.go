@@ -2,17 +2,34 @@ package v1
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/config"
 	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// _sessionIDKey holds in the session the id under which it is indexed among the sessions of its user.
+const _sessionIDKey = "sessionID"
+
+// The LINE login in progress is kept in the session until LINE redirects back to lineCallback.
+const (
+	_lineLoginStateKey        = "lineLoginState"
+	_lineLoginNonceKey        = "lineLoginNonce"
+	_lineLoginCodeVerifierKey = "lineLoginCodeVerifier"
+	_lineLoginExpiresAtKey    = "lineLoginExpiresAt" // unix ms
 )
 
 type authRoutes struct {
@@ -21,15 +38,25 @@ type authRoutes struct {
 	logger         logger.Logger
 	oauthDetail    usecase.OAuthDetail
 	userCredential usecase.UserCredential
+	verification   usecase.EmailVerification
+	password       usecase.Password
+	twoFactor      usecase.TwoFactor
+	sessions       usecase.Session
 	lineChannelID  string
+	oauthStateTTL  time.Duration
 }
 
-func NewAuthRoutes(cfg *config.Config, handler *gin.RouterGroup, u usecase.UserProfile, l logger.Logger, o usecase.OAuthDetail, c usecase.UserCredential, lineChannelID string) {
-	r := authRoutes{domainUrl: cfg.App.DomainUrl, userProfile: u, logger: l, oauthDetail: o, userCredential: c, lineChannelID: lineChannelID}
+func NewAuthRoutes(cfg *config.Config, handler *gin.RouterGroup, u usecase.UserProfile, l logger.Logger, o usecase.OAuthDetail, c usecase.UserCredential, ev usecase.EmailVerification, p usecase.Password, tf usecase.TwoFactor, s usecase.Session, lineChannelID string) {
+	r := authRoutes{domainUrl: cfg.App.DomainUrl, userProfile: u, logger: l, oauthDetail: o, userCredential: c, verification: ev, password: p, twoFactor: tf, sessions: s, lineChannelID: lineChannelID, oauthStateTTL: cfg.OAuth.StateTTL}
 	auth := handler.Group("/auth")
 	{
 		auth.POST("/register", r.register)
 		auth.POST("/login", r.login)
+		auth.GET("/verify-email", r.verifyEmail)
+		auth.POST("/verify-email/resend", CheckSessionMiddleware(), r.resendVerification)
+		auth.POST("/password/forgot", r.forgotPassword)
+		auth.POST("/password/reset", r.resetPassword)
+		auth.POST("/password/change", CheckSessionMiddleware(), r.changePassword)
 		auth.GET("/line-login", r.lineLogin)       // Initiate Line Login
 		auth.GET("/line-callback", r.lineCallback) // Handler the redirect from Line Login
 		auth.GET("/logout", r.logout)
@@ -40,6 +67,7 @@ type RegisterRequest struct {
 	DisplayName string `json:"displayName" example:"billyang"`
 	Username    string `json:"username" binding:"required" example:"useraname"`
 	Password    string `json:"password" binding:"required" example:"password"`
+	Email       string `json:"email" binding:"required,email,max=255" example:"billyang@mail.com"`
 }
 
 type RegisterResponse struct {
@@ -49,24 +77,34 @@ type RegisterResponse struct {
 // register godoc
 //
 //	@Summary		Register
-//	@Description	Register
+//	@Description	Register a local account, a link verifying the email is sent to it
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			RegisterRequest	body		RegisterRequest		true	"register information"
 //	@Success		200				{object}	RegisterResponse	"Succesfully registered"
+//	@Failure		400				{object}	errorResponse		"Invalid request or password rejected by the policy"
 //	@Router			/auth/register [post]
 func (r *authRoutes) register(c *gin.Context) {
 	var req RegisterRequest
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
 		r.logger.Warn("AuthRoutes - register: invalid request body", err)
-		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		if validationErrs, ok := err.(validator.ValidationErrors); ok {
+			sendValidationErrorResponse(c, validationErrs)
+		} else {
+			sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		}
 		return
 	}
 
-	userID, err := r.userCredential.Register(c.Request.Context(), req.DisplayName, req.Username, req.Password)
+	userID, err := r.userCredential.Register(c.Request.Context(), req.DisplayName, req.Username, req.Password, req.Email)
 	if err != nil {
+		if apperrors.IsPasswordPolicyViolationError(err) {
+			r.logger.Warn("AuthRoutes - register: password rejected", "error", err)
+			sendValidationErrorResponse(c, err)
+			return
+		}
 		r.logger.Error("AuthRoutes - register: register failed", err)
 		sendErrorResponse(c, http.StatusInternalServerError, "register failed")
 		return
@@ -76,20 +114,82 @@ func (r *authRoutes) register(c *gin.Context) {
 	c.JSON(http.StatusOK, RegisterResponse{UserID: fmt.Sprint(userID)})
 }
 
+// verifyEmail godoc
+//
+//	@Summary		Verify Email
+//	@Description	Open the link sent by email to verify it, then redirect to the app with emailVerified set to true or false
+//	@Tags			Auth
+//	@Param			token	query		string	true		"Token of the verification link"
+//	@Success		307		{string}	string	Location	"Redirect URL"
+//	@Router			/auth/verify-email [get]
+func (r *authRoutes) verifyEmail(c *gin.Context) {
+	err := r.verification.Verify(c.Request.Context(), c.Query("token"))
+	if err != nil && !apperrors.IsNoRowsAffectedError(err) {
+		r.logger.Error("AuthRoutes - verifyEmail: failed to verify email", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to verify email")
+		return
+	}
+
+	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s?emailVerified=%t", r.domainUrl, err == nil))
+}
+
+// resendVerification godoc
+//
+//	@Summary		Resend Email Verification
+//	@Description	Send a new link verifying the email of the account, the earlier links stop working
+//	@Tags			Auth
+//	@Success		204	{object}	nil				"No content"
+//	@Failure		404	{object}	errorResponse	"The account has no email"
+//	@Failure		409	{object}	errorResponse	"The email is already verified"
+//	@Failure		429	{object}	errorResponse	"A link was sent recently, retry after the Retry-After header"
+//	@Router			/auth/verify-email/resend [post]
+func (r *authRoutes) resendVerification(c *gin.Context) {
+	userID, _ := currentUserID(c)
+
+	err := r.verification.Resend(c.Request.Context(), userID)
+	if err != nil {
+		if rle, ok := apperrors.AsRetryLaterError(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rle.RetryAfter.Seconds()))))
+			sendErrorResponse(c, http.StatusTooManyRequests, rle.Message)
+			return
+		}
+		if apperrors.IsEmailAlreadyVerifiedError(err) {
+			sendErrorResponse(c, http.StatusConflict, "the email is already verified")
+			return
+		}
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "the account has no email to verify")
+			return
+		}
+		r.logger.Error("AuthRoutes - resendVerification: failed to resend verification", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to resend verification")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 type LoginRequest struct {
 	Username string `json:"username" example:"username" binding:"required"`
 	Password string `json:"password" example:"password" binding:"required"`
 }
 
+type LoginResponse struct {
+	TwoFactorRequired bool `json:"twoFactorRequired" example:"true"`
+}
+
 // login godoc
 //
 //	@Summary		Login
-//	@Description	Login
+//	@Description	Login. Users with two-factor authentication enabled are only logged in once they give a code to /auth/two-factor/verify
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			LoginRequest	body		LoginRequest	true	"login information"
+//	@Success		202				{object}	LoginResponse	"Password accepted, waiting for the second factor"
 //	@Success		204				{object}	nil				"No content"
+//	@Failure		401				{object}	errorResponse	"Invalid username or password"
+//	@Failure		429				{object}	errorResponse	"Too many failed attempts, retry after the Retry-After header"
 //	@Router			/auth/login [post]
 func (r *authRoutes) login(c *gin.Context) {
 	var req LoginRequest
@@ -100,47 +200,231 @@ func (r *authRoutes) login(c *gin.Context) {
 		return
 	}
 
-	uc, err := r.userCredential.Login(c.Request.Context(), req.Username, req.Password)
+	uc, err := r.userCredential.Login(c.Request.Context(), req.Username, req.Password, c.ClientIP())
 	if err != nil {
+		if lte, ok := apperrors.AsLoginThrottledError(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lte.RetryAfter.Seconds()))))
+			sendErrorResponse(c, http.StatusTooManyRequests, "too many failed login attempts, try again later")
+			return
+		}
+		if apperrors.IsInvalidCredentialsError(err) {
+			sendErrorResponse(c, http.StatusUnauthorized, "invalid username or password")
+			return
+		}
 		r.logger.Error("AuthRoutes - login: login failed", err)
-		sendErrorResponse(c, http.StatusUnauthorized, "login failed")
+		sendErrorResponse(c, http.StatusInternalServerError, "login failed")
 		return
 	}
 
-	err = r.setUserSession(c, uc.UserID)
+	pending, err := r.beginUserSession(c, uc.UserID)
 	if err != nil {
 		r.logger.Error("AuthRoutes - login: failed to set user session", err)
 		sendErrorResponse(c, http.StatusInternalServerError, "login failed")
 		return
 	}
+	if pending {
+		c.JSON(http.StatusAccepted, LoginResponse{TwoFactorRequired: true})
+		return
+	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"billyang@mail.com"`
+}
+
+// forgotPassword godoc
+//
+//	@Summary		Forgot Password
+//	@Description	Email a link resetting the password to the account with the email. The response is the same whether an account has the email or not
+//	@Tags			Auth
+//	@Accept			json
+//	@Param			ForgotPasswordRequest	body		ForgotPasswordRequest	true	"email of the account"
+//	@Success		202						{object}	nil						"Accepted"
+//	@Failure		400						{object}	errorResponse			"Invalid request"
+//	@Router			/auth/password/forgot [post]
+func (r *authRoutes) forgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		r.logger.Warn("AuthRoutes - forgotPassword: invalid request body", err)
+		if validationErrs, ok := err.(validator.ValidationErrors); ok {
+			sendValidationErrorResponse(c, validationErrs)
+		} else {
+			sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		}
+		return
+	}
+
+	r.password.Forgot(c.Request.Context(), req.Email)
+	c.Status(http.StatusAccepted)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"token"`
+	Password string `json:"password" binding:"required" example:"password"`
+}
+
+// resetPassword godoc
+//
+//	@Summary		Reset Password
+//	@Description	Choose a new password with the token of a reset link, every session of the user is logged out
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			ResetPasswordRequest	body		ResetPasswordRequest	true	"token of the reset link and new password"
+//	@Success		204						{object}	nil						"No content"
+//	@Failure		400						{object}	errorResponse			"Invalid request, invalid or expired token, or password rejected by the policy"
+//	@Router			/auth/password/reset [post]
+func (r *authRoutes) resetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		r.logger.Warn("AuthRoutes - resetPassword: invalid request body", err)
+		if validationErrs, ok := err.(validator.ValidationErrors); ok {
+			sendValidationErrorResponse(c, validationErrs)
+		} else {
+			sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		}
+		return
+	}
+
+	err = r.password.Reset(c.Request.Context(), req.Token, req.Password)
+	if err != nil {
+		if apperrors.IsPasswordPolicyViolationError(err) {
+			sendValidationErrorResponse(c, err)
+			return
+		}
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusBadRequest, "the reset link is invalid or has expired")
+			return
+		}
+		r.logger.Error("AuthRoutes - resetPassword: failed to reset password", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to reset password")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required" example:"password"`
+	NewPassword     string `json:"newPassword" binding:"required" example:"new password"`
+}
+
+// changePassword godoc
+//
+//	@Summary		Change Password
+//	@Description	Change the password knowing the current one, the other sessions of the user are logged out
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			ChangePasswordRequest	body		ChangePasswordRequest	true	"current and new password"
+//	@Success		204						{object}	nil						"No content"
+//	@Failure		400						{object}	errorResponse			"Invalid request or password rejected by the policy"
+//	@Failure		403						{object}	errorResponse			"The current password is incorrect"
+//	@Failure		409						{object}	errorResponse			"The account signs in through an OAuth provider and has no password"
+//	@Router			/auth/password/change [post]
+func (r *authRoutes) changePassword(c *gin.Context) {
+	userID, _ := currentUserID(c)
+
+	var req ChangePasswordRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		r.logger.Warn("AuthRoutes - changePassword: invalid request body", err)
+		if validationErrs, ok := err.(validator.ValidationErrors); ok {
+			sendValidationErrorResponse(c, validationErrs)
+		} else {
+			sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		}
+		return
+	}
+
+	err = r.password.Change(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if apperrors.IsPasswordPolicyViolationError(err) {
+			sendValidationErrorResponse(c, err)
+			return
+		}
+		if apperrors.IsInvalidCredentialsError(err) {
+			sendErrorResponse(c, http.StatusForbidden, "current password is incorrect")
+			return
+		}
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusConflict, "the account has no password")
+			return
+		}
+		r.logger.Error("AuthRoutes - changePassword: failed to change password", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to change password")
+		return
+	}
+
+	// every session was revoked, issuing this one again keeps the user logged in here
+	err = setUserSession(c, r.sessions, userID)
+	if err != nil {
+		r.logger.Error("AuthRoutes - changePassword: failed to set user session", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to keep the session")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // generateState godoc
 //
-// prepare a random string for the state parameter to prevent CSRF attacks
-func generateState() string {
-	b := make([]byte, 16)
-	rand.Read(b)
-	return base64.URLEncoding.EncodeToString(b)
+// prepare a random URL-safe string for the state, nonce and PKCE code verifier of a login, 43 characters long
+// as PKCE requires at least that many
+func generateState() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 // lineLogin godoc
 //
 //	@Summary		Line Login
-//	@Description	Redirect to Line Login
+//	@Description	Redirect to Line Login. The state, nonce and PKCE code verifier of the login are kept in the session until Line redirects back
 //	@Tags			Auth
 //	@Produce		html
 //	@Success		302	{string}	string	Location	"Redirect URL"
+//	@Failure		500	{object}	errorResponse
 //	@Router			/auth/line-login [get]
 func (r *authRoutes) lineLogin(c *gin.Context) {
-	state := generateState()
-	lineAuthUrl := fmt.Sprintf("https://access.line.me/oauth2/v2.1/authorize?response_type=code&client_id=%s&redirect_uri=%s&state=%s&scope=profile%%20openid&nonce=%s",
-		url.QueryEscape(os.Getenv("LINE_CHANNEL_ID")),
+	var flow [3]string
+	for i := range flow {
+		value, err := generateState()
+		if err != nil {
+			r.logger.Error("AuthRoutes - lineLogin: failed to generate state", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "failed to start the login")
+			return
+		}
+		flow[i] = value
+	}
+	state, nonce, codeVerifier := flow[0], flow[1], flow[2]
+
+	session := sessions.Default(c)
+	session.Set(_lineLoginStateKey, state)
+	session.Set(_lineLoginNonceKey, nonce)
+	session.Set(_lineLoginCodeVerifierKey, codeVerifier)
+	session.Set(_lineLoginExpiresAtKey, time.Now().Add(r.oauthStateTTL).UnixMilli())
+	err := session.Save()
+	if err != nil {
+		r.logger.Error("AuthRoutes - lineLogin: failed to save session", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to start the login")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	lineAuthUrl := fmt.Sprintf("https://access.line.me/oauth2/v2.1/authorize?response_type=code&client_id=%s&redirect_uri=%s&state=%s&scope=profile%%20openid&nonce=%s&code_challenge=%s&code_challenge_method=S256",
+		url.QueryEscape(r.lineChannelID),
 		url.QueryEscape(fmt.Sprintf("%s/api/v1/auth/line-callback", r.domainUrl)),
 		state,
-		state, // nonce can be the same as state for simplicity in this example
+		nonce,
+		base64.RawURLEncoding.EncodeToString(challenge[:]),
 	)
 
 	r.logger.Info("AuthRoutes - lineLogin: redirect to line login")
@@ -150,12 +434,51 @@ func (r *authRoutes) lineLogin(c *gin.Context) {
 // lineCallback godoc
 //
 //	@Summary		Line Callback
-//	@Description	Handler the redirect from Line Login and set user session
+//	@Description	Handler the redirect from Line Login and set user session, users with two-factor authentication enabled are redirected with twoFactorRequired=true to give their code first. The state must be the one of the login started in this session before it expired. Logins Line reports as failed, such as when the user cancels, are redirected with lineLoginError set to the Line error code
 //	@Tags			Auth
-//	@Param			code	query		string	true		"Authorization code returned from Line Login"
-//	@Success		302		{string}	string	Location	"Redirect URL"
+//	@Param			code				query		string	false		"Authorization code returned from Line Login"
+//	@Param			state				query		string	true		"State of the login, as sent to Line Login"
+//	@Param			error				query		string	false		"Error code returned from Line Login instead of a code"
+//	@Param			error_description	query		string	false		"Description of the error returned from Line Login"
+//	@Success		302					{string}	string	Location	"Redirect URL"
+//	@Failure		400					{object}	errorResponse
+//	@Failure		401					{object}	errorResponse
 //	@Router			/auth/line-callback [get]
 func (r *authRoutes) lineCallback(c *gin.Context) {
+	// the login in progress is used up by its callback, whatever the outcome
+	session := sessions.Default(c)
+	state, _ := session.Get(_lineLoginStateKey).(string)
+	nonce, _ := session.Get(_lineLoginNonceKey).(string)
+	codeVerifier, _ := session.Get(_lineLoginCodeVerifierKey).(string)
+	expiresAt, _ := session.Get(_lineLoginExpiresAtKey).(int64)
+	session.Delete(_lineLoginStateKey)
+	session.Delete(_lineLoginNonceKey)
+	session.Delete(_lineLoginCodeVerifierKey)
+	session.Delete(_lineLoginExpiresAtKey)
+	err := session.Save()
+	if err != nil {
+		r.logger.Error("AuthRoutes - lineCallback: failed to save session", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	if state == "" || time.Now().UnixMilli() >= expiresAt {
+		r.logger.Warn("AuthRoutes - lineCallback: no line login in progress")
+		sendErrorResponse(c, http.StatusBadRequest, "the login has expired, start again")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(state)) != 1 {
+		r.logger.Warn("AuthRoutes - lineCallback: state does not match the login in progress")
+		sendErrorResponse(c, http.StatusBadRequest, "invalid state")
+		return
+	}
+
+	if lineError := c.Query("error"); lineError != "" {
+		r.logger.Warn("AuthRoutes - lineCallback: line login failed", "error", lineError, "description", c.Query("error_description"))
+		c.Redirect(http.StatusTemporaryRedirect, r.domainUrl+"?lineLoginError="+url.QueryEscape(lineError))
+		return
+	}
+
 	code := c.Query("code")
 	if code == "" {
 		r.logger.Warn("AuthRoutes - lineCallback: code is empty")
@@ -163,19 +486,27 @@ func (r *authRoutes) lineCallback(c *gin.Context) {
 		return
 	}
 
-	oAuthDetail, err := r.oauthDetail.HandleOAuthCallback(c.Request.Context(), code, r.domainUrl, "line", r.lineChannelID)
+	oAuthDetail, err := r.oauthDetail.HandleOAuthCallback(c.Request.Context(), code, codeVerifier, nonce, r.domainUrl, "line", r.lineChannelID)
 	if err != nil {
+		if apperrors.IsInvalidCredentialsError(err) {
+			sendErrorResponse(c, http.StatusUnauthorized, "the login could not be verified, start again")
+			return
+		}
 		r.logger.Error("AuthRoutes - lineCallback: failed to handle oauth callback", err)
 		sendErrorResponse(c, http.StatusInternalServerError, "failed to handle oauth callback")
 		return
 	}
 
-	err = r.setUserSession(c, oAuthDetail.UserID)
+	pending, err := r.beginUserSession(c, oAuthDetail.UserID)
 	if err != nil {
 		r.logger.Error("AuthRoutes - lineCallback: failed to set user session", err)
 		sendErrorResponse(c, http.StatusInternalServerError, "login failed")
 		return
 	}
+	if pending {
+		c.Redirect(http.StatusTemporaryRedirect, r.domainUrl+"?twoFactorRequired=true")
+		return
+	}
 
 	c.Redirect(http.StatusTemporaryRedirect, r.domainUrl)
 }
@@ -188,9 +519,13 @@ func (r *authRoutes) lineCallback(c *gin.Context) {
 //	@Success		204	{object}	nil	"No content"
 //	@Router			/auth/logout [get]
 func (r *authRoutes) logout(c *gin.Context) {
-	session := sessions.Default(c)
-	session.Delete("userID")
-	err := session.Save()
+	err := clearUserSession(c, r.sessions)
+	if err != nil {
+		r.logger.Error("AuthRoutes - logout: failed to revoke session", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to logout")
+		return
+	}
+	err = sessions.Default(c).Save()
 	if err != nil {
 		sendErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -199,13 +534,63 @@ func (r *authRoutes) logout(c *gin.Context) {
 	c.JSON(http.StatusOK, nil)
 }
 
-func (r *authRoutes) setUserSession(c *gin.Context, userID int) error {
+// beginUserSession logs the user in once their first factor has passed. Users with two-factor
+// authentication enabled get a pending challenge in their session instead, it is reported as pending.
+func (r *authRoutes) beginUserSession(c *gin.Context, userID int) (bool, error) {
+	enabled, err := r.twoFactor.Enabled(c.Request.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, setUserSession(c, r.sessions, userID)
+	}
+
+	challengeID, err := r.twoFactor.StartChallenge(c.Request.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+
+	err = clearUserSession(c, r.sessions)
+	if err != nil {
+		return false, err
+	}
 	session := sessions.Default(c)
-	session.Set("userID", userID)
-	err := session.Save()
+	session.Set(_twoFactorChallengeKey, challengeID)
+	return true, session.Save()
+}
+
+// setUserSession logs the user in with a new session, in place of any session the request was carrying.
+func setUserSession(c *gin.Context, s usecase.Session, userID int) error {
+	err := clearUserSession(c, s)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := s.Start(c.Request.Context(), userID, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		return err
 	}
 
+	session := sessions.Default(c)
+	session.Set("userID", userID)
+	session.Set(_sessionIDKey, sessionID)
+	return session.Save()
+}
+
+// clearUserSession revokes the session the request is carrying and logs it out, the caller saves it.
+func clearUserSession(c *gin.Context, s usecase.Session) error {
+	session := sessions.Default(c)
+	userID, loggedIn := session.Get("userID").(int)
+	sessionID, indexed := session.Get(_sessionIDKey).(string)
+	if loggedIn && indexed {
+		err := s.Revoke(c.Request.Context(), userID, sessionID)
+		if err != nil && !apperrors.IsNoRowsAffectedError(err) {
+			return err
+		}
+	}
+
+	session.Delete("userID")
+	session.Delete(_sessionIDKey)
+	session.Delete(_twoFactorChallengeKey)
 	return nil
 }
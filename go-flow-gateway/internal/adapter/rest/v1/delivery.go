@@ -0,0 +1,124 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type deliveryRoutes struct {
+	userUploadFile usecase.UserUploadedFile
+	logger         logger.Logger
+}
+
+func NewDeliveryRoutes(handler *gin.RouterGroup, uu usecase.UserUploadedFile, l logger.Logger) {
+
+	r := &deliveryRoutes{uu, l}
+
+	h := handler.Group("/deliveries")
+	{
+		h.Use(CheckScopeMiddleware(entity.ScopeFilesWrite))
+		h.PATCH("/:id", r.reschedule)
+		h.POST("/:id/cancel", r.cancel)
+	}
+}
+
+type rescheduleDeliveryRequest struct {
+	SendAt *time.Time `json:"sendAt" example:"2024-01-01T09:00:00Z" binding:"required"`
+}
+
+// reschedule delivery godoc
+//
+//	@Summary		Reschedule delivery
+//	@Description	Move the send time of a scheduled delivery, only deliveries that have not been sent yet can be rescheduled
+//	@Tags			Delivery
+//	@Accept			json
+//	@Param			id							path	int							true	"delivery id"
+//	@Param			rescheduleDeliveryRequest	body	rescheduleDeliveryRequest	true	"new send time"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		422	{object}	errorResponse
+//	@Router			/deliveries/{id} [patch]
+func (r *deliveryRoutes) reschedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("DeliveryRoutes - reschedule : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var request rescheduleDeliveryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		r.logger.Error("DeliveryRoutes - reschedule: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("DeliveryRoutes - reschedule: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	err = r.userUploadFile.RescheduleDelivery(c.Request.Context(), id, userID, *request.SendAt)
+	if err != nil {
+		r.logger.Error("DeliveryRoutes - reschedule: failed to reschedule delivery", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "scheduled delivery not found")
+		} else if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+			sendUploadPolicyErrorResponse(c, upve)
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to reschedule delivery")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// cancel delivery godoc
+//
+//	@Summary		Cancel delivery
+//	@Description	Cancel a scheduled delivery, only deliveries that have not been sent yet can be cancelled
+//	@Tags			Delivery
+//	@Param			id	path	int	true	"delivery id"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Router			/deliveries/{id}/cancel [post]
+func (r *deliveryRoutes) cancel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("DeliveryRoutes - cancel : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("DeliveryRoutes - cancel: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	err = r.userUploadFile.CancelDelivery(c.Request.Context(), id, userID)
+	if err != nil {
+		r.logger.Error("DeliveryRoutes - cancel: failed to cancel delivery", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "scheduled delivery not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to cancel delivery")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
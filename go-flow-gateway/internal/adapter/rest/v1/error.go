@@ -1,14 +1,17 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
 type errorResponse struct {
+	Code      string            `json:"code,omitempty" example:"code"`
 	Message   string            `json:"message" example:"message"`
 	FieldErrs map[string]string `json:"fieldErrs,omitempty"`
 }
@@ -17,8 +20,19 @@ func sendErrorResponse(c *gin.Context, code int, msg string) {
 	c.JSON(code, errorResponse{Message: msg})
 }
 
-func sendValidationErrorResponse(c *gin.Context, validationErrs validator.ValidationErrors) {
+func sendCodedErrorResponse(c *gin.Context, status int, code, msg string) {
+	c.JSON(status, errorResponse{Code: code, Message: msg})
+}
+
+// sendValidationErrorResponse reports the fields rejected by the binding validator or by a password policy.
+func sendValidationErrorResponse(c *gin.Context, err error) {
 	errMessages := make(map[string]string)
+	if ppve, ok := apperrors.AsPasswordPolicyViolationError(err); ok {
+		errMessages[ppve.Field] = ppve.Error()
+	}
+
+	var validationErrs validator.ValidationErrors
+	errors.As(err, &validationErrs)
 	for _, err := range validationErrs {
 		switch err.Tag() {
 		case "required":
@@ -0,0 +1,89 @@
+package v1
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// _fileStatusKeepAlive is how often a comment is written to idle streams so proxies do not close them.
+const _fileStatusKeepAlive = 15 * time.Second
+
+// fileStatusEventNames maps the file events to the names of the server-sent events.
+var fileStatusEventNames = map[string]string{
+	entity.FileEventCreated:     "created",
+	entity.FileEventScanning:    "scanning",
+	entity.FileEventEmailed:     "emailed",
+	entity.FileEventEmailFailed: "failed",
+	entity.FileEventDeleted:     "deleted",
+}
+
+type fileStatusRoutes struct {
+	fileStatus usecase.FileStatus
+	logger     logger.Logger
+}
+
+func NewFileStatusRoutes(handler *gin.RouterGroup, fs usecase.FileStatus, l logger.Logger) {
+
+	r := &fileStatusRoutes{fs, l}
+
+	h := handler.Group("/user-uploaded-files")
+	{
+		h.Use(CheckScopeMiddleware(entity.ScopeFilesRead))
+		h.GET("/events", r.stream)
+	}
+}
+
+// stream file status godoc
+//
+//	@Summary		Stream file status
+//	@Description	Server-sent events about the status transitions of the files of the user. The event name is created, scanning, emailed, failed or deleted and the data is the file event
+//	@Tags			User Uploaded File
+//	@Produce		text/event-stream
+//	@Success		200	{object}	entity.FileEvent
+//	@Failure		401	{object}	errorResponse
+//	@Router			/user-uploaded-files/events [get]
+func (r *fileStatusRoutes) stream(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("FileStatusRoutes - stream: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	events := r.fileStatus.Subscribe(c.Request.Context(), userID)
+	keepAlive := time.NewTicker(_fileStatusKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable response buffering of nginx
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// the channel is closed once the client goes away
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			name, known := fileStatusEventNames[event.Type]
+			if !known {
+				continue
+			}
+			c.SSEvent(name, event)
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFileStatus hands out the given events to the subscriber and then ends the stream.
+type fakeFileStatus struct {
+	events []entity.FileEvent
+	userID int
+}
+
+func (f *fakeFileStatus) Subscribe(ctx context.Context, userID int) <-chan entity.FileEvent {
+	f.userID = userID
+	ch := make(chan entity.FileEvent, len(f.events))
+	for _, event := range f.events {
+		ch <- event
+	}
+	close(ch)
+	return ch
+}
+
+func (f *fakeFileStatus) Notify(ctx context.Context, event entity.FileEvent) {}
+
+func TestFileStatusRoute_Stream(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	setupRouter := func(fs usecase.FileStatus, userID int) *gin.Engine {
+		router := gin.New()
+		router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+		router.Use(func(c *gin.Context) {
+			if userID != 0 {
+				sessions.Default(c).Set("userID", userID)
+			}
+			c.Next()
+		})
+		NewFileStatusRoutes(router.Group("/api/v1"), fs, logger.New("debug"))
+		return router
+	}
+
+	t.Run("should stream the status transitions of the files of the user", func(t *testing.T) {
+		// Arrange
+		fs := &fakeFileStatus{events: []entity.FileEvent{
+			{ID: "evt-1", Type: entity.FileEventScanning, File: entity.UserUploadedFile{ID: 10, UserID: 1}},
+			{ID: "evt-2", Type: entity.FileEventEmailFailed, File: entity.UserUploadedFile{ID: 10, UserID: 1}},
+		}}
+		router := setupRouter(fs, 1)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/user-uploaded-files/events", nil)
+		w := httptest.NewRecorder()
+
+		// Act
+		router.ServeHTTP(w, req)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, 1, fs.userID, "The stream should be scoped to the session user")
+		body := w.Body.String()
+		assert.Contains(t, body, "event:scanning\n")
+		assert.Contains(t, body, "event:failed\n")
+		assert.Contains(t, body, `"id":"evt-2"`)
+	})
+
+	t.Run("should reject requests without a session", func(t *testing.T) {
+		// Arrange
+		router := setupRouter(&fakeFileStatus{}, 0)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/user-uploaded-files/events", nil)
+		w := httptest.NewRecorder()
+
+		// Act
+		router.ServeHTTP(w, req)
+
+		// Assert
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -0,0 +1,83 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type mailEventRoutes struct {
+	userUploadFile usecase.UserUploadedFile
+	logger         logger.Logger
+}
+
+// NewMailEventRoutes registers the callbacks the mail provider sends about the delivery of emails. They are
+// authenticated with an HMAC signature instead of a session.
+func NewMailEventRoutes(handler *gin.RouterGroup, uu usecase.UserUploadedFile, cfg config.MailWebhookConfig, l logger.Logger) {
+
+	r := &mailEventRoutes{uu, l}
+
+	h := handler.Group("/webhooks")
+	{
+		h.POST("/mail-events", VerifySignatureMiddleware(cfg.Secret, cfg.Tolerance), r.receive)
+	}
+}
+
+type mailEventRequest struct {
+	Type       string     `json:"type" example:"bounced" binding:"required,oneof=delivered bounced complained"`
+	MessageID  string     `json:"messageId" example:"3f2a9c@mail.com" binding:"required"`
+	Recipient  string     `json:"recipient" example:"johndoe@email.com" binding:"required,email"`
+	Reason     *string    `json:"reason" example:"550 5.1.1 mailbox does not exist"`
+	OccurredAt *time.Time `json:"occurredAt" example:"2024-01-01T09:00:00Z" binding:"required"`
+}
+
+type mailEventsRequest struct {
+	Events []mailEventRequest `json:"events" binding:"required,min=1,max=100,dive"`
+}
+
+// receive mail events godoc
+//
+//	@Summary		Receive mail events
+//	@Description	Delivery, bounce and complaint callbacks of the mail provider. The body is signed with HMAC-SHA256 over "<timestamp>.<body>" using the shared secret
+//	@Tags			Webhook
+//	@Accept			json
+//	@Param			X-Webhook-Timestamp	header	string				true	"unix timestamp of the signature"
+//	@Param			X-Webhook-Signature	header	string				true	"sha256=<hex encoded HMAC>"
+//	@Param			mailEventsRequest	body	mailEventsRequest	true	"mail events"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		401	{object}	errorResponse
+//	@Router			/webhooks/mail-events [post]
+func (r *mailEventRoutes) receive(c *gin.Context) {
+	var request mailEventsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		r.logger.Error("MailEventRoutes - receive: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	events := make([]entity.MailEvent, len(request.Events))
+	for i, e := range request.Events {
+		events[i] = entity.MailEvent{
+			Type:       e.Type,
+			MessageID:  e.MessageID,
+			Recipient:  e.Recipient,
+			Reason:     e.Reason,
+			OccurredAt: *e.OccurredAt,
+		}
+	}
+
+	err := r.userUploadFile.HandleMailEvents(c.Request.Context(), events)
+	if err != nil {
+		r.logger.Error("MailEventRoutes - receive: failed to handle mail events", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to handle mail events")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,166 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+type meRoutes struct {
+	userUploadFile usecase.UserUploadedFile
+	sessions       usecase.Session
+	logger         logger.Logger
+}
+
+func NewMeRoutes(handler *gin.RouterGroup, uu usecase.UserUploadedFile, s usecase.Session, l logger.Logger) {
+
+	r := &meRoutes{uu, s, l}
+
+	h := handler.Group("/me")
+	{
+		h.GET("/usage", CheckScopeMiddleware(entity.ScopeFilesRead), r.getUsage)
+		h.GET("/sessions", CheckSessionMiddleware(), r.listSessions)
+		h.DELETE("/sessions", CheckSessionMiddleware(), r.revokeOtherSessions)
+		h.DELETE("/sessions/:id", CheckSessionMiddleware(), r.revokeSession)
+	}
+}
+
+type listSessionsResponse struct {
+	Sessions []entity.UserSession `json:"sessions"`
+}
+
+// get usage godoc
+//
+//	@Summary		Get usage
+//	@Description	Get the storage usage of the current user against each upload quota, a limit of 0 means unlimited
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	dto.UserUsage
+//	@Failure		401	{object}	errorResponse
+//	@Router			/me/usage [get]
+func (r *meRoutes) getUsage(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("MeRoutes - getUsage: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	usage, err := r.userUploadFile.GetUsage(c.Request.Context(), userID)
+	if err != nil {
+		r.logger.Error("MeRoutes - getUsage: failed to get usage", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to get usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// list sessions godoc
+//
+//	@Summary		List sessions
+//	@Description	List the active sessions of the current user with their device, the address they were last seen from and when, the session making the request is flagged as current
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	listSessionsResponse
+//	@Failure		401	{object}	errorResponse
+//	@Router			/me/sessions [get]
+func (r *meRoutes) listSessions(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("MeRoutes - listSessions: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	userSessions, err := r.sessions.List(c.Request.Context(), userID)
+	if err != nil {
+		r.logger.Error("MeRoutes - listSessions: failed to list sessions", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+
+	currentID, _ := sessions.Default(c).Get(_sessionIDKey).(string)
+	for i := range userSessions {
+		userSessions[i].Current = userSessions[i].ID == currentID
+	}
+
+	c.JSON(http.StatusOK, listSessionsResponse{Sessions: userSessions})
+}
+
+// revoke session godoc
+//
+//	@Summary		Revoke session
+//	@Description	Log out one session of the current user, revoking the current session logs the request out as well
+//	@Tags			Me
+//	@Param			id	path	string	true	"session id"
+//	@Success		204
+//	@Failure		401	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Router			/me/sessions/{id} [delete]
+func (r *meRoutes) revokeSession(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("MeRoutes - revokeSession: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	sessionID := c.Param("id")
+	err := r.sessions.Revoke(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "session not found")
+		} else {
+			r.logger.Error("MeRoutes - revokeSession: failed to revoke session", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to revoke session")
+		}
+		return
+	}
+
+	session := sessions.Default(c)
+	if currentID, _ := session.Get(_sessionIDKey).(string); currentID == sessionID {
+		session.Delete("userID")
+		session.Delete(_sessionIDKey)
+		err = session.Save()
+		if err != nil {
+			r.logger.Error("MeRoutes - revokeSession: failed to save session", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to revoke session")
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revoke other sessions godoc
+//
+//	@Summary		Revoke other sessions
+//	@Description	Log out every session of the current user except the one making the request
+//	@Tags			Me
+//	@Success		204
+//	@Failure		401	{object}	errorResponse
+//	@Router			/me/sessions [delete]
+func (r *meRoutes) revokeOtherSessions(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("MeRoutes - revokeOtherSessions: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	currentID, _ := sessions.Default(c).Get(_sessionIDKey).(string)
+	err := r.sessions.RevokeOthers(c.Request.Context(), userID, currentID)
+	if err != nil {
+		r.logger.Error("MeRoutes - revokeOtherSessions: failed to revoke sessions", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type personalAccessTokenRoutes struct {
+	tokens usecase.PersonalAccessToken
+	logger logger.Logger
+}
+
+// NewPersonalAccessTokenRoutes registers the management of personal access tokens. It needs a login session,
+// a token cannot issue other tokens.
+func NewPersonalAccessTokenRoutes(handler *gin.RouterGroup, t usecase.PersonalAccessToken, l logger.Logger) {
+
+	r := &personalAccessTokenRoutes{t, l}
+
+	h := handler.Group("/me/tokens")
+	{
+		h.Use(CheckSessionMiddleware())
+		h.POST("/", r.create)
+		h.GET("/", r.list)
+		h.DELETE("/:id", r.revoke)
+	}
+}
+
+type createPersonalAccessTokenRequest struct {
+	Name          string   `json:"name" example:"nightly backup" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" example:"files:read,files:write" binding:"required,min=1,dive,oneof=files:read files:write"`
+	ExpiresInDays int      `json:"expiresInDays" example:"90" binding:"min=0,max=365"` // 0 never expires
+}
+
+type listPersonalAccessTokensResponse struct {
+	Tokens []entity.PersonalAccessToken `json:"tokens"`
+}
+
+// create personal access token godoc
+//
+//	@Summary		Create personal access token
+//	@Description	Issue a token for scripts and integrations, sent as "Authorization: Bearer <token>". The response carries the token, it is not shown again
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			createPersonalAccessTokenRequest	body		createPersonalAccessTokenRequest	true	"token"
+//	@Success		201									{object}	dto.CreatedPersonalAccessToken
+//	@Failure		400									{object}	errorResponse
+//	@Failure		401									{object}	errorResponse
+//	@Router			/me/tokens [post]
+func (r *personalAccessTokenRoutes) create(c *gin.Context) {
+	var request createPersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		sendValidationErrorResponse(c, err)
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("PersonalAccessTokenRoutes - create: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	ttl := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	token, err := r.tokens.Create(c.Request.Context(), userID, request.Name, request.Scopes, ttl)
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRoutes - create: failed to create token", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// list personal access tokens godoc
+//
+//	@Summary		List personal access tokens
+//	@Description	List the personal access tokens of the current user with their scopes and last use, the tokens themselves are not shown
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	listPersonalAccessTokensResponse
+//	@Failure		401	{object}	errorResponse
+//	@Router			/me/tokens [get]
+func (r *personalAccessTokenRoutes) list(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("PersonalAccessTokenRoutes - list: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	tokens, err := r.tokens.List(c.Request.Context(), userID)
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRoutes - list: failed to list tokens", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to list tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, listPersonalAccessTokensResponse{Tokens: tokens})
+}
+
+// revoke personal access token godoc
+//
+//	@Summary		Revoke personal access token
+//	@Description	Delete a personal access token of the current user, requests sent with it are refused from then on
+//	@Tags			Me
+//	@Param			id	path	int	true	"token id"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		401	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Router			/me/tokens/{id} [delete]
+func (r *personalAccessTokenRoutes) revoke(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("PersonalAccessTokenRoutes - revoke: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	err = r.tokens.Revoke(c.Request.Context(), userID, id)
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "token not found")
+		} else {
+			r.logger.Error("PersonalAccessTokenRoutes - revoke: failed to revoke token", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to revoke token")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
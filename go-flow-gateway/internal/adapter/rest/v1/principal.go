@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// _principalKey holds in the gin context who the request acts for.
+const _principalKey = "principal"
+
+// Principal is who a request acts for: a user logged in with a session, or a script of the user sending one
+// of their personal access tokens.
+type Principal struct {
+	UserID  int
+	TokenID int      // personal access token the request was sent with, 0 for a session
+	Scopes  []string // scopes of the token, a session is not limited by scopes
+}
+
+// ViaToken tells whether the request was sent with a personal access token rather than a session.
+func (p Principal) ViaToken() bool {
+	return p.TokenID != 0
+}
+
+// HasScope tells whether the principal may act within the scope.
+func (p Principal) HasScope(scope string) bool {
+	if !p.ViaToken() {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// currentPrincipal returns who the request acts for, false when it is anonymous. Requests that did not go
+// through AuthMiddleware are authenticated by their session.
+func currentPrincipal(c *gin.Context) (Principal, bool) {
+	if v, exists := c.Get(_principalKey); exists {
+		p, ok := v.(Principal)
+		return p, ok
+	}
+
+	userID, exists := sessions.Default(c).Get("userID").(int)
+	if !exists {
+		return Principal{}, false
+	}
+	p := Principal{UserID: userID}
+	c.Set(_principalKey, p)
+	return p, true
+}
+
+// currentUserID returns the user the request acts for, false when it is anonymous.
+func currentUserID(c *gin.Context) (int, bool) {
+	p, exists := currentPrincipal(c)
+	return p.UserID, exists
+}
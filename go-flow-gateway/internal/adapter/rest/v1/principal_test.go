@@ -0,0 +1,142 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	setupRouter := func(tokens usecase.PersonalAccessToken, sessionUserID int) *gin.Engine {
+		router := gin.New()
+		router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+		router.Use(func(c *gin.Context) {
+			if sessionUserID != 0 {
+				sessions.Default(c).Set("userID", sessionUserID)
+			}
+			c.Next()
+		})
+		router.Use(AuthMiddleware(tokens, logger.New("debug")))
+		whoami := func(c *gin.Context) {
+			p, _ := currentPrincipal(c)
+			c.JSON(http.StatusOK, gin.H{"userID": p.UserID, "viaToken": p.ViaToken()})
+		}
+		router.GET("/files", CheckScopeMiddleware(entity.ScopeFilesRead), whoami)
+		router.POST("/files", CheckScopeMiddleware(entity.ScopeFilesWrite), whoami)
+		router.GET("/account", CheckSessionMiddleware(), whoami)
+		return router
+	}
+
+	serve := func(router *gin.Engine, method, path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("a bearer token acts for its user within its scopes", func(t *testing.T) {
+		// Arrange
+		tokens := new(usecase.MockPersonalAccessTokenUseCase)
+		tokens.On("Authenticate", mock.Anything, "gfg_pat_read").
+			Return(entity.PersonalAccessToken{ID: 3, UserID: 7, Scopes: []string{entity.ScopeFilesRead}}, nil)
+		router := setupRouter(tokens, 0)
+
+		// Act
+		read := serve(router, http.MethodGet, "/files", "Bearer gfg_pat_read")
+		write := serve(router, http.MethodPost, "/files", "Bearer gfg_pat_read")
+		account := serve(router, http.MethodGet, "/account", "Bearer gfg_pat_read")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, read.Code)
+		assert.JSONEq(t, `{"userID":7,"viaToken":true}`, read.Body.String())
+		assert.Equal(t, http.StatusForbidden, write.Code)
+		assert.Contains(t, write.Body.String(), "insufficient_scope")
+		assert.Equal(t, http.StatusForbidden, account.Code)
+	})
+
+	t.Run("the token wins over the session", func(t *testing.T) {
+		// Arrange
+		tokens := new(usecase.MockPersonalAccessTokenUseCase)
+		tokens.On("Authenticate", mock.Anything, "gfg_pat_read").
+			Return(entity.PersonalAccessToken{ID: 3, UserID: 7, Scopes: []string{entity.ScopeFilesRead}}, nil)
+		router := setupRouter(tokens, 1)
+
+		// Act
+		w := serve(router, http.MethodGet, "/files", "Bearer gfg_pat_read")
+
+		// Assert
+		assert.JSONEq(t, `{"userID":7,"viaToken":true}`, w.Body.String())
+	})
+
+	t.Run("an invalid token is refused even with a session", func(t *testing.T) {
+		// Arrange
+		tokens := new(usecase.MockPersonalAccessTokenUseCase)
+		tokens.On("Authenticate", mock.Anything, "gfg_pat_revoked").
+			Return(entity.PersonalAccessToken{}, apperrors.NewInvalidCredentialsError("invalid token", "test"))
+		router := setupRouter(tokens, 1)
+
+		// Act
+		revoked := serve(router, http.MethodGet, "/files", "Bearer gfg_pat_revoked")
+		empty := serve(router, http.MethodGet, "/files", "Bearer ")
+
+		// Assert
+		assert.Equal(t, http.StatusUnauthorized, revoked.Code)
+		assert.Contains(t, revoked.Header().Get("WWW-Authenticate"), "invalid_token")
+		assert.Equal(t, http.StatusUnauthorized, empty.Code)
+	})
+
+	t.Run("another authorization scheme falls back to the session", func(t *testing.T) {
+		// Arrange
+		tokens := new(usecase.MockPersonalAccessTokenUseCase)
+		router := setupRouter(tokens, 1)
+
+		// Act
+		w := serve(router, http.MethodPost, "/files", "Basic dXNlcjpwYXNz")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"userID":1,"viaToken":false}`, w.Body.String())
+		tokens.AssertNotCalled(t, "Authenticate", mock.Anything, mock.Anything)
+	})
+
+	t.Run("a session may do everything", func(t *testing.T) {
+		// Arrange
+		router := setupRouter(new(usecase.MockPersonalAccessTokenUseCase), 1)
+
+		// Act
+		write := serve(router, http.MethodPost, "/files", "")
+		account := serve(router, http.MethodGet, "/account", "")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, write.Code)
+		assert.JSONEq(t, `{"userID":1,"viaToken":false}`, write.Body.String())
+		assert.Equal(t, http.StatusOK, account.Code)
+	})
+
+	t.Run("anonymous requests are unauthorized", func(t *testing.T) {
+		// Arrange
+		router := setupRouter(new(usecase.MockPersonalAccessTokenUseCase), 0)
+
+		// Act
+		w := serve(router, http.MethodGet, "/files", "")
+
+		// Assert
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
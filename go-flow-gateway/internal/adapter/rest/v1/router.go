@@ -1,11 +1,14 @@
 package v1
 
 import (
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/bgg/go-flow-gateway/config"
 	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -16,17 +19,28 @@ import (
 	_ "github.com/bgg/go-flow-gateway/docs"
 )
 
-func NewRouter(cfg *config.Config, handler *gin.Engine, l logger.Logger, u usecase.UserProfile, uu usecase.UserUploadedFile, o usecase.OAuthDetail, c usecase.UserCredential) {
+func NewRouter(cfg *config.Config, handler *gin.Engine, l logger.Logger, u usecase.UserProfile, uu usecase.UserUploadedFile, us usecase.UploadSession, o usecase.OAuthDetail, c usecase.UserCredential, w usecase.Webhook, fs usecase.FileStatus, dl usecase.DeadLetter, ev usecase.EmailVerification, p usecase.Password, s usecase.Session, tf usecase.TwoFactor, t usecase.PersonalAccessToken) {
 
 	// logging each http request
 	handler.Use(gin.Logger())
+	handler.Use(TrackSessionMiddleware(s, l))
+	handler.Use(AuthMiddleware(t, l))
 
 	// Routers
 	h := handler.Group("/api/v1")
 	{
 		NewUserProfileRoutes(h, u, l)
-		NewAuthRoutes(cfg, h, u, l, o, c, os.Getenv("LINE_CHANNEL_ID"))
-		NewUserUploadedFileRoutes(h, uu, l)
+		NewAuthRoutes(cfg, h, u, l, o, c, ev, p, tf, s, os.Getenv("LINE_CHANNEL_ID"))
+		NewTwoFactorRoutes(h, tf, s, l)
+		NewUserUploadedFileRoutes(h, uu, ev, l)
+		NewFileStatusRoutes(h, fs, l)
+		NewUploadSessionRoutes(h, us, ev, cfg.Upload.Resumable.MaxChunkSize, l)
+		NewMeRoutes(h, uu, s, l)
+		NewPersonalAccessTokenRoutes(h, t, l)
+		NewDeliveryRoutes(h, uu, l)
+		NewMailEventRoutes(h, uu, cfg.Mail.Webhook, l)
+		NewWebhookEndpointRoutes(h, w, l)
+		NewAdminRoutes(h, uu, dl, cfg.Admin, l)
 	}
 
 	// Swagger
@@ -34,15 +48,140 @@ func NewRouter(cfg *config.Config, handler *gin.Engine, l logger.Logger, u useca
 	handler.GET("/swagger/*any", swaggerHandler)
 }
 
+// CheckSessionMiddleware lets through the requests of a user logged in with a session. Personal access tokens
+// are refused, they may not manage the account.
 func CheckSessionMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		_, exists := session.Get("userID").(int)
+		p, exists := currentPrincipal(c)
+		if !exists {
+			sendErrorResponse(c, http.StatusUnauthorized, "unauthorized")
+			c.Abort()
+			return
+		}
+		if p.ViaToken() {
+			sendCodedErrorResponse(c, http.StatusForbidden, "session_required", "personal access tokens are not accepted here, log in instead")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CheckScopeMiddleware lets through the requests of a user logged in with a session, and those sent with a
+// personal access token carrying the scope.
+func CheckScopeMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, exists := currentPrincipal(c)
 		if !exists {
 			sendErrorResponse(c, http.StatusUnauthorized, "unauthorized")
 			c.Abort()
 			return
 		}
+		if !p.HasScope(scope) {
+			sendCodedErrorResponse(c, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("the token needs the %s scope", scope))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthMiddleware puts in the context who the request acts for: the owner of the personal access token sent as
+// "Authorization: Bearer <token>", or else the user of the session. Other Authorization schemes are left to
+// whoever added them, the session is used then. A request with a token that is not accepted is refused rather
+// than served anonymously. It runs after TrackSessionMiddleware, so that revoked sessions are already logged out.
+func AuthMiddleware(t usecase.PersonalAccessToken, l logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, token, _ := strings.Cut(strings.TrimSpace(c.GetHeader("Authorization")), " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			if userID, exists := sessions.Default(c).Get("userID").(int); exists {
+				c.Set(_principalKey, Principal{UserID: userID})
+			}
+			c.Next()
+			return
+		}
+
+		token = strings.TrimSpace(token)
+		if token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			sendErrorResponse(c, http.StatusUnauthorized, "the bearer token is missing")
+			c.Abort()
+			return
+		}
+
+		pat, err := t.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			if apperrors.IsInvalidCredentialsError(err) {
+				c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				sendErrorResponse(c, http.StatusUnauthorized, "invalid or expired token")
+			} else {
+				l.Error("AuthMiddleware: failed to authenticate token", err)
+				sendErrorResponse(c, http.StatusInternalServerError, "internal server problems")
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set(_principalKey, Principal{UserID: pat.UserID, TokenID: pat.ID, Scopes: pat.Scopes})
+		c.Next()
+	}
+}
+
+// TrackSessionMiddleware records when and from where the session of the request was last used, and logs it
+// out once it was revoked or expired, the request then goes on without a user. Sessions from before sessions
+// were indexed cannot be checked against the revocations made before the index, they are logged out too.
+func TrackSessionMiddleware(s usecase.Session, l logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		userID, exists := session.Get("userID").(int)
+		if !exists {
+			c.Next()
+			return
+		}
+
+		valid := false
+		if sessionID, indexed := session.Get(_sessionIDKey).(string); indexed {
+			var err error
+			valid, err = s.Touch(c.Request.Context(), userID, sessionID, c.ClientIP())
+			if err != nil {
+				l.Error("TrackSessionMiddleware: failed to check session", err)
+				sendErrorResponse(c, http.StatusInternalServerError, "internal server problems")
+				c.Abort()
+				return
+			}
+		}
+		if !valid {
+			session.Delete("userID")
+			session.Delete(_sessionIDKey)
+			session.Delete("issuedAt") // carried by sessions from before the index
+			err := session.Save()
+			if err != nil {
+				l.Error("TrackSessionMiddleware: failed to save session", err)
+				sendErrorResponse(c, http.StatusInternalServerError, "internal server problems")
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// CheckEmailVerifiedMiddleware refuses the request when the user in session may not upload before verifying
+// their email. It runs after CheckSessionMiddleware or CheckScopeMiddleware.
+func CheckEmailVerifiedMiddleware(ev usecase.EmailVerification, l logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := currentUserID(c)
+		err := ev.CheckUploadAllowed(c.Request.Context(), userID)
+		if err != nil {
+			if apperrors.IsEmailNotVerifiedError(err) {
+				sendCodedErrorResponse(c, http.StatusForbidden, "email_not_verified", err.Error())
+			} else {
+				l.Error("CheckEmailVerifiedMiddleware: failed to check email verification", err)
+				sendErrorResponse(c, http.StatusInternalServerError, "internal server problems")
+			}
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -3,18 +3,21 @@ package v1
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/internal/infra/email"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/bgg/go-flow-gateway/pkg/postgres"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/redis"
 	"github.com/gin-gonic/gin"
 	redigo "github.com/gomodule/redigo/redis"
-	mail "github.com/xhit/go-simple-mail/v2"
 
 	"github.com/ory/dockertest/v3"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -191,7 +194,7 @@ func setupRabbitMQ(t *testing.T) (*amqp.Channel, func()) {
 	}
 }
 
-func setupMailhog(t *testing.T) (*mail.SMTPClient, func()) {
+func setupMailhog(t *testing.T) (email.Mailer, func()) {
 	t.Helper()
 
 	pool, err := dockertest.NewPool("")
@@ -208,27 +211,33 @@ func setupMailhog(t *testing.T) (*mail.SMTPClient, func()) {
 		t.Fatalf("could not start resource: %s", err)
 	}
 
-	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
-	server.Username = ""
-	server.Password = ""
-	server.Encryption = mail.EncryptionNone
+	port, err := strconv.Atoi(resource.GetPort("1025/tcp"))
+	if err != nil {
+		t.Fatalf("could not parse mailhog port: %s", err)
+	}
+
+	mailer, err := email.NewSMTPMailer(config.SMTPConfig{
+		Host:       "localhost",
+		Port:       port,
+		Encryption: "none",
+		KeepAlive:  true,
+	}, setupLogger(t))
+	if err != nil {
+		t.Fatalf("could not create smtp mailer: %s", err)
+	}
 
-	var smtpClient *mail.SMTPClient
 	if err := pool.Retry(func() error {
-		smtpClient, err = server.Connect()
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
 		if err != nil {
 			return err
 		}
-		return nil
-
+		return conn.Close()
 	}); err != nil {
 		t.Fatalf("could not connect to mailhog: %s", err)
 	}
 
-	return smtpClient, func() {
-		smtpClient.Close()
+	return mailer, func() {
+		mailer.Close()
 		pool.Purge(resource)
 	}
 }
@@ -0,0 +1,209 @@
+package v1
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// _twoFactorChallengeKey holds in the session the login waiting for its second factor.
+const _twoFactorChallengeKey = "twoFactorChallenge"
+
+type twoFactorRoutes struct {
+	twoFactor usecase.TwoFactor
+	sessions  usecase.Session
+	logger    logger.Logger
+}
+
+func NewTwoFactorRoutes(handler *gin.RouterGroup, tf usecase.TwoFactor, s usecase.Session, l logger.Logger) {
+	r := &twoFactorRoutes{twoFactor: tf, sessions: s, logger: l}
+
+	h := handler.Group("/auth/two-factor")
+	{
+		h.POST("/enroll", CheckSessionMiddleware(), r.enroll)
+		h.POST("/confirm", CheckSessionMiddleware(), r.confirm)
+		h.POST("/disable", CheckSessionMiddleware(), r.disable)
+		h.POST("/verify", r.verify)
+	}
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"` // TOTP code of the authenticator app, or a recovery code
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes" example:"abcd-efgh,ijkl-mnop"`
+}
+
+// enroll godoc
+//
+//	@Summary		Enroll Authenticator App
+//	@Description	Generate the secret of an authenticator app, two-factor authentication is enabled once a first code is confirmed. Enrolling again before confirming replaces the secret
+//	@Tags			Two-Factor
+//	@Produce		json
+//	@Success		200	{object}	dto.TOTPEnrollment
+//	@Failure		401	{object}	errorResponse	"Unauthorized"
+//	@Failure		409	{object}	errorResponse	"Two-factor authentication is already enabled"
+//	@Router			/auth/two-factor/enroll [post]
+func (r *twoFactorRoutes) enroll(c *gin.Context) {
+	userID, _ := currentUserID(c)
+
+	enrollment, err := r.twoFactor.Enroll(c.Request.Context(), userID)
+	if err != nil {
+		if apperrors.IsTwoFactorAlreadyEnabledError(err) {
+			sendErrorResponse(c, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+		r.logger.Error("TwoFactorRoutes - enroll: failed to enroll", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "failed to enroll")
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// confirm godoc
+//
+//	@Summary		Confirm Authenticator App
+//	@Description	Enable two-factor authentication with a first code of the enrolled app. The recovery codes returned are not shown again
+//	@Tags			Two-Factor
+//	@Accept			json
+//	@Produce		json
+//	@Param			TwoFactorCodeRequest	body		TwoFactorCodeRequest	true	"code of the authenticator app"
+//	@Success		200						{object}	RecoveryCodesResponse
+//	@Failure		400						{object}	errorResponse	"Invalid request or code"
+//	@Failure		401						{object}	errorResponse	"Unauthorized"
+//	@Failure		404						{object}	errorResponse	"No app is enrolled"
+//	@Failure		409						{object}	errorResponse	"Two-factor authentication is already enabled"
+//	@Router			/auth/two-factor/confirm [post]
+func (r *twoFactorRoutes) confirm(c *gin.Context) {
+	userID, _ := currentUserID(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	codes, err := r.twoFactor.Confirm(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case apperrors.IsInvalidTwoFactorCodeError(err):
+			sendErrorResponse(c, http.StatusBadRequest, "invalid code")
+		case apperrors.IsNoRowsAffectedError(err):
+			sendErrorResponse(c, http.StatusNotFound, "no authenticator app is enrolled")
+		case apperrors.IsTwoFactorAlreadyEnabledError(err):
+			sendErrorResponse(c, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			r.logger.Error("TwoFactorRoutes - confirm: failed to confirm", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "failed to confirm")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// disable godoc
+//
+//	@Summary		Disable Two-Factor Authentication
+//	@Description	Remove the authenticator app and the recovery codes, given a code of either
+//	@Tags			Two-Factor
+//	@Accept			json
+//	@Param			TwoFactorCodeRequest	body		TwoFactorCodeRequest	true	"code of the authenticator app or recovery code"
+//	@Success		204						{object}	nil				"No content"
+//	@Failure		400						{object}	errorResponse	"Invalid request or code"
+//	@Failure		401						{object}	errorResponse	"Unauthorized"
+//	@Failure		404						{object}	errorResponse	"Two-factor authentication is not enabled"
+//	@Failure		429						{object}	errorResponse	"Too many failed attempts, retry after the Retry-After header"
+//	@Router			/auth/two-factor/disable [post]
+func (r *twoFactorRoutes) disable(c *gin.Context) {
+	userID, _ := currentUserID(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	err := r.twoFactor.Disable(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		if lte, ok := apperrors.AsLoginThrottledError(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lte.RetryAfter.Seconds()))))
+			sendErrorResponse(c, http.StatusTooManyRequests, "too many failed login attempts, try again later")
+			return
+		}
+		switch {
+		case apperrors.IsInvalidTwoFactorCodeError(err):
+			sendErrorResponse(c, http.StatusBadRequest, "invalid code")
+		case apperrors.IsNoRowsAffectedError(err):
+			sendErrorResponse(c, http.StatusNotFound, "two-factor authentication is not enabled")
+		default:
+			r.logger.Error("TwoFactorRoutes - disable: failed to disable", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "failed to disable")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// verify godoc
+//
+//	@Summary		Verify Second Factor
+//	@Description	Finish a login waiting for its second factor, given a code of the authenticator app or a recovery code. Too many wrong codes end the login, it then starts over
+//	@Tags			Two-Factor
+//	@Accept			json
+//	@Param			TwoFactorCodeRequest	body		TwoFactorCodeRequest	true	"code of the authenticator app or recovery code"
+//	@Success		204						{object}	nil				"No content"
+//	@Failure		400						{object}	errorResponse	"Invalid request"
+//	@Failure		401						{object}	errorResponse	"Invalid code, or no login is waiting for a second factor"
+//	@Failure		429						{object}	errorResponse	"Too many failed attempts, retry after the Retry-After header"
+//	@Router			/auth/two-factor/verify [post]
+func (r *twoFactorRoutes) verify(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	challengeID, ok := sessions.Default(c).Get(_twoFactorChallengeKey).(string)
+	if !ok {
+		sendErrorResponse(c, http.StatusUnauthorized, "no login is waiting for a second factor")
+		return
+	}
+
+	userID, err := r.twoFactor.CompleteChallenge(c.Request.Context(), challengeID, req.Code)
+	if err != nil {
+		if lte, ok := apperrors.AsLoginThrottledError(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lte.RetryAfter.Seconds()))))
+			sendErrorResponse(c, http.StatusTooManyRequests, "too many failed login attempts, try again later")
+			return
+		}
+		switch {
+		case apperrors.IsInvalidTwoFactorCodeError(err):
+			sendErrorResponse(c, http.StatusUnauthorized, "invalid code")
+		case apperrors.IsNoRowsAffectedError(err):
+			sendErrorResponse(c, http.StatusUnauthorized, "the login has expired, log in again")
+		default:
+			r.logger.Error("TwoFactorRoutes - verify: failed to verify", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "failed to verify")
+		}
+		return
+	}
+
+	err = setUserSession(c, r.sessions, userID)
+	if err != nil {
+		r.logger.Error("TwoFactorRoutes - verify: failed to set user session", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,260 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	_uploadOffsetHeader  = "Upload-Offset"
+	_uploadLengthHeader  = "Upload-Length"
+	_uploadExpiresHeader = "Upload-Expires"
+	_chunkContentType    = "application/offset+octet-stream"
+)
+
+type uploadSessionRoutes struct {
+	uploadSession usecase.UploadSession
+	maxChunkSize  int64
+	logger        logger.Logger
+}
+
+// NewUploadSessionRoutes registers the resumable upload protocol. It follows tus: a session is created
+// first, chunks are sent with PATCH at the offset reported by HEAD, and the complete upload is finalised.
+func NewUploadSessionRoutes(handler *gin.RouterGroup, u usecase.UploadSession, ev usecase.EmailVerification, maxChunkSize int64, l logger.Logger) {
+
+	r := &uploadSessionRoutes{u, maxChunkSize, l}
+
+	h := handler.Group("/user-uploaded-files/uploads")
+	{
+		h.Use(CheckScopeMiddleware(entity.ScopeFilesWrite))
+		h.POST("/", CheckEmailVerifiedMiddleware(ev, l), r.create)
+		h.HEAD("/:id", r.head)
+		h.PATCH("/:id", r.patch)
+		h.POST("/:id/finalize", r.finalize)
+	}
+}
+
+type createUploadSessionRequest struct {
+	Name           string `json:"name" example:"report.pdf" binding:"required"`
+	Size           int64  `json:"size" example:"10485760" binding:"required,min=1"`
+	EmailRecipient string `json:"emailRecipient" example:"johndoe@email.com" binding:"required,email"`
+}
+
+// create upload session godoc
+//
+//	@Summary		Create upload session
+//	@Description	Start a resumable upload, chunks are then sent to the returned location
+//	@Tags			Resumable Upload
+//	@Accept			json
+//	@Produce		json
+//	@Param			createUploadSessionRequest	body		createUploadSessionRequest	true	"file to upload"
+//	@Success		201							{object}	entity.UploadSession
+//	@Header			201							{string}	Location		"URL of the upload session"
+//	@Header			201							{integer}	Upload-Offset	"bytes received so far"
+//	@Failure		400							{object}	errorResponse
+//	@Failure		415							{object}	errorResponse
+//	@Failure		422							{object}	errorResponse
+//	@Failure		429							{object}	errorResponse
+//	@Failure		507							{object}	errorResponse
+//	@Router			/user-uploaded-files/uploads [post]
+func (r *uploadSessionRoutes) create(c *gin.Context) {
+	var request createUploadSessionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		r.logger.Error("UploadSessionRoutes - create: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UploadSessionRoutes - create: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	uploadSession, err := r.uploadSession.Create(c.Request.Context(), entity.UploadSession{
+		UserID:         userID,
+		Name:           request.Name,
+		Size:           request.Size,
+		EmailRecipient: request.EmailRecipient,
+	})
+	if err != nil {
+		r.logger.Error("UploadSessionRoutes - create: failed to create upload session", err)
+		if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+			sendUploadPolicyErrorResponse(c, upve)
+		} else if qee, ok := apperrors.AsQuotaExceededError(err); ok {
+			sendQuotaErrorResponse(c, qee)
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to create upload session")
+		}
+		return
+	}
+
+	setUploadHeaders(c, uploadSession)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+uploadSession.ID)
+	c.JSON(http.StatusCreated, uploadSession)
+}
+
+// head upload session godoc
+//
+//	@Summary		Get upload offset
+//	@Description	Report how many bytes of a resumable upload have been received
+//	@Tags			Resumable Upload
+//	@Param			id	path	string	true	"upload session id"
+//	@Success		200
+//	@Header			200	{integer}	Upload-Offset	"bytes received so far"
+//	@Header			200	{integer}	Upload-Length	"declared size"
+//	@Failure		404
+//	@Router			/user-uploaded-files/uploads/{id} [head]
+func (r *uploadSessionRoutes) head(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UploadSessionRoutes - head: failed to get the user of the request")
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	uploadSession, err := r.uploadSession.GetByID(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		r.logger.Error("UploadSessionRoutes - head: failed to get upload session", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			c.Status(http.StatusNotFound)
+		} else {
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setUploadHeaders(c, uploadSession)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// patch upload session godoc
+//
+//	@Summary		Upload chunk
+//	@Description	Append a chunk to a resumable upload, Upload-Offset must equal the offset reported by HEAD
+//	@Tags			Resumable Upload
+//	@Accept			application/offset+octet-stream
+//	@Param			id				path	string	true	"upload session id"
+//	@Param			Upload-Offset	header	integer	true	"offset of the chunk"
+//	@Success		204
+//	@Header			204	{integer}	Upload-Offset	"bytes received so far"
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		409	{object}	errorResponse
+//	@Failure		413	{object}	errorResponse
+//	@Failure		415	{object}	errorResponse
+//	@Router			/user-uploaded-files/uploads/{id} [patch]
+func (r *uploadSessionRoutes) patch(c *gin.Context) {
+	if c.ContentType() != _chunkContentType {
+		sendErrorResponse(c, http.StatusUnsupportedMediaType, "Content-Type must be "+_chunkContentType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader(_uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		r.logger.Error("UploadSessionRoutes - patch: invalid Upload-Offset header", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid Upload-Offset header")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UploadSessionRoutes - patch: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	chunk, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, r.maxChunkSize))
+	if err != nil {
+		r.logger.Error("UploadSessionRoutes - patch: failed to read chunk", err)
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			sendErrorResponse(c, http.StatusRequestEntityTooLarge, "chunk must not exceed "+strconv.FormatInt(r.maxChunkSize, 10)+" bytes")
+		} else {
+			sendErrorResponse(c, http.StatusBadRequest, "Failed to read chunk")
+		}
+		return
+	}
+
+	uploadSession, err := r.uploadSession.AppendChunk(c.Request.Context(), c.Param("id"), userID, offset, chunk)
+	if err != nil {
+		r.logger.Error("UploadSessionRoutes - patch: failed to append chunk", err)
+		if uome, ok := apperrors.AsUploadOffsetMismatchError(err); ok {
+			c.Header(_uploadOffsetHeader, strconv.FormatInt(uome.Offset, 10))
+			sendErrorResponse(c, http.StatusConflict, uome.Message)
+		} else if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+			sendUploadPolicyErrorResponse(c, upve)
+		} else if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "upload session not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to append chunk")
+		}
+		return
+	}
+
+	setUploadHeaders(c, uploadSession)
+	c.Status(http.StatusNoContent)
+}
+
+// finalize upload session godoc
+//
+//	@Summary		Finalize upload session
+//	@Description	Turn a complete resumable upload into a user uploaded file and send it to the recipient
+//	@Tags			Resumable Upload
+//	@Produce		json
+//	@Param			id	path		string	true	"upload session id"
+//	@Success		200	{object}	entity.UserUploadedFile
+//	@Failure		404	{object}	errorResponse
+//	@Failure		409	{object}	errorResponse
+//	@Failure		415	{object}	errorResponse
+//	@Failure		422	{object}	errorResponse
+//	@Failure		429	{object}	errorResponse
+//	@Failure		507	{object}	errorResponse
+//	@Router			/user-uploaded-files/uploads/{id}/finalize [post]
+func (r *uploadSessionRoutes) finalize(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UploadSessionRoutes - finalize: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	userUploadedFile, err := r.uploadSession.Finalize(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		r.logger.Error("UploadSessionRoutes - finalize: failed to finalize upload session", err)
+		if uie, ok := apperrors.AsUploadIncompleteError(err); ok {
+			sendErrorResponse(c, http.StatusConflict, uie.Message)
+		} else if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+			sendUploadPolicyErrorResponse(c, upve)
+		} else if qee, ok := apperrors.AsQuotaExceededError(err); ok {
+			sendQuotaErrorResponse(c, qee)
+		} else if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "upload session not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to finalize upload session")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, userUploadedFile)
+}
+
+func setUploadHeaders(c *gin.Context, uploadSession entity.UploadSession) {
+	c.Header(_uploadOffsetHeader, strconv.FormatInt(uploadSession.Offset, 10))
+	c.Header(_uploadLengthHeader, strconv.FormatInt(uploadSession.Size, 10))
+	if uploadSession.ExpiresAt != nil {
+		c.Header(_uploadExpiresHeader, uploadSession.ExpiresAt.UTC().Format(time.RFC1123))
+	}
+}
@@ -1,14 +1,21 @@
 package v1
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
 	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,20 +24,26 @@ type userUploadedFileRoutes struct {
 	logger         logger.Logger
 }
 
-func NewUserUploadedFileRoutes(handler *gin.RouterGroup, u usecase.UserUploadedFile, l logger.Logger) {
+func NewUserUploadedFileRoutes(handler *gin.RouterGroup, u usecase.UserUploadedFile, ev usecase.EmailVerification, l logger.Logger) {
 
 	r := &userUploadedFileRoutes{u, l}
 
 	h := handler.Group("/user-uploaded-files")
 	{
-		h.Use(CheckSessionMiddleware())
-		h.POST("/", r.create)
-		h.GET("/", r.getPaginatedFiles)
+		read, write := CheckScopeMiddleware(entity.ScopeFilesRead), CheckScopeMiddleware(entity.ScopeFilesWrite)
+		h.POST("/", write, CheckEmailVerifiedMiddleware(ev, l), r.create)
+		h.POST("/batch", write, CheckEmailVerifiedMiddleware(ev, l), r.createBatch)
+		h.GET("/", read, r.getPaginatedFiles)
+		h.GET("/:id/content", read, r.download)
+		h.DELETE("/:id", write, r.delete)
+		h.POST("/:id/resend", write, r.resend)
 	}
 }
 
 type createUserUploadedFileRequest struct {
-	EmailRecipient string `form:"emailRecipient" example:"johndoe@email.com"  binding:"required,email"`
+	EmailRecipient string     `form:"emailRecipient" example:"johndoe@email.com"  binding:"required,email"`
+	SendAt         *time.Time `form:"sendAt" example:"2024-01-01T09:00:00Z"`
+	ExpiresAt      *time.Time `form:"expiresAt" example:"2024-02-01T09:00:00Z"`
 }
 
 // create user uploaded file godoc
@@ -42,8 +55,15 @@ type createUserUploadedFileRequest struct {
 //	@Produce		json
 //	@Param			emailRecipient	formData	string	true	"email recipient"
 //	@Param			file			formData	file	true	"file"
+//	@Param			sendAt			formData	string	false	"send the email at this RFC 3339 time instead of right away"
+//	@Param			expiresAt		formData	string	false	"purge the content at this RFC 3339 time instead of after the default retention"
 //	@Success		204
+//	@Success		201	{object}	createBatchResponse	"the email is scheduled"
 //	@Failure		400	{object}	errorResponse
+//	@Failure		415	{object}	errorResponse
+//	@Failure		422	{object}	errorResponse
+//	@Failure		429	{object}	errorResponse
+//	@Failure		507	{object}	errorResponse
 //	@Router			/user-uploaded-files [post]
 func (r *userUploadedFileRoutes) create(c *gin.Context) {
 	var request createUserUploadedFileRequest
@@ -68,38 +88,180 @@ func (r *userUploadedFileRoutes) create(c *gin.Context) {
 	}
 	defer uploadedFile.Close()
 
-	fileContent, err := io.ReadAll(uploadedFile)
+	// hash the content while it is read so the checksum needs no second pass
+	hasher := sha256.New()
+	fileContent, err := io.ReadAll(io.TeeReader(uploadedFile, hasher))
 	if err != nil {
 		r.logger.Error("UserUploadedFileRoutes - create: failed to read file", err)
 		sendErrorResponse(c, http.StatusInternalServerError, "Failed to read file")
 		return
 	}
 
-	session := sessions.Default(c)
-	userID, exists := session.Get("userID").(int)
+	userID, exists := currentUserID(c)
 	if !exists {
-		r.logger.Error("UserUploadedFileRoutes - create: failed to get userID from session", err)
+		r.logger.Error("UserUploadedFileRoutes - create: failed to get the user of the request", err)
 		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
 		return
 	}
 
-	_, err = r.userUploadFile.Create(c.Request.Context(),
-		entity.UserUploadedFile{
-			UserID:         userID,
-			EmailRecipient: request.EmailRecipient,
-			Name:           file.Filename,
-			Size:           file.Size,
-			Content:        fileContent,
+	userUploadedFile := entity.UserUploadedFile{
+		UserID:         userID,
+		EmailRecipient: request.EmailRecipient,
+		Name:           file.Filename,
+		Size:           file.Size,
+		Checksum:       hex.EncodeToString(hasher.Sum(nil)),
+		Content:        fileContent,
+		ExpiresAt:      request.ExpiresAt,
+	}
+
+	// a scheduled email is kept as a delivery of one file, so it can be cancelled or rescheduled
+	if request.SendAt != nil {
+		delivery, results, err := r.userUploadFile.CreateDelivery(c.Request.Context(), entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: []string{request.EmailRecipient},
+			Files:           []entity.UserUploadedFile{userUploadedFile},
+			SendAt:          request.SendAt,
 		})
+		if err != nil {
+			r.logger.Error("UserUploadedFileRoutes - create: failed to create delivery", err)
+			if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+				sendUploadPolicyErrorResponse(c, upve)
+			} else {
+				sendErrorResponse(c, http.StatusInternalServerError, "Failed to create user uploaded file")
+			}
+			return
+		}
+		sendDeliveryResponse(c, delivery, results)
+		return
+	}
+
+	_, err = r.userUploadFile.Create(c.Request.Context(), userUploadedFile)
 	if err != nil {
 		r.logger.Error("UserUploadedFileRoutes - create: failed to create user uploaded file", err)
-		sendErrorResponse(c, http.StatusInternalServerError, "Failed to create user uploaded file")
+		if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+			sendUploadPolicyErrorResponse(c, upve)
+		} else if qee, ok := apperrors.AsQuotaExceededError(err); ok {
+			sendQuotaErrorResponse(c, qee)
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to create user uploaded file")
+		}
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
 
+type createBatchRequest struct {
+	EmailRecipients []string   `form:"emailRecipients" example:"johndoe@email.com" binding:"required,min=1,max=10,dive,email"`
+	SendAt          *time.Time `form:"sendAt" example:"2024-01-01T09:00:00Z"`
+	ExpiresAt       *time.Time `form:"expiresAt" example:"2024-02-01T09:00:00Z"`
+}
+
+type createBatchResponse struct {
+	DeliveryID int                      `json:"deliveryId,omitempty"`
+	Status     string                   `json:"status,omitempty"`
+	SendAt     *time.Time               `json:"sendAt,omitempty"`
+	Files      []dto.DeliveryFileResult `json:"files"`
+}
+
+// create batch godoc
+//
+//	@Summary		Create batch upload
+//	@Description	Upload several files at once, the accepted files are sent together in one email
+//	@Tags			User Uploaded File
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			emailRecipients	formData	[]string	true	"email recipients"	collectionFormat(multi)
+//	@Param			files			formData	file		true	"files"
+//	@Param			sendAt			formData	string		false	"send the email at this RFC 3339 time instead of right away"
+//	@Param			expiresAt		formData	string		false	"purge the content at this RFC 3339 time instead of after the default retention"
+//	@Success		201				{object}	createBatchResponse
+//	@Failure		400				{object}	errorResponse
+//	@Failure		422				{object}	createBatchResponse	"no file was accepted"
+//	@Router			/user-uploaded-files/batch [post]
+func (r *userUploadedFileRoutes) createBatch(c *gin.Context) {
+	var request createBatchRequest
+	if err := c.ShouldBind(&request); err != nil {
+		r.logger.Error("UserUploadedFileRoutes - createBatch: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		r.logger.Error("UserUploadedFileRoutes - createBatch: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UserUploadedFileRoutes - createBatch: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	files := make([]entity.UserUploadedFile, 0, len(form.File["files"]))
+	for _, file := range form.File["files"] {
+		fileContent, checksum, err := readFormFile(file)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRoutes - createBatch: failed to read file", err)
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to read file")
+			return
+		}
+		files = append(files, entity.UserUploadedFile{
+			Name:      file.Filename,
+			Size:      file.Size,
+			Checksum:  checksum,
+			Content:   fileContent,
+			ExpiresAt: request.ExpiresAt,
+		})
+	}
+
+	delivery, results, err := r.userUploadFile.CreateDelivery(c.Request.Context(), entity.Delivery{
+		UserID:          userID,
+		EmailRecipients: request.EmailRecipients,
+		Files:           files,
+		SendAt:          request.SendAt,
+	})
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - createBatch: failed to create delivery", err)
+		if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+			sendUploadPolicyErrorResponse(c, upve)
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to create delivery")
+		}
+		return
+	}
+
+	sendDeliveryResponse(c, delivery, results)
+}
+
+// sendDeliveryResponse answers 201 with the per-file results, or 422 when no file has been accepted.
+func sendDeliveryResponse(c *gin.Context, delivery entity.Delivery, results []dto.DeliveryFileResult) {
+	if delivery.ID == 0 {
+		c.JSON(http.StatusUnprocessableEntity, createBatchResponse{Files: results})
+		return
+	}
+	c.JSON(http.StatusCreated, createBatchResponse{DeliveryID: delivery.ID, Status: delivery.Status, SendAt: delivery.SendAt, Files: results})
+}
+
+// readFormFile reads an uploaded file and computes its SHA-256 checksum in the same pass.
+func readFormFile(file *multipart.FileHeader) ([]byte, string, error) {
+	uploadedFile, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer uploadedFile.Close()
+
+	hasher := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(uploadedFile, hasher))
+	if err != nil {
+		return nil, "", err
+	}
+	return content, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
 type getPaginatedFilesResponse struct {
 	Files        []entity.UserUploadedFile `json:"files"`
 	TotalRecords int                       `json:"totalRecords"`
@@ -132,10 +294,9 @@ func (r *userUploadedFileRoutes) getPaginatedFiles(c *gin.Context) {
 		return
 	}
 
-	session := sessions.Default(c)
-	userID, exists := session.Get("userID").(int)
+	userID, exists := currentUserID(c)
 	if !exists {
-		r.logger.Error("UserUploadedFileRoutes - getPaginatedFiles: failed to get userID from session", err)
+		r.logger.Error("UserUploadedFileRoutes - getPaginatedFiles: failed to get the user of the request", err)
 		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
 		return
 	}
@@ -149,3 +310,181 @@ func (r *userUploadedFileRoutes) getPaginatedFiles(c *gin.Context) {
 
 	c.JSON(http.StatusOK, getPaginatedFilesResponse{Files: files, TotalRecords: totalRecords})
 }
+
+// download user uploaded file godoc
+//
+//	@Summary		Download user uploaded file
+//	@Description	Download the content of a user uploaded file, the content is gone once the file has expired
+//	@Tags			User Uploaded File
+//	@Produce		octet-stream
+//	@Param			id	path	int	true	"user uploaded file id"
+//	@Success		200	{file}	file
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse	"the file is quarantined"
+//	@Failure		404	{object}	errorResponse
+//	@Failure		410	{object}	errorResponse	"the file has expired"
+//	@Router			/user-uploaded-files/{id}/content [get]
+func (r *userUploadedFileRoutes) download(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - download : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UserUploadedFileRoutes - download: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	file, err := r.userUploadFile.Download(c.Request.Context(), id, userID)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - download: failed to download user uploaded file", err)
+		switch {
+		case apperrors.IsNoRowsAffectedError(err):
+			sendErrorResponse(c, http.StatusNotFound, "user uploaded file not found")
+		case apperrors.IsFileExpiredError(err):
+			sendErrorResponse(c, http.StatusGone, "user uploaded file has expired")
+		case apperrors.IsFileQuarantinedError(err):
+			sendErrorResponse(c, http.StatusForbidden, "user uploaded file is quarantined")
+		default:
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to download user uploaded file")
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	c.Data(http.StatusOK, file.ContentType, file.Content)
+}
+
+// sendUploadPolicyErrorResponse maps a policy violation to 415 for disallowed types and 422 for everything else.
+func sendUploadPolicyErrorResponse(c *gin.Context, upve *apperrors.UploadPolicyViolationError) {
+	status := http.StatusUnprocessableEntity
+	if upve.Reason == apperrors.UploadPolicyContentTypeNotAllowed || upve.Reason == apperrors.UploadPolicyExtensionBlocked {
+		status = http.StatusUnsupportedMediaType
+	}
+	sendCodedErrorResponse(c, status, upve.Reason, upve.Message)
+}
+
+// sendQuotaErrorResponse maps an exceeded upload rate and too many open uploads to 429 and exceeded
+// storage quotas to 507.
+func sendQuotaErrorResponse(c *gin.Context, qee *apperrors.QuotaExceededError) {
+	status := http.StatusInsufficientStorage
+	switch qee.Reason {
+	case apperrors.QuotaUploadRateExceeded, apperrors.QuotaResendRateExceeded:
+		c.Header("Retry-After", "3600")
+		status = http.StatusTooManyRequests
+	case apperrors.QuotaUploadSessionsExceeded:
+		status = http.StatusTooManyRequests
+	}
+	sendCodedErrorResponse(c, status, qee.Reason, qee.Message)
+}
+
+// delete user uploaded file godoc
+//
+//	@Summary		Delete user uploaded file
+//	@Description	Delete user uploaded file, stored content is released once no other upload shares it
+//	@Tags			User Uploaded File
+//	@Param			id	path	int	true	"user uploaded file id"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Router			/user-uploaded-files/{id} [delete]
+func (r *userUploadedFileRoutes) delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - delete : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UserUploadedFileRoutes - delete: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	err = r.userUploadFile.Delete(c.Request.Context(), id, userID)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - delete: failed to delete user uploaded file", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "user uploaded file not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to delete user uploaded file")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type resendRequest struct {
+	EmailRecipients []string `json:"emailRecipients" example:"johndoe@email.com" binding:"omitempty,max=10,dive,email"` // replaces the recipients when set
+}
+
+// resend user uploaded file godoc
+//
+//	@Summary		Resend user uploaded file
+//	@Description	Queue another copy of the email of the file, optionally to new recipients. A file sent with others is sent again with its whole delivery
+//	@Tags			User Uploaded File
+//	@Accept			json
+//	@Param			id				path	int				true	"user uploaded file id"
+//	@Param			resendRequest	body	resendRequest	false	"new recipients"
+//	@Success		202
+//	@Failure		400	{object}	errorResponse
+//	@Failure		403	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Failure		409	{object}	errorResponse
+//	@Failure		410	{object}	errorResponse
+//	@Failure		429	{object}	errorResponse
+//	@Router			/user-uploaded-files/{id}/resend [post]
+func (r *userUploadedFileRoutes) resend(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - resend : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("UserUploadedFileRoutes - resend: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	// the body is optional, the email goes to its former recipients without one
+	var request resendRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		r.logger.Error("UserUploadedFileRoutes - resend: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	err = r.userUploadFile.Resend(c.Request.Context(), id, userID, request.EmailRecipients)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRoutes - resend: failed to resend user uploaded file", err)
+		if qee, ok := apperrors.AsQuotaExceededError(err); ok {
+			sendQuotaErrorResponse(c, qee)
+			return
+		}
+		switch {
+		case apperrors.IsNoRowsAffectedError(err):
+			sendErrorResponse(c, http.StatusNotFound, "user uploaded file not found")
+		case apperrors.IsEmailInProgressError(err):
+			sendErrorResponse(c, http.StatusConflict, "the email is being sent")
+		case apperrors.IsFileExpiredError(err):
+			sendErrorResponse(c, http.StatusGone, "user uploaded file has expired")
+		case apperrors.IsFileQuarantinedError(err):
+			sendErrorResponse(c, http.StatusForbidden, "user uploaded file is quarantined")
+		default:
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to resend user uploaded file")
+		}
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -10,10 +10,13 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/bgg/go-flow-gateway/config"
 	"github.com/bgg/go-flow-gateway/internal/infra/email"
-	"github.com/bgg/go-flow-gateway/internal/infra/messaging/rabbitmq"
+	"github.com/bgg/go-flow-gateway/internal/infra/messaging"
 	"github.com/bgg/go-flow-gateway/internal/infra/repo"
+	"github.com/bgg/go-flow-gateway/internal/infra/scanner"
 	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
 	"github.com/bgg/go-flow-gateway/pkg/postgres"
 	"github.com/gin-gonic/gin"
 )
@@ -29,23 +32,90 @@ func setupUserUploadedFilesTable(t *testing.T) (*postgres.Postgres, func()) {
 		t.Fatalf("could not insert test data: %s", err)
 	}
 
+	createBlobsTableSQL := `CREATE TABLE file_blobs (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES user_profiles(user_id),
+		checksum CHAR(64) NOT NULL,
+		size BIGINT NOT NULL,
+		content BYTEA NOT NULL,
+		ref_count INT NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	);`
+
+	if _, err := pg.Pool.Exec(context.Background(), createBlobsTableSQL); err != nil {
+		t.Fatalf("could not create file_blobs table: %s", err)
+	}
+
+	createDeliveriesTableSQL := `CREATE TABLE deliveries (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES user_profiles(user_id),
+		email_recipients TEXT[] NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		send_at TIMESTAMPTZ,
+		claimed_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+		email_sent BOOLEAN NOT NULL DEFAULT FALSE,
+		email_sent_at TIMESTAMPTZ,
+		failed_at TIMESTAMPTZ,
+		error_message TEXT
+	);`
+
+	if _, err := pg.Pool.Exec(context.Background(), createDeliveriesTableSQL); err != nil {
+		t.Fatalf("could not create deliveries table: %s", err)
+	}
+
 	createTableSQL := `CREATE TABLE user_uploaded_files (
 		id SERIAL PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
 		size BIGINT NOT NULL,
-		content BYTEA NOT NULL,
+		content_type VARCHAR(255) NOT NULL DEFAULT 'application/octet-stream',
+		checksum CHAR(64) NOT NULL,
+		blob_id INT REFERENCES file_blobs(id),
 		user_id INT NOT NULL REFERENCES user_profiles(user_id),
+		delivery_id INT REFERENCES deliveries(id),
 		created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+		expires_at TIMESTAMPTZ,
+		expired_at TIMESTAMPTZ,
 		email_sent BOOLEAN NOT NULL,
 		email_sent_at TIMESTAMPTZ,
-		email_recipient VARCHAR(255),
-		error_message TEXT
+		email_state VARCHAR(20) NOT NULL DEFAULT 'queued',
+		email_claimed_at TIMESTAMPTZ,
+		email_failed_at TIMESTAMPTZ,
+		email_recipient TEXT,
+		message_id VARCHAR(255),
+		email_status VARCHAR(20),
+		error_message TEXT,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending'
 	);`
 
 	if _, err := pg.Pool.Exec(context.Background(), createTableSQL); err != nil {
 		t.Fatalf("could not create user_uploaded_files table: %s", err)
 	}
 
+	createRecipientStatusesTableSQL := `CREATE TABLE email_recipient_statuses (
+		user_uploaded_file_id INT NOT NULL REFERENCES user_uploaded_files(id) ON DELETE CASCADE,
+		recipient TEXT NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		reason TEXT,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (user_uploaded_file_id, recipient)
+	);`
+
+	if _, err := pg.Pool.Exec(context.Background(), createRecipientStatusesTableSQL); err != nil {
+		t.Fatalf("could not create email_recipient_statuses table: %s", err)
+	}
+
+	createResendsTableSQL := `CREATE TABLE email_resends (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES user_profiles(user_id),
+		user_uploaded_file_id INT NOT NULL REFERENCES user_uploaded_files(id) ON DELETE CASCADE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+	);`
+
+	if _, err := pg.Pool.Exec(context.Background(), createResendsTableSQL); err != nil {
+		t.Fatalf("could not create email_resends table: %s", err)
+	}
+
 	return pg, dbTeardown
 }
 
@@ -54,16 +124,22 @@ func setupUserUploadedFileRoute(t *testing.T) (*gin.Engine, *http.Cookie, *postg
 	pg, dbTeardown := setupUserUploadedFilesTable(t)
 
 	ch, rabbitMQTeardown := setupRabbitMQ(t)
+	bus, err := eventbus.NewRabbitMQ(ch, messaging.Topology)
+	if err != nil {
+		t.Fatalf("could not declare the event bus topology: %s", err)
+	}
 
-	smtpClient, smtpTeardown := setupMailhog(t)
+	mailer, smtpTeardown := setupMailhog(t)
 
 	l := setupLogger(t)
 
-	userUploadedFileUseCase := usecase.NewUserUploadedFileUseCase(repo.NewUserUploadedFileRepo(pg, l), rabbitmq.NewUserUploadedFilePublisher(l, ch), email.NewUserUploadedFileEmailSender(smtpClient, l), l)
+	userUploadedFileUseCase := usecase.NewUserUploadedFileUseCase(repo.NewUserUploadedFileRepo(pg, l), messaging.NewUserUploadedFilePublisher(bus, l), email.NewUserUploadedFileEmailSender(mailer, "bgg@mail.com", config.ArchiveConfig{}, l), scanner.NewNoopScanner(l), usecase.UploadPolicy{}, usecase.UploadQuota{}, l)
 
 	router, redisTeardown := setupRouter(t)
 
-	NewUserUploadedFileRoutes(router.Group("/api/v1"), userUploadedFileUseCase, l)
+	emailVerificationUseCase := usecase.NewEmailVerificationUseCase(repo.NewEmailVerificationRepo(pg, l), repo.NewUserCredentialRepo(pg, l), email.NewAccountEmailSender(mailer, "bgg@mail.com", l), usecase.EmailVerificationPolicy{}, l)
+
+	NewUserUploadedFileRoutes(router.Group("/api/v1"), userUploadedFileUseCase, emailVerificationUseCase, l)
 
 	sessionCookie := setupSessions(t, router)
 	return router, sessionCookie, pg, func() {
@@ -164,6 +240,7 @@ func TestUserUploadedFileRoute_GetPaginatedFiles(t *testing.T) {
 		httpMethod     = "GET"
 		fileName       = "test.txt"
 		fileContent    = "dummy file content"
+		checksum       = "0b9d2ee6d4c6b8ef2d3a4b4c9b6f1b3f3c8e9f2a6d1c7b5e4a3f2e1d0c9b8a7f"
 		emailRecipient = "johndoe@mail.com"
 		size           = 100
 		userID         = 1
@@ -173,8 +250,15 @@ func TestUserUploadedFileRoute_GetPaginatedFiles(t *testing.T) {
 	t.Run("get paginated user uploaded files successfully", func(t *testing.T) {
 
 		// insert test data
-		query := `INSERT INTO user_uploaded_files (name, size, content, user_id,email_sent,email_recipient) VALUES ($1, $2, $3, $4,$5,$6);`
-		_, err := pg.Pool.Exec(context.Background(), query, fileName, size, fileContent, userID, emailSent, emailRecipient)
+		var blobID int
+		query := `INSERT INTO file_blobs (user_id, checksum, size, content) VALUES ($1, $2, $3, $4) RETURNING id;`
+		err := pg.Pool.QueryRow(context.Background(), query, userID, checksum, size, fileContent).Scan(&blobID)
+		if err != nil {
+			t.Fatalf("could not insert test data: %s", err)
+		}
+
+		query = `INSERT INTO user_uploaded_files (name, size, checksum, blob_id, user_id,email_sent,email_recipient) VALUES ($1, $2, $3, $4, $5,$6,$7);`
+		_, err = pg.Pool.Exec(context.Background(), query, fileName, size, checksum, blobID, userID, emailSent, emailRecipient)
 		if err != nil {
 			t.Fatalf("could not insert test data: %s", err)
 		}
@@ -0,0 +1,241 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type webhookEndpointRoutes struct {
+	webhook usecase.Webhook
+	logger  logger.Logger
+}
+
+func NewWebhookEndpointRoutes(handler *gin.RouterGroup, w usecase.Webhook, l logger.Logger) {
+
+	r := &webhookEndpointRoutes{w, l}
+
+	h := handler.Group("/webhook-endpoints")
+	{
+		h.Use(CheckSessionMiddleware())
+		h.POST("/", r.create)
+		h.GET("/", r.list)
+		h.DELETE("/:id", r.delete)
+		h.POST("/:id/enable", r.enable)
+		h.GET("/:id/deliveries", r.getPaginatedDeliveries)
+	}
+}
+
+type createWebhookEndpointRequest struct {
+	URL    string   `json:"url" example:"https://example.com/hooks/files" binding:"required,url"`
+	Events []string `json:"events" example:"file.created,file.emailed" binding:"required,min=1,dive,oneof=file.created file.emailed file.email_failed file.deleted"`
+}
+
+// create webhook endpoint godoc
+//
+//	@Summary		Create webhook endpoint
+//	@Description	Register an https URL notified about file events. The response carries the secret the payloads are signed with, it is not shown again
+//	@Tags			Webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			createWebhookEndpointRequest	body		createWebhookEndpointRequest	true	"endpoint"
+//	@Success		201								{object}	entity.WebhookEndpoint
+//	@Failure		400								{object}	errorResponse
+//	@Router			/webhook-endpoints [post]
+func (r *webhookEndpointRoutes) create(c *gin.Context) {
+	var request createWebhookEndpointRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		r.logger.Error("WebhookEndpointRoutes - create: invalid request body", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("WebhookEndpointRoutes - create: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	endpoint, err := r.webhook.CreateEndpoint(c.Request.Context(), entity.WebhookEndpoint{UserID: userID, URL: request.URL, Events: request.Events})
+	if apperrors.IsInvalidWebhookURLError(err) {
+		sendErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - create: failed to create webhook endpoint", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to create webhook endpoint")
+		return
+	}
+
+	c.JSON(http.StatusCreated, endpoint)
+}
+
+type listWebhookEndpointsResponse struct {
+	Endpoints []entity.WebhookEndpoint `json:"endpoints"`
+}
+
+// list webhook endpoints godoc
+//
+//	@Summary		List webhook endpoints
+//	@Description	List the webhook endpoints of the user, endpoints disabled after failing too often show enabled false
+//	@Tags			Webhook
+//	@Produce		json
+//	@Success		200	{object}	listWebhookEndpointsResponse
+//	@Router			/webhook-endpoints [get]
+func (r *webhookEndpointRoutes) list(c *gin.Context) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("WebhookEndpointRoutes - list: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	endpoints, err := r.webhook.GetEndpoints(c.Request.Context(), userID)
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - list: failed to get webhook endpoints", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to get webhook endpoints")
+		return
+	}
+
+	c.JSON(http.StatusOK, listWebhookEndpointsResponse{Endpoints: endpoints})
+}
+
+// delete webhook endpoint godoc
+//
+//	@Summary		Delete webhook endpoint
+//	@Description	Delete a webhook endpoint together with its delivery log
+//	@Tags			Webhook
+//	@Param			id	path	int	true	"webhook endpoint id"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Router			/webhook-endpoints/{id} [delete]
+func (r *webhookEndpointRoutes) delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - delete : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("WebhookEndpointRoutes - delete: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	err = r.webhook.DeleteEndpoint(c.Request.Context(), id, userID)
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - delete: failed to delete webhook endpoint", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "webhook endpoint not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to delete webhook endpoint")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// enable webhook endpoint godoc
+//
+//	@Summary		Enable webhook endpoint
+//	@Description	Enable a webhook endpoint again after it was disabled for failing too often, its pending deliveries are sent again
+//	@Tags			Webhook
+//	@Param			id	path	int	true	"webhook endpoint id"
+//	@Success		204
+//	@Failure		400	{object}	errorResponse
+//	@Failure		404	{object}	errorResponse
+//	@Router			/webhook-endpoints/{id}/enable [post]
+func (r *webhookEndpointRoutes) enable(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - enable : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("WebhookEndpointRoutes - enable: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	err = r.webhook.EnableEndpoint(c.Request.Context(), id, userID)
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - enable: failed to enable webhook endpoint", err)
+		if apperrors.IsNoRowsAffectedError(err) {
+			sendErrorResponse(c, http.StatusNotFound, "webhook endpoint not found")
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, "Failed to enable webhook endpoint")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type getPaginatedWebhookDeliveriesResponse struct {
+	Deliveries   []entity.WebhookDelivery `json:"deliveries"`
+	TotalRecords int                      `json:"totalRecords"`
+}
+
+// get paginated webhook deliveries godoc
+//
+//	@Summary		Get paginated webhook deliveries
+//	@Description	Get the delivery log of a webhook endpoint with the outcome of the last attempt of each event
+//	@Tags			Webhook
+//	@Produce		json
+//	@Param			id		path		int	true	"webhook endpoint id"
+//	@Param			lastID	query		int	false	"last ID of the last record"
+//	@Param			limit	query		int	false	"limit"
+//	@Success		200		{object}	getPaginatedWebhookDeliveriesResponse
+//	@Failure		400		{object}	errorResponse
+//	@Router			/webhook-endpoints/{id}/deliveries [get]
+func (r *webhookEndpointRoutes) getPaginatedDeliveries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - getPaginatedDeliveries : invalid id", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	lastID, err := strconv.Atoi(c.Query("lastID"))
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - getPaginatedDeliveries : invalid lastID query parameter", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid query parameter")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - getPaginatedDeliveries : invalid limit query parameter", err)
+		sendErrorResponse(c, http.StatusBadRequest, "invalid query parameter")
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		r.logger.Error("WebhookEndpointRoutes - getPaginatedDeliveries: failed to get the user of the request")
+		sendErrorResponse(c, http.StatusUnauthorized, "authentication failed")
+		return
+	}
+
+	deliveries, totalRecords, err := r.webhook.GetPaginatedDeliveries(c.Request.Context(), id, userID, lastID, limit)
+	if err != nil {
+		r.logger.Error("WebhookEndpointRoutes - getPaginatedDeliveries: failed to get webhook deliveries", err)
+		sendErrorResponse(c, http.StatusInternalServerError, "Failed to get webhook deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, getPaginatedWebhookDeliveriesResponse{Deliveries: deliveries, TotalRecords: totalRecords})
+}
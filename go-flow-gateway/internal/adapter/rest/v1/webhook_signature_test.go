@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidSignature(t *testing.T) {
+
+	const secret = "secret"
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"events":[]}`)
+	sign := func(secret, timestamp string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		expected  bool
+	}{
+		{"accepts a valid signature", secret, timestamp, sign(secret, timestamp, body), body, true},
+		{"rejects a signature made with another secret", secret, timestamp, sign("other", timestamp, body), body, false},
+		{"rejects a tampered body", secret, timestamp, sign(secret, timestamp, body), []byte(`{"events":[{}]}`), false},
+		{"rejects a stale timestamp", secret, stale, sign(secret, stale, body), body, false},
+		{"rejects everything without a secret", "", timestamp, sign("", timestamp, body), body, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature(tt.secret, tt.timestamp, tt.signature, tt.body, now, 5*time.Minute); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -1,27 +1,33 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/config"
 	"github.com/bgg/go-flow-gateway/internal/adapter/event"
+	"github.com/bgg/go-flow-gateway/internal/adapter/job"
 	v1 "github.com/bgg/go-flow-gateway/internal/adapter/rest/v1"
+	"github.com/bgg/go-flow-gateway/internal/infra/breach"
 	"github.com/bgg/go-flow-gateway/internal/infra/email"
 	"github.com/bgg/go-flow-gateway/internal/infra/external"
-	"github.com/bgg/go-flow-gateway/internal/infra/messaging/rabbitmq"
+	"github.com/bgg/go-flow-gateway/internal/infra/messaging"
 	"github.com/bgg/go-flow-gateway/internal/infra/repo"
+	"github.com/bgg/go-flow-gateway/internal/infra/scanner"
 	"github.com/bgg/go-flow-gateway/internal/infra/utils"
 	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/bgg/go-flow-gateway/pkg/redis"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/redis"
+	sessionredis "github.com/gin-contrib/sessions/redis"
 	"github.com/gin-gonic/gin"
 	amqp "github.com/rabbitmq/amqp091-go"
-	mail "github.com/xhit/go-simple-mail/v2"
 )
 
 func Run(cfg *config.Config) {
@@ -36,38 +42,40 @@ func Run(cfg *config.Config) {
 	defer pg.Close()
 
 	handler := gin.New()
+	err = handler.SetTrustedProxies(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		l.Fatal(fmt.Errorf("app - Run - handler.SetTrustedProxies: %w", err))
+	}
+
 	// Redis Session
-	store, err := redis.NewStore(10, "tcp", cfg.Redis.Host+":"+cfg.Redis.Port, cfg.Redis.Password, []byte(os.Getenv("SESSION_SECRET")))
+	redisPool := redis.NewPool(cfg.Redis.Host+":"+cfg.Redis.Port, cfg.Redis.Password, 10)
+	defer redisPool.Close()
+	store, err := sessionredis.NewStoreWithPool(redisPool, []byte(os.Getenv("SESSION_SECRET")))
+	if err != nil {
+		l.Fatal(fmt.Errorf("app - Run - sessionredis.NewStoreWithPool: %w", err))
+	}
+	cookieOptions, err := sessionCookieOptions(cfg.Session)
 	if err != nil {
-		l.Fatal(fmt.Errorf("app - Run - redis.NewStore: %w", err))
+		l.Fatal(fmt.Errorf("app - Run - sessionCookieOptions: %w", err))
 	}
+	store.Options(cookieOptions)
 	handler.Use(sessions.Sessions("user-auth", store))
 
-	mailHogPort, err := strconv.Atoi(cfg.MailHog.Port)
+	// Mailer
+	mailer, err := email.NewMailer(cfg.Mail, l)
 	if err != nil {
-		l.Fatal(fmt.Errorf("app - Run - strconv.Atoi: %w", err))
+		l.Fatal(fmt.Errorf("app - Run - email.NewMailer: %w", err))
 	}
-	// SMTP Client
-	server := mail.NewSMTPClient()
-	server.Host = cfg.MailHog.Host
-	server.Port = mailHogPort
-	server.Username = ""
-	server.Password = ""
-	server.Encryption = mail.EncryptionNone
+	defer mailer.Close()
 
-	smtpClient, err := server.Connect()
+	// Content Scanner
+	fileScanner, err := scanner.New(cfg.Scanner, l)
 	if err != nil {
-		l.Fatal(fmt.Errorf("app - Run - server.Connect: %w", err))
+		l.Fatal(fmt.Errorf("app - Run - scanner.New: %w", err))
 	}
-	defer smtpClient.Close()
 
 	// RabbitMQ
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		cfg.RabbitMQ.Username,
-		cfg.RabbitMQ.Password,
-		cfg.RabbitMQ.Host,
-		cfg.RabbitMQ.Port)
-	conn, err := amqp.Dial(url)
+	conn, err := dialRabbitMQ(cfg)
 	if err != nil {
 		l.Fatal(fmt.Errorf("app - Run - amqp.Dial: %w", err))
 	}
@@ -77,16 +85,78 @@ func Run(cfg *config.Config) {
 		l.Fatal(fmt.Errorf("app - Run - conn.Channel: %w", err))
 	}
 	defer ch.Close()
+	bus, err := eventbus.NewRabbitMQ(ch, messaging.Topology)
+	if err != nil {
+		l.Fatal(fmt.Errorf("app - Run - eventbus.NewRabbitMQ: %w", err))
+	}
 
+	uploadPolicy := usecase.UploadPolicy{
+		AllowedTypes:      cfg.Upload.AllowedTypes,
+		BlockedExtensions: cfg.Upload.BlockedExtensions,
+		MaxSize:           cfg.Upload.MaxSize,
+		MaxSizeByType:     cfg.Upload.MaxSizeByType,
+		Deduplicate:       cfg.Upload.Deduplicate,
+		MaxBatchFiles:     cfg.Upload.MaxBatchFiles,
+		DefaultRetention:  cfg.Upload.Retention.Default,
+		MaxRetention:      cfg.Upload.Retention.Max,
+	}
+	uploadQuota := usecase.UploadQuota{
+		MaxBytes:          cfg.Upload.Quota.MaxBytes,
+		MaxFiles:          cfg.Upload.Quota.MaxFiles,
+		MaxUploadsPerHour: cfg.Upload.Quota.MaxUploadsPerHour,
+		MaxResendsPerHour: cfg.Upload.Quota.MaxResendsPerHour,
+		MaxUploadSessions: cfg.Upload.Quota.MaxUploadSessions,
+	}
 	userUploadedFileCase := usecase.NewUserUploadedFileUseCase(
 		repo.NewUserUploadedFileRepo(pg, l),
-		rabbitmq.NewUserUploadedFilePublisher(l, ch),
-		email.NewUserUploadedFileEmailSender(smtpClient, l),
+		messaging.NewUserUploadedFilePublisher(bus, l),
+		email.NewUserUploadedFileEmailSender(mailer, cfg.Mail.From, cfg.Mail.Archive, l),
+		fileScanner,
+		uploadPolicy,
+		uploadQuota,
 		l,
 	)
 	// Consumer
-	cs := event.NewUserUploadedFileConsumer(userUploadedFileCase, ch, l)
+	fileStatusUseCase := usecase.NewFileStatusUseCase(l)
+	fscs := event.NewFileStatusConsumer(fileStatusUseCase, bus, messaging.FileStatusQueue, l)
+	go fscs.StartConsume()
+	cs := event.NewUserUploadedFileConsumer(userUploadedFileCase, bus, messaging.FileUploadedQueue, l)
 	go cs.StartConsume()
+	dcs := event.NewDeliveryConsumer(userUploadedFileCase, bus, messaging.DeliveryCreatedQueue, l)
+	go dcs.StartConsume()
+
+	uploadSessionUseCase := usecase.NewUploadSessionUseCase(
+		repo.NewUploadSessionRepo(pg, l),
+		userUploadedFileCase,
+		uploadPolicy,
+		uploadQuota,
+		cfg.Upload.Resumable.SessionTTL,
+		l,
+	)
+	janitor := job.NewUploadSessionJanitor(uploadSessionUseCase, cfg.Upload.Resumable.PurgeInterval, l)
+	go janitor.Start(context.Background())
+	scheduler := job.NewDeliveryScheduler(userUploadedFileCase, cfg.Upload.Schedule.PollInterval, l)
+	go scheduler.Start(context.Background())
+	retentionJanitor := job.NewRetentionJanitor(userUploadedFileCase, cfg.Upload.Retention.PurgeInterval, l)
+	go retentionJanitor.Start(context.Background())
+
+	// Webhooks
+	webhookUseCase := usecase.NewWebhookUseCase(
+		repo.NewWebhookRepo(pg, l),
+		external.NewWebhookSender(cfg.Webhook.Timeout, cfg.Webhook.AllowHTTP, l),
+		usecase.WebhookPolicy{
+			MaxAttempts:  cfg.Webhook.MaxAttempts,
+			BackoffBase:  cfg.Webhook.BackoffBase,
+			BackoffMax:   cfg.Webhook.BackoffMax,
+			DisableAfter: cfg.Webhook.DisableAfter,
+			AllowHTTP:    cfg.Webhook.AllowHTTP,
+		},
+		l,
+	)
+	wcs := event.NewWebhookConsumer(webhookUseCase, bus, messaging.WebhookQueue, l)
+	go wcs.StartConsume()
+	dispatcher := job.NewWebhookDispatcher(webhookUseCase, cfg.Webhook.PollInterval, l)
+	go dispatcher.Start(context.Background())
 
 	// Use case
 	userProfileUseCase := usecase.NewUserProfileUseCase(
@@ -99,15 +169,115 @@ func Run(cfg *config.Config) {
 		l,
 		external.NewLineTokenService(l),
 	)
-	userCredentialUseCase := usecase.NewUserCredentialUseCase(
+	breachedPasswords, err := breach.New(cfg.Password.Breached.Dataset)
+	if err != nil {
+		l.Fatal(fmt.Errorf("app - Run - breach.New: %w", err))
+	}
+	emailVerificationUseCase := usecase.NewEmailVerificationUseCase(
+		repo.NewEmailVerificationRepo(pg, l),
+		repo.NewUserCredentialRepo(pg, l),
+		email.NewAccountEmailSender(mailer, cfg.Mail.From, l),
+		usecase.EmailVerificationPolicy{
+			TokenTTL:         cfg.EmailVerification.TokenTTL,
+			ResendInterval:   cfg.EmailVerification.ResendInterval,
+			RequiredToUpload: cfg.EmailVerification.RequiredToUpload,
+			VerifyURL:        cfg.App.DomainUrl + "/api/v1/auth/verify-email",
+		},
+		l,
+	)
+	passwordPolicy := usecase.PasswordPolicy{
+		MinLength:      cfg.Password.MinLength,
+		MaxLength:      cfg.Password.MaxLength,
+		RequireUpper:   cfg.Password.RequireUpper,
+		RequireLower:   cfg.Password.RequireLower,
+		RequireDigit:   cfg.Password.RequireDigit,
+		RequireSymbol:  cfg.Password.RequireSymbol,
+		ForbidUsername: cfg.Password.ForbidUsername,
+		MinStrength:    cfg.Password.MinStrength,
+		MinBreachCount: cfg.Password.Breached.MinCount,
+	}
+	// wrong second factor codes count against the login throttle like wrong passwords
+	loginAttempts := repo.NewLoginAttemptRepo(redisPool, l)
+	loginThrottle := usecase.LoginThrottle{
+		FreeAttempts:     cfg.Login.FreeAttempts,
+		DelayBase:        cfg.Login.DelayBase,
+		DelayMax:         cfg.Login.DelayMax,
+		MaxFailures:      cfg.Login.MaxFailures,
+		MaxFailuresPerIP: cfg.Login.MaxFailuresPerIP,
+		LockDuration:     cfg.Login.LockDuration,
+		Window:           cfg.Login.Window,
+	}
+	twoFactorRepo := repo.NewTwoFactorRepo(pg, l)
+	userCredentialUseCase, err := usecase.NewUserCredentialUseCase(
+		repo.NewUserCredentialRepo(pg, l),
+		utils.NewBcryptHasher(),
+		userProfileUseCase,
+		emailVerificationUseCase,
+		passwordPolicy,
+		breachedPasswords,
+		loginAttempts,
+		loginThrottle,
+		twoFactorRepo,
+		l,
+	)
+	if err != nil {
+		l.Fatal(fmt.Errorf("app - Run - usecase.NewUserCredentialUseCase: %w", err))
+	}
+
+	sessionUseCase := usecase.NewSessionUseCase(
+		repo.NewSessionRepo(redisPool, l),
+		usecase.SessionPolicy{MaxAge: cfg.Session.MaxAge},
+		l,
+	)
+	passwordResetURL := cfg.Password.Reset.URL
+	if passwordResetURL == "" {
+		passwordResetURL = cfg.App.DomainUrl + "/reset-password"
+	}
+	passwordUseCase := usecase.NewPasswordUseCase(
+		repo.NewPasswordResetRepo(pg, l),
 		repo.NewUserCredentialRepo(pg, l),
 		utils.NewBcryptHasher(),
+		passwordPolicy,
+		breachedPasswords,
+		sessionUseCase,
+		email.NewAccountEmailSender(mailer, cfg.Mail.From, l),
+		usecase.PasswordResetPolicy{
+			TokenTTL:        cfg.Password.Reset.TokenTTL,
+			RequestInterval: cfg.Password.Reset.RequestInterval,
+			ResetURL:        passwordResetURL,
+		},
+		l,
+	)
+
+	twoFactorIssuer := cfg.TwoFactor.Issuer
+	if twoFactorIssuer == "" {
+		twoFactorIssuer = cfg.App.Name
+	}
+	twoFactorUseCase := usecase.NewTwoFactorUseCase(
+		twoFactorRepo,
+		repo.NewTwoFactorChallengeRepo(redisPool, l),
+		repo.NewUserCredentialRepo(pg, l),
 		userProfileUseCase,
+		usecase.TwoFactorPolicy{
+			Issuer:        twoFactorIssuer,
+			ChallengeTTL:  cfg.TwoFactor.ChallengeTTL,
+			MaxAttempts:   cfg.TwoFactor.MaxAttempts,
+			RecoveryCodes: cfg.TwoFactor.RecoveryCodes,
+		},
+		loginAttempts,
+		loginThrottle,
+		l,
+	)
+
+	deadLetterUseCase := usecase.NewDeadLetterUseCase(
+		messaging.NewDeadLetterStore(eventbus.NewRabbitMQDeadLetters(conn, messaging.Topology)),
 		l,
 	)
 
+	personalAccessTokenUseCase := usecase.NewPersonalAccessTokenUseCase(repo.NewPersonalAccessTokenRepo(pg, l), l)
+
 	// HTTP Server
-	v1.NewRouter(cfg, handler, l, userProfileUseCase, userUploadedFileCase, oauthDetailUseCase, userCredentialUseCase)
+	v1.NewRouter(cfg, handler, l, userProfileUseCase, userUploadedFileCase, uploadSessionUseCase, oauthDetailUseCase, userCredentialUseCase, webhookUseCase, fileStatusUseCase, deadLetterUseCase, emailVerificationUseCase, passwordUseCase, sessionUseCase, twoFactorUseCase, personalAccessTokenUseCase)
 	httpServer := &http.Server{
 		Addr:    ":" + cfg.HTTP.Port,
 		Handler: handler,
@@ -118,3 +288,43 @@ func Run(cfg *config.Config) {
 		l.Fatal(fmt.Errorf("app - Run - httpServer.ListenAndServe: %w", err))
 	}
 }
+
+// sessionCookieOptions returns the options of the session cookie, which also bound how long redis keeps a session.
+func sessionCookieOptions(cfg config.SessionConfig) (sessions.Options, error) {
+	if cfg.MaxAge < time.Second {
+		return sessions.Options{}, fmt.Errorf("session max age must be at least a second, got %s", cfg.MaxAge)
+	}
+
+	var sameSite http.SameSite
+	switch strings.ToLower(cfg.SameSite) {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		if !cfg.Secure {
+			return sessions.Options{}, fmt.Errorf("session cookies with SameSite none must be secure")
+		}
+		sameSite = http.SameSiteNoneMode
+	default:
+		return sessions.Options{}, fmt.Errorf("unknown session cookie SameSite %q", cfg.SameSite)
+	}
+
+	return sessions.Options{
+		Path:     cfg.Path,
+		Domain:   cfg.Domain,
+		MaxAge:   int(cfg.MaxAge / time.Second),
+		Secure:   cfg.Secure,
+		HttpOnly: cfg.HttpOnly,
+		SameSite: sameSite,
+	}, nil
+}
+
+func dialRabbitMQ(cfg *config.Config) (*amqp.Connection, error) {
+	url := fmt.Sprintf("amqp://%s:%s@%s:%s/",
+		cfg.RabbitMQ.Username,
+		cfg.RabbitMQ.Password,
+		cfg.RabbitMQ.Host,
+		cfg.RabbitMQ.Port)
+	return amqp.Dial(url)
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/internal/adapter/cli"
+	"github.com/bgg/go-flow-gateway/internal/infra/messaging"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// RunDLQ runs the dlq subcommand against the dead letter queue and returns the exit code. Only errors
+// are logged, so the output stays readable.
+func RunDLQ(cfg *config.Config, args []string) int {
+
+	l := logger.New("error")
+
+	conn, err := dialRabbitMQ(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("app - RunDLQ - amqp.Dial: %w", err))
+		return 1
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	deadLetterUseCase := usecase.NewDeadLetterUseCase(
+		messaging.NewDeadLetterStore(eventbus.NewRabbitMQDeadLetters(conn, messaging.Topology)),
+		l,
+	)
+	err = cli.NewDLQCommand(deadLetterUseCase, os.Stdout).Run(ctx, args)
+	if errors.Is(err, cli.ErrUsage) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,17 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is an event whose consumer failed, kept for inspection until it is replayed or purged.
+type DeadLetter struct {
+	ID       string            `json:"id"`
+	Event    string            `json:"event"`    // Name of the event, it is replayed with it
+	Queue    string            `json:"queue"`    // Queue whose consumer failed
+	Error    string            `json:"error"`    // Reason of the failure
+	FailedAt time.Time         `json:"failedAt"` // When the consumer failed
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     json.RawMessage   `json:"body,omitempty" swaggertype:"object"` // The event, only set when a single dead letter is requested
+}
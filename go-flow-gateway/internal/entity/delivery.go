@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+const (
+	DeliveryStatusScheduled = "scheduled" // Waiting for the send time, can still be cancelled or rescheduled
+	DeliveryStatusCancelled = "cancelled" // Cancelled before the send time
+	DeliveryStatusPending   = "pending"   // Waiting for the email to be sent
+	DeliveryStatusSending   = "sending"   // Claimed by a consumer, the email is being sent
+	DeliveryStatusSent      = "sent"      // The email has been sent with every deliverable file
+	DeliveryStatusFailed    = "failed"    // No file could be delivered, see the error message
+)
+
+// Delivery groups files that are sent to the recipients in a single email.
+type Delivery struct {
+	ID              int                `json:"id"`
+	UserID          int                `json:"userId"`
+	EmailRecipients []string           `json:"emailRecipients"`
+	Files           []UserUploadedFile `json:"files"`
+	Status          string             `json:"status"` // Delivery status, see DeliveryStatus constants
+	SendAt          *time.Time         `json:"sendAt"` // Time the email is sent at, nil to send it right away
+	CreatedAt       *time.Time         `json:"createdAt"`
+	EmailSent       bool               `json:"emailSent"`
+	EmailSentAt     *time.Time         `json:"emailSentAt"`
+	ErrorMessage    *string            `json:"errorMessage"`
+	ArchivePassword *string            `json:"-"` // Password of the archive until the separate email with it is sent
+	ArchiveSentAt   *time.Time         `json:"-"` // Time the archive went out, nil while only its password is recorded
+}
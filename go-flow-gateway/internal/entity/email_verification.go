@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// EmailVerification is a pending proof that a user owns an email. Only the hash of its token is stored.
+type EmailVerification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Email     string    `json:"email"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
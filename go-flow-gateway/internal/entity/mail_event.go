@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+const (
+	EmailStatusSent       = "sent"       // Handed to the mail provider
+	EmailStatusDelivered  = "delivered"  // Accepted by the mailbox of the recipient
+	EmailStatusBounced    = "bounced"    // Rejected by the mailbox of the recipient
+	EmailStatusComplained = "complained" // Reported as spam by the recipient
+)
+
+// MailEvent is a delivery status callback of the mail provider for one recipient of a sent email.
+type MailEvent struct {
+	Type       string    // One of the EmailStatus constants except sent
+	MessageID  string    // Message-ID of the email the event refers to
+	Recipient  string    // The email address the event is about
+	Reason     *string   // Diagnostic of the provider for bounces and complaints
+	OccurredAt time.Time // When the provider observed the event
+}
+
+// RecipientStatus is the latest delivery state of a file email for one recipient.
+type RecipientStatus struct {
+	Recipient string    `json:"recipient"`
+	Status    string    `json:"status"`
+	Reason    *string   `json:"reason"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// PasswordReset is a pending request of a user to choose a new password. Only the hash of its token is stored.
+type PasswordReset struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,35 @@
+package entity
+
+import "time"
+
+// Scopes a personal access token may carry. Login sessions are not scoped.
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+)
+
+// PersonalAccessTokenScopes lists every scope a personal access token may carry.
+var PersonalAccessTokenScopes = []string{ScopeFilesRead, ScopeFilesWrite}
+
+// PersonalAccessToken lets the scripts and integrations of a user call the API without a login session. Only
+// the hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"` // nil never expires
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasScope tells whether the token may act within the scope.
+func (t PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
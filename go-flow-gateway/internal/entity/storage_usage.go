@@ -0,0 +1,10 @@
+package entity
+
+// StorageUsage is what a user currently consumes of the upload quotas.
+type StorageUsage struct {
+	BytesStored     int64 `json:"bytesStored"`     // Bytes of stored content, shared content is counted once
+	FileCount       int64 `json:"fileCount"`       // Number of uploaded files
+	UploadsLastHour int64 `json:"uploadsLastHour"` // Number of files uploaded within the last hour
+	BytesReserved   int64 `json:"bytesReserved"`   // Declared bytes of open upload sessions, not stored yet
+	UploadSessions  int64 `json:"uploadSessions"`  // Number of open upload sessions
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// TOTPFactor is the authenticator app of a user, a second factor once it is confirmed with a first code.
+type TOTPFactor struct {
+	UserID       int        `json:"userId"`
+	Secret       string     `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmedAt"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
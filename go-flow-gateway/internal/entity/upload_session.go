@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+const (
+	UploadSessionStatusOpen       = "open"       // chunks are being received
+	UploadSessionStatusFinalizing = "finalizing" // claimed by a request turning it into a file
+)
+
+// UploadSession tracks a resumable upload whose content arrives in chunks.
+type UploadSession struct {
+	ID             string     `json:"id"` // Random token identifying the session in upload URLs
+	UserID         int        `json:"userId"`
+	Name           string     `json:"name"`
+	Size           int64      `json:"size"`           // Declared total size in bytes
+	Offset         int64      `json:"offset"`         // Number of bytes received so far
+	EmailRecipient string     `json:"emailRecipient"` // The email address of the recipient once the upload is finalised
+	CreatedAt      *time.Time `json:"createdAt"`
+	ExpiresAt      *time.Time `json:"expiresAt"` // Abandoned sessions are purged after this timestamp
+	Status         string     `json:"status"`    // open or finalizing
+}
+
+// Complete reports whether every declared byte has been received.
+func (s UploadSession) Complete() bool {
+	return s.Offset == s.Size
+}
@@ -1,8 +1,10 @@
 package entity
 
 type UserCredential struct {
-	CredentialID string `json:"credentialId"`
-	UserID       int    `json:"userId"`
-	Username     string `json:"username"`
-	PasswordHash string `json:"password"`
+	CredentialID  string `json:"credentialId"`
+	UserID        int    `json:"userId"`
+	Username      string `json:"username"`
+	PasswordHash  string `json:"password"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
 }
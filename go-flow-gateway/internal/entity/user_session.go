@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// UserSession is a login of a user on one device, listed so the user can end the ones they do not recognize.
+type UserSession struct {
+	ID         string    `json:"id" example:"c2Vzc2lvbi1pZA"`
+	UserAgent  string    `json:"userAgent" example:"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)"`
+	IP         string    `json:"ip" example:"203.0.113.7"` // address the session was last seen from
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"` // the session making the request
+}
@@ -2,17 +2,46 @@ package entity
 
 import "time"
 
+const (
+	FileStatusPending     = "pending"     // Uploaded and waiting to be scanned
+	FileStatusClean       = "clean"       // Scanned and cleared for delivery
+	FileStatusQuarantined = "quarantined" // Infected or unscannable, delivery is blocked
+	FileStatusFailed      = "failed"      // Processing failed, see the error message
+	FileStatusExpired     = "expired"     // Retention period is over, the content has been purged
+)
+
+const (
+	EmailStateQueued  = "queued"  // The email waits for a consumer, also after a failed attempt or a resend request
+	EmailStateSending = "sending" // A consumer claimed the email and is sending it
+	EmailStateSent    = "sent"    // The email went out, messages for the file are acknowledged without sending again
+)
+
 // File represents the file-related information that will be stored and retrieved.
 type UserUploadedFile struct {
-	ID             int        `json:"id"`
-	Name           string     `json:"name"`
-	Size           int64      `json:"size"`
-	Content        []byte     `json:"-"`
-	Base64Content  string     `json:"content,omitempty"`
-	UserID         int        `json:"userId"`
-	CreatedAt      *time.Time `json:"createdAt"`
-	EmailSent      bool       `json:"emailSent"`      // Indicates if the email was sent successfully
-	EmailSentAt    *time.Time `json:"emailSentAt"`    // The timestamp when the email was sent
-	EmailRecipient string     `json:"emailRecipient"` // The email address of the recipient
-	ErrorMessage   *string    `json:"errorMessage"`   //  // Error message if the email was not sent successfully
+	ID             int               `json:"id"`
+	Name           string            `json:"name"`
+	Size           int64             `json:"size"`
+	ContentType    string            `json:"contentType"` // Media type sniffed from the content
+	Checksum       string            `json:"checksum"`    // Hex encoded SHA-256 of the content
+	BlobID         int               `json:"-"`           // Stored content, shared between identical uploads of the same user
+	Content        []byte            `json:"-"`
+	Base64Content  string            `json:"content,omitempty"`
+	UserID         int               `json:"userId"`
+	DeliveryID     *int              `json:"deliveryId"` // Set when the file is sent together with others
+	CreatedAt      *time.Time        `json:"createdAt"`
+	ExpiresAt      *time.Time        `json:"expiresAt"`            // The content is purged after this time, nil keeps it forever
+	ExpiredAt      *time.Time        `json:"expiredAt"`            // The timestamp when the content was purged
+	EmailSent      bool              `json:"emailSent"`            // Indicates if the email was sent successfully
+	EmailSentAt    *time.Time        `json:"emailSentAt"`          // The timestamp when the email was sent
+	EmailRecipient string            `json:"emailRecipient"`       // The email address of the recipient
+	MessageID      string            `json:"-"`                    // Message-ID of the email, delivery status callbacks refer to it
+	EmailStatus    *string           `json:"emailStatus"`          // Delivery state of the email, see EmailStatus constants
+	Recipients     []RecipientStatus `json:"recipients,omitempty"` // Delivery state reported for each recipient
+	ErrorMessage   *string           `json:"errorMessage"`         //  // Error message if the email was not sent successfully
+	Status         string            `json:"status"`               // Processing status of the file, see FileStatus constants
+}
+
+// Expired reports whether the retention period of the file is over, also before its content has been purged.
+func (f UserUploadedFile) Expired(now time.Time) bool {
+	return f.Status == FileStatusExpired || (f.ExpiresAt != nil && !f.ExpiresAt.After(now))
 }
@@ -0,0 +1,63 @@
+package entity
+
+import "time"
+
+const (
+	FileEventCreated     = "file.created"      // The file has been uploaded and stored
+	FileEventScanning    = "file.scanning"     // The file is being scanned before it is emailed
+	FileEventEmailed     = "file.emailed"      // The file has been sent to its recipients
+	FileEventEmailFailed = "file.email_failed" // The file could not be sent, see the error of the event
+	FileEventDeleted     = "file.deleted"      // The file has been deleted by its owner
+)
+
+// FileEventTypes lists the events a webhook endpoint can subscribe to, file.scanning is only streamed to the owner.
+var FileEventTypes = []string{FileEventCreated, FileEventEmailed, FileEventEmailFailed, FileEventDeleted}
+
+// FileStatusEventTypes lists the events streamed to the owner of the file as status transitions.
+var FileStatusEventTypes = []string{FileEventCreated, FileEventScanning, FileEventEmailed, FileEventEmailFailed, FileEventDeleted}
+
+const (
+	WebhookDeliveryPending   = "pending"   // Waiting for the first attempt or for a retry
+	WebhookDeliverySucceeded = "succeeded" // The endpoint answered with a 2xx status
+	WebhookDeliveryFailed    = "failed"    // Every attempt failed, the delivery is not retried anymore
+)
+
+// FileEvent is a domain event about an uploaded file, it is the payload sent to webhook endpoints.
+type FileEvent struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"` // See FileEvent constants
+	OccurredAt time.Time        `json:"occurredAt"`
+	File       UserUploadedFile `json:"file"`
+	Error      *string          `json:"error,omitempty"` // Why the email failed, only set for file.email_failed
+}
+
+// WebhookEndpoint is a URL of a user that is notified about the events it subscribes to.
+type WebhookEndpoint struct {
+	ID                  int        `json:"id"`
+	UserID              int        `json:"userId"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"secret,omitempty"` // HMAC key the payloads are signed with, only returned on creation
+	Events              []string   `json:"events"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	DisabledAt          *time.Time `json:"disabledAt"` // Set when the endpoint was disabled after failing too often
+	CreatedAt           *time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is the log entry of an event sent to an endpoint.
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	EndpointID     int        `json:"endpointId"`
+	EventID        string     `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Payload        []byte     `json:"-"`
+	Status         string     `json:"status"` // See WebhookDelivery constants
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt"`
+	LastStatusCode *int       `json:"lastStatusCode"` // HTTP status of the last attempt, nil when no response was received
+	LastError      *string    `json:"lastError"`
+	CreatedAt      *time.Time `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	URL            string     `json:"-"` // URL of the endpoint, loaded for sending
+	Secret         string     `json:"-"` // Secret of the endpoint, loaded for sending
+}
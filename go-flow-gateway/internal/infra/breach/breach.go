@@ -0,0 +1,161 @@
+// Package breach looks up passwords in offline copies of breached password datasets. Lookups follow the
+// k-anonymity model of the Pwned Passwords range API: callers pass the first 5 characters of the SHA-1
+// hash of a password and get back the suffixes of every breached hash sharing them, with their counts.
+package breach
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	_prefixLength = 5
+	_hashLength   = 40
+)
+
+//go:embed common.txt
+var _common string
+
+// Dataset returns the breached hash suffixes sharing a prefix.
+type Dataset interface {
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// New opens the dataset mounted in dir, or the bundled list of common passwords when dir is empty.
+func New(dir string) (Dataset, error) {
+	if dir == "" {
+		return NewBundledDataset(), nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breach - New - os.Stat: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breach - New: %s is not a directory", dir)
+	}
+	return NewPrefixDataset(os.DirFS(dir)), nil
+}
+
+// PrefixDataset reads a dataset laid out like the Pwned Passwords downloads split by prefix: one file
+// named after each prefix, such as 5BAA6.txt, holding "SUFFIX:COUNT" lines. Only the file of the requested
+// prefix is read, so the dataset can be far larger than memory.
+type PrefixDataset struct {
+	fsys fs.FS
+}
+
+func NewPrefixDataset(fsys fs.FS) *PrefixDataset {
+	return &PrefixDataset{fsys: fsys}
+}
+
+func (d *PrefixDataset) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	prefix, err := normalizePrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("PrefixDataset - Range - normalizePrefix: %w", err)
+	}
+
+	f, err := d.fsys.Open(prefix + ".txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		// a dataset without the file has no breached password with the prefix
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("PrefixDataset - Range - fsys.Open: %w", err)
+	}
+	defer f.Close()
+
+	suffixes := make(map[string]int)
+	err = parseHashes(f, _hashLength-_prefixLength, func(suffix string, count int) {
+		suffixes[suffix] += count
+	})
+	if err != nil {
+		return nil, fmt.Errorf("PrefixDataset - Range - parseHashes: %w", err)
+	}
+	return suffixes, nil
+}
+
+// BundledDataset serves the common passwords shipped with the binary. It is small enough to be indexed
+// by prefix in memory.
+type BundledDataset struct {
+	ranges map[string]map[string]int
+}
+
+func NewBundledDataset() *BundledDataset {
+	ranges := make(map[string]map[string]int)
+	// the bundled file is covered by a test, it cannot be malformed
+	_ = parseHashes(strings.NewReader(_common), _hashLength, func(hash string, count int) {
+		prefix, suffix := hash[:_prefixLength], hash[_prefixLength:]
+		if ranges[prefix] == nil {
+			ranges[prefix] = make(map[string]int)
+		}
+		ranges[prefix][suffix] += count
+	})
+	return &BundledDataset{ranges: ranges}
+}
+
+func (d *BundledDataset) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	prefix, err := normalizePrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("BundledDataset - Range - normalizePrefix: %w", err)
+	}
+
+	// the caller gets a copy, the index is shared between requests
+	suffixes := make(map[string]int, len(d.ranges[prefix]))
+	for suffix, count := range d.ranges[prefix] {
+		suffixes[suffix] = count
+	}
+	return suffixes, nil
+}
+
+func normalizePrefix(prefix string) (string, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != _prefixLength || !isHex(prefix) {
+		return "", fmt.Errorf("invalid hash prefix %q", prefix)
+	}
+	return prefix, nil
+}
+
+// parseHashes reads "HASH:COUNT" lines whose hash has the given length. The count is optional and defaults
+// to 1, blank lines and lines starting with # are skipped.
+func parseHashes(r io.Reader, length int, fn func(hash string, count int)) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, rawCount, hasCount := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != length || !isHex(hash) {
+			return fmt.Errorf("line %d: invalid hash %q", line, hash)
+		}
+		count := 1
+		if hasCount {
+			var err error
+			count, err = strconv.Atoi(rawCount)
+			if err != nil || count < 0 {
+				return fmt.Errorf("line %d: invalid count %q", line, rawCount)
+			}
+		}
+		fn(hash, count)
+	}
+	return scanner.Err()
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+	return true
+}
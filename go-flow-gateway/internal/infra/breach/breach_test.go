@@ -0,0 +1,77 @@
+package breach
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+const (
+	_passwordPrefix = "5BAA6"
+	_passwordSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+func TestPrefixDataset_Range(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		_passwordPrefix + ".txt": {Data: []byte("0018A45C4D1DEF81644B54AB7F969B88D65:10\r\n" + _passwordSuffix + ":9659365\r\n")},
+		"00000.txt":              {Data: []byte("not a hash line\n")},
+	}
+	dataset := NewPrefixDataset(fsys)
+
+	t.Run("returns the suffixes of the prefix", func(t *testing.T) {
+		// Act
+		suffixes, err := dataset.Range(context.Background(), strings.ToLower(_passwordPrefix))
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 9659365, suffixes[_passwordSuffix])
+		assert.Len(t, suffixes, 2)
+	})
+
+	t.Run("a missing prefix file has no suffixes", func(t *testing.T) {
+		// Act
+		suffixes, err := dataset.Range(context.Background(), "FFFFF")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Empty(t, suffixes)
+	})
+
+	t.Run("rejects a malformed prefix file", func(t *testing.T) {
+		// Act
+		_, err := dataset.Range(context.Background(), "00000")
+
+		// Assert
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects an invalid prefix", func(t *testing.T) {
+		// Act
+		_, err := dataset.Range(context.Background(), "../etc")
+
+		// Assert
+		assert.Error(t, err)
+	})
+}
+
+func TestBundledDataset_Range(t *testing.T) {
+
+	t.Run("the bundled list parses", func(t *testing.T) {
+		err := parseHashes(strings.NewReader(_common), _hashLength, func(string, int) {})
+		assert.NoError(t, err)
+	})
+
+	t.Run("contains common passwords", func(t *testing.T) {
+		// Act
+		suffixes, err := NewBundledDataset().Range(context.Background(), _passwordPrefix)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, suffixes[_passwordSuffix])
+	})
+}
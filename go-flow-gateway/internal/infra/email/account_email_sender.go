@@ -0,0 +1,66 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// AccountEmailSender sends the emails about the account of a user, such as the link verifying their email.
+type AccountEmailSender struct {
+	mailer Mailer
+	from   string
+	logger logger.Logger
+}
+
+func NewAccountEmailSender(m Mailer, from string, l logger.Logger) *AccountEmailSender {
+	return &AccountEmailSender{mailer: m, from: from, logger: l}
+}
+
+func (s *AccountEmailSender) SendEmailVerification(ctx context.Context, to, username, link string, expiresAt time.Time) error {
+	email := mail.NewMSG()
+	email.SetFrom(s.from).
+		AddTo(to).
+		SetSubject("Verify your email").
+		SetBody(mail.TextHTML, "<h1>Verify your email</h1>"+
+			"<p>Hello "+html.EscapeString(username)+",</p>"+
+			"<p>Please confirm that this is your email by opening the link below.</p>"+
+			"<p><a href=\""+html.EscapeString(link)+"\">Verify my email</a></p>"+
+			"<p>The link expires on "+expiresAt.UTC().Format("2006-01-02 15:04 MST")+". If you did not create an account, you can ignore this email.</p>"+
+			"<p>Best Regards,<br>Your Support Team</p>")
+
+	err := s.mailer.Send(ctx, email)
+	if err != nil {
+		s.logger.Error("AccountEmailSender - SendEmailVerification: failed to send email", "error", err)
+		return fmt.Errorf("AccountEmailSender - SendEmailVerification - mailer.Send: %w", err)
+	}
+
+	s.logger.Info("AccountEmailSender - SendEmailVerification: successfully sent email", "username", username)
+	return nil
+}
+
+func (s *AccountEmailSender) SendPasswordReset(ctx context.Context, to, username, link string, expiresAt time.Time) error {
+	email := mail.NewMSG()
+	email.SetFrom(s.from).
+		AddTo(to).
+		SetSubject("Reset your password").
+		SetBody(mail.TextHTML, "<h1>Reset your password</h1>"+
+			"<p>Hello "+html.EscapeString(username)+",</p>"+
+			"<p>We received a request to reset the password of your account. Open the link below to choose a new one.</p>"+
+			"<p><a href=\""+html.EscapeString(link)+"\">Reset my password</a></p>"+
+			"<p>The link can be used once and expires on "+expiresAt.UTC().Format("2006-01-02 15:04 MST")+". If you did not ask for it, you can ignore this email, your password stays the same.</p>"+
+			"<p>Best Regards,<br>Your Support Team</p>")
+
+	err := s.mailer.Send(ctx, email)
+	if err != nil {
+		s.logger.Error("AccountEmailSender - SendPasswordReset: failed to send email", "error", err)
+		return fmt.Errorf("AccountEmailSender - SendPasswordReset - mailer.Send: %w", err)
+	}
+
+	s.logger.Info("AccountEmailSender - SendPasswordReset: successfully sent email", "username", username)
+	return nil
+}
@@ -0,0 +1,57 @@
+package email
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountEmailSender_SendEmailVerification(t *testing.T) {
+
+	t.Run("should send the verification link", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		m, err := NewFileMailer(dir, logger.New("debug"))
+		assert.NoError(t, err)
+		s := NewAccountEmailSender(m, "bgg@mail.com", logger.New("debug"))
+
+		// Act
+		err = s.SendEmailVerification(context.Background(), "hank@mail.com", "<hank>", "http://localhost/verify?token=abc&x=1", time.Now().Add(time.Hour))
+
+		// Assert
+		assert.NoError(t, err)
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.Len(t, files, 1)
+		content, _ := os.ReadFile(files[0])
+		assert.Contains(t, string(content), "Subject: Verify your email")
+		assert.Contains(t, string(content), "To: <hank@mail.com>")
+		assert.NotContains(t, string(content), "<hank>", "The username should have been escaped")
+	})
+}
+
+func TestAccountEmailSender_SendPasswordReset(t *testing.T) {
+
+	t.Run("should send the reset link", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		m, err := NewFileMailer(dir, logger.New("debug"))
+		assert.NoError(t, err)
+		s := NewAccountEmailSender(m, "bgg@mail.com", logger.New("debug"))
+
+		// Act
+		err = s.SendPasswordReset(context.Background(), "hank@mail.com", "hank", "http://localhost/reset-password?token=abc", time.Now().Add(time.Hour))
+
+		// Assert
+		assert.NoError(t, err)
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.Len(t, files, 1)
+		content, _ := os.ReadFile(files[0])
+		assert.Contains(t, string(content), "Subject: Reset your password")
+		assert.Contains(t, string(content), "To: <hank@mail.com>")
+	})
+}
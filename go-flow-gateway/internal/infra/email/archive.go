@@ -0,0 +1,197 @@
+package email
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// WinZip AES (AE-2) with a 256-bit key, see https://www.winzip.com/en/support/aes-encryption/
+	_aesMethod         = 99
+	_aesExtraID        = 0x9901
+	_aesVersion        = 2
+	_aesStrength256    = 3
+	_aesKeySize        = 32
+	_aesSaltSize       = 16
+	_aesVerifierSize   = 2
+	_aesAuthCodeSize   = 10
+	_aesKeyIterations  = 1000
+	_zipFlagEncrypted  = 0x1
+	_zipFlagDescriptor = 0x8
+
+	_archivePasswordLength   = 16
+	_archivePasswordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+)
+
+// archiveWriter streams files into a zip archive one at a time. With a password every entry is
+// encrypted with WinZip AES-256, which the common archive tools can open.
+type archiveWriter struct {
+	zw       *zip.Writer
+	password string
+	names    map[string]int
+}
+
+func newArchiveWriter(w io.Writer, password string) *archiveWriter {
+	return &archiveWriter{zw: zip.NewWriter(w), password: password, names: make(map[string]int)}
+}
+
+// Add compresses content into the archive under name. Names that are already taken get a numbered suffix.
+func (a *archiveWriter) Add(name string, content []byte) error {
+	name = a.uniqueName(name)
+	if a.password == "" {
+		w, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return fmt.Errorf("archiveWriter - Add - zw.CreateHeader: %w", err)
+		}
+		_, err = w.Write(content)
+		return err
+	}
+	return a.addEncrypted(name, content)
+}
+
+func (a *archiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+// addEncrypted writes an AE-2 entry: salt, password verifier, the deflated content encrypted with
+// AES-CTR and an HMAC-SHA1 of the ciphertext. AE-2 leaves the CRC empty, the HMAC authenticates the data.
+func (a *archiveWriter) addEncrypted(name string, content []byte) error {
+	salt := make([]byte, _aesSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("archiveWriter - addEncrypted - rand.Read: %w", err)
+	}
+	keys := pbkdf2.Key([]byte(a.password), salt, _aesKeyIterations, 2*_aesKeySize+_aesVerifierSize, sha1.New)
+	block, err := aes.NewCipher(keys[:_aesKeySize])
+	if err != nil {
+		return fmt.Errorf("archiveWriter - addEncrypted - aes.NewCipher: %w", err)
+	}
+	mac := hmac.New(sha1.New, keys[_aesKeySize:2*_aesKeySize])
+
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], _aesExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], _aesVersion)
+	copy(extra[6:], "AE")
+	extra[8] = _aesStrength256
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             _aesMethod,
+		Flags:              _zipFlagEncrypted | _zipFlagDescriptor,
+		Extra:              extra,
+		UncompressedSize64: uint64(len(content)),
+	}
+	fh.SetModTime(time.Now())
+	w, err := a.zw.CreateRaw(fh)
+	if err != nil {
+		return fmt.Errorf("archiveWriter - addEncrypted - zw.CreateRaw: %w", err)
+	}
+
+	cw := &countingWriter{w: w}
+	if _, err := cw.Write(salt); err != nil {
+		return err
+	}
+	if _, err := cw.Write(keys[2*_aesKeySize:]); err != nil {
+		return err
+	}
+	fw, err := flate.NewWriter(newAESCTRWriter(io.MultiWriter(cw, mac), block), flate.DefaultCompression)
+	if err != nil {
+		return fmt.Errorf("archiveWriter - addEncrypted - flate.NewWriter: %w", err)
+	}
+	if _, err := fw.Write(content); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	if _, err := cw.Write(mac.Sum(nil)[:_aesAuthCodeSize]); err != nil {
+		return err
+	}
+
+	// the sizes go into the data descriptor and the central directory once the entry is closed
+	fh.CompressedSize64 = uint64(cw.n)
+	fh.CompressedSize = uint32(min(fh.CompressedSize64, 0xffffffff))
+	fh.UncompressedSize = uint32(min(fh.UncompressedSize64, 0xffffffff))
+	return nil
+}
+
+func (a *archiveWriter) uniqueName(name string) string {
+	a.names[name]++
+	if n := a.names[name]; n > 1 {
+		ext := path.Ext(name)
+		return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	return name
+}
+
+// aesCTRWriter encrypts with AES in the counter mode of WinZip AES, a little-endian counter starting at 1.
+type aesCTRWriter struct {
+	w       io.Writer
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newAESCTRWriter(w io.Writer, block cipher.Block) *aesCTRWriter {
+	return &aesCTRWriter{w: w, block: block, used: aes.BlockSize}
+}
+
+func (c *aesCTRWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	for i, b := range p {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		buf[i] = b ^ c.stream[c.used]
+		c.used++
+	}
+	return c.w.Write(buf)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// newArchivePassword generates the password of a protected archive.
+func newArchivePassword() (string, error) {
+	password := make([]byte, _archivePasswordLength)
+	limit := big.NewInt(int64(len(_archivePasswordAlphabet)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		password[i] = _archivePasswordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,110 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestArchiveWriter_Add(t *testing.T) {
+
+	t.Run("should write a zip archive readable by archive/zip", func(t *testing.T) {
+		// Arrange
+		var buf bytes.Buffer
+		archive := newArchiveWriter(&buf, "")
+
+		// Act
+		assert.NoError(t, archive.Add("notes.txt", []byte("first")))
+		assert.NoError(t, archive.Add("notes.txt", []byte("second")))
+		assert.NoError(t, archive.Close())
+
+		// Assert
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Len(t, r.File, 2)
+		assert.Equal(t, "notes.txt", r.File[0].Name)
+		assert.Equal(t, "notes (2).txt", r.File[1].Name)
+		f, err := r.File[1].Open()
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(f)
+		assert.Equal(t, []byte("second"), content)
+	})
+
+	t.Run("should encrypt the entries with WinZip AES", func(t *testing.T) {
+		// Arrange
+		var buf bytes.Buffer
+		password := "secret"
+		content := bytes.Repeat([]byte("dummy file content "), 100)
+		archive := newArchiveWriter(&buf, password)
+
+		// Act
+		assert.NoError(t, archive.Add("report.txt", content))
+		assert.NoError(t, archive.Close())
+
+		// Assert
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Len(t, r.File, 1)
+		f := r.File[0]
+		assert.Equal(t, uint16(_aesMethod), f.Method)
+		assert.Equal(t, uint16(_zipFlagEncrypted), f.Flags&_zipFlagEncrypted)
+		assert.Equal(t, uint64(len(content)), f.UncompressedSize64)
+
+		rc, err := f.OpenRaw()
+		assert.NoError(t, err)
+		raw, _ := io.ReadAll(rc)
+		assert.Equal(t, f.CompressedSize64, uint64(len(raw)))
+		assert.Equal(t, content, decryptAESEntry(t, raw, password))
+	})
+}
+
+func TestNewArchivePassword(t *testing.T) {
+
+	t.Run("should generate distinct passwords", func(t *testing.T) {
+		// Act
+		first, err := newArchivePassword()
+		assert.NoError(t, err)
+		second, _ := newArchivePassword()
+
+		// Assert
+		assert.Len(t, first, _archivePasswordLength)
+		assert.NotEqual(t, first, second)
+	})
+}
+
+// decryptAESEntry checks the password verifier and the authentication code of an AE-2 entry and
+// returns the inflated content.
+func decryptAESEntry(t *testing.T, raw []byte, password string) []byte {
+	t.Helper()
+
+	salt := raw[:_aesSaltSize]
+	verifier := raw[_aesSaltSize : _aesSaltSize+_aesVerifierSize]
+	ciphertext := raw[_aesSaltSize+_aesVerifierSize : len(raw)-_aesAuthCodeSize]
+	authCode := raw[len(raw)-_aesAuthCodeSize:]
+
+	keys := pbkdf2.Key([]byte(password), salt, _aesKeyIterations, 2*_aesKeySize+_aesVerifierSize, sha1.New)
+	assert.Equal(t, keys[2*_aesKeySize:], verifier, "The password verifier should match")
+
+	mac := hmac.New(sha1.New, keys[_aesKeySize:2*_aesKeySize])
+	mac.Write(ciphertext)
+	assert.Equal(t, mac.Sum(nil)[:_aesAuthCodeSize], authCode, "The authentication code should match")
+
+	block, err := aes.NewCipher(keys[:_aesKeySize])
+	assert.NoError(t, err)
+	var compressed bytes.Buffer
+	// CTR is symmetric, encrypting the ciphertext again yields the plaintext
+	_, err = newAESCTRWriter(&compressed, block).Write(ciphertext)
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(flate.NewReader(&compressed))
+	assert.NoError(t, err)
+	return content
+}
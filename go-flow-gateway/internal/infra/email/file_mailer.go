@@ -0,0 +1,56 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// FileMailer writes every email as an .eml file into a directory instead of
+// delivering it. It is meant for local development and tests.
+type FileMailer struct {
+	dir    string
+	logger logger.Logger
+}
+
+func NewFileMailer(dir string, l logger.Logger) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("FileMailer - NewFileMailer - os.MkdirAll: %w", err)
+	}
+	return &FileMailer{dir: dir, logger: l}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, email *mail.Email) error {
+	if err := email.GetError(); err != nil {
+		return fmt.Errorf("FileMailer - Send - email.GetError: %w", err)
+	}
+	if len(email.GetRecipients()) == 0 {
+		return errors.New("FileMailer - Send: no recipient specified")
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("FileMailer - Send - rand.Read: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	path := filepath.Join(m.dir, name)
+
+	if err := os.WriteFile(path, []byte(email.GetMessage()), 0o644); err != nil {
+		return fmt.Errorf("FileMailer - Send - os.WriteFile: %w", err)
+	}
+
+	m.logger.Info("FileMailer - Send: email written", "path", path)
+	return nil
+}
+
+func (m *FileMailer) Close() error {
+	return nil
+}
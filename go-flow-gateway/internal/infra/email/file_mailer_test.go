@@ -0,0 +1,54 @@
+package email
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+
+	t.Run("should write the email as an eml file", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		m, err := NewFileMailer(dir, logger.New("debug"))
+		assert.NoError(t, err)
+
+		email := mail.NewMSG()
+		email.SetFrom("bgg@mail.com").
+			AddTo("johndoe@email.com").
+			SetSubject("test subject").
+			SetBody(mail.TextPlain, "test body")
+
+		// Act
+		err = m.Send(context.Background(), email)
+
+		// Assert
+		assert.NoError(t, err)
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.Len(t, files, 1)
+		content, _ := os.ReadFile(files[0])
+		assert.True(t, strings.Contains(string(content), "Subject: test subject"))
+	})
+
+	t.Run("should return an error when there is no recipient", func(t *testing.T) {
+		// Arrange
+		m, err := NewFileMailer(t.TempDir(), logger.New("debug"))
+		assert.NoError(t, err)
+
+		email := mail.NewMSG()
+		email.SetFrom("bgg@mail.com").SetSubject("test subject")
+
+		// Act
+		err = m.Send(context.Background(), email)
+
+		// Assert
+		assert.Error(t, err)
+	})
+}
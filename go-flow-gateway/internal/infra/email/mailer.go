@@ -0,0 +1,33 @@
+package email
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+)
+
+// Mailer delivers a composed email through a transport.
+type Mailer interface {
+	Send(ctx context.Context, email *mail.Email) error
+	Close() error
+}
+
+// NewMailer builds the transport selected in config.
+func NewMailer(cfg config.MailConfig, l logger.Logger) (Mailer, error) {
+	switch cfg.Transport {
+	case TransportSMTP, "":
+		return NewSMTPMailer(cfg.SMTP, l)
+	case TransportFile:
+		return NewFileMailer(cfg.FileDrop.Dir, l)
+	default:
+		return nil, fmt.Errorf("email - NewMailer: unknown mail transport %q", cfg.Transport)
+	}
+}
@@ -0,0 +1,128 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SMTPMailer sends emails through an SMTP server. The connection is opened
+// lazily, kept alive between sends when configured, and re-established when
+// the server has dropped it while idle. A send that fails once the message was
+// handed over is not repeated, the server may have accepted it already.
+type SMTPMailer struct {
+	server *mail.SMTPServer
+	client *mail.SMTPClient
+	mu     sync.Mutex
+	logger logger.Logger
+}
+
+func NewSMTPMailer(cfg config.SMTPConfig, l logger.Logger) (*SMTPMailer, error) {
+	encryption, err := parseEncryption(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("SMTPMailer - NewSMTPMailer - parseEncryption: %w", err)
+	}
+
+	server := mail.NewSMTPClient()
+	server.Host = cfg.Host
+	server.Port = cfg.Port
+	server.Username = cfg.Username
+	server.Password = cfg.Password
+	server.Encryption = encryption
+	server.KeepAlive = cfg.KeepAlive
+	server.ConnectTimeout = cfg.ConnectTimeout
+	server.SendTimeout = cfg.SendTimeout
+	server.Authentication = mail.AuthAuto
+	if cfg.Username == "" {
+		server.Authentication = mail.AuthNone
+	}
+
+	return &SMTPMailer{server: server, logger: l}, nil
+}
+
+func parseEncryption(encryption string) (mail.Encryption, error) {
+	switch strings.ToLower(encryption) {
+	case "", "none":
+		return mail.EncryptionNone, nil
+	case "ssl", "tls", "ssltls":
+		return mail.EncryptionSSLTLS, nil
+	case "starttls":
+		return mail.EncryptionSTARTTLS, nil
+	default:
+		return mail.EncryptionNone, fmt.Errorf("unknown smtp encryption %q", encryption)
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email *mail.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("SMTPMailer - Send: %w", err)
+	}
+
+	client, err := m.connect()
+	if err != nil {
+		return fmt.Errorf("SMTPMailer - Send - m.connect: %w", err)
+	}
+
+	err = email.Send(client)
+	if err != nil {
+		m.reset()
+		return fmt.Errorf("SMTPMailer - Send - email.Send: %w", err)
+	}
+
+	// without keep-alive the library quits the session after each send
+	if !m.server.KeepAlive {
+		m.client = nil
+	}
+	return nil
+}
+
+// connect returns the cached client when it still answers NOOP, otherwise it dials a new one. This is the
+// only place a lost connection is retried, nothing of the message has been sent yet.
+func (m *SMTPMailer) connect() (*mail.SMTPClient, error) {
+	if m.client != nil {
+		if err := m.client.Noop(); err == nil {
+			return m.client, nil
+		}
+		m.reset()
+	}
+
+	client, err := m.server.Connect()
+	if err != nil {
+		if client != nil {
+			client.Close()
+		}
+		return nil, err
+	}
+
+	m.logger.Info("SMTPMailer - connect: connected to smtp server", "host", m.server.Host)
+	m.client = client
+	return client, nil
+}
+
+func (m *SMTPMailer) reset() {
+	if m.client != nil {
+		m.client.Close()
+		m.client = nil
+	}
+}
+
+func (m *SMTPMailer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.client == nil {
+		return nil
+	}
+	m.client.Quit()
+	err := m.client.Close()
+	m.client = nil
+	return err
+}
@@ -0,0 +1,175 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// fakeSMTPServer speaks just enough SMTP for the mailer. It counts the connections and the messages it
+// received, and drops the connection instead of answering the end of DATA when dropAfterData is set.
+type fakeSMTPServer struct {
+	listener      net.Listener
+	dropAfterData bool
+
+	mu          sync.Mutex
+	conns       []net.Conn
+	connections int
+	messages    int
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	s := &fakeSMTPServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.connections++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			for {
+				line, err = r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+			}
+			s.mu.Lock()
+			s.messages++
+			s.mu.Unlock()
+			if s.dropAfterData {
+				return
+			}
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// dropConnections closes the open connections as a server does with idle ones.
+func (s *fakeSMTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeSMTPServer) counts() (connections int, messages int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections, s.messages
+}
+
+func newTestSMTPMailer(t *testing.T, s *fakeSMTPServer) *SMTPMailer {
+	t.Helper()
+
+	addr := s.listener.Addr().(*net.TCPAddr)
+	m, err := NewSMTPMailer(config.SMTPConfig{
+		Host:           addr.IP.String(),
+		Port:           addr.Port,
+		KeepAlive:      true,
+		ConnectTimeout: time.Second,
+		SendTimeout:    time.Second,
+	}, logger.New("debug"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func newTestEmail() *mail.Email {
+	email := mail.NewMSG()
+	email.SetFrom("bgg@mail.com").
+		AddTo("johndoe@email.com").
+		SetSubject("test subject").
+		SetBody(mail.TextPlain, "test body")
+	return email
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+
+	t.Run("should reconnect when the server dropped the idle connection", func(t *testing.T) {
+		// Arrange
+		s := newFakeSMTPServer(t)
+		m := newTestSMTPMailer(t, s)
+		assert.NoError(t, m.Send(context.Background(), newTestEmail()))
+		s.dropConnections()
+
+		// Act
+		err := m.Send(context.Background(), newTestEmail())
+
+		// Assert
+		assert.NoError(t, err)
+		connections, messages := s.counts()
+		assert.Equal(t, 2, connections)
+		assert.Equal(t, 2, messages)
+	})
+
+	t.Run("should not resend when the connection is lost after the message was handed over", func(t *testing.T) {
+		// Arrange
+		s := newFakeSMTPServer(t)
+		s.dropAfterData = true
+		m := newTestSMTPMailer(t, s)
+
+		// Act
+		err := m.Send(context.Background(), newTestEmail())
+
+		// Assert
+		assert.Error(t, err)
+		connections, messages := s.counts()
+		assert.Equal(t, 1, connections)
+		assert.Equal(t, 1, messages)
+	})
+}
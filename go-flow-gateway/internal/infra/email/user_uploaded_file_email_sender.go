@@ -2,27 +2,44 @@ package email
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"strings"
 
+	"github.com/bgg/go-flow-gateway/config"
 	"github.com/bgg/go-flow-gateway/internal/entity"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
 
 type UserUploadedFileEmailSender struct {
-	smtp   *mail.SMTPClient
-	logger logger.Logger
+	mailer  Mailer
+	from    string
+	archive config.ArchiveConfig
+	logger  logger.Logger
 }
 
-func NewUserUploadedFileEmailSender(smtp *mail.SMTPClient, l logger.Logger) *UserUploadedFileEmailSender {
-	return &UserUploadedFileEmailSender{smtp: smtp, logger: l}
+func NewUserUploadedFileEmailSender(m Mailer, from string, archive config.ArchiveConfig, l logger.Logger) *UserUploadedFileEmailSender {
+	return &UserUploadedFileEmailSender{mailer: m, from: from, archive: archive, logger: l}
 }
 
-func (s *UserUploadedFileEmailSender) Send(ctx context.Context, uuf entity.UserUploadedFile) error {
+// Send emails the file to its recipient and returns the Message-ID of the email, which the mail
+// provider reports back in its delivery status callbacks.
+func (s *UserUploadedFileEmailSender) Send(ctx context.Context, uuf entity.UserUploadedFile) (string, error) {
 	s.logger.Info("UserUploadedFileEmailSender - Send: sending email", "userUploadedFileID", uuf.ID)
 
+	messageID, err := newMessageID(s.from)
+	if err != nil {
+		return "", fmt.Errorf("UserUploadedFileEmailSender - Send - newMessageID: %w", err)
+	}
+
 	email := mail.NewMSG()
-	email.SetFrom("bgg@mail.com").
-		AddTo(uuf.EmailRecipient).
+	email.AddHeader("Message-ID", "<"+messageID+">")
+	email.SetFrom(s.from).
+		AddTo(strings.Split(uuf.EmailRecipient, ", ")...). // a resend can name several recipients
 		SetSubject("Your File Upload Confirmation").
 		SetBody(mail.TextHTML, "<h1>File Upload Successful</h1>"+
 			"<p>Hello,</p>"+
@@ -37,12 +54,181 @@ func (s *UserUploadedFileEmailSender) Send(ctx context.Context, uuf entity.UserU
 	}
 	email.Attach(&attachment)
 
-	err := email.Send(s.smtp)
+	err = s.mailer.Send(ctx, email)
 	if err != nil {
 		s.logger.Error("UserUploadedFileEmailSender - Send: failed to send email", "error", err)
-		return err
+		return "", err
+	}
+
+	s.logger.Info("UserUploadedFileEmailSender - Send: successfully sent email", "userUploadedFileID", uuf.ID, "messageID", messageID)
+	return messageID, nil
+}
+
+// SendDelivery sends the clean files of a delivery to all of its recipients in one email.
+// Files withheld by the scan or the checksum verification are listed without attachment. The content is
+// loaded one file at a time, deliveries with many files are bundled into a zip archive written to disk.
+// The archive is protected with the password when one is given, the caller sends it with
+// SendArchivePassword once it recorded that the archive went out.
+func (s *UserUploadedFileEmailSender) SendDelivery(ctx context.Context, delivery entity.Delivery, password string, load func(ctx context.Context, file entity.UserUploadedFile) ([]byte, error)) (string, error) {
+	s.logger.Info("UserUploadedFileEmailSender - SendDelivery: sending email", "deliveryID", delivery.ID)
+
+	var delivered, withheld strings.Builder
+	clean := make([]entity.UserUploadedFile, 0, len(delivery.Files))
+	for _, file := range delivery.Files {
+		if file.Status != entity.FileStatusClean {
+			withheld.WriteString("<li>" + html.EscapeString(file.Name) + "</li>")
+			continue
+		}
+		delivered.WriteString("<li>" + html.EscapeString(file.Name) + "</li>")
+		clean = append(clean, file)
+	}
+
+	messageID, err := newMessageID(s.from)
+	if err != nil {
+		return "", fmt.Errorf("UserUploadedFileEmailSender - SendDelivery - newMessageID: %w", err)
+	}
+
+	email := mail.NewMSG()
+	email.AddHeader("Message-ID", "<"+messageID+">")
+	if s.bundles(len(clean)) {
+		err = s.attachArchive(ctx, email, delivery.ID, password, clean, load)
+		if err != nil {
+			s.logger.Error("UserUploadedFileEmailSender - SendDelivery: failed to build archive", "error", err)
+			return "", err
+		}
+	} else {
+		for _, file := range clean {
+			content, err := load(ctx, file)
+			if err != nil {
+				s.logger.Error("UserUploadedFileEmailSender - SendDelivery: failed to load file content", "error", err)
+				return "", err
+			}
+			email.Attach(&mail.File{
+				Name: file.Name,
+				Data: content,
+			})
+		}
+	}
+
+	body := "<h1>File Upload Successful</h1>" +
+		"<p>Hello,</p>" +
+		"<p>We have successfully received your file upload.</p>" +
+		"<p><b>Files:</b></p><ul>" + delivered.String() + "</ul>"
+	if password != "" {
+		body += "<p>The files are attached as a protected zip archive, the password follows in a separate email.</p>"
+	}
+	if withheld.Len() > 0 {
+		body += "<p><b>The following files could not be delivered:</b></p><ul>" + withheld.String() + "</ul>"
+	}
+	body += "<p>If you have any questions or need further assistance, please do not hesitate to contact us.</p>" +
+		"<p>Best Regards,<br>Your Support Team</p>"
+
+	email.SetFrom(s.from).
+		AddTo(delivery.EmailRecipients...).
+		SetSubject("Your File Upload Confirmation").
+		SetBody(mail.TextHTML, body)
+
+	err = s.mailer.Send(ctx, email)
+	if err != nil {
+		s.logger.Error("UserUploadedFileEmailSender - SendDelivery: failed to send email", "error", err)
+		return "", err
+	}
+	s.logger.Info("UserUploadedFileEmailSender - SendDelivery: successfully sent email", "deliveryID", delivery.ID, "messageID", messageID)
+	return messageID, nil
+}
+
+// attachArchive streams the files into a zip archive in a temporary file and attaches it. The archive
+// is protected with the password unless it is empty.
+func (s *UserUploadedFileEmailSender) attachArchive(ctx context.Context, email *mail.Email, deliveryID int, password string, files []entity.UserUploadedFile, load func(ctx context.Context, file entity.UserUploadedFile) ([]byte, error)) error {
+	f, err := os.CreateTemp("", "delivery-*.zip")
+	if err != nil {
+		return fmt.Errorf("UserUploadedFileEmailSender - attachArchive - os.CreateTemp: %w", err)
 	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	s.logger.Info("UserUploadedFileEmailSender - Send: successfully sent email", "userUploadedFileID", uuf.ID)
+	archive := newArchiveWriter(f, password)
+	for _, file := range files {
+		content, err := load(ctx, file)
+		if err != nil {
+			return fmt.Errorf("UserUploadedFileEmailSender - attachArchive - load: %w", err)
+		}
+		if err := archive.Add(file.Name, content); err != nil {
+			return fmt.Errorf("UserUploadedFileEmailSender - attachArchive - archive.Add: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("UserUploadedFileEmailSender - attachArchive - archive.Close: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("UserUploadedFileEmailSender - attachArchive - f.Close: %w", err)
+	}
+
+	// the file is read when it is attached, so it can be removed right after
+	email.Attach(&mail.File{
+		FilePath: f.Name(),
+		Name:     fmt.Sprintf("delivery-%d.zip", deliveryID),
+		MimeType: "application/zip",
+	})
+	if err := email.GetError(); err != nil {
+		return fmt.Errorf("UserUploadedFileEmailSender - attachArchive - email.Attach: %w", err)
+	}
+	return nil
+}
+
+// ArchivePassword returns a new password for the archive of a delivery, which is empty unless the clean
+// files of the delivery are bundled into a protected archive.
+func (s *UserUploadedFileEmailSender) ArchivePassword(delivery entity.Delivery) (string, error) {
+	clean := 0
+	for _, file := range delivery.Files {
+		if file.Status == entity.FileStatusClean {
+			clean++
+		}
+	}
+	if !s.archive.Encrypt || !s.bundles(clean) {
+		return "", nil
+	}
+	password, err := newArchivePassword()
+	if err != nil {
+		return "", fmt.Errorf("UserUploadedFileEmailSender - ArchivePassword - newArchivePassword: %w", err)
+	}
+	return password, nil
+}
+
+// bundles reports whether that many clean files are sent as an archive rather than one attachment each.
+func (s *UserUploadedFileEmailSender) bundles(clean int) bool {
+	return s.archive.MinFiles > 0 && clean >= s.archive.MinFiles
+}
+
+// SendArchivePassword sends the password of the archive of a delivery in an email of its own.
+func (s *UserUploadedFileEmailSender) SendArchivePassword(ctx context.Context, delivery entity.Delivery, password string) error {
+	email := mail.NewMSG()
+	email.SetFrom(s.from).
+		AddTo(delivery.EmailRecipients...).
+		SetSubject("Password for your file upload").
+		SetBody(mail.TextHTML, "<p>Hello,</p>"+
+			"<p>The files of your upload were sent as a protected zip archive in a separate email.</p>"+
+			"<p><b>Password:</b> "+html.EscapeString(password)+"</p>"+
+			"<p>Best Regards,<br>Your Support Team</p>")
+
+	err := s.mailer.Send(ctx, email)
+	if err != nil {
+		s.logger.Error("UserUploadedFileEmailSender - SendArchivePassword: failed to send archive password", "error", err)
+		return err
+	}
+	s.logger.Info("UserUploadedFileEmailSender - SendArchivePassword: successfully sent archive password", "deliveryID", delivery.ID)
 	return nil
 }
+
+// newMessageID generates a globally unique Message-ID, without angle brackets, in the domain of the sender.
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = strings.TrimSuffix(from[i+1:], ">")
+	}
+	return hex.EncodeToString(b) + "@" + domain, nil
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserUploadedFileEmailSender_SendDelivery(t *testing.T) {
+
+	delivery := entity.Delivery{
+		ID:              7,
+		EmailRecipients: []string{"johndoe@email.com"},
+		Files: []entity.UserUploadedFile{
+			{ID: 1, Name: "a.txt", Status: entity.FileStatusClean},
+			{ID: 2, Name: "b.txt", Status: entity.FileStatusClean},
+			{ID: 3, Name: "eicar.txt", Status: entity.FileStatusQuarantined},
+		},
+	}
+
+	t.Run("should bundle the clean files into a protected archive and send the password separately", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		m, err := NewFileMailer(dir, logger.New("debug"))
+		assert.NoError(t, err)
+		s := NewUserUploadedFileEmailSender(m, "bgg@mail.com", config.ArchiveConfig{MinFiles: 2, Encrypt: true}, logger.New("debug"))
+
+		var loaded []int
+		load := func(ctx context.Context, file entity.UserUploadedFile) ([]byte, error) {
+			loaded = append(loaded, file.ID)
+			return []byte("content of " + file.Name), nil
+		}
+
+		// Act
+		password, err := s.ArchivePassword(delivery)
+		assert.NoError(t, err)
+		_, err = s.SendDelivery(context.Background(), delivery, password, load)
+		assert.NoError(t, err)
+		archiveOnly, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		err = s.SendArchivePassword(context.Background(), delivery, password)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NotEmpty(t, password, "The password of the archive should be returned")
+		assert.Len(t, archiveOnly, 1, "SendDelivery should not send the password")
+		assert.Equal(t, []int{1, 2}, loaded, "Only the clean files should have been loaded")
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.Len(t, files, 2, "The password should have been sent in a separate email")
+		var messages []string
+		for _, f := range files {
+			content, _ := os.ReadFile(f)
+			messages = append(messages, string(content))
+		}
+		joined := strings.Join(messages, "\n")
+		assert.Contains(t, joined, "delivery-7.zip")
+		assert.Contains(t, joined, "Subject: Password for your file upload")
+	})
+
+	t.Run("should attach the files individually below the archive threshold", func(t *testing.T) {
+		// Arrange
+		dir := t.TempDir()
+		m, err := NewFileMailer(dir, logger.New("debug"))
+		assert.NoError(t, err)
+		s := NewUserUploadedFileEmailSender(m, "bgg@mail.com", config.ArchiveConfig{MinFiles: 5}, logger.New("debug"))
+
+		load := func(ctx context.Context, file entity.UserUploadedFile) ([]byte, error) {
+			return []byte("content of " + file.Name), nil
+		}
+
+		// Act
+		password, passwordErr := s.ArchivePassword(delivery)
+		messageID, err := s.SendDelivery(context.Background(), delivery, password, load)
+
+		// Assert
+		assert.NoError(t, passwordErr)
+		assert.Empty(t, password, "No archive should have been built")
+		assert.NoError(t, err)
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		assert.Len(t, files, 1)
+		content, _ := os.ReadFile(files[0])
+		assert.NotContains(t, string(content), ".zip")
+		assert.Contains(t, string(content), "a.txt")
+		assert.True(t, strings.HasSuffix(messageID, "@mail.com"), "The Message-ID should be in the domain of the sender")
+		assert.Contains(t, string(content), "<"+messageID+">", "The email should carry the returned Message-ID")
+	})
+}
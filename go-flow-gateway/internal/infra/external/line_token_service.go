@@ -1,7 +1,6 @@
 package external
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,10 +21,15 @@ func NewLineTokenService(l logger.Logger) *LineTokenService {
 	return &LineTokenService{logger: l}
 }
 
-func (l *LineTokenService) VerifyIDToken(idToken, clientID string) (*dto.LineUserProfile, error) {
-	data := fmt.Sprintf("id_token=%s&client_id=%s", idToken, clientID)
+// VerifyIDToken has LINE check the id token, including that it carries the nonce sent with the login.
+func (l *LineTokenService) VerifyIDToken(idToken, clientID, nonce string) (*dto.LineUserProfile, error) {
+	data := url.Values{
+		"id_token":  {idToken},
+		"client_id": {clientID},
+		"nonce":     {nonce},
+	}
 
-	req, err := http.NewRequest("POST", "https://api.line.me/oauth2/v2.1/verify", bytes.NewBufferString(data))
+	req, err := http.NewRequest("POST", "https://api.line.me/oauth2/v2.1/verify", strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to LINE: %v", err)
 	}
@@ -55,7 +59,9 @@ func (l *LineTokenService) VerifyIDToken(idToken, clientID string) (*dto.LineUse
 	return &profile, nil
 }
 
-func (l *LineTokenService) ExchangeCodeForTokens(code, domainUrl string) (*dto.TokenResponse, error) {
+// ExchangeCodeForTokens redeems the authorization code, proving with the PKCE code verifier that this server
+// started the login.
+func (l *LineTokenService) ExchangeCodeForTokens(code, domainUrl, codeVerifier string) (*dto.TokenResponse, error) {
 
 	tokenEndpoint := "https://api.line.me/oauth2/v2.1/token"
 
@@ -65,6 +71,7 @@ func (l *LineTokenService) ExchangeCodeForTokens(code, domainUrl string) (*dto.T
 		"redirect_uri":  {fmt.Sprintf("%s/api/v1/auth/line-callback", domainUrl)},
 		"client_id":     {os.Getenv("LINE_CHANNEL_ID")},
 		"client_secret": {os.Getenv("LINE_CHANNEL_SECRET")},
+		"code_verifier": {codeVerifier},
 	}
 
 	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(data.Encode()))
@@ -0,0 +1,125 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// WebhookSender posts webhook payloads to the endpoints of the users. Every request is signed with the
+// secret of the endpoint: X-Webhook-Signature is "sha256=" followed by the hex encoded HMAC-SHA256 of
+// "<X-Webhook-Timestamp>.<body>".
+type WebhookSender struct {
+	client    *http.Client
+	allowHTTP bool
+	logger    logger.Logger
+}
+
+// NewWebhookSender refuses to connect to loopback, private, link-local and unspecified addresses, whatever
+// the host of the endpoint resolves to, so an endpoint cannot reach the internal network. Plain http
+// endpoints are only called when allowHTTP is set.
+func NewWebhookSender(timeout time.Duration, allowHTTP bool, l logger.Logger) *WebhookSender {
+	return newWebhookSender(timeout, allowHTTP, refuseInternalAddress, l)
+}
+
+func newWebhookSender(timeout time.Duration, allowHTTP bool, control func(network, address string, c syscall.RawConn) error, l logger.Logger) *WebhookSender {
+	// the address is checked when the connection is made, after name resolution, so a host name
+	// resolving to an internal address is refused as well
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would connect on our behalf and bypass the check
+	transport.Proxy = nil
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// a redirect counts as a failure, the payload is only sent to the registered URL
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &WebhookSender{client: client, allowHTTP: allowHTTP, logger: l}
+}
+
+// Send posts the payload of the delivery and returns the status code of the response, 0 when no response
+// was received. Any status outside 2xx is reported as an error.
+func (s *WebhookSender) Send(ctx context.Context, delivery entity.WebhookDelivery) (int, error) {
+	u, err := url.Parse(delivery.URL)
+	if err != nil {
+		return 0, fmt.Errorf("WebhookSender - Send - url.Parse: %w", err)
+	}
+	// endpoints registered before plain http was refused are not called either
+	if u.Scheme != "https" && !(u.Scheme == "http" && s.allowHTTP) {
+		return 0, fmt.Errorf("webhook endpoint scheme not allowed: %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("WebhookSender - Send - http.NewRequestWithContext: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-flow-gateway-webhook")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("WebhookSender - Send - client.Do: %w", err)
+	}
+	defer resp.Body.Close()
+	// drain a little of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code from webhook endpoint: %d", resp.StatusCode)
+	}
+
+	s.logger.Debug("WebhookSender - Send: webhook delivered", "webhookDeliveryID", delivery.ID, "statusCode", resp.StatusCode)
+	return resp.StatusCode, nil
+}
+
+// _sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which net.IP.IsPrivate does not cover.
+var _sharedAddressSpace = net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// refuseInternalAddress is the Control of the dialer of the webhook sender. It refuses loopback, private,
+// shared (carrier-grade NAT), link-local and unspecified addresses.
+func refuseInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("WebhookSender - refuseInternalAddress - net.SplitHostPort: %w", err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("webhook endpoint address is not an IP address: %q", host)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || _sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("webhook endpoint address not allowed: %s", ip)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature header value for the payload.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
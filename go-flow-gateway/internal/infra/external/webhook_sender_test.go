@@ -0,0 +1,140 @@
+package external
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// allowAnyAddress lets the tests reach the loopback address of httptest servers.
+func allowAnyAddress(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+func TestWebhookSender_Send(t *testing.T) {
+
+	payload := []byte(`{"id":"abc","type":"file.created"}`)
+
+	t.Run("should post the signed payload", func(t *testing.T) {
+		// Arrange
+		var received *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		s := newWebhookSender(time.Second, true, allowAnyAddress, logger.New("debug"))
+		delivery := entity.WebhookDelivery{ID: 1, EventID: "abc", EventType: entity.FileEventCreated, Payload: payload, URL: server.URL, Secret: "whsec_test"}
+
+		// Act
+		statusCode, err := s.Send(context.Background(), delivery)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, statusCode)
+		assert.Equal(t, payload, body)
+		assert.Equal(t, entity.FileEventCreated, received.Header.Get("X-Webhook-Event"))
+		assert.Equal(t, "abc", received.Header.Get("X-Webhook-ID"))
+		timestamp := received.Header.Get("X-Webhook-Timestamp")
+		assert.Equal(t, SignWebhookPayload("whsec_test", timestamp, payload), received.Header.Get("X-Webhook-Signature"))
+	})
+
+	t.Run("should report a non 2xx response as failed", func(t *testing.T) {
+		// Arrange
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		}))
+		defer server.Close()
+
+		s := newWebhookSender(time.Second, true, allowAnyAddress, logger.New("debug"))
+
+		// Act
+		statusCode, err := s.Send(context.Background(), entity.WebhookDelivery{Payload: payload, URL: server.URL})
+
+		// Assert
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusFound, statusCode, "The redirect should not have been followed")
+	})
+
+	t.Run("should refuse to connect to a loopback address", func(t *testing.T) {
+		// Arrange
+		called := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer server.Close()
+
+		s := NewWebhookSender(time.Second, true, logger.New("debug"))
+
+		// Act
+		statusCode, err := s.Send(context.Background(), entity.WebhookDelivery{Payload: payload, URL: server.URL})
+
+		// Assert
+		assert.Error(t, err)
+		assert.Equal(t, 0, statusCode)
+		assert.False(t, called, "The endpoint should not have been called")
+	})
+
+	t.Run("should refuse a plain http endpoint unless allowed", func(t *testing.T) {
+		// Arrange
+		called := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer server.Close()
+
+		s := newWebhookSender(time.Second, false, allowAnyAddress, logger.New("debug"))
+
+		// Act
+		statusCode, err := s.Send(context.Background(), entity.WebhookDelivery{Payload: payload, URL: server.URL})
+
+		// Assert
+		assert.Error(t, err)
+		assert.Equal(t, 0, statusCode)
+		assert.False(t, called, "The endpoint should not have been called")
+	})
+}
+
+func TestRefuseInternalAddress(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		address string
+		refused bool
+	}{
+		{"refuses the IPv4 loopback", "127.0.0.1:443", true},
+		{"refuses the IPv6 loopback", "[::1]:443", true},
+		{"refuses a 10/8 address", "10.1.2.3:443", true},
+		{"refuses a 172.16/12 address", "172.16.0.1:443", true},
+		{"refuses a 192.168/16 address", "192.168.1.1:443", true},
+		{"refuses a unique local IPv6 address", "[fd00::1]:443", true},
+		{"refuses a carrier-grade NAT address", "100.64.0.1:443", true},
+		{"refuses the last carrier-grade NAT address", "100.127.255.254:443", true},
+		{"refuses the cloud metadata address", "169.254.169.254:80", true},
+		{"refuses a link-local IPv6 address", "[fe80::1]:443", true},
+		{"refuses the unspecified IPv4 address", "0.0.0.0:443", true},
+		{"refuses the unspecified IPv6 address", "[::]:443", true},
+		{"refuses a loopback mapped into IPv6", "[::ffff:127.0.0.1]:443", true},
+		{"allows a public IPv4 address", "93.184.216.34:443", false},
+		{"allows the address right after carrier-grade NAT", "100.128.0.1:443", false},
+		{"allows a public IPv6 address", "[2606:4700::1111]:443", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := refuseInternalAddress("tcp", tt.address, nil)
+			assert.Equal(t, tt.refused, err != nil, "error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+)
+
+// DeadLetterStore exposes the dead letter queue of the topology to the use cases.
+type DeadLetterStore struct {
+	deadLetters eventbus.DeadLetters
+}
+
+func NewDeadLetterStore(dl eventbus.DeadLetters) *DeadLetterStore {
+	return &DeadLetterStore{deadLetters: dl}
+}
+
+// List returns the dead letters without their body, the body of an uploaded file carries its content.
+func (s *DeadLetterStore) List(ctx context.Context, limit int) ([]entity.DeadLetter, error) {
+	letters, err := s.deadLetters.List(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("DeadLetterStore - List - deadLetters.List: %w", err)
+	}
+
+	result := make([]entity.DeadLetter, len(letters))
+	for i, dl := range letters {
+		result[i] = toEntity(dl)
+		result[i].Body = nil
+	}
+	return result, nil
+}
+
+func (s *DeadLetterStore) Get(ctx context.Context, id string) (entity.DeadLetter, error) {
+	dl, err := s.deadLetters.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, eventbus.ErrDeadLetterNotFound) {
+			return entity.DeadLetter{}, apperrors.NewNoRowsAffectedError("dead letter not found", fmt.Sprintf("DeadLetterStore - Get - deadLetters.Get: %s", err.Error()))
+		}
+		return entity.DeadLetter{}, fmt.Errorf("DeadLetterStore - Get - deadLetters.Get: %w", err)
+	}
+	return toEntity(dl), nil
+}
+
+func (s *DeadLetterStore) Replay(ctx context.Context, ids []string) (int, error) {
+	replayed, err := s.deadLetters.Replay(ctx, ids)
+	if err != nil {
+		return replayed, fmt.Errorf("DeadLetterStore - Replay - deadLetters.Replay: %w", err)
+	}
+	return replayed, nil
+}
+
+func (s *DeadLetterStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	purged, err := s.deadLetters.Purge(ctx, before)
+	if err != nil {
+		return purged, fmt.Errorf("DeadLetterStore - Purge - deadLetters.Purge: %w", err)
+	}
+	return purged, nil
+}
+
+func toEntity(dl eventbus.DeadLetter) entity.DeadLetter {
+	e := entity.DeadLetter{
+		ID:       dl.ID,
+		Event:    dl.Name,
+		Queue:    dl.Queue,
+		Error:    dl.Error,
+		FailedAt: dl.FailedAt,
+		Headers:  dl.Headers,
+	}
+	if json.Valid(dl.Body) {
+		e.Body = dl.Body
+	}
+	return e
+}
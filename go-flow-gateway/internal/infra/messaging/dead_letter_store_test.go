@@ -0,0 +1,64 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+
+	// setup dead-letters an uploaded file by consuming it with a failing handler
+	setup := func(t *testing.T) (*eventbus.Memory, *DeadLetterStore) {
+		bus := eventbus.NewMemory(Topology)
+		pub := NewUserUploadedFilePublisher(bus, logger.New("debug"))
+		assert.NoError(t, pub.Publish(context.Background(), entity.UserUploadedFile{ID: 1, Content: []byte("hello")}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		handled := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- bus.Subscribe(ctx, FileUploadedQueue, func(ctx context.Context, msg eventbus.Message) error {
+				defer close(handled)
+				return errors.New("mail server down")
+			})
+		}()
+		<-handled
+		cancel()
+		<-done
+		return bus, NewDeadLetterStore(bus)
+	}
+
+	t.Run("should list the dead letters without their body", func(t *testing.T) {
+		// Arrange
+		_, store := setup(t)
+
+		// Act
+		letters, err := store.List(context.Background(), 10)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Len(t, letters, 1)
+		assert.Equal(t, EventFileUploaded, letters[0].Event)
+		assert.Equal(t, FileUploadedQueue, letters[0].Queue)
+		assert.Equal(t, "mail server down", letters[0].Error)
+		assert.Nil(t, letters[0].Body)
+	})
+
+	t.Run("should report a missing dead letter as not found", func(t *testing.T) {
+		// Arrange
+		_, store := setup(t)
+
+		// Act
+		_, err := store.Get(context.Background(), "unknown")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+	})
+}
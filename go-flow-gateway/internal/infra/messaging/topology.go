@@ -0,0 +1,36 @@
+package messaging
+
+import (
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+)
+
+const (
+	EventFileUploaded    = "file.uploaded"    // A file waits for its email, the message carries its content
+	EventDeliveryCreated = "delivery.created" // A delivery waits for its email, the files are read from storage
+)
+
+// The queues are declared with a dead letter exchange, which a queue of the same name declared without it
+// refuses. The queue "user-uploaded-file-created-queue" of earlier releases is no longer consumed, the
+// messages left in it have to be moved before it is deleted.
+const (
+	FileUploadedQueue    = "go-flow-gateway.file-uploaded"
+	DeliveryCreatedQueue = "go-flow-gateway.delivery-created"
+	WebhookQueue         = "go-flow-gateway.webhook"
+	FileStatusQueue      = "go-flow-gateway.file-status"
+	DeadLetterQueue      = "go-flow-gateway.dead-letter" // also the name of its exchange
+)
+
+// Topology is every queue of the gateway and the events routed to it.
+var Topology = eventbus.Topology{
+	Exchange:   "go-flow-gateway",
+	DeadLetter: DeadLetterQueue,
+	Prefetch:   10,
+	Queues: []eventbus.Queue{
+		{Name: FileUploadedQueue, Bindings: []string{EventFileUploaded}},
+		{Name: DeliveryCreatedQueue, Bindings: []string{EventDeliveryCreated}},
+		{Name: WebhookQueue, Bindings: entity.FileEventTypes},
+		// the status streams of a user may be opened on any replica, each one needs every transition
+		{Name: FileStatusQueue, Bindings: entity.FileStatusEventTypes, PerInstance: true},
+	},
+}
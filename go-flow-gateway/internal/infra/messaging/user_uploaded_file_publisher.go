@@ -0,0 +1,80 @@
+package messaging
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+type fileUploaded struct {
+	entity.UserUploadedFile
+}
+
+func (fileUploaded) EventName() string { return EventFileUploaded }
+
+type deliveryCreated struct {
+	entity.Delivery
+}
+
+func (deliveryCreated) EventName() string { return EventDeliveryCreated }
+
+// fileEvent is published with its type as routing key, so consumers bind to the events they are
+// interested in.
+type fileEvent struct {
+	entity.FileEvent
+}
+
+func (e fileEvent) EventName() string { return e.Type }
+func (e fileEvent) EventID() string   { return e.ID }
+
+type UserUploadedFilePublisher struct {
+	logger logger.Logger
+	bus    eventbus.Publisher
+}
+
+func NewUserUploadedFilePublisher(bus eventbus.Publisher, l logger.Logger) *UserUploadedFilePublisher {
+	return &UserUploadedFilePublisher{logger: l, bus: bus}
+}
+
+func (pub *UserUploadedFilePublisher) Publish(ctx context.Context, file entity.UserUploadedFile) error {
+
+	file.Base64Content = base64.StdEncoding.EncodeToString(file.Content)
+	err := pub.bus.Publish(ctx, fileUploaded{file})
+	if err != nil {
+		pub.logger.Error("UserUploadedFilePublisher - Publish - bus.Publish: failed to publish message", "error", err)
+		return err
+	}
+
+	pub.logger.Info("UserUploadedFilePublisher - Publish: successfully published message", "event", EventFileUploaded, "userUploadedFileID", file.ID)
+	return nil
+}
+
+// PublishDelivery publishes a single event for all files of a delivery. The file content is not
+// part of the message, the consumer reads it from storage.
+func (pub *UserUploadedFilePublisher) PublishDelivery(ctx context.Context, delivery entity.Delivery) error {
+
+	err := pub.bus.Publish(ctx, deliveryCreated{delivery})
+	if err != nil {
+		pub.logger.Error("UserUploadedFilePublisher - PublishDelivery - bus.Publish: failed to publish message", "error", err)
+		return err
+	}
+
+	pub.logger.Info("UserUploadedFilePublisher - PublishDelivery: successfully published message", "event", EventDeliveryCreated, "deliveryID", delivery.ID)
+	return nil
+}
+
+// PublishFileEvent publishes a domain event about a file.
+func (pub *UserUploadedFilePublisher) PublishFileEvent(ctx context.Context, event entity.FileEvent) error {
+
+	err := pub.bus.Publish(ctx, fileEvent{event})
+	if err != nil {
+		pub.logger.Error("UserUploadedFilePublisher - PublishFileEvent - bus.Publish: failed to publish message", "error", err)
+		return err
+	}
+
+	pub.logger.Info("UserUploadedFilePublisher - PublishFileEvent: successfully published message", "event", event.Type, "eventID", event.ID)
+	return nil
+}
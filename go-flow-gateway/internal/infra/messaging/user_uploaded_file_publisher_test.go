@@ -0,0 +1,71 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/eventbus"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserUploadedFilePublisher(t *testing.T) {
+
+	t.Run("should publish the file with its content for the email consumer", func(t *testing.T) {
+		// Arrange
+		bus := eventbus.NewMemory(Topology)
+		pub := NewUserUploadedFilePublisher(bus, logger.New("debug"))
+
+		// Act
+		err := pub.Publish(context.Background(), entity.UserUploadedFile{ID: 1, Content: []byte("hello")})
+
+		// Assert
+		assert.NoError(t, err)
+		pending := bus.Pending(FileUploadedQueue)
+		assert.Len(t, pending, 1)
+		var file entity.UserUploadedFile
+		assert.NoError(t, json.Unmarshal(pending[0].Body, &file))
+		assert.Equal(t, 1, file.ID)
+		assert.Equal(t, "aGVsbG8=", file.Base64Content)
+		assert.Empty(t, bus.Pending(DeliveryCreatedQueue))
+	})
+
+	t.Run("should publish the delivery for the delivery consumer", func(t *testing.T) {
+		// Arrange
+		bus := eventbus.NewMemory(Topology)
+		pub := NewUserUploadedFilePublisher(bus, logger.New("debug"))
+
+		// Act
+		err := pub.PublishDelivery(context.Background(), entity.Delivery{ID: 7})
+
+		// Assert
+		assert.NoError(t, err)
+		pending := bus.Pending(DeliveryCreatedQueue)
+		assert.Len(t, pending, 1)
+		var delivery entity.Delivery
+		assert.NoError(t, json.Unmarshal(pending[0].Body, &delivery))
+		assert.Equal(t, 7, delivery.ID)
+		assert.Empty(t, bus.Pending(FileUploadedQueue))
+	})
+
+	t.Run("should route file events to webhooks and status streams by their type", func(t *testing.T) {
+		// Arrange
+		bus := eventbus.NewMemory(Topology)
+		pub := NewUserUploadedFilePublisher(bus, logger.New("debug"))
+
+		// Act
+		err := pub.PublishFileEvent(context.Background(), entity.FileEvent{ID: "evt-1", Type: entity.FileEventCreated})
+		assert.NoError(t, err)
+		err = pub.PublishFileEvent(context.Background(), entity.FileEvent{ID: "evt-2", Type: entity.FileEventScanning})
+		assert.NoError(t, err)
+
+		// Assert
+		webhook := bus.Pending(WebhookQueue)
+		assert.Len(t, webhook, 1, "Scanning is not an event webhooks subscribe to")
+		assert.Equal(t, "evt-1", webhook[0].ID)
+		assert.Len(t, bus.Pending(FileStatusQueue), 2)
+		assert.Empty(t, bus.Pending(FileUploadedQueue))
+	})
+}
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+)
+
+type EmailVerificationRepo struct {
+	*postgres.Postgres
+	logger logger.Logger
+}
+
+func NewEmailVerificationRepo(pg *postgres.Postgres, logger logger.Logger) *EmailVerificationRepo {
+	return &EmailVerificationRepo{Postgres: pg, logger: logger}
+}
+
+// Create stores a verification, replacing the earlier ones of the user so that only the latest link works.
+func (r *EmailVerificationRepo) Create(ctx context.Context, v entity.EmailVerification) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Create - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("EmailVerificationRepo - Create - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Delete("email_verifications").
+		Where("user_id = ?", v.UserID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Create - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("EmailVerificationRepo - Create - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Create - tx.Exec: failed to delete earlier verifications", "error", err)
+		return fmt.Errorf("EmailVerificationRepo - Create - tx.Exec: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Insert("email_verifications").
+		Columns("user_id", "email", "token_hash", "expires_at").
+		Values(v.UserID, v.Email, v.TokenHash, v.ExpiresAt).
+		ToSql()
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Create - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("EmailVerificationRepo - Create - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Create - tx.Exec: failed to create verification", "error", err)
+		return fmt.Errorf("EmailVerificationRepo - Create - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Create - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("EmailVerificationRepo - Create - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("EmailVerificationRepo - Create: email verification created", "userID", v.UserID)
+	return nil
+}
+
+// GetLatest returns the most recent verification of the user.
+func (r *EmailVerificationRepo) GetLatest(ctx context.Context, userID int) (entity.EmailVerification, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "email", "expires_at", "created_at").
+		From("email_verifications").
+		Where("user_id = ?", userID).
+		OrderBy("created_at DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - GetLatest - r.Builder: failed to build query", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - GetLatest - r.Builder: %w", err)
+	}
+
+	var v entity.EmailVerification
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&v.ID, &v.UserID, &v.Email, &v.ExpiresAt, &v.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.EmailVerification{}, apperrors.NewNoRowsAffectedError("email verification not found", fmt.Sprintf("EmailVerificationRepo - GetLatest - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("EmailVerificationRepo - GetLatest - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - GetLatest - r.Pool.QueryRow: %w", err)
+	}
+
+	return v, nil
+}
+
+// Consume uses up the unexpired verification with the token hash and marks the email of the user as
+// verified, as long as the credential still has the email the token was sent to.
+func (r *EmailVerificationRepo) Consume(ctx context.Context, tokenHash string, now time.Time) (entity.EmailVerification, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Consume - r.Pool.Begin: failed to begin transaction", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - Consume - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Delete("email_verifications").
+		Where("token_hash = ?", tokenHash).
+		Where("expires_at > ?", now).
+		Suffix("RETURNING id, user_id, email, expires_at, created_at").
+		ToSql()
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Consume - r.Builder: failed to build query", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - Consume - r.Builder: %w", err)
+	}
+
+	var v entity.EmailVerification
+	err = tx.QueryRow(ctx, sql, args...).Scan(&v.ID, &v.UserID, &v.Email, &v.ExpiresAt, &v.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.EmailVerification{}, apperrors.NewNoRowsAffectedError("email verification not found or expired", fmt.Sprintf("EmailVerificationRepo - Consume - tx.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("EmailVerificationRepo - Consume - tx.QueryRow: failed to execute query", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - Consume - tx.QueryRow: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Update("user_credentials").
+		Set("email_verified", true).
+		Where("user_id = ?", v.UserID).
+		Where("email = ?", v.Email).
+		ToSql()
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Consume - r.Builder: failed to build query", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - Consume - r.Builder: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Consume - tx.Exec: failed to mark email verified", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - Consume - tx.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return entity.EmailVerification{}, apperrors.NewNoRowsAffectedError("the email has changed since the verification was sent", "EmailVerificationRepo - Consume - tx.Exec")
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("EmailVerificationRepo - Consume - tx.Commit: failed to commit transaction", "error", err)
+		return entity.EmailVerification{}, fmt.Errorf("EmailVerificationRepo - Consume - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("EmailVerificationRepo - Consume: email verified", "userID", v.UserID)
+	return v, nil
+}
@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupEmailVerificationRepoTest(t *testing.T) (context.Context, pgxmock.PgxPoolIface, *EmailVerificationRepo) {
+	t.Helper()
+
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err, "Error should not have occurred when opening a stub database connection")
+
+	pg := &postgres.Postgres{Pool: mock, Builder: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+	repo := NewEmailVerificationRepo(pg, logger.New("debug"))
+
+	return ctx, mock, repo
+}
+
+func TestEmailVerificationRepo_Create(t *testing.T) {
+
+	t.Run("replaces the earlier verifications of the user", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupEmailVerificationRepoTest(t)
+		expiresAt := time.Now().Add(time.Hour)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM email_verifications WHERE user_id = \\$1").
+			WithArgs(7).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec("INSERT INTO email_verifications").
+			WithArgs(7, "hank@mail.com", "hash", expiresAt).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Create(ctx, entity.EmailVerification{UserID: 7, Email: "hank@mail.com", TokenHash: "hash", ExpiresAt: expiresAt})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestEmailVerificationRepo_Consume(t *testing.T) {
+
+	now := time.Now()
+
+	t.Run("marks the email verified", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupEmailVerificationRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM email_verifications WHERE token_hash = \\$1 AND expires_at > \\$2 RETURNING").
+			WithArgs("hash", now).
+			WillReturnRows(mock.NewRows([]string{"id", "user_id", "email", "expires_at", "created_at"}).
+				AddRow(1, 7, "hank@mail.com", now.Add(time.Hour), now))
+		mock.ExpectExec("UPDATE user_credentials SET email_verified = \\$1 WHERE user_id = \\$2 AND email = \\$3").
+			WithArgs(true, 7, "hank@mail.com").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		v, err := repo.Consume(ctx, "hash", now)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, v.UserID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("an unknown or expired token is not found", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupEmailVerificationRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM email_verifications").
+			WithArgs("hash", now).
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.Consume(ctx, "hash", now)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a token sent to a replaced email is not honoured", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupEmailVerificationRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM email_verifications").
+			WithArgs("hash", now).
+			WillReturnRows(mock.NewRows([]string{"id", "user_id", "email", "expires_at", "created_at"}).
+				AddRow(1, 7, "old@mail.com", now.Add(time.Hour), now))
+		mock.ExpectExec("UPDATE user_credentials").
+			WithArgs(true, 7, "old@mail.com").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.Consume(ctx, "hash", now)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	_loginFailuresPrefix = "login-attempts:failures:"
+	_loginBlockedPrefix  = "login-attempts:blocked:"
+)
+
+// RedisPool hands out redis connections, it is implemented by *redis.Pool.
+type RedisPool interface {
+	GetContext(ctx context.Context) (redis.Conn, error)
+}
+
+// LoginAttemptRepo keeps the failed login attempts in redis, so they are shared by every instance and
+// expire on their own.
+type LoginAttemptRepo struct {
+	pool   RedisPool
+	logger logger.Logger
+}
+
+func NewLoginAttemptRepo(pool RedisPool, logger logger.Logger) *LoginAttemptRepo {
+	return &LoginAttemptRepo{pool: pool, logger: logger}
+}
+
+func (r *LoginAttemptRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("LoginAttemptRepo - RecordFailure - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	// the counter and its expiry are set together, a counter must never outlive the window
+	conn.Send("MULTI")
+	conn.Send("INCR", _loginFailuresPrefix+key)
+	conn.Send("PEXPIRE", _loginFailuresPrefix+key, window.Milliseconds())
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		r.logger.Error("LoginAttemptRepo - RecordFailure - conn.Do : failed to count failed attempt", "key", key, "error", err)
+		return 0, fmt.Errorf("LoginAttemptRepo - RecordFailure - conn.Do: %w", err)
+	}
+
+	failures, err := redis.Int(replies[0], nil)
+	if err != nil {
+		return 0, fmt.Errorf("LoginAttemptRepo - RecordFailure - redis.Int: %w", err)
+	}
+	return failures, nil
+}
+
+func (r *LoginAttemptRepo) Block(ctx context.Context, key string, d time.Duration) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("LoginAttemptRepo - Block - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("SET", _loginBlockedPrefix+key, 1, "PX", d.Milliseconds())
+	if err != nil {
+		r.logger.Error("LoginAttemptRepo - Block - conn.Do : failed to block login attempts", "key", key, "error", err)
+		return fmt.Errorf("LoginAttemptRepo - Block - conn.Do: %w", err)
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepo) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("LoginAttemptRepo - BlockedFor - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	ttl, err := redis.Int64(conn.Do("PTTL", _loginBlockedPrefix+key))
+	if err != nil {
+		r.logger.Error("LoginAttemptRepo - BlockedFor - conn.Do : failed to read login block", "key", key, "error", err)
+		return 0, fmt.Errorf("LoginAttemptRepo - BlockedFor - conn.Do: %w", err)
+	}
+	// PTTL is negative for a missing key or one without expiry, blocks are always set with one
+	if ttl < 0 {
+		return 0, nil
+	}
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+func (r *LoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("LoginAttemptRepo - Reset - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", _loginFailuresPrefix+key, _loginBlockedPrefix+key)
+	if err != nil {
+		r.logger.Error("LoginAttemptRepo - Reset - conn.Do : failed to reset login attempts", "key", key, "error", err)
+		return fmt.Errorf("LoginAttemptRepo - Reset - conn.Do: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis understands the few commands the redis repos send, with expiries relative to now.
+type fakeRedis struct {
+	now     time.Time
+	values  map[string]int64
+	hashes  map[string]map[string]string
+	expires map[string]time.Time
+	queued  [][]interface{}
+	multi   bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{now: time.Now(), values: map[string]int64{}, hashes: map[string]map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (f *fakeRedis) GetContext(ctx context.Context) (redis.Conn, error) { return f, nil }
+func (f *fakeRedis) Close() error                                       { return nil }
+func (f *fakeRedis) Err() error                                         { return nil }
+func (f *fakeRedis) Flush() error                                       { return nil }
+func (f *fakeRedis) Receive() (interface{}, error)                      { return nil, fmt.Errorf("not supported") }
+
+func (f *fakeRedis) Send(cmd string, args ...interface{}) error {
+	if cmd == "MULTI" {
+		f.multi = true
+		return nil
+	}
+	f.queued = append(f.queued, append([]interface{}{cmd}, args...))
+	return nil
+}
+
+func (f *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "EXEC" && f.multi {
+		var replies []interface{}
+		for _, q := range f.queued {
+			reply, err := f.run(q[0].(string), q[1:]...)
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, reply)
+		}
+		f.queued, f.multi = nil, false
+		return replies, nil
+	}
+	return f.run(cmd, args...)
+}
+
+func (f *fakeRedis) run(cmd string, args ...interface{}) (interface{}, error) {
+	key := args[0].(string)
+	if exp, ok := f.expires[key]; ok && !f.now.Before(exp) {
+		delete(f.values, key)
+		delete(f.hashes, key)
+		delete(f.expires, key)
+	}
+
+	switch cmd {
+	case "INCR":
+		f.values[key]++
+		return f.values[key], nil
+	case "PEXPIRE":
+		f.expires[key] = f.now.Add(time.Duration(args[1].(int64)) * time.Millisecond)
+		return int64(1), nil
+	case "SET":
+		switch v := args[1].(type) {
+		case int:
+			f.values[key] = int64(v)
+		case int64:
+			f.values[key] = v
+		}
+		if len(args) > 3 {
+			f.expires[key] = f.now.Add(time.Duration(args[3].(int64)) * time.Millisecond)
+		}
+		return "OK", nil
+	case "GET":
+		if v, ok := f.values[key]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "PTTL":
+		if _, ok := f.values[key]; !ok {
+			return int64(-2), nil
+		}
+		return f.expires[key].Sub(f.now).Milliseconds(), nil
+	case "DEL":
+		for _, k := range args {
+			delete(f.values, k.(string))
+			delete(f.hashes, k.(string))
+			delete(f.expires, k.(string))
+		}
+		return int64(len(args)), nil
+	case "HSET":
+		if f.hashes[key] == nil {
+			f.hashes[key] = map[string]string{}
+		}
+		f.hashes[key][args[1].(string)] = args[2].(string)
+		return int64(1), nil
+	case "HGET":
+		if value, ok := f.hashes[key][args[1].(string)]; ok {
+			return []byte(value), nil
+		}
+		return nil, nil
+	case "HGETALL":
+		var reply []interface{}
+		for field, value := range f.hashes[key] {
+			reply = append(reply, []byte(field), []byte(value))
+		}
+		return reply, nil
+	case "HDEL":
+		var deleted int64
+		for _, field := range args[1:] {
+			if _, ok := f.hashes[key][field.(string)]; ok {
+				delete(f.hashes[key], field.(string))
+				deleted++
+			}
+		}
+		return deleted, nil
+	}
+	return nil, fmt.Errorf("unknown command %s", cmd)
+}
+
+func TestLoginAttemptRepo(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Run("counts failures within the window", func(t *testing.T) {
+		// Arrange
+		fake := newFakeRedis()
+		r := NewLoginAttemptRepo(fake, logger.New("debug"))
+
+		// Act
+		_, _ = r.RecordFailure(ctx, "user:hank", time.Minute)
+		failures, err := r.RecordFailure(ctx, "user:hank", time.Minute)
+		fake.now = fake.now.Add(2 * time.Minute)
+		afterWindow, _ := r.RecordFailure(ctx, "user:hank", time.Minute)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 2, failures)
+		assert.Equal(t, 1, afterWindow)
+	})
+
+	t.Run("reports how long a block lasts", func(t *testing.T) {
+		// Arrange
+		fake := newFakeRedis()
+		r := NewLoginAttemptRepo(fake, logger.New("debug"))
+
+		// Act
+		notBlocked, _ := r.BlockedFor(ctx, "ip:10.0.0.1")
+		err := r.Block(ctx, "ip:10.0.0.1", 30*time.Second)
+		blocked, _ := r.BlockedFor(ctx, "ip:10.0.0.1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Zero(t, notBlocked)
+		assert.Equal(t, 30*time.Second, blocked)
+	})
+
+	t.Run("reset forgets failures and blocks", func(t *testing.T) {
+		// Arrange
+		fake := newFakeRedis()
+		r := NewLoginAttemptRepo(fake, logger.New("debug"))
+		_, _ = r.RecordFailure(ctx, "user:hank", time.Minute)
+		_ = r.Block(ctx, "user:hank", time.Minute)
+
+		// Act
+		err := r.Reset(ctx, "user:hank")
+		blocked, _ := r.BlockedFor(ctx, "user:hank")
+		failures, _ := r.RecordFailure(ctx, "user:hank", time.Minute)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Zero(t, blocked)
+		assert.Equal(t, 1, failures)
+	})
+}
@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+)
+
+type PasswordResetRepo struct {
+	*postgres.Postgres
+	logger logger.Logger
+}
+
+func NewPasswordResetRepo(pg *postgres.Postgres, logger logger.Logger) *PasswordResetRepo {
+	return &PasswordResetRepo{Postgres: pg, logger: logger}
+}
+
+// Create stores a reset, replacing the earlier ones of the user so that only the latest link works.
+func (r *PasswordResetRepo) Create(ctx context.Context, pr entity.PasswordReset) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Create - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("PasswordResetRepo - Create - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Delete("password_resets").
+		Where("user_id = ?", pr.UserID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Create - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("PasswordResetRepo - Create - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Create - tx.Exec: failed to delete earlier resets", "error", err)
+		return fmt.Errorf("PasswordResetRepo - Create - tx.Exec: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Insert("password_resets").
+		Columns("user_id", "token_hash", "expires_at").
+		Values(pr.UserID, pr.TokenHash, pr.ExpiresAt).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Create - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("PasswordResetRepo - Create - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Create - tx.Exec: failed to create reset", "error", err)
+		return fmt.Errorf("PasswordResetRepo - Create - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Create - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("PasswordResetRepo - Create - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("PasswordResetRepo - Create: password reset created", "userID", pr.UserID)
+	return nil
+}
+
+// GetLatest returns the most recent reset of the user.
+func (r *PasswordResetRepo) GetLatest(ctx context.Context, userID int) (entity.PasswordReset, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "expires_at", "created_at").
+		From("password_resets").
+		Where("user_id = ?", userID).
+		OrderBy("created_at DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - GetLatest - r.Builder: failed to build query", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - GetLatest - r.Builder: %w", err)
+	}
+
+	var pr entity.PasswordReset
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&pr.ID, &pr.UserID, &pr.ExpiresAt, &pr.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("password reset not found", fmt.Sprintf("PasswordResetRepo - GetLatest - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("PasswordResetRepo - GetLatest - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - GetLatest - r.Pool.QueryRow: %w", err)
+	}
+
+	return pr, nil
+}
+
+// GetByTokenHash returns the unexpired reset with the token hash without using it up, so that a new
+// password breaking the policy can be refused while the link keeps working.
+func (r *PasswordResetRepo) GetByTokenHash(ctx context.Context, tokenHash string, now time.Time) (entity.PasswordReset, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "expires_at", "created_at").
+		From("password_resets").
+		Where("token_hash = ?", tokenHash).
+		Where("expires_at > ?", now).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - GetByTokenHash - r.Builder: failed to build query", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - GetByTokenHash - r.Builder: %w", err)
+	}
+
+	var pr entity.PasswordReset
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&pr.ID, &pr.UserID, &pr.ExpiresAt, &pr.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("password reset not found or expired", fmt.Sprintf("PasswordResetRepo - GetByTokenHash - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("PasswordResetRepo - GetByTokenHash - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - GetByTokenHash - r.Pool.QueryRow: %w", err)
+	}
+
+	return pr, nil
+}
+
+// Consume uses up the unexpired reset with the token hash and sets the password hash of its user, so that
+// a token changes the password at most once.
+func (r *PasswordResetRepo) Consume(ctx context.Context, tokenHash string, now time.Time, passwordHash string) (entity.PasswordReset, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Consume - r.Pool.Begin: failed to begin transaction", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - Consume - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Delete("password_resets").
+		Where("token_hash = ?", tokenHash).
+		Where("expires_at > ?", now).
+		Suffix("RETURNING id, user_id, expires_at, created_at").
+		ToSql()
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Consume - r.Builder: failed to build query", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - Consume - r.Builder: %w", err)
+	}
+
+	var pr entity.PasswordReset
+	err = tx.QueryRow(ctx, sql, args...).Scan(&pr.ID, &pr.UserID, &pr.ExpiresAt, &pr.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("password reset not found or expired", fmt.Sprintf("PasswordResetRepo - Consume - tx.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("PasswordResetRepo - Consume - tx.QueryRow: failed to execute query", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - Consume - tx.QueryRow: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Update("user_credentials").
+		Set("password_hash", passwordHash).
+		Where("user_id = ?", pr.UserID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Consume - r.Builder: failed to build query", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - Consume - r.Builder: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Consume - tx.Exec: failed to update password", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - Consume - tx.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("user credential not found", "PasswordResetRepo - Consume - tx.Exec")
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("PasswordResetRepo - Consume - tx.Commit: failed to commit transaction", "error", err)
+		return entity.PasswordReset{}, fmt.Errorf("PasswordResetRepo - Consume - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("PasswordResetRepo - Consume: password reset", "userID", pr.UserID)
+	return pr, nil
+}
@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPasswordResetRepoTest(t *testing.T) (context.Context, pgxmock.PgxPoolIface, *PasswordResetRepo) {
+	t.Helper()
+
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err, "Error should not have occurred when opening a stub database connection")
+
+	pg := &postgres.Postgres{Pool: mock, Builder: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+	repo := NewPasswordResetRepo(pg, logger.New("debug"))
+
+	return ctx, mock, repo
+}
+
+func TestPasswordResetRepo_Create(t *testing.T) {
+
+	t.Run("replaces the earlier resets of the user", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupPasswordResetRepoTest(t)
+		expiresAt := time.Now().Add(time.Hour)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM password_resets WHERE user_id = \\$1").
+			WithArgs(7).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec("INSERT INTO password_resets").
+			WithArgs(7, "hash", expiresAt).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Create(ctx, entity.PasswordReset{UserID: 7, TokenHash: "hash", ExpiresAt: expiresAt})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPasswordResetRepo_Consume(t *testing.T) {
+
+	now := time.Now()
+
+	t.Run("sets the password of the user", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupPasswordResetRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM password_resets WHERE token_hash = \\$1 AND expires_at > \\$2 RETURNING").
+			WithArgs("hash", now).
+			WillReturnRows(mock.NewRows([]string{"id", "user_id", "expires_at", "created_at"}).
+				AddRow(1, 7, now.Add(time.Hour), now))
+		mock.ExpectExec("UPDATE user_credentials SET password_hash = \\$1 WHERE user_id = \\$2").
+			WithArgs("new-hash", 7).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		pr, err := repo.Consume(ctx, "hash", now, "new-hash")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, pr.UserID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("an unknown, used or expired token is not found", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupPasswordResetRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM password_resets").
+			WithArgs("hash", now).
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.Consume(ctx, "hash", now, "new-hash")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+)
+
+type PersonalAccessTokenRepo struct {
+	*postgres.Postgres
+	logger logger.Logger
+}
+
+func NewPersonalAccessTokenRepo(pg *postgres.Postgres, logger logger.Logger) *PersonalAccessTokenRepo {
+	return &PersonalAccessTokenRepo{Postgres: pg, logger: logger}
+}
+
+func (r *PersonalAccessTokenRepo) Create(ctx context.Context, t entity.PersonalAccessToken) (entity.PersonalAccessToken, error) {
+	sql, args, err := r.Builder.
+		Insert("personal_access_tokens").
+		Columns("user_id", "name", "token_hash", "scopes", "expires_at").
+		Values(t.UserID, t.Name, t.TokenHash, t.Scopes, t.ExpiresAt).
+		Suffix("RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - Create - r.Builder: failed to build query", "error", err)
+		return entity.PersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenRepo - Create - r.Builder: %w", err)
+	}
+
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - Create - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.PersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenRepo - Create - r.Pool.QueryRow: %w", err)
+	}
+
+	r.logger.Info("PersonalAccessTokenRepo - Create: personal access token created", "userID", t.UserID, "tokenID", t.ID)
+	return t, nil
+}
+
+// ListByUser returns the tokens of the user, the newest first.
+func (r *PersonalAccessTokenRepo) ListByUser(ctx context.Context, userID int) ([]entity.PersonalAccessToken, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "name", "scopes", "expires_at", "last_used_at", "created_at").
+		From("personal_access_tokens").
+		Where("user_id = ?", userID).
+		OrderBy("created_at DESC", "id DESC").
+		ToSql()
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - ListByUser - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("PersonalAccessTokenRepo - ListByUser - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - ListByUser - r.Pool.Query: failed to execute query", "sql", sql, "error", err)
+		return nil, fmt.Errorf("PersonalAccessTokenRepo - ListByUser - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []entity.PersonalAccessToken{}
+	for rows.Next() {
+		var t entity.PersonalAccessToken
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+		if err != nil {
+			r.logger.Error("PersonalAccessTokenRepo - ListByUser - rows.Scan: failed to scan row", "error", err)
+			return nil, fmt.Errorf("PersonalAccessTokenRepo - ListByUser - rows.Scan: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("PersonalAccessTokenRepo - ListByUser - rows.Err: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (r *PersonalAccessTokenRepo) GetByTokenHash(ctx context.Context, tokenHash string) (entity.PersonalAccessToken, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "name", "token_hash", "scopes", "expires_at", "last_used_at", "created_at").
+		From("personal_access_tokens").
+		Where("token_hash = ?", tokenHash).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - GetByTokenHash - r.Builder: failed to build query", "error", err)
+		return entity.PersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenRepo - GetByTokenHash - r.Builder: %w", err)
+	}
+
+	var t entity.PersonalAccessToken
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&t.ID, &t.UserID, &t.Name, &t.TokenHash, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.PersonalAccessToken{}, apperrors.NewNoRowsAffectedError("personal access token not found", fmt.Sprintf("PersonalAccessTokenRepo - GetByTokenHash - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("PersonalAccessTokenRepo - GetByTokenHash - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.PersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenRepo - GetByTokenHash - r.Pool.QueryRow: %w", err)
+	}
+
+	return t, nil
+}
+
+func (r *PersonalAccessTokenRepo) MarkUsed(ctx context.Context, id int) error {
+	sql, args, err := r.Builder.
+		Update("personal_access_tokens").
+		Set("last_used_at", squirrel.Expr("NOW()")).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - MarkUsed - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("PersonalAccessTokenRepo - MarkUsed - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - MarkUsed - r.Pool.Exec: failed to execute query", "sql", sql, "error", err)
+		return fmt.Errorf("PersonalAccessTokenRepo - MarkUsed - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a token of the user, tokens of other users are reported as not found.
+func (r *PersonalAccessTokenRepo) Delete(ctx context.Context, id int, userID int) error {
+	sql, args, err := r.Builder.
+		Delete("personal_access_tokens").
+		Where("id = ?", id).
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - Delete - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("PersonalAccessTokenRepo - Delete - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("PersonalAccessTokenRepo - Delete - r.Pool.Exec: failed to execute query", "sql", sql, "error", err)
+		return fmt.Errorf("PersonalAccessTokenRepo - Delete - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("personal access token not found", "PersonalAccessTokenRepo - Delete - r.Pool.Exec")
+	}
+
+	r.logger.Info("PersonalAccessTokenRepo - Delete: personal access token deleted", "userID", userID, "tokenID", id)
+	return nil
+}
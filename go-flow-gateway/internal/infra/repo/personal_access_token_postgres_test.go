@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPersonalAccessTokenRepoTest(t *testing.T) (context.Context, pgxmock.PgxPoolIface, *PersonalAccessTokenRepo) {
+	t.Helper()
+
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err, "Error should not have occurred when opening a stub database connection")
+
+	pg := &postgres.Postgres{Pool: mock, Builder: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+	repo := NewPersonalAccessTokenRepo(pg, logger.New("debug"))
+
+	return ctx, mock, repo
+}
+
+func TestPersonalAccessTokenRepo_Create(t *testing.T) {
+
+	t.Run("returns the token with its id", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupPersonalAccessTokenRepoTest(t)
+		createdAt := time.Now()
+		token := entity.PersonalAccessToken{UserID: 7, Name: "backup script", TokenHash: "hash", Scopes: []string{entity.ScopeFilesRead}}
+
+		mock.ExpectQuery("INSERT INTO personal_access_tokens \\(user_id,name,token_hash,scopes,expires_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5\\) RETURNING id, created_at").
+			WithArgs(7, "backup script", "hash", []string{entity.ScopeFilesRead}, (*time.Time)(nil)).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(3, createdAt))
+
+		// Act
+		created, err := repo.Create(ctx, token)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 3, created.ID)
+		assert.Equal(t, createdAt, created.CreatedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPersonalAccessTokenRepo_GetByTokenHash(t *testing.T) {
+
+	t.Run("an unknown token is not found", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupPersonalAccessTokenRepoTest(t)
+
+		mock.ExpectQuery("SELECT .+ FROM personal_access_tokens WHERE token_hash = \\$1").
+			WithArgs("hash").
+			WillReturnError(pgx.ErrNoRows)
+
+		// Act
+		_, err := repo.GetByTokenHash(ctx, "hash")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPersonalAccessTokenRepo_Delete(t *testing.T) {
+
+	t.Run("a token of another user is not found", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupPersonalAccessTokenRepoTest(t)
+
+		mock.ExpectExec("DELETE FROM personal_access_tokens WHERE id = \\$1 AND user_id = \\$2").
+			WithArgs(3, 7).
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+		// Act
+		err := repo.Delete(ctx, 3, 7)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
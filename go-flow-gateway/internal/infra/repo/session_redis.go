@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	_sessionsPrefix         = "sessions:user:"
+	_sessionsLastSeenPrefix = "sessions:last-seen:"
+)
+
+// SessionRepo indexes in redis the sessions of each user, next to the sessions themselves. A session is
+// valid while it is in the index. When it was last seen is kept apart, so that recording it can never bring
+// back a session deleted in the meantime.
+type SessionRepo struct {
+	pool   RedisPool
+	logger logger.Logger
+}
+
+func NewSessionRepo(pool RedisPool, logger logger.Logger) *SessionRepo {
+	return &SessionRepo{pool: pool, logger: logger}
+}
+
+type storedSession struct {
+	UserAgent string `json:"userAgent"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type storedLastSeen struct {
+	IP string `json:"ip"`
+	At int64  `json:"at"`
+}
+
+// Create indexes the session, the index of the user expires ttl after its last write.
+func (r *SessionRepo) Create(ctx context.Context, userID int, s entity.UserSession, ttl time.Duration) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("SessionRepo - Create - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	session, _ := json.Marshal(storedSession{UserAgent: s.UserAgent, CreatedAt: s.CreatedAt.UnixMilli()})
+	lastSeen, _ := json.Marshal(storedLastSeen{IP: s.IP, At: s.LastSeenAt.UnixMilli()})
+	sessionsKey, lastSeenKey := sessionKeys(userID)
+
+	conn.Send("MULTI")
+	conn.Send("HSET", sessionsKey, s.ID, string(session))
+	conn.Send("HSET", lastSeenKey, s.ID, string(lastSeen))
+	conn.Send("PEXPIRE", sessionsKey, ttl.Milliseconds())
+	conn.Send("PEXPIRE", lastSeenKey, ttl.Milliseconds())
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		r.logger.Error("SessionRepo - Create - conn.Do : failed to index session", "userID", userID, "error", err)
+		return fmt.Errorf("SessionRepo - Create - conn.Do: %w", err)
+	}
+	return nil
+}
+
+// Touch records that the session was seen from the ip and returns when it was created, and whether it is
+// still indexed.
+func (r *SessionRepo) Touch(ctx context.Context, userID int, sessionID string, ip string, seenAt time.Time, ttl time.Duration) (time.Time, bool, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("SessionRepo - Touch - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	lastSeen, _ := json.Marshal(storedLastSeen{IP: ip, At: seenAt.UnixMilli()})
+	sessionsKey, lastSeenKey := sessionKeys(userID)
+
+	conn.Send("MULTI")
+	conn.Send("HGET", sessionsKey, sessionID)
+	conn.Send("HSET", lastSeenKey, sessionID, string(lastSeen))
+	conn.Send("PEXPIRE", sessionsKey, ttl.Milliseconds())
+	conn.Send("PEXPIRE", lastSeenKey, ttl.Milliseconds())
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		r.logger.Error("SessionRepo - Touch - conn.Do : failed to record session use", "userID", userID, "error", err)
+		return time.Time{}, false, fmt.Errorf("SessionRepo - Touch - conn.Do: %w", err)
+	}
+	if replies[0] == nil {
+		return time.Time{}, false, nil
+	}
+
+	value, err := redis.Bytes(replies[0], nil)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("SessionRepo - Touch - redis.Bytes: %w", err)
+	}
+	var session storedSession
+	err = json.Unmarshal(value, &session)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("SessionRepo - Touch - json.Unmarshal: %w", err)
+	}
+	return time.UnixMilli(session.CreatedAt), true, nil
+}
+
+// List returns the indexed sessions of the user, the most recently seen first.
+func (r *SessionRepo) List(ctx context.Context, userID int) ([]entity.UserSession, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("SessionRepo - List - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	sessionsKey, lastSeenKey := sessionKeys(userID)
+	stored, err := redis.StringMap(conn.Do("HGETALL", sessionsKey))
+	if err != nil {
+		r.logger.Error("SessionRepo - List - conn.Do : failed to list sessions", "userID", userID, "error", err)
+		return nil, fmt.Errorf("SessionRepo - List - conn.Do: %w", err)
+	}
+	seen, err := redis.StringMap(conn.Do("HGETALL", lastSeenKey))
+	if err != nil {
+		r.logger.Error("SessionRepo - List - conn.Do : failed to list session uses", "userID", userID, "error", err)
+		return nil, fmt.Errorf("SessionRepo - List - conn.Do: %w", err)
+	}
+
+	sessions := make([]entity.UserSession, 0, len(stored))
+	for id, value := range stored {
+		var s storedSession
+		err = json.Unmarshal([]byte(value), &s)
+		if err != nil {
+			return nil, fmt.Errorf("SessionRepo - List - json.Unmarshal: %w", err)
+		}
+		session := entity.UserSession{
+			ID:         id,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  time.UnixMilli(s.CreatedAt),
+			LastSeenAt: time.UnixMilli(s.CreatedAt),
+		}
+
+		var l storedLastSeen
+		if json.Unmarshal([]byte(seen[id]), &l) == nil {
+			session.IP = l.IP
+			session.LastSeenAt = time.UnixMilli(l.At)
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// Delete removes the sessions from the index and returns how many of them were in it.
+func (r *SessionRepo) Delete(ctx context.Context, userID int, sessionIDs ...string) (int, error) {
+	if len(sessionIDs) == 0 {
+		return 0, nil
+	}
+
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("SessionRepo - Delete - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	sessionsKey, lastSeenKey := sessionKeys(userID)
+	conn.Send("MULTI")
+	conn.Send("HDEL", redis.Args{}.Add(sessionsKey).AddFlat(sessionIDs)...)
+	conn.Send("HDEL", redis.Args{}.Add(lastSeenKey).AddFlat(sessionIDs)...)
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		r.logger.Error("SessionRepo - Delete - conn.Do : failed to delete sessions", "userID", userID, "error", err)
+		return 0, fmt.Errorf("SessionRepo - Delete - conn.Do: %w", err)
+	}
+
+	deleted, err := redis.Int(replies[0], nil)
+	if err != nil {
+		return 0, fmt.Errorf("SessionRepo - Delete - redis.Int: %w", err)
+	}
+	return deleted, nil
+}
+
+func (r *SessionRepo) DeleteAll(ctx context.Context, userID int) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("SessionRepo - DeleteAll - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	sessionsKey, lastSeenKey := sessionKeys(userID)
+	_, err = conn.Do("DEL", sessionsKey, lastSeenKey)
+	if err != nil {
+		r.logger.Error("SessionRepo - DeleteAll - conn.Do : failed to delete sessions", "userID", userID, "error", err)
+		return fmt.Errorf("SessionRepo - DeleteAll - conn.Do: %w", err)
+	}
+	return nil
+}
+
+func sessionKeys(userID int) (string, string) {
+	id := strconv.Itoa(userID)
+	return _sessionsPrefix + id, _sessionsLastSeenPrefix + id
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRepo(t *testing.T) {
+
+	ctx := context.Background()
+	created := time.UnixMilli(time.Now().Add(-time.Hour).UnixMilli())
+
+	newSession := func(id string) entity.UserSession {
+		return entity.UserSession{ID: id, UserAgent: "curl/8.0", IP: "10.0.0.1", CreatedAt: created, LastSeenAt: created}
+	}
+
+	t.Run("lists the sessions of the user, most recently seen first", func(t *testing.T) {
+		// Arrange
+		r := NewSessionRepo(newFakeRedis(), logger.New("debug"))
+		_ = r.Create(ctx, 7, newSession("a"), time.Hour)
+		_ = r.Create(ctx, 7, newSession("b"), time.Hour)
+		_ = r.Create(ctx, 8, newSession("c"), time.Hour)
+		seen := created.Add(time.Minute)
+
+		// Act
+		createdAt, valid, err := r.Touch(ctx, 7, "b", "10.0.0.2", seen, time.Hour)
+		sessions, _ := r.List(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, created.Equal(createdAt))
+		if assert.Len(t, sessions, 2) {
+			assert.Equal(t, "b", sessions[0].ID)
+			assert.Equal(t, "10.0.0.2", sessions[0].IP)
+			assert.True(t, seen.Equal(sessions[0].LastSeenAt))
+			assert.True(t, created.Equal(sessions[0].CreatedAt))
+			assert.Equal(t, "curl/8.0", sessions[0].UserAgent)
+			assert.Equal(t, "a", sessions[1].ID)
+		}
+	})
+
+	t.Run("a deleted session is no longer valid", func(t *testing.T) {
+		// Arrange
+		r := NewSessionRepo(newFakeRedis(), logger.New("debug"))
+		_ = r.Create(ctx, 7, newSession("a"), time.Hour)
+		_ = r.Create(ctx, 7, newSession("b"), time.Hour)
+
+		// Act
+		deleted, err := r.Delete(ctx, 7, "a", "missing")
+		_, valid, _ := r.Touch(ctx, 7, "a", "10.0.0.1", time.Now(), time.Hour)
+		sessions, _ := r.List(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		assert.False(t, valid)
+		if assert.Len(t, sessions, 1) {
+			assert.Equal(t, "b", sessions[0].ID)
+		}
+	})
+
+	t.Run("delete all empties the index of the user", func(t *testing.T) {
+		// Arrange
+		r := NewSessionRepo(newFakeRedis(), logger.New("debug"))
+		_ = r.Create(ctx, 7, newSession("a"), time.Hour)
+
+		// Act
+		err := r.DeleteAll(ctx, 7)
+		_, valid, _ := r.Touch(ctx, 7, "a", "10.0.0.1", time.Now(), time.Hour)
+		sessions, _ := r.List(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("the index expires when unused", func(t *testing.T) {
+		// Arrange
+		fake := newFakeRedis()
+		r := NewSessionRepo(fake, logger.New("debug"))
+		_ = r.Create(ctx, 7, newSession("a"), time.Hour)
+
+		// Act
+		fake.now = fake.now.Add(2 * time.Hour)
+		_, valid, err := r.Touch(ctx, 7, "a", "10.0.0.1", time.Now(), time.Hour)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+}
@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	_twoFactorChallengePrefix         = "two-factor:challenges:"
+	_twoFactorChallengeFailuresPrefix = "two-factor:challenge-failures:"
+)
+
+// TwoFactorChallengeRepo keeps in redis the logins waiting for their second factor, they expire on their
+// own when it is not given in time.
+type TwoFactorChallengeRepo struct {
+	pool   RedisPool
+	logger logger.Logger
+}
+
+func NewTwoFactorChallengeRepo(pool RedisPool, logger logger.Logger) *TwoFactorChallengeRepo {
+	return &TwoFactorChallengeRepo{pool: pool, logger: logger}
+}
+
+func (r *TwoFactorChallengeRepo) Create(ctx context.Context, id string, userID int, ttl time.Duration) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("TwoFactorChallengeRepo - Create - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("SET", _twoFactorChallengePrefix+id, userID, "PX", ttl.Milliseconds())
+	if err != nil {
+		r.logger.Error("TwoFactorChallengeRepo - Create - conn.Do : failed to create challenge", "userID", userID, "error", err)
+		return fmt.Errorf("TwoFactorChallengeRepo - Create - conn.Do: %w", err)
+	}
+	return nil
+}
+
+// Get returns the user logging in with the challenge, a missing or expired challenge is not found.
+func (r *TwoFactorChallengeRepo) Get(ctx context.Context, id string) (int, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorChallengeRepo - Get - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	userID, err := redis.Int(conn.Do("GET", _twoFactorChallengePrefix+id))
+	if errors.Is(err, redis.ErrNil) {
+		return 0, apperrors.NewNoRowsAffectedError("two-factor challenge not found or expired", "TwoFactorChallengeRepo - Get - conn.Do")
+	}
+	if err != nil {
+		r.logger.Error("TwoFactorChallengeRepo - Get - conn.Do : failed to read challenge", "error", err)
+		return 0, fmt.Errorf("TwoFactorChallengeRepo - Get - conn.Do: %w", err)
+	}
+	return userID, nil
+}
+
+// RecordFailure counts a wrong code given for the challenge and returns the failures counted so far.
+func (r *TwoFactorChallengeRepo) RecordFailure(ctx context.Context, id string, ttl time.Duration) (int, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorChallengeRepo - RecordFailure - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("INCR", _twoFactorChallengeFailuresPrefix+id)
+	conn.Send("PEXPIRE", _twoFactorChallengeFailuresPrefix+id, ttl.Milliseconds())
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		r.logger.Error("TwoFactorChallengeRepo - RecordFailure - conn.Do : failed to count failed code", "error", err)
+		return 0, fmt.Errorf("TwoFactorChallengeRepo - RecordFailure - conn.Do: %w", err)
+	}
+
+	failures, err := redis.Int(replies[0], nil)
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorChallengeRepo - RecordFailure - redis.Int: %w", err)
+	}
+	return failures, nil
+}
+
+func (r *TwoFactorChallengeRepo) Delete(ctx context.Context, id string) error {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return fmt.Errorf("TwoFactorChallengeRepo - Delete - r.pool.GetContext: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", _twoFactorChallengePrefix+id, _twoFactorChallengeFailuresPrefix+id)
+	if err != nil {
+		r.logger.Error("TwoFactorChallengeRepo - Delete - conn.Do : failed to delete challenge", "error", err)
+		return fmt.Errorf("TwoFactorChallengeRepo - Delete - conn.Do: %w", err)
+	}
+	return nil
+}
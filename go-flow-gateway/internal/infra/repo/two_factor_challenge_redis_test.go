@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwoFactorChallengeRepo(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Run("returns the user of the challenge until it expires", func(t *testing.T) {
+		// Arrange
+		fake := newFakeRedis()
+		r := NewTwoFactorChallengeRepo(fake, logger.New("debug"))
+
+		// Act
+		err := r.Create(ctx, "abc", 7, 5*time.Minute)
+		userID, getErr := r.Get(ctx, "abc")
+		fake.now = fake.now.Add(6 * time.Minute)
+		_, expiredErr := r.Get(ctx, "abc")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NoError(t, getErr)
+		assert.Equal(t, 7, userID)
+		assert.True(t, apperrors.IsNoRowsAffectedError(expiredErr))
+	})
+
+	t.Run("delete forgets the challenge and its failures", func(t *testing.T) {
+		// Arrange
+		fake := newFakeRedis()
+		r := NewTwoFactorChallengeRepo(fake, logger.New("debug"))
+		_ = r.Create(ctx, "abc", 7, 5*time.Minute)
+		_, _ = r.RecordFailure(ctx, "abc", 5*time.Minute)
+		failures, _ := r.RecordFailure(ctx, "abc", 5*time.Minute)
+
+		// Act
+		err := r.Delete(ctx, "abc")
+		_, getErr := r.Get(ctx, "abc")
+		afterDelete, _ := r.RecordFailure(ctx, "abc", 5*time.Minute)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 2, failures)
+		assert.True(t, apperrors.IsNoRowsAffectedError(getErr))
+		assert.Equal(t, 1, afterDelete)
+	})
+}
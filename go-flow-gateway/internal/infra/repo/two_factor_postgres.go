@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
+)
+
+// TwoFactorRepo keeps the TOTP factors of the users and their recovery codes.
+type TwoFactorRepo struct {
+	*postgres.Postgres
+	logger logger.Logger
+}
+
+func NewTwoFactorRepo(pg *postgres.Postgres, logger logger.Logger) *TwoFactorRepo {
+	return &TwoFactorRepo{Postgres: pg, logger: logger}
+}
+
+// SavePending stores a factor waiting for its first code, replacing a pending one of the user. A confirmed
+// factor is left alone and reported as not found.
+func (r *TwoFactorRepo) SavePending(ctx context.Context, f entity.TOTPFactor) error {
+	sql, args, err := r.Builder.
+		Insert("totp_factors").
+		Columns("user_id", "secret").
+		Values(f.UserID, f.Secret).
+		Suffix("ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW() WHERE totp_factors.confirmed_at IS NULL").
+		ToSql()
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - SavePending - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("TwoFactorRepo - SavePending - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - SavePending - r.Pool.Exec: failed to execute query", "sql", sql, "error", err)
+		return fmt.Errorf("TwoFactorRepo - SavePending - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("no pending totp factor to replace", "TwoFactorRepo - SavePending - r.Pool.Exec")
+	}
+
+	r.logger.Info("TwoFactorRepo - SavePending: pending totp factor saved", "userID", f.UserID)
+	return nil
+}
+
+func (r *TwoFactorRepo) GetFactor(ctx context.Context, userID int) (entity.TOTPFactor, error) {
+	sql, args, err := r.Builder.
+		Select("user_id", "secret", "confirmed_at", "last_used_step", "created_at").
+		From("totp_factors").
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - GetFactor - r.Builder: failed to build query", "error", err)
+		return entity.TOTPFactor{}, fmt.Errorf("TwoFactorRepo - GetFactor - r.Builder: %w", err)
+	}
+
+	var f entity.TOTPFactor
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&f.UserID, &f.Secret, &f.ConfirmedAt, &f.LastUsedStep, &f.CreatedAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.TOTPFactor{}, apperrors.NewNoRowsAffectedError("totp factor not found", fmt.Sprintf("TwoFactorRepo - GetFactor - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("TwoFactorRepo - GetFactor - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.TOTPFactor{}, fmt.Errorf("TwoFactorRepo - GetFactor - r.Pool.QueryRow: %w", err)
+	}
+
+	return f, nil
+}
+
+// Confirm enables the pending factor of the user with the step of its first code and replaces the
+// recovery codes of the user.
+func (r *TwoFactorRepo) Confirm(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Confirm - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Confirm - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Update("totp_factors").
+		Set("confirmed_at", squirrel.Expr("NOW()")).
+		Set("last_used_step", step).
+		Where("user_id = ?", userID).
+		Where("confirmed_at IS NULL").
+		ToSql()
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Confirm - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Confirm - r.Builder: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Confirm - tx.Exec: failed to confirm totp factor", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Confirm - tx.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("no pending totp factor to confirm", "TwoFactorRepo - Confirm - tx.Exec")
+	}
+
+	err = r.replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	if err != nil {
+		return fmt.Errorf("TwoFactorRepo - Confirm - r.replaceRecoveryCodes: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Confirm - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Confirm - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("TwoFactorRepo - Confirm: totp factor confirmed", "userID", userID)
+	return nil
+}
+
+func (r *TwoFactorRepo) replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	sql, args, err := r.Builder.
+		Delete("recovery_codes").
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("TwoFactorRepo - replaceRecoveryCodes - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - replaceRecoveryCodes - tx.Exec: failed to delete recovery codes", "error", err)
+		return fmt.Errorf("TwoFactorRepo - replaceRecoveryCodes - tx.Exec: %w", err)
+	}
+
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	insert := r.Builder.
+		Insert("recovery_codes").
+		Columns("user_id", "code_hash")
+	for _, h := range codeHashes {
+		insert = insert.Values(userID, h)
+	}
+	sql, args, err = insert.ToSql()
+	if err != nil {
+		return fmt.Errorf("TwoFactorRepo - replaceRecoveryCodes - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - replaceRecoveryCodes - tx.Exec: failed to insert recovery codes", "error", err)
+		return fmt.Errorf("TwoFactorRepo - replaceRecoveryCodes - tx.Exec: %w", err)
+	}
+	return nil
+}
+
+// UseStep records that the code of a time step was accepted for the user. Steps not after the last used
+// one are reported as not found, so that a code cannot be replayed.
+func (r *TwoFactorRepo) UseStep(ctx context.Context, userID int, step int64) error {
+	sql, args, err := r.Builder.
+		Update("totp_factors").
+		Set("last_used_step", step).
+		Where("user_id = ?", userID).
+		Where("last_used_step < ?", step).
+		ToSql()
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - UseStep - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("TwoFactorRepo - UseStep - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - UseStep - r.Pool.Exec: failed to execute query", "sql", sql, "error", err)
+		return fmt.Errorf("TwoFactorRepo - UseStep - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("totp code already used", "TwoFactorRepo - UseStep - r.Pool.Exec")
+	}
+	return nil
+}
+
+// UseRecoveryCode uses up an unused recovery code of the user.
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	sql, args, err := r.Builder.
+		Update("recovery_codes").
+		Set("used_at", squirrel.Expr("NOW()")).
+		Where("user_id = ?", userID).
+		Where("code_hash = ?", codeHash).
+		Where("used_at IS NULL").
+		ToSql()
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - UseRecoveryCode - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("TwoFactorRepo - UseRecoveryCode - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - UseRecoveryCode - r.Pool.Exec: failed to execute query", "sql", sql, "error", err)
+		return fmt.Errorf("TwoFactorRepo - UseRecoveryCode - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("recovery code not found or used", "TwoFactorRepo - UseRecoveryCode - r.Pool.Exec")
+	}
+
+	r.logger.Info("TwoFactorRepo - UseRecoveryCode: recovery code used", "userID", userID)
+	return nil
+}
+
+// Delete removes the factor of the user and their recovery codes.
+func (r *TwoFactorRepo) Delete(ctx context.Context, userID int) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Delete - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Delete - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = r.replaceRecoveryCodes(ctx, tx, userID, nil)
+	if err != nil {
+		return fmt.Errorf("TwoFactorRepo - Delete - r.replaceRecoveryCodes: %w", err)
+	}
+
+	sql, args, err := r.Builder.
+		Delete("totp_factors").
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Delete - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Delete - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Delete - tx.Exec: failed to delete totp factor", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Delete - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("TwoFactorRepo - Delete - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("TwoFactorRepo - Delete - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("TwoFactorRepo - Delete: totp factor deleted", "userID", userID)
+	return nil
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTwoFactorRepoTest(t *testing.T) (context.Context, pgxmock.PgxPoolIface, *TwoFactorRepo) {
+	t.Helper()
+
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err, "Error should not have occurred when opening a stub database connection")
+
+	pg := &postgres.Postgres{Pool: mock, Builder: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+	repo := NewTwoFactorRepo(pg, logger.New("debug"))
+
+	return ctx, mock, repo
+}
+
+func TestTwoFactorRepo_SavePending(t *testing.T) {
+
+	t.Run("a confirmed factor is not replaced", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupTwoFactorRepoTest(t)
+
+		mock.ExpectExec("INSERT INTO totp_factors .+ ON CONFLICT \\(user_id\\) DO UPDATE .+ WHERE totp_factors.confirmed_at IS NULL").
+			WithArgs(7, "SECRET").
+			WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+		// Act
+		err := repo.SavePending(ctx, entity.TOTPFactor{UserID: 7, Secret: "SECRET"})
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTwoFactorRepo_Confirm(t *testing.T) {
+
+	t.Run("enables the factor and replaces the recovery codes", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupTwoFactorRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE totp_factors SET confirmed_at = NOW\\(\\), last_used_step = \\$1 WHERE user_id = \\$2 AND confirmed_at IS NULL").
+			WithArgs(int64(100), 7).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("DELETE FROM recovery_codes WHERE user_id = \\$1").
+			WithArgs(7).
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("INSERT INTO recovery_codes \\(user_id,code_hash\\) VALUES \\(\\$1,\\$2\\),\\(\\$3,\\$4\\)").
+			WithArgs(7, "h1", 7, "h2").
+			WillReturnResult(pgxmock.NewResult("INSERT", 2))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Confirm(ctx, 7, 100, []string{"h1", "h2"})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTwoFactorRepo_UseStep(t *testing.T) {
+
+	t.Run("a step already used is refused", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupTwoFactorRepoTest(t)
+
+		mock.ExpectExec("UPDATE totp_factors SET last_used_step = \\$1 WHERE user_id = \\$2 AND last_used_step < \\$3").
+			WithArgs(int64(100), 7, int64(100)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		// Act
+		err := repo.UseStep(ctx, 7, 100)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTwoFactorRepo_UseRecoveryCode(t *testing.T) {
+
+	t.Run("uses up an unused code", func(t *testing.T) {
+		// Arrange
+		ctx, mock, repo := setupTwoFactorRepoTest(t)
+
+		mock.ExpectExec("UPDATE recovery_codes SET used_at = NOW\\(\\) WHERE user_id = \\$1 AND code_hash = \\$2 AND used_at IS NULL").
+			WithArgs(7, "h1").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.UseRecoveryCode(ctx, 7, "h1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,400 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
+)
+
+type UploadSessionRepo struct {
+	*postgres.Postgres
+	files  *UserUploadedFileRepo
+	logger logger.Logger
+}
+
+func NewUploadSessionRepo(pg *postgres.Postgres, l logger.Logger) *UploadSessionRepo {
+	return &UploadSessionRepo{Postgres: pg, files: NewUserUploadedFileRepo(pg, l), logger: l}
+}
+
+// Create stores the session. When admit is given, the user is locked like for a file upload and admit
+// decides on the usage read under the lock whether the session may be opened.
+func (r *UploadSessionRepo) Create(ctx context.Context, s entity.UploadSession, admit func(usage entity.StorageUsage) error) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Create - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Create - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if admit != nil {
+		usage, err := r.files.lockUsage(ctx, tx, s.UserID)
+		if err != nil {
+			return fmt.Errorf("UploadSessionRepo - Create - r.files.lockUsage: %w", err)
+		}
+		err = admit(usage)
+		if err != nil {
+			return fmt.Errorf("UploadSessionRepo - Create - admit: %w", err)
+		}
+	}
+
+	sql, args, err := r.Builder.
+		Insert("upload_sessions").
+		Columns("id", "user_id", "name", "size", "email_recipient", "expires_at").
+		Values(s.ID, s.UserID, s.Name, s.Size, s.EmailRecipient, s.ExpiresAt).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Create - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Create - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Create - tx.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Create - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Create - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Create - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UploadSessionRepo - Create: successfully created upload session", "uploadSessionID", s.ID)
+	return nil
+}
+
+// GetByID returns an upload session of the user that has not expired yet.
+func (r *UploadSessionRepo) GetByID(ctx context.Context, ID string, userID int) (entity.UploadSession, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "name", "size", "upload_offset", "email_recipient", "created_at", "expires_at", "status").
+		From("upload_sessions").
+		Where("id = ?", ID).
+		Where("user_id = ?", userID).
+		Where("expires_at > NOW()").
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - GetByID - r.Builder: failed to build query", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionRepo - GetByID - r.Builder: %w", err)
+	}
+
+	var s entity.UploadSession
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&s.ID, &s.UserID, &s.Name, &s.Size, &s.Offset, &s.EmailRecipient, &s.CreatedAt, &s.ExpiresAt, &s.Status)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.UploadSession{}, apperrors.NewNoRowsAffectedError("upload session not found", fmt.Sprintf("UploadSessionRepo - GetByID - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UploadSessionRepo - GetByID - r.Pool.QueryRow: failed to execute query", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionRepo - GetByID - r.Pool.QueryRow: %w", err)
+	}
+
+	return s, nil
+}
+
+// AppendChunk stores the chunk as a blob and advances the session offset. The offset only moves when
+// it still equals the expected offset, so concurrent requests cannot write the same range twice.
+func (r *UploadSessionRepo) AppendChunk(ctx context.Context, ID string, userID int, offset int64, chunk []byte, checksum string, expiresAt time.Time) (int64, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - r.Pool.Begin: failed to begin transaction", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Update("upload_sessions").
+		Set("upload_offset", squirrel.Expr("upload_offset + ?", len(chunk))).
+		Set("expires_at", expiresAt).
+		Where("id = ?", ID).
+		Where("user_id = ?", userID).
+		Where("upload_offset = ?", offset).
+		Where("expires_at > NOW()").
+		Suffix("RETURNING upload_offset").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - r.Builder: %w", err)
+	}
+
+	var newOffset int64
+	err = tx.QueryRow(ctx, sql, args...).Scan(&newOffset)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return 0, apperrors.NewNoRowsAffectedError("upload session not found at offset", fmt.Sprintf("UploadSessionRepo - AppendChunk - tx.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UploadSessionRepo - AppendChunk - tx.QueryRow: failed to execute query", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - tx.QueryRow: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Insert("file_blobs").
+		Columns("user_id", "checksum", "size", "content").
+		Values(userID, checksum, len(chunk), chunk).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - r.Builder: %w", err)
+	}
+
+	var blobID int
+	err = tx.QueryRow(ctx, sql, args...).Scan(&blobID)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - tx.QueryRow: failed to store chunk", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - tx.QueryRow: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Insert("upload_session_chunks").
+		Columns("session_id", "chunk_offset", "blob_id").
+		Values(ID, offset, blobID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - tx.Exec: failed to link chunk", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - AppendChunk - tx.Commit: failed to commit transaction", "error", err)
+		return 0, fmt.Errorf("UploadSessionRepo - AppendChunk - tx.Commit: %w", err)
+	}
+
+	r.logger.Debug("UploadSessionRepo - AppendChunk: successfully stored chunk", "uploadSessionID", ID, "offset", newOffset)
+	return newOffset, nil
+}
+
+// Claim marks an open session of the user as being finalised, so only one request turns it into a file.
+// A session that is unknown, expired or already claimed is not found.
+func (r *UploadSessionRepo) Claim(ctx context.Context, ID string, userID int) error {
+	sql, args, err := r.Builder.
+		Update("upload_sessions").
+		Set("status", entity.UploadSessionStatusFinalizing).
+		Where("id = ?", ID).
+		Where("user_id = ?", userID).
+		Where("status = ?", entity.UploadSessionStatusOpen).
+		Where("expires_at > NOW()").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Claim - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Claim - r.Builder: %w", err)
+	}
+
+	result, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Claim - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Claim - r.Pool.Exec: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("upload session not found or already being finalised", "UploadSessionRepo - Claim")
+	}
+	return nil
+}
+
+// Release reopens a claimed session after its file could not be created.
+func (r *UploadSessionRepo) Release(ctx context.Context, ID string) error {
+	sql, args, err := r.Builder.
+		Update("upload_sessions").
+		Set("status", entity.UploadSessionStatusOpen).
+		Where("id = ?", ID).
+		Where("status = ?", entity.UploadSessionStatusFinalizing).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Release - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Release - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - Release - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - Release - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+// GetContent reassembles the content of a session from its chunks.
+func (r *UploadSessionRepo) GetContent(ctx context.Context, ID string) ([]byte, error) {
+	sql, args, err := r.Builder.
+		Select("b.content").
+		From("upload_session_chunks c").
+		Join("file_blobs b ON b.id = c.blob_id").
+		Where("c.session_id = ?", ID).
+		OrderBy("c.chunk_offset ASC").
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - GetContent - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UploadSessionRepo - GetContent - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - GetContent - r.Pool.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UploadSessionRepo - GetContent - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var content []byte
+	for rows.Next() {
+		var chunk []byte
+		err := rows.Scan(&chunk)
+		if err != nil {
+			r.logger.Error("UploadSessionRepo - GetContent - rows.Scan: failed to scan chunk", "error", err)
+			return nil, fmt.Errorf("UploadSessionRepo - GetContent - rows.Scan: %w", err)
+		}
+		content = append(content, chunk...)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UploadSessionRepo - GetContent - rows.Err: failed to read chunks", "error", err)
+		return nil, fmt.Errorf("UploadSessionRepo - GetContent - rows.Err: %w", err)
+	}
+
+	return content, nil
+}
+
+// Delete removes a session and releases the blobs of its chunks.
+func (r *UploadSessionRepo) Delete(ctx context.Context, ID string) error {
+	err := r.delete(ctx, squirrel.Eq{"id": ID})
+	if err != nil {
+		return fmt.Errorf("UploadSessionRepo - Delete - r.delete: %w", err)
+	}
+
+	r.logger.Info("UploadSessionRepo - Delete: successfully deleted upload session", "uploadSessionID", ID)
+	return nil
+}
+
+// DeleteExpired removes every session that expired before the given time and releases the blobs of their chunks.
+func (r *UploadSessionRepo) DeleteExpired(ctx context.Context, before time.Time) error {
+	err := r.delete(ctx, squirrel.LtOrEq{"expires_at": before})
+	if err != nil {
+		return fmt.Errorf("UploadSessionRepo - DeleteExpired - r.delete: %w", err)
+	}
+
+	r.logger.Info("UploadSessionRepo - DeleteExpired: successfully deleted expired upload sessions", "before", before)
+	return nil
+}
+
+// delete removes the sessions matching the predicate together with their chunks. Chunk blobs are
+// released like file blobs, because a deduplicated upload may reference a blob that started as a chunk.
+func (r *UploadSessionRepo) delete(ctx context.Context, pred squirrel.Sqlizer) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - delete - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("UploadSessionRepo - delete - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Delete("upload_session_chunks").
+		Where(squirrel.Expr("session_id IN (?)", squirrel.Select("id").From("upload_sessions").Where(pred))).
+		Suffix("RETURNING blob_id").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - delete - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - delete - r.Builder: %w", err)
+	}
+
+	blobIDs, err := r.collectIDs(ctx, tx, sql, args)
+	if err != nil {
+		return fmt.Errorf("UploadSessionRepo - delete - r.collectIDs: %w", err)
+	}
+
+	if len(blobIDs) > 0 {
+		err = r.releaseBlobs(ctx, tx, blobIDs)
+		if err != nil {
+			return fmt.Errorf("UploadSessionRepo - delete - r.releaseBlobs: %w", err)
+		}
+	}
+
+	sql, args, err = r.Builder.
+		Delete("upload_sessions").
+		Where(pred).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - delete - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - delete - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - delete - tx.Exec: failed to delete upload sessions", "error", err)
+		return fmt.Errorf("UploadSessionRepo - delete - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - delete - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("UploadSessionRepo - delete - tx.Commit: %w", err)
+	}
+	return nil
+}
+
+func (r *UploadSessionRepo) collectIDs(ctx context.Context, tx pgx.Tx, sql string, args []interface{}) ([]int, error) {
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - collectIDs - tx.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UploadSessionRepo - collectIDs - tx.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			r.logger.Error("UploadSessionRepo - collectIDs - rows.Scan: failed to scan id", "error", err)
+			return nil, fmt.Errorf("UploadSessionRepo - collectIDs - rows.Scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *UploadSessionRepo) releaseBlobs(ctx context.Context, tx pgx.Tx, blobIDs []int) error {
+	sql, args, err := r.Builder.
+		Update("file_blobs").
+		Set("ref_count", squirrel.Expr("ref_count - 1")).
+		Where("id = ANY(?)", blobIDs).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - releaseBlobs - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - releaseBlobs - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - releaseBlobs - tx.Exec: failed to release blobs", "error", err)
+		return fmt.Errorf("UploadSessionRepo - releaseBlobs - tx.Exec: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Delete("file_blobs").
+		Where("id = ANY(?)", blobIDs).
+		Where("ref_count <= 0").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - releaseBlobs - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UploadSessionRepo - releaseBlobs - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UploadSessionRepo - releaseBlobs - tx.Exec: failed to delete blobs", "error", err)
+		return fmt.Errorf("UploadSessionRepo - releaseBlobs - tx.Exec: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupUploadSessionRepoTest(t *testing.T) (context.Context, pgxmock.PgxPoolIface, *UploadSessionRepo) {
+	t.Helper()
+
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err, "Error should not have occurred when opening a stub database connection")
+	defer mock.Close()
+
+	pg := &postgres.Postgres{Pool: mock, Builder: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+	repo := NewUploadSessionRepo(pg, logger.New("debug"))
+	return ctx, mock, repo
+}
+
+func TestUploadSession_Create(t *testing.T) {
+
+	t.Run("should create an upload session", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		expiresAt := time.Now().Add(time.Hour)
+		uploadSession := entity.UploadSession{
+			ID:             "0123456789abcdef0123456789abcdef",
+			UserID:         123,
+			Name:           "test.txt",
+			Size:           100,
+			EmailRecipient: "johndoe@email.com",
+			ExpiresAt:      &expiresAt,
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO upload_sessions").
+			WithArgs(uploadSession.ID, uploadSession.UserID, uploadSession.Name, uploadSession.Size, uploadSession.EmailRecipient, uploadSession.ExpiresAt).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Create(ctx, uploadSession, nil)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when creating an upload session")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should check the quota on the usage read under the lock of the user", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		uploadSession := entity.UploadSession{ID: "0123456789abcdef0123456789abcdef", UserID: 123, Name: "test.txt", Size: 100}
+		usage := entity.StorageUsage{BytesStored: 2048, FileCount: 3, UploadsLastHour: 5, BytesReserved: 512, UploadSessions: 2}
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT user_id FROM user_profiles WHERE user_id = \\$1 FOR UPDATE").
+			WithArgs(123).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT (.+) FROM upload_sessions WHERE user_id = \\$5 AND status = \\$6 AND expires_at > NOW\\(\\)").
+			WithArgs(123, 123, 123, 123, 123, entity.UploadSessionStatusOpen, 123, entity.UploadSessionStatusOpen).
+			WillReturnRows(mock.NewRows([]string{"bytes_stored", "file_count", "uploads_last_hour", "bytes_reserved", "upload_sessions"}).
+				AddRow(usage.BytesStored, usage.FileCount, usage.UploadsLastHour, usage.BytesReserved, usage.UploadSessions))
+		mock.ExpectRollback()
+
+		var checked entity.StorageUsage
+		admit := func(u entity.StorageUsage) error {
+			checked = u
+			return apperrors.NewQuotaExceededError(apperrors.QuotaUploadSessionsExceeded, "no more than 2 uploads can be in progress", "test")
+		}
+
+		// Act
+		err := repo.Create(ctx, uploadSession, admit)
+
+		// Assert
+		assert.True(t, apperrors.IsQuotaExceededError(err), "The rejection of the quota check should be returned")
+		assert.Equal(t, usage, checked, "The quota should be checked on the usage read in the transaction")
+		assert.NoError(t, mock.ExpectationsWereMet(), "The session should not be stored")
+	})
+}
+
+func TestUploadSession_GetByID(t *testing.T) {
+
+	t.Run("should return a no rows error when the session does not exist or has expired", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectQuery("SELECT (.+) FROM upload_sessions WHERE id = \\$1 AND user_id = \\$2 AND expires_at > NOW\\(\\)").
+			WithArgs("unknown", 123).
+			WillReturnError(pgx.ErrNoRows)
+
+		// Act
+		_, err := repo.GetByID(ctx, "unknown", 123)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUploadSession_AppendChunk(t *testing.T) {
+
+	const (
+		id     = "0123456789abcdef0123456789abcdef"
+		userID = 123
+	)
+	chunk := []byte("chunk")
+	expiresAt := time.Now().Add(time.Hour)
+
+	t.Run("should store the chunk as a blob and advance the offset", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE upload_sessions SET upload_offset = upload_offset \\+ \\$1, expires_at = \\$2 WHERE id = \\$3 AND user_id = \\$4 AND upload_offset = \\$5").
+			WithArgs(len(chunk), expiresAt, id, userID, int64(5)).
+			WillReturnRows(mock.NewRows([]string{"upload_offset"}).AddRow(int64(10)))
+		mock.ExpectQuery("INSERT INTO file_blobs").
+			WithArgs(userID, "checksum", len(chunk), chunk).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec("INSERT INTO upload_session_chunks").
+			WithArgs(id, int64(5), 7).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		// Act
+		offset, err := repo.AppendChunk(ctx, id, userID, 5, chunk, "checksum", expiresAt)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when appending a chunk")
+		assert.Equal(t, int64(10), offset, "The offset should have advanced by the chunk size")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should return a no rows error when the offset has moved", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE upload_sessions SET").
+			WithArgs(len(chunk), expiresAt, id, userID, int64(5)).
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.AppendChunk(ctx, id, userID, 5, chunk, "checksum", expiresAt)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUploadSession_Claim(t *testing.T) {
+
+	const (
+		id     = "0123456789abcdef0123456789abcdef"
+		userID = 123
+	)
+
+	t.Run("should mark an open session as being finalised", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectExec("UPDATE upload_sessions SET status = \\$1 WHERE id = \\$2 AND user_id = \\$3 AND status = \\$4 AND expires_at > NOW\\(\\)").
+			WithArgs(entity.UploadSessionStatusFinalizing, id, userID, entity.UploadSessionStatusOpen).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.Claim(ctx, id, userID)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when claiming an upload session")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error when the session is already claimed", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectExec("UPDATE upload_sessions SET status").
+			WithArgs(entity.UploadSessionStatusFinalizing, id, userID, entity.UploadSessionStatusOpen).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		// Act
+		err := repo.Claim(ctx, id, userID)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUploadSession_GetContent(t *testing.T) {
+
+	t.Run("should concatenate the chunks in offset order", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectQuery("SELECT b.content FROM upload_session_chunks c JOIN file_blobs b ON b.id = c.blob_id WHERE c.session_id = \\$1 ORDER BY c.chunk_offset ASC").
+			WithArgs("id").
+			WillReturnRows(mock.NewRows([]string{"content"}).AddRow([]byte("dummy ")).AddRow([]byte("content")))
+
+		// Act
+		content, err := repo.GetContent(ctx, "id")
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when getting the content")
+		assert.Equal(t, []byte("dummy content"), content, "The chunks should have been concatenated")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUploadSession_Delete(t *testing.T) {
+
+	t.Run("should delete the session and release its chunk blobs", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM upload_session_chunks WHERE session_id IN \\(SELECT id FROM upload_sessions WHERE id = \\$1\\) RETURNING blob_id").
+			WithArgs("id").
+			WillReturnRows(mock.NewRows([]string{"blob_id"}).AddRow(7).AddRow(8))
+		mock.ExpectExec("UPDATE file_blobs SET ref_count = ref_count - 1 WHERE id = ANY\\(\\$1\\)").
+			WithArgs([]int{7, 8}).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+		mock.ExpectExec("DELETE FROM file_blobs WHERE id = ANY\\(\\$1\\) AND ref_count <= 0").
+			WithArgs([]int{7, 8}).
+			WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		mock.ExpectExec("DELETE FROM upload_sessions WHERE id = \\$1").
+			WithArgs("id").
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Delete(ctx, "id")
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when deleting an upload session")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should delete expired sessions without chunks", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUploadSessionRepoTest(t)
+		before := time.Now()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM upload_session_chunks WHERE session_id IN \\(SELECT id FROM upload_sessions WHERE expires_at <= \\$1\\)").
+			WithArgs(before).
+			WillReturnRows(mock.NewRows([]string{"blob_id"}))
+		mock.ExpectExec("DELETE FROM upload_sessions WHERE expires_at <= \\$1").
+			WithArgs(before).
+			WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.DeleteExpired(ctx, before)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when deleting expired upload sessions")
+		mock.ExpectationsWereMet()
+	})
+}
@@ -23,8 +23,8 @@ func (r *UserCredentialRepo) Create(ctx context.Context, u entity.UserCredential
 
 	sql, args, err := r.Builder.
 		Insert("user_credentials").
-		Columns("user_id", "username", "password_hash").
-		Values(u.UserID, u.Username, u.PasswordHash).
+		Columns("user_id", "username", "password_hash", "email").
+		Values(u.UserID, u.Username, u.PasswordHash, nullIfEmpty(u.Email)).
 		ToSql()
 
 	if err != nil {
@@ -48,7 +48,7 @@ func (r *UserCredentialRepo) Create(ctx context.Context, u entity.UserCredential
 
 func (r *UserCredentialRepo) GetByUsername(ctx context.Context, username string) (entity.UserCredential, error) {
 	sql, args, err := r.Builder.
-		Select("user_id", "username", "password_hash").
+		Select("user_id", "username", "password_hash", "COALESCE(email, '')", "email_verified").
 		From("user_credentials").
 		Where("username = ?", username).
 		ToSql()
@@ -60,7 +60,7 @@ func (r *UserCredentialRepo) GetByUsername(ctx context.Context, username string)
 
 	var u entity.UserCredential
 	row := r.Pool.QueryRow(ctx, sql, args...)
-	err = row.Scan(&u.UserID, &u.Username, &u.PasswordHash)
+	err = row.Scan(&u.UserID, &u.Username, &u.PasswordHash, &u.Email, &u.EmailVerified)
 	if err != nil {
 		r.logger.Error("UserCredentialRepo - GetByUsername - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
 		pgErrorChecker := postgres.NewPGErrorChecker()
@@ -73,3 +73,91 @@ func (r *UserCredentialRepo) GetByUsername(ctx context.Context, username string)
 	r.logger.Info("UserCredentialRepo - GetByUsername - user credential retrieved successfully", "username", u.Username)
 	return u, nil
 }
+
+func (r *UserCredentialRepo) GetByUserID(ctx context.Context, userID int) (entity.UserCredential, error) {
+	sql, args, err := r.Builder.
+		Select("user_id", "username", "password_hash", "COALESCE(email, '')", "email_verified").
+		From("user_credentials").
+		Where("user_id = ?", userID).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserCredentialRepo - GetByUserID - r.Builder: failed to build query", "error", err)
+		return entity.UserCredential{}, fmt.Errorf("UserCredentialRepo - GetByUserID - r.Builder: %w", err)
+	}
+
+	var u entity.UserCredential
+	row := r.Pool.QueryRow(ctx, sql, args...)
+	err = row.Scan(&u.UserID, &u.Username, &u.PasswordHash, &u.Email, &u.EmailVerified)
+	if err != nil {
+		pgErrorChecker := postgres.NewPGErrorChecker()
+		if pgErrorChecker.IsNoRows(err) {
+			// users signed up through an OAuth provider have no credential
+			return entity.UserCredential{}, apperrors.NewNoRowsAffectedError("user credential not found", fmt.Sprintf("UserCredentialRepo - GetByUserID - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserCredentialRepo - GetByUserID - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.UserCredential{}, fmt.Errorf("UserCredentialRepo - GetByUserID - r.Pool.QueryRow: %w", err)
+	}
+
+	return u, nil
+}
+
+func (r *UserCredentialRepo) GetByEmail(ctx context.Context, email string) (entity.UserCredential, error) {
+	sql, args, err := r.Builder.
+		Select("user_id", "username", "password_hash", "COALESCE(email, '')", "email_verified").
+		From("user_credentials").
+		Where("email = ?", email).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserCredentialRepo - GetByEmail - r.Builder: failed to build query", "error", err)
+		return entity.UserCredential{}, fmt.Errorf("UserCredentialRepo - GetByEmail - r.Builder: %w", err)
+	}
+
+	var u entity.UserCredential
+	row := r.Pool.QueryRow(ctx, sql, args...)
+	err = row.Scan(&u.UserID, &u.Username, &u.PasswordHash, &u.Email, &u.EmailVerified)
+	if err != nil {
+		pgErrorChecker := postgres.NewPGErrorChecker()
+		if pgErrorChecker.IsNoRows(err) {
+			return entity.UserCredential{}, apperrors.NewNoRowsAffectedError("user credential not found", fmt.Sprintf("UserCredentialRepo - GetByEmail - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserCredentialRepo - GetByEmail - r.Pool.QueryRow: failed to execute query", "sql", sql, "error", err)
+		return entity.UserCredential{}, fmt.Errorf("UserCredentialRepo - GetByEmail - r.Pool.QueryRow: %w", err)
+	}
+
+	return u, nil
+}
+
+func (r *UserCredentialRepo) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	sql, args, err := r.Builder.
+		Update("user_credentials").
+		Set("password_hash", passwordHash).
+		Where("user_id = ?", userID).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserCredentialRepo - UpdatePassword - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserCredentialRepo - UpdatePassword - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserCredentialRepo - UpdatePassword - r.Pool.Exec : failed to execute query", "sql", sql, "error", err)
+		return fmt.Errorf("UserCredentialRepo - UpdatePassword - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("user credential not found", "UserCredentialRepo - UpdatePassword - r.Pool.Exec")
+	}
+
+	r.logger.Info("UserCredentialRepo - UpdatePassword - password updated successfully", "userID", userID)
+	return nil
+}
+
+// nullIfEmpty stores an empty string as NULL, so that optional unique columns do not collide on it.
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -6,8 +6,10 @@ import (
 
 	"github.com/Masterminds/squirrel"
 	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/assert"
 )
@@ -32,6 +34,7 @@ func TestUserCredentialRepo_Create(t *testing.T) {
 		userID       = 123
 		userName     = "123"
 		passwordHash = "123"
+		email        = "hank@mail.com"
 	)
 
 	t.Run("should create a user credential", func(t *testing.T) {
@@ -42,10 +45,11 @@ func TestUserCredentialRepo_Create(t *testing.T) {
 			UserID:       userID,
 			Username:     userName,
 			PasswordHash: passwordHash,
+			Email:        email,
 		}
 
 		mock.ExpectExec("INSERT INTO user_credentials").
-			WithArgs(userCredential.UserID, userCredential.Username, userCredential.PasswordHash).
+			WithArgs(userCredential.UserID, userCredential.Username, userCredential.PasswordHash, nullIfEmpty(email)).
 			WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 		err := repo.Create(ctx, userCredential)
@@ -60,7 +64,7 @@ func TestUserCredentialRepo_Create(t *testing.T) {
 		userCredential := entity.UserCredential{}
 
 		mock.ExpectExec("INSERT INTO user_credentials").
-			WithArgs(userCredential.UserID, userCredential.Username, userCredential.PasswordHash).
+			WithArgs(userCredential.UserID, userCredential.Username, userCredential.PasswordHash, nullIfEmpty("")).
 			WillReturnError(assert.AnError)
 
 		err := repo.Create(ctx, userCredential)
@@ -82,16 +86,18 @@ func TestUserCredentialRepo_GetByUsername(t *testing.T) {
 		ctx, mock, repo := setupUserCredentialRepoTest(t)
 
 		userCredential := entity.UserCredential{
-			UserID:       userID,
-			Username:     userName,
-			PasswordHash: passwordHash,
+			UserID:        userID,
+			Username:      userName,
+			PasswordHash:  passwordHash,
+			Email:         "hank@mail.com",
+			EmailVerified: true,
 		}
 
-		mock.ExpectQuery("SELECT user_id, username, password_hash FROM user_credentials").
+		mock.ExpectQuery("SELECT user_id, username, password_hash, .+ FROM user_credentials").
 			WithArgs(userCredential.Username).
 			WillReturnRows(
-				mock.NewRows([]string{"user_id", "username", "password_hash"}).
-					AddRow(userCredential.UserID, userCredential.Username, userCredential.PasswordHash),
+				mock.NewRows([]string{"user_id", "username", "password_hash", "email", "email_verified"}).
+					AddRow(userCredential.UserID, userCredential.Username, userCredential.PasswordHash, userCredential.Email, userCredential.EmailVerified),
 			)
 
 		u, err := repo.GetByUsername(ctx, userCredential.Username)
@@ -106,7 +112,7 @@ func TestUserCredentialRepo_GetByUsername(t *testing.T) {
 
 		userCredential := entity.UserCredential{}
 
-		mock.ExpectQuery("SELECT user_id, username, password_hash FROM user_credentials").
+		mock.ExpectQuery("SELECT user_id, username, password_hash, .+ FROM user_credentials").
 			WithArgs(userCredential.Username).
 			WillReturnError(assert.AnError)
 
@@ -115,3 +121,66 @@ func TestUserCredentialRepo_GetByUsername(t *testing.T) {
 		mock.ExpectationsWereMet()
 	})
 }
+
+func TestUserCredentialRepo_GetByUserID(t *testing.T) {
+
+	t.Run("should get a user credential by user id", func(t *testing.T) {
+
+		ctx, mock, repo := setupUserCredentialRepoTest(t)
+
+		mock.ExpectQuery("SELECT user_id, username, password_hash, .+ FROM user_credentials WHERE user_id = \\$1").
+			WithArgs(123).
+			WillReturnRows(
+				mock.NewRows([]string{"user_id", "username", "password_hash", "email", "email_verified"}).
+					AddRow(123, "hank", "hash", "hank@mail.com", false),
+			)
+
+		u, err := repo.GetByUserID(ctx, 123)
+		assert.NoError(t, err)
+		assert.Equal(t, "hank@mail.com", u.Email)
+		assert.False(t, u.EmailVerified)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error for users without a credential", func(t *testing.T) {
+
+		ctx, mock, repo := setupUserCredentialRepoTest(t)
+
+		mock.ExpectQuery("SELECT user_id, username, password_hash, .+ FROM user_credentials").
+			WithArgs(123).
+			WillReturnError(pgx.ErrNoRows)
+
+		_, err := repo.GetByUserID(ctx, 123)
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserCredentialRepo_UpdatePassword(t *testing.T) {
+
+	t.Run("should update the password hash", func(t *testing.T) {
+
+		ctx, mock, repo := setupUserCredentialRepoTest(t)
+
+		mock.ExpectExec("UPDATE user_credentials SET password_hash = \\$1 WHERE user_id = \\$2").
+			WithArgs("new-hash", 123).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		err := repo.UpdatePassword(ctx, 123, "new-hash")
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error for users without a credential", func(t *testing.T) {
+
+		ctx, mock, repo := setupUserCredentialRepoTest(t)
+
+		mock.ExpectExec("UPDATE user_credentials").
+			WithArgs("new-hash", 123).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		err := repo.UpdatePassword(ctx, 123, "new-hash")
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
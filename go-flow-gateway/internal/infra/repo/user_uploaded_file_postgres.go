@@ -3,45 +3,898 @@ package repo
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/squirrel"
 	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
 )
 
+// rowQuerier is what reads share between the pool and a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
 type UserUploadedFileRepo struct {
 	*postgres.Postgres
 	logger logger.Logger
 }
 
-func NewUserUploadedFileRepo(pg *postgres.Postgres, l logger.Logger) *UserUploadedFileRepo {
-	return &UserUploadedFileRepo{Postgres: pg, logger: l}
+func NewUserUploadedFileRepo(pg *postgres.Postgres, l logger.Logger) *UserUploadedFileRepo {
+	return &UserUploadedFileRepo{Postgres: pg, logger: l}
+}
+
+// Create stores the file. When admit is given, the user is locked and admit decides on the usage read under
+// the lock whether the file may be stored, so concurrent uploads cannot pass the quota check together.
+func (r *UserUploadedFileRepo) Create(ctx context.Context, u entity.UserUploadedFile, admit func(usage entity.StorageUsage) error) (int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - Create - r.Pool.Begin: failed to begin transaction", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - Create - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if admit != nil {
+		usage, err := r.lockUsage(ctx, tx, u.UserID)
+		if err != nil {
+			return 0, fmt.Errorf("UserUploadedFileRepo - Create - r.lockUsage: %w", err)
+		}
+		err = admit(usage)
+		if err != nil {
+			return 0, fmt.Errorf("UserUploadedFileRepo - Create - admit: %w", err)
+		}
+	}
+
+	userUploadedFileID, blobID, err := r.insertFile(ctx, tx, u)
+	if err != nil {
+		return 0, fmt.Errorf("UserUploadedFileRepo - Create - r.insertFile: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - Create - tx.Commit: failed to commit transaction", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - Create - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - Create: successfully created user uploaded file", "userUploadedFileID", userUploadedFileID, "blobID", blobID)
+	return userUploadedFileID, nil
+}
+
+// lockUsage locks the user until the transaction ends and reads what they consume of the upload quotas.
+func (r *UserUploadedFileRepo) lockUsage(ctx context.Context, tx pgx.Tx, userID int) (entity.StorageUsage, error) {
+	sql, args, err := r.Builder.
+		Select("user_id").
+		From("user_profiles").
+		Where("user_id = ?", userID).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - lockUsage - r.Builder: failed to build query", "error", err)
+		return entity.StorageUsage{}, fmt.Errorf("UserUploadedFileRepo - lockUsage - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - lockUsage - tx.Exec: failed to lock user", "error", err)
+		return entity.StorageUsage{}, fmt.Errorf("UserUploadedFileRepo - lockUsage - tx.Exec: %w", err)
+	}
+
+	usage, err := r.getUsage(ctx, tx, userID)
+	if err != nil {
+		return entity.StorageUsage{}, fmt.Errorf("UserUploadedFileRepo - lockUsage - r.getUsage: %w", err)
+	}
+	return usage, nil
+}
+
+// insertFile stores the file record together with a reference on its blob, and logs the upload for the
+// upload rate limit.
+func (r *UserUploadedFileRepo) insertFile(ctx context.Context, tx pgx.Tx, u entity.UserUploadedFile) (int, int, error) {
+	blobID, err := r.acquireBlob(ctx, tx, u)
+	if err != nil {
+		return 0, 0, fmt.Errorf("UserUploadedFileRepo - insertFile - r.acquireBlob: %w", err)
+	}
+
+	// Build the SQL query using squirrel
+	sql, args, err := r.Builder.
+		Insert("user_uploaded_files").
+		Columns("name", "size", "content_type", "checksum", "blob_id", "user_id", "delivery_id", "expires_at", "email_sent", "email_recipient").
+		Values(u.Name, u.Size, u.ContentType, u.Checksum, blobID, u.UserID, u.DeliveryID, u.ExpiresAt, u.EmailSent, u.EmailRecipient).
+		Suffix("RETURNING id").
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - insertFile - r.Builder: failed to build query", "error", err)
+		return 0, 0, fmt.Errorf("UserUploadedFileRepo - insertFile - r.Builder: %w", err)
+	}
+
+	// Execute the query using pgx
+	var userUploadedFileID int
+	err = tx.QueryRow(ctx, sql, args...).Scan(&userUploadedFileID)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - insertFile - tx.QueryRow: failed to execute query", "error", err)
+		return 0, 0, fmt.Errorf("UserUploadedFileRepo - insertFile - tx.QueryRow: %w", err)
+	}
+
+	// the log outlives the file, deleting an upload does not give the upload back
+	sql, args, err = r.Builder.
+		Insert("file_uploads").
+		Columns("user_id").
+		Values(u.UserID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - insertFile - r.Builder: failed to build upload log query", "error", err)
+		return 0, 0, fmt.Errorf("UserUploadedFileRepo - insertFile - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - insertFile - tx.Exec: failed to log upload", "error", err)
+		return 0, 0, fmt.Errorf("UserUploadedFileRepo - insertFile - tx.Exec: %w", err)
+	}
+	return userUploadedFileID, blobID, nil
+}
+
+// acquireBlob takes a reference on the blob the file points to, or stores the content as a new blob.
+func (r *UserUploadedFileRepo) acquireBlob(ctx context.Context, tx pgx.Tx, u entity.UserUploadedFile) (int, error) {
+	var blobID int
+	if u.BlobID != 0 {
+		sql, args, err := r.Builder.
+			Update("file_blobs").
+			Set("ref_count", squirrel.Expr("ref_count + 1")).
+			Where("id = ?", u.BlobID).
+			Where("user_id = ?", u.UserID).
+			Suffix("RETURNING id").
+			ToSql()
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - acquireBlob - r.Builder: failed to build query", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - acquireBlob - r.Builder: %w", err)
+		}
+
+		err = tx.QueryRow(ctx, sql, args...).Scan(&blobID)
+		if err == nil {
+			return blobID, nil
+		}
+		if !postgres.NewPGErrorChecker().IsNoRows(err) {
+			r.logger.Error("UserUploadedFileRepo - acquireBlob - tx.QueryRow: failed to execute query", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - acquireBlob - tx.QueryRow: %w", err)
+		}
+		// the blob has been released in the meantime, store the content again
+	}
+
+	sql, args, err := r.Builder.
+		Insert("file_blobs").
+		Columns("user_id", "checksum", "size", "content").
+		Values(u.UserID, u.Checksum, u.Size, u.Content).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - acquireBlob - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - acquireBlob - r.Builder: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, sql, args...).Scan(&blobID)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - acquireBlob - tx.QueryRow: failed to execute query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - acquireBlob - tx.QueryRow: %w", err)
+	}
+	return blobID, nil
+}
+
+func (r *UserUploadedFileRepo) GetBlobIDByChecksum(ctx context.Context, userID int, checksum string) (int, error) {
+	sql, args, err := r.Builder.
+		Select("id").
+		From("file_blobs").
+		Where("user_id = ?", userID).
+		Where("checksum = ?", checksum).
+		OrderBy("id ASC").
+		Limit(1).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetBlobIDByChecksum - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - GetBlobIDByChecksum - r.Builder: %w", err)
+	}
+
+	var blobID int
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&blobID)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return 0, apperrors.NewNoRowsAffectedError("file blob not found", fmt.Sprintf("UserUploadedFileRepo - GetBlobIDByChecksum - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserUploadedFileRepo - GetBlobIDByChecksum - r.Pool.QueryRow: failed to execute query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - GetBlobIDByChecksum - r.Pool.QueryRow: %w", err)
+	}
+
+	return blobID, nil
+}
+
+// Delete removes the file record and releases its blob, deleting the content once no file references it.
+func (r *UserUploadedFileRepo) Delete(ctx context.Context, ID, userID int) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - Delete - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - Delete - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Delete("user_uploaded_files").
+		Where("id = ?", ID).
+		Where("user_id = ?", userID).
+		Suffix("RETURNING COALESCE(blob_id, 0)").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - Delete - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - Delete - r.Builder: %w", err)
+	}
+
+	var blobID int
+	err = tx.QueryRow(ctx, sql, args...).Scan(&blobID)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return apperrors.NewNoRowsAffectedError("user uploaded file not found", fmt.Sprintf("UserUploadedFileRepo - Delete - tx.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserUploadedFileRepo - Delete - tx.QueryRow: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - Delete - tx.QueryRow: %w", err)
+	}
+
+	// the content of an expired file has already been released
+	refCount := 0
+	if blobID != 0 {
+		refCount, err = r.releaseBlob(ctx, tx, blobID)
+		if err != nil {
+			return fmt.Errorf("UserUploadedFileRepo - Delete - r.releaseBlob: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - Delete - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - Delete - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - Delete: successfully deleted user uploaded file", "userUploadedFileID", ID, "blobRefCount", refCount)
+	return nil
+}
+
+// releaseBlob drops a reference on a blob and deletes the content once no file references it.
+// It returns the remaining number of references.
+func (r *UserUploadedFileRepo) releaseBlob(ctx context.Context, tx pgx.Tx, blobID int) (int, error) {
+	sql, args, err := r.Builder.
+		Update("file_blobs").
+		Set("ref_count", squirrel.Expr("ref_count - 1")).
+		Where("id = ?", blobID).
+		Suffix("RETURNING ref_count").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - releaseBlob - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - releaseBlob - r.Builder: %w", err)
+	}
+
+	var refCount int
+	err = tx.QueryRow(ctx, sql, args...).Scan(&refCount)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - releaseBlob - tx.QueryRow: failed to release blob", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - releaseBlob - tx.QueryRow: %w", err)
+	}
+
+	if refCount <= 0 {
+		sql, args, err = r.Builder.
+			Delete("file_blobs").
+			Where("id = ?", blobID).
+			ToSql()
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - releaseBlob - r.Builder: failed to build query", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - releaseBlob - r.Builder: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, sql, args...)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - releaseBlob - tx.Exec: failed to delete blob", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - releaseBlob - tx.Exec: %w", err)
+		}
+	}
+	return refCount, nil
+}
+
+// GetByID returns a file of the user without its content, see GetBlobContent.
+func (r *UserUploadedFileRepo) GetByID(ctx context.Context, ID, userID int) (entity.UserUploadedFile, error) {
+	sql, args, err := r.Builder.
+		Select("id", "name", "size", "content_type", "checksum", "COALESCE(blob_id, 0)", "user_id", "delivery_id", "created_at", "expires_at", "expired_at", "email_sent", "email_sent_at", "email_recipient", "error_message", "status").
+		From("user_uploaded_files").
+		Where("id = ?", ID).
+		Where("user_id = ?", userID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetByID - r.Builder: failed to build query", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileRepo - GetByID - r.Builder: %w", err)
+	}
+
+	var file entity.UserUploadedFile
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&file.ID, &file.Name, &file.Size, &file.ContentType, &file.Checksum, &file.BlobID, &file.UserID, &file.DeliveryID, &file.CreatedAt, &file.ExpiresAt, &file.ExpiredAt, &file.EmailSent, &file.EmailSentAt, &file.EmailRecipient, &file.ErrorMessage, &file.Status)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.UserUploadedFile{}, apperrors.NewNoRowsAffectedError("user uploaded file not found", fmt.Sprintf("UserUploadedFileRepo - GetByID - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserUploadedFileRepo - GetByID - r.Pool.QueryRow: failed to execute query", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileRepo - GetByID - r.Pool.QueryRow: %w", err)
+	}
+	return file, nil
+}
+
+// ExpireFiles purges the content of up to limit files whose expiry has passed. The file rows stay as
+// tombstones with the expired status, so the upload remains on record. It returns the expired file ids.
+func (r *UserUploadedFileRepo) ExpireFiles(ctx context.Context, now time.Time, limit int) ([]int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - r.Pool.Begin: failed to begin transaction", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Select("id", "blob_id").
+		From("user_uploaded_files").
+		Where("expired_at IS NULL").
+		Where("expires_at <= ?", now).
+		OrderBy("expires_at ASC").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - r.Builder: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - tx.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - tx.Query: %w", err)
+	}
+	var ids, blobIDs []int
+	for rows.Next() {
+		var id, blobID int
+		if err := rows.Scan(&id, &blobID); err != nil {
+			rows.Close()
+			r.logger.Error("UserUploadedFileRepo - ExpireFiles - rows.Scan: failed to scan file", "error", err)
+			return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - rows.Scan: %w", err)
+		}
+		ids = append(ids, id)
+		blobIDs = append(blobIDs, blobID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - rows.Err: failed to read files", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - rows.Err: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	sql, args, err = r.Builder.
+		Update("user_uploaded_files").
+		Set("status", entity.FileStatusExpired).
+		Set("expired_at", now).
+		Set("blob_id", nil).
+		Where(squirrel.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - tx.Exec: failed to mark files as expired", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - tx.Exec: %w", err)
+	}
+
+	for _, blobID := range blobIDs {
+		_, err = r.releaseBlob(ctx, tx, blobID)
+		if err != nil {
+			return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - r.releaseBlob: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ExpireFiles - tx.Commit: failed to commit transaction", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ExpireFiles - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - ExpireFiles: successfully expired user uploaded files", "count", len(ids))
+	return ids, nil
+}
+
+// CreateDelivery stores the delivery with its files in one transaction. When admit is given, the user is
+// locked and admit picks the files that may be stored from the usage read under the lock, an error stores
+// nothing.
+func (r *UserUploadedFileRepo) CreateDelivery(ctx context.Context, d entity.Delivery, admit func(usage entity.StorageUsage) ([]entity.UserUploadedFile, error)) (entity.Delivery, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateDelivery - r.Pool.Begin: failed to begin transaction", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if admit != nil {
+		usage, err := r.lockUsage(ctx, tx, d.UserID)
+		if err != nil {
+			return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - r.lockUsage: %w", err)
+		}
+		d.Files, err = admit(usage)
+		if err != nil {
+			return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - admit: %w", err)
+		}
+	}
+
+	sql, args, err := r.Builder.
+		Insert("deliveries").
+		Columns("user_id", "email_recipients", "status", "send_at").
+		Values(d.UserID, d.EmailRecipients, d.Status, d.SendAt).
+		Suffix("RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateDelivery - r.Builder: failed to build query", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - r.Builder: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, sql, args...).Scan(&d.ID, &d.CreatedAt)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateDelivery - tx.QueryRow: failed to execute query", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - tx.QueryRow: %w", err)
+	}
+
+	files := make([]entity.UserUploadedFile, len(d.Files))
+	for i, file := range d.Files {
+		file.DeliveryID = &d.ID
+		file.ID, file.BlobID, err = r.insertFile(ctx, tx, file)
+		if err != nil {
+			return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - r.insertFile: %w", err)
+		}
+		files[i] = file
+	}
+	d.Files = files
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateDelivery - tx.Commit: failed to commit transaction", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - CreateDelivery - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - CreateDelivery: successfully created delivery", "deliveryID", d.ID, "files", len(d.Files))
+	return d, nil
+}
+
+// GetDelivery returns a delivery with its files. The content is left out, see GetBlobContent.
+func (r *UserUploadedFileRepo) GetDelivery(ctx context.Context, deliveryID int) (entity.Delivery, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "email_recipients", "status", "send_at", "created_at", "email_sent", "email_sent_at", "error_message", "archive_password", "archive_sent_at").
+		From("deliveries").
+		Where("id = ?", deliveryID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetDelivery - r.Builder: failed to build delivery query", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - GetDelivery - r.Builder: %w", err)
+	}
+
+	var d entity.Delivery
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&d.ID, &d.UserID, &d.EmailRecipients, &d.Status, &d.SendAt, &d.CreatedAt, &d.EmailSent, &d.EmailSentAt, &d.ErrorMessage, &d.ArchivePassword, &d.ArchiveSentAt)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return entity.Delivery{}, apperrors.NewNoRowsAffectedError("delivery not found", fmt.Sprintf("UserUploadedFileRepo - GetDelivery - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserUploadedFileRepo - GetDelivery - r.Pool.QueryRow: failed to execute delivery query", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - GetDelivery - r.Pool.QueryRow: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Select("id", "name", "size", "content_type", "checksum", "COALESCE(blob_id, 0)", "user_id", "delivery_id", "created_at", "expires_at", "email_recipient", "status").
+		From("user_uploaded_files").
+		Where("delivery_id = ?", deliveryID).
+		OrderBy("id ASC").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetDelivery - r.Builder: failed to build files query", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - GetDelivery - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetDelivery - r.Pool.Query: failed to execute files query", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - GetDelivery - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file entity.UserUploadedFile
+		err := rows.Scan(&file.ID, &file.Name, &file.Size, &file.ContentType, &file.Checksum, &file.BlobID, &file.UserID, &file.DeliveryID, &file.CreatedAt, &file.ExpiresAt, &file.EmailRecipient, &file.Status)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - GetDelivery - rows.Scan: failed to scan file", "error", err)
+			return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - GetDelivery - rows.Scan: %w", err)
+		}
+		d.Files = append(d.Files, file)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetDelivery - rows.Err: failed to read files", "error", err)
+		return entity.Delivery{}, fmt.Errorf("UserUploadedFileRepo - GetDelivery - rows.Err: %w", err)
+	}
+
+	return d, nil
+}
+
+// GetBlobContent loads the stored content of a single blob, so files can be processed one at a time.
+func (r *UserUploadedFileRepo) GetBlobContent(ctx context.Context, blobID int) ([]byte, error) {
+	sql, args, err := r.Builder.
+		Select("content").
+		From("file_blobs").
+		Where("id = ?", blobID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetBlobContent - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetBlobContent - r.Builder: %w", err)
+	}
+
+	var content []byte
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&content)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			return nil, apperrors.NewNoRowsAffectedError("blob not found", fmt.Sprintf("UserUploadedFileRepo - GetBlobContent - r.Pool.QueryRow: %s", err.Error()))
+		}
+		r.logger.Error("UserUploadedFileRepo - GetBlobContent - r.Pool.QueryRow: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetBlobContent - r.Pool.QueryRow: %w", err)
+	}
+	return content, nil
+}
+
+// UpdateDeliveryStatus sets the status of a delivery. A status with an error message records a failed
+// attempt, a sent delivery clears it.
+func (r *UserUploadedFileRepo) UpdateDeliveryStatus(ctx context.Context, deliveryID int, status string, errorMessage *string) error {
+	builder := r.Builder.
+		Update("deliveries").
+		Set("status", status).
+		Set("error_message", errorMessage).
+		Where("id = ?", deliveryID)
+	if status == entity.DeliveryStatusSent {
+		builder = builder.Set("email_sent", true).Set("email_sent_at", squirrel.Expr("NOW()")).Set("failed_at", nil).Set("archive_password", nil).Set("archive_sent_at", nil)
+	} else if errorMessage != nil {
+		builder = builder.Set("failed_at", squirrel.Expr("NOW()"))
+	}
+
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - UpdateDeliveryStatus - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - UpdateDeliveryStatus - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - UpdateDeliveryStatus - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - UpdateDeliveryStatus - r.Pool.Exec: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - UpdateDeliveryStatus: successfully updated delivery status", "deliveryID", deliveryID, "status", status)
+	return nil
+}
+
+// SetArchivePassword records the password of an archive before it is emailed, until the separate email
+// with the password is sent and the delivery is marked sent.
+func (r *UserUploadedFileRepo) SetArchivePassword(ctx context.Context, deliveryID int, password string) error {
+	sql, args, err := r.Builder.
+		Update("deliveries").
+		Set("archive_password", password).
+		Where("id = ?", deliveryID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - SetArchivePassword - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - SetArchivePassword - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - SetArchivePassword - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - SetArchivePassword - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+// MarkArchiveSent records that the archive of a delivery went out, so a retry only sends its password.
+func (r *UserUploadedFileRepo) MarkArchiveSent(ctx context.Context, deliveryID int) error {
+	sql, args, err := r.Builder.
+		Update("deliveries").
+		Set("archive_sent_at", squirrel.Expr("NOW()")).
+		Where("id = ?", deliveryID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - MarkArchiveSent - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - MarkArchiveSent - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - MarkArchiveSent - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - MarkArchiveSent - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+// MarkDeliveryPublished forgets the claim of ClaimDueDeliveries once the delivery has been published.
+func (r *UserUploadedFileRepo) MarkDeliveryPublished(ctx context.Context, deliveryID int) error {
+	sql, args, err := r.Builder.
+		Update("deliveries").
+		Set("publish_claimed_at", nil).
+		Where("id = ?", deliveryID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - MarkDeliveryPublished - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - MarkDeliveryPublished - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - MarkDeliveryPublished - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - MarkDeliveryPublished - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+// ClaimDelivery marks a pending delivery as being sent. A delivery already sent or failed, or claimed by
+// another consumer after staleBefore, is reported as a no rows error so a redelivered message does not
+// send it again.
+func (r *UserUploadedFileRepo) ClaimDelivery(ctx context.Context, deliveryID int, now, staleBefore time.Time) error {
+	sql, args, err := r.Builder.
+		Update("deliveries").
+		Set("status", entity.DeliveryStatusSending).
+		Set("claimed_at", now).
+		Set("publish_claimed_at", nil). // the message arrived, the scheduler need not publish it again
+		Where("id = ?", deliveryID).
+		Where(squirrel.Or{
+			squirrel.Eq{"status": entity.DeliveryStatusPending},
+			squirrel.And{squirrel.Eq{"status": entity.DeliveryStatusSending}, squirrel.Lt{"claimed_at": staleBefore}},
+		}).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ClaimDelivery - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - ClaimDelivery - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ClaimDelivery - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - ClaimDelivery - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("delivery already sent or being sent", "UserUploadedFileRepo - ClaimDelivery - r.Pool.Exec: no rows affected")
+	}
+	return nil
+}
+
+// RequeueDelivery puts a delivery of the user back to pending so it is sent again, to new recipients when
+// some are given, and forgets the recipient statuses reported for its files. Deliveries that are scheduled,
+// cancelled or being sent are reported as a no rows error.
+func (r *UserUploadedFileRepo) RequeueDelivery(ctx context.Context, deliveryID, userID int, recipients []string) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueDelivery - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	builder := r.Builder.
+		Update("deliveries").
+		Set("status", entity.DeliveryStatusPending).
+		Set("claimed_at", nil).
+		Set("error_message", nil).
+		Set("archive_password", nil). // a resend builds a new archive
+		Set("archive_sent_at", nil).
+		Where("id = ?", deliveryID).
+		Where("user_id = ?", userID).
+		Where(squirrel.Eq{"status": []string{entity.DeliveryStatusPending, entity.DeliveryStatusSent, entity.DeliveryStatusFailed}})
+	if len(recipients) > 0 {
+		builder = builder.Set("email_recipients", recipients)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueDelivery - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - r.Builder: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueDelivery - tx.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - tx.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("delivery being sent or not sent yet", "UserUploadedFileRepo - RequeueDelivery - tx.Exec: no rows affected")
+	}
+
+	if len(recipients) > 0 {
+		// the files show the recipients of their delivery
+		sql, args, err = r.Builder.
+			Update("user_uploaded_files").
+			Set("email_recipient", strings.Join(recipients, ", ")).
+			Where("delivery_id = ?", deliveryID).
+			ToSql()
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - RequeueDelivery - r.Builder: failed to build files query", "error", err)
+			return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - r.Builder: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, sql, args...)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - RequeueDelivery - tx.Exec: failed to update file recipients", "error", err)
+			return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - tx.Exec: %w", err)
+		}
+	}
+
+	// the statuses reported for the previous email would otherwise show against the new one
+	sql, args, err = r.Builder.
+		Delete("email_recipient_statuses").
+		Where("user_uploaded_file_id IN (SELECT id FROM user_uploaded_files WHERE delivery_id = ?)", deliveryID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueDelivery - r.Builder: failed to build recipient statuses query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueDelivery - tx.Exec: failed to clear recipient statuses", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueDelivery - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueDelivery - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - RequeueDelivery: successfully requeued delivery", "deliveryID", deliveryID)
+	return nil
+}
+
+// GetFailedDeliveries returns up to limit deliveries after lastID whose last attempt failed between from
+// and to and that have not been sent since.
+func (r *UserUploadedFileRepo) GetFailedDeliveries(ctx context.Context, from, to time.Time, lastID, limit int) ([]entity.Delivery, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "email_recipients", "status", "error_message").
+		From("deliveries").
+		Where(squirrel.Eq{"status": []string{entity.DeliveryStatusPending, entity.DeliveryStatusFailed}}).
+		Where("failed_at >= ?", from).
+		Where("failed_at < ?", to).
+		Where("id > ?", lastID).
+		OrderBy("id ASC").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetFailedDeliveries - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedDeliveries - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetFailedDeliveries - r.Pool.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedDeliveries - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []entity.Delivery
+	for rows.Next() {
+		var d entity.Delivery
+		err := rows.Scan(&d.ID, &d.UserID, &d.EmailRecipients, &d.Status, &d.ErrorMessage)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - GetFailedDeliveries - rows.Scan: failed to scan delivery", "error", err)
+			return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedDeliveries - rows.Scan: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetFailedDeliveries - rows.Err: failed to read deliveries", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedDeliveries - rows.Err: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RescheduleDelivery moves the send time of a delivery that is still scheduled.
+func (r *UserUploadedFileRepo) RescheduleDelivery(ctx context.Context, deliveryID, userID int, sendAt time.Time) error {
+	err := r.updateScheduledDelivery(ctx, deliveryID, userID, map[string]interface{}{"send_at": sendAt})
+	if err != nil {
+		return fmt.Errorf("UserUploadedFileRepo - RescheduleDelivery - r.updateScheduledDelivery: %w", err)
+	}
+	r.logger.Info("UserUploadedFileRepo - RescheduleDelivery: successfully rescheduled delivery", "deliveryID", deliveryID)
+	return nil
 }
 
-func (r *UserUploadedFileRepo) Create(ctx context.Context, u entity.UserUploadedFile) (int, error) {
-	// Build the SQL query using squirrel
+// CancelDelivery cancels a delivery that is still scheduled.
+func (r *UserUploadedFileRepo) CancelDelivery(ctx context.Context, deliveryID, userID int) error {
+	err := r.updateScheduledDelivery(ctx, deliveryID, userID, map[string]interface{}{"status": entity.DeliveryStatusCancelled})
+	if err != nil {
+		return fmt.Errorf("UserUploadedFileRepo - CancelDelivery - r.updateScheduledDelivery: %w", err)
+	}
+	r.logger.Info("UserUploadedFileRepo - CancelDelivery: successfully cancelled delivery", "deliveryID", deliveryID)
+	return nil
+}
+
+// updateScheduledDelivery only touches a delivery that is still scheduled, one that has been claimed
+// in the meantime is reported as a no rows error.
+func (r *UserUploadedFileRepo) updateScheduledDelivery(ctx context.Context, deliveryID, userID int, set map[string]interface{}) error {
 	sql, args, err := r.Builder.
-		Insert("user_uploaded_files").
-		Columns("name", "size", "content", "user_id", "email_sent", "email_recipient").
-		Values(u.Name, u.Size, u.Content, u.UserID, u.EmailSent, u.EmailRecipient).
-		Suffix("RETURNING id").
+		Update("deliveries").
+		SetMap(set).
+		Where("id = ?", deliveryID).
+		Where("user_id = ?", userID).
+		Where("status = ?", entity.DeliveryStatusScheduled).
 		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - updateScheduledDelivery - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - updateScheduledDelivery - r.Builder: %w", err)
+	}
 
+	tag, err := r.Pool.Exec(ctx, sql, args...)
 	if err != nil {
-		r.logger.Error("UserUploadedFileRepo - Create - r.Builder: failed to build query", "error", err)
-		return 0, fmt.Errorf("UserUploadedFileRepo - Create - r.Builder: %w", err)
+		r.logger.Error("UserUploadedFileRepo - updateScheduledDelivery - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - updateScheduledDelivery - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("scheduled delivery not found", "UserUploadedFileRepo - updateScheduledDelivery - r.Pool.Exec: no rows affected")
 	}
+	return nil
+}
 
-	// Execute the query using pgx
-	var userUploadedFileID int
-	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&userUploadedFileID)
+// ClaimDueDeliveries moves up to limit scheduled deliveries whose send time has passed to pending and
+// returns them. The claim is recorded until MarkDeliveryPublished, deliveries claimed before staleBefore
+// and still pending were never published and are claimed again. Rows locked by another worker are skipped.
+func (r *UserUploadedFileRepo) ClaimDueDeliveries(ctx context.Context, now, staleBefore time.Time, limit int) ([]entity.Delivery, error) {
+	// the subquery keeps ? placeholders so they are numbered together with the outer statement
+	due := squirrel.
+		Select("id").
+		From("deliveries").
+		Where(squirrel.Or{
+			squirrel.And{squirrel.Eq{"status": entity.DeliveryStatusScheduled}, squirrel.LtOrEq{"send_at": now}},
+			squirrel.And{squirrel.Eq{"status": entity.DeliveryStatusPending}, squirrel.Lt{"publish_claimed_at": staleBefore}},
+		}).
+		OrderBy("send_at ASC").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	sql, args, err := r.Builder.
+		Update("deliveries").
+		Set("status", entity.DeliveryStatusPending).
+		Set("publish_claimed_at", now).
+		Where(squirrel.Expr("id IN (?)", due)).
+		Suffix("RETURNING id, user_id, email_recipients, status, send_at, created_at").
+		ToSql()
 	if err != nil {
-		r.logger.Error("UserUploadedFileRepo - Create - r.Pool.QueryRow: failed to execute query", "error", err)
-		return 0, fmt.Errorf("UserUploadedFileRepo - Save - r.Pool.QueryRow: %w", err)
+		r.logger.Error("UserUploadedFileRepo - ClaimDueDeliveries - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ClaimDueDeliveries - r.Builder: %w", err)
 	}
 
-	r.logger.Info("UserUploadedFileRepo - Create: successfully created user uploaded file", "userUploadedFileID", userUploadedFileID)
-	return userUploadedFileID, nil
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ClaimDueDeliveries - r.Pool.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ClaimDueDeliveries - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []entity.Delivery
+	for rows.Next() {
+		var d entity.Delivery
+		err := rows.Scan(&d.ID, &d.UserID, &d.EmailRecipients, &d.Status, &d.SendAt, &d.CreatedAt)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - ClaimDueDeliveries - rows.Scan: failed to scan delivery", "error", err)
+			return nil, fmt.Errorf("UserUploadedFileRepo - ClaimDueDeliveries - rows.Scan: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - ClaimDueDeliveries - rows.Err: failed to read deliveries", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - ClaimDueDeliveries - rows.Err: %w", err)
+	}
+	return deliveries, nil
 }
 
 func (r *UserUploadedFileRepo) GetPaginatedFiles(ctx context.Context, lastID, userID, limit int) ([]entity.UserUploadedFile, int, error) {
@@ -67,7 +920,7 @@ func (r *UserUploadedFileRepo) GetPaginatedFiles(ctx context.Context, lastID, us
 
 	// Build the SQL query using squirrel
 	sql, args, err := r.Builder.
-		Select("id", "name", "size", "content", "user_id", "created_at", "email_sent", "email_sent_at", "email_recipient", "error_message").
+		Select("id", "name", "size", "content_type", "checksum", "user_id", "delivery_id", "created_at", "expires_at", "expired_at", "email_sent", "email_sent_at", "email_recipient", "email_status", "error_message", "status").
 		From("user_uploaded_files").
 		Where("user_id = ?", userID).
 		Where("id > ?", lastID).
@@ -91,24 +944,121 @@ func (r *UserUploadedFileRepo) GetPaginatedFiles(ctx context.Context, lastID, us
 	var files []entity.UserUploadedFile
 	for rows.Next() {
 		var file entity.UserUploadedFile
-		err := rows.Scan(&file.ID, &file.Name, &file.Size, &file.Content, &file.UserID, &file.CreatedAt, &file.EmailSent, &file.EmailSentAt, &file.EmailRecipient, &file.ErrorMessage)
+		err := rows.Scan(&file.ID, &file.Name, &file.Size, &file.ContentType, &file.Checksum, &file.UserID, &file.DeliveryID, &file.CreatedAt, &file.ExpiresAt, &file.ExpiredAt, &file.EmailSent, &file.EmailSentAt, &file.EmailRecipient, &file.EmailStatus, &file.ErrorMessage, &file.Status)
 		if err != nil {
 			r.logger.Error("UserUploadedFileRepo - GetPaginatedFiles - rows.Scan: failed to scan user uploaded files query", "error", err)
 			return nil, totalRecords, fmt.Errorf("UserUploadedFileRepo - GetPaginatedFiles - rows.Scan: %w", err)
 		}
 		files = append(files, file)
 	}
+	rows.Close()
+
+	err = r.attachRecipientStatuses(ctx, files)
+	if err != nil {
+		return nil, totalRecords, fmt.Errorf("UserUploadedFileRepo - GetPaginatedFiles - r.attachRecipientStatuses: %w", err)
+	}
 
 	r.logger.Info("UserUploadedFileRepo - GetPaginatedFiles: successfully retrieved user uploaded files", "totalRecords", totalRecords)
 	return files, totalRecords, nil
 }
 
-func (r *UserUploadedFileRepo) UpdateEmailSent(ctx context.Context, ID int) error {
+// attachRecipientStatuses loads the delivery state reported for the recipients of the files in one query.
+func (r *UserUploadedFileRepo) attachRecipientStatuses(ctx context.Context, files []entity.UserUploadedFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	ids := make([]int, len(files))
+	index := make(map[int]int, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+		index[file.ID] = i
+	}
+
+	sql, args, err := r.Builder.
+		Select("user_uploaded_file_id", "recipient", "status", "reason", "updated_at").
+		From("email_recipient_statuses").
+		Where(squirrel.Eq{"user_uploaded_file_id": ids}).
+		OrderBy("user_uploaded_file_id ASC", "recipient ASC").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - attachRecipientStatuses - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - attachRecipientStatuses - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - attachRecipientStatuses - r.Pool.Query: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - attachRecipientStatuses - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fileID int
+		var status entity.RecipientStatus
+		err := rows.Scan(&fileID, &status.Recipient, &status.Status, &status.Reason, &status.UpdatedAt)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - attachRecipientStatuses - rows.Scan: failed to scan recipient status", "error", err)
+			return fmt.Errorf("UserUploadedFileRepo - attachRecipientStatuses - rows.Scan: %w", err)
+		}
+		i := index[fileID]
+		files[i].Recipients = append(files[i].Recipients, status)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - attachRecipientStatuses - rows.Err: failed to read recipient statuses", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - attachRecipientStatuses - rows.Err: %w", err)
+	}
+	return nil
+}
+
+// GetUsage reports what a user currently consumes of the upload quotas. Stored bytes are summed over
+// the blobs referenced by files, so shared content is counted once and unfinished uploads not at all.
+// Expired files no longer hold content and do not count against the file quota. Uploads are counted from
+// the upload log, so deleted files still count against the upload rate. Open upload sessions reserve their
+// declared size until they are finalised or expire.
+func (r *UserUploadedFileRepo) GetUsage(ctx context.Context, userID int) (entity.StorageUsage, error) {
+	usage, err := r.getUsage(ctx, r.Pool, userID)
+	if err != nil {
+		return entity.StorageUsage{}, fmt.Errorf("UserUploadedFileRepo - GetUsage - r.getUsage: %w", err)
+	}
+	return usage, nil
+}
+
+func (r *UserUploadedFileRepo) getUsage(ctx context.Context, q rowQuerier, userID int) (entity.StorageUsage, error) {
+	sql, args, err := r.Builder.
+		Select().
+		Column(squirrel.Expr("(SELECT COALESCE(SUM(size), 0) FROM file_blobs WHERE user_id = ? AND id IN (SELECT blob_id FROM user_uploaded_files WHERE user_id = ?))", userID, userID)).
+		Column(squirrel.Expr("(SELECT COUNT(id) FROM user_uploaded_files WHERE user_id = ? AND expired_at IS NULL)", userID)).
+		Column(squirrel.Expr("(SELECT COUNT(id) FROM file_uploads WHERE user_id = ? AND created_at > NOW() - INTERVAL '1 hour')", userID)).
+		Column(squirrel.Expr("(SELECT COALESCE(SUM(size), 0) FROM upload_sessions WHERE user_id = ? AND status = ? AND expires_at > NOW())", userID, entity.UploadSessionStatusOpen)).
+		Column(squirrel.Expr("(SELECT COUNT(id) FROM upload_sessions WHERE user_id = ? AND status = ? AND expires_at > NOW())", userID, entity.UploadSessionStatusOpen)).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - getUsage - r.Builder: failed to build query", "error", err)
+		return entity.StorageUsage{}, fmt.Errorf("UserUploadedFileRepo - getUsage - r.Builder: %w", err)
+	}
+
+	var usage entity.StorageUsage
+	err = q.QueryRow(ctx, sql, args...).Scan(&usage.BytesStored, &usage.FileCount, &usage.UploadsLastHour, &usage.BytesReserved, &usage.UploadSessions)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - getUsage - q.QueryRow: failed to execute query", "error", err)
+		return entity.StorageUsage{}, fmt.Errorf("UserUploadedFileRepo - getUsage - q.QueryRow: %w", err)
+	}
+
+	return usage, nil
+}
+
+func (r *UserUploadedFileRepo) UpdateEmailSent(ctx context.Context, ID int, messageID string) error {
 	// Build the SQL query using squirrel
 	sql, args, err := r.Builder.
 		Update("user_uploaded_files").
 		Set("email_sent", true).
 		Set("email_sent_at", "NOW()").
+		Set("message_id", messageID).
+		Set("email_status", entity.EmailStatusSent).
+		Set("email_state", entity.EmailStateSent).
+		Set("email_claimed_at", nil).
+		Set("email_failed_at", nil).
 		Where("id = ?", ID).
 		ToSql()
 
@@ -127,3 +1077,383 @@ func (r *UserUploadedFileRepo) UpdateEmailSent(ctx context.Context, ID int) erro
 	r.logger.Info("UserUploadedFileRepo - UpdateEmailSent: successfully updated user uploaded file", "userUploadedFileID", ID)
 	return nil
 }
+
+// ClaimEmail marks the email of a file as being sent. A file already sent, or claimed by another consumer
+// after staleBefore, is reported as a no rows error so a redelivered message does not send it again.
+func (r *UserUploadedFileRepo) ClaimEmail(ctx context.Context, ID int, now, staleBefore time.Time) error {
+	sql, args, err := r.Builder.
+		Update("user_uploaded_files").
+		Set("email_state", entity.EmailStateSending).
+		Set("email_claimed_at", now).
+		Where("id = ?", ID).
+		Where(squirrel.Or{
+			squirrel.Eq{"email_state": entity.EmailStateQueued},
+			squirrel.And{squirrel.Eq{"email_state": entity.EmailStateSending}, squirrel.Lt{"email_claimed_at": staleBefore}},
+		}).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ClaimEmail - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - ClaimEmail - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ClaimEmail - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - ClaimEmail - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("email already sent or being sent", "UserUploadedFileRepo - ClaimEmail - r.Pool.Exec: no rows affected")
+	}
+	return nil
+}
+
+// ReleaseEmail puts a claimed email back to queued after a failed attempt and records when it failed.
+func (r *UserUploadedFileRepo) ReleaseEmail(ctx context.Context, ID int) error {
+	sql, args, err := r.Builder.
+		Update("user_uploaded_files").
+		Set("email_state", entity.EmailStateQueued).
+		Set("email_claimed_at", nil).
+		Set("email_failed_at", squirrel.Expr("NOW()")).
+		Where("id = ?", ID).
+		Where("email_state = ?", entity.EmailStateSending).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ReleaseEmail - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - ReleaseEmail - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ReleaseEmail - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - ReleaseEmail - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+// RequeueEmail queues the email of a file of the user again, also when it has been sent, to new recipients
+// when some are given, and forgets the recipient statuses reported for the previous email. A file whose
+// email is being sent is reported as a no rows error.
+func (r *UserUploadedFileRepo) RequeueEmail(ctx context.Context, ID, userID int, recipients []string) error {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueEmail - r.Pool.Begin: failed to begin transaction", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueEmail - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	builder := r.Builder.
+		Update("user_uploaded_files").
+		Set("email_state", entity.EmailStateQueued).
+		Set("email_claimed_at", nil).
+		Where("id = ?", ID).
+		Where("user_id = ?", userID).
+		Where("email_state <> ?", entity.EmailStateSending)
+	if len(recipients) > 0 {
+		builder = builder.Set("email_recipient", strings.Join(recipients, ", "))
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueEmail - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueEmail - r.Builder: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueEmail - tx.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueEmail - tx.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("email being sent", "UserUploadedFileRepo - RequeueEmail - tx.Exec: no rows affected")
+	}
+
+	// the statuses reported for the previous email would otherwise show against the new one
+	sql, args, err = r.Builder.
+		Delete("email_recipient_statuses").
+		Where("user_uploaded_file_id = ?", ID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueEmail - r.Builder: failed to build recipient statuses query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueEmail - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueEmail - tx.Exec: failed to clear recipient statuses", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueEmail - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - RequeueEmail - tx.Commit: failed to commit transaction", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - RequeueEmail - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - RequeueEmail: successfully requeued email", "userUploadedFileID", ID)
+	return nil
+}
+
+// GetFailedEmails returns up to limit files sent on their own after lastID whose last attempt failed
+// between from and to and that have not been sent since. Quarantined and expired files are left out.
+func (r *UserUploadedFileRepo) GetFailedEmails(ctx context.Context, from, to time.Time, lastID, limit int) ([]entity.UserUploadedFile, error) {
+	sql, args, err := r.Builder.
+		Select("id", "name", "size", "content_type", "checksum", "COALESCE(blob_id, 0)", "user_id", "created_at", "expires_at", "email_recipient", "status").
+		From("user_uploaded_files").
+		Where("delivery_id IS NULL").
+		Where("email_state = ?", entity.EmailStateQueued).
+		Where(squirrel.NotEq{"status": []string{entity.FileStatusQuarantined, entity.FileStatusExpired}}).
+		Where("email_failed_at >= ?", from).
+		Where("email_failed_at < ?", to).
+		Where("id > ?", lastID).
+		OrderBy("id ASC").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetFailedEmails - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedEmails - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetFailedEmails - r.Pool.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedEmails - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var files []entity.UserUploadedFile
+	for rows.Next() {
+		var file entity.UserUploadedFile
+		err := rows.Scan(&file.ID, &file.Name, &file.Size, &file.ContentType, &file.Checksum, &file.BlobID, &file.UserID, &file.CreatedAt, &file.ExpiresAt, &file.EmailRecipient, &file.Status)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - GetFailedEmails - rows.Scan: failed to scan user uploaded file", "error", err)
+			return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedEmails - rows.Scan: %w", err)
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - GetFailedEmails - rows.Err: failed to read user uploaded files", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileRepo - GetFailedEmails - rows.Err: %w", err)
+	}
+	return files, nil
+}
+
+// CreateResend records that the user asked to send the email of a file again and returns the id of the
+// resend. The user is locked while the resends since the given time are counted and passed to admit, so
+// concurrent resends cannot exceed the limit. An error of admit records nothing and is returned.
+func (r *UserUploadedFileRepo) CreateResend(ctx context.Context, userID, userUploadedFileID int, since time.Time, admit func(resends int64) error) (int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - r.Pool.Begin: failed to begin transaction", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Select("user_id").
+		From("user_profiles").
+		Where("user_id = ?", userID).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - r.Builder: %w", err)
+	}
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - tx.Exec: failed to lock user", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - tx.Exec: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Select("COUNT(id)").
+		From("email_resends").
+		Where("user_id = ?", userID).
+		Where("created_at > ?", since).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - r.Builder: %w", err)
+	}
+	var resends int64
+	err = tx.QueryRow(ctx, sql, args...).Scan(&resends)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - tx.QueryRow: failed to count resends", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - tx.QueryRow: %w", err)
+	}
+	err = admit(resends)
+	if err != nil {
+		return 0, err
+	}
+
+	sql, args, err = r.Builder.
+		Insert("email_resends").
+		Columns("user_id", "user_uploaded_file_id").
+		Values(userID, userUploadedFileID).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - r.Builder: %w", err)
+	}
+	var resendID int
+	err = tx.QueryRow(ctx, sql, args...).Scan(&resendID)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - tx.QueryRow: failed to record resend", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - tx.QueryRow: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - CreateResend - tx.Commit: failed to commit transaction", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - CreateResend - tx.Commit: %w", err)
+	}
+	return resendID, nil
+}
+
+// DeleteResend forgets a resend whose email could not be queued, so it does not count against the limit.
+func (r *UserUploadedFileRepo) DeleteResend(ctx context.Context, resendID int) error {
+	sql, args, err := r.Builder.
+		Delete("email_resends").
+		Where("id = ?", resendID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - DeleteResend - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - DeleteResend - r.Builder: %w", err)
+	}
+
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - DeleteResend - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - DeleteResend - r.Pool.Exec: %w", err)
+	}
+	return nil
+}
+
+const (
+	// _worstRecipientStatusSQL picks the email status of a file from its recipients, a bounce or a
+	// complaint of one recipient outweighs the successful deliveries to the others.
+	_worstRecipientStatusSQL = "(SELECT s.status FROM email_recipient_statuses s WHERE s.user_uploaded_file_id = user_uploaded_files.id " +
+		"ORDER BY CASE s.status WHEN 'bounced' THEN 3 WHEN 'complained' THEN 2 ELSE 1 END DESC LIMIT 1)"
+	// _noBounceSQL keeps email_sent true until a recipient bounces.
+	_noBounceSQL = "NOT EXISTS (SELECT 1 FROM email_recipient_statuses s WHERE s.user_uploaded_file_id = user_uploaded_files.id AND s.status = 'bounced')"
+)
+
+// ApplyMailEvent records a delivery status callback for the recipient on every file sent with the email and
+// recomputes the email status of those files. An event older than the state already recorded for the
+// recipient is ignored, so callbacks arriving out of order do not overwrite newer ones. It returns the number
+// of files of the email, or a no rows error when no email with the message id was sent to the recipient.
+func (r *UserUploadedFileRepo) ApplyMailEvent(ctx context.Context, e entity.MailEvent) (int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - r.Pool.Begin: failed to begin transaction", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Select("id").
+		From("user_uploaded_files").
+		Where("message_id = ?", e.MessageID).
+		// the recipients are stored comma separated, a callback must not add a status for anyone else
+		Where("? = ANY(string_to_array(LOWER(REPLACE(email_recipient, ' ', '')), ','))", e.Recipient).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - r.Builder: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - tx.Query: failed to execute query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - tx.Query: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - rows.Scan: failed to scan file", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - rows.Scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - rows.Err: failed to read files", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - rows.Err: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, apperrors.NewNoRowsAffectedError("email not found", "UserUploadedFileRepo - ApplyMailEvent - tx.Query: no file with this message id and recipient")
+	}
+
+	for _, id := range ids {
+		sql, args, err = r.Builder.
+			Insert("email_recipient_statuses").
+			Columns("user_uploaded_file_id", "recipient", "status", "reason", "updated_at").
+			Values(id, e.Recipient, e.Type, e.Reason, e.OccurredAt).
+			Suffix("ON CONFLICT (user_uploaded_file_id, recipient) DO UPDATE SET status = EXCLUDED.status, reason = EXCLUDED.reason, updated_at = EXCLUDED.updated_at " +
+				"WHERE email_recipient_statuses.updated_at <= EXCLUDED.updated_at").
+			ToSql()
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - r.Builder: failed to build query", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - r.Builder: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, sql, args...)
+		if err != nil {
+			r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - tx.Exec: failed to record recipient status", "error", err)
+			return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - tx.Exec: %w", err)
+		}
+	}
+
+	sql, args, err = r.Builder.
+		Update("user_uploaded_files").
+		Set("email_status", squirrel.Expr(_worstRecipientStatusSQL)).
+		Set("email_sent", squirrel.Expr(_noBounceSQL)).
+		Where(squirrel.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - tx.Exec: failed to update email status", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - ApplyMailEvent - tx.Commit: failed to commit transaction", "error", err)
+		return 0, fmt.Errorf("UserUploadedFileRepo - ApplyMailEvent - tx.Commit: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - ApplyMailEvent: successfully applied mail event", "messageID", e.MessageID, "type", e.Type, "files", len(ids))
+	return len(ids), nil
+}
+
+func (r *UserUploadedFileRepo) UpdateStatus(ctx context.Context, ID int, status string, errorMessage *string) error {
+	// Build the SQL query using squirrel
+	sql, args, err := r.Builder.
+		Update("user_uploaded_files").
+		Set("status", status).
+		Set("error_message", errorMessage).
+		Where("id = ?", ID).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - UpdateStatus - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - UpdateStatus - r.Builder: %w", err)
+	}
+
+	// Execute the query using pgx
+	_, err = r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("UserUploadedFileRepo - UpdateStatus - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("UserUploadedFileRepo - UpdateStatus - r.Pool.Exec: %w", err)
+	}
+
+	r.logger.Info("UserUploadedFileRepo - UpdateStatus: successfully updated user uploaded file status", "userUploadedFileID", ID, "status", status)
+	return nil
+}
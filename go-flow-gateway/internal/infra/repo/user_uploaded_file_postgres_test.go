@@ -7,8 +7,10 @@ import (
 
 	"github.com/Masterminds/squirrel"
 	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/assert"
 )
@@ -36,6 +38,8 @@ func TestUserUploadedFile_Created(t *testing.T) {
 		userUploadedFile := entity.UserUploadedFile{
 			Name:           "test.txt",
 			Size:           123,
+			ContentType:    "text/plain",
+			Checksum:       "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
 			Content:        []byte("test"),
 			UserID:         123,
 			EmailSent:      false,
@@ -43,17 +47,97 @@ func TestUserUploadedFile_Created(t *testing.T) {
 		}
 
 		userUploadedFileID := 1
+		blobID := 2
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO file_blobs").
+			WithArgs(userUploadedFile.UserID, userUploadedFile.Checksum, userUploadedFile.Size, userUploadedFile.Content).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(blobID))
 		mock.ExpectQuery("INSERT INTO user_uploaded_files").
-			WithArgs(userUploadedFile.Name, userUploadedFile.Size, userUploadedFile.Content, userUploadedFile.UserID, userUploadedFile.EmailSent, userUploadedFile.EmailRecipient).
+			WithArgs(userUploadedFile.Name, userUploadedFile.Size, userUploadedFile.ContentType, userUploadedFile.Checksum, blobID, userUploadedFile.UserID, userUploadedFile.DeliveryID, userUploadedFile.ExpiresAt, userUploadedFile.EmailSent, userUploadedFile.EmailRecipient).
 			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(userUploadedFileID))
+		mock.ExpectExec("INSERT INTO file_uploads \\(user_id\\) VALUES \\(\\$1\\)").
+			WithArgs(userUploadedFile.UserID).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
 
 		// Act
-		returnedID, err := repo.Create(ctx, userUploadedFile)
+		returnedID, err := repo.Create(ctx, userUploadedFile, nil)
 
 		// Assert
 		assert.Equal(t, userUploadedFileID, returnedID, "The returned ID should match the expected value")
 		assert.NoError(t, err, "Error should not have occurred when creating a user uploaded file")
-		mock.ExpectationsWereMet()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should reference the stored blob of a duplicate upload", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		userUploadedFile := entity.UserUploadedFile{
+			Name:           "test.txt",
+			Size:           123,
+			ContentType:    "text/plain",
+			Checksum:       "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			BlobID:         2,
+			Content:        []byte("test"),
+			UserID:         123,
+			EmailRecipient: "test@mail.com",
+		}
+
+		userUploadedFileID := 1
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE file_blobs SET ref_count = ref_count \\+ 1").
+			WithArgs(userUploadedFile.BlobID, userUploadedFile.UserID).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(userUploadedFile.BlobID))
+		mock.ExpectQuery("INSERT INTO user_uploaded_files").
+			WithArgs(userUploadedFile.Name, userUploadedFile.Size, userUploadedFile.ContentType, userUploadedFile.Checksum, userUploadedFile.BlobID, userUploadedFile.UserID, userUploadedFile.DeliveryID, userUploadedFile.ExpiresAt, userUploadedFile.EmailSent, userUploadedFile.EmailRecipient).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(userUploadedFileID))
+		mock.ExpectExec("INSERT INTO file_uploads \\(user_id\\) VALUES \\(\\$1\\)").
+			WithArgs(userUploadedFile.UserID).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		// Act
+		returnedID, err := repo.Create(ctx, userUploadedFile, nil)
+
+		// Assert
+		assert.Equal(t, userUploadedFileID, returnedID, "The returned ID should match the expected value")
+		assert.NoError(t, err, "Error should not have occurred when creating a deduplicated user uploaded file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should check the quota on the usage read under the lock of the user", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		userUploadedFile := entity.UserUploadedFile{Name: "test.txt", Size: 4, Checksum: "checksum", Content: []byte("test"), UserID: 123}
+		usage := entity.StorageUsage{BytesStored: 2048, FileCount: 3, UploadsLastHour: 5}
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT user_id FROM user_profiles WHERE user_id = \\$1 FOR UPDATE").
+			WithArgs(123).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT (.+) FROM file_uploads WHERE user_id = \\$4").
+			WithArgs(123, 123, 123, 123, 123, entity.UploadSessionStatusOpen, 123, entity.UploadSessionStatusOpen).
+			WillReturnRows(mock.NewRows([]string{"bytes_stored", "file_count", "uploads_last_hour", "bytes_reserved", "upload_sessions"}).
+				AddRow(usage.BytesStored, usage.FileCount, usage.UploadsLastHour, usage.BytesReserved, usage.UploadSessions))
+		mock.ExpectRollback()
+
+		var checked entity.StorageUsage
+		admit := func(u entity.StorageUsage) error {
+			checked = u
+			return apperrors.NewQuotaExceededError(apperrors.QuotaUploadRateExceeded, "no more than 5 uploads per hour are allowed", "test")
+		}
+
+		// Act
+		_, err := repo.Create(ctx, userUploadedFile, admit)
+
+		// Assert
+		assert.True(t, apperrors.IsQuotaExceededError(err), "The rejection of the quota check should be returned")
+		assert.Equal(t, usage, checked, "The quota should be checked on the usage read in the transaction")
+		assert.NoError(t, mock.ExpectationsWereMet(), "Nothing should be stored")
 	})
 
 	t.Run("should return an error when creating a user uploaded file", func(t *testing.T) {
@@ -63,18 +147,116 @@ func TestUserUploadedFile_Created(t *testing.T) {
 
 		userUploadedFile := entity.UserUploadedFile{}
 
-		mock.ExpectExec("INSERT INTO user_uploaded_files").
-			WithArgs(userUploadedFile.Name, userUploadedFile.Size, userUploadedFile.Content, userUploadedFile.UserID, userUploadedFile.EmailSent).
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO file_blobs").
+			WithArgs(userUploadedFile.UserID, userUploadedFile.Checksum, userUploadedFile.Size, userUploadedFile.Content).
 			WillReturnError(assert.AnError)
+		mock.ExpectRollback()
 
 		// Act
-		_, err := repo.Create(ctx, userUploadedFile)
+		_, err := repo.Create(ctx, userUploadedFile, nil)
 
 		// Assert
 		assert.Error(t, err, "Error should have occurred when creating a user uploaded file")
-		mock.ExpectationsWereMet()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+}
+
+func TestUserUploadedFile_Delete(t *testing.T) {
+
+	t.Run("should delete the file and its last blob reference", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		id, userID, blobID := 1, 123, 2
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM user_uploaded_files").
+			WithArgs(id, userID).
+			WillReturnRows(mock.NewRows([]string{"blob_id"}).AddRow(blobID))
+		mock.ExpectQuery("UPDATE file_blobs SET ref_count = ref_count - 1").
+			WithArgs(blobID).
+			WillReturnRows(mock.NewRows([]string{"ref_count"}).AddRow(0))
+		mock.ExpectExec("DELETE FROM file_blobs").
+			WithArgs(blobID).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Delete(ctx, id, userID)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when deleting a user uploaded file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should keep a blob that is still referenced", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		id, userID, blobID := 1, 123, 2
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM user_uploaded_files").
+			WithArgs(id, userID).
+			WillReturnRows(mock.NewRows([]string{"blob_id"}).AddRow(blobID))
+		mock.ExpectQuery("UPDATE file_blobs SET ref_count = ref_count - 1").
+			WithArgs(blobID).
+			WillReturnRows(mock.NewRows([]string{"ref_count"}).AddRow(1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Delete(ctx, id, userID)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when deleting a user uploaded file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should delete the tombstone of an expired file without touching blobs", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		id, userID := 1, 123
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM user_uploaded_files").
+			WithArgs(id, userID).
+			WillReturnRows(mock.NewRows([]string{"blob_id"}).AddRow(0))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.Delete(ctx, id, userID)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when deleting an expired file")
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("should return a no rows error when the file does not exist", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		id, userID := 1, 123
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM user_uploaded_files").
+			WithArgs(id, userID).
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectRollback()
+
+		// Act
+		err := repo.Delete(ctx, id, userID)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have occurred when deleting a missing file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
 func TestUserUploadedFile_GetPaginatedFiles(t *testing.T) {
@@ -90,18 +272,24 @@ func TestUserUploadedFile_GetPaginatedFiles(t *testing.T) {
 
 		now := time.Now()
 		errorMessage := "test error message"
+		emailStatus := entity.EmailStatusBounced
+		reason := "550 mailbox does not exist"
 		userUploadedFiles := []entity.UserUploadedFile{
 			{
 				ID:             3,
 				Name:           "test.txt",
 				Size:           123,
-				Content:        []byte("test"),
+				ContentType:    "text/plain",
+				Checksum:       "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
 				UserID:         123,
 				CreatedAt:      &now,
 				EmailSent:      false,
 				EmailSentAt:    &now,
-				EmailRecipient: "",
+				EmailRecipient: "johndoe@email.com",
+				EmailStatus:    &emailStatus,
+				Recipients:     []entity.RecipientStatus{{Recipient: "johndoe@email.com", Status: entity.EmailStatusBounced, Reason: &reason, UpdatedAt: now}},
 				ErrorMessage:   &errorMessage,
+				Status:         entity.FileStatusPending,
 			},
 		}
 
@@ -111,8 +299,13 @@ func TestUserUploadedFile_GetPaginatedFiles(t *testing.T) {
 
 		mock.ExpectQuery("SELECT (.+) FROM user_uploaded_files").
 			WithArgs(userID, lastID).
-			WillReturnRows(mock.NewRows([]string{"id", "name", "size", "content", "user_id", "created_at", "email_sent", "email_sent_at", "email_recipient", "error_message"}).
-				AddRow(userUploadedFiles[0].ID, userUploadedFiles[0].Name, userUploadedFiles[0].Size, userUploadedFiles[0].Content, userUploadedFiles[0].UserID, userUploadedFiles[0].CreatedAt, userUploadedFiles[0].EmailSent, userUploadedFiles[0].EmailSentAt, userUploadedFiles[0].EmailRecipient, userUploadedFiles[0].ErrorMessage))
+			WillReturnRows(mock.NewRows([]string{"id", "name", "size", "content_type", "checksum", "user_id", "delivery_id", "created_at", "expires_at", "expired_at", "email_sent", "email_sent_at", "email_recipient", "email_status", "error_message", "status"}).
+				AddRow(userUploadedFiles[0].ID, userUploadedFiles[0].Name, userUploadedFiles[0].Size, userUploadedFiles[0].ContentType, userUploadedFiles[0].Checksum, userUploadedFiles[0].UserID, userUploadedFiles[0].DeliveryID, userUploadedFiles[0].CreatedAt, userUploadedFiles[0].ExpiresAt, userUploadedFiles[0].ExpiredAt, userUploadedFiles[0].EmailSent, userUploadedFiles[0].EmailSentAt, userUploadedFiles[0].EmailRecipient, userUploadedFiles[0].EmailStatus, userUploadedFiles[0].ErrorMessage, userUploadedFiles[0].Status))
+
+		mock.ExpectQuery("SELECT (.+) FROM email_recipient_statuses WHERE user_uploaded_file_id IN \\(\\$1\\)").
+			WithArgs(userUploadedFiles[0].ID).
+			WillReturnRows(mock.NewRows([]string{"user_uploaded_file_id", "recipient", "status", "reason", "updated_at"}).
+				AddRow(userUploadedFiles[0].ID, "johndoe@email.com", entity.EmailStatusBounced, &reason, now))
 
 		// Act
 		files, totalRecords, err := repo.GetPaginatedFiles(ctx, lastID, userID, limit)
@@ -125,6 +318,50 @@ func TestUserUploadedFile_GetPaginatedFiles(t *testing.T) {
 	})
 }
 
+func TestUserUploadedFile_GetUsage(t *testing.T) {
+
+	t.Run("should return the storage usage of a user", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		userID := 123
+		expected := entity.StorageUsage{BytesStored: 2048, FileCount: 3, UploadsLastHour: 1, BytesReserved: 512, UploadSessions: 1}
+
+		mock.ExpectQuery("SELECT \\(SELECT COALESCE\\(SUM\\(size\\), 0\\) FROM file_blobs WHERE user_id = \\$1 AND id IN").
+			WithArgs(userID, userID, userID, userID, userID, entity.UploadSessionStatusOpen, userID, entity.UploadSessionStatusOpen).
+			WillReturnRows(mock.NewRows([]string{"bytes_stored", "file_count", "uploads_last_hour", "bytes_reserved", "upload_sessions"}).
+				AddRow(expected.BytesStored, expected.FileCount, expected.UploadsLastHour, expected.BytesReserved, expected.UploadSessions))
+
+		// Act
+		usage, err := repo.GetUsage(ctx, userID)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when getting the storage usage")
+		assert.Equal(t, expected, usage, "The returned usage should match the expected usage")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should return an error when getting the storage usage", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		userID := 123
+
+		mock.ExpectQuery("SELECT (.+) FROM file_blobs").
+			WithArgs(userID, userID, userID, userID, userID, entity.UploadSessionStatusOpen, userID, entity.UploadSessionStatusOpen).
+			WillReturnError(assert.AnError)
+
+		// Act
+		_, err := repo.GetUsage(ctx, userID)
+
+		// Assert
+		assert.Error(t, err, "Error should have occurred when getting the storage usage")
+		mock.ExpectationsWereMet()
+	})
+}
+
 func TestUserUploadedFile_UpdateEmailSent(t *testing.T) {
 
 	t.Run("should update email sent", func(t *testing.T) {
@@ -136,12 +373,12 @@ func TestUserUploadedFile_UpdateEmailSent(t *testing.T) {
 		emailSentAt := "NOW()"
 		id := 123
 
-		mock.ExpectExec("UPDATE user_uploaded_files SET email_sent = \\$1, email_sent_at = \\$2").
-			WithArgs(emailSent, emailSentAt, id).
+		mock.ExpectExec("UPDATE user_uploaded_files SET email_sent = \\$1, email_sent_at = \\$2, message_id = \\$3, email_status = \\$4, email_state = \\$5, email_claimed_at = \\$6, email_failed_at = \\$7 WHERE id = \\$8").
+			WithArgs(emailSent, emailSentAt, "abc@mail.com", entity.EmailStatusSent, entity.EmailStateSent, nil, nil, id).
 			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
 		// Act
-		err := repo.UpdateEmailSent(ctx, id)
+		err := repo.UpdateEmailSent(ctx, id, "abc@mail.com")
 
 		// Assert
 		assert.NoError(t, err, "Error should not have occurred when updating email sent")
@@ -156,11 +393,11 @@ func TestUserUploadedFile_UpdateEmailSent(t *testing.T) {
 		id := 123
 
 		mock.ExpectExec("UPDATE user_uploaded_files SET").
-			WithArgs(id).
+			WithArgs(true, "NOW()", "abc@mail.com", entity.EmailStatusSent, entity.EmailStateSent, nil, nil, id).
 			WillReturnError(assert.AnError)
 
 		// Act
-		err := repo.UpdateEmailSent(ctx, id)
+		err := repo.UpdateEmailSent(ctx, id, "abc@mail.com")
 
 		// Assert
 		assert.Error(t, err, "Error should have occurred when updating email sent")
@@ -168,3 +405,732 @@ func TestUserUploadedFile_UpdateEmailSent(t *testing.T) {
 	})
 
 }
+
+func TestUserUploadedFile_ClaimEmail(t *testing.T) {
+
+	t.Run("should claim a queued email or a stale claim", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		now := time.Now()
+		staleBefore := now.Add(-10 * time.Minute)
+		mock.ExpectExec("UPDATE user_uploaded_files SET email_state = \\$1, email_claimed_at = \\$2 WHERE id = \\$3 AND \\(email_state = \\$4 OR \\(email_state = \\$5 AND email_claimed_at < \\$6\\)\\)").
+			WithArgs(entity.EmailStateSending, now, 123, entity.EmailStateQueued, entity.EmailStateSending, staleBefore).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.ClaimEmail(ctx, 123, now, staleBefore)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when claiming an email")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error when the email is sent or being sent", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		now := time.Now()
+		staleBefore := now.Add(-10 * time.Minute)
+		mock.ExpectExec("UPDATE user_uploaded_files SET").
+			WithArgs(entity.EmailStateSending, now, 123, entity.EmailStateQueued, entity.EmailStateSending, staleBefore).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		// Act
+		err := repo.ClaimEmail(ctx, 123, now, staleBefore)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_RequeueDelivery(t *testing.T) {
+
+	t.Run("should put a sent or failed delivery back to pending", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE deliveries SET status = \\$1, claimed_at = \\$2, error_message = \\$3, archive_password = \\$4, archive_sent_at = \\$5 WHERE id = \\$6 AND user_id = \\$7 AND status IN \\(\\$8,\\$9,\\$10\\)").
+			WithArgs(entity.DeliveryStatusPending, nil, nil, nil, nil, 7, 123, entity.DeliveryStatusPending, entity.DeliveryStatusSent, entity.DeliveryStatusFailed).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("DELETE FROM email_recipient_statuses WHERE user_uploaded_file_id IN \\(SELECT id FROM user_uploaded_files WHERE delivery_id = \\$1\\)").
+			WithArgs(7).
+			WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.RequeueDelivery(ctx, 7, 123, nil)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when requeuing a delivery")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should replace the recipients of the delivery and its files", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		recipients := []string{"johndoe@email.com", "janedoe@email.com"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE deliveries SET status = \\$1, claimed_at = \\$2, error_message = \\$3, archive_password = \\$4, archive_sent_at = \\$5, email_recipients = \\$6 WHERE id = \\$7").
+			WithArgs(entity.DeliveryStatusPending, nil, nil, nil, nil, recipients, 7, 123, entity.DeliveryStatusPending, entity.DeliveryStatusSent, entity.DeliveryStatusFailed).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE user_uploaded_files SET email_recipient = \\$1 WHERE delivery_id = \\$2").
+			WithArgs("johndoe@email.com, janedoe@email.com", 7).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+		mock.ExpectExec("DELETE FROM email_recipient_statuses WHERE user_uploaded_file_id IN \\(SELECT id FROM user_uploaded_files WHERE delivery_id = \\$1\\)").
+			WithArgs(7).
+			WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.RequeueDelivery(ctx, 7, 123, recipients)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when requeuing a delivery to new recipients")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error when the delivery is being sent", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE deliveries SET").
+			WithArgs(entity.DeliveryStatusPending, nil, nil, nil, nil, 7, 123, entity.DeliveryStatusPending, entity.DeliveryStatusSent, entity.DeliveryStatusFailed).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+		mock.ExpectRollback()
+
+		// Act
+		err := repo.RequeueDelivery(ctx, 7, 123, nil)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_RequeueEmail(t *testing.T) {
+
+	t.Run("should queue the email again and clear the statuses of the previous one", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_uploaded_files SET email_state = \\$1, email_claimed_at = \\$2 WHERE id = \\$3 AND user_id = \\$4 AND email_state <> \\$5").
+			WithArgs(entity.EmailStateQueued, nil, 1, 123, entity.EmailStateSending).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("DELETE FROM email_recipient_statuses WHERE user_uploaded_file_id = \\$1").
+			WithArgs(1).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		err := repo.RequeueEmail(ctx, 1, 123, nil)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when requeuing an email")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error when the email is being sent", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_uploaded_files SET").
+			WithArgs(entity.EmailStateQueued, nil, 1, 123, entity.EmailStateSending).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+		mock.ExpectRollback()
+
+		// Act
+		err := repo.RequeueEmail(ctx, 1, 123, nil)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_SetArchivePassword(t *testing.T) {
+
+	t.Run("should record the password of the archive of a delivery", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectExec("UPDATE deliveries SET archive_password = \\$1 WHERE id = \\$2").
+			WithArgs("secret", 7).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.SetArchivePassword(ctx, 7, "secret")
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when recording the archive password")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_MarkArchiveSent(t *testing.T) {
+
+	t.Run("should record that the archive of a delivery went out", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectExec("UPDATE deliveries SET archive_sent_at = NOW\\(\\) WHERE id = \\$1").
+			WithArgs(7).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.MarkArchiveSent(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when marking the archive sent")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_GetFailedEmails(t *testing.T) {
+
+	t.Run("should return the files whose email failed within the window", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		from := time.Now().Add(-24 * time.Hour)
+		to := time.Now()
+		createdAt := time.Now().Add(-48 * time.Hour)
+		rows := mock.NewRows([]string{"id", "name", "size", "content_type", "checksum", "blob_id", "user_id", "created_at", "expires_at", "email_recipient", "status"}).
+			AddRow(5, "report.pdf", int64(1024), "application/pdf", "abc", 9, 123, &createdAt, nil, "johndoe@email.com", entity.FileStatusClean)
+		mock.ExpectQuery("SELECT (.+) FROM user_uploaded_files WHERE delivery_id IS NULL AND email_state = \\$1 AND status NOT IN \\(\\$2,\\$3\\) AND email_failed_at >= \\$4 AND email_failed_at < \\$5 AND id > \\$6 ORDER BY id ASC LIMIT 100").
+			WithArgs(entity.EmailStateQueued, entity.FileStatusQuarantined, entity.FileStatusExpired, from, to, 0).
+			WillReturnRows(rows)
+
+		// Act
+		files, err := repo.GetFailedEmails(ctx, from, to, 0, 100)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when getting failed emails")
+		assert.Len(t, files, 1)
+		assert.Equal(t, 5, files[0].ID)
+		assert.Equal(t, 9, files[0].BlobID)
+		assert.Equal(t, "johndoe@email.com", files[0].EmailRecipient)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_CreateResend(t *testing.T) {
+
+	since := time.Now().Add(-time.Hour)
+
+	t.Run("should record the resend once the count of the locked user is admitted", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT user_id FROM user_profiles WHERE user_id = \\$1 FOR UPDATE").
+			WithArgs(123).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT COUNT\\(id\\) FROM email_resends WHERE user_id = \\$1 AND created_at > \\$2").
+			WithArgs(123, since).
+			WillReturnRows(mock.NewRows([]string{"count"}).AddRow(int64(2)))
+		mock.ExpectQuery("INSERT INTO email_resends \\(user_id,user_uploaded_file_id\\) VALUES \\(\\$1,\\$2\\) RETURNING id").
+			WithArgs(123, 1).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(5))
+		mock.ExpectCommit()
+
+		var admitted int64
+		admit := func(resends int64) error {
+			admitted = resends
+			return nil
+		}
+
+		// Act
+		resendID, err := repo.CreateResend(ctx, 123, 1, since, admit)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when recording a resend")
+		assert.Equal(t, 5, resendID)
+		assert.Equal(t, int64(2), admitted, "The resends of the user should have been passed to admit")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should record nothing when admit refuses the resend", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT user_id FROM user_profiles WHERE user_id = \\$1 FOR UPDATE").
+			WithArgs(123).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT COUNT\\(id\\) FROM email_resends").
+			WithArgs(123, since).
+			WillReturnRows(mock.NewRows([]string{"count"}).AddRow(int64(3)))
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.CreateResend(ctx, 123, 1, since, func(resends int64) error { return assert.AnError })
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError, "The error of admit should have been returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_DeleteResend(t *testing.T) {
+
+	t.Run("should delete the resend", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectExec("DELETE FROM email_resends WHERE id = \\$1").
+			WithArgs(5).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+		// Act
+		err := repo.DeleteResend(ctx, 5)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when deleting a resend")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_UpdateStatus(t *testing.T) {
+
+	t.Run("should update status", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		id := 123
+		reason := "malware detected: Eicar-Test-Signature"
+
+		mock.ExpectExec("UPDATE user_uploaded_files SET status = \\$1, error_message = \\$2").
+			WithArgs(entity.FileStatusQuarantined, &reason, id).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.UpdateStatus(ctx, id, entity.FileStatusQuarantined, &reason)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when updating status")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should return an error when updating status", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		id := 123
+
+		mock.ExpectExec("UPDATE user_uploaded_files SET").
+			WithArgs(id).
+			WillReturnError(assert.AnError)
+
+		// Act
+		err := repo.UpdateStatus(ctx, id, entity.FileStatusClean, nil)
+
+		// Assert
+		assert.Error(t, err, "Error should have occurred when updating status")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_CreateDelivery(t *testing.T) {
+
+	t.Run("should create a delivery with its files", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		recipients := []string{"johndoe@email.com", "janedoe@email.com"}
+		delivery := entity.Delivery{
+			UserID:          123,
+			EmailRecipients: recipients,
+			Status:          entity.DeliveryStatusPending,
+			Files: []entity.UserUploadedFile{
+				{Name: "test.txt", Size: 4, ContentType: "text/plain", Checksum: "checksum", Content: []byte("test"), UserID: 123, EmailRecipient: "johndoe@email.com, janedoe@email.com"},
+			},
+		}
+		deliveryID := 7
+		createdAt := time.Now()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO deliveries").
+			WithArgs(delivery.UserID, recipients, entity.DeliveryStatusPending, delivery.SendAt).
+			WillReturnRows(mock.NewRows([]string{"id", "created_at"}).AddRow(deliveryID, &createdAt))
+		mock.ExpectQuery("INSERT INTO file_blobs").
+			WithArgs(123, "checksum", int64(4), []byte("test")).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectQuery("INSERT INTO user_uploaded_files").
+			WithArgs("test.txt", int64(4), "text/plain", "checksum", 2, 123, &deliveryID, (*time.Time)(nil), false, "johndoe@email.com, janedoe@email.com").
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO file_uploads").
+			WithArgs(123).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		// Act
+		result, err := repo.CreateDelivery(ctx, delivery, nil)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when creating a delivery")
+		assert.Equal(t, deliveryID, result.ID, "The delivery ID should have been returned")
+		assert.Equal(t, 1, result.Files[0].ID, "The file ID should have been returned")
+		assert.Equal(t, deliveryID, *result.Files[0].DeliveryID, "The file should belong to the delivery")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should roll back when a file cannot be stored", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		delivery := entity.Delivery{
+			UserID:          123,
+			EmailRecipients: []string{"johndoe@email.com"},
+			Status:          entity.DeliveryStatusPending,
+			Files:           []entity.UserUploadedFile{{Name: "test.txt", Size: 4, Checksum: "checksum", Content: []byte("test"), UserID: 123}},
+		}
+		createdAt := time.Now()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO deliveries").
+			WithArgs(delivery.UserID, delivery.EmailRecipients, entity.DeliveryStatusPending, delivery.SendAt).
+			WillReturnRows(mock.NewRows([]string{"id", "created_at"}).AddRow(7, &createdAt))
+		mock.ExpectQuery("INSERT INTO file_blobs").
+			WithArgs(123, "checksum", int64(4), []byte("test")).
+			WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.CreateDelivery(ctx, delivery, nil)
+
+		// Assert
+		assert.Error(t, err, "Error should have occurred when creating a delivery")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_GetDelivery(t *testing.T) {
+
+	t.Run("should return a delivery with its files", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		deliveryID := 7
+		createdAt := time.Now()
+		recipients := []string{"johndoe@email.com"}
+
+		mock.ExpectQuery("SELECT (.+) FROM deliveries WHERE id = \\$1").
+			WithArgs(deliveryID).
+			WillReturnRows(mock.NewRows([]string{"id", "user_id", "email_recipients", "status", "send_at", "created_at", "email_sent", "email_sent_at", "error_message", "archive_password", "archive_sent_at"}).
+				AddRow(deliveryID, 123, recipients, entity.DeliveryStatusPending, (*time.Time)(nil), &createdAt, false, (*time.Time)(nil), (*string)(nil), (*string)(nil), (*time.Time)(nil)))
+		mock.ExpectQuery("SELECT (.+) FROM user_uploaded_files WHERE delivery_id = \\$1").
+			WithArgs(deliveryID).
+			WillReturnRows(mock.NewRows([]string{"id", "name", "size", "content_type", "checksum", "blob_id", "user_id", "delivery_id", "created_at", "expires_at", "email_recipient", "status"}).
+				AddRow(1, "test.txt", int64(4), "text/plain", "checksum", 2, 123, &deliveryID, &createdAt, &createdAt, "johndoe@email.com", entity.FileStatusPending))
+
+		// Act
+		result, err := repo.GetDelivery(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when getting a delivery")
+		assert.Equal(t, recipients, result.EmailRecipients, "The recipients should match")
+		assert.Len(t, result.Files, 1, "The delivery should contain one file")
+		assert.Equal(t, 2, result.Files[0].BlobID, "The blob of the file should be returned")
+		assert.Nil(t, result.Files[0].Content, "The content should not have been loaded")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should return a no rows error when the delivery does not exist", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectQuery("SELECT (.+) FROM deliveries").
+			WithArgs(7).
+			WillReturnError(pgx.ErrNoRows)
+
+		// Act
+		_, err := repo.GetDelivery(ctx, 7)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_GetBlobContent(t *testing.T) {
+
+	t.Run("should return the content of a blob", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectQuery("SELECT content FROM file_blobs WHERE id = \\$1").
+			WithArgs(2).
+			WillReturnRows(mock.NewRows([]string{"content"}).AddRow([]byte("test")))
+
+		// Act
+		content, err := repo.GetBlobContent(ctx, 2)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when getting the blob content")
+		assert.Equal(t, []byte("test"), content, "The content should match")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_ClaimDueDeliveries(t *testing.T) {
+
+	t.Run("should move the due deliveries to pending", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		now := time.Now()
+		staleBefore := now.Add(-5 * time.Minute)
+		sendAt := now.Add(-time.Minute)
+		recipients := []string{"johndoe@email.com"}
+
+		mock.ExpectQuery("UPDATE deliveries SET status = \\$1, publish_claimed_at = \\$2 WHERE id IN \\(SELECT id FROM deliveries WHERE \\(\\(status = \\$3 AND send_at <= \\$4\\) OR \\(status = \\$5 AND publish_claimed_at < \\$6\\)\\) ORDER BY send_at ASC LIMIT 100 FOR UPDATE SKIP LOCKED\\) RETURNING").
+			WithArgs(entity.DeliveryStatusPending, now, entity.DeliveryStatusScheduled, now, entity.DeliveryStatusPending, staleBefore).
+			WillReturnRows(mock.NewRows([]string{"id", "user_id", "email_recipients", "status", "send_at", "created_at"}).
+				AddRow(7, 123, recipients, entity.DeliveryStatusPending, &sendAt, &sendAt))
+
+		// Act
+		deliveries, err := repo.ClaimDueDeliveries(ctx, now, staleBefore, 100)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when claiming due deliveries")
+		assert.Len(t, deliveries, 1, "One delivery should have been claimed")
+		assert.Equal(t, 7, deliveries[0].ID, "The claimed delivery should be returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_MarkDeliveryPublished(t *testing.T) {
+
+	t.Run("should forget the claim of a published delivery", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectExec("UPDATE deliveries SET publish_claimed_at = \\$1 WHERE id = \\$2").
+			WithArgs(nil, 7).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.MarkDeliveryPublished(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when marking a delivery published")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_CancelDelivery(t *testing.T) {
+
+	t.Run("should cancel a scheduled delivery", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectExec("UPDATE deliveries SET status = \\$1 WHERE id = \\$2 AND user_id = \\$3 AND status = \\$4").
+			WithArgs(entity.DeliveryStatusCancelled, 7, 123, entity.DeliveryStatusScheduled).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.CancelDelivery(ctx, 7, 123)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when cancelling a delivery")
+		mock.ExpectationsWereMet()
+	})
+
+	t.Run("should return a no rows error when the delivery is no longer scheduled", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectExec("UPDATE deliveries SET").
+			WithArgs(entity.DeliveryStatusCancelled, 7, 123, entity.DeliveryStatusScheduled).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		// Act
+		err := repo.CancelDelivery(ctx, 7, 123)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_RescheduleDelivery(t *testing.T) {
+
+	t.Run("should move the send time of a scheduled delivery", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		sendAt := time.Now().Add(time.Hour)
+		mock.ExpectExec("UPDATE deliveries SET send_at = \\$1 WHERE id = \\$2 AND user_id = \\$3 AND status = \\$4").
+			WithArgs(sendAt, 7, 123, entity.DeliveryStatusScheduled).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		// Act
+		err := repo.RescheduleDelivery(ctx, 7, 123, sendAt)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when rescheduling a delivery")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_ExpireFiles(t *testing.T) {
+
+	t.Run("should keep a tombstone and release the content of expired files", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		now := time.Now()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, blob_id FROM user_uploaded_files WHERE expired_at IS NULL AND expires_at <= \\$1 ORDER BY expires_at ASC LIMIT 100 FOR UPDATE SKIP LOCKED").
+			WithArgs(now).
+			WillReturnRows(mock.NewRows([]string{"id", "blob_id"}).AddRow(1, 11))
+		mock.ExpectExec("UPDATE user_uploaded_files SET status = \\$1, expired_at = \\$2, blob_id = \\$3 WHERE id IN \\(\\$4\\)").
+			WithArgs(entity.FileStatusExpired, now, nil, 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectQuery("UPDATE file_blobs SET ref_count = ref_count - 1").
+			WithArgs(11).
+			WillReturnRows(mock.NewRows([]string{"ref_count"}).AddRow(0))
+		mock.ExpectExec("DELETE FROM file_blobs").
+			WithArgs(11).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		ids, err := repo.ExpireFiles(ctx, now, 100)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when expiring files")
+		assert.Equal(t, []int{1}, ids, "The expired file should be returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should do nothing when no file has expired", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		now := time.Now()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, blob_id FROM user_uploaded_files").
+			WithArgs(now).
+			WillReturnRows(mock.NewRows([]string{"id", "blob_id"}))
+		mock.ExpectRollback()
+
+		// Act
+		ids, err := repo.ExpireFiles(ctx, now, 100)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when no file has expired")
+		assert.Empty(t, ids, "No file should have been expired")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserUploadedFile_GetByID(t *testing.T) {
+
+	t.Run("should return a no rows error when the file does not belong to the user", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectQuery("SELECT (.+) FROM user_uploaded_files WHERE id = \\$1 AND user_id = \\$2").
+			WithArgs(1, 123).
+			WillReturnError(pgx.ErrNoRows)
+
+		// Act
+		_, err := repo.GetByID(ctx, 1, 123)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		mock.ExpectationsWereMet()
+	})
+}
+
+func TestUserUploadedFile_ApplyMailEvent(t *testing.T) {
+
+	occurredAt := time.Now()
+	reason := "550 mailbox does not exist"
+	event := entity.MailEvent{Type: entity.EmailStatusBounced, MessageID: "abc@mail.com", Recipient: "johndoe@email.com", Reason: &reason, OccurredAt: occurredAt}
+
+	t.Run("should record the recipient status on every file of the email", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM user_uploaded_files WHERE message_id = \\$1 AND \\$2 = ANY\\(string_to_array\\(LOWER\\(REPLACE\\(email_recipient, ' ', ''\\)\\), ','\\)\\) FOR UPDATE").
+			WithArgs(event.MessageID, event.Recipient).
+			WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		for _, id := range []int{1, 2} {
+			mock.ExpectExec("INSERT INTO email_recipient_statuses (.+) ON CONFLICT (.+) WHERE email_recipient_statuses.updated_at <= EXCLUDED.updated_at").
+				WithArgs(id, event.Recipient, event.Type, event.Reason, event.OccurredAt).
+				WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}
+		mock.ExpectExec("UPDATE user_uploaded_files SET email_status = (.+), email_sent = NOT EXISTS (.+) WHERE id IN \\(\\$1,\\$2\\)").
+			WithArgs(1, 2).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+		mock.ExpectCommit()
+
+		// Act
+		updated, err := repo.ApplyMailEvent(ctx, event)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when applying a mail event")
+		assert.Equal(t, 2, updated, "Both files of the email should have been updated")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return a no rows error when no email with the message id was sent to the recipient", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupUserUploadedFileRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM user_uploaded_files").
+			WithArgs(event.MessageID, event.Recipient).
+			WillReturnRows(mock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		// Act
+		_, err := repo.ApplyMailEvent(ctx, event)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have been returned")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
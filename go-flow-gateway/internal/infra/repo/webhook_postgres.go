@@ -0,0 +1,372 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+)
+
+type WebhookRepo struct {
+	*postgres.Postgres
+	logger logger.Logger
+}
+
+func NewWebhookRepo(pg *postgres.Postgres, l logger.Logger) *WebhookRepo {
+	return &WebhookRepo{Postgres: pg, logger: l}
+}
+
+func (r *WebhookRepo) CreateEndpoint(ctx context.Context, e entity.WebhookEndpoint) (entity.WebhookEndpoint, error) {
+	sql, args, err := r.Builder.
+		Insert("webhook_endpoints").
+		Columns("user_id", "url", "secret", "events", "enabled").
+		Values(e.UserID, e.URL, e.Secret, e.Events, e.Enabled).
+		Suffix("RETURNING id, created_at").
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - CreateEndpoint - r.Builder: failed to build query", "error", err)
+		return entity.WebhookEndpoint{}, fmt.Errorf("WebhookRepo - CreateEndpoint - r.Builder: %w", err)
+	}
+
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		r.logger.Error("WebhookRepo - CreateEndpoint - r.Pool.QueryRow: failed to execute query", "error", err)
+		return entity.WebhookEndpoint{}, fmt.Errorf("WebhookRepo - CreateEndpoint - r.Pool.QueryRow: %w", err)
+	}
+
+	r.logger.Info("WebhookRepo - CreateEndpoint: successfully created webhook endpoint", "endpointID", e.ID)
+	return e, nil
+}
+
+// GetEndpoints returns the endpoints of the user without their secrets.
+func (r *WebhookRepo) GetEndpoints(ctx context.Context, userID int) ([]entity.WebhookEndpoint, error) {
+	sql, args, err := r.Builder.
+		Select("id", "user_id", "url", "events", "enabled", "consecutive_failures", "disabled_at", "created_at").
+		From("webhook_endpoints").
+		Where("user_id = ?", userID).
+		OrderBy("id ASC").
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - GetEndpoints - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("WebhookRepo - GetEndpoints - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - GetEndpoints - r.Pool.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("WebhookRepo - GetEndpoints - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []entity.WebhookEndpoint{}
+	for rows.Next() {
+		var e entity.WebhookEndpoint
+		err := rows.Scan(&e.ID, &e.UserID, &e.URL, &e.Events, &e.Enabled, &e.ConsecutiveFailures, &e.DisabledAt, &e.CreatedAt)
+		if err != nil {
+			r.logger.Error("WebhookRepo - GetEndpoints - rows.Scan: failed to scan webhook endpoint", "error", err)
+			return nil, fmt.Errorf("WebhookRepo - GetEndpoints - rows.Scan: %w", err)
+		}
+		endpoints = append(endpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("WebhookRepo - GetEndpoints - rows.Err: failed to read webhook endpoints", "error", err)
+		return nil, fmt.Errorf("WebhookRepo - GetEndpoints - rows.Err: %w", err)
+	}
+	return endpoints, nil
+}
+
+func (r *WebhookRepo) EnableEndpoint(ctx context.Context, endpointID, userID int) error {
+	sql, args, err := r.Builder.
+		Update("webhook_endpoints").
+		Set("enabled", true).
+		Set("consecutive_failures", 0).
+		Set("disabled_at", nil).
+		Where("id = ?", endpointID).
+		Where("user_id = ?", userID).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - EnableEndpoint - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("WebhookRepo - EnableEndpoint - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - EnableEndpoint - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("WebhookRepo - EnableEndpoint - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("webhook endpoint not found", "WebhookRepo - EnableEndpoint - r.Pool.Exec: no rows affected")
+	}
+	return nil
+}
+
+// DeleteEndpoint deletes an endpoint of the user together with its delivery log.
+func (r *WebhookRepo) DeleteEndpoint(ctx context.Context, endpointID, userID int) error {
+	sql, args, err := r.Builder.
+		Delete("webhook_endpoints").
+		Where("id = ?", endpointID).
+		Where("user_id = ?", userID).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - DeleteEndpoint - r.Builder: failed to build query", "error", err)
+		return fmt.Errorf("WebhookRepo - DeleteEndpoint - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - DeleteEndpoint - r.Pool.Exec: failed to execute query", "error", err)
+		return fmt.Errorf("WebhookRepo - DeleteEndpoint - r.Pool.Exec: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperrors.NewNoRowsAffectedError("webhook endpoint not found", "WebhookRepo - DeleteEndpoint - r.Pool.Exec: no rows affected")
+	}
+	return nil
+}
+
+// GetPaginatedDeliveries returns the delivery log of an endpoint of the user, oldest first.
+func (r *WebhookRepo) GetPaginatedDeliveries(ctx context.Context, endpointID, userID, lastID, limit int) ([]entity.WebhookDelivery, int, error) {
+	var totalRecords int
+	countSql, countArgs, err := r.Builder.
+		Select("COUNT(d.id)").
+		From("webhook_deliveries d").
+		Join("webhook_endpoints e ON e.id = d.endpoint_id").
+		Where("d.endpoint_id = ?", endpointID).
+		Where("e.user_id = ?", userID).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - GetPaginatedDeliveries - r.Builder: failed to build total records query", "error", err)
+		return nil, 0, fmt.Errorf("WebhookRepo - GetPaginatedDeliveries - r.Builder: %w", err)
+	}
+
+	err = r.Pool.QueryRow(ctx, countSql, countArgs...).Scan(&totalRecords)
+	if err != nil {
+		r.logger.Error("WebhookRepo - GetPaginatedDeliveries - r.Pool.QueryRow: failed to execute total records query", "error", err)
+		return nil, 0, fmt.Errorf("WebhookRepo - GetPaginatedDeliveries - r.Pool.QueryRow: %w", err)
+	}
+
+	sql, args, err := r.Builder.
+		Select("d.id", "d.endpoint_id", "d.event_id", "d.event_type", "d.status", "d.attempts", "d.next_attempt_at", "d.last_status_code", "d.last_error", "d.created_at", "d.delivered_at").
+		From("webhook_deliveries d").
+		Join("webhook_endpoints e ON e.id = d.endpoint_id").
+		Where("d.endpoint_id = ?", endpointID).
+		Where("e.user_id = ?", userID).
+		Where("d.id > ?", lastID).
+		OrderBy("d.id ASC").
+		Limit(uint64(limit)).
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - GetPaginatedDeliveries - r.Builder: failed to build webhook deliveries query", "error", err)
+		return nil, totalRecords, fmt.Errorf("WebhookRepo - GetPaginatedDeliveries - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - GetPaginatedDeliveries - r.Pool.Query: failed to execute webhook deliveries query", "error", err)
+		return nil, totalRecords, fmt.Errorf("WebhookRepo - GetPaginatedDeliveries - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []entity.WebhookDelivery
+	for rows.Next() {
+		var d entity.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			r.logger.Error("WebhookRepo - GetPaginatedDeliveries - rows.Scan: failed to scan webhook delivery", "error", err)
+			return nil, totalRecords, fmt.Errorf("WebhookRepo - GetPaginatedDeliveries - rows.Scan: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("WebhookRepo - GetPaginatedDeliveries - rows.Err: failed to read webhook deliveries", "error", err)
+		return nil, totalRecords, fmt.Errorf("WebhookRepo - GetPaginatedDeliveries - rows.Err: %w", err)
+	}
+	return deliveries, totalRecords, nil
+}
+
+// CreateDeliveries queues the event for every enabled endpoint of the file owner subscribed to its type,
+// due right away. An event that has already been queued for an endpoint is not queued twice. It returns
+// the number of deliveries queued.
+func (r *WebhookRepo) CreateDeliveries(ctx context.Context, event entity.FileEvent, payload []byte) (int, error) {
+	// the select keeps ? placeholders so they are numbered together with the insert
+	endpoints := squirrel.
+		Select("id").
+		Column("?::varchar", event.ID).
+		Column("?::varchar", event.Type).
+		Column("?::jsonb", payload).
+		Column("NOW()").
+		From("webhook_endpoints").
+		Where("user_id = ?", event.File.UserID).
+		Where("enabled").
+		Where("? = ANY(events)", event.Type)
+
+	sql, args, err := r.Builder.
+		Insert("webhook_deliveries").
+		Columns("endpoint_id", "event_id", "event_type", "payload", "next_attempt_at").
+		Select(endpoints).
+		Suffix("ON CONFLICT (endpoint_id, event_id) DO NOTHING").
+		ToSql()
+
+	if err != nil {
+		r.logger.Error("WebhookRepo - CreateDeliveries - r.Builder: failed to build query", "error", err)
+		return 0, fmt.Errorf("WebhookRepo - CreateDeliveries - r.Builder: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - CreateDeliveries - r.Pool.Exec: failed to execute query", "error", err)
+		return 0, fmt.Errorf("WebhookRepo - CreateDeliveries - r.Pool.Exec: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries of enabled endpoints whose next attempt is due,
+// together with the URL and secret of their endpoint. Their next attempt is moved to leaseUntil, so other
+// dispatchers skip them while they are sent. Deliveries locked by another dispatcher are skipped as well.
+func (r *WebhookRepo) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	// the subquery keeps ? placeholders so they are numbered together with the outer statement
+	due := squirrel.
+		Select("d.id").
+		From("webhook_deliveries d").
+		Join("webhook_endpoints e ON e.id = d.endpoint_id").
+		Where("d.status = ?", entity.WebhookDeliveryPending).
+		Where("d.next_attempt_at <= ?", now).
+		Where("e.enabled").
+		OrderBy("d.next_attempt_at ASC").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE OF d SKIP LOCKED")
+
+	sql, args, err := r.Builder.
+		Update("webhook_deliveries").
+		Set("next_attempt_at", leaseUntil).
+		From("webhook_endpoints e").
+		Where("e.id = webhook_deliveries.endpoint_id").
+		Where(squirrel.Expr("webhook_deliveries.id IN (?)", due)).
+		Suffix("RETURNING webhook_deliveries.id, webhook_deliveries.endpoint_id, webhook_deliveries.event_id, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts, e.url, e.secret").
+		ToSql()
+	if err != nil {
+		r.logger.Error("WebhookRepo - ClaimDueDeliveries - r.Builder: failed to build query", "error", err)
+		return nil, fmt.Errorf("WebhookRepo - ClaimDueDeliveries - r.Builder: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - ClaimDueDeliveries - r.Pool.Query: failed to execute query", "error", err)
+		return nil, fmt.Errorf("WebhookRepo - ClaimDueDeliveries - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []entity.WebhookDelivery
+	for rows.Next() {
+		d := entity.WebhookDelivery{Status: entity.WebhookDeliveryPending}
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret)
+		if err != nil {
+			r.logger.Error("WebhookRepo - ClaimDueDeliveries - rows.Scan: failed to scan webhook delivery", "error", err)
+			return nil, fmt.Errorf("WebhookRepo - ClaimDueDeliveries - rows.Scan: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("WebhookRepo - ClaimDueDeliveries - rows.Err: failed to read webhook deliveries", "error", err)
+		return nil, fmt.Errorf("WebhookRepo - ClaimDueDeliveries - rows.Err: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt stores the outcome of an attempt on the delivery and keeps count of the consecutive failed
+// attempts of its endpoint. A success resets the count, and the endpoint is disabled once the count
+// reaches disableAfter. It reports whether the endpoint has been disabled by this attempt.
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, d entity.WebhookDelivery, disableAfter int) (bool, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - r.Pool.Begin: failed to begin transaction", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := r.Builder.
+		Select("enabled", "consecutive_failures").
+		From("webhook_endpoints").
+		Where("id = ?", d.EndpointID).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - r.Builder: failed to build query", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - r.Builder: %w", err)
+	}
+
+	var enabled bool
+	var failures int
+	err = tx.QueryRow(ctx, sql, args...).Scan(&enabled, &failures)
+	if err != nil {
+		if postgres.NewPGErrorChecker().IsNoRows(err) {
+			// the endpoint has been deleted together with its deliveries while the attempt was made
+			return false, nil
+		}
+		r.logger.Error("WebhookRepo - RecordAttempt - tx.QueryRow: failed to lock webhook endpoint", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - tx.QueryRow: %w", err)
+	}
+
+	sql, args, err = r.Builder.
+		Update("webhook_deliveries").
+		Set("status", d.Status).
+		Set("attempts", d.Attempts).
+		Set("next_attempt_at", d.NextAttemptAt).
+		Set("last_status_code", d.LastStatusCode).
+		Set("last_error", d.LastError).
+		Set("delivered_at", d.DeliveredAt).
+		Where("id = ?", d.ID).
+		ToSql()
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - r.Builder: failed to build query", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - tx.Exec: failed to update webhook delivery", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - tx.Exec: %w", err)
+	}
+
+	failures++
+	if d.Status == entity.WebhookDeliverySucceeded {
+		failures = 0
+	}
+	disable := enabled && disableAfter > 0 && failures >= disableAfter
+
+	update := r.Builder.
+		Update("webhook_endpoints").
+		Set("consecutive_failures", failures).
+		Where("id = ?", d.EndpointID)
+	if disable {
+		update = update.Set("enabled", false).Set("disabled_at", squirrel.Expr("NOW()"))
+	}
+	sql, args, err = update.ToSql()
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - r.Builder: failed to build query", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - r.Builder: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - tx.Exec: failed to update webhook endpoint", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - tx.Exec: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		r.logger.Error("WebhookRepo - RecordAttempt - tx.Commit: failed to commit transaction", "error", err)
+		return false, fmt.Errorf("WebhookRepo - RecordAttempt - tx.Commit: %w", err)
+	}
+	return disable, nil
+}
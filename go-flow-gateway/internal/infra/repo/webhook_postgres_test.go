@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/postgres"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupWebhookRepoTest(t *testing.T) (context.Context, pgxmock.PgxPoolIface, *WebhookRepo) {
+	t.Helper()
+
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err, "Error should not have occurred when opening a stub database connection")
+	defer mock.Close()
+
+	pg := &postgres.Postgres{Pool: mock, Builder: squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)}
+	repo := NewWebhookRepo(pg, logger.New("debug"))
+	return ctx, mock, repo
+}
+
+func TestWebhook_CreateEndpoint(t *testing.T) {
+
+	t.Run("should create a webhook endpoint", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupWebhookRepoTest(t)
+
+		now := time.Now()
+		endpoint := entity.WebhookEndpoint{UserID: 123, URL: "https://example.com/hook", Secret: "whsec_test", Events: []string{entity.FileEventCreated}, Enabled: true}
+
+		mock.ExpectQuery("INSERT INTO webhook_endpoints \\(user_id,url,secret,events,enabled\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5\\) RETURNING id, created_at").
+			WithArgs(endpoint.UserID, endpoint.URL, endpoint.Secret, endpoint.Events, endpoint.Enabled).
+			WillReturnRows(mock.NewRows([]string{"id", "created_at"}).AddRow(1, &now))
+
+		// Act
+		created, err := repo.CreateEndpoint(ctx, endpoint)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when creating a webhook endpoint")
+		assert.Equal(t, 1, created.ID)
+		assert.Equal(t, &now, created.CreatedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWebhook_DeleteEndpoint(t *testing.T) {
+
+	t.Run("should return a no rows error when the endpoint does not belong to the user", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupWebhookRepoTest(t)
+
+		mock.ExpectExec("DELETE FROM webhook_endpoints WHERE id = \\$1 AND user_id = \\$2").
+			WithArgs(1, 123).
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+		// Act
+		err := repo.DeleteEndpoint(ctx, 1, 123)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err), "A no rows error should have occurred when deleting a missing endpoint")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWebhook_CreateDeliveries(t *testing.T) {
+
+	t.Run("should queue the event for the subscribed endpoints", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupWebhookRepoTest(t)
+
+		event := entity.FileEvent{ID: "abc", Type: entity.FileEventEmailed, File: entity.UserUploadedFile{ID: 1, UserID: 123}}
+		payload := []byte(`{"id":"abc"}`)
+
+		mock.ExpectExec("INSERT INTO webhook_deliveries \\(endpoint_id,event_id,event_type,payload,next_attempt_at\\) "+
+			"SELECT id, \\$1::varchar, \\$2::varchar, \\$3::jsonb, NOW\\(\\) FROM webhook_endpoints WHERE user_id = \\$4 AND enabled AND \\$5 = ANY\\(events\\) "+
+			"ON CONFLICT \\(endpoint_id, event_id\\) DO NOTHING").
+			WithArgs(event.ID, event.Type, payload, 123, event.Type).
+			WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+		// Act
+		queued, err := repo.CreateDeliveries(ctx, event, payload)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when queueing webhook deliveries")
+		assert.Equal(t, 2, queued)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWebhook_ClaimDueDeliveries(t *testing.T) {
+
+	t.Run("should claim the due deliveries of enabled endpoints", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupWebhookRepoTest(t)
+
+		now := time.Now()
+		leaseUntil := now.Add(15 * time.Minute)
+		payload := []byte(`{"id":"abc"}`)
+
+		mock.ExpectQuery("UPDATE webhook_deliveries SET next_attempt_at = \\$1 FROM webhook_endpoints e WHERE e.id = webhook_deliveries.endpoint_id "+
+			"AND webhook_deliveries.id IN \\(SELECT d.id FROM webhook_deliveries d JOIN webhook_endpoints e ON e.id = d.endpoint_id "+
+			"WHERE d.status = \\$2 AND d.next_attempt_at <= \\$3 AND e.enabled ORDER BY d.next_attempt_at ASC LIMIT 50 FOR UPDATE OF d SKIP LOCKED\\) RETURNING").
+			WithArgs(leaseUntil, entity.WebhookDeliveryPending, now).
+			WillReturnRows(mock.NewRows([]string{"id", "endpoint_id", "event_id", "event_type", "payload", "attempts", "url", "secret"}).
+				AddRow(7, 1, "abc", entity.FileEventCreated, payload, 2, "https://example.com/hook", "whsec_test"))
+
+		// Act
+		deliveries, err := repo.ClaimDueDeliveries(ctx, now, leaseUntil, 50)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when claiming due webhook deliveries")
+		assert.Equal(t, []entity.WebhookDelivery{{ID: 7, EndpointID: 1, EventID: "abc", EventType: entity.FileEventCreated, Payload: payload, Status: entity.WebhookDeliveryPending, Attempts: 2, URL: "https://example.com/hook", Secret: "whsec_test"}}, deliveries)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWebhook_RecordAttempt(t *testing.T) {
+
+	lastError := "unexpected status code from webhook endpoint: 500"
+	statusCode := 500
+	next := time.Now().Add(time.Minute)
+	failed := entity.WebhookDelivery{ID: 7, EndpointID: 1, Status: entity.WebhookDeliveryPending, Attempts: 3, NextAttemptAt: &next, LastStatusCode: &statusCode, LastError: &lastError}
+
+	t.Run("should disable the endpoint once it failed too often", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupWebhookRepoTest(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT enabled, consecutive_failures FROM webhook_endpoints WHERE id = \\$1 FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(mock.NewRows([]string{"enabled", "consecutive_failures"}).AddRow(true, 4))
+		mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$1, attempts = \\$2, next_attempt_at = \\$3, last_status_code = \\$4, last_error = \\$5, delivered_at = \\$6 WHERE id = \\$7").
+			WithArgs(failed.Status, failed.Attempts, failed.NextAttemptAt, failed.LastStatusCode, failed.LastError, failed.DeliveredAt, failed.ID).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE webhook_endpoints SET consecutive_failures = \\$1, enabled = \\$2, disabled_at = NOW\\(\\) WHERE id = \\$3").
+			WithArgs(5, false, 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		disabled, err := repo.RecordAttempt(ctx, failed, 5)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when recording an attempt")
+		assert.True(t, disabled, "The endpoint should have been disabled")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should reset the failures of the endpoint on success", func(t *testing.T) {
+
+		// Arrange
+		ctx, mock, repo := setupWebhookRepoTest(t)
+
+		now := time.Now()
+		succeeded := entity.WebhookDelivery{ID: 7, EndpointID: 1, Status: entity.WebhookDeliverySucceeded, Attempts: 4, LastStatusCode: &statusCode, DeliveredAt: &now}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT enabled, consecutive_failures FROM webhook_endpoints").
+			WithArgs(1).
+			WillReturnRows(mock.NewRows([]string{"enabled", "consecutive_failures"}).AddRow(true, 3))
+		mock.ExpectExec("UPDATE webhook_deliveries SET").
+			WithArgs(succeeded.Status, succeeded.Attempts, succeeded.NextAttemptAt, succeeded.LastStatusCode, succeeded.LastError, succeeded.DeliveredAt, succeeded.ID).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE webhook_endpoints SET consecutive_failures = \\$1 WHERE id = \\$2").
+			WithArgs(0, 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		// Act
+		disabled, err := repo.RecordAttempt(ctx, succeeded, 5)
+
+		// Assert
+		assert.NoError(t, err, "Error should not have occurred when recording an attempt")
+		assert.False(t, disabled, "The endpoint should have stayed enabled")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
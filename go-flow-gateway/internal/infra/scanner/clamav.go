@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+const (
+	_defaultClamAVTimeout   = 30 * time.Second
+	_defaultClamAVChunkSize = 64 * 1024
+)
+
+// ClamAVScanner talks to a clamd daemon using the INSTREAM command of the
+// clamd TCP protocol.
+type ClamAVScanner struct {
+	address   string
+	timeout   time.Duration
+	chunkSize int
+	logger    logger.Logger
+}
+
+func NewClamAVScanner(address string, timeout time.Duration, l logger.Logger) *ClamAVScanner {
+	if timeout <= 0 {
+		timeout = _defaultClamAVTimeout
+	}
+	return &ClamAVScanner{address: address, timeout: timeout, chunkSize: _defaultClamAVChunkSize, logger: l}
+}
+
+func (s *ClamAVScanner) Scan(ctx context.Context, name string, content []byte) (dto.ScanResult, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return dto.ScanResult{}, fmt.Errorf("ClamAVScanner - Scan - dialer.DialContext: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return dto.ScanResult{}, fmt.Errorf("ClamAVScanner - Scan - conn.SetDeadline: %w", err)
+	}
+
+	if err := s.stream(conn, content); err != nil {
+		// clamd answers a stream over its size limit with an error and closes the connection
+		if reply, rerr := bufio.NewReader(conn).ReadString('\x00'); reply != "" {
+			s.logger.Warn("ClamAVScanner - Scan: clamd stopped reading the stream", "name", name, "error", err, "readError", rerr)
+			return parseClamAVReply(reply), nil
+		}
+		return dto.ScanResult{}, fmt.Errorf("ClamAVScanner - Scan - s.stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && reply == "" {
+		return dto.ScanResult{}, fmt.Errorf("ClamAVScanner - Scan - ReadString: %w", err)
+	}
+
+	result := parseClamAVReply(reply)
+	s.logger.Info("ClamAVScanner - Scan: file scanned", "name", name, "clean", result.Clean, "unscannable", result.Unscannable)
+	return result, nil
+}
+
+// stream sends the content with the INSTREAM command. Each chunk is prefixed with its length as a 4 byte
+// big-endian integer, a zero length chunk terminates the stream.
+func (s *ClamAVScanner) stream(conn net.Conn, content []byte) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	size := make([]byte, 4)
+	for offset := 0; offset < len(content); offset += s.chunkSize {
+		end := offset + s.chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		binary.BigEndian.PutUint32(size, uint32(end-offset))
+		if _, err := conn.Write(size); err != nil {
+			return err
+		}
+		if _, err := conn.Write(content[offset:end]); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	_, err := conn.Write(size)
+	return err
+}
+
+// parseClamAVReply understands the three reply shapes of clamd:
+// "stream: OK", "stream: <signature> FOUND" and "<message> ERROR".
+// An error or a reply it does not understand reports the file as unscannable.
+func parseClamAVReply(reply string) dto.ScanResult {
+	reply = strings.TrimRight(reply, "\x00\n")
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return dto.ScanResult{Clean: true}
+	case strings.HasSuffix(reply, " FOUND"):
+		return dto.ScanResult{Clean: false, Signature: strings.TrimSuffix(reply, " FOUND")}
+	case strings.HasSuffix(reply, " ERROR"):
+		return dto.ScanResult{Clean: false, Unscannable: strings.TrimSuffix(reply, " ERROR")}
+	default:
+		return dto.ScanResult{Clean: false, Unscannable: fmt.Sprintf("unexpected clamd reply: %q", reply)}
+	}
+}
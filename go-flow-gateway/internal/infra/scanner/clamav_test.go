@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// startStubClamd starts a minimal clamd that answers INSTREAM requests,
+// reporting the EICAR test string as infected and everything else as clean.
+func startStubClamd(t *testing.T, reply func(content []byte) string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start stub clamd: %s", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if _, err := r.ReadString('\x00'); err != nil {
+					return
+				}
+
+				var content bytes.Buffer
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+						return
+					}
+				}
+				conn.Write([]byte(reply(content.Bytes()) + "\x00"))
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func eicarReply(content []byte) string {
+	if bytes.Contains(content, []byte(eicar)) {
+		return "stream: Eicar-Test-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamAVScanner_Scan(t *testing.T) {
+
+	t.Run("should report a clean file", func(t *testing.T) {
+		// Arrange
+		addr := startStubClamd(t, eicarReply)
+		s := NewClamAVScanner(addr, time.Second, logger.New("debug"))
+
+		// Act
+		result, err := s.Scan(context.Background(), "test.txt", []byte("dummy file content"))
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, result.Clean)
+	})
+
+	t.Run("should report an infected file streamed over several chunks", func(t *testing.T) {
+		// Arrange
+		addr := startStubClamd(t, eicarReply)
+		s := NewClamAVScanner(addr, time.Second, logger.New("debug"))
+		s.chunkSize = 16
+
+		// Act
+		result, err := s.Scan(context.Background(), "eicar.com", []byte(eicar))
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, result.Clean)
+		assert.Equal(t, "Eicar-Test-Signature", result.Signature)
+	})
+
+	t.Run("should report a file clamd replies an error for as unscannable", func(t *testing.T) {
+		// Arrange
+		addr := startStubClamd(t, func([]byte) string { return "INSTREAM size limit exceeded. ERROR" })
+		s := NewClamAVScanner(addr, time.Second, logger.New("debug"))
+
+		// Act
+		result, err := s.Scan(context.Background(), "test.txt", []byte("dummy file content"))
+
+		// Assert
+		assert.NoError(t, err, "A file clamd refuses should not be retried")
+		assert.False(t, result.Clean)
+		assert.Equal(t, "INSTREAM size limit exceeded.", result.Unscannable)
+	})
+
+	t.Run("should read the reply of clamd when it stops reading the stream", func(t *testing.T) {
+		// Arrange
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			r.ReadString('\x00')
+			io.ReadFull(r, make([]byte, 4))
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+		}()
+		s := NewClamAVScanner(ln.Addr().String(), time.Second, logger.New("debug"))
+
+		// Act
+		result, err := s.Scan(context.Background(), "big.bin", make([]byte, 8<<20))
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, "INSTREAM size limit exceeded.", result.Unscannable)
+	})
+
+	t.Run("should return an error when clamd is unreachable", func(t *testing.T) {
+		// Arrange
+		s := NewClamAVScanner("127.0.0.1:1", time.Second, logger.New("debug"))
+
+		// Act
+		_, err := s.Scan(context.Background(), "test.txt", []byte("dummy file content"))
+
+		// Assert
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bgg/go-flow-gateway/config"
+	"github.com/bgg/go-flow-gateway/internal/usecase"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+const (
+	ProviderNone   = "none"
+	ProviderClamAV = "clamav"
+)
+
+// New builds the scanner selected in config.
+func New(cfg config.ScannerConfig, l logger.Logger) (usecase.FileScanner, error) {
+	switch cfg.Provider {
+	case ProviderNone, "":
+		return NewNoopScanner(l), nil
+	case ProviderClamAV:
+		return NewClamAVScanner(cfg.ClamAV.Address, cfg.ClamAV.Timeout, l), nil
+	default:
+		return nil, fmt.Errorf("scanner - New: unknown scanner provider %q", cfg.Provider)
+	}
+}
+
+// NoopScanner reports every file as clean. It is used when scanning is disabled.
+type NoopScanner struct {
+	logger logger.Logger
+}
+
+func NewNoopScanner(l logger.Logger) *NoopScanner {
+	return &NoopScanner{logger: l}
+}
+
+func (s *NoopScanner) Scan(ctx context.Context, name string, content []byte) (dto.ScanResult, error) {
+	s.logger.Debug("NoopScanner - Scan: scanning disabled, file treated as clean", "name", name)
+	return dto.ScanResult{Clean: true}, nil
+}
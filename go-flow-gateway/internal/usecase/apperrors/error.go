@@ -3,6 +3,8 @@ package apperrors
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type UniqueConstraintError struct {
@@ -52,3 +54,431 @@ func AsNoRowsAffectedError(err error) (*NoRowsAffectedError, bool) {
 	ok := errors.As(err, &nrae)
 	return nrae, ok
 }
+
+type FileQuarantinedError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *FileQuarantinedError) Error() string {
+	return e.Message
+}
+
+func NewFileQuarantinedError(msg string, loggingContext string, args ...interface{}) *FileQuarantinedError {
+	return &FileQuarantinedError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsFileQuarantinedError(err error) bool {
+	var fqe *FileQuarantinedError
+	return errors.As(err, &fqe)
+}
+
+func AsFileQuarantinedError(err error) (*FileQuarantinedError, bool) {
+	var fqe *FileQuarantinedError
+	ok := errors.As(err, &fqe)
+	return fqe, ok
+}
+
+// NothingDeliverableError reports that every file of a delivery was withheld, it wraps the reason of each file.
+type NothingDeliverableError struct {
+	Reasons        []error
+	LoggingContext string
+}
+
+func (e *NothingDeliverableError) Error() string {
+	reasons := make([]string, len(e.Reasons))
+	for i, reason := range e.Reasons {
+		reasons[i] = reason.Error()
+	}
+	return "no file of the delivery could be delivered: " + strings.Join(reasons, "; ")
+}
+
+func (e *NothingDeliverableError) Unwrap() []error {
+	return e.Reasons
+}
+
+func NewNothingDeliverableError(reasons []error, loggingContext string) *NothingDeliverableError {
+	return &NothingDeliverableError{Reasons: reasons, LoggingContext: loggingContext}
+}
+
+func IsNothingDeliverableError(err error) bool {
+	var nde *NothingDeliverableError
+	return errors.As(err, &nde)
+}
+
+type ChecksumMismatchError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return e.Message
+}
+
+func NewChecksumMismatchError(msg string, loggingContext string, args ...interface{}) *ChecksumMismatchError {
+	return &ChecksumMismatchError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsChecksumMismatchError(err error) bool {
+	var cme *ChecksumMismatchError
+	return errors.As(err, &cme)
+}
+
+const (
+	UploadPolicyContentTypeNotAllowed = "content_type_not_allowed"
+	UploadPolicyExtensionBlocked      = "extension_blocked"
+	UploadPolicyFileTooLarge          = "file_too_large"
+	UploadPolicyTooManyFiles          = "too_many_files"
+	UploadPolicyInvalidExpiry         = "invalid_expiry"
+)
+
+type UploadPolicyViolationError struct {
+	Reason         string
+	Message        string
+	LoggingContext string
+}
+
+func (e *UploadPolicyViolationError) Error() string {
+	return e.Message
+}
+
+func NewUploadPolicyViolationError(reason string, msg string, loggingContext string, args ...interface{}) *UploadPolicyViolationError {
+	return &UploadPolicyViolationError{Reason: reason, Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsUploadPolicyViolationError(err error) bool {
+	var upve *UploadPolicyViolationError
+	return errors.As(err, &upve)
+}
+
+func AsUploadPolicyViolationError(err error) (*UploadPolicyViolationError, bool) {
+	var upve *UploadPolicyViolationError
+	ok := errors.As(err, &upve)
+	return upve, ok
+}
+
+const (
+	QuotaStorageExceeded        = "storage_quota_exceeded"
+	QuotaFileCountExceeded      = "file_count_quota_exceeded"
+	QuotaUploadRateExceeded     = "upload_rate_exceeded"
+	QuotaResendRateExceeded     = "resend_rate_exceeded"
+	QuotaUploadSessionsExceeded = "upload_sessions_exceeded"
+)
+
+type QuotaExceededError struct {
+	Reason         string
+	Message        string
+	LoggingContext string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.Message
+}
+
+func NewQuotaExceededError(reason string, msg string, loggingContext string, args ...interface{}) *QuotaExceededError {
+	return &QuotaExceededError{Reason: reason, Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsQuotaExceededError(err error) bool {
+	var qee *QuotaExceededError
+	return errors.As(err, &qee)
+}
+
+func AsQuotaExceededError(err error) (*QuotaExceededError, bool) {
+	var qee *QuotaExceededError
+	ok := errors.As(err, &qee)
+	return qee, ok
+}
+
+type UploadOffsetMismatchError struct {
+	Offset         int64
+	Message        string
+	LoggingContext string
+}
+
+func (e *UploadOffsetMismatchError) Error() string {
+	return e.Message
+}
+
+func NewUploadOffsetMismatchError(offset int64, msg string, loggingContext string, args ...interface{}) *UploadOffsetMismatchError {
+	return &UploadOffsetMismatchError{Offset: offset, Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsUploadOffsetMismatchError(err error) bool {
+	var uome *UploadOffsetMismatchError
+	return errors.As(err, &uome)
+}
+
+func AsUploadOffsetMismatchError(err error) (*UploadOffsetMismatchError, bool) {
+	var uome *UploadOffsetMismatchError
+	ok := errors.As(err, &uome)
+	return uome, ok
+}
+
+type UploadIncompleteError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *UploadIncompleteError) Error() string {
+	return e.Message
+}
+
+func NewUploadIncompleteError(msg string, loggingContext string, args ...interface{}) *UploadIncompleteError {
+	return &UploadIncompleteError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsUploadIncompleteError(err error) bool {
+	var uie *UploadIncompleteError
+	return errors.As(err, &uie)
+}
+
+func AsUploadIncompleteError(err error) (*UploadIncompleteError, bool) {
+	var uie *UploadIncompleteError
+	ok := errors.As(err, &uie)
+	return uie, ok
+}
+
+type FileExpiredError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *FileExpiredError) Error() string {
+	return e.Message
+}
+
+func NewFileExpiredError(msg string, loggingContext string, args ...interface{}) *FileExpiredError {
+	return &FileExpiredError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsFileExpiredError(err error) bool {
+	var fee *FileExpiredError
+	return errors.As(err, &fee)
+}
+
+type EmailInProgressError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *EmailInProgressError) Error() string {
+	return e.Message
+}
+
+func NewEmailInProgressError(msg string, loggingContext string, args ...interface{}) *EmailInProgressError {
+	return &EmailInProgressError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsEmailInProgressError(err error) bool {
+	var eipe *EmailInProgressError
+	return errors.As(err, &eipe)
+}
+
+const (
+	PasswordTooShort         = "password_too_short"
+	PasswordTooLong          = "password_too_long"
+	PasswordMissingUpper     = "password_missing_upper"
+	PasswordMissingLower     = "password_missing_lower"
+	PasswordMissingDigit     = "password_missing_digit"
+	PasswordMissingSymbol    = "password_missing_symbol"
+	PasswordContainsUsername = "password_contains_username"
+	PasswordTooWeak          = "password_too_weak"
+	PasswordBreached         = "password_breached"
+)
+
+// PasswordViolation is one rule of the password policy that a password breaks.
+type PasswordViolation struct {
+	Reason  string
+	Message string
+}
+
+type PasswordPolicyViolationError struct {
+	Field          string
+	Violations     []PasswordViolation
+	LoggingContext string
+}
+
+func (e *PasswordPolicyViolationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func NewPasswordPolicyViolationError(field string, violations []PasswordViolation, loggingContext string) *PasswordPolicyViolationError {
+	return &PasswordPolicyViolationError{Field: field, Violations: violations, LoggingContext: loggingContext}
+}
+
+func IsPasswordPolicyViolationError(err error) bool {
+	var ppve *PasswordPolicyViolationError
+	return errors.As(err, &ppve)
+}
+
+func AsPasswordPolicyViolationError(err error) (*PasswordPolicyViolationError, bool) {
+	var ppve *PasswordPolicyViolationError
+	ok := errors.As(err, &ppve)
+	return ppve, ok
+}
+
+type InvalidCredentialsError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *InvalidCredentialsError) Error() string {
+	return e.Message
+}
+
+func NewInvalidCredentialsError(msg string, loggingContext string, args ...interface{}) *InvalidCredentialsError {
+	return &InvalidCredentialsError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsInvalidCredentialsError(err error) bool {
+	var ice *InvalidCredentialsError
+	return errors.As(err, &ice)
+}
+
+type LoginThrottledError struct {
+	RetryAfter     time.Duration
+	Message        string
+	LoggingContext string
+}
+
+func (e *LoginThrottledError) Error() string {
+	return e.Message
+}
+
+func NewLoginThrottledError(retryAfter time.Duration, msg string, loggingContext string, args ...interface{}) *LoginThrottledError {
+	return &LoginThrottledError{RetryAfter: retryAfter, Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsLoginThrottledError(err error) bool {
+	var lte *LoginThrottledError
+	return errors.As(err, &lte)
+}
+
+func AsLoginThrottledError(err error) (*LoginThrottledError, bool) {
+	var lte *LoginThrottledError
+	ok := errors.As(err, &lte)
+	return lte, ok
+}
+
+type EmailNotVerifiedError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *EmailNotVerifiedError) Error() string {
+	return e.Message
+}
+
+func NewEmailNotVerifiedError(msg string, loggingContext string, args ...interface{}) *EmailNotVerifiedError {
+	return &EmailNotVerifiedError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsEmailNotVerifiedError(err error) bool {
+	var enve *EmailNotVerifiedError
+	return errors.As(err, &enve)
+}
+
+type EmailAlreadyVerifiedError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *EmailAlreadyVerifiedError) Error() string {
+	return e.Message
+}
+
+func NewEmailAlreadyVerifiedError(msg string, loggingContext string, args ...interface{}) *EmailAlreadyVerifiedError {
+	return &EmailAlreadyVerifiedError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsEmailAlreadyVerifiedError(err error) bool {
+	var eave *EmailAlreadyVerifiedError
+	return errors.As(err, &eave)
+}
+
+// RetryLaterError is returned when an action was repeated sooner than allowed.
+type RetryLaterError struct {
+	RetryAfter     time.Duration
+	Message        string
+	LoggingContext string
+}
+
+func (e *RetryLaterError) Error() string {
+	return e.Message
+}
+
+func NewRetryLaterError(retryAfter time.Duration, msg string, loggingContext string, args ...interface{}) *RetryLaterError {
+	return &RetryLaterError{RetryAfter: retryAfter, Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsRetryLaterError(err error) bool {
+	var rle *RetryLaterError
+	return errors.As(err, &rle)
+}
+
+func AsRetryLaterError(err error) (*RetryLaterError, bool) {
+	var rle *RetryLaterError
+	ok := errors.As(err, &rle)
+	return rle, ok
+}
+
+type TwoFactorAlreadyEnabledError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *TwoFactorAlreadyEnabledError) Error() string {
+	return e.Message
+}
+
+func NewTwoFactorAlreadyEnabledError(msg string, loggingContext string, args ...interface{}) *TwoFactorAlreadyEnabledError {
+	return &TwoFactorAlreadyEnabledError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsTwoFactorAlreadyEnabledError(err error) bool {
+	var tfae *TwoFactorAlreadyEnabledError
+	return errors.As(err, &tfae)
+}
+
+// InvalidTwoFactorCodeError is returned when neither a TOTP code nor an unused recovery code matches.
+type InvalidTwoFactorCodeError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *InvalidTwoFactorCodeError) Error() string {
+	return e.Message
+}
+
+func NewInvalidTwoFactorCodeError(msg string, loggingContext string, args ...interface{}) *InvalidTwoFactorCodeError {
+	return &InvalidTwoFactorCodeError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsInvalidTwoFactorCodeError(err error) bool {
+	var itfce *InvalidTwoFactorCodeError
+	return errors.As(err, &itfce)
+}
+
+// InvalidWebhookURLError is returned when a webhook endpoint is registered with a URL it may not use.
+type InvalidWebhookURLError struct {
+	Message        string
+	LoggingContext string
+}
+
+func (e *InvalidWebhookURLError) Error() string {
+	return e.Message
+}
+
+func NewInvalidWebhookURLError(msg string, loggingContext string, args ...interface{}) *InvalidWebhookURLError {
+	return &InvalidWebhookURLError{Message: fmt.Sprintf(msg, args...), LoggingContext: loggingContext}
+}
+
+func IsInvalidWebhookURLError(err error) bool {
+	var iwue *InvalidWebhookURLError
+	return errors.As(err, &iwue)
+}
@@ -0,0 +1,12 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Checksum returns the hex encoded SHA-256 of the content.
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
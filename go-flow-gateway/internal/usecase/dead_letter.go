@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// DeadLetterUseCase lets operators inspect the events whose consumer failed and replay or purge them.
+type DeadLetterUseCase struct {
+	store  DeadLetterStore
+	logger logger.Logger
+}
+
+func NewDeadLetterUseCase(s DeadLetterStore, l logger.Logger) *DeadLetterUseCase {
+	return &DeadLetterUseCase{store: s, logger: l}
+}
+
+func (uc *DeadLetterUseCase) List(ctx context.Context, limit int) ([]entity.DeadLetter, error) {
+	letters, err := uc.store.List(ctx, limit)
+	if err != nil {
+		uc.logger.Error("DeadLetterUseCase - List - store.List : error listing dead letters", "error", err)
+		return nil, fmt.Errorf("DeadLetterUseCase - List - s.store.List: %w", err)
+	}
+	return letters, nil
+}
+
+func (uc *DeadLetterUseCase) Get(ctx context.Context, id string) (entity.DeadLetter, error) {
+	letter, err := uc.store.Get(ctx, id)
+	if err != nil {
+		uc.logger.Error("DeadLetterUseCase - Get - store.Get : error getting dead letter", "error", err, "id", id)
+		return entity.DeadLetter{}, fmt.Errorf("DeadLetterUseCase - Get - s.store.Get: %w", err)
+	}
+	return letter, nil
+}
+
+// Replay publishes the dead letters with the given IDs again, it returns how many were found.
+func (uc *DeadLetterUseCase) Replay(ctx context.Context, ids []string) (int, error) {
+	replayed, err := uc.store.Replay(ctx, ids)
+	if err != nil {
+		uc.logger.Error("DeadLetterUseCase - Replay - store.Replay : error replaying dead letters", "error", err, "replayed", replayed)
+		return replayed, fmt.Errorf("DeadLetterUseCase - Replay - s.store.Replay: %w", err)
+	}
+
+	uc.logger.Info("DeadLetterUseCase - Replay : dead letters replayed", "requested", len(ids), "replayed", replayed)
+	return replayed, nil
+}
+
+// Purge removes the dead letters that failed before the given time.
+func (uc *DeadLetterUseCase) Purge(ctx context.Context, before time.Time) (int, error) {
+	purged, err := uc.store.Purge(ctx, before)
+	if err != nil {
+		uc.logger.Error("DeadLetterUseCase - Purge - store.Purge : error purging dead letters", "error", err, "purged", purged)
+		return purged, fmt.Errorf("DeadLetterUseCase - Purge - s.store.Purge: %w", err)
+	}
+
+	uc.logger.Info("DeadLetterUseCase - Purge : dead letters purged", "before", before, "purged", purged)
+	return purged, nil
+}
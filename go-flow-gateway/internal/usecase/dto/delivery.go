@@ -0,0 +1,9 @@
+package dto
+
+// DeliveryFileResult reports the outcome of one file of a batch upload
+type DeliveryFileResult struct {
+	Name  string `json:"name" example:"report.pdf"`
+	ID    int    `json:"id,omitempty" example:"1"`                   // Set when the file has been accepted
+	Code  string `json:"code,omitempty" example:"extension_blocked"` // Set when the file has been rejected
+	Error string `json:"error,omitempty" example:"files with extension .exe are not allowed"`
+}
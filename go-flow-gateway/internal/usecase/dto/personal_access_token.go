@@ -0,0 +1,9 @@
+package dto
+
+import "github.com/bgg/go-flow-gateway/internal/entity"
+
+// CreatedPersonalAccessToken is a new personal access token together with the token itself, shown only once
+type CreatedPersonalAccessToken struct {
+	Token string `json:"token" example:"gfg_pat_3q2-7wAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"` // Sent as "Authorization: Bearer <token>"
+	entity.PersonalAccessToken
+}
@@ -0,0 +1,8 @@
+package dto
+
+// RequeueResult reports what a bulk requeue of failed emails queued again
+type RequeueResult struct {
+	Files      int `json:"files" example:"3"`      // Files sent on their own
+	Deliveries int `json:"deliveries" example:"1"` // Deliveries, each sending all of its files
+	Skipped    int `json:"skipped" example:"0"`    // Emails being sent in the meantime
+}
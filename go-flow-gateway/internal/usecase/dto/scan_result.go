@@ -0,0 +1,8 @@
+package dto
+
+// ScanResult is the verdict of a content scanner for a single file
+type ScanResult struct {
+	Clean       bool   `json:"clean"`
+	Signature   string `json:"signature,omitempty"`   // Name of the detected threat when the file is not clean
+	Unscannable string `json:"unscannable,omitempty"` // Why the scanner refused to check the file, such as a size limit
+}
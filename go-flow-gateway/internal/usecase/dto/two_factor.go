@@ -0,0 +1,9 @@
+package dto
+
+// TOTPEnrollment is what an authenticator app needs to add the account, shown once when two-factor
+// authentication is being enabled
+type TOTPEnrollment struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`                                                         // For apps where the secret is typed in
+	OTPAuthURI string `json:"otpauthUri" example:"otpauth://totp/GoFlowGatewayApp:hank?issuer=GoFlowGatewayApp&secret=JBSWY3DPEHPK3PXP"` // For apps opening the link
+	QRPayload  string `json:"qrPayload" example:"otpauth://totp/GoFlowGatewayApp:hank?issuer=GoFlowGatewayApp&secret=JBSWY3DPEHPK3PXP"`  // Text to encode in the QR code scanned by the app
+}
@@ -0,0 +1,16 @@
+package dto
+
+// QuotaUsage reports the consumption of a single quota, a limit of 0 means unlimited
+type QuotaUsage struct {
+	Used  int64 `json:"used" example:"1024"`
+	Limit int64 `json:"limit" example:"104857600"`
+}
+
+// UserUsage reports the consumption of every upload quota of a user
+type UserUsage struct {
+	BytesStored    QuotaUsage `json:"bytesStored"`
+	FileCount      QuotaUsage `json:"fileCount"`
+	UploadsPerHour QuotaUsage `json:"uploadsPerHour"`
+	BytesReserved  int64      `json:"bytesReserved" example:"2048"` // declared by open upload sessions, counted against bytesStored
+	UploadSessions QuotaUsage `json:"uploadSessions"`
+}
@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// EmailVerificationPolicy configures how users prove that they own the email of their account.
+type EmailVerificationPolicy struct {
+	TokenTTL         time.Duration // How long a verification link works
+	ResendInterval   time.Duration // Shortest time between two verification emails to a user
+	RequiredToUpload bool          // Refuse uploads from local accounts whose email is not verified
+	VerifyURL        string        // Target of the link, the token is added as its token query parameter
+}
+
+type EmailVerificationUseCase struct {
+	repo           EmailVerificationRepo
+	userCredential UserCredentialRepo
+	mailer         AccountMailer
+	policy         EmailVerificationPolicy
+	logger         logger.Logger
+}
+
+func NewEmailVerificationUseCase(repo EmailVerificationRepo, userCredential UserCredentialRepo, mailer AccountMailer, policy EmailVerificationPolicy, l logger.Logger) *EmailVerificationUseCase {
+	return &EmailVerificationUseCase{repo: repo, userCredential: userCredential, mailer: mailer, policy: policy, logger: l}
+}
+
+// Send emails a new verification link for the email of the credential, the earlier links stop working.
+func (uc *EmailVerificationUseCase) Send(ctx context.Context, u entity.UserCredential) error {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		uc.logger.Error("EmailVerificationUseCase - Send - newToken : error generating token", "error", err)
+		return fmt.Errorf("EmailVerificationUseCase - Send - newToken: %w", err)
+	}
+
+	v := entity.EmailVerification{
+		UserID:    u.UserID,
+		Email:     u.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(uc.policy.TokenTTL),
+	}
+	err = uc.repo.Create(ctx, v)
+	if err != nil {
+		uc.logger.Error("EmailVerificationUseCase - Send - repo.Create : error creating email verification", "error", err, "userID", u.UserID)
+		return fmt.Errorf("EmailVerificationUseCase - Send - repo.Create: %w", err)
+	}
+
+	link := uc.policy.VerifyURL + "?token=" + url.QueryEscape(token)
+	err = uc.mailer.SendEmailVerification(ctx, u.Email, u.Username, link, v.ExpiresAt)
+	if err != nil {
+		uc.logger.Error("EmailVerificationUseCase - Send - mailer.SendEmailVerification : error sending verification email", "error", err, "userID", u.UserID)
+		return fmt.Errorf("EmailVerificationUseCase - Send - mailer.SendEmailVerification: %w", err)
+	}
+
+	uc.logger.Info("EmailVerificationUseCase - Send : verification email sent", "userID", u.UserID)
+	return nil
+}
+
+// Resend emails a new verification link to a user whose email is not verified yet, at most once per
+// resend interval.
+func (uc *EmailVerificationUseCase) Resend(ctx context.Context, userID int) error {
+	u, err := uc.userCredential.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("EmailVerificationUseCase - Resend - userCredential.GetByUserID: %w", err)
+	}
+	if u.Email == "" {
+		return apperrors.NewNoRowsAffectedError("the account has no email to verify", "EmailVerificationUseCase - Resend")
+	}
+	if u.EmailVerified {
+		return apperrors.NewEmailAlreadyVerifiedError("the email is already verified", "EmailVerificationUseCase - Resend")
+	}
+
+	latest, err := uc.repo.GetLatest(ctx, userID)
+	if err != nil && !apperrors.IsNoRowsAffectedError(err) {
+		uc.logger.Error("EmailVerificationUseCase - Resend - repo.GetLatest : error getting latest verification", "error", err, "userID", userID)
+		return fmt.Errorf("EmailVerificationUseCase - Resend - repo.GetLatest: %w", err)
+	}
+	if err == nil {
+		if wait := latest.CreatedAt.Add(uc.policy.ResendInterval).Sub(time.Now()); wait > 0 {
+			return apperrors.NewRetryLaterError(wait, "a verification email was sent recently, try again later", "EmailVerificationUseCase - Resend")
+		}
+	}
+
+	return uc.Send(ctx, u)
+}
+
+// Verify uses up a verification token and marks the email it was sent to as verified.
+func (uc *EmailVerificationUseCase) Verify(ctx context.Context, token string) error {
+	v, err := uc.repo.Consume(ctx, hashToken(token), time.Now())
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Warn("EmailVerificationUseCase - Verify : invalid or expired token")
+		} else {
+			uc.logger.Error("EmailVerificationUseCase - Verify - repo.Consume : error consuming verification", "error", err)
+		}
+		return fmt.Errorf("EmailVerificationUseCase - Verify - repo.Consume: %w", err)
+	}
+
+	uc.logger.Info("EmailVerificationUseCase - Verify : email verified", "userID", v.UserID)
+	return nil
+}
+
+// CheckUploadAllowed refuses uploads from local accounts whose email is not verified when the policy
+// requires it. Users signed up through an OAuth provider have no credential and are always allowed.
+func (uc *EmailVerificationUseCase) CheckUploadAllowed(ctx context.Context, userID int) error {
+	if !uc.policy.RequiredToUpload {
+		return nil
+	}
+
+	u, err := uc.userCredential.GetByUserID(ctx, userID)
+	if apperrors.IsNoRowsAffectedError(err) {
+		return nil
+	}
+	if err != nil {
+		uc.logger.Error("EmailVerificationUseCase - CheckUploadAllowed - userCredential.GetByUserID : error getting user credential", "error", err, "userID", userID)
+		return fmt.Errorf("EmailVerificationUseCase - CheckUploadAllowed - userCredential.GetByUserID: %w", err)
+	}
+
+	if !u.EmailVerified {
+		return apperrors.NewEmailNotVerifiedError("verify your email before uploading files", "EmailVerificationUseCase - CheckUploadAllowed")
+	}
+	return nil
+}
+
+// newToken returns a random URL-safe token and the hash under which it is stored.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEmailVerificationRepo struct {
+	mock.Mock
+}
+
+func (m *MockEmailVerificationRepo) Create(ctx context.Context, v entity.EmailVerification) error {
+	args := m.Called(ctx, v)
+	return args.Error(0)
+}
+
+func (m *MockEmailVerificationRepo) GetLatest(ctx context.Context, userID int) (entity.EmailVerification, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(entity.EmailVerification), args.Error(1)
+}
+
+func (m *MockEmailVerificationRepo) Consume(ctx context.Context, tokenHash string, now time.Time) (entity.EmailVerification, error) {
+	args := m.Called(ctx, tokenHash, now)
+	return args.Get(0).(entity.EmailVerification), args.Error(1)
+}
+
+type MockAccountMailer struct {
+	mock.Mock
+}
+
+func (m *MockAccountMailer) SendEmailVerification(ctx context.Context, to, username, link string, expiresAt time.Time) error {
+	args := m.Called(ctx, to, username, link, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAccountMailer) SendPasswordReset(ctx context.Context, to, username, link string, expiresAt time.Time) error {
+	args := m.Called(ctx, to, username, link, expiresAt)
+	return args.Error(0)
+}
+
+func setupEmailVerificationUseCase(t *testing.T, policy EmailVerificationPolicy) (*EmailVerificationUseCase, *MockEmailVerificationRepo, *MockUserCredentialRepo, *MockAccountMailer) {
+	t.Helper()
+	mockRepo := new(MockEmailVerificationRepo)
+	mockCredentialRepo := new(MockUserCredentialRepo)
+	mockMailer := new(MockAccountMailer)
+	uc := NewEmailVerificationUseCase(mockRepo, mockCredentialRepo, mockMailer, policy, logger.New("debug"))
+	return uc, mockRepo, mockCredentialRepo, mockMailer
+}
+
+func TestEmailVerificationUseCase_Send(t *testing.T) {
+
+	policy := EmailVerificationPolicy{TokenTTL: 24 * time.Hour, VerifyURL: "http://localhost:8080/api/v1/auth/verify-email"}
+	u := entity.UserCredential{UserID: 7, Username: "hank", Email: "hank@mail.com"}
+
+	t.Run("stores the hash of the token and emails the token", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockMailer := setupEmailVerificationUseCase(t, policy)
+		ctx := context.Background()
+
+		var stored entity.EmailVerification
+		mockRepo.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(entity.EmailVerification)
+		}).Return(nil)
+		var link string
+		mockMailer.On("SendEmailVerification", ctx, u.Email, u.Username, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			link = args.String(3)
+		}).Return(nil)
+
+		// Act
+		err := uc.Send(ctx, u)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(link, policy.VerifyURL+"?token="))
+		token := strings.TrimPrefix(link, policy.VerifyURL+"?token=")
+		assert.Equal(t, hashToken(token), stored.TokenHash)
+		assert.NotContains(t, stored.TokenHash, token)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), stored.ExpiresAt, time.Minute)
+	})
+}
+
+func TestEmailVerificationUseCase_Resend(t *testing.T) {
+
+	policy := EmailVerificationPolicy{TokenTTL: time.Hour, ResendInterval: time.Minute}
+
+	t.Run("refuses to resend too soon", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockCredentialRepo, mockMailer := setupEmailVerificationUseCase(t, policy)
+		ctx := context.Background()
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Email: "hank@mail.com"}, nil)
+		mockRepo.On("GetLatest", ctx, 7).Return(entity.EmailVerification{CreatedAt: time.Now().Add(-20 * time.Second)}, nil)
+
+		// Act
+		err := uc.Resend(ctx, 7)
+
+		// Assert
+		rle, ok := apperrors.AsRetryLaterError(err)
+		assert.True(t, ok)
+		assert.InDelta(t, 40*time.Second, rle.RetryAfter, float64(time.Second))
+		mockMailer.AssertNotCalled(t, "SendEmailVerification", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("refuses to resend to a verified email", func(t *testing.T) {
+		// Arrange
+		uc, _, mockCredentialRepo, _ := setupEmailVerificationUseCase(t, policy)
+		ctx := context.Background()
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Email: "hank@mail.com", EmailVerified: true}, nil)
+
+		// Act
+		err := uc.Resend(ctx, 7)
+
+		// Assert
+		assert.True(t, apperrors.IsEmailAlreadyVerifiedError(err))
+	})
+
+	t.Run("sends a new link once the interval has passed", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockCredentialRepo, mockMailer := setupEmailVerificationUseCase(t, policy)
+		ctx := context.Background()
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Email: "hank@mail.com"}, nil)
+		mockRepo.On("GetLatest", ctx, 7).Return(entity.EmailVerification{}, apperrors.NewNoRowsAffectedError("test", "test"))
+		mockRepo.On("Create", ctx, mock.Anything).Return(nil)
+		mockMailer.On("SendEmailVerification", ctx, "hank@mail.com", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		// Act
+		err := uc.Resend(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		mockMailer.AssertExpectations(t)
+	})
+}
+
+func TestEmailVerificationUseCase_Verify(t *testing.T) {
+
+	t.Run("consumes the token by its hash", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _ := setupEmailVerificationUseCase(t, EmailVerificationPolicy{})
+		ctx := context.Background()
+		mockRepo.On("Consume", ctx, hashToken("token"), mock.Anything).Return(entity.EmailVerification{UserID: 7}, nil)
+
+		// Act
+		err := uc.Verify(ctx, "token")
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("an invalid token is not found", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _ := setupEmailVerificationUseCase(t, EmailVerificationPolicy{})
+		ctx := context.Background()
+		mockRepo.On("Consume", ctx, mock.Anything, mock.Anything).Return(entity.EmailVerification{}, apperrors.NewNoRowsAffectedError("test", "test"))
+
+		// Act
+		err := uc.Verify(ctx, "token")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+	})
+}
+
+func TestEmailVerificationUseCase_CheckUploadAllowed(t *testing.T) {
+
+	required := EmailVerificationPolicy{RequiredToUpload: true}
+
+	tests := []struct {
+		name       string
+		credential entity.UserCredential
+		err        error
+		expected   func(error) bool
+	}{
+		{"allows a verified account", entity.UserCredential{EmailVerified: true}, nil, func(err error) bool { return err == nil }},
+		{"refuses an unverified account", entity.UserCredential{}, nil, apperrors.IsEmailNotVerifiedError},
+		{"allows users without a local account", entity.UserCredential{}, apperrors.NewNoRowsAffectedError("test", "test"), func(err error) bool { return err == nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			uc, _, mockCredentialRepo, _ := setupEmailVerificationUseCase(t, required)
+			ctx := context.Background()
+			mockCredentialRepo.On("GetByUserID", ctx, 7).Return(tt.credential, tt.err)
+
+			// Act
+			err := uc.CheckUploadAllowed(ctx, 7)
+
+			// Assert
+			assert.True(t, tt.expected(err), "unexpected error %v", err)
+		})
+	}
+
+	t.Run("allows everyone when verification is not required", func(t *testing.T) {
+		uc, _, mockCredentialRepo, _ := setupEmailVerificationUseCase(t, EmailVerificationPolicy{})
+
+		assert.NoError(t, uc.CheckUploadAllowed(context.Background(), 7))
+		mockCredentialRepo.AssertNotCalled(t, "GetByUserID", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// _fileStatusBufferSize is the number of events a subscriber can lag behind before events are dropped.
+const _fileStatusBufferSize = 16
+
+// FileStatusUseCase fans the status transitions of files out to the streams opened by their owners
+// on this instance.
+type FileStatusUseCase struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan entity.FileEvent]struct{}
+	logger      logger.Logger
+}
+
+func NewFileStatusUseCase(l logger.Logger) *FileStatusUseCase {
+	return &FileStatusUseCase{subscribers: make(map[int]map[chan entity.FileEvent]struct{}), logger: l}
+}
+
+// Subscribe returns the events about the files of the user, the channel is closed once ctx is done.
+func (uc *FileStatusUseCase) Subscribe(ctx context.Context, userID int) <-chan entity.FileEvent {
+	ch := make(chan entity.FileEvent, _fileStatusBufferSize)
+
+	uc.mu.Lock()
+	if uc.subscribers[userID] == nil {
+		uc.subscribers[userID] = make(map[chan entity.FileEvent]struct{})
+	}
+	uc.subscribers[userID][ch] = struct{}{}
+	uc.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		uc.mu.Lock()
+		delete(uc.subscribers[userID], ch)
+		if len(uc.subscribers[userID]) == 0 {
+			delete(uc.subscribers, userID)
+		}
+		uc.mu.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Notify passes the event to the subscribers of the owner of the file. A subscriber that does not keep
+// up misses the event rather than blocking the others.
+func (uc *FileStatusUseCase) Notify(ctx context.Context, event entity.FileEvent) {
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+
+	for ch := range uc.subscribers[event.File.UserID] {
+		select {
+		case ch <- event:
+		default:
+			uc.logger.Warn("FileStatusUseCase - Notify : subscriber is too slow, dropping event", "userID", event.File.UserID, "eventID", event.ID)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStatusUseCase_Notify(t *testing.T) {
+
+	t.Run("should only pass the event to the subscribers of the owner", func(t *testing.T) {
+		// Arrange
+		uc := NewFileStatusUseCase(logger.New("debug"))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		owner := uc.Subscribe(ctx, 1)
+		other := uc.Subscribe(ctx, 2)
+		event := entity.FileEvent{ID: "evt", Type: entity.FileEventScanning, File: entity.UserUploadedFile{ID: 10, UserID: 1}}
+
+		// Act
+		uc.Notify(context.Background(), event)
+
+		// Assert
+		select {
+		case got := <-owner:
+			assert.Equal(t, event, got)
+		case <-time.After(time.Second):
+			t.Fatal("The owner should have received the event")
+		}
+		assert.Len(t, other, 0, "Other users should not receive the event")
+	})
+
+	t.Run("should drop events for a subscriber that does not keep up", func(t *testing.T) {
+		// Arrange
+		uc := NewFileStatusUseCase(logger.New("debug"))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := uc.Subscribe(ctx, 1)
+		event := entity.FileEvent{File: entity.UserUploadedFile{UserID: 1}}
+
+		// Act
+		for i := 0; i < _fileStatusBufferSize+5; i++ {
+			uc.Notify(context.Background(), event)
+		}
+
+		// Assert
+		assert.Len(t, ch, _fileStatusBufferSize)
+	})
+
+	t.Run("should close the channel and forget the subscriber once the context is done", func(t *testing.T) {
+		// Arrange
+		uc := NewFileStatusUseCase(logger.New("debug"))
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := uc.Subscribe(ctx, 1)
+
+		// Act
+		cancel()
+
+		// Assert
+		select {
+		case _, ok := <-ch:
+			assert.False(t, ok, "The channel should have been closed")
+		case <-time.After(time.Second):
+			t.Fatal("The channel should have been closed")
+		}
+		uc.mu.RLock()
+		defer uc.mu.RUnlock()
+		assert.Empty(t, uc.subscribers)
+	})
+}
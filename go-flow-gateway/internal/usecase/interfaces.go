@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
 	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
@@ -20,25 +21,150 @@ type UserProfileRepo interface {
 type UserUploadedFile interface {
 	Create(ctx context.Context, userUploadedFile entity.UserUploadedFile) (entity.UserUploadedFile, error)
 	SendEmail(ctx context.Context, userUploadedFile entity.UserUploadedFile) error
+	Resend(ctx context.Context, userUploadedFileID, userID int, recipients []string) error
+	RequeueFailed(ctx context.Context, from, to time.Time) (dto.RequeueResult, error)
+	CreateDelivery(ctx context.Context, delivery entity.Delivery) (entity.Delivery, []dto.DeliveryFileResult, error)
+	SendDeliveryEmail(ctx context.Context, deliveryID int) error
+	RescheduleDelivery(ctx context.Context, deliveryID, userID int, sendAt time.Time) error
+	CancelDelivery(ctx context.Context, deliveryID, userID int) error
+	PublishDueDeliveries(ctx context.Context) error
 	GetPaginatedFiles(ctx context.Context, lastID, userID, limit int) ([]entity.UserUploadedFile, int, error)
+	Download(ctx context.Context, userUploadedFileID, userID int) (entity.UserUploadedFile, error)
+	Delete(ctx context.Context, userUploadedFileID, userID int) error
+	PurgeExpiredFiles(ctx context.Context) error
+	HandleMailEvents(ctx context.Context, events []entity.MailEvent) error
+	GetUsage(ctx context.Context, userID int) (dto.UserUsage, error)
 }
 
 type UserUploadedFileRepo interface {
-	Create(ctx context.Context, userUploadedFile entity.UserUploadedFile) (int, error)
+	// Create stores the file. A non-nil admit is called with the usage of the user, read under a lock held
+	// until the file is stored, and rejects the file by returning an error.
+	Create(ctx context.Context, userUploadedFile entity.UserUploadedFile, admit func(usage entity.StorageUsage) error) (int, error)
+	GetBlobIDByChecksum(ctx context.Context, userID int, checksum string) (int, error)
+	GetByID(ctx context.Context, userUploadedFileID, userID int) (entity.UserUploadedFile, error)
+	Delete(ctx context.Context, userUploadedFileID, userID int) error
+	ExpireFiles(ctx context.Context, now time.Time, limit int) ([]int, error)
+	// CreateDelivery stores the delivery. A non-nil admit is called like for Create and returns the files of
+	// the delivery to store.
+	CreateDelivery(ctx context.Context, delivery entity.Delivery, admit func(usage entity.StorageUsage) ([]entity.UserUploadedFile, error)) (entity.Delivery, error)
+	GetDelivery(ctx context.Context, deliveryID int) (entity.Delivery, error)
+	GetBlobContent(ctx context.Context, blobID int) ([]byte, error)
+	UpdateDeliveryStatus(ctx context.Context, deliveryID int, status string, errorMessage *string) error
+	SetArchivePassword(ctx context.Context, deliveryID int, password string) error
+	MarkArchiveSent(ctx context.Context, deliveryID int) error
+	RescheduleDelivery(ctx context.Context, deliveryID, userID int, sendAt time.Time) error
+	CancelDelivery(ctx context.Context, deliveryID, userID int) error
+	ClaimDueDeliveries(ctx context.Context, now, staleBefore time.Time, limit int) ([]entity.Delivery, error)
+	MarkDeliveryPublished(ctx context.Context, deliveryID int) error
 	GetPaginatedFiles(ctx context.Context, lastID, userID, limit int) ([]entity.UserUploadedFile, int, error)
-	UpdateEmailSent(ctx context.Context, userUploadedFileID int) error
+	GetUsage(ctx context.Context, userID int) (entity.StorageUsage, error)
+	UpdateEmailSent(ctx context.Context, userUploadedFileID int, messageID string) error
+	ClaimEmail(ctx context.Context, userUploadedFileID int, now, staleBefore time.Time) error
+	ReleaseEmail(ctx context.Context, userUploadedFileID int) error
+	RequeueEmail(ctx context.Context, userUploadedFileID, userID int, recipients []string) error
+	GetFailedEmails(ctx context.Context, from, to time.Time, lastID, limit int) ([]entity.UserUploadedFile, error)
+	ClaimDelivery(ctx context.Context, deliveryID int, now, staleBefore time.Time) error
+	RequeueDelivery(ctx context.Context, deliveryID, userID int, recipients []string) error
+	GetFailedDeliveries(ctx context.Context, from, to time.Time, lastID, limit int) ([]entity.Delivery, error)
+	// CreateResend records a resend once admit accepted the number of resends of the user since the given
+	// time, which is counted with the user locked.
+	CreateResend(ctx context.Context, userID, userUploadedFileID int, since time.Time, admit func(resends int64) error) (int, error)
+	DeleteResend(ctx context.Context, resendID int) error
+	ApplyMailEvent(ctx context.Context, event entity.MailEvent) (int, error)
+	UpdateStatus(ctx context.Context, userUploadedFileID int, status string, errorMessage *string) error
+}
+
+type Webhook interface {
+	CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (entity.WebhookEndpoint, error)
+	GetEndpoints(ctx context.Context, userID int) ([]entity.WebhookEndpoint, error)
+	EnableEndpoint(ctx context.Context, endpointID, userID int) error
+	DeleteEndpoint(ctx context.Context, endpointID, userID int) error
+	GetPaginatedDeliveries(ctx context.Context, endpointID, userID, lastID, limit int) ([]entity.WebhookDelivery, int, error)
+	Enqueue(ctx context.Context, event entity.FileEvent) error
+	DispatchDue(ctx context.Context) error
+}
+
+type DeadLetter interface {
+	List(ctx context.Context, limit int) ([]entity.DeadLetter, error)
+	Get(ctx context.Context, id string) (entity.DeadLetter, error)
+	Replay(ctx context.Context, ids []string) (int, error)
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+type DeadLetterStore interface {
+	List(ctx context.Context, limit int) ([]entity.DeadLetter, error)
+	Get(ctx context.Context, id string) (entity.DeadLetter, error)
+	Replay(ctx context.Context, ids []string) (int, error)
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+type FileStatus interface {
+	Subscribe(ctx context.Context, userID int) <-chan entity.FileEvent
+	Notify(ctx context.Context, event entity.FileEvent)
+}
+
+type WebhookRepo interface {
+	CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (entity.WebhookEndpoint, error)
+	GetEndpoints(ctx context.Context, userID int) ([]entity.WebhookEndpoint, error)
+	EnableEndpoint(ctx context.Context, endpointID, userID int) error
+	DeleteEndpoint(ctx context.Context, endpointID, userID int) error
+	GetPaginatedDeliveries(ctx context.Context, endpointID, userID, lastID, limit int) ([]entity.WebhookDelivery, int, error)
+	CreateDeliveries(ctx context.Context, event entity.FileEvent, payload []byte) (int, error)
+	ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, delivery entity.WebhookDelivery, disableAfter int) (bool, error)
+}
+
+type WebhookSender interface {
+	Send(ctx context.Context, delivery entity.WebhookDelivery) (int, error)
+}
+
+type UploadSession interface {
+	Create(ctx context.Context, uploadSession entity.UploadSession) (entity.UploadSession, error)
+	GetByID(ctx context.Context, uploadSessionID string, userID int) (entity.UploadSession, error)
+	AppendChunk(ctx context.Context, uploadSessionID string, userID int, offset int64, chunk []byte) (entity.UploadSession, error)
+	Finalize(ctx context.Context, uploadSessionID string, userID int) (entity.UserUploadedFile, error)
+	PurgeExpired(ctx context.Context) error
+}
+
+type UploadSessionRepo interface {
+	// Create stores the session, admit rejects it on the usage of the user read under a lock. It may be nil.
+	Create(ctx context.Context, uploadSession entity.UploadSession, admit func(usage entity.StorageUsage) error) error
+	GetByID(ctx context.Context, uploadSessionID string, userID int) (entity.UploadSession, error)
+	AppendChunk(ctx context.Context, uploadSessionID string, userID int, offset int64, chunk []byte, checksum string, expiresAt time.Time) (int64, error)
+	Claim(ctx context.Context, uploadSessionID string, userID int) error
+	Release(ctx context.Context, uploadSessionID string) error
+	GetContent(ctx context.Context, uploadSessionID string) ([]byte, error)
+	Delete(ctx context.Context, uploadSessionID string) error
+	DeleteExpired(ctx context.Context, before time.Time) error
 }
 
 type UserUploadedFilePublisher interface {
 	Publish(ctx context.Context, userUploadedFile entity.UserUploadedFile) error
+	PublishDelivery(ctx context.Context, delivery entity.Delivery) error
+	PublishFileEvent(ctx context.Context, event entity.FileEvent) error
 }
 
 type UserUploadedFileEmailSender interface {
-	Send(ctx context.Context, userUploadedFile entity.UserUploadedFile) error
+	Send(ctx context.Context, userUploadedFile entity.UserUploadedFile) (string, error)
+	// ArchivePassword returns a new password for the archive of a delivery, which is empty unless the clean
+	// files are bundled into a protected archive.
+	ArchivePassword(delivery entity.Delivery) (string, error)
+	// SendDelivery returns the Message-ID of the email. An archive is protected with the password, which
+	// is not sent by SendDelivery.
+	SendDelivery(ctx context.Context, delivery entity.Delivery, password string, load func(ctx context.Context, file entity.UserUploadedFile) ([]byte, error)) (string, error)
+	SendArchivePassword(ctx context.Context, delivery entity.Delivery, password string) error
+}
+
+type FileScanner interface {
+	// Scan returns an error only when the scanner could not be reached or did not answer in time. A file
+	// the scanner refuses to check is reported in the result as unscannable.
+	Scan(ctx context.Context, name string, content []byte) (dto.ScanResult, error)
 }
 
 type OAuthDetail interface {
-	HandleOAuthCallback(ctx context.Context, code, domainUrl, provider, clientID string) (entity.OAuthDetail, error)
+	// HandleOAuthCallback logs in with the authorization code of a login started with the PKCE code verifier
+	// and the nonce, an id token issued for another login is invalid credentials.
+	HandleOAuthCallback(ctx context.Context, code, codeVerifier, nonce, domainUrl, provider, clientID string) (entity.OAuthDetail, error)
 	UpdateRefreshToken(ctx context.Context, userID, refreshToken string) error
 	GetByOAuthID(ctx context.Context, oAuthID string) (entity.OAuthDetail, error)
 }
@@ -50,22 +176,140 @@ type OAuthDetailRepo interface {
 }
 
 type TokenService interface {
-	ExchangeCodeForTokens(code, domainUrl string) (*dto.TokenResponse, error)
-	VerifyIDToken(idToken, clietID string) (*dto.LineUserProfile, error)
+	ExchangeCodeForTokens(code, domainUrl, codeVerifier string) (*dto.TokenResponse, error)
+	VerifyIDToken(idToken, clietID, nonce string) (*dto.LineUserProfile, error)
 }
 
 type UserCredential interface {
-	Register(ctx context.Context, displayName, username, password string) (int, error)
+	Register(ctx context.Context, displayName, username, password, email string) (int, error)
 	GetByUsername(ctx context.Context, username string) (entity.UserCredential, error)
-	Login(ctx context.Context, username, password string) (entity.UserCredential, error)
+	Login(ctx context.Context, username, password, ip string) (entity.UserCredential, error)
 }
 
 type UserCredentialRepo interface {
 	Create(ctx context.Context, userCredential entity.UserCredential) error
 	GetByUsername(ctx context.Context, username string) (entity.UserCredential, error)
+	GetByUserID(ctx context.Context, userID int) (entity.UserCredential, error)
+	GetByEmail(ctx context.Context, email string) (entity.UserCredential, error)
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+}
+
+type Password interface {
+	Forgot(ctx context.Context, email string)
+	Reset(ctx context.Context, token, password string) error
+	Change(ctx context.Context, userID int, currentPassword, newPassword string) error
+}
+
+type PasswordResetRepo interface {
+	Create(ctx context.Context, pr entity.PasswordReset) error
+	GetLatest(ctx context.Context, userID int) (entity.PasswordReset, error)
+	GetByTokenHash(ctx context.Context, tokenHash string, now time.Time) (entity.PasswordReset, error)
+	Consume(ctx context.Context, tokenHash string, now time.Time, passwordHash string) (entity.PasswordReset, error)
+}
+
+type Session interface {
+	// Start indexes a new session of the user and returns its id.
+	Start(ctx context.Context, userID int, userAgent, ip string) (string, error)
+	// Touch records that the session was used and reports whether it is still valid.
+	Touch(ctx context.Context, userID int, sessionID, ip string) (bool, error)
+	List(ctx context.Context, userID int) ([]entity.UserSession, error)
+	Revoke(ctx context.Context, userID int, sessionID string) error
+	RevokeOthers(ctx context.Context, userID int, keepSessionID string) error
+	RevokeAll(ctx context.Context, userID int) error
+}
+
+type SessionRepo interface {
+	Create(ctx context.Context, userID int, s entity.UserSession, ttl time.Duration) error
+	// Touch records that the session was seen from the ip and returns when it was created, and whether it is
+	// still indexed.
+	Touch(ctx context.Context, userID int, sessionID string, ip string, seenAt time.Time, ttl time.Duration) (time.Time, bool, error)
+	List(ctx context.Context, userID int) ([]entity.UserSession, error)
+	// Delete removes the sessions from the index and returns how many of them were in it.
+	Delete(ctx context.Context, userID int, sessionIDs ...string) (int, error)
+	DeleteAll(ctx context.Context, userID int) error
+}
+
+type PersonalAccessToken interface {
+	// Create issues a token of the user, expiring after ttl or never when ttl is 0.
+	Create(ctx context.Context, userID int, name string, scopes []string, ttl time.Duration) (dto.CreatedPersonalAccessToken, error)
+	List(ctx context.Context, userID int) ([]entity.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID int, id int) error
+	// Authenticate returns the token the request was sent with, unknown and expired tokens are invalid credentials.
+	Authenticate(ctx context.Context, token string) (entity.PersonalAccessToken, error)
+}
+
+type PersonalAccessTokenRepo interface {
+	Create(ctx context.Context, t entity.PersonalAccessToken) (entity.PersonalAccessToken, error)
+	ListByUser(ctx context.Context, userID int) ([]entity.PersonalAccessToken, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (entity.PersonalAccessToken, error)
+	MarkUsed(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int, userID int) error
+}
+
+type EmailVerification interface {
+	Send(ctx context.Context, u entity.UserCredential) error
+	Resend(ctx context.Context, userID int) error
+	Verify(ctx context.Context, token string) error
+	CheckUploadAllowed(ctx context.Context, userID int) error
+}
+
+type EmailVerificationRepo interface {
+	Create(ctx context.Context, v entity.EmailVerification) error
+	GetLatest(ctx context.Context, userID int) (entity.EmailVerification, error)
+	Consume(ctx context.Context, tokenHash string, now time.Time) (entity.EmailVerification, error)
+}
+
+type AccountMailer interface {
+	SendEmailVerification(ctx context.Context, to, username, link string, expiresAt time.Time) error
+	SendPasswordReset(ctx context.Context, to, username, link string, expiresAt time.Time) error
+}
+
+type TwoFactor interface {
+	Enroll(ctx context.Context, userID int) (dto.TOTPEnrollment, error)
+	// Confirm enables the pending factor with a first code and returns the recovery codes, they are not
+	// shown again.
+	Confirm(ctx context.Context, userID int, code string) ([]string, error)
+	Disable(ctx context.Context, userID int, code string) error
+	Enabled(ctx context.Context, userID int) (bool, error)
+	// StartChallenge holds a login until its second factor is given and returns the challenge to give it to.
+	StartChallenge(ctx context.Context, userID int) (string, error)
+	// CompleteChallenge checks the code given for a challenge and returns the user logging in.
+	CompleteChallenge(ctx context.Context, challengeID, code string) (int, error)
+}
+
+type TwoFactorRepo interface {
+	SavePending(ctx context.Context, f entity.TOTPFactor) error
+	GetFactor(ctx context.Context, userID int) (entity.TOTPFactor, error)
+	Confirm(ctx context.Context, userID int, step int64, codeHashes []string) error
+	UseStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	Delete(ctx context.Context, userID int) error
+}
+
+type TwoFactorChallengeRepo interface {
+	Create(ctx context.Context, id string, userID int, ttl time.Duration) error
+	Get(ctx context.Context, id string) (int, error)
+	RecordFailure(ctx context.Context, id string, ttl time.Duration) (int, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type PasswordHasher interface {
 	GenerateHash(ctx context.Context, password string) (string, error)
 	CompareHash(ctx context.Context, password, hashedPassword string) error
 }
+
+type LoginAttemptRepo interface {
+	// RecordFailure counts a failed login for the key and returns the failures counted so far, they are
+	// forgotten once window passes without another one.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Block(ctx context.Context, key string, d time.Duration) error
+	// BlockedFor returns how long logins for the key remain blocked, 0 when they are not.
+	BlockedFor(ctx context.Context, key string) (time.Duration, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type BreachedPasswords interface {
+	// Range returns the SHA-1 hash suffixes of the breached passwords whose hash starts with the 5 character
+	// prefix, with how many times each was seen.
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// LoginThrottle slows down repeated failed logins. Failures are counted per username, whether it exists or
+// not, and per client IP. Zero fields disable the matching protection.
+type LoginThrottle struct {
+	FreeAttempts     int           // Failures on a username before each further one blocks it for a while
+	DelayBase        time.Duration // Block after the first delayed failure, doubled for every further one
+	DelayMax         time.Duration // Longest progressive block
+	MaxFailures      int           // Failures on a username that lock it for LockDuration
+	MaxFailuresPerIP int           // Failures from an IP that lock it for LockDuration
+	LockDuration     time.Duration
+	Window           time.Duration // Failures are forgotten once this passes without another one
+}
+
+func (t LoginThrottle) enabled() bool {
+	return t.Window > 0 && (t.DelayBase > 0 || t.MaxFailures > 0 || t.MaxFailuresPerIP > 0)
+}
+
+// usernameBlock returns how long a username stays blocked after its given number of failures.
+func (t LoginThrottle) usernameBlock(failures int) time.Duration {
+	if t.MaxFailures > 0 && failures >= t.MaxFailures {
+		return t.LockDuration
+	}
+	if t.DelayBase <= 0 || failures <= t.FreeAttempts {
+		return 0
+	}
+
+	delay := t.DelayBase
+	for i := t.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if t.DelayMax > 0 && delay >= t.DelayMax {
+			return t.DelayMax
+		}
+	}
+	return delay
+}
+
+// ipBlock returns how long an IP stays blocked after its given number of failures. IPs are not delayed
+// progressively, many users may share one behind a NAT.
+func (t LoginThrottle) ipBlock(failures int) time.Duration {
+	if t.MaxFailuresPerIP > 0 && failures >= t.MaxFailuresPerIP {
+		return t.LockDuration
+	}
+	return 0
+}
+
+// loginUsernameKey is the key the failed logins of a username are counted under.
+func loginUsernameKey(username string) string {
+	return "user:" + username
+}
+
+// recordLoginFailure counts a failed attempt for the key and blocks it for as long as block returns for
+// the failures counted so far. Errors are only logged, the attempt has failed already.
+func recordLoginFailure(ctx context.Context, attempts LoginAttemptRepo, window time.Duration, key string, block func(failures int) time.Duration, l logger.Logger) {
+	failures, err := attempts.RecordFailure(ctx, key, window)
+	if err != nil {
+		l.Error("recordLoginFailure - attempts.RecordFailure : error counting failed attempt", "error", err, "key", key)
+		return
+	}
+	if d := block(failures); d > 0 {
+		l.Warn("recordLoginFailure : blocking login attempts", "key", key, "failures", failures, "duration", d)
+		err = attempts.Block(ctx, key, d)
+		if err != nil {
+			l.Error("recordLoginFailure - attempts.Block : error blocking login attempts", "error", err, "key", key)
+		}
+	}
+}
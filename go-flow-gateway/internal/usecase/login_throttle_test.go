@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottle_Blocks(t *testing.T) {
+
+	throttle := LoginThrottle{
+		FreeAttempts:     3,
+		DelayBase:        time.Second,
+		DelayMax:         10 * time.Second,
+		MaxFailures:      10,
+		MaxFailuresPerIP: 50,
+		LockDuration:     15 * time.Minute,
+		Window:           time.Hour,
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		expected time.Duration
+	}{
+		{"free attempts are not delayed", 3, 0},
+		{"the first delayed failure waits the base delay", 4, time.Second},
+		{"every further failure doubles the delay", 6, 4 * time.Second},
+		{"delays are capped", 9, 10 * time.Second},
+		{"too many failures lock the username", 10, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, throttle.usernameBlock(tt.failures))
+		})
+	}
+
+	t.Run("IPs are only locked", func(t *testing.T) {
+		assert.Zero(t, throttle.ipBlock(49))
+		assert.Equal(t, 15*time.Minute, throttle.ipBlock(50))
+	})
+
+	t.Run("a zero throttle is disabled", func(t *testing.T) {
+		assert.False(t, LoginThrottle{}.enabled())
+	})
+}
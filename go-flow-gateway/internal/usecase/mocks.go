@@ -2,8 +2,10 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -20,3 +22,164 @@ func (m *MockUserProfileUseCase) GetByID(ctx context.Context, userID int) (entit
 	args := m.Called(ctx, userID)
 	return args.Get(0).(entity.UserProfile), args.Error(1)
 }
+
+type MockUserUploadedFileUseCase struct {
+	mock.Mock
+}
+
+func (m *MockUserUploadedFileUseCase) Create(ctx context.Context, userUploadedFile entity.UserUploadedFile) (entity.UserUploadedFile, error) {
+	args := m.Called(ctx, userUploadedFile)
+	return args.Get(0).(entity.UserUploadedFile), args.Error(1)
+}
+
+func (m *MockUserUploadedFileUseCase) SendEmail(ctx context.Context, userUploadedFile entity.UserUploadedFile) error {
+	args := m.Called(ctx, userUploadedFile)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) Resend(ctx context.Context, userUploadedFileID, userID int, recipients []string) error {
+	args := m.Called(ctx, userUploadedFileID, userID, recipients)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) RequeueFailed(ctx context.Context, from, to time.Time) (dto.RequeueResult, error) {
+	args := m.Called(ctx, from, to)
+	return args.Get(0).(dto.RequeueResult), args.Error(1)
+}
+
+func (m *MockUserUploadedFileUseCase) GetPaginatedFiles(ctx context.Context, lastID, userID, limit int) ([]entity.UserUploadedFile, int, error) {
+	args := m.Called(ctx, lastID, userID, limit)
+	return args.Get(0).([]entity.UserUploadedFile), args.Int(1), args.Error(2)
+}
+
+func (m *MockUserUploadedFileUseCase) Delete(ctx context.Context, userUploadedFileID, userID int) error {
+	args := m.Called(ctx, userUploadedFileID, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) GetUsage(ctx context.Context, userID int) (dto.UserUsage, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(dto.UserUsage), args.Error(1)
+}
+
+func (m *MockUserUploadedFileUseCase) CreateDelivery(ctx context.Context, delivery entity.Delivery) (entity.Delivery, []dto.DeliveryFileResult, error) {
+	args := m.Called(ctx, delivery)
+	return args.Get(0).(entity.Delivery), args.Get(1).([]dto.DeliveryFileResult), args.Error(2)
+}
+
+func (m *MockUserUploadedFileUseCase) SendDeliveryEmail(ctx context.Context, deliveryID int) error {
+	args := m.Called(ctx, deliveryID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) RescheduleDelivery(ctx context.Context, deliveryID, userID int, sendAt time.Time) error {
+	args := m.Called(ctx, deliveryID, userID, sendAt)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) CancelDelivery(ctx context.Context, deliveryID, userID int) error {
+	args := m.Called(ctx, deliveryID, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) PublishDueDeliveries(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) Download(ctx context.Context, userUploadedFileID, userID int) (entity.UserUploadedFile, error) {
+	args := m.Called(ctx, userUploadedFileID, userID)
+	return args.Get(0).(entity.UserUploadedFile), args.Error(1)
+}
+
+func (m *MockUserUploadedFileUseCase) PurgeExpiredFiles(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileUseCase) HandleMailEvents(ctx context.Context, events []entity.MailEvent) error {
+	args := m.Called(ctx, events)
+	return args.Error(0)
+}
+
+type MockEmailVerificationUseCase struct {
+	mock.Mock
+}
+
+func (m *MockEmailVerificationUseCase) Send(ctx context.Context, u entity.UserCredential) error {
+	args := m.Called(ctx, u)
+	return args.Error(0)
+}
+
+func (m *MockEmailVerificationUseCase) Resend(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockEmailVerificationUseCase) Verify(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockEmailVerificationUseCase) CheckUploadAllowed(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockSessionUseCase struct {
+	mock.Mock
+}
+
+func (m *MockSessionUseCase) Start(ctx context.Context, userID int, userAgent, ip string) (string, error) {
+	args := m.Called(ctx, userID, userAgent, ip)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSessionUseCase) Touch(ctx context.Context, userID int, sessionID, ip string) (bool, error) {
+	args := m.Called(ctx, userID, sessionID, ip)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionUseCase) List(ctx context.Context, userID int) ([]entity.UserSession, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]entity.UserSession), args.Error(1)
+}
+
+func (m *MockSessionUseCase) Revoke(ctx context.Context, userID int, sessionID string) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionUseCase) RevokeOthers(ctx context.Context, userID int, keepSessionID string) error {
+	args := m.Called(ctx, userID, keepSessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionUseCase) RevokeAll(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockPersonalAccessTokenUseCase struct {
+	mock.Mock
+}
+
+func (m *MockPersonalAccessTokenUseCase) Create(ctx context.Context, userID int, name string, scopes []string, ttl time.Duration) (dto.CreatedPersonalAccessToken, error) {
+	args := m.Called(ctx, userID, name, scopes, ttl)
+	return args.Get(0).(dto.CreatedPersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenUseCase) List(ctx context.Context, userID int) ([]entity.PersonalAccessToken, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]entity.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenUseCase) Revoke(ctx context.Context, userID int, id int) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockPersonalAccessTokenUseCase) Authenticate(ctx context.Context, token string) (entity.PersonalAccessToken, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(entity.PersonalAccessToken), args.Error(1)
+}
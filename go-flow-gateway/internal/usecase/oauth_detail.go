@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
@@ -20,22 +21,28 @@ func NewOAuthDetailUseCase(r OAuthDetailRepo, u UserProfile, l logger.Logger, t
 	return &OAuthDetailUseCase{repo: r, userProfileUseCase: u, logger: l, tokenSvc: t}
 }
 
-func (uc *OAuthDetailUseCase) HandleOAuthCallback(ctx context.Context, code, domainUrl, provider, clientID string) (entity.OAuthDetail, error) {
+func (uc *OAuthDetailUseCase) HandleOAuthCallback(ctx context.Context, code, codeVerifier, nonce, domainUrl, provider, clientID string) (entity.OAuthDetail, error) {
 
 	// Exchange code for tokens
-	tokenResponse, err := uc.tokenSvc.ExchangeCodeForTokens(code, domainUrl)
+	tokenResponse, err := uc.tokenSvc.ExchangeCodeForTokens(code, domainUrl, codeVerifier)
 	if err != nil {
 		uc.logger.Error("OAuthDetailUseCase - HandleOAuthCallback - s.tokenSvc.ExchangeCodeForTokens: failed to exchange code for tokens", "error", err)
 		return entity.OAuthDetail{}, fmt.Errorf("OAuthDetailUseCase - HandleOAuthCallback - s.tokenSvc.ExchangeCodeForTokens: %w", err)
 	}
 
 	// Verify ID Token And Get User Profile of Line
-	lineUserProfile, err := uc.tokenSvc.VerifyIDToken(tokenResponse.IDToken, clientID)
+	lineUserProfile, err := uc.tokenSvc.VerifyIDToken(tokenResponse.IDToken, clientID, nonce)
 	if err != nil {
 		uc.logger.Error("OAuthDetailUseCase - HandleOAuthCallback - s.tokenSvc.VerifyIDToken: failed to verify id token", "error", err)
 		return entity.OAuthDetail{}, fmt.Errorf("OAuthDetailUseCase - HandleOAuthCallback - s.tokenSvc.VerifyIDToken: %w", err)
 	}
 
+	// the id token must have been issued for the login this browser started, not replayed from another one
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(lineUserProfile.Nonce), []byte(nonce)) != 1 {
+		uc.logger.Warn("OAuthDetailUseCase - HandleOAuthCallback : id token nonce does not match the login", "provider", provider)
+		return entity.OAuthDetail{}, apperrors.NewInvalidCredentialsError("id token was issued for another login", "OAuthDetailUseCase - HandleOAuthCallback")
+	}
+
 	// check the oauth detail is exists
 	oAuthDetail, err := uc.GetByOAuthID(ctx, lineUserProfile.Sub)
 	if err != nil {
@@ -35,13 +35,13 @@ func (m *MockOAuthDetailRepo) GetByOAuthID(ctx context.Context, oauthId string)
 	return args.Get(0).(entity.OAuthDetail), args.Error(1)
 }
 
-func (m *MockTokenService) ExchangeCodeForTokens(code, domainUrl string) (*dto.TokenResponse, error) {
-	args := m.Called(code, domainUrl)
+func (m *MockTokenService) ExchangeCodeForTokens(code, domainUrl, codeVerifier string) (*dto.TokenResponse, error) {
+	args := m.Called(code, domainUrl, codeVerifier)
 	return args.Get(0).(*dto.TokenResponse), args.Error(1)
 }
 
-func (m *MockTokenService) VerifyIDToken(idToken, clientID string) (*dto.LineUserProfile, error) {
-	args := m.Called(idToken, clientID)
+func (m *MockTokenService) VerifyIDToken(idToken, clientID, nonce string) (*dto.LineUserProfile, error) {
+	args := m.Called(idToken, clientID, nonce)
 	return args.Get(0).(*dto.LineUserProfile), args.Error(1)
 }
 
@@ -59,6 +59,8 @@ func TestOAuthDetailUsecase_HandleOAuthCallback(t *testing.T) {
 
 	const (
 		code         = "testcode"
+		codeVerifier = "testcodeverifier"
+		nonce        = "testnonce"
 		domainURL    = "https://example.com/callback"
 		clientID     = "testclientid"
 		userID       = 1
@@ -86,13 +88,14 @@ func TestOAuthDetailUsecase_HandleOAuthCallback(t *testing.T) {
 			RefreshToken: refreshToken,
 		}
 
-		mockTokenService.On("ExchangeCodeForTokens", code, domainURL).Return(&dto.TokenResponse{
+		mockTokenService.On("ExchangeCodeForTokens", code, domainURL, codeVerifier).Return(&dto.TokenResponse{
 			IDToken:      idToken,
 			ExpiresIn:    expiresIn,
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken,
 		}, nil)
-		mockTokenService.On("VerifyIDToken", idToken, clientID).Return(&dto.LineUserProfile{
+		mockTokenService.On("VerifyIDToken", idToken, clientID, nonce).Return(&dto.LineUserProfile{
+			Nonce:   nonce,
 			Sub:     sub,
 			Name:    displayName,
 			Picture: pictureURL,
@@ -108,7 +111,7 @@ func TestOAuthDetailUsecase_HandleOAuthCallback(t *testing.T) {
 
 		mockRepo.On("Create", ctx, oAuthDetail).Return(nil)
 
-		gotOAuthDetail, err := uc.HandleOAuthCallback(ctx, code, domainURL, provider, clientID)
+		gotOAuthDetail, err := uc.HandleOAuthCallback(ctx, code, codeVerifier, nonce, domainURL, provider, clientID)
 
 		assert.NoError(t, err)
 		assert.Equal(t, oAuthDetail, gotOAuthDetail)
@@ -130,13 +133,14 @@ func TestOAuthDetailUsecase_HandleOAuthCallback(t *testing.T) {
 			RefreshToken: refreshToken,
 		}
 
-		mockTokenService.On("ExchangeCodeForTokens", code, domainURL).Return(&dto.TokenResponse{
+		mockTokenService.On("ExchangeCodeForTokens", code, domainURL, codeVerifier).Return(&dto.TokenResponse{
 			IDToken:      idToken,
 			ExpiresIn:    expiresIn,
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken,
 		}, nil)
-		mockTokenService.On("VerifyIDToken", idToken, clientID).Return(&dto.LineUserProfile{
+		mockTokenService.On("VerifyIDToken", idToken, clientID, nonce).Return(&dto.LineUserProfile{
+			Nonce:   nonce,
 			Sub:     sub,
 			Name:    displayName,
 			Picture: pictureURL,
@@ -152,13 +156,36 @@ func TestOAuthDetailUsecase_HandleOAuthCallback(t *testing.T) {
 
 		mockRepo.On("Create", ctx, oAuthDetail).Return(assert.AnError)
 
-		_, err := uc.HandleOAuthCallback(ctx, code, domainURL, provider, clientID)
+		_, err := uc.HandleOAuthCallback(ctx, code, codeVerifier, nonce, domainURL, provider, clientID)
 
 		assert.Error(t, err)
 		mockRepo.AssertExpectations(t)
 		mockUserProfileUseCase.AssertExpectations(t)
 		mockTokenService.AssertExpectations(t)
 	})
+
+	t.Run("Refuse an id token issued for another login", func(t *testing.T) {
+
+		uc, mockRepo, mockUserProfileUseCase, mockTokenService := setupOAuthDetailUsecase(t)
+		ctx := context.Background()
+
+		mockTokenService.On("ExchangeCodeForTokens", code, domainURL, codeVerifier).Return(&dto.TokenResponse{
+			IDToken:      idToken,
+			ExpiresIn:    expiresIn,
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+		}, nil)
+		mockTokenService.On("VerifyIDToken", idToken, clientID, nonce).Return(&dto.LineUserProfile{
+			Nonce: "othernonce",
+			Sub:   sub,
+		}, nil)
+
+		_, err := uc.HandleOAuthCallback(ctx, code, codeVerifier, nonce, domainURL, provider, clientID)
+
+		assert.True(t, apperrors.IsInvalidCredentialsError(err))
+		mockRepo.AssertNotCalled(t, "GetByOAuthID", mock.Anything, mock.Anything)
+		mockUserProfileUseCase.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
 }
 
 func TestOAuthDetailUsecase_UpdateRefreshToken(t *testing.T) {
@@ -0,0 +1,205 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// PasswordResetPolicy configures how users who forgot their password choose a new one.
+type PasswordResetPolicy struct {
+	TokenTTL        time.Duration // How long a reset link works
+	RequestInterval time.Duration // Shortest time between two reset emails to a user
+	ResetURL        string        // Page the link opens, the token is added as its token query parameter
+}
+
+// PasswordUseCase changes the passwords of local accounts, either knowing the current one or through a
+// link emailed to the account.
+type PasswordUseCase struct {
+	repo           PasswordResetRepo
+	userCredential UserCredentialRepo
+	hasher         PasswordHasher
+	policy         PasswordPolicy
+	breached       BreachedPasswords
+	sessions       Session
+	mailer         AccountMailer
+	reset          PasswordResetPolicy
+	logger         logger.Logger
+}
+
+func NewPasswordUseCase(repo PasswordResetRepo, userCredential UserCredentialRepo, hasher PasswordHasher, policy PasswordPolicy, breached BreachedPasswords, sessions Session, mailer AccountMailer, reset PasswordResetPolicy, l logger.Logger) *PasswordUseCase {
+	return &PasswordUseCase{
+		repo:           repo,
+		userCredential: userCredential,
+		hasher:         hasher,
+		policy:         policy,
+		breached:       breached,
+		sessions:       sessions,
+		mailer:         mailer,
+		reset:          reset,
+		logger:         l,
+	}
+}
+
+// Forgot emails a reset link to the account with the email in the background and returns right away, so
+// that neither the answer nor its timing tell the caller which emails have an account.
+func (uc *PasswordUseCase) Forgot(ctx context.Context, email string) {
+	// the request is answered before the email is sent
+	ctx = context.WithoutCancel(ctx)
+	go uc.sendResetLink(ctx, email)
+}
+
+// sendResetLink emails a reset link to the account with the email. Unknown emails, requests repeated
+// within the request interval and failures are only logged.
+func (uc *PasswordUseCase) sendResetLink(ctx context.Context, email string) {
+	u, err := uc.userCredential.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if apperrors.IsNoRowsAffectedError(err) {
+		uc.logger.Warn("PasswordUseCase - sendResetLink : no account with the email")
+		return
+	}
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - sendResetLink - userCredential.GetByEmail : error getting user credential", "error", err)
+		return
+	}
+
+	latest, err := uc.repo.GetLatest(ctx, u.UserID)
+	if err != nil && !apperrors.IsNoRowsAffectedError(err) {
+		uc.logger.Error("PasswordUseCase - sendResetLink - repo.GetLatest : error getting latest reset", "error", err, "userID", u.UserID)
+		return
+	}
+	if err == nil && time.Since(latest.CreatedAt) < uc.reset.RequestInterval {
+		uc.logger.Warn("PasswordUseCase - sendResetLink : a reset email was sent recently", "userID", u.UserID)
+		return
+	}
+
+	token, tokenHash, err := newToken()
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - sendResetLink - newToken : error generating token", "error", err)
+		return
+	}
+
+	pr := entity.PasswordReset{
+		UserID:    u.UserID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(uc.reset.TokenTTL),
+	}
+	err = uc.repo.Create(ctx, pr)
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - sendResetLink - repo.Create : error creating password reset", "error", err, "userID", u.UserID)
+		return
+	}
+
+	link := uc.reset.ResetURL + "?token=" + url.QueryEscape(token)
+	err = uc.mailer.SendPasswordReset(ctx, u.Email, u.Username, link, pr.ExpiresAt)
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - sendResetLink - mailer.SendPasswordReset : error sending reset email", "error", err, "userID", u.UserID)
+		return
+	}
+
+	uc.logger.Info("PasswordUseCase - sendResetLink : reset email sent", "userID", u.UserID)
+}
+
+// Reset sets the password of the user a reset token was sent to and uses the token up. Every session of
+// the user is revoked. The token keeps working when the password is refused by the policy.
+func (uc *PasswordUseCase) Reset(ctx context.Context, token, password string) error {
+	tokenHash := hashToken(token)
+	pr, err := uc.repo.GetByTokenHash(ctx, tokenHash, time.Now())
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Warn("PasswordUseCase - Reset : invalid or expired token")
+		} else {
+			uc.logger.Error("PasswordUseCase - Reset - repo.GetByTokenHash : error getting password reset", "error", err)
+		}
+		return fmt.Errorf("PasswordUseCase - Reset - repo.GetByTokenHash: %w", err)
+	}
+
+	u, err := uc.userCredential.GetByUserID(ctx, pr.UserID)
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - Reset - userCredential.GetByUserID : error getting user credential", "error", err, "userID", pr.UserID)
+		return fmt.Errorf("PasswordUseCase - Reset - userCredential.GetByUserID: %w", err)
+	}
+
+	passwordHash, err := uc.hashNewPassword(ctx, "Password", u.Username, password)
+	if err != nil {
+		return fmt.Errorf("PasswordUseCase - Reset - hashNewPassword: %w", err)
+	}
+
+	// the token is only used up here, a concurrent reset with the same token finds it gone
+	_, err = uc.repo.Consume(ctx, tokenHash, time.Now(), passwordHash)
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - Reset - repo.Consume : error consuming password reset", "error", err, "userID", u.UserID)
+		return fmt.Errorf("PasswordUseCase - Reset - repo.Consume: %w", err)
+	}
+
+	err = uc.sessions.RevokeAll(ctx, u.UserID)
+	if err != nil {
+		return fmt.Errorf("PasswordUseCase - Reset - sessions.RevokeAll: %w", err)
+	}
+
+	uc.logger.Info("PasswordUseCase - Reset : password reset", "userID", u.UserID)
+	return nil
+}
+
+// Change sets a new password for a user who knows the current one. Every session of the user issued until
+// now is revoked, the caller issues the session making the change again.
+func (uc *PasswordUseCase) Change(ctx context.Context, userID int, currentPassword, newPassword string) error {
+	u, err := uc.userCredential.GetByUserID(ctx, userID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("PasswordUseCase - Change - userCredential.GetByUserID : error getting user credential", "error", err, "userID", userID)
+		}
+		return fmt.Errorf("PasswordUseCase - Change - userCredential.GetByUserID: %w", err)
+	}
+
+	err = uc.hasher.CompareHash(ctx, currentPassword, u.PasswordHash)
+	if err != nil {
+		uc.logger.Warn("PasswordUseCase - Change : wrong current password", "userID", userID)
+		return apperrors.NewInvalidCredentialsError("current password is incorrect", "PasswordUseCase - Change")
+	}
+
+	passwordHash, err := uc.hashNewPassword(ctx, "NewPassword", u.Username, newPassword)
+	if err != nil {
+		return fmt.Errorf("PasswordUseCase - Change - hashNewPassword: %w", err)
+	}
+
+	err = uc.userCredential.UpdatePassword(ctx, userID, passwordHash)
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - Change - userCredential.UpdatePassword : error updating password", "error", err, "userID", userID)
+		return fmt.Errorf("PasswordUseCase - Change - userCredential.UpdatePassword: %w", err)
+	}
+
+	err = uc.sessions.RevokeAll(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("PasswordUseCase - Change - sessions.RevokeAll: %w", err)
+	}
+
+	uc.logger.Info("PasswordUseCase - Change : password changed", "userID", userID)
+	return nil
+}
+
+// hashNewPassword checks a new password against the policy and hashes it, policy violations are reported
+// on the field of the request.
+func (uc *PasswordUseCase) hashNewPassword(ctx context.Context, field, username, password string) (string, error) {
+	err := uc.policy.check(ctx, uc.breached, field, username, password)
+	if apperrors.IsPasswordPolicyViolationError(err) {
+		uc.logger.Warn("PasswordUseCase - hashNewPassword : password rejected by the policy", "username", username)
+		return "", err
+	}
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - hashNewPassword - policy.check : error checking password", "error", err)
+		return "", fmt.Errorf("PasswordUseCase - hashNewPassword - policy.check: %w", err)
+	}
+
+	passwordHash, err := uc.hasher.GenerateHash(ctx, password)
+	if err != nil {
+		uc.logger.Error("PasswordUseCase - hashNewPassword - hasher.GenerateHash : error generating hash", "error", err)
+		return "", fmt.Errorf("PasswordUseCase - hashNewPassword - hasher.GenerateHash: %w", err)
+	}
+	return passwordHash, nil
+}
@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+)
+
+// _minUsernameInPassword is the shortest username that is looked for in a password, shorter ones would
+// reject passwords for containing a common letter.
+const _minUsernameInPassword = 3
+
+// PasswordPolicy restricts which passwords users may choose. Zero fields mean no restriction.
+type PasswordPolicy struct {
+	MinLength      int     // Characters
+	MaxLength      int     // Bytes, bcrypt refuses passwords longer than 72
+	RequireUpper   bool    // At least one upper case letter
+	RequireLower   bool    // At least one lower case letter
+	RequireDigit   bool    // At least one digit
+	RequireSymbol  bool    // At least one character that is neither a letter nor a digit
+	ForbidUsername bool    // Reject passwords containing the username, ignoring case
+	MinStrength    float64 // Estimated entropy in bits, see passwordStrength
+	MinBreachCount int     // Times a password must have been seen in breaches to be rejected
+}
+
+// violations lists the rules of the policy that the password breaks, apart from the breach check which
+// needs a dataset.
+func (p PasswordPolicy) violations(username, password string) []apperrors.PasswordViolation {
+	var violations []apperrors.PasswordViolation
+	add := func(reason, msg string, args ...interface{}) {
+		violations = append(violations, apperrors.PasswordViolation{Reason: reason, Message: fmt.Sprintf(msg, args...)})
+	}
+
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		add(apperrors.PasswordTooShort, "password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		add(apperrors.PasswordTooLong, "password must not exceed %d bytes", p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add(apperrors.PasswordMissingUpper, "password must contain an upper case letter")
+	}
+	if p.RequireLower && !lower {
+		add(apperrors.PasswordMissingLower, "password must contain a lower case letter")
+	}
+	if p.RequireDigit && !digit {
+		add(apperrors.PasswordMissingDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(apperrors.PasswordMissingSymbol, "password must contain a symbol")
+	}
+
+	if p.ForbidUsername && utf8.RuneCountInString(username) >= _minUsernameInPassword &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		add(apperrors.PasswordContainsUsername, "password must not contain the username")
+	}
+
+	if p.MinStrength > 0 && passwordStrength(password) < p.MinStrength {
+		add(apperrors.PasswordTooWeak, "password is too easy to guess, use a longer one or mix more kinds of characters")
+	}
+
+	return violations
+}
+
+// breached reports whether the password was seen in breaches often enough to be rejected. Only the first
+// 5 characters of its SHA-1 hash leave the use case, the matching against the suffixes happens here.
+func (p PasswordPolicy) breached(ctx context.Context, passwords BreachedPasswords, password string) (bool, error) {
+	if p.MinBreachCount <= 0 || passwords == nil {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := passwords.Range(ctx, hash[:5])
+	if err != nil {
+		return false, fmt.Errorf("PasswordPolicy - breached - passwords.Range: %w", err)
+	}
+
+	return suffixes[hash[5:]] >= p.MinBreachCount, nil
+}
+
+// check validates a password chosen by a user, every broken rule is reported in one
+// PasswordPolicyViolationError on the field of the request.
+func (p PasswordPolicy) check(ctx context.Context, passwords BreachedPasswords, field, username, password string) error {
+	violations := p.violations(username, password)
+
+	breached, err := p.breached(ctx, passwords, password)
+	if err != nil {
+		return fmt.Errorf("PasswordPolicy - check - breached: %w", err)
+	}
+	if breached {
+		violations = append(violations, apperrors.PasswordViolation{
+			Reason:  apperrors.PasswordBreached,
+			Message: "password has appeared in a data breach, choose another one",
+		})
+	}
+
+	if len(violations) > 0 {
+		return apperrors.NewPasswordPolicyViolationError(field, violations, "PasswordPolicy - check")
+	}
+	return nil
+}
+
+// passwordStrength estimates the entropy of a password in bits from the kinds of characters it mixes.
+// A character repeating the previous one or continuing a sequence with it, as in "aaa" or "123", adds
+// nothing.
+func passwordStrength(password string) float64 {
+	var pool, effective int
+	var upper, lower, digit, symbol, other bool
+	var prev rune
+	for i, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || (r != prev && r != prev+1 && r != prev-1) {
+			effective++
+		}
+		prev = r
+	}
+
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{upper, 26}, {lower, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(effective) * math.Log2(float64(pool))
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy_Violations(t *testing.T) {
+
+	policy := PasswordPolicy{
+		MinLength:      10,
+		MaxLength:      72,
+		RequireUpper:   true,
+		RequireLower:   true,
+		RequireDigit:   true,
+		RequireSymbol:  true,
+		ForbidUsername: true,
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		expected []string
+	}{
+		{"accepts a password following every rule", "hank", "Tr0ub4dor&3x", nil},
+		{"counts characters, not bytes", "hank", "Pässwörd1!ü", nil},
+		{"rejects a short password", "hank", "Ab1!", []string{apperrors.PasswordTooShort}},
+		{"rejects a password bcrypt cannot hash", "hank", "Ab1!" + string(make([]byte, 69)), []string{apperrors.PasswordTooLong}},
+		{"reports every missing class", "hank", "          ", []string{
+			apperrors.PasswordMissingUpper,
+			apperrors.PasswordMissingLower,
+			apperrors.PasswordMissingDigit,
+		}},
+		{"rejects the username ignoring case", "Hank", "myHANKpass1!", []string{apperrors.PasswordContainsUsername}},
+		{"ignores usernames too short to matter", "ab", "Xabcdefg1!", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasons []string
+			for _, v := range policy.violations(tt.username, tt.password) {
+				reasons = append(reasons, v.Reason)
+			}
+			assert.Equal(t, tt.expected, reasons)
+		})
+	}
+
+	t.Run("a zero policy accepts anything", func(t *testing.T) {
+		assert.Empty(t, PasswordPolicy{}.violations("hank", "hank"))
+	})
+}
+
+func TestPasswordStrength(t *testing.T) {
+
+	t.Run("repeats and sequences add nothing", func(t *testing.T) {
+		assert.Equal(t, passwordStrength("a"), passwordStrength("aaaaaaaaaa"))
+		assert.Equal(t, passwordStrength("1"), passwordStrength("123456789"))
+	})
+
+	t.Run("mixing classes makes a password stronger", func(t *testing.T) {
+		assert.Less(t, passwordStrength("tmfqzxkwvr"), passwordStrength("tmFqz9kw!r"))
+	})
+
+	t.Run("the default minimum rejects weak passwords", func(t *testing.T) {
+		assert.Less(t, passwordStrength("abcabcabca"), 40.0)
+		assert.GreaterOrEqual(t, passwordStrength("tmfqzxkwvr"), 40.0)
+	})
+}
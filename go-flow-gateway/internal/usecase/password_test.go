@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPasswordResetRepo struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetRepo) Create(ctx context.Context, pr entity.PasswordReset) error {
+	args := m.Called(ctx, pr)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetRepo) GetLatest(ctx context.Context, userID int) (entity.PasswordReset, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(entity.PasswordReset), args.Error(1)
+}
+
+func (m *MockPasswordResetRepo) GetByTokenHash(ctx context.Context, tokenHash string, now time.Time) (entity.PasswordReset, error) {
+	args := m.Called(ctx, tokenHash, now)
+	return args.Get(0).(entity.PasswordReset), args.Error(1)
+}
+
+func (m *MockPasswordResetRepo) Consume(ctx context.Context, tokenHash string, now time.Time, passwordHash string) (entity.PasswordReset, error) {
+	args := m.Called(ctx, tokenHash, now, passwordHash)
+	return args.Get(0).(entity.PasswordReset), args.Error(1)
+}
+
+type passwordUseCaseMocks struct {
+	repo     *MockPasswordResetRepo
+	creds    *MockUserCredentialRepo
+	hasher   *MockPasswordHasher
+	sessions *MockSessionUseCase
+	mailer   *MockAccountMailer
+}
+
+var _passwordResetPolicy = PasswordResetPolicy{TokenTTL: time.Hour, RequestInterval: time.Minute, ResetURL: "http://localhost:8080/reset-password"}
+
+func setupPasswordUseCase(t *testing.T) (*PasswordUseCase, passwordUseCaseMocks) {
+	t.Helper()
+	m := passwordUseCaseMocks{
+		repo:     new(MockPasswordResetRepo),
+		creds:    new(MockUserCredentialRepo),
+		hasher:   new(MockPasswordHasher),
+		sessions: new(MockSessionUseCase),
+		mailer:   new(MockAccountMailer),
+	}
+	uc := NewPasswordUseCase(m.repo, m.creds, m.hasher, PasswordPolicy{MinLength: 8}, nil, m.sessions, m.mailer, _passwordResetPolicy, logger.New("debug"))
+	return uc, m
+}
+
+func TestPasswordUseCase_Forgot(t *testing.T) {
+
+	u := entity.UserCredential{UserID: 7, Username: "hank", Email: "hank@mail.com"}
+
+	t.Run("returns before the reset link is emailed", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		release := make(chan struct{})
+		sent := make(chan struct{})
+		m.creds.On("GetByEmail", mock.Anything, "hank@mail.com").Run(func(args mock.Arguments) {
+			<-release
+		}).Return(u, nil)
+		m.repo.On("GetLatest", mock.Anything, 7).Return(entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("not found", ""))
+		m.repo.On("Create", mock.Anything, mock.Anything).Return(nil)
+		m.mailer.On("SendPasswordReset", mock.Anything, u.Email, u.Username, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			close(sent)
+		}).Return(nil)
+
+		// Act
+		uc.Forgot(ctx, "hank@mail.com")
+		cancel() // the request is answered
+		close(release)
+
+		// Assert
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatal("The reset link should have been emailed after Forgot returned")
+		}
+	})
+
+	t.Run("emails a reset link and stores the hash of its token", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByEmail", ctx, "hank@mail.com").Return(u, nil)
+		m.repo.On("GetLatest", ctx, 7).Return(entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("not found", ""))
+		var stored entity.PasswordReset
+		m.repo.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(entity.PasswordReset)
+		}).Return(nil)
+		var link string
+		m.mailer.On("SendPasswordReset", ctx, u.Email, u.Username, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			link = args.String(3)
+		}).Return(nil)
+
+		// Act
+		uc.sendResetLink(ctx, " Hank@Mail.com ")
+
+		// Assert
+		assert.True(t, strings.HasPrefix(link, _passwordResetPolicy.ResetURL+"?token="))
+		token := strings.TrimPrefix(link, _passwordResetPolicy.ResetURL+"?token=")
+		assert.Equal(t, hashToken(token), stored.TokenHash)
+		assert.Equal(t, 7, stored.UserID)
+	})
+
+	t.Run("an unknown email sends nothing", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByEmail", ctx, "nobody@mail.com").Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		uc.sendResetLink(ctx, "nobody@mail.com")
+
+		// Assert
+		m.repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		m.mailer.AssertNotCalled(t, "SendPasswordReset", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a repeated request within the interval sends nothing", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByEmail", ctx, "hank@mail.com").Return(u, nil)
+		m.repo.On("GetLatest", ctx, 7).Return(entity.PasswordReset{CreatedAt: time.Now().Add(-10 * time.Second)}, nil)
+
+		// Act
+		uc.sendResetLink(ctx, "hank@mail.com")
+
+		// Assert
+		m.repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestPasswordUseCase_Reset(t *testing.T) {
+
+	u := entity.UserCredential{UserID: 7, Username: "hank", Email: "hank@mail.com"}
+
+	t.Run("sets the password and revokes every session", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.repo.On("GetByTokenHash", ctx, hashToken("token"), mock.Anything).Return(entity.PasswordReset{UserID: 7}, nil)
+		m.creds.On("GetByUserID", ctx, 7).Return(u, nil)
+		m.hasher.On("GenerateHash", ctx, "new password").Return("new-hash", nil)
+		m.repo.On("Consume", ctx, hashToken("token"), mock.Anything, "new-hash").Return(entity.PasswordReset{UserID: 7}, nil)
+		m.sessions.On("RevokeAll", ctx, 7).Return(nil)
+
+		// Act
+		err := uc.Reset(ctx, "token", "new password")
+
+		// Assert
+		assert.NoError(t, err)
+		m.repo.AssertExpectations(t)
+		m.sessions.AssertExpectations(t)
+	})
+
+	t.Run("an invalid or expired token is not found", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.repo.On("GetByTokenHash", ctx, hashToken("token"), mock.Anything).Return(entity.PasswordReset{}, apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		err := uc.Reset(ctx, "token", "new password")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		m.sessions.AssertNotCalled(t, "RevokeAll", mock.Anything, mock.Anything)
+	})
+
+	t.Run("a password breaking the policy keeps the token", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.repo.On("GetByTokenHash", ctx, hashToken("token"), mock.Anything).Return(entity.PasswordReset{UserID: 7}, nil)
+		m.creds.On("GetByUserID", ctx, 7).Return(u, nil)
+
+		// Act
+		err := uc.Reset(ctx, "token", "short")
+
+		// Assert
+		ppve, ok := apperrors.AsPasswordPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, "Password", ppve.Field)
+		m.repo.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestPasswordUseCase_Change(t *testing.T) {
+
+	u := entity.UserCredential{UserID: 7, Username: "hank", PasswordHash: "hash"}
+
+	t.Run("sets the password and revokes the sessions", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByUserID", ctx, 7).Return(u, nil)
+		m.hasher.On("CompareHash", ctx, "old password", "hash").Return(nil)
+		m.hasher.On("GenerateHash", ctx, "new password").Return("new-hash", nil)
+		m.creds.On("UpdatePassword", ctx, 7, "new-hash").Return(nil)
+		m.sessions.On("RevokeAll", ctx, 7).Return(nil)
+
+		// Act
+		err := uc.Change(ctx, 7, "old password", "new password")
+
+		// Assert
+		assert.NoError(t, err)
+		m.creds.AssertExpectations(t)
+		m.sessions.AssertExpectations(t)
+	})
+
+	t.Run("a wrong current password is refused", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByUserID", ctx, 7).Return(u, nil)
+		m.hasher.On("CompareHash", ctx, "wrong password", "hash").Return(errors.New("mismatch"))
+
+		// Act
+		err := uc.Change(ctx, 7, "wrong password", "new password")
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidCredentialsError(err))
+		m.creds.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a new password breaking the policy is reported on its field", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByUserID", ctx, 7).Return(u, nil)
+		m.hasher.On("CompareHash", ctx, "old password", "hash").Return(nil)
+
+		// Act
+		err := uc.Change(ctx, 7, "old password", "short")
+
+		// Assert
+		ppve, ok := apperrors.AsPasswordPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, "NewPassword", ppve.Field)
+	})
+
+	t.Run("users without a credential have no password to change", func(t *testing.T) {
+		// Arrange
+		uc, m := setupPasswordUseCase(t)
+		ctx := context.Background()
+
+		m.creds.On("GetByUserID", ctx, 7).Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		err := uc.Change(ctx, 7, "old password", "new password")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+	})
+}
@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+const (
+	// _personalAccessTokenPrefix marks the tokens so that they are told apart from other secrets, such as by
+	// secret scanners.
+	_personalAccessTokenPrefix = "gfg_pat_"
+	// _tokenLastUsedPrecision is how stale the last use of a token may get before it is written again, so
+	// that a busy token does not write on every request.
+	_tokenLastUsedPrecision = time.Minute
+)
+
+type PersonalAccessTokenUseCase struct {
+	repo   PersonalAccessTokenRepo
+	logger logger.Logger
+}
+
+func NewPersonalAccessTokenUseCase(repo PersonalAccessTokenRepo, l logger.Logger) *PersonalAccessTokenUseCase {
+	return &PersonalAccessTokenUseCase{repo: repo, logger: l}
+}
+
+// Create issues a token of the user with the scopes, expiring after ttl or never when ttl is 0. The token
+// itself is only returned here.
+func (uc *PersonalAccessTokenUseCase) Create(ctx context.Context, userID int, name string, scopes []string, ttl time.Duration) (dto.CreatedPersonalAccessToken, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return dto.CreatedPersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenUseCase - Create - normalizeScopes: %w", err)
+	}
+
+	secret, _, err := newToken()
+	if err != nil {
+		return dto.CreatedPersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenUseCase - Create - newToken: %w", err)
+	}
+	token := _personalAccessTokenPrefix + secret
+
+	pat := entity.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	pat, err = uc.repo.Create(ctx, pat)
+	if err != nil {
+		uc.logger.Error("PersonalAccessTokenUseCase - Create - repo.Create : error creating token", "error", err, "userID", userID)
+		return dto.CreatedPersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenUseCase - Create - repo.Create: %w", err)
+	}
+
+	uc.logger.Info("PersonalAccessTokenUseCase - Create : token created", "userID", userID, "tokenID", pat.ID, "scopes", scopes)
+	return dto.CreatedPersonalAccessToken{Token: token, PersonalAccessToken: pat}, nil
+}
+
+func (uc *PersonalAccessTokenUseCase) List(ctx context.Context, userID int) ([]entity.PersonalAccessToken, error) {
+	tokens, err := uc.repo.ListByUser(ctx, userID)
+	if err != nil {
+		uc.logger.Error("PersonalAccessTokenUseCase - List - repo.ListByUser : error listing tokens", "error", err, "userID", userID)
+		return nil, fmt.Errorf("PersonalAccessTokenUseCase - List - repo.ListByUser: %w", err)
+	}
+	return tokens, nil
+}
+
+func (uc *PersonalAccessTokenUseCase) Revoke(ctx context.Context, userID int, id int) error {
+	err := uc.repo.Delete(ctx, id, userID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("PersonalAccessTokenUseCase - Revoke - repo.Delete : error revoking token", "error", err, "userID", userID)
+		}
+		return fmt.Errorf("PersonalAccessTokenUseCase - Revoke - repo.Delete: %w", err)
+	}
+	return nil
+}
+
+// Authenticate returns the token the request was sent with. Unknown and expired tokens are invalid credentials.
+func (uc *PersonalAccessTokenUseCase) Authenticate(ctx context.Context, token string) (entity.PersonalAccessToken, error) {
+	if !strings.HasPrefix(token, _personalAccessTokenPrefix) {
+		return entity.PersonalAccessToken{}, apperrors.NewInvalidCredentialsError("invalid token", "PersonalAccessTokenUseCase - Authenticate")
+	}
+
+	pat, err := uc.repo.GetByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			return entity.PersonalAccessToken{}, apperrors.NewInvalidCredentialsError("invalid token", "PersonalAccessTokenUseCase - Authenticate - repo.GetByTokenHash")
+		}
+		uc.logger.Error("PersonalAccessTokenUseCase - Authenticate - repo.GetByTokenHash : error reading token", "error", err)
+		return entity.PersonalAccessToken{}, fmt.Errorf("PersonalAccessTokenUseCase - Authenticate - repo.GetByTokenHash: %w", err)
+	}
+
+	now := time.Now()
+	if pat.ExpiresAt != nil && !now.Before(*pat.ExpiresAt) {
+		return entity.PersonalAccessToken{}, apperrors.NewInvalidCredentialsError("token expired", "PersonalAccessTokenUseCase - Authenticate")
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= _tokenLastUsedPrecision {
+		err = uc.repo.MarkUsed(ctx, pat.ID)
+		if err != nil {
+			// the request goes on, only the last use shown to the user is behind
+			uc.logger.Warn("PersonalAccessTokenUseCase - Authenticate - repo.MarkUsed : error recording token use", "error", err, "tokenID", pat.ID)
+		}
+	}
+
+	return pat, nil
+}
+
+// normalizeScopes drops duplicate scopes and orders them as entity.PersonalAccessTokenScopes does, a token
+// needs at least one known scope.
+func normalizeScopes(scopes []string) ([]string, error) {
+	requested := make(map[string]bool, len(scopes))
+	for _, s := range scopes {
+		requested[s] = true
+	}
+
+	normalized := make([]string, 0, len(requested))
+	for _, s := range entity.PersonalAccessTokenScopes {
+		if requested[s] {
+			normalized = append(normalized, s)
+			delete(requested, s)
+		}
+	}
+	for s := range requested {
+		return nil, fmt.Errorf("unknown scope %q", s)
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("a token needs at least one scope")
+	}
+	return normalized, nil
+}
@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPersonalAccessTokenRepo struct {
+	mock.Mock
+}
+
+func (m *MockPersonalAccessTokenRepo) Create(ctx context.Context, t entity.PersonalAccessToken) (entity.PersonalAccessToken, error) {
+	args := m.Called(ctx, t)
+	return args.Get(0).(entity.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenRepo) ListByUser(ctx context.Context, userID int) ([]entity.PersonalAccessToken, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]entity.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenRepo) GetByTokenHash(ctx context.Context, tokenHash string) (entity.PersonalAccessToken, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(entity.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenRepo) MarkUsed(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockPersonalAccessTokenRepo) Delete(ctx context.Context, id int, userID int) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func TestPersonalAccessTokenUseCase_Create(t *testing.T) {
+
+	t.Run("stores only the hash of the token", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockPersonalAccessTokenRepo)
+		uc := NewPersonalAccessTokenUseCase(mockRepo, logger.New("debug"))
+		ctx := context.Background()
+		var stored entity.PersonalAccessToken
+		mockRepo.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(entity.PersonalAccessToken)
+		}).Return(entity.PersonalAccessToken{ID: 3, UserID: 7}, nil)
+
+		// Act
+		created, err := uc.Create(ctx, 7, "backup script", []string{entity.ScopeFilesWrite, entity.ScopeFilesRead, entity.ScopeFilesWrite}, 24*time.Hour)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Token, _personalAccessTokenPrefix))
+		assert.Equal(t, 3, created.ID)
+		assert.Equal(t, hashToken(created.Token), stored.TokenHash)
+		assert.Equal(t, []string{entity.ScopeFilesRead, entity.ScopeFilesWrite}, stored.Scopes)
+		assert.NotNil(t, stored.ExpiresAt)
+	})
+
+	t.Run("refuses unknown scopes", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockPersonalAccessTokenRepo)
+		uc := NewPersonalAccessTokenUseCase(mockRepo, logger.New("debug"))
+
+		// Act
+		_, err := uc.Create(context.Background(), 7, "admin script", []string{"admin"}, 0)
+
+		// Assert
+		assert.Error(t, err)
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestPersonalAccessTokenUseCase_Authenticate(t *testing.T) {
+
+	token := _personalAccessTokenPrefix + "secret"
+
+	t.Run("returns the token and records its use", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockPersonalAccessTokenRepo)
+		uc := NewPersonalAccessTokenUseCase(mockRepo, logger.New("debug"))
+		ctx := context.Background()
+		mockRepo.On("GetByTokenHash", ctx, hashToken(token)).Return(entity.PersonalAccessToken{ID: 3, UserID: 7}, nil)
+		mockRepo.On("MarkUsed", ctx, 3).Return(nil)
+
+		// Act
+		pat, err := uc.Authenticate(ctx, token)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, pat.UserID)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("does not record a use again right away", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockPersonalAccessTokenRepo)
+		uc := NewPersonalAccessTokenUseCase(mockRepo, logger.New("debug"))
+		ctx := context.Background()
+		lastUsed := time.Now().Add(-time.Second)
+		mockRepo.On("GetByTokenHash", ctx, hashToken(token)).Return(entity.PersonalAccessToken{ID: 3, UserID: 7, LastUsedAt: &lastUsed}, nil)
+
+		// Act
+		_, err := uc.Authenticate(ctx, token)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "MarkUsed", mock.Anything, mock.Anything)
+	})
+
+	t.Run("expired and unknown tokens are invalid credentials", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockPersonalAccessTokenRepo)
+		uc := NewPersonalAccessTokenUseCase(mockRepo, logger.New("debug"))
+		ctx := context.Background()
+		expiredAt := time.Now().Add(-time.Minute)
+		mockRepo.On("GetByTokenHash", ctx, hashToken(token)).Return(entity.PersonalAccessToken{ID: 3, ExpiresAt: &expiredAt}, nil)
+		mockRepo.On("GetByTokenHash", ctx, hashToken(token+"x")).Return(entity.PersonalAccessToken{}, apperrors.NewNoRowsAffectedError("not found", "test"))
+
+		// Act
+		_, expiredErr := uc.Authenticate(ctx, token)
+		_, unknownErr := uc.Authenticate(ctx, token+"x")
+		_, malformedErr := uc.Authenticate(ctx, "not-a-token")
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidCredentialsError(expiredErr))
+		assert.True(t, apperrors.IsInvalidCredentialsError(unknownErr))
+		assert.True(t, apperrors.IsInvalidCredentialsError(malformedErr))
+	})
+}
@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// _maxUserAgentLength bounds the user agent kept for a session, it is only shown back to the user.
+const _maxUserAgentLength = 512
+
+// SessionPolicy holds how long a session lasts from its login.
+type SessionPolicy struct {
+	MaxAge time.Duration
+}
+
+// SessionUseCase keeps an index of the sessions of each user, so that they can be listed and revoked one by
+// one. A session is valid while it is in the index of its user.
+type SessionUseCase struct {
+	repo   SessionRepo
+	policy SessionPolicy
+	logger logger.Logger
+}
+
+func NewSessionUseCase(repo SessionRepo, policy SessionPolicy, l logger.Logger) *SessionUseCase {
+	return &SessionUseCase{repo: repo, policy: policy, logger: l}
+}
+
+func (uc *SessionUseCase) Start(ctx context.Context, userID int, userAgent, ip string) (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", fmt.Errorf("SessionUseCase - Start - newSessionID: %w", err)
+	}
+
+	if len(userAgent) > _maxUserAgentLength {
+		userAgent = userAgent[:_maxUserAgentLength]
+	}
+	now := time.Now()
+	err = uc.repo.Create(ctx, userID, entity.UserSession{
+		ID:         id,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}, uc.policy.MaxAge)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - Start - repo.Create : error indexing session", "error", err, "userID", userID)
+		return "", fmt.Errorf("SessionUseCase - Start - repo.Create: %w", err)
+	}
+	return id, nil
+}
+
+// Touch records that the session was used and reports whether it is still valid. A session that outlived
+// MaxAge since its login is expired and dropped from the index.
+func (uc *SessionUseCase) Touch(ctx context.Context, userID int, sessionID, ip string) (bool, error) {
+	now := time.Now()
+	createdAt, indexed, err := uc.repo.Touch(ctx, userID, sessionID, ip, now, uc.policy.MaxAge)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - Touch - repo.Touch : error recording session use", "error", err, "userID", userID)
+		return false, fmt.Errorf("SessionUseCase - Touch - repo.Touch: %w", err)
+	}
+	if !indexed {
+		return false, nil
+	}
+	if uc.expired(createdAt, now) {
+		_, err = uc.repo.Delete(ctx, userID, sessionID)
+		if err != nil {
+			// it is dropped by the next listing, the session itself has expired already
+			uc.logger.Warn("SessionUseCase - Touch - repo.Delete : error dropping expired session", "error", err, "userID", userID)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// List returns the sessions of the user that have not expired yet, the expired ones are dropped from the index.
+func (uc *SessionUseCase) List(ctx context.Context, userID int) ([]entity.UserSession, error) {
+	sessions, err := uc.repo.List(ctx, userID)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - List - repo.List : error listing sessions", "error", err, "userID", userID)
+		return nil, fmt.Errorf("SessionUseCase - List - repo.List: %w", err)
+	}
+
+	now := time.Now()
+	active := make([]entity.UserSession, 0, len(sessions))
+	var expired []string
+	for _, s := range sessions {
+		if uc.expired(s.CreatedAt, now) {
+			expired = append(expired, s.ID)
+			continue
+		}
+		active = append(active, s)
+	}
+
+	if len(expired) > 0 {
+		_, err = uc.repo.Delete(ctx, userID, expired...)
+		if err != nil {
+			// they are left for the next listing, the sessions themselves have expired already
+			uc.logger.Warn("SessionUseCase - List - repo.Delete : error dropping expired sessions", "error", err, "userID", userID)
+		}
+	}
+	return active, nil
+}
+
+func (uc *SessionUseCase) Revoke(ctx context.Context, userID int, sessionID string) error {
+	deleted, err := uc.repo.Delete(ctx, userID, sessionID)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - Revoke - repo.Delete : error revoking session", "error", err, "userID", userID)
+		return fmt.Errorf("SessionUseCase - Revoke - repo.Delete: %w", err)
+	}
+	if deleted == 0 {
+		return apperrors.NewNoRowsAffectedError("session not found", "SessionUseCase - Revoke - repo.Delete")
+	}
+
+	uc.logger.Info("SessionUseCase - Revoke : session revoked", "userID", userID)
+	return nil
+}
+
+func (uc *SessionUseCase) RevokeOthers(ctx context.Context, userID int, keepSessionID string) error {
+	sessions, err := uc.repo.List(ctx, userID)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - RevokeOthers - repo.List : error listing sessions", "error", err, "userID", userID)
+		return fmt.Errorf("SessionUseCase - RevokeOthers - repo.List: %w", err)
+	}
+
+	var others []string
+	for _, s := range sessions {
+		if s.ID != keepSessionID {
+			others = append(others, s.ID)
+		}
+	}
+
+	deleted, err := uc.repo.Delete(ctx, userID, others...)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - RevokeOthers - repo.Delete : error revoking sessions", "error", err, "userID", userID)
+		return fmt.Errorf("SessionUseCase - RevokeOthers - repo.Delete: %w", err)
+	}
+
+	uc.logger.Info("SessionUseCase - RevokeOthers : sessions revoked", "userID", userID, "count", deleted)
+	return nil
+}
+
+func (uc *SessionUseCase) RevokeAll(ctx context.Context, userID int) error {
+	err := uc.repo.DeleteAll(ctx, userID)
+	if err != nil {
+		uc.logger.Error("SessionUseCase - RevokeAll - repo.DeleteAll : error revoking sessions", "error", err, "userID", userID)
+		return fmt.Errorf("SessionUseCase - RevokeAll - repo.DeleteAll: %w", err)
+	}
+
+	uc.logger.Info("SessionUseCase - RevokeAll : sessions revoked", "userID", userID)
+	return nil
+}
+
+// expired reports whether a session created at createdAt outlived MaxAge by now.
+func (uc *SessionUseCase) expired(createdAt, now time.Time) bool {
+	return !now.Before(createdAt.Add(uc.policy.MaxAge))
+}
+
+// newSessionID returns the random id under which a session is indexed. It names the session to its user
+// and is not the id of the session cookie.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSessionRepo struct {
+	mock.Mock
+}
+
+func (m *MockSessionRepo) Create(ctx context.Context, userID int, s entity.UserSession, ttl time.Duration) error {
+	args := m.Called(ctx, userID, s, ttl)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) Touch(ctx context.Context, userID int, sessionID string, ip string, seenAt time.Time, ttl time.Duration) (time.Time, bool, error) {
+	args := m.Called(ctx, userID, sessionID, ip, seenAt, ttl)
+	return args.Get(0).(time.Time), args.Bool(1), args.Error(2)
+}
+
+func (m *MockSessionRepo) List(ctx context.Context, userID int) ([]entity.UserSession, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]entity.UserSession), args.Error(1)
+}
+
+func (m *MockSessionRepo) Delete(ctx context.Context, userID int, sessionIDs ...string) (int, error) {
+	args := m.Called(ctx, userID, sessionIDs)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockSessionRepo) DeleteAll(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func newTestSessionUseCase(repo SessionRepo) *SessionUseCase {
+	return NewSessionUseCase(repo, SessionPolicy{MaxAge: 24 * time.Hour}, logger.New("debug"))
+}
+
+func TestSessionUseCase_Start(t *testing.T) {
+
+	t.Run("indexes the session under a new id", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		var indexed entity.UserSession
+		mockRepo.On("Create", ctx, 7, mock.Anything, 24*time.Hour).Run(func(args mock.Arguments) {
+			indexed = args.Get(2).(entity.UserSession)
+		}).Return(nil)
+
+		// Act
+		id, err := uc.Start(ctx, 7, "curl/8.0", "10.0.0.1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NotEmpty(t, id)
+		assert.Equal(t, id, indexed.ID)
+		assert.Equal(t, "curl/8.0", indexed.UserAgent)
+		assert.Equal(t, "10.0.0.1", indexed.IP)
+		assert.False(t, indexed.CreatedAt.IsZero())
+	})
+
+	t.Run("fails when the session cannot be indexed", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("Create", ctx, 7, mock.Anything, 24*time.Hour).Return(errors.New("redis down"))
+
+		// Act
+		id, err := uc.Start(ctx, 7, "curl/8.0", "10.0.0.1")
+
+		// Assert
+		assert.Error(t, err)
+		assert.Empty(t, id)
+	})
+}
+
+func TestSessionUseCase_Touch(t *testing.T) {
+
+	t.Run("a recent session is valid", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("Touch", ctx, 7, "a", "10.0.0.1", mock.Anything, 24*time.Hour).Return(time.Now().Add(-time.Hour), true, nil)
+
+		// Act
+		valid, err := uc.Touch(ctx, 7, "a", "10.0.0.1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a session older than its max age expires", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("Touch", ctx, 7, "a", "10.0.0.1", mock.Anything, 24*time.Hour).Return(time.Now().Add(-25*time.Hour), true, nil)
+		mockRepo.On("Delete", ctx, 7, []string{"a"}).Return(1, nil)
+
+		// Act
+		valid, err := uc.Touch(ctx, 7, "a", "10.0.0.1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("a session missing from the index is not valid", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("Touch", ctx, 7, "a", "10.0.0.1", mock.Anything, 24*time.Hour).Return(time.Time{}, false, nil)
+
+		// Act
+		valid, err := uc.Touch(ctx, 7, "a", "10.0.0.1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+}
+
+func TestSessionUseCase_List(t *testing.T) {
+
+	t.Run("drops expired sessions", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		now := time.Now()
+		mockRepo.On("List", ctx, 7).Return([]entity.UserSession{
+			{ID: "recent", CreatedAt: now.Add(-time.Hour)},
+			{ID: "expired", CreatedAt: now.Add(-25 * time.Hour)},
+		}, nil)
+		mockRepo.On("Delete", ctx, 7, []string{"expired"}).Return(1, nil)
+
+		// Act
+		sessions, err := uc.List(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		if assert.Len(t, sessions, 1) {
+			assert.Equal(t, "recent", sessions[0].ID)
+		}
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestSessionUseCase_Revoke(t *testing.T) {
+
+	t.Run("an unknown session is not found", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("Delete", ctx, 7, []string{"other-user"}).Return(0, nil)
+
+		// Act
+		err := uc.Revoke(ctx, 7, "other-user")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+	})
+
+	t.Run("revokes every session but the one kept", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("List", ctx, 7).Return([]entity.UserSession{{ID: "a"}, {ID: "current"}, {ID: "b"}}, nil)
+		mockRepo.On("Delete", ctx, 7, []string{"a", "b"}).Return(2, nil)
+
+		// Act
+		err := uc.RevokeOthers(ctx, 7, "current")
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("revoke all empties the index", func(t *testing.T) {
+		// Arrange
+		mockRepo := new(MockSessionRepo)
+		uc := newTestSessionUseCase(mockRepo)
+		ctx := context.Background()
+		mockRepo.On("DeleteAll", ctx, 7).Return(nil)
+
+		// Act
+		err := uc.RevokeAll(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,396 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/totp"
+)
+
+// _totpSkew is how many time steps a code may be early or late, allowing for clocks that drift apart.
+const _totpSkew = 1
+
+var _recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorPolicy configures the second factor of logins.
+type TwoFactorPolicy struct {
+	Issuer        string        // Name of the app shown by authenticator apps
+	ChallengeTTL  time.Duration // How long a login waits for its second factor
+	MaxAttempts   int           // Wrong codes after which a login has to start over, 0 never
+	RecoveryCodes int           // Recovery codes given when two-factor authentication is enabled
+}
+
+// TwoFactorUseCase enrolls authenticator apps as a second factor and checks it when users log in, with a
+// password or through an OAuth provider.
+type TwoFactorUseCase struct {
+	repo           TwoFactorRepo
+	challenges     TwoFactorChallengeRepo
+	userCredential UserCredentialRepo
+	userProfile    UserProfile
+	policy         TwoFactorPolicy
+	attempts       LoginAttemptRepo
+	throttle       LoginThrottle
+	logger         logger.Logger
+}
+
+func NewTwoFactorUseCase(repo TwoFactorRepo, challenges TwoFactorChallengeRepo, userCredential UserCredentialRepo, userProfile UserProfile, policy TwoFactorPolicy, attempts LoginAttemptRepo, throttle LoginThrottle, l logger.Logger) *TwoFactorUseCase {
+	return &TwoFactorUseCase{repo: repo, challenges: challenges, userCredential: userCredential, userProfile: userProfile, policy: policy, attempts: attempts, throttle: throttle, logger: l}
+}
+
+// Enroll generates the secret of a new factor, it is only enabled once confirmed with a first code.
+// Enrolling again before confirming replaces the secret.
+func (uc *TwoFactorUseCase) Enroll(ctx context.Context, userID int) (dto.TOTPEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - Enroll - totp.GenerateSecret : error generating secret", "error", err)
+		return dto.TOTPEnrollment{}, fmt.Errorf("TwoFactorUseCase - Enroll - totp.GenerateSecret: %w", err)
+	}
+
+	err = uc.repo.SavePending(ctx, entity.TOTPFactor{UserID: userID, Secret: secret})
+	if apperrors.IsNoRowsAffectedError(err) {
+		return dto.TOTPEnrollment{}, apperrors.NewTwoFactorAlreadyEnabledError("two-factor authentication is already enabled", "TwoFactorUseCase - Enroll")
+	}
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - Enroll - repo.SavePending : error saving factor", "error", err, "userID", userID)
+		return dto.TOTPEnrollment{}, fmt.Errorf("TwoFactorUseCase - Enroll - repo.SavePending: %w", err)
+	}
+
+	account, err := uc.accountName(ctx, userID)
+	if err != nil {
+		return dto.TOTPEnrollment{}, fmt.Errorf("TwoFactorUseCase - Enroll - accountName: %w", err)
+	}
+	uri := totp.URI(uc.policy.Issuer, account, secret)
+
+	uc.logger.Info("TwoFactorUseCase - Enroll : factor enrolled", "userID", userID)
+	return dto.TOTPEnrollment{Secret: secret, OTPAuthURI: uri, QRPayload: uri}, nil
+}
+
+// Confirm enables the pending factor of the user with a first code and returns new recovery codes.
+func (uc *TwoFactorUseCase) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	f, err := uc.repo.GetFactor(ctx, userID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("TwoFactorUseCase - Confirm - repo.GetFactor : error getting factor", "error", err, "userID", userID)
+		}
+		return nil, fmt.Errorf("TwoFactorUseCase - Confirm - repo.GetFactor: %w", err)
+	}
+	if f.ConfirmedAt != nil {
+		return nil, apperrors.NewTwoFactorAlreadyEnabledError("two-factor authentication is already enabled", "TwoFactorUseCase - Confirm")
+	}
+
+	step, ok := matchTOTP(f, normalizeCode(code), time.Now())
+	if !ok {
+		uc.logger.Warn("TwoFactorUseCase - Confirm : invalid code", "userID", userID)
+		return nil, apperrors.NewInvalidTwoFactorCodeError("invalid code", "TwoFactorUseCase - Confirm")
+	}
+
+	codes, hashes, err := newRecoveryCodes(uc.policy.RecoveryCodes)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - Confirm - newRecoveryCodes : error generating recovery codes", "error", err)
+		return nil, fmt.Errorf("TwoFactorUseCase - Confirm - newRecoveryCodes: %w", err)
+	}
+
+	err = uc.repo.Confirm(ctx, userID, step, hashes)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - Confirm - repo.Confirm : error confirming factor", "error", err, "userID", userID)
+		return nil, fmt.Errorf("TwoFactorUseCase - Confirm - repo.Confirm: %w", err)
+	}
+
+	uc.logger.Info("TwoFactorUseCase - Confirm : two-factor authentication enabled", "userID", userID)
+	return codes, nil
+}
+
+// Disable removes the factor of the user and their recovery codes, given a code proving that the user
+// still has the factor. The code is throttled like one given to complete a login.
+func (uc *TwoFactorUseCase) Disable(ctx context.Context, userID int, code string) error {
+	f, err := uc.confirmedFactor(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("TwoFactorUseCase - Disable - confirmedFactor: %w", err)
+	}
+
+	key, throttled := uc.loginKey(ctx, userID)
+	err = uc.admitLoginAttempt(ctx, key, throttled, userID)
+	if err != nil {
+		return fmt.Errorf("TwoFactorUseCase - Disable - admitLoginAttempt: %w", err)
+	}
+
+	err = uc.verifyCode(ctx, f, code)
+	if err != nil {
+		return fmt.Errorf("TwoFactorUseCase - Disable - verifyCode: %w", err)
+	}
+
+	uc.forgiveLoginFailures(ctx, key, throttled, userID)
+
+	err = uc.repo.Delete(ctx, userID)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - Disable - repo.Delete : error deleting factor", "error", err, "userID", userID)
+		return fmt.Errorf("TwoFactorUseCase - Disable - repo.Delete: %w", err)
+	}
+
+	uc.logger.Info("TwoFactorUseCase - Disable : two-factor authentication disabled", "userID", userID)
+	return nil
+}
+
+func (uc *TwoFactorUseCase) Enabled(ctx context.Context, userID int) (bool, error) {
+	_, err := uc.confirmedFactor(ctx, userID)
+	if apperrors.IsNoRowsAffectedError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("TwoFactorUseCase - Enabled - confirmedFactor: %w", err)
+	}
+	return true, nil
+}
+
+func (uc *TwoFactorUseCase) StartChallenge(ctx context.Context, userID int) (string, error) {
+	id, _, err := newToken()
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - StartChallenge - newToken : error generating challenge", "error", err)
+		return "", fmt.Errorf("TwoFactorUseCase - StartChallenge - newToken: %w", err)
+	}
+
+	err = uc.challenges.Create(ctx, id, userID, uc.policy.ChallengeTTL)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - StartChallenge - challenges.Create : error creating challenge", "error", err, "userID", userID)
+		return "", fmt.Errorf("TwoFactorUseCase - StartChallenge - challenges.Create: %w", err)
+	}
+
+	uc.logger.Info("TwoFactorUseCase - StartChallenge : waiting for the second factor", "userID", userID)
+	return id, nil
+}
+
+// CompleteChallenge checks the code given for a login waiting for its second factor. Every code is counted
+// before it is compared, so parallel requests cannot try more than MaxAttempts codes on a challenge; the
+// login then starts over. Codes also count against the username of the user in the login throttle, which
+// refuses them while the username is blocked and forgives them once a code is accepted.
+func (uc *TwoFactorUseCase) CompleteChallenge(ctx context.Context, challengeID, code string) (int, error) {
+	userID, err := uc.challenges.Get(ctx, challengeID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("TwoFactorUseCase - CompleteChallenge - challenges.Get : error getting challenge", "error", err)
+		}
+		return 0, fmt.Errorf("TwoFactorUseCase - CompleteChallenge - challenges.Get: %w", err)
+	}
+
+	key, throttled := uc.loginKey(ctx, userID)
+	err = uc.admitLoginAttempt(ctx, key, throttled, userID)
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorUseCase - CompleteChallenge - admitLoginAttempt: %w", err)
+	}
+
+	err = uc.admitChallengeAttempt(ctx, challengeID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorUseCase - CompleteChallenge - admitChallengeAttempt: %w", err)
+	}
+
+	f, err := uc.confirmedFactor(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorUseCase - CompleteChallenge - confirmedFactor: %w", err)
+	}
+
+	err = uc.verifyCode(ctx, f, code)
+	if apperrors.IsInvalidTwoFactorCodeError(err) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("TwoFactorUseCase - CompleteChallenge - verifyCode: %w", err)
+	}
+
+	err = uc.challenges.Delete(ctx, challengeID)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - CompleteChallenge - challenges.Delete : error deleting challenge", "error", err, "userID", userID)
+	}
+
+	uc.forgiveLoginFailures(ctx, key, throttled, userID)
+
+	uc.logger.Info("TwoFactorUseCase - CompleteChallenge : second factor passed", "userID", userID)
+	return userID, nil
+}
+
+// admitChallengeAttempt counts a code given for the challenge before it is compared. The challenge ends
+// once more than MaxAttempts codes were given for it.
+func (uc *TwoFactorUseCase) admitChallengeAttempt(ctx context.Context, challengeID string, userID int) error {
+	if uc.policy.MaxAttempts <= 0 {
+		return nil
+	}
+
+	attempts, err := uc.challenges.RecordFailure(ctx, challengeID, uc.policy.ChallengeTTL)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - admitChallengeAttempt - challenges.RecordFailure : error counting code", "error", err, "userID", userID)
+		return fmt.Errorf("TwoFactorUseCase - admitChallengeAttempt - challenges.RecordFailure: %w", err)
+	}
+	if attempts <= uc.policy.MaxAttempts {
+		return nil
+	}
+
+	uc.logger.Warn("TwoFactorUseCase - admitChallengeAttempt : too many codes, ending the challenge", "userID", userID)
+	err = uc.challenges.Delete(ctx, challengeID)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - admitChallengeAttempt - challenges.Delete : error deleting challenge", "error", err, "userID", userID)
+	}
+	return apperrors.NewNoRowsAffectedError("too many codes, the login has to start over", "TwoFactorUseCase - admitChallengeAttempt")
+}
+
+// admitLoginAttempt refuses a code while the username of the user is blocked by the login throttle, and
+// otherwise counts it as a failed login before it is compared, like a wrong password.
+func (uc *TwoFactorUseCase) admitLoginAttempt(ctx context.Context, key string, throttled bool, userID int) error {
+	if !throttled {
+		return nil
+	}
+
+	retryAfter, err := uc.attempts.BlockedFor(ctx, key)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - admitLoginAttempt - attempts.BlockedFor : error reading login block", "error", err, "userID", userID)
+		return fmt.Errorf("TwoFactorUseCase - admitLoginAttempt - attempts.BlockedFor: %w", err)
+	}
+	if retryAfter > 0 {
+		uc.logger.Warn("TwoFactorUseCase - admitLoginAttempt : code blocked", "userID", userID, "retryAfter", retryAfter)
+		return apperrors.NewLoginThrottledError(retryAfter, "too many failed login attempts, try again later", "TwoFactorUseCase - admitLoginAttempt")
+	}
+
+	recordLoginFailure(ctx, uc.attempts, uc.throttle.Window, key, uc.throttle.usernameBlock, uc.logger)
+	return nil
+}
+
+// forgiveLoginFailures forgets the failed logins of the username of the user once they gave a right code.
+func (uc *TwoFactorUseCase) forgiveLoginFailures(ctx context.Context, key string, throttled bool, userID int) {
+	if !throttled {
+		return
+	}
+	err := uc.attempts.Reset(ctx, key)
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - forgiveLoginFailures - attempts.Reset : error resetting failed attempts", "error", err, "userID", userID)
+	}
+}
+
+// loginKey returns the key the failed logins of the user are counted under, and whether they are
+// throttled at all. Users logging in only through an OAuth provider have no username, their logins are
+// not throttled.
+func (uc *TwoFactorUseCase) loginKey(ctx context.Context, userID int) (string, bool) {
+	if uc.attempts == nil || !uc.throttle.enabled() {
+		return "", false
+	}
+	u, err := uc.userCredential.GetByUserID(ctx, userID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("TwoFactorUseCase - loginKey - userCredential.GetByUserID : error getting user credential", "error", err, "userID", userID)
+		}
+		return "", false
+	}
+	return loginUsernameKey(u.Username), true
+}
+
+func (uc *TwoFactorUseCase) confirmedFactor(ctx context.Context, userID int) (entity.TOTPFactor, error) {
+	f, err := uc.repo.GetFactor(ctx, userID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("TwoFactorUseCase - confirmedFactor - repo.GetFactor : error getting factor", "error", err, "userID", userID)
+		}
+		return entity.TOTPFactor{}, fmt.Errorf("TwoFactorUseCase - confirmedFactor - repo.GetFactor: %w", err)
+	}
+	if f.ConfirmedAt == nil {
+		return entity.TOTPFactor{}, apperrors.NewNoRowsAffectedError("two-factor authentication is not enabled", "TwoFactorUseCase - confirmedFactor")
+	}
+	return f, nil
+}
+
+// verifyCode accepts a TOTP code of the factor that was not used yet, or else an unused recovery code of
+// the user, and uses it up.
+func (uc *TwoFactorUseCase) verifyCode(ctx context.Context, f entity.TOTPFactor, code string) error {
+	code = normalizeCode(code)
+	invalid := apperrors.NewInvalidTwoFactorCodeError("invalid code", "TwoFactorUseCase - verifyCode")
+
+	var err error
+	if len(code) == totp.Digits {
+		step, ok := matchTOTP(f, code, time.Now())
+		if !ok {
+			uc.logger.Warn("TwoFactorUseCase - verifyCode : invalid totp code", "userID", f.UserID)
+			return invalid
+		}
+		err = uc.repo.UseStep(ctx, f.UserID, step)
+	} else {
+		err = uc.repo.UseRecoveryCode(ctx, f.UserID, hashToken(code))
+	}
+	if apperrors.IsNoRowsAffectedError(err) {
+		uc.logger.Warn("TwoFactorUseCase - verifyCode : code used already or unknown", "userID", f.UserID)
+		return invalid
+	}
+	if err != nil {
+		uc.logger.Error("TwoFactorUseCase - verifyCode : error using code", "error", err, "userID", f.UserID)
+		return fmt.Errorf("TwoFactorUseCase - verifyCode: %w", err)
+	}
+	return nil
+}
+
+// accountName labels the factor in authenticator apps, with the username of local accounts and the display
+// name of the others.
+func (uc *TwoFactorUseCase) accountName(ctx context.Context, userID int) (string, error) {
+	u, err := uc.userCredential.GetByUserID(ctx, userID)
+	if err == nil {
+		return u.Username, nil
+	}
+	if !apperrors.IsNoRowsAffectedError(err) {
+		uc.logger.Error("TwoFactorUseCase - accountName - userCredential.GetByUserID : error getting user credential", "error", err, "userID", userID)
+		return "", fmt.Errorf("TwoFactorUseCase - accountName - userCredential.GetByUserID: %w", err)
+	}
+
+	up, err := uc.userProfile.GetByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("TwoFactorUseCase - accountName - userProfile.GetByID: %w", err)
+	}
+	if up.DisplayName == "" {
+		return fmt.Sprintf("user %d", userID), nil
+	}
+	return up.DisplayName, nil
+}
+
+// matchTOTP returns the time step a code belongs to, among the steps around now that are later than the
+// last one used.
+func matchTOTP(f entity.TOTPFactor, code string, now time.Time) (int64, bool) {
+	current := totp.Step(now)
+	for step := current - _totpSkew; step <= current+_totpSkew; step++ {
+		if step <= f.LastUsedStep {
+			continue
+		}
+		expected, err := totp.Code(f.Secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes returns n random codes, formatted as xxxx-xxxx for reading, and the hashes under which
+// they are stored.
+func newRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(_recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode drops the separators users may type and lowercases recovery codes.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
@@ -0,0 +1,448 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/bgg/go-flow-gateway/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockTwoFactorRepo struct {
+	mock.Mock
+}
+
+func (m *MockTwoFactorRepo) SavePending(ctx context.Context, f entity.TOTPFactor) error {
+	args := m.Called(ctx, f)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepo) GetFactor(ctx context.Context, userID int) (entity.TOTPFactor, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(entity.TOTPFactor), args.Error(1)
+}
+
+func (m *MockTwoFactorRepo) Confirm(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	args := m.Called(ctx, userID, step, codeHashes)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepo) UseStep(ctx context.Context, userID int, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepo) Delete(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockTwoFactorChallengeRepo struct {
+	mock.Mock
+}
+
+func (m *MockTwoFactorChallengeRepo) Create(ctx context.Context, id string, userID int, ttl time.Duration) error {
+	args := m.Called(ctx, id, userID, ttl)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorChallengeRepo) Get(ctx context.Context, id string) (int, error) {
+	args := m.Called(ctx, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTwoFactorChallengeRepo) RecordFailure(ctx context.Context, id string, ttl time.Duration) (int, error) {
+	args := m.Called(ctx, id, ttl)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTwoFactorChallengeRepo) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+var _twoFactorPolicy = TwoFactorPolicy{Issuer: "GoFlow", ChallengeTTL: 5 * time.Minute, MaxAttempts: 3, RecoveryCodes: 4}
+
+func setupTwoFactorUseCase(t *testing.T) (*TwoFactorUseCase, *MockTwoFactorRepo, *MockTwoFactorChallengeRepo, *MockUserCredentialRepo, *MockUserProfileUseCase) {
+	t.Helper()
+	mockRepo := new(MockTwoFactorRepo)
+	mockChallenges := new(MockTwoFactorChallengeRepo)
+	mockCredentialRepo := new(MockUserCredentialRepo)
+	mockUserProfile := new(MockUserProfileUseCase)
+	uc := NewTwoFactorUseCase(mockRepo, mockChallenges, mockCredentialRepo, mockUserProfile, _twoFactorPolicy, nil, LoginThrottle{}, logger.New("debug"))
+	return uc, mockRepo, mockChallenges, mockCredentialRepo, mockUserProfile
+}
+
+// confirmedFactor returns an enabled factor and its code at the current time step.
+func confirmedFactor(t *testing.T) (entity.TOTPFactor, string) {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	assert.NoError(t, err)
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	assert.NoError(t, err)
+	confirmedAt := time.Now().Add(-time.Hour)
+	return entity.TOTPFactor{UserID: 7, Secret: secret, ConfirmedAt: &confirmedAt}, code
+}
+
+func TestTwoFactorUseCase_Enroll(t *testing.T) {
+
+	t.Run("returns the secret as an otpauth uri labelled with the username", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockCredentialRepo, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+
+		var saved entity.TOTPFactor
+		mockRepo.On("SavePending", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			saved = args.Get(1).(entity.TOTPFactor)
+		}).Return(nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Username: "hank"}, nil)
+
+		// Act
+		enrollment, err := uc.Enroll(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, saved.Secret, enrollment.Secret)
+		assert.True(t, strings.HasPrefix(enrollment.OTPAuthURI, "otpauth://totp/GoFlow:hank?"))
+		assert.Contains(t, enrollment.OTPAuthURI, "secret="+saved.Secret)
+		assert.Equal(t, enrollment.OTPAuthURI, enrollment.QRPayload)
+	})
+
+	t.Run("oauth users are labelled with their display name", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockCredentialRepo, mockUserProfile := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("SavePending", ctx, mock.Anything).Return(nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("not found", ""))
+		mockUserProfile.On("GetByID", ctx, 7).Return(entity.UserProfile{UserID: 7, DisplayName: "Hank"}, nil)
+
+		// Act
+		enrollment, err := uc.Enroll(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(enrollment.OTPAuthURI, "otpauth://totp/GoFlow:Hank?"))
+	})
+
+	t.Run("an enabled factor is not replaced", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("SavePending", ctx, mock.Anything).Return(apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		_, err := uc.Enroll(ctx, 7)
+
+		// Assert
+		assert.True(t, apperrors.IsTwoFactorAlreadyEnabledError(err))
+	})
+}
+
+func TestTwoFactorUseCase_Confirm(t *testing.T) {
+
+	t.Run("enables the factor and stores the hashes of the recovery codes", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		f, code := confirmedFactor(t)
+		f.ConfirmedAt = nil
+
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		var hashes []string
+		mockRepo.On("Confirm", ctx, 7, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			hashes = args.Get(3).([]string)
+		}).Return(nil)
+
+		// Act
+		codes, err := uc.Confirm(ctx, 7, code)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Len(t, codes, _twoFactorPolicy.RecoveryCodes)
+		assert.Len(t, hashes, _twoFactorPolicy.RecoveryCodes)
+		assert.Equal(t, hashToken(normalizeCode(codes[0])), hashes[0])
+	})
+
+	t.Run("a wrong code leaves the factor pending", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		f, _ := confirmedFactor(t)
+		f.ConfirmedAt = nil
+
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+
+		// Act
+		_, err := uc.Confirm(ctx, 7, "000000x")
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidTwoFactorCodeError(err))
+		mockRepo.AssertNotCalled(t, "Confirm", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestTwoFactorUseCase_CompleteChallenge(t *testing.T) {
+
+	t.Run("a totp code completes the login and is used up", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		f, code := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+		mockRepo.On("UseStep", ctx, 7, mock.Anything).Return(nil)
+		mockChallenges.On("Delete", ctx, "challenge").Return(nil)
+
+		// Act
+		userID, err := uc.CompleteChallenge(ctx, "challenge", code[:3]+" "+code[3:])
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, userID)
+		mockRepo.AssertExpectations(t)
+		mockChallenges.AssertExpectations(t)
+	})
+
+	t.Run("a recovery code completes the login", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		f, _ := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+		mockRepo.On("UseRecoveryCode", ctx, 7, hashToken("abcd2345")).Return(nil)
+		mockChallenges.On("Delete", ctx, "challenge").Return(nil)
+
+		// Act
+		userID, err := uc.CompleteChallenge(ctx, "challenge", "ABCD-2345")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, userID)
+	})
+
+	t.Run("a replayed code is refused", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		f, code := confirmedFactor(t)
+		f.LastUsedStep = totp.Step(time.Now())
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+
+		// Act
+		_, err := uc.CompleteChallenge(ctx, "challenge", code)
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidTwoFactorCodeError(err))
+		mockRepo.AssertNotCalled(t, "UseStep", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a code beyond the limit ends the challenge before it is compared", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		f, code := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(_twoFactorPolicy.MaxAttempts+1, nil)
+		mockChallenges.On("Delete", ctx, "challenge").Return(nil)
+
+		// Act
+		_, err := uc.CompleteChallenge(ctx, "challenge", code)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		mockChallenges.AssertCalled(t, "Delete", ctx, "challenge")
+		mockRepo.AssertNotCalled(t, "UseStep", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("an expired challenge is not found", func(t *testing.T) {
+		// Arrange
+		uc, _, mockChallenges, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+
+		mockChallenges.On("Get", ctx, "challenge").Return(0, apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		_, err := uc.CompleteChallenge(ctx, "challenge", "123456")
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+	})
+}
+
+func TestTwoFactorUseCase_Enabled(t *testing.T) {
+
+	t.Run("a pending factor is not enabled", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		mockRepo.On("GetFactor", ctx, 7).Return(entity.TOTPFactor{UserID: 7}, nil)
+
+		// Act
+		enabled, err := uc.Enabled(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, enabled)
+	})
+
+	t.Run("users without a factor are not enabled", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupTwoFactorUseCase(t)
+		ctx := context.Background()
+		mockRepo.On("GetFactor", ctx, 7).Return(entity.TOTPFactor{}, apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		enabled, err := uc.Enabled(ctx, 7)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, enabled)
+	})
+}
+
+func TestTwoFactorUseCase_CompleteChallenge_Throttle(t *testing.T) {
+
+	throttle := LoginThrottle{FreeAttempts: 3, DelayBase: time.Second, DelayMax: time.Minute, MaxFailures: 10, LockDuration: 15 * time.Minute, Window: time.Hour}
+
+	setup := func(t *testing.T) (*TwoFactorUseCase, *MockTwoFactorRepo, *MockTwoFactorChallengeRepo, *MockUserCredentialRepo, *MockLoginAttemptRepo) {
+		t.Helper()
+		mockRepo := new(MockTwoFactorRepo)
+		mockChallenges := new(MockTwoFactorChallengeRepo)
+		mockCredentialRepo := new(MockUserCredentialRepo)
+		mockAttempts := new(MockLoginAttemptRepo)
+		uc := NewTwoFactorUseCase(mockRepo, mockChallenges, mockCredentialRepo, new(MockUserProfileUseCase), _twoFactorPolicy, mockAttempts, throttle, logger.New("debug"))
+		return uc, mockRepo, mockChallenges, mockCredentialRepo, mockAttempts
+	}
+
+	t.Run("a wrong code counts against the username of the user", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, mockCredentialRepo, mockAttempts := setup(t)
+		ctx := context.Background()
+		f, _ := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockRepo.On("UseRecoveryCode", ctx, 7, mock.Anything).Return(apperrors.NewNoRowsAffectedError("not found", ""))
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Username: "hank"}, nil)
+		mockAttempts.On("BlockedFor", ctx, "user:hank").Return(time.Duration(0), nil)
+		mockAttempts.On("RecordFailure", ctx, "user:hank", time.Hour).Return(10, nil)
+		mockAttempts.On("Block", ctx, "user:hank", 15*time.Minute).Return(nil)
+
+		// Act
+		_, err := uc.CompleteChallenge(ctx, "challenge", "wrong-code")
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidTwoFactorCodeError(err))
+		mockAttempts.AssertExpectations(t)
+		mockAttempts.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+	})
+
+	t.Run("a passed second factor forgives the username", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, mockCredentialRepo, mockAttempts := setup(t)
+		ctx := context.Background()
+		f, code := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+		mockRepo.On("UseStep", ctx, 7, mock.Anything).Return(nil)
+		mockChallenges.On("Delete", ctx, "challenge").Return(nil)
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Username: "hank"}, nil)
+		mockAttempts.On("BlockedFor", ctx, "user:hank").Return(time.Duration(0), nil)
+		mockAttempts.On("RecordFailure", ctx, "user:hank", time.Hour).Return(1, nil)
+		mockAttempts.On("Reset", ctx, "user:hank").Return(nil)
+
+		// Act
+		userID, err := uc.CompleteChallenge(ctx, "challenge", code)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, userID)
+		mockAttempts.AssertExpectations(t)
+	})
+
+	t.Run("a user without a password is not throttled", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, mockCredentialRepo, mockAttempts := setup(t)
+		ctx := context.Background()
+		f, _ := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockRepo.On("UseRecoveryCode", ctx, 7, mock.Anything).Return(apperrors.NewNoRowsAffectedError("not found", ""))
+		mockChallenges.On("RecordFailure", ctx, "challenge", _twoFactorPolicy.ChallengeTTL).Return(1, nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("not found", ""))
+
+		// Act
+		_, err := uc.CompleteChallenge(ctx, "challenge", "wrong-code")
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidTwoFactorCodeError(err))
+		mockAttempts.AssertNotCalled(t, "RecordFailure", mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("a blocked username is refused before the code is compared", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockChallenges, mockCredentialRepo, mockAttempts := setup(t)
+		ctx := context.Background()
+		_, code := confirmedFactor(t)
+
+		mockChallenges.On("Get", ctx, "challenge").Return(7, nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Username: "hank"}, nil)
+		mockAttempts.On("BlockedFor", ctx, "user:hank").Return(30*time.Second, nil)
+
+		// Act
+		_, err := uc.CompleteChallenge(ctx, "challenge", code)
+
+		// Assert
+		lte, ok := apperrors.AsLoginThrottledError(err)
+		assert.True(t, ok)
+		assert.Equal(t, 30*time.Second, lte.RetryAfter)
+		mockChallenges.AssertNotCalled(t, "RecordFailure", mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertNotCalled(t, "UseStep", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a blocked username cannot disable the factor", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockCredentialRepo, mockAttempts := setup(t)
+		ctx := context.Background()
+		f, code := confirmedFactor(t)
+
+		mockRepo.On("GetFactor", ctx, 7).Return(f, nil)
+		mockCredentialRepo.On("GetByUserID", ctx, 7).Return(entity.UserCredential{UserID: 7, Username: "hank"}, nil)
+		mockAttempts.On("BlockedFor", ctx, "user:hank").Return(30*time.Second, nil)
+
+		// Act
+		err := uc.Disable(ctx, 7, code)
+
+		// Assert
+		_, ok := apperrors.AsLoginThrottledError(err)
+		assert.True(t, ok)
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
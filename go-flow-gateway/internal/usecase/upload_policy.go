@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+)
+
+// UploadPolicy restricts which files users may upload. Empty fields mean no restriction.
+type UploadPolicy struct {
+	AllowedTypes      []string         // Media types such as "application/pdf" or "image/*"
+	BlockedExtensions []string         // File extensions such as ".exe"
+	MaxSize           int64            // Default size limit in bytes
+	MaxSizeByType     map[string]int64 // Size limits in bytes keyed by media type pattern
+	Deduplicate       bool             // Reuse stored content when a user uploads identical bytes again
+	MaxBatchFiles     int              // Number of files that can be sent together in one delivery
+	DefaultRetention  time.Duration    // How long content is kept when the user does not choose an expiry
+	MaxRetention      time.Duration    // Latest expiry a user can choose, counted from the upload
+}
+
+// Check validates a sniffed upload against the policy.
+func (p UploadPolicy) Check(name, contentType string, size int64) error {
+	ext := strings.ToLower(path.Ext(name))
+	for _, blocked := range p.BlockedExtensions {
+		if ext != "" && strings.EqualFold(ext, normalizeExtension(blocked)) {
+			return apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyExtensionBlocked, "files with extension %s are not allowed", "UploadPolicy - Check", ext)
+		}
+	}
+
+	if len(p.AllowedTypes) > 0 {
+		allowed := false
+		for _, pattern := range p.AllowedTypes {
+			if matchMediaType(pattern, contentType) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyContentTypeNotAllowed, "files of type %s are not allowed", "UploadPolicy - Check", contentType)
+		}
+	}
+
+	limit := p.sizeLimit(contentType)
+	if limit > 0 && size > limit {
+		return apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyFileTooLarge, "files of type %s must not exceed %d bytes", "UploadPolicy - Check", contentType, limit)
+	}
+
+	return nil
+}
+
+// sizeLimit is the limit of the most specific pattern matching the content type: the exact type, then
+// "type/*", then "*/*", then the default. Patterns are visited in sorted order so that equally specific ones,
+// differing only in case, always resolve the same way.
+func (p UploadPolicy) sizeLimit(contentType string) int64 {
+	patterns := make([]string, 0, len(p.MaxSizeByType))
+	for pattern := range p.MaxSizeByType {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	limit, best := p.MaxSize, -1
+	for _, pattern := range patterns {
+		if !matchMediaType(pattern, contentType) {
+			continue
+		}
+		if specificity := mediaTypeSpecificity(pattern); specificity > best {
+			limit, best = p.MaxSizeByType[pattern], specificity
+		}
+	}
+	return limit
+}
+
+// ExpiresAt resolves the expiry of a file uploaded at now. A requested expiry must lie in the future and
+// within the maximum retention, without one the default retention applies. Nil means the file never expires.
+func (p UploadPolicy) ExpiresAt(requested *time.Time, now time.Time) (*time.Time, error) {
+	if requested == nil {
+		if p.DefaultRetention <= 0 {
+			return nil, nil
+		}
+		expiresAt := now.Add(p.DefaultRetention)
+		return &expiresAt, nil
+	}
+
+	if !requested.After(now) {
+		return nil, apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyInvalidExpiry, "the expiry must be in the future", "UploadPolicy - ExpiresAt")
+	}
+	if p.MaxRetention > 0 && requested.After(now.Add(p.MaxRetention)) {
+		return nil, apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyInvalidExpiry, "files cannot be kept longer than %s", "UploadPolicy - ExpiresAt", p.MaxRetention)
+	}
+	return requested, nil
+}
+
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+func matchMediaType(pattern, contentType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*/*" || pattern == contentType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(contentType, prefix+"/")
+	}
+	return false
+}
+
+// mediaTypeSpecificity ranks a media type pattern, an exact type over "type/*" over "*/*".
+func mediaTypeSpecificity(pattern string) int {
+	pattern = strings.TrimSpace(pattern)
+	switch {
+	case pattern == "*/*":
+		return 0
+	case strings.HasSuffix(pattern, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+const _genericContentType = "application/octet-stream"
+
+// executable formats that http.DetectContentType reports as application/octet-stream, Windows executables
+// are told by their PE header, see isPortableExecutable
+var executableSignatures = []struct {
+	magic       []byte
+	contentType string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xca\xfe\xba\xbe"), "application/x-mach-binary"},
+}
+
+// DetectContentType sniffs the media type from the magic bytes of the content.
+// The file extension is only consulted when the content itself is not
+// recognisable, so a renamed binary keeps its real type.
+func DetectContentType(name string, content []byte) string {
+	if isPortableExecutable(content) {
+		return "application/x-msdownload"
+	}
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(content, sig.magic) {
+			return sig.contentType
+		}
+	}
+
+	sniffed := baseMediaType(http.DetectContentType(content))
+	if sniffed != _genericContentType && sniffed != "text/plain" {
+		return sniffed
+	}
+
+	if byExt := baseMediaType(mime.TypeByExtension(strings.ToLower(path.Ext(name)))); byExt != "" {
+		// never let the extension turn binary content into text
+		if sniffed == _genericContentType && strings.HasPrefix(byExt, "text/") {
+			return sniffed
+		}
+		return byExt
+	}
+	return sniffed
+}
+
+// isPortableExecutable reports whether the content is a Windows executable. Plenty of text starts with "MZ",
+// so beyond the DOS header it needs the "PE\0\0" signature at the offset the header points to (e_lfanew).
+func isPortableExecutable(content []byte) bool {
+	const lfanewOffset = 0x3c
+	if len(content) < lfanewOffset+4 || !bytes.HasPrefix(content, []byte("MZ")) {
+		return false
+	}
+	peOffset := int64(binary.LittleEndian.Uint32(content[lfanewOffset:]))
+	if peOffset < lfanewOffset+4 || peOffset+4 > int64(len(content)) {
+		return false
+	}
+	return bytes.Equal(content[peOffset:peOffset+4], []byte("PE\x00\x00"))
+}
+
+func baseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// sanitizeFileName strips any directory components a client may send along with the name.
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContentType(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		fileName string
+		content  []byte
+		expected string
+	}{
+		{"sniffs png magic bytes", "picture.txt", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"sniffs pdf magic bytes", "document", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"sniffs windows executables renamed to pdf", "invoice.pdf", portableExecutable(), "application/x-msdownload"},
+		{"does not take text starting with MZ for an executable", "names.txt", []byte("MZ Smith\nAB Jones\n"), "text/plain"},
+		{"needs the pe signature where the dos header points", "fake.bin", append([]byte("MZ"), make([]byte, 0x7e)...), "application/octet-stream"},
+		{"falls back to the extension for plain text", "report.csv", []byte("a,b,c\n1,2,3\n"), "text/csv"},
+		{"keeps binary content binary", "notes.txt", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DetectContentType(tt.fileName, tt.content))
+		})
+	}
+}
+
+// portableExecutable builds the headers of a minimal Windows executable, the PE signature follows the DOS header.
+func portableExecutable() []byte {
+	content := make([]byte, 0x84)
+	copy(content, "MZ")
+	binary.LittleEndian.PutUint32(content[0x3c:], 0x80)
+	copy(content[0x80:], "PE\x00\x00")
+	return content
+}
+
+func TestUploadPolicy_Check(t *testing.T) {
+
+	policy := UploadPolicy{
+		AllowedTypes:      []string{"image/*", "application/pdf"},
+		BlockedExtensions: []string{"exe", ".bat"},
+		MaxSize:           100,
+		MaxSizeByType:     map[string]int64{"image/*": 50, "image/gif": 10},
+	}
+
+	tests := []struct {
+		name        string
+		fileName    string
+		contentType string
+		size        int64
+		reason      string
+	}{
+		{"allows a permitted type within limits", "scan.pdf", "application/pdf", 100, ""},
+		{"rejects a blocked extension", "setup.EXE", "application/x-msdownload", 1, apperrors.UploadPolicyExtensionBlocked},
+		{"rejects a type that is not allowed", "notes.txt", "text/plain", 1, apperrors.UploadPolicyContentTypeNotAllowed},
+		{"applies the default size limit", "scan.pdf", "application/pdf", 101, apperrors.UploadPolicyFileTooLarge},
+		{"applies the wildcard size limit", "photo.png", "image/png", 51, apperrors.UploadPolicyFileTooLarge},
+		{"prefers the exact type size limit", "anim.gif", "image/gif", 11, apperrors.UploadPolicyFileTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.fileName, tt.contentType, tt.size)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			upve, ok := apperrors.AsUploadPolicyViolationError(err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.reason, upve.Reason)
+		})
+	}
+}
+
+func TestUploadPolicy_sizeLimit(t *testing.T) {
+
+	limits := map[string]int64{"*/*": 80, "IMAGE/*": 60, "image/*": 50, "image/gif": 10}
+
+	tests := []struct {
+		name          string
+		maxSizeByType map[string]int64
+		contentType   string
+		expected      int64
+	}{
+		{"prefers the exact type", limits, "image/gif", 10},
+		{"prefers the wildcard over the catch-all, the first in sorted order among equals", limits, "image/png", 60},
+		{"falls back to the catch-all", limits, "application/pdf", 80},
+		{"falls back to the default without a matching pattern", map[string]int64{"image/*": 50}, "application/pdf", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := UploadPolicy{MaxSize: 100, MaxSizeByType: tt.maxSizeByType}
+			// map iteration order differs between runs, the limit must not
+			for i := 0; i < 20; i++ {
+				assert.Equal(t, tt.expected, policy.sizeLimit(tt.contentType))
+			}
+		})
+	}
+}
+
+func TestUploadPolicy_ExpiresAt(t *testing.T) {
+
+	policy := UploadPolicy{DefaultRetention: 24 * time.Hour, MaxRetention: 72 * time.Hour}
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		policy    UploadPolicy
+		requested *time.Time
+		expected  *time.Time
+		reason    string
+	}{
+		{"applies the default retention", policy, nil, at(24 * time.Hour), ""},
+		{"keeps the file forever without a default retention", UploadPolicy{}, nil, nil, ""},
+		{"accepts an expiry within the maximum retention", policy, at(72 * time.Hour), at(72 * time.Hour), ""},
+		{"rejects an expiry in the past", policy, at(-time.Minute), nil, apperrors.UploadPolicyInvalidExpiry},
+		{"rejects an expiry beyond the maximum retention", policy, at(73 * time.Hour), nil, apperrors.UploadPolicyInvalidExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiresAt, err := tt.policy.ExpiresAt(tt.requested, now)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, expiresAt)
+				return
+			}
+			upve, ok := apperrors.AsUploadPolicyViolationError(err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.reason, upve.Reason)
+		})
+	}
+}
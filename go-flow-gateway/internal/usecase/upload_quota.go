@@ -0,0 +1,51 @@
+package usecase
+
+import (
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+)
+
+// UploadQuota limits how much a single user may upload. A limit of 0 means unlimited.
+type UploadQuota struct {
+	MaxBytes          int64
+	MaxFiles          int64
+	MaxUploadsPerHour int64
+	MaxResendsPerHour int64
+	MaxUploadSessions int64 // open resumable uploads
+}
+
+func (q UploadQuota) enabled() bool {
+	return q.MaxBytes > 0 || q.MaxFiles > 0 || q.MaxUploadsPerHour > 0 || q.MaxUploadSessions > 0
+}
+
+// Check validates that storing newBytes more for one more file stays within the quota. The bytes
+// reserved by open upload sessions count as stored.
+func (q UploadQuota) Check(usage entity.StorageUsage, newBytes int64) error {
+	if q.MaxUploadsPerHour > 0 && usage.UploadsLastHour >= q.MaxUploadsPerHour {
+		return apperrors.NewQuotaExceededError(apperrors.QuotaUploadRateExceeded, "no more than %d uploads per hour are allowed", "UploadQuota - Check", q.MaxUploadsPerHour)
+	}
+	if q.MaxFiles > 0 && usage.FileCount >= q.MaxFiles {
+		return apperrors.NewQuotaExceededError(apperrors.QuotaFileCountExceeded, "no more than %d files can be stored", "UploadQuota - Check", q.MaxFiles)
+	}
+	if q.MaxBytes > 0 && usage.BytesStored+usage.BytesReserved+newBytes > q.MaxBytes {
+		return apperrors.NewQuotaExceededError(apperrors.QuotaStorageExceeded, "no more than %d bytes can be stored", "UploadQuota - Check", q.MaxBytes)
+	}
+	return nil
+}
+
+// CheckUploadSession validates that one more upload session may be opened and that its declared size
+// fits into the quota.
+func (q UploadQuota) CheckUploadSession(usage entity.StorageUsage, size int64) error {
+	if q.MaxUploadSessions > 0 && usage.UploadSessions >= q.MaxUploadSessions {
+		return apperrors.NewQuotaExceededError(apperrors.QuotaUploadSessionsExceeded, "no more than %d uploads can be in progress", "UploadQuota - CheckUploadSession", q.MaxUploadSessions)
+	}
+	return q.Check(usage, size)
+}
+
+// CheckResend validates that one more email can be resent after resendsLastHour.
+func (q UploadQuota) CheckResend(resendsLastHour int64) error {
+	if q.MaxResendsPerHour > 0 && resendsLastHour >= q.MaxResendsPerHour {
+		return apperrors.NewQuotaExceededError(apperrors.QuotaResendRateExceeded, "no more than %d resends per hour are allowed", "UploadQuota - CheckResend", q.MaxResendsPerHour)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+// UploadSessionUseCase implements resumable uploads. Content arrives in chunks that are stored as
+// blobs, and a finalised session becomes a regular UserUploadedFile.
+type UploadSessionUseCase struct {
+	repo   UploadSessionRepo
+	files  UserUploadedFile
+	policy UploadPolicy
+	quota  UploadQuota
+	ttl    time.Duration
+	logger logger.Logger
+}
+
+func NewUploadSessionUseCase(r UploadSessionRepo, f UserUploadedFile, policy UploadPolicy, quota UploadQuota, ttl time.Duration, l logger.Logger) *UploadSessionUseCase {
+	return &UploadSessionUseCase{repo: r, files: f, policy: policy, quota: quota, ttl: ttl, logger: l}
+}
+
+func (uc *UploadSessionUseCase) Create(ctx context.Context, uploadSession entity.UploadSession) (entity.UploadSession, error) {
+	uploadSession.Name = sanitizeFileName(uploadSession.Name)
+
+	// the content is not known yet, reject what the name and declared size already rule out
+	err := uc.policy.Check(uploadSession.Name, DetectContentType(uploadSession.Name, nil), uploadSession.Size)
+	if err != nil {
+		uc.logger.Warn("UploadSessionUseCase - Create - policy.Check : upload rejected by policy", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - Create - uc.policy.Check: %w", err)
+	}
+
+	uploadSession.ID, err = newUploadSessionID()
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - Create - newUploadSessionID : error generating session id", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - Create - newUploadSessionID: %w", err)
+	}
+	now := time.Now()
+	expiresAt := now.Add(uc.ttl)
+	uploadSession.Offset = 0
+	uploadSession.Status = entity.UploadSessionStatusOpen
+	uploadSession.CreatedAt = &now
+	uploadSession.ExpiresAt = &expiresAt
+
+	err = uc.repo.Create(ctx, uploadSession, uc.admitQuota(uploadSession))
+	if err != nil {
+		if apperrors.IsQuotaExceededError(err) {
+			return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - Create - s.repo.Create: %w", err)
+		}
+		uc.logger.Error("UploadSessionUseCase - Create - repo.Create : error creating upload session", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - Create - s.repo.Create: %w", err)
+	}
+
+	uc.logger.Info("UploadSessionUseCase - Create : upload session created", "uploadSessionID", uploadSession.ID)
+	return uploadSession, nil
+}
+
+func (uc *UploadSessionUseCase) GetByID(ctx context.Context, uploadSessionID string, userID int) (entity.UploadSession, error) {
+	uploadSession, err := uc.repo.GetByID(ctx, uploadSessionID, userID)
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - GetByID - repo.GetByID : error getting upload session", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - GetByID - s.repo.GetByID: %w", err)
+	}
+	return uploadSession, nil
+}
+
+// AppendChunk stores a chunk written at offset. The offset must equal the number of bytes received so
+// far, otherwise an UploadOffsetMismatchError carrying the current offset is returned.
+// Every accepted chunk extends the expiry of the session.
+func (uc *UploadSessionUseCase) AppendChunk(ctx context.Context, uploadSessionID string, userID int, offset int64, chunk []byte) (entity.UploadSession, error) {
+	uploadSession, err := uc.repo.GetByID(ctx, uploadSessionID, userID)
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - AppendChunk - repo.GetByID : error getting upload session", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - AppendChunk - s.repo.GetByID: %w", err)
+	}
+
+	if offset != uploadSession.Offset {
+		return entity.UploadSession{}, apperrors.NewUploadOffsetMismatchError(uploadSession.Offset, "expected offset %d but got %d", "UploadSessionUseCase - AppendChunk", uploadSession.Offset, offset)
+	}
+	if offset+int64(len(chunk)) > uploadSession.Size {
+		return entity.UploadSession{}, apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyFileTooLarge, "chunk exceeds the declared size of %d bytes", "UploadSessionUseCase - AppendChunk", uploadSession.Size)
+	}
+	if len(chunk) == 0 {
+		return uploadSession, nil
+	}
+
+	expiresAt := time.Now().Add(uc.ttl)
+	newOffset, err := uc.repo.AppendChunk(ctx, uploadSessionID, userID, offset, chunk, Checksum(chunk), expiresAt)
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			// another request advanced the offset in the meantime
+			return entity.UploadSession{}, apperrors.NewUploadOffsetMismatchError(uploadSession.Offset, "offset %d has already been written", "UploadSessionUseCase - AppendChunk", offset)
+		}
+		uc.logger.Error("UploadSessionUseCase - AppendChunk - repo.AppendChunk : error storing chunk", "error", err)
+		return entity.UploadSession{}, fmt.Errorf("UploadSessionUseCase - AppendChunk - s.repo.AppendChunk: %w", err)
+	}
+
+	uploadSession.Offset = newOffset
+	uploadSession.ExpiresAt = &expiresAt
+	return uploadSession, nil
+}
+
+// Finalize turns a complete session into a UserUploadedFile, which then goes through the regular
+// publish and email flow. The session is claimed first, so concurrent requests cannot create the file
+// twice, and released again when the file cannot be created. It is deleted with its chunks afterwards.
+func (uc *UploadSessionUseCase) Finalize(ctx context.Context, uploadSessionID string, userID int) (entity.UserUploadedFile, error) {
+	uploadSession, err := uc.repo.GetByID(ctx, uploadSessionID, userID)
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - Finalize - repo.GetByID : error getting upload session", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UploadSessionUseCase - Finalize - s.repo.GetByID: %w", err)
+	}
+
+	if !uploadSession.Complete() {
+		return entity.UserUploadedFile{}, apperrors.NewUploadIncompleteError("received %d of %d bytes", "UploadSessionUseCase - Finalize", uploadSession.Offset, uploadSession.Size)
+	}
+
+	err = uc.repo.Claim(ctx, uploadSessionID, userID)
+	if err != nil {
+		if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("UploadSessionUseCase - Finalize - repo.Claim : error claiming upload session", "error", err)
+		}
+		return entity.UserUploadedFile{}, fmt.Errorf("UploadSessionUseCase - Finalize - s.repo.Claim: %w", err)
+	}
+
+	userUploadedFile, err := uc.createFile(ctx, uploadSession)
+	if err != nil {
+		releaseErr := uc.repo.Release(ctx, uploadSessionID)
+		if releaseErr != nil {
+			// the session stays claimed and is purged once it expires
+			uc.logger.Error("UploadSessionUseCase - Finalize - repo.Release : error releasing upload session", "error", releaseErr, "uploadSessionID", uploadSessionID)
+		}
+		return entity.UserUploadedFile{}, fmt.Errorf("UploadSessionUseCase - Finalize - uc.createFile: %w", err)
+	}
+
+	err = uc.repo.Delete(ctx, uploadSessionID)
+	if err != nil {
+		// the session stays claimed so it cannot be finalised again, the janitor purges it once it expires
+		uc.logger.Error("UploadSessionUseCase - Finalize - repo.Delete : error deleting upload session", "error", err, "uploadSessionID", uploadSessionID)
+	}
+
+	uc.logger.Info("UploadSessionUseCase - Finalize : upload session finalised", "uploadSessionID", uploadSessionID, "userUploadedFileID", userUploadedFile.ID)
+	return userUploadedFile, nil
+}
+
+// createFile creates the file from the content received by a claimed session.
+func (uc *UploadSessionUseCase) createFile(ctx context.Context, uploadSession entity.UploadSession) (entity.UserUploadedFile, error) {
+	content, err := uc.repo.GetContent(ctx, uploadSession.ID)
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - createFile - repo.GetContent : error reading upload session content", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UploadSessionUseCase - createFile - s.repo.GetContent: %w", err)
+	}
+
+	userUploadedFile, err := uc.files.Create(ctx, entity.UserUploadedFile{
+		Name:           uploadSession.Name,
+		Size:           int64(len(content)),
+		Content:        content,
+		UserID:         uploadSession.UserID,
+		EmailRecipient: uploadSession.EmailRecipient,
+	})
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - createFile - files.Create : error creating user uploaded file", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UploadSessionUseCase - createFile - s.files.Create: %w", err)
+	}
+	return userUploadedFile, nil
+}
+
+// PurgeExpired releases the sessions that have been abandoned.
+func (uc *UploadSessionUseCase) PurgeExpired(ctx context.Context) error {
+	err := uc.repo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		uc.logger.Error("UploadSessionUseCase - PurgeExpired - repo.DeleteExpired : error deleting expired upload sessions", "error", err)
+		return fmt.Errorf("UploadSessionUseCase - PurgeExpired - s.repo.DeleteExpired: %w", err)
+	}
+	return nil
+}
+
+func newUploadSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// admitQuota returns the check the repo runs on the usage of the user before opening the session. The
+// declared size is reserved until the session is finalised, so it must fit into the remaining quota.
+// It is nil when no quota is set.
+func (uc *UploadSessionUseCase) admitQuota(uploadSession entity.UploadSession) func(usage entity.StorageUsage) error {
+	if !uc.quota.enabled() {
+		return nil
+	}
+
+	return func(usage entity.StorageUsage) error {
+		err := uc.quota.CheckUploadSession(usage, uploadSession.Size)
+		if err != nil {
+			uc.logger.Warn("UploadSessionUseCase - admitQuota - quota.CheckUploadSession : upload session rejected by quota", "userID", uploadSession.UserID, "error", err)
+			return fmt.Errorf("UploadSessionUseCase - admitQuota - uc.quota.CheckUploadSession: %w", err)
+		}
+		return nil
+	}
+}
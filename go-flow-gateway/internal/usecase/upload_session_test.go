@@ -0,0 +1,355 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockUploadSessionRepo struct {
+	mock.Mock
+}
+
+func (m *MockUploadSessionRepo) Create(ctx context.Context, s entity.UploadSession, admit func(usage entity.StorageUsage) error) error {
+	if admit != nil {
+		usage, err := m.GetUsage(ctx, s.UserID)
+		if err != nil {
+			return err
+		}
+		if err := admit(usage); err != nil {
+			return err
+		}
+	}
+	args := m.Called(ctx, s)
+	return args.Error(0)
+}
+
+// GetUsage stands in for the usage the repo reads under the lock of the user.
+func (m *MockUploadSessionRepo) GetUsage(ctx context.Context, userID int) (entity.StorageUsage, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(entity.StorageUsage), args.Error(1)
+}
+
+func (m *MockUploadSessionRepo) GetByID(ctx context.Context, id string, userID int) (entity.UploadSession, error) {
+	args := m.Called(ctx, id, userID)
+	return args.Get(0).(entity.UploadSession), args.Error(1)
+}
+
+func (m *MockUploadSessionRepo) AppendChunk(ctx context.Context, id string, userID int, offset int64, chunk []byte, checksum string, expiresAt time.Time) (int64, error) {
+	args := m.Called(ctx, id, userID, offset, chunk, checksum, expiresAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUploadSessionRepo) Claim(ctx context.Context, id string, userID int) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockUploadSessionRepo) Release(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUploadSessionRepo) GetContent(ctx context.Context, id string) ([]byte, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockUploadSessionRepo) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUploadSessionRepo) DeleteExpired(ctx context.Context, before time.Time) error {
+	args := m.Called(ctx, before)
+	return args.Error(0)
+}
+
+func setupUploadSessionUseCase(t *testing.T) (*UploadSessionUseCase, *MockUploadSessionRepo, *MockUserUploadedFileUseCase) {
+	t.Helper()
+
+	mockRepo := new(MockUploadSessionRepo)
+	mockFiles := new(MockUserUploadedFileUseCase)
+	uc := NewUploadSessionUseCase(mockRepo, mockFiles, UploadPolicy{}, UploadQuota{}, time.Hour, logger.New("debug"))
+	return uc, mockRepo, mockFiles
+}
+
+func TestUploadSessionUseCase_Create(t *testing.T) {
+
+	const userID = 123
+
+	t.Run("Create upload session successfully", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("Create", ctx, mock.MatchedBy(func(s entity.UploadSession) bool {
+			return len(s.ID) == 32 && s.Name == "report.pdf" && s.Offset == 0 && s.ExpiresAt != nil
+		})).Return(nil)
+
+		// Act
+		result, err := uc.Create(ctx, entity.UploadSession{UserID: userID, Name: "../report.pdf", Size: 100, EmailRecipient: "johndoe@email.com"})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, "report.pdf", result.Name)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reject upload session over the size limit", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		uc.policy = UploadPolicy{MaxSize: 10}
+		ctx := context.Background()
+
+		// Act
+		_, err := uc.Create(ctx, entity.UploadSession{UserID: userID, Name: "report.pdf", Size: 100})
+
+		// Assert
+		upve, ok := apperrors.AsUploadPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.UploadPolicyFileTooLarge, upve.Reason)
+		mockRepo.AssertNotCalled(t, "Create")
+	})
+
+	t.Run("Reject upload session whose declared size exceeds the remaining quota", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		uc.quota = UploadQuota{MaxBytes: 1000}
+		ctx := context.Background()
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{BytesStored: 600, BytesReserved: 300}, nil)
+
+		// Act
+		_, err := uc.Create(ctx, entity.UploadSession{UserID: userID, Name: "report.pdf", Size: 101})
+
+		// Assert
+		qee, ok := apperrors.AsQuotaExceededError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.QuotaStorageExceeded, qee.Reason, "Bytes reserved by open sessions count against the quota")
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Reject upload session when too many uploads are in progress", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		uc.quota = UploadQuota{MaxUploadSessions: 2}
+		ctx := context.Background()
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{UploadSessions: 2}, nil)
+
+		// Act
+		_, err := uc.Create(ctx, entity.UploadSession{UserID: userID, Name: "report.pdf", Size: 100})
+
+		// Assert
+		qee, ok := apperrors.AsQuotaExceededError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.QuotaUploadSessionsExceeded, qee.Reason)
+		mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Create upload session within the quota", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		uc.quota = UploadQuota{MaxBytes: 1000, MaxUploadSessions: 2}
+		ctx := context.Background()
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{BytesStored: 600, BytesReserved: 300, UploadSessions: 1}, nil)
+		mockRepo.On("Create", ctx, mock.AnythingOfType("entity.UploadSession")).Return(nil)
+
+		// Act
+		_, err := uc.Create(ctx, entity.UploadSession{UserID: userID, Name: "report.pdf", Size: 100})
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUploadSessionUseCase_AppendChunk(t *testing.T) {
+
+	const (
+		ID     = "0123456789abcdef0123456789abcdef"
+		userID = 123
+	)
+	chunk := []byte("chunk")
+
+	t.Run("Append chunk successfully", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Size: 10, Offset: 5}, nil)
+		mockRepo.On("AppendChunk", ctx, ID, userID, int64(5), chunk, Checksum(chunk), mock.AnythingOfType("time.Time")).Return(int64(10), nil)
+
+		// Act
+		result, err := uc.AppendChunk(ctx, ID, userID, 5, chunk)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), result.Offset)
+		assert.True(t, result.Complete())
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reject chunk at the wrong offset", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Size: 10, Offset: 5}, nil)
+
+		// Act
+		_, err := uc.AppendChunk(ctx, ID, userID, 0, chunk)
+
+		// Assert
+		uome, ok := apperrors.AsUploadOffsetMismatchError(err)
+		assert.True(t, ok)
+		assert.Equal(t, int64(5), uome.Offset)
+		mockRepo.AssertNotCalled(t, "AppendChunk")
+	})
+
+	t.Run("Reject chunk beyond the declared size", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Size: 8, Offset: 5}, nil)
+
+		// Act
+		_, err := uc.AppendChunk(ctx, ID, userID, 5, chunk)
+
+		// Assert
+		assert.True(t, apperrors.IsUploadPolicyViolationError(err))
+		mockRepo.AssertNotCalled(t, "AppendChunk")
+	})
+
+	t.Run("Reject chunk when another request advanced the offset", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Size: 10, Offset: 5}, nil)
+		mockRepo.On("AppendChunk", ctx, ID, userID, int64(5), chunk, Checksum(chunk), mock.AnythingOfType("time.Time")).Return(int64(0), apperrors.NewNoRowsAffectedError("test", "test"))
+
+		// Act
+		_, err := uc.AppendChunk(ctx, ID, userID, 5, chunk)
+
+		// Assert
+		assert.True(t, apperrors.IsUploadOffsetMismatchError(err))
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUploadSessionUseCase_Finalize(t *testing.T) {
+
+	const (
+		ID     = "0123456789abcdef0123456789abcdef"
+		userID = 123
+	)
+
+	t.Run("Finalize upload session successfully", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockFiles := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+		content := []byte("dummy file content")
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Name: "test.txt", Size: int64(len(content)), Offset: int64(len(content)), EmailRecipient: "johndoe@email.com"}, nil)
+		mockRepo.On("Claim", ctx, ID, userID).Return(nil)
+		mockRepo.On("GetContent", ctx, ID).Return(content, nil)
+		file := entity.UserUploadedFile{Name: "test.txt", Size: int64(len(content)), Content: content, UserID: userID, EmailRecipient: "johndoe@email.com"}
+		created := file
+		created.ID = 1
+		mockFiles.On("Create", ctx, file).Return(created, nil)
+		mockRepo.On("Delete", ctx, ID).Return(nil)
+
+		// Act
+		result, err := uc.Finalize(ctx, ID, userID)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, created, result)
+		mockRepo.AssertExpectations(t)
+		mockFiles.AssertExpectations(t)
+	})
+
+	t.Run("Reject finalizing an incomplete upload session", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockFiles := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Size: 10, Offset: 5}, nil)
+
+		// Act
+		_, err := uc.Finalize(ctx, ID, userID)
+
+		// Assert
+		assert.True(t, apperrors.IsUploadIncompleteError(err))
+		mockFiles.AssertNotCalled(t, "Create")
+	})
+
+	t.Run("Reject finalizing an upload session claimed by another request", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockFiles := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Size: 10, Offset: 10}, nil)
+		mockRepo.On("Claim", ctx, ID, userID).Return(apperrors.NewNoRowsAffectedError("upload session not found or already being finalised", "test"))
+
+		// Act
+		_, err := uc.Finalize(ctx, ID, userID)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		mockRepo.AssertNotCalled(t, "GetContent", mock.Anything, mock.Anything)
+		mockFiles.AssertNotCalled(t, "Create")
+	})
+
+	t.Run("Keep the upload session when the file cannot be created", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockFiles := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+		content := []byte("dummy file content")
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Name: "test.txt", Size: int64(len(content)), Offset: int64(len(content))}, nil)
+		mockRepo.On("Claim", ctx, ID, userID).Return(nil)
+		mockRepo.On("GetContent", ctx, ID).Return(content, nil)
+		mockFiles.On("Create", ctx, mock.Anything).Return(entity.UserUploadedFile{}, assert.AnError)
+		mockRepo.On("Release", ctx, ID).Return(nil)
+
+		// Act
+		_, err := uc.Finalize(ctx, ID, userID)
+
+		// Assert
+		assert.Error(t, err)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "Delete")
+	})
+
+	t.Run("Return the file when the finalised session cannot be deleted", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockFiles := setupUploadSessionUseCase(t)
+		ctx := context.Background()
+		content := []byte("dummy file content")
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UploadSession{ID: ID, UserID: userID, Name: "test.txt", Size: int64(len(content)), Offset: int64(len(content))}, nil)
+		mockRepo.On("Claim", ctx, ID, userID).Return(nil)
+		mockRepo.On("GetContent", ctx, ID).Return(content, nil)
+		mockFiles.On("Create", ctx, mock.Anything).Return(entity.UserUploadedFile{ID: 1}, nil)
+		mockRepo.On("Delete", ctx, ID).Return(assert.AnError)
+
+		// Act
+		result, err := uc.Finalize(ctx, ID, userID)
+
+		// Assert
+		assert.NoError(t, err, "The file is created, the claimed session is purged once it expires")
+		assert.Equal(t, 1, result.ID)
+		mockRepo.AssertNotCalled(t, "Release", mock.Anything, mock.Anything)
+	})
+}
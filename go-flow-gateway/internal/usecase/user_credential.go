@@ -3,6 +3,8 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
 	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
@@ -10,23 +12,55 @@ import (
 )
 
 type UserCredentialUseCase struct {
-	repo        UserCredentialRepo
-	hasher      PasswordHasher
-	userProfile UserProfile
-	logger      logger.Logger
+	repo         UserCredentialRepo
+	hasher       PasswordHasher
+	userProfile  UserProfile
+	verification EmailVerification
+	policy       PasswordPolicy
+	breached     BreachedPasswords
+	attempts     LoginAttemptRepo
+	throttle     LoginThrottle
+	factors      TwoFactorRepo
+	logger       logger.Logger
+
+	// dummyHash is compared against when a username does not exist, so that it takes as long as a wrong password
+	dummyHash string
 }
 
-func NewUserCredentialUseCase(repo UserCredentialRepo, hasher PasswordHasher, userProfile UserProfile, logger logger.Logger) *UserCredentialUseCase {
-	return &UserCredentialUseCase{
-		repo:        repo,
-		hasher:      hasher,
-		userProfile: userProfile,
-		logger:      logger,
+// _dummyPassword is hashed into the dummy hash of the use case.
+const _dummyPassword = "go-flow-gateway dummy password"
+
+// NewUserCredentialUseCase hashes the dummy password a login of an unknown username is compared against,
+// an error leaves no use case, so such logins never answer faster than a wrong password.
+func NewUserCredentialUseCase(repo UserCredentialRepo, hasher PasswordHasher, userProfile UserProfile, verification EmailVerification, policy PasswordPolicy, breached BreachedPasswords, attempts LoginAttemptRepo, throttle LoginThrottle, factors TwoFactorRepo, logger logger.Logger) (*UserCredentialUseCase, error) {
+	dummyHash, err := hasher.GenerateHash(context.Background(), _dummyPassword)
+	if err != nil {
+		return nil, fmt.Errorf("UserCredentialUseCase - NewUserCredentialUseCase - hasher.GenerateHash: %w", err)
 	}
+
+	return &UserCredentialUseCase{
+		repo:         repo,
+		hasher:       hasher,
+		userProfile:  userProfile,
+		verification: verification,
+		policy:       policy,
+		breached:     breached,
+		attempts:     attempts,
+		throttle:     throttle,
+		factors:      factors,
+		logger:       logger,
+		dummyHash:    dummyHash,
+	}, nil
 }
 
-func (uc *UserCredentialUseCase) Register(ctx context.Context, displayName, username, password string) (int, error) {
-	_, err := uc.repo.GetByUsername(ctx, username)
+// Register creates a local account and emails a link verifying its email.
+func (uc *UserCredentialUseCase) Register(ctx context.Context, displayName, username, password, email string) (int, error) {
+	err := uc.checkPassword(ctx, username, password)
+	if err != nil {
+		return 0, fmt.Errorf("UserCredentialUseCase - Register - checkPassword: %w", err)
+	}
+
+	_, err = uc.repo.GetByUsername(ctx, username)
 	if err == nil {
 		uc.logger.Warn("UserCredentialUseCase - Register: duplicate username found", "username", username)
 		return 0, fmt.Errorf("UserCredentialUseCase - Register - GetByUsername: has duplicate username")
@@ -54,6 +88,7 @@ func (uc *UserCredentialUseCase) Register(ctx context.Context, displayName, user
 		UserID:       up.UserID,
 		Username:     username,
 		PasswordHash: hashedPassword,
+		Email:        strings.ToLower(strings.TrimSpace(email)),
 	}
 	err = uc.repo.Create(ctx, u)
 	if err != nil {
@@ -61,6 +96,12 @@ func (uc *UserCredentialUseCase) Register(ctx context.Context, displayName, user
 		return 0, fmt.Errorf("UserCredentialUseCase - Register - repo.Create: %w", err)
 	}
 
+	// the account exists already, the user can ask for another email
+	err = uc.verification.Send(ctx, u)
+	if err != nil {
+		uc.logger.Error("UserCredentialUseCase - Register - verification.Send: error sending verification email", "error", err, "userID", up.UserID)
+	}
+
 	uc.logger.Info("UserCredentialUseCase - Register: user registered", "userID", up.UserID)
 	return up.UserID, nil
 }
@@ -76,18 +117,118 @@ func (uc *UserCredentialUseCase) GetByUsername(ctx context.Context, username str
 	return u, nil
 }
 
-func (uc *UserCredentialUseCase) Login(ctx context.Context, username, password string) (entity.UserCredential, error) {
-	u, err := uc.GetByUsername(ctx, username)
+// Login checks a username and password. Unknown usernames and wrong passwords fail alike with an
+// InvalidCredentialsError, in about the same time, so that usernames cannot be enumerated. Repeated
+// failures for a username or from an IP block further attempts with a LoginThrottledError.
+func (uc *UserCredentialUseCase) Login(ctx context.Context, username, password, ip string) (entity.UserCredential, error) {
+	keys := loginAttemptKeys(username, ip)
+
+	retryAfter, err := uc.loginBlockedFor(ctx, keys)
 	if err != nil {
-		return entity.UserCredential{}, fmt.Errorf("UserCredentialUseCase - Login - GetByUsername: %w", err)
+		return entity.UserCredential{}, fmt.Errorf("UserCredentialUseCase - Login - loginBlockedFor: %w", err)
+	}
+	if retryAfter > 0 {
+		uc.logger.Warn("UserCredentialUseCase - Login : login attempt blocked", "username", username, "ip", ip, "retryAfter", retryAfter)
+		return entity.UserCredential{}, apperrors.NewLoginThrottledError(retryAfter, "too many failed login attempts, try again later", "UserCredentialUseCase - Login")
 	}
 
-	err = uc.hasher.CompareHash(ctx, password, u.PasswordHash)
-	if err != nil {
-		uc.logger.Error("UserCredentialUseCase - Login - CompareHash: failed to compare hash", "error", err)
-		return entity.UserCredential{}, fmt.Errorf("UserCredentialUseCase - Login - CompareHash: %w", err)
+	u, err := uc.repo.GetByUsername(ctx, username)
+	if err != nil && !apperrors.IsNoRowsAffectedError(err) {
+		uc.logger.Error("UserCredentialUseCase - Login - repo.GetByUsername : error getting user credential", "error", err)
+		return entity.UserCredential{}, fmt.Errorf("UserCredentialUseCase - Login - repo.GetByUsername: %w", err)
+	}
+	found := err == nil
+
+	hash := u.PasswordHash
+	if !found {
+		hash = uc.dummyHash
+	}
+	err = uc.hasher.CompareHash(ctx, password, hash)
+	if !found || err != nil {
+		uc.logger.Warn("UserCredentialUseCase - Login : invalid credentials", "username", username, "ip", ip)
+		uc.recordLoginFailure(ctx, keys)
+		return entity.UserCredential{}, apperrors.NewInvalidCredentialsError("invalid username or password", "UserCredentialUseCase - Login")
+	}
+
+	// a user with a second factor is forgiven once it is passed, wrong codes count as failures as well
+	if uc.attempts != nil && uc.throttle.enabled() && !uc.hasSecondFactor(ctx, u.UserID) {
+		// only the username is forgiven, an IP could otherwise reset its count with an account of its own
+		err = uc.attempts.Reset(ctx, keys.username)
+		if err != nil {
+			uc.logger.Error("UserCredentialUseCase - Login - attempts.Reset : error resetting failed attempts", "error", err, "userID", u.UserID)
+		}
 	}
 
 	uc.logger.Info("UserCredentialUseCase - Login: user logged in", "userID", u.UserID)
 	return u, nil
 }
+
+type loginKeys struct {
+	username string
+	ip       string
+}
+
+func loginAttemptKeys(username, ip string) loginKeys {
+	return loginKeys{username: loginUsernameKey(username), ip: "ip:" + ip}
+}
+
+// loginBlockedFor returns how long logins with the keys remain blocked, the longest of their blocks.
+func (uc *UserCredentialUseCase) loginBlockedFor(ctx context.Context, keys loginKeys) (time.Duration, error) {
+	if uc.attempts == nil || !uc.throttle.enabled() {
+		return 0, nil
+	}
+
+	var longest time.Duration
+	for _, key := range []string{keys.username, keys.ip} {
+		blocked, err := uc.attempts.BlockedFor(ctx, key)
+		if err != nil {
+			uc.logger.Error("UserCredentialUseCase - loginBlockedFor - attempts.BlockedFor : error reading login block", "error", err, "key", key)
+			return 0, fmt.Errorf("UserCredentialUseCase - loginBlockedFor - attempts.BlockedFor: %w", err)
+		}
+		longest = max(longest, blocked)
+	}
+	return longest, nil
+}
+
+// recordLoginFailure counts a failed login and blocks the username or the IP once they have failed too
+// often. Errors are only logged, the login has failed already.
+func (uc *UserCredentialUseCase) recordLoginFailure(ctx context.Context, keys loginKeys) {
+	if uc.attempts == nil || !uc.throttle.enabled() {
+		return
+	}
+
+	recordLoginFailure(ctx, uc.attempts, uc.throttle.Window, keys.username, uc.throttle.usernameBlock, uc.logger)
+	recordLoginFailure(ctx, uc.attempts, uc.throttle.Window, keys.ip, uc.throttle.ipBlock, uc.logger)
+}
+
+// hasSecondFactor reports whether the user has to give a second factor after their password. A factor
+// that cannot be read counts as enabled, so the failures of the user are not forgiven too early.
+func (uc *UserCredentialUseCase) hasSecondFactor(ctx context.Context, userID int) bool {
+	if uc.factors == nil {
+		return false
+	}
+	f, err := uc.factors.GetFactor(ctx, userID)
+	if apperrors.IsNoRowsAffectedError(err) {
+		return false
+	}
+	if err != nil {
+		uc.logger.Error("UserCredentialUseCase - hasSecondFactor - factors.GetFactor : error getting factor", "error", err, "userID", userID)
+		return true
+	}
+	return f.ConfirmedAt != nil
+}
+
+// checkPassword validates a password chosen by a user against the policy, every broken rule is reported
+// in one PasswordPolicyViolationError.
+func (uc *UserCredentialUseCase) checkPassword(ctx context.Context, username, password string) error {
+	err := uc.policy.check(ctx, uc.breached, "Password", username, password)
+	if apperrors.IsPasswordPolicyViolationError(err) {
+		uc.logger.Warn("UserCredentialUseCase - checkPassword : password rejected by the policy", "username", username)
+		return err
+	}
+	if err != nil {
+		uc.logger.Error("UserCredentialUseCase - checkPassword - policy.check : error checking password", "error", err)
+		return fmt.Errorf("UserCredentialUseCase - checkPassword - policy.check: %w", err)
+	}
+	return nil
+}
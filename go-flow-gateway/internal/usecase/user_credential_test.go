@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
 	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
@@ -19,6 +20,42 @@ type MockPasswordHasher struct {
 	mock.Mock
 }
 
+type MockLoginAttemptRepo struct {
+	mock.Mock
+}
+
+func (m *MockLoginAttemptRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	args := m.Called(ctx, key, window)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLoginAttemptRepo) Block(ctx context.Context, key string, d time.Duration) error {
+	args := m.Called(ctx, key, d)
+	return args.Error(0)
+}
+
+func (m *MockLoginAttemptRepo) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockLoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+type MockBreachedPasswords struct {
+	mock.Mock
+}
+
+func (m *MockBreachedPasswords) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	args := m.Called(ctx, prefix)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int), args.Error(1)
+}
+
 func (m *MockUserCredentialRepo) Create(ctx context.Context, userCredential entity.UserCredential) error {
 	args := m.Called(ctx, userCredential)
 	return args.Error(0)
@@ -29,6 +66,21 @@ func (m *MockUserCredentialRepo) GetByUsername(ctx context.Context, username str
 	return args.Get(0).(entity.UserCredential), args.Error(1)
 }
 
+func (m *MockUserCredentialRepo) GetByUserID(ctx context.Context, userID int) (entity.UserCredential, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(entity.UserCredential), args.Error(1)
+}
+
+func (m *MockUserCredentialRepo) GetByEmail(ctx context.Context, email string) (entity.UserCredential, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(entity.UserCredential), args.Error(1)
+}
+
+func (m *MockUserCredentialRepo) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	args := m.Called(ctx, userID, passwordHash)
+	return args.Error(0)
+}
+
 func (m *MockPasswordHasher) GenerateHash(ctx context.Context, password string) (string, error) {
 	args := m.Called(ctx, password)
 	return args.String(0), args.Error(1)
@@ -44,10 +96,30 @@ func setupUserCredentialUsecase(t *testing.T) (UserCredential, *MockUserCredenti
 	mockRepo := new(MockUserCredentialRepo)
 	mockHasher := new(MockPasswordHasher)
 	mockUserProfileUseCase := new(MockUserProfileUseCase)
-	uc := NewUserCredentialUseCase(mockRepo, mockHasher, mockUserProfileUseCase, logger.New("debug"))
+	mockVerification := new(MockEmailVerificationUseCase)
+	mockVerification.On("Send", mock.Anything, mock.Anything).Return(nil)
+	mockHasher.On("GenerateHash", mock.Anything, _dummyPassword).Return("$2a$10$dummy", nil)
+	uc, err := NewUserCredentialUseCase(mockRepo, mockHasher, mockUserProfileUseCase, mockVerification, PasswordPolicy{}, nil, nil, LoginThrottle{}, nil, logger.New("debug"))
+	assert.NoError(t, err)
 	return uc, mockRepo, mockHasher, mockUserProfileUseCase
 }
 
+func TestNewUserCredentialUseCase(t *testing.T) {
+
+	t.Run("fails when the dummy hash cannot be generated", func(t *testing.T) {
+		// Arrange
+		mockHasher := new(MockPasswordHasher)
+		mockHasher.On("GenerateHash", mock.Anything, _dummyPassword).Return("", assert.AnError)
+
+		// Act
+		uc, err := NewUserCredentialUseCase(new(MockUserCredentialRepo), mockHasher, new(MockUserProfileUseCase), new(MockEmailVerificationUseCase), PasswordPolicy{}, nil, nil, LoginThrottle{}, nil, logger.New("debug"))
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Nil(t, uc, "No use case should be returned without a dummy hash")
+	})
+}
+
 func TestUserCredentialUsecase_Register(t *testing.T) {
 
 	const (
@@ -56,6 +128,7 @@ func TestUserCredentialUsecase_Register(t *testing.T) {
 		password       = "test"
 		hashedPassword = "$2a$10"
 		userID         = 123
+		email          = "Hank@Mail.com "
 	)
 
 	t.Run("user registered successfully", func(t *testing.T) {
@@ -68,6 +141,7 @@ func TestUserCredentialUsecase_Register(t *testing.T) {
 			UserID:       userID,
 			Username:     username,
 			PasswordHash: hashedPassword,
+			Email:        "hank@mail.com",
 		}
 
 		mockRepo.On("GetByUsername", ctx, username).Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("test", "test"))
@@ -79,7 +153,7 @@ func TestUserCredentialUsecase_Register(t *testing.T) {
 		mockHasher.On("GenerateHash", ctx, password).Return(hashedPassword, nil)
 		mockRepo.On("Create", ctx, userCredential).Return(nil)
 
-		gotUserID, err := uc.Register(ctx, displayName, username, password)
+		gotUserID, err := uc.Register(ctx, displayName, username, password, email)
 
 		assert.NoError(t, err)
 		assert.Equal(t, userID, gotUserID)
@@ -98,6 +172,7 @@ func TestUserCredentialUsecase_Register(t *testing.T) {
 			UserID:       userID,
 			Username:     username,
 			PasswordHash: hashedPassword,
+			Email:        "hank@mail.com",
 		}
 
 		mockRepo.On("GetByUsername", ctx, username).Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("test", "test"))
@@ -109,7 +184,7 @@ func TestUserCredentialUsecase_Register(t *testing.T) {
 		mockHasher.On("GenerateHash", ctx, password).Return(hashedPassword, nil)
 		mockRepo.On("Create", ctx, userCredential).Return(assert.AnError)
 
-		_, err := uc.Register(ctx, displayName, username, password)
+		_, err := uc.Register(ctx, displayName, username, password, email)
 
 		assert.Error(t, err)
 		mockUserProfileUseCase.AssertExpectations(t)
@@ -118,6 +193,83 @@ func TestUserCredentialUsecase_Register(t *testing.T) {
 	})
 }
 
+func TestUserCredentialUsecase_Register_PasswordPolicy(t *testing.T) {
+
+	const (
+		displayName = "hank"
+		username    = "hankster"
+	)
+
+	setup := func(t *testing.T) (*UserCredentialUseCase, *MockUserCredentialRepo, *MockBreachedPasswords) {
+		t.Helper()
+		mockRepo := new(MockUserCredentialRepo)
+		mockBreached := new(MockBreachedPasswords)
+		policy := PasswordPolicy{MinLength: 10, ForbidUsername: true, MinBreachCount: 1}
+		mockHasher := new(MockPasswordHasher)
+		mockHasher.On("GenerateHash", mock.Anything, _dummyPassword).Return("$2a$10$dummy", nil)
+		uc, err := NewUserCredentialUseCase(mockRepo, mockHasher, new(MockUserProfileUseCase), new(MockEmailVerificationUseCase), policy, mockBreached, nil, LoginThrottle{}, nil, logger.New("debug"))
+		assert.NoError(t, err)
+		return uc, mockRepo, mockBreached
+	}
+
+	t.Run("reports every rule the password breaks", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockBreached := setup(t)
+		ctx := context.Background()
+		mockBreached.On("Range", ctx, mock.AnythingOfType("string")).Return(map[string]int{}, nil)
+
+		// Act
+		_, err := uc.Register(ctx, displayName, username, "Hankster1", "hank@mail.com")
+
+		// Assert
+		ppve, ok := apperrors.AsPasswordPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, "Password", ppve.Field)
+		assert.Equal(t, []string{apperrors.PasswordTooShort, apperrors.PasswordContainsUsername}, violationReasons(ppve))
+		mockRepo.AssertNotCalled(t, "GetByUsername", mock.Anything, mock.Anything)
+	})
+
+	t.Run("rejects a breached password by its hash prefix", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockBreached := setup(t)
+		ctx := context.Background()
+		// SHA-1 of "correct horse battery staple" is ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42
+		mockBreached.On("Range", ctx, "ABF7A").Return(map[string]int{"AD6438836DBE526AA231ABDE2D0EEF74D42": 3}, nil)
+
+		// Act
+		_, err := uc.Register(ctx, displayName, username, "correct horse battery staple", "hank@mail.com")
+
+		// Assert
+		ppve, ok := apperrors.AsPasswordPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, []string{apperrors.PasswordBreached}, violationReasons(ppve))
+		mockBreached.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "GetByUsername", mock.Anything, mock.Anything)
+	})
+
+	t.Run("fails when the breached passwords cannot be looked up", func(t *testing.T) {
+		// Arrange
+		uc, _, mockBreached := setup(t)
+		ctx := context.Background()
+		mockBreached.On("Range", ctx, mock.AnythingOfType("string")).Return(nil, assert.AnError)
+
+		// Act
+		_, err := uc.Register(ctx, displayName, username, "correct horse battery staple", "hank@mail.com")
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.False(t, apperrors.IsPasswordPolicyViolationError(err))
+	})
+}
+
+func violationReasons(err *apperrors.PasswordPolicyViolationError) []string {
+	var reasons []string
+	for _, v := range err.Violations {
+		reasons = append(reasons, v.Reason)
+	}
+	return reasons
+}
+
 func TestUserCredentialUsecase_GetByUsername(t *testing.T) {
 
 	const (
@@ -195,7 +347,7 @@ func TestUserCredentialUsecase_Login(t *testing.T) {
 		mockRepo.On("GetByUsername", ctx, userCredential.Username).Return(userCredential, nil)
 		mockHasher.On("CompareHash", ctx, password, userCredential.PasswordHash).Return(nil)
 
-		u, err := uc.Login(ctx, userCredential.Username, password)
+		u, err := uc.Login(ctx, userCredential.Username, password, "10.0.0.1")
 
 		assert.NoError(t, err)
 		assert.Equal(t, userCredential, u)
@@ -218,7 +370,7 @@ func TestUserCredentialUsecase_Login(t *testing.T) {
 		mockRepo.On("GetByUsername", ctx, userCredential.Username).Return(userCredential, nil)
 		mockHasher.On("CompareHash", ctx, password, userCredential.PasswordHash).Return(assert.AnError)
 
-		u, err := uc.Login(ctx, userCredential.Username, password)
+		u, err := uc.Login(ctx, userCredential.Username, password, "10.0.0.1")
 
 		assert.Error(t, err)
 		assert.Equal(t, entity.UserCredential{}, u)
@@ -226,3 +378,131 @@ func TestUserCredentialUsecase_Login(t *testing.T) {
 		mockHasher.AssertExpectations(t)
 	})
 }
+
+func TestUserCredentialUsecase_Login_Throttle(t *testing.T) {
+
+	const (
+		userID         = 123
+		username       = "test"
+		password       = "test"
+		hashedPassword = "$2a$10"
+		ip             = "10.0.0.1"
+	)
+
+	throttle := LoginThrottle{FreeAttempts: 3, DelayBase: time.Second, DelayMax: time.Minute, MaxFailures: 10, MaxFailuresPerIP: 50, LockDuration: 15 * time.Minute, Window: time.Hour}
+
+	setupWithFactors := func(t *testing.T) (*UserCredentialUseCase, *MockUserCredentialRepo, *MockPasswordHasher, *MockLoginAttemptRepo, *MockTwoFactorRepo) {
+		t.Helper()
+		mockRepo := new(MockUserCredentialRepo)
+		mockHasher := new(MockPasswordHasher)
+		mockAttempts := new(MockLoginAttemptRepo)
+		mockFactors := new(MockTwoFactorRepo)
+		mockHasher.On("GenerateHash", mock.Anything, _dummyPassword).Return("$2a$10$dummy", nil)
+		uc, err := NewUserCredentialUseCase(mockRepo, mockHasher, new(MockUserProfileUseCase), new(MockEmailVerificationUseCase), PasswordPolicy{}, nil, mockAttempts, throttle, mockFactors, logger.New("debug"))
+		assert.NoError(t, err)
+		return uc, mockRepo, mockHasher, mockAttempts, mockFactors
+	}
+
+	setup := func(t *testing.T) (*UserCredentialUseCase, *MockUserCredentialRepo, *MockPasswordHasher, *MockLoginAttemptRepo) {
+		t.Helper()
+		uc, mockRepo, mockHasher, mockAttempts, mockFactors := setupWithFactors(t)
+		mockFactors.On("GetFactor", mock.Anything, userID).Return(entity.TOTPFactor{}, apperrors.NewNoRowsAffectedError("test", "test"))
+		return uc, mockRepo, mockHasher, mockAttempts
+	}
+
+	t.Run("an unknown username fails like a wrong password", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockHasher, mockAttempts := setup(t)
+		ctx := context.Background()
+		mockAttempts.On("BlockedFor", ctx, mock.Anything).Return(time.Duration(0), nil)
+		mockRepo.On("GetByUsername", ctx, username).Return(entity.UserCredential{}, apperrors.NewNoRowsAffectedError("test", "test"))
+		mockHasher.On("CompareHash", ctx, password, "$2a$10$dummy").Return(assert.AnError)
+		mockAttempts.On("RecordFailure", ctx, "user:"+username, time.Hour).Return(1, nil)
+		mockAttempts.On("RecordFailure", ctx, "ip:"+ip, time.Hour).Return(1, nil)
+
+		// Act
+		_, errUnknown := uc.Login(ctx, username, password, ip)
+		_, errAgain := uc.Login(ctx, username, password, ip)
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidCredentialsError(errUnknown))
+		assert.Equal(t, errUnknown.Error(), errAgain.Error())
+		mockHasher.AssertExpectations(t)
+		mockAttempts.AssertNotCalled(t, "Block", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("rejects a blocked login before checking the password", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockHasher, mockAttempts := setup(t)
+		ctx := context.Background()
+		mockAttempts.On("BlockedFor", ctx, "user:"+username).Return(4*time.Second, nil)
+		mockAttempts.On("BlockedFor", ctx, "ip:"+ip).Return(time.Duration(0), nil)
+
+		// Act
+		_, err := uc.Login(ctx, username, password, ip)
+
+		// Assert
+		lte, ok := apperrors.AsLoginThrottledError(err)
+		assert.True(t, ok)
+		assert.Equal(t, 4*time.Second, lte.RetryAfter)
+		mockRepo.AssertNotCalled(t, "GetByUsername", mock.Anything, mock.Anything)
+		mockHasher.AssertNotCalled(t, "CompareHash", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("locks the username after too many failures", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockHasher, mockAttempts := setup(t)
+		ctx := context.Background()
+		mockAttempts.On("BlockedFor", ctx, mock.Anything).Return(time.Duration(0), nil)
+		mockRepo.On("GetByUsername", ctx, username).Return(entity.UserCredential{UserID: userID, Username: username, PasswordHash: hashedPassword}, nil)
+		mockHasher.On("CompareHash", ctx, password, hashedPassword).Return(assert.AnError)
+		mockAttempts.On("RecordFailure", ctx, "user:"+username, time.Hour).Return(10, nil)
+		mockAttempts.On("RecordFailure", ctx, "ip:"+ip, time.Hour).Return(10, nil)
+		mockAttempts.On("Block", ctx, "user:"+username, 15*time.Minute).Return(nil)
+
+		// Act
+		_, err := uc.Login(ctx, username, password, ip)
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidCredentialsError(err))
+		mockAttempts.AssertExpectations(t)
+	})
+
+	t.Run("a successful login forgives the username only", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockHasher, mockAttempts := setup(t)
+		ctx := context.Background()
+		mockAttempts.On("BlockedFor", ctx, mock.Anything).Return(time.Duration(0), nil)
+		mockRepo.On("GetByUsername", ctx, username).Return(entity.UserCredential{UserID: userID, Username: username, PasswordHash: hashedPassword}, nil)
+		mockHasher.On("CompareHash", ctx, password, hashedPassword).Return(nil)
+		mockAttempts.On("Reset", ctx, "user:"+username).Return(nil)
+
+		// Act
+		u, err := uc.Login(ctx, username, password, ip)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, userID, u.UserID)
+		mockAttempts.AssertExpectations(t)
+		mockAttempts.AssertNotCalled(t, "Reset", ctx, "ip:"+ip)
+	})
+
+	t.Run("a login waiting for its second factor is not forgiven yet", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockHasher, mockAttempts, mockFactors := setupWithFactors(t)
+		ctx := context.Background()
+		confirmedAt := time.Now()
+		mockAttempts.On("BlockedFor", ctx, mock.Anything).Return(time.Duration(0), nil)
+		mockRepo.On("GetByUsername", ctx, username).Return(entity.UserCredential{UserID: userID, Username: username, PasswordHash: hashedPassword}, nil)
+		mockHasher.On("CompareHash", ctx, password, hashedPassword).Return(nil)
+		mockFactors.On("GetFactor", ctx, userID).Return(entity.TOTPFactor{UserID: userID, ConfirmedAt: &confirmedAt}, nil)
+
+		// Act
+		u, err := uc.Login(ctx, username, password, ip)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, userID, u.UserID)
+		mockAttempts.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+	})
+}
@@ -2,26 +2,43 @@ package usecase
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 )
 
 type UserUploadedFileUseCase struct {
-	repo   UserUploadedFileRepo
-	pub    UserUploadedFilePublisher
-	sender UserUploadedFileEmailSender
-	logger logger.Logger
+	repo    UserUploadedFileRepo
+	pub     UserUploadedFilePublisher
+	sender  UserUploadedFileEmailSender
+	scanner FileScanner
+	policy  UploadPolicy
+	quota   UploadQuota
+	logger  logger.Logger
 }
 
-func NewUserUploadedFileUseCase(r UserUploadedFileRepo, p UserUploadedFilePublisher, s UserUploadedFileEmailSender, l logger.Logger) *UserUploadedFileUseCase {
-	return &UserUploadedFileUseCase{repo: r, pub: p, sender: s, logger: l}
+func NewUserUploadedFileUseCase(r UserUploadedFileRepo, p UserUploadedFilePublisher, s UserUploadedFileEmailSender, sc FileScanner, policy UploadPolicy, quota UploadQuota, l logger.Logger) *UserUploadedFileUseCase {
+	return &UserUploadedFileUseCase{repo: r, pub: p, sender: s, scanner: sc, policy: policy, quota: quota, logger: l}
 }
 
 func (uc *UserUploadedFileUseCase) Create(ctx context.Context, userUploadedFile entity.UserUploadedFile) (entity.UserUploadedFile, error) {
-	returnedID, err := uc.repo.Create(ctx, userUploadedFile)
+	userUploadedFile, err := uc.prepare(ctx, userUploadedFile)
 	if err != nil {
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - Create - uc.prepare: %w", err)
+	}
+
+	returnedID, err := uc.repo.Create(ctx, userUploadedFile, uc.admitQuota(userUploadedFile))
+	if err != nil {
+		if apperrors.IsQuotaExceededError(err) {
+			return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - Create - s.repo.Create: %w", err)
+		}
 		uc.logger.Error("UserUploadedFileUseCase - Create - repo.Create : error creating user uploaded file", "error", err)
 		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - Create - s.repo.Create: %w", err)
 	}
@@ -35,18 +52,290 @@ func (uc *UserUploadedFileUseCase) Create(ctx context.Context, userUploadedFile
 	}
 
 	uc.logger.Info("UserUploadedFileUseCase - Create : user uploaded file published", "userUploadedFileID", userUploadedFile.ID)
+	uc.emit(ctx, entity.FileEventCreated, userUploadedFile, nil)
 	return userUploadedFile, nil
 }
 
+const (
+	// _dueDeliveriesBatchSize is the number of due deliveries claimed at once by PublishDueDeliveries.
+	_dueDeliveriesBatchSize = 100
+	// _expiredFilesBatchSize is the number of expired files purged at once by PurgeExpiredFiles.
+	_expiredFilesBatchSize = 100
+	// _emailClaimLease is how long an email claimed by a consumer that stopped responding blocks others.
+	_emailClaimLease = 10 * time.Minute
+	// _deliveryPublishLease is how long a due delivery claimed by a scheduler that stopped before publishing
+	// it waits before another scheduler publishes it.
+	_deliveryPublishLease = 5 * time.Minute
+	// _failedEmailsBatchSize is the number of failed emails or deliveries requeued at once by RequeueFailed.
+	_failedEmailsBatchSize = 100
+)
+
+// CreateDelivery stores the files of a batch upload under one delivery and publishes a single event for it.
+// Files rejected by the upload policy or the quotas are left out and reported in the results, the delivery
+// is only created when at least one file is accepted. A delivery with a send time in the future is stored
+// as scheduled and published by PublishDueDeliveries once it is due.
+func (uc *UserUploadedFileUseCase) CreateDelivery(ctx context.Context, delivery entity.Delivery) (entity.Delivery, []dto.DeliveryFileResult, error) {
+	if uc.policy.MaxBatchFiles > 0 && len(delivery.Files) > uc.policy.MaxBatchFiles {
+		return entity.Delivery{}, nil, apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyTooManyFiles, "no more than %d files can be sent together", "UserUploadedFileUseCase - CreateDelivery", uc.policy.MaxBatchFiles)
+	}
+
+	recipients := strings.Join(delivery.EmailRecipients, ", ")
+	results := make([]dto.DeliveryFileResult, len(delivery.Files))
+	accepted := make([]entity.UserUploadedFile, 0, len(delivery.Files))
+	acceptedIdx := make([]int, 0, len(delivery.Files))
+	for i, file := range delivery.Files {
+		results[i].Name = sanitizeFileName(file.Name)
+		file.UserID = delivery.UserID
+		file.EmailRecipient = recipients
+
+		prepared, err := uc.prepare(ctx, file)
+		if err == nil {
+			err = checkExpiryAfterSend(prepared, delivery.SendAt)
+		}
+		if err != nil {
+			if upve, ok := apperrors.AsUploadPolicyViolationError(err); ok {
+				results[i].Code, results[i].Error = upve.Reason, upve.Message
+				continue
+			}
+			return entity.Delivery{}, nil, fmt.Errorf("UserUploadedFileUseCase - CreateDelivery - uc.prepare: %w", err)
+		}
+		accepted = append(accepted, prepared)
+		acceptedIdx = append(acceptedIdx, i)
+	}
+
+	if len(accepted) == 0 {
+		uc.logger.Warn("UserUploadedFileUseCase - CreateDelivery : no file of the batch was accepted", "userID", delivery.UserID)
+		return entity.Delivery{}, results, nil
+	}
+
+	// the quotas are checked by the repo under a lock of the user, files over a quota are left out
+	var admit func(usage entity.StorageUsage) ([]entity.UserUploadedFile, error)
+	if uc.quota.enabled() {
+		admit = func(usage entity.StorageUsage) ([]entity.UserUploadedFile, error) {
+			admitted := make([]entity.UserUploadedFile, 0, len(accepted))
+			admittedIdx := make([]int, 0, len(accepted))
+			var rejection error
+			for j, file := range accepted {
+				err := uc.quota.Check(usage, newBytes(file))
+				if err != nil {
+					qee, ok := apperrors.AsQuotaExceededError(err)
+					if !ok {
+						return nil, err
+					}
+					results[acceptedIdx[j]].Code, results[acceptedIdx[j]].Error = qee.Reason, qee.Message
+					rejection = err
+					continue
+				}
+				// later files of the batch count against what the earlier ones consume
+				usage.BytesStored += newBytes(file)
+				usage.FileCount++
+				usage.UploadsLastHour++
+				admitted = append(admitted, file)
+				admittedIdx = append(admittedIdx, acceptedIdx[j])
+			}
+			if len(admitted) == 0 {
+				return nil, rejection
+			}
+			acceptedIdx = admittedIdx
+			return admitted, nil
+		}
+	}
+
+	delivery.Files = accepted
+	delivery.Status = entity.DeliveryStatusPending
+	if delivery.SendAt != nil {
+		if delivery.SendAt.After(time.Now()) {
+			delivery.Status = entity.DeliveryStatusScheduled
+		} else {
+			delivery.SendAt = nil
+		}
+	}
+	created, err := uc.repo.CreateDelivery(ctx, delivery, admit)
+	if err != nil {
+		if apperrors.IsQuotaExceededError(err) {
+			uc.logger.Warn("UserUploadedFileUseCase - CreateDelivery : no file of the batch was accepted", "userID", delivery.UserID)
+			return entity.Delivery{}, results, nil
+		}
+		uc.logger.Error("UserUploadedFileUseCase - CreateDelivery - repo.CreateDelivery : error creating delivery", "error", err)
+		return entity.Delivery{}, nil, fmt.Errorf("UserUploadedFileUseCase - CreateDelivery - s.repo.CreateDelivery: %w", err)
+	}
+	delivery = created
+	for j, file := range delivery.Files {
+		results[acceptedIdx[j]].ID = file.ID
+	}
+	uc.logger.Info("UserUploadedFileUseCase - CreateDelivery : delivery created", "deliveryID", delivery.ID, "files", len(delivery.Files))
+	for _, file := range delivery.Files {
+		uc.emit(ctx, entity.FileEventCreated, file, nil)
+	}
+
+	if delivery.Status == entity.DeliveryStatusScheduled {
+		uc.logger.Info("UserUploadedFileUseCase - CreateDelivery : delivery scheduled", "deliveryID", delivery.ID, "sendAt", delivery.SendAt)
+		return delivery, results, nil
+	}
+
+	err = uc.pub.PublishDelivery(ctx, delivery)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - CreateDelivery - pub.PublishDelivery : error publishing delivery", "error", err)
+		return entity.Delivery{}, nil, fmt.Errorf("UserUploadedFileUseCase - CreateDelivery - s.pub.PublishDelivery: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - CreateDelivery : delivery published", "deliveryID", delivery.ID)
+	return delivery, results, nil
+}
+
+// RescheduleDelivery moves the send time of a delivery that has not been published yet. Like at creation,
+// the delivery is rejected when one of its files would expire before the new send time.
+func (uc *UserUploadedFileUseCase) RescheduleDelivery(ctx context.Context, deliveryID, userID int, sendAt time.Time) error {
+	delivery, err := uc.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			return fmt.Errorf("UserUploadedFileUseCase - RescheduleDelivery - s.repo.GetDelivery: %w", err)
+		}
+		uc.logger.Error("UserUploadedFileUseCase - RescheduleDelivery - repo.GetDelivery : error getting delivery", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - RescheduleDelivery - s.repo.GetDelivery: %w", err)
+	}
+	if delivery.UserID != userID {
+		return apperrors.NewNoRowsAffectedError("scheduled delivery not found", "UserUploadedFileUseCase - RescheduleDelivery")
+	}
+	for _, file := range delivery.Files {
+		err = checkExpiryAfterSend(file, &sendAt)
+		if err != nil {
+			uc.logger.Warn("UserUploadedFileUseCase - RescheduleDelivery - checkExpiryAfterSend : delivery rejected by policy", "deliveryID", deliveryID, "userUploadedFileID", file.ID, "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - RescheduleDelivery - checkExpiryAfterSend: %w", err)
+		}
+	}
+
+	err = uc.repo.RescheduleDelivery(ctx, deliveryID, userID, sendAt)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - RescheduleDelivery - repo.RescheduleDelivery : error rescheduling delivery", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - RescheduleDelivery - s.repo.RescheduleDelivery: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - RescheduleDelivery : delivery rescheduled", "deliveryID", deliveryID, "sendAt", sendAt)
+	return nil
+}
+
+// CancelDelivery cancels a delivery that has not been published yet.
+func (uc *UserUploadedFileUseCase) CancelDelivery(ctx context.Context, deliveryID, userID int) error {
+	err := uc.repo.CancelDelivery(ctx, deliveryID, userID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - CancelDelivery - repo.CancelDelivery : error cancelling delivery", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - CancelDelivery - s.repo.CancelDelivery: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - CancelDelivery : delivery cancelled", "deliveryID", deliveryID)
+	return nil
+}
+
+// PublishDueDeliveries publishes the scheduled deliveries whose send time has passed. A delivery that
+// cannot be published is put back to scheduled, so the next run retries it. A delivery claimed by a run
+// that stopped before publishing it is claimed again once _deliveryPublishLease has passed.
+func (uc *UserUploadedFileUseCase) PublishDueDeliveries(ctx context.Context) error {
+	for {
+		now := time.Now()
+		deliveries, err := uc.repo.ClaimDueDeliveries(ctx, now, now.Add(-_deliveryPublishLease), _dueDeliveriesBatchSize)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - PublishDueDeliveries - repo.ClaimDueDeliveries : error claiming due deliveries", "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - PublishDueDeliveries - s.repo.ClaimDueDeliveries: %w", err)
+		}
+
+		failed := 0
+		for _, delivery := range deliveries {
+			err = uc.pub.PublishDelivery(ctx, delivery)
+			if err == nil {
+				uc.logger.Info("UserUploadedFileUseCase - PublishDueDeliveries : delivery published", "deliveryID", delivery.ID)
+				err = uc.repo.MarkDeliveryPublished(ctx, delivery.ID)
+				if err != nil {
+					// the delivery is published again once the claim is stale, the consumer sends it once
+					uc.logger.Error("UserUploadedFileUseCase - PublishDueDeliveries - repo.MarkDeliveryPublished : error marking delivery published", "error", err, "deliveryID", delivery.ID)
+				}
+				continue
+			}
+			failed++
+			uc.logger.Error("UserUploadedFileUseCase - PublishDueDeliveries - pub.PublishDelivery : error publishing delivery", "error", err)
+			err = uc.repo.UpdateDeliveryStatus(ctx, delivery.ID, entity.DeliveryStatusScheduled, nil)
+			if err != nil {
+				uc.logger.Error("UserUploadedFileUseCase - PublishDueDeliveries - repo.UpdateDeliveryStatus : error putting delivery back to scheduled", "error", err)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("UserUploadedFileUseCase - PublishDueDeliveries - s.pub.PublishDelivery: %d of %d deliveries could not be published", failed, len(deliveries))
+		}
+
+		if len(deliveries) < _dueDeliveriesBatchSize {
+			return nil
+		}
+	}
+}
+
+// SendEmail sends the file to its recipient once. The email is claimed before anything else, so a
+// redelivered or replayed message for a file already sent, or being sent, is skipped. Failed attempts
+// release the claim. See Resend for sending another copy.
 func (uc *UserUploadedFileUseCase) SendEmail(ctx context.Context, userUploadedFile entity.UserUploadedFile) error {
-	err := uc.sender.Send(ctx, userUploadedFile)
+	now := time.Now()
+	err := uc.repo.ClaimEmail(ctx, userUploadedFile.ID, now, now.Add(-_emailClaimLease))
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Info("UserUploadedFileUseCase - SendEmail : email already sent or being sent, skipping", "userUploadedFileID", userUploadedFile.ID)
+			return nil
+		}
+		uc.logger.Error("UserUploadedFileUseCase - SendEmail - repo.ClaimEmail : error claiming email", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - s.repo.ClaimEmail: %w", err)
+	}
+
+	// the message may have waited in the queue while the file expired or was quarantined
+	current, err := uc.repo.GetByID(ctx, userUploadedFile.ID, userUploadedFile.UserID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - SendEmail - repo.GetByID : error getting user uploaded file", "error", err)
+		uc.releaseEmail(ctx, userUploadedFile.ID)
+		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - s.repo.GetByID: %w", err)
+	}
+	switch {
+	case current.Expired(now):
+		err = apperrors.NewFileExpiredError("the file has expired", "UserUploadedFileUseCase - SendEmail")
+	case current.Status == entity.FileStatusQuarantined:
+		err = apperrors.NewFileQuarantinedError("the file is quarantined", "UserUploadedFileUseCase - SendEmail")
+	}
+	if err != nil {
+		uc.logger.Warn("UserUploadedFileUseCase - SendEmail : file cannot be sent anymore, skipping", "userUploadedFileID", userUploadedFile.ID, "reason", err)
+		uc.releaseEmail(ctx, userUploadedFile.ID)
+		uc.emit(ctx, entity.FileEventEmailFailed, userUploadedFile, err)
+		return err
+	}
+
+	// the stored content is checked and sent, the copy carried by the message would hide a corrupted blob
+	userUploadedFile.BlobID, userUploadedFile.Checksum = current.BlobID, current.Checksum
+	userUploadedFile.Content, err = uc.loadContent(ctx, userUploadedFile)
+	if err != nil {
+		uc.releaseEmail(ctx, userUploadedFile.ID)
+		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - uc.loadContent: %w", err)
+	}
+
+	err = uc.verifyChecksum(ctx, userUploadedFile)
+	if err != nil {
+		uc.releaseEmail(ctx, userUploadedFile.ID)
+		uc.emit(ctx, entity.FileEventEmailFailed, userUploadedFile, err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - uc.verifyChecksum: %w", err)
+	}
+
+	err = uc.scan(ctx, userUploadedFile)
+	if err != nil {
+		uc.releaseEmail(ctx, userUploadedFile.ID)
+		uc.emit(ctx, entity.FileEventEmailFailed, userUploadedFile, err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - uc.scan: %w", err)
+	}
+
+	messageID, err := uc.sender.Send(ctx, userUploadedFile)
 	if err != nil {
 		uc.logger.Error("UserUploadedFileUseCase - SendEmail - sender.Send : error sending email", "error", err)
+		uc.releaseEmail(ctx, userUploadedFile.ID)
+		uc.emit(ctx, entity.FileEventEmailFailed, userUploadedFile, err)
 		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - s.sender.Send: %w", err)
 	}
 	uc.logger.Info("UserUploadedFileUseCase - SendEmail : email sent", "userUploadedFileID", userUploadedFile.ID)
+	uc.emit(ctx, entity.FileEventEmailed, userUploadedFile, nil)
 
-	err = uc.repo.UpdateEmailSent(ctx, userUploadedFile.ID)
+	err = uc.repo.UpdateEmailSent(ctx, userUploadedFile.ID, messageID)
 	if err != nil {
 		uc.logger.Error("UserUploadedFileUseCase - SendEmail - repo.UpdateEmailSent : error updating email sent", "error", err)
 		return fmt.Errorf("UserUploadedFileUseCase - SendEmail - s.repo.UpdateEmailSent: %w", err)
@@ -56,6 +345,394 @@ func (uc *UserUploadedFileUseCase) SendEmail(ctx context.Context, userUploadedFi
 	return nil
 }
 
+// releaseEmail lets a later message send the email again after a failed attempt. A claim that cannot be
+// released is taken over once it is stale.
+func (uc *UserUploadedFileUseCase) releaseEmail(ctx context.Context, userUploadedFileID int) {
+	err := uc.repo.ReleaseEmail(ctx, userUploadedFileID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - releaseEmail - repo.ReleaseEmail : error releasing email", "error", err, "userUploadedFileID", userUploadedFileID)
+	}
+}
+
+// Resend queues another copy of the email of a file of the user, to new recipients when some are given.
+// A file sent with a delivery is sent again with the whole delivery. Resends count against the hourly
+// resend limit of the user.
+func (uc *UserUploadedFileUseCase) Resend(ctx context.Context, userUploadedFileID, userID int, recipients []string) error {
+	file, err := uc.repo.GetByID(ctx, userUploadedFileID, userID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - Resend - repo.GetByID : error getting user uploaded file", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - Resend - s.repo.GetByID: %w", err)
+	}
+
+	if file.Expired(time.Now()) {
+		return apperrors.NewFileExpiredError("the file has expired", "UserUploadedFileUseCase - Resend")
+	}
+	if file.Status == entity.FileStatusQuarantined {
+		return apperrors.NewFileQuarantinedError("the file is quarantined", "UserUploadedFileUseCase - Resend")
+	}
+
+	// recorded before the email is queued, so concurrent resends cannot get past the limit
+	resendID, err := uc.repo.CreateResend(ctx, userID, file.ID, time.Now().Add(-time.Hour), uc.quota.CheckResend)
+	if err != nil {
+		if !apperrors.IsQuotaExceededError(err) {
+			uc.logger.Error("UserUploadedFileUseCase - Resend - repo.CreateResend : error recording resend", "error", err)
+		}
+		return fmt.Errorf("UserUploadedFileUseCase - Resend - s.repo.CreateResend: %w", err)
+	}
+
+	if file.DeliveryID != nil {
+		err = uc.resendDelivery(ctx, *file.DeliveryID, userID, recipients)
+	} else {
+		err = uc.resendFile(ctx, file, recipients)
+	}
+	if err != nil {
+		// nothing was queued, the resend must not count against the limit
+		deleteErr := uc.repo.DeleteResend(ctx, resendID)
+		if deleteErr != nil {
+			uc.logger.Error("UserUploadedFileUseCase - Resend - repo.DeleteResend : error forgetting resend", "error", deleteErr, "resendID", resendID)
+		}
+		return fmt.Errorf("UserUploadedFileUseCase - Resend - uc.resend: %w", err)
+	}
+	return nil
+}
+
+// RequeueFailed queues the emails and deliveries again whose last attempt failed between from and to.
+// Emails being sent in the meantime are skipped. The resend limit of the users does not apply.
+func (uc *UserUploadedFileUseCase) RequeueFailed(ctx context.Context, from, to time.Time) (dto.RequeueResult, error) {
+	var result dto.RequeueResult
+
+	lastID := 0
+	for {
+		deliveries, err := uc.repo.GetFailedDeliveries(ctx, from, to, lastID, _failedEmailsBatchSize)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - RequeueFailed - repo.GetFailedDeliveries : error getting failed deliveries", "error", err)
+			return result, fmt.Errorf("UserUploadedFileUseCase - RequeueFailed - s.repo.GetFailedDeliveries: %w", err)
+		}
+		for _, delivery := range deliveries {
+			lastID = delivery.ID
+			err = uc.resendDelivery(ctx, delivery.ID, delivery.UserID, nil)
+			if apperrors.IsEmailInProgressError(err) {
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("UserUploadedFileUseCase - RequeueFailed - uc.resendDelivery: %w", err)
+			}
+			result.Deliveries++
+		}
+		if len(deliveries) < _failedEmailsBatchSize {
+			break
+		}
+	}
+
+	lastID = 0
+	for {
+		files, err := uc.repo.GetFailedEmails(ctx, from, to, lastID, _failedEmailsBatchSize)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - RequeueFailed - repo.GetFailedEmails : error getting failed emails", "error", err)
+			return result, fmt.Errorf("UserUploadedFileUseCase - RequeueFailed - s.repo.GetFailedEmails: %w", err)
+		}
+		for _, file := range files {
+			lastID = file.ID
+			err = uc.resendFile(ctx, file, nil)
+			if apperrors.IsEmailInProgressError(err) {
+				result.Skipped++
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("UserUploadedFileUseCase - RequeueFailed - uc.resendFile: %w", err)
+			}
+			result.Files++
+		}
+		if len(files) < _failedEmailsBatchSize {
+			break
+		}
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - RequeueFailed : failed emails queued again", "from", from, "to", to, "files", result.Files, "deliveries", result.Deliveries, "skipped", result.Skipped)
+	return result, nil
+}
+
+// resendFile queues the email of a file sent on its own again and publishes it, SendEmail picks it up.
+func (uc *UserUploadedFileUseCase) resendFile(ctx context.Context, file entity.UserUploadedFile, recipients []string) error {
+	err := uc.repo.RequeueEmail(ctx, file.ID, file.UserID, recipients)
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			return apperrors.NewEmailInProgressError("the email is being sent", "UserUploadedFileUseCase - resendFile")
+		}
+		uc.logger.Error("UserUploadedFileUseCase - resendFile - repo.RequeueEmail : error requeuing email", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - resendFile - s.repo.RequeueEmail: %w", err)
+	}
+	if len(recipients) > 0 {
+		file.EmailRecipient = strings.Join(recipients, ", ")
+	}
+
+	file.Content, err = uc.loadContent(ctx, file)
+	if err != nil {
+		return fmt.Errorf("UserUploadedFileUseCase - resendFile - uc.loadContent: %w", err)
+	}
+	err = uc.pub.Publish(ctx, file)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - resendFile - pub.Publish : error publishing user uploaded file", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - resendFile - s.pub.Publish: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - resendFile : email queued again", "userUploadedFileID", file.ID)
+	return nil
+}
+
+// resendDelivery queues a delivery again and publishes it, SendDeliveryEmail picks it up.
+func (uc *UserUploadedFileUseCase) resendDelivery(ctx context.Context, deliveryID, userID int, recipients []string) error {
+	err := uc.repo.RequeueDelivery(ctx, deliveryID, userID, recipients)
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			return apperrors.NewEmailInProgressError("the delivery is being sent or not due yet", "UserUploadedFileUseCase - resendDelivery")
+		}
+		uc.logger.Error("UserUploadedFileUseCase - resendDelivery - repo.RequeueDelivery : error requeuing delivery", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - resendDelivery - s.repo.RequeueDelivery: %w", err)
+	}
+
+	err = uc.pub.PublishDelivery(ctx, entity.Delivery{ID: deliveryID, UserID: userID, Status: entity.DeliveryStatusPending})
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - resendDelivery - pub.PublishDelivery : error publishing delivery", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - resendDelivery - s.pub.PublishDelivery: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - resendDelivery : delivery queued again", "deliveryID", deliveryID)
+	return nil
+}
+
+// SendDeliveryEmail sends every deliverable file of a delivery in a single email. Files that fail the
+// checksum verification or the scan are withheld, and the delivery fails with a NothingDeliverableError
+// carrying the reason of each file when no file is left.
+// The content is loaded one file at a time and released once the file is checked. Like SendEmail, the
+// delivery is claimed first, so it is sent once however often its message is delivered.
+func (uc *UserUploadedFileUseCase) SendDeliveryEmail(ctx context.Context, deliveryID int) error {
+	now := time.Now()
+	err := uc.repo.ClaimDelivery(ctx, deliveryID, now, now.Add(-_emailClaimLease))
+	if err != nil {
+		if apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Info("UserUploadedFileUseCase - SendDeliveryEmail : delivery already sent or being sent, skipping", "deliveryID", deliveryID)
+			return nil
+		}
+		uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - repo.ClaimDelivery : error claiming delivery", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - s.repo.ClaimDelivery: %w", err)
+	}
+
+	delivery, err := uc.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - repo.GetDelivery : error getting delivery", "error", err)
+		uc.releaseDelivery(ctx, deliveryID, err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - s.repo.GetDelivery: %w", err)
+	}
+	if delivery.ArchivePassword != nil && delivery.ArchiveSentAt != nil {
+		// the archive went out in an earlier attempt, only the email with its password is missing
+		uc.logger.Info("UserUploadedFileUseCase - SendDeliveryEmail : archive already sent, sending its password", "deliveryID", deliveryID)
+		return uc.sendArchivePassword(ctx, delivery, *delivery.ArchivePassword)
+	}
+
+	deliverable := 0
+	withheld := make([]error, len(delivery.Files)) // why each file is left out of the email
+	for i, file := range delivery.Files {
+		if file.Expired(time.Now()) {
+			uc.logger.Warn("UserUploadedFileUseCase - SendDeliveryEmail : file expired before delivery", "userUploadedFileID", file.ID)
+			delivery.Files[i].Status = entity.FileStatusExpired
+			withheld[i] = apperrors.NewFileExpiredError("the file has expired", "UserUploadedFileUseCase - SendDeliveryEmail")
+			continue
+		}
+		file.Content, err = uc.loadContent(ctx, file)
+		if err != nil {
+			uc.releaseDelivery(ctx, deliveryID, err)
+			return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - uc.loadContent: %w", err)
+		}
+		err = uc.verifyChecksum(ctx, file)
+		if err == nil {
+			err = uc.scan(ctx, file)
+		}
+		switch {
+		case err == nil:
+			delivery.Files[i].Status = entity.FileStatusClean
+			deliverable++
+		case apperrors.IsChecksumMismatchError(err):
+			delivery.Files[i].Status = entity.FileStatusFailed
+			withheld[i] = err
+		case apperrors.IsFileQuarantinedError(err):
+			delivery.Files[i].Status = entity.FileStatusQuarantined
+			withheld[i] = err
+		default:
+			uc.releaseDelivery(ctx, deliveryID, err)
+			return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - uc.scan: %w", err)
+		}
+	}
+
+	if deliverable == 0 {
+		reasons := make([]error, len(delivery.Files))
+		for i, file := range delivery.Files {
+			reasons[i] = fmt.Errorf("%s: %w", file.Name, withheld[i])
+		}
+		nothingDeliverable := apperrors.NewNothingDeliverableError(reasons, "UserUploadedFileUseCase - SendDeliveryEmail")
+		reason := nothingDeliverable.Error()
+		err = uc.repo.UpdateDeliveryStatus(ctx, deliveryID, entity.DeliveryStatusFailed, &reason)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - repo.UpdateDeliveryStatus : error updating delivery status", "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - s.repo.UpdateDeliveryStatus: %w", err)
+		}
+		uc.emitDelivery(ctx, delivery, withheld, nil)
+		return nothingDeliverable
+	}
+
+	password, err := uc.archivePassword(ctx, delivery)
+	if err != nil {
+		uc.releaseDelivery(ctx, deliveryID, err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - uc.archivePassword: %w", err)
+	}
+	messageID, err := uc.sender.SendDelivery(ctx, delivery, password, uc.loadContent)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - sender.SendDelivery : error sending email", "error", err)
+		uc.releaseDelivery(ctx, deliveryID, err)
+		uc.emitDelivery(ctx, delivery, withheld, err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - s.sender.SendDelivery: %w", err)
+	}
+	uc.logger.Info("UserUploadedFileUseCase - SendDeliveryEmail : email sent", "deliveryID", deliveryID)
+	if password != "" {
+		// without the mark a retry sends the archive again, with the same password
+		err = uc.repo.MarkArchiveSent(ctx, deliveryID)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - repo.MarkArchiveSent : error marking archive sent", "error", err, "deliveryID", deliveryID)
+		}
+	}
+	uc.emitDelivery(ctx, delivery, withheld, nil)
+
+	for _, file := range delivery.Files {
+		if file.Status != entity.FileStatusClean {
+			continue
+		}
+		err = uc.repo.UpdateEmailSent(ctx, file.ID, messageID)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - repo.UpdateEmailSent : error updating email sent", "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - s.repo.UpdateEmailSent: %w", err)
+		}
+	}
+	if password != "" {
+		return uc.sendArchivePassword(ctx, delivery, password)
+	}
+
+	err = uc.repo.UpdateDeliveryStatus(ctx, deliveryID, entity.DeliveryStatusSent, nil)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - SendDeliveryEmail - repo.UpdateDeliveryStatus : error updating delivery status", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - SendDeliveryEmail - s.repo.UpdateDeliveryStatus: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - SendDeliveryEmail : delivery sent", "deliveryID", deliveryID, "deliverable", deliverable, "withheld", len(delivery.Files)-deliverable)
+	return nil
+}
+
+// archivePassword returns the password of the archive of a claimed delivery, empty when its files are not
+// bundled into a protected archive. A new password is recorded before the archive is sent, so every
+// attempt builds the archive with the password that is eventually emailed.
+func (uc *UserUploadedFileUseCase) archivePassword(ctx context.Context, delivery entity.Delivery) (string, error) {
+	password, err := uc.sender.ArchivePassword(delivery)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - archivePassword - sender.ArchivePassword : error generating archive password", "error", err)
+		return "", fmt.Errorf("UserUploadedFileUseCase - archivePassword - s.sender.ArchivePassword: %w", err)
+	}
+	if password == "" {
+		return "", nil
+	}
+	if delivery.ArchivePassword != nil {
+		// recorded by an earlier attempt that failed to send the archive
+		return *delivery.ArchivePassword, nil
+	}
+
+	err = uc.repo.SetArchivePassword(ctx, delivery.ID, password)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - archivePassword - repo.SetArchivePassword : error recording archive password", "error", err, "deliveryID", delivery.ID)
+		return "", fmt.Errorf("UserUploadedFileUseCase - archivePassword - s.repo.SetArchivePassword: %w", err)
+	}
+	return password, nil
+}
+
+// sendArchivePassword sends the password of the archive of a claimed delivery and marks the delivery sent,
+// which forgets the password. When the email fails the delivery is put back to pending with its recorded
+// password, so the next attempt only sends the password.
+func (uc *UserUploadedFileUseCase) sendArchivePassword(ctx context.Context, delivery entity.Delivery, password string) error {
+	err := uc.sender.SendArchivePassword(ctx, delivery, password)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - sendArchivePassword - sender.SendArchivePassword : error sending archive password", "error", err)
+		uc.releaseDelivery(ctx, delivery.ID, err)
+		return fmt.Errorf("UserUploadedFileUseCase - sendArchivePassword - s.sender.SendArchivePassword: %w", err)
+	}
+
+	err = uc.repo.UpdateDeliveryStatus(ctx, delivery.ID, entity.DeliveryStatusSent, nil)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - sendArchivePassword - repo.UpdateDeliveryStatus : error updating delivery status", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - sendArchivePassword - s.repo.UpdateDeliveryStatus: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - sendArchivePassword : delivery sent", "deliveryID", delivery.ID)
+	return nil
+}
+
+// releaseDelivery puts a claimed delivery back to pending after a failed attempt, so a later message
+// sends it again.
+func (uc *UserUploadedFileUseCase) releaseDelivery(ctx context.Context, deliveryID int, cause error) {
+	reason := cause.Error()
+	err := uc.repo.UpdateDeliveryStatus(ctx, deliveryID, entity.DeliveryStatusPending, &reason)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - releaseDelivery - repo.UpdateDeliveryStatus : error releasing delivery", "error", err, "deliveryID", deliveryID)
+	}
+}
+
+// emit publishes a domain event about the file. The events only feed notifications, so a failure to
+// publish one is logged and does not fail the operation it is about.
+func (uc *UserUploadedFileUseCase) emit(ctx context.Context, eventType string, file entity.UserUploadedFile, cause error) {
+	eventID, err := newEventID()
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - emit - newEventID : error generating event id", "error", err)
+		return
+	}
+
+	now := time.Now()
+	file.Content, file.Base64Content = nil, ""
+	if eventType == entity.FileEventEmailed {
+		file.EmailSent, file.EmailSentAt = true, &now
+	}
+	event := entity.FileEvent{ID: eventID, Type: eventType, OccurredAt: now, File: file}
+	if cause != nil {
+		reason := cause.Error()
+		event.Error = &reason
+	}
+
+	err = uc.pub.PublishFileEvent(ctx, event)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - emit - pub.PublishFileEvent : error publishing file event", "error", err, "type", eventType, "userUploadedFileID", file.ID)
+	}
+}
+
+// emitDelivery reports the outcome of a delivery email for each of its files. Withheld files failed for
+// their own reason, the others were emailed unless sending failed.
+func (uc *UserUploadedFileUseCase) emitDelivery(ctx context.Context, delivery entity.Delivery, withheld []error, sendErr error) {
+	for i, file := range delivery.Files {
+		switch {
+		case withheld[i] != nil:
+			uc.emit(ctx, entity.FileEventEmailFailed, file, withheld[i])
+		case sendErr != nil:
+			uc.emit(ctx, entity.FileEventEmailFailed, file, sendErr)
+		default:
+			uc.emit(ctx, entity.FileEventEmailed, file, nil)
+		}
+	}
+}
+
+func (uc *UserUploadedFileUseCase) loadContent(ctx context.Context, file entity.UserUploadedFile) ([]byte, error) {
+	content, err := uc.repo.GetBlobContent(ctx, file.BlobID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - loadContent - repo.GetBlobContent : error loading file content", "error", err)
+		return nil, fmt.Errorf("UserUploadedFileUseCase - loadContent - s.repo.GetBlobContent: %w", err)
+	}
+	return content, nil
+}
+
 func (uc *UserUploadedFileUseCase) GetPaginatedFiles(ctx context.Context, lastID, userID, limit int) ([]entity.UserUploadedFile, int, error) {
 	files, totalRecords, err := uc.repo.GetPaginatedFiles(ctx, lastID, userID, limit)
 	if err != nil {
@@ -63,6 +740,240 @@ func (uc *UserUploadedFileUseCase) GetPaginatedFiles(ctx context.Context, lastID
 		return nil, 0, fmt.Errorf("UserUploadedFileUseCase - GetPaginatedFiles - s.repo.GetPaginatedFiles: %w", err)
 	}
 
+	// files whose retention is over show as expired even before the janitor has purged them
+	now := time.Now()
+	for i := range files {
+		if files[i].Expired(now) {
+			files[i].Status = entity.FileStatusExpired
+		}
+	}
+
 	uc.logger.Info("UserUploadedFileUseCase - GetPaginatedFiles : paginated files retrieved", "totalRecords", totalRecords)
 	return files, totalRecords, nil
 }
+
+// Download returns a file of the user together with its content. Expired files are reported with a
+// FileExpiredError and quarantined files with a FileQuarantinedError.
+func (uc *UserUploadedFileUseCase) Download(ctx context.Context, userUploadedFileID, userID int) (entity.UserUploadedFile, error) {
+	file, err := uc.repo.GetByID(ctx, userUploadedFileID, userID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - Download - repo.GetByID : error getting user uploaded file", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - Download - s.repo.GetByID: %w", err)
+	}
+
+	if file.Expired(time.Now()) {
+		return entity.UserUploadedFile{}, apperrors.NewFileExpiredError("the file has expired", "UserUploadedFileUseCase - Download")
+	}
+	if file.Status == entity.FileStatusQuarantined {
+		return entity.UserUploadedFile{}, apperrors.NewFileQuarantinedError("the file is quarantined", "UserUploadedFileUseCase - Download")
+	}
+
+	file.Content, err = uc.loadContent(ctx, file)
+	if err != nil {
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - Download - uc.loadContent: %w", err)
+	}
+	return file, nil
+}
+
+func (uc *UserUploadedFileUseCase) Delete(ctx context.Context, userUploadedFileID, userID int) error {
+	err := uc.repo.Delete(ctx, userUploadedFileID, userID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - Delete - repo.Delete : error deleting user uploaded file", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - Delete - s.repo.Delete: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - Delete : user uploaded file deleted", "userUploadedFileID", userUploadedFileID)
+	uc.emit(ctx, entity.FileEventDeleted, entity.UserUploadedFile{ID: userUploadedFileID, UserID: userID}, nil)
+	return nil
+}
+
+// PurgeExpiredFiles releases the content of the files whose retention is over and keeps their records.
+func (uc *UserUploadedFileUseCase) PurgeExpiredFiles(ctx context.Context) error {
+	for {
+		ids, err := uc.repo.ExpireFiles(ctx, time.Now(), _expiredFilesBatchSize)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - PurgeExpiredFiles - repo.ExpireFiles : error expiring files", "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - PurgeExpiredFiles - s.repo.ExpireFiles: %w", err)
+		}
+		if len(ids) > 0 {
+			uc.logger.Info("UserUploadedFileUseCase - PurgeExpiredFiles : expired files purged", "userUploadedFileIDs", ids)
+		}
+
+		if len(ids) < _expiredFilesBatchSize {
+			return nil
+		}
+	}
+}
+
+// HandleMailEvents records the delivery status callbacks of the mail provider on the files of the emails.
+// Events about emails the gateway does not know, or about someone the email was not sent to, are skipped,
+// so the provider does not keep retrying them.
+func (uc *UserUploadedFileUseCase) HandleMailEvents(ctx context.Context, events []entity.MailEvent) error {
+	for _, event := range events {
+		event.MessageID = strings.Trim(strings.TrimSpace(event.MessageID), "<>")
+		event.Recipient = strings.ToLower(strings.TrimSpace(event.Recipient))
+
+		updated, err := uc.repo.ApplyMailEvent(ctx, event)
+		if apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Warn("UserUploadedFileUseCase - HandleMailEvents - repo.ApplyMailEvent : no email with this message id for the recipient", "messageID", event.MessageID)
+			continue
+		}
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - HandleMailEvents - repo.ApplyMailEvent : error applying mail event", "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - HandleMailEvents - s.repo.ApplyMailEvent: %w", err)
+		}
+
+		uc.logger.Info("UserUploadedFileUseCase - HandleMailEvents : mail event applied", "messageID", event.MessageID, "type", event.Type, "files", updated)
+	}
+	return nil
+}
+
+func (uc *UserUploadedFileUseCase) GetUsage(ctx context.Context, userID int) (dto.UserUsage, error) {
+	usage, err := uc.repo.GetUsage(ctx, userID)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - GetUsage - repo.GetUsage : error getting storage usage", "error", err)
+		return dto.UserUsage{}, fmt.Errorf("UserUploadedFileUseCase - GetUsage - s.repo.GetUsage: %w", err)
+	}
+
+	return dto.UserUsage{
+		BytesStored:    dto.QuotaUsage{Used: usage.BytesStored, Limit: uc.quota.MaxBytes},
+		FileCount:      dto.QuotaUsage{Used: usage.FileCount, Limit: uc.quota.MaxFiles},
+		UploadsPerHour: dto.QuotaUsage{Used: usage.UploadsLastHour, Limit: uc.quota.MaxUploadsPerHour},
+		BytesReserved:  usage.BytesReserved,
+		UploadSessions: dto.QuotaUsage{Used: usage.UploadSessions, Limit: uc.quota.MaxUploadSessions},
+	}, nil
+}
+
+// prepare runs the checks shared by single and batch uploads: the name is sanitised, the content type
+// sniffed and checked against the policy, and identical stored content is looked up for deduplication.
+func (uc *UserUploadedFileUseCase) prepare(ctx context.Context, userUploadedFile entity.UserUploadedFile) (entity.UserUploadedFile, error) {
+	userUploadedFile.Name = sanitizeFileName(userUploadedFile.Name)
+	userUploadedFile.ContentType = DetectContentType(userUploadedFile.Name, userUploadedFile.Content)
+	err := uc.policy.Check(userUploadedFile.Name, userUploadedFile.ContentType, userUploadedFile.Size)
+	if err != nil {
+		uc.logger.Warn("UserUploadedFileUseCase - prepare - policy.Check : upload rejected by policy", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - prepare - uc.policy.Check: %w", err)
+	}
+
+	userUploadedFile.ExpiresAt, err = uc.policy.ExpiresAt(userUploadedFile.ExpiresAt, time.Now())
+	if err != nil {
+		uc.logger.Warn("UserUploadedFileUseCase - prepare - policy.ExpiresAt : upload rejected by policy", "error", err)
+		return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - prepare - uc.policy.ExpiresAt: %w", err)
+	}
+
+	if userUploadedFile.Checksum == "" {
+		userUploadedFile.Checksum = Checksum(userUploadedFile.Content)
+	}
+	if uc.policy.Deduplicate {
+		blobID, err := uc.repo.GetBlobIDByChecksum(ctx, userUploadedFile.UserID, userUploadedFile.Checksum)
+		if err == nil {
+			uc.logger.Info("UserUploadedFileUseCase - prepare : reusing stored content", "blobID", blobID)
+			userUploadedFile.BlobID = blobID
+		} else if !apperrors.IsNoRowsAffectedError(err) {
+			uc.logger.Error("UserUploadedFileUseCase - prepare - repo.GetBlobIDByChecksum : error looking up stored content", "error", err)
+			return entity.UserUploadedFile{}, fmt.Errorf("UserUploadedFileUseCase - prepare - s.repo.GetBlobIDByChecksum: %w", err)
+		}
+	}
+	return userUploadedFile, nil
+}
+
+// admitQuota returns the check the repo runs on the usage of the user before storing the file, it rejects
+// the upload when it would take the user over a quota. It is nil when no quota is set.
+func (uc *UserUploadedFileUseCase) admitQuota(userUploadedFile entity.UserUploadedFile) func(usage entity.StorageUsage) error {
+	if !uc.quota.enabled() {
+		return nil
+	}
+
+	return func(usage entity.StorageUsage) error {
+		err := uc.quota.Check(usage, newBytes(userUploadedFile))
+		if err != nil {
+			uc.logger.Warn("UserUploadedFileUseCase - admitQuota - quota.Check : upload rejected by quota", "userID", userUploadedFile.UserID, "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - admitQuota - uc.quota.Check: %w", err)
+		}
+		return nil
+	}
+}
+
+// checkExpiryAfterSend rejects a file of a scheduled delivery that would expire before the email is sent.
+func checkExpiryAfterSend(userUploadedFile entity.UserUploadedFile, sendAt *time.Time) error {
+	if sendAt == nil || userUploadedFile.ExpiresAt == nil || userUploadedFile.ExpiresAt.After(*sendAt) {
+		return nil
+	}
+	return apperrors.NewUploadPolicyViolationError(apperrors.UploadPolicyInvalidExpiry, "the file would expire before the scheduled send time", "UserUploadedFileUseCase - checkExpiryAfterSend")
+}
+
+// newBytes is what storing the file adds to the stored bytes, content shared with an earlier upload is already counted.
+func newBytes(userUploadedFile entity.UserUploadedFile) int64 {
+	if userUploadedFile.BlobID != 0 {
+		return 0
+	}
+	return userUploadedFile.Size
+}
+
+// verifyChecksum makes sure the content loaded from storage is the content that was uploaded. A mismatch
+// marks the file failed for good and is reported with a ChecksumMismatchError.
+func (uc *UserUploadedFileUseCase) verifyChecksum(ctx context.Context, userUploadedFile entity.UserUploadedFile) error {
+	if userUploadedFile.Checksum == "" || Checksum(userUploadedFile.Content) == userUploadedFile.Checksum {
+		return nil
+	}
+
+	uc.logger.Error("UserUploadedFileUseCase - verifyChecksum : checksum mismatch", "userUploadedFileID", userUploadedFile.ID)
+	reason := "checksum mismatch"
+	err := uc.repo.UpdateStatus(ctx, userUploadedFile.ID, entity.FileStatusFailed, &reason)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - verifyChecksum - repo.UpdateStatus : error updating status", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - verifyChecksum - s.repo.UpdateStatus: %w", err)
+	}
+	return apperrors.NewChecksumMismatchError(reason, "UserUploadedFileUseCase - verifyChecksum")
+}
+
+// scan runs the content scanner before delivery. Infected files and files the scanner refuses to check are
+// quarantined and a FileQuarantinedError is returned so the email is blocked. When the scanner cannot be
+// reached the file keeps its status and the error is returned as is: the email is released and its
+// message dead-lettered, an operator sends it again with the requeue of failed emails once the scanner is back.
+func (uc *UserUploadedFileUseCase) scan(ctx context.Context, userUploadedFile entity.UserUploadedFile) error {
+	uc.emit(ctx, entity.FileEventScanning, userUploadedFile, nil)
+
+	result, err := uc.scanner.Scan(ctx, userUploadedFile.Name, userUploadedFile.Content)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - scan - scanner.Scan : error scanning file", "error", err, "userUploadedFileID", userUploadedFile.ID)
+		return fmt.Errorf("UserUploadedFileUseCase - scan - s.scanner.Scan: %w", err)
+	}
+
+	var reason string
+	switch {
+	case result.Unscannable != "":
+		uc.logger.Warn("UserUploadedFileUseCase - scan : file could not be scanned", "userUploadedFileID", userUploadedFile.ID, "reason", result.Unscannable)
+		reason = fmt.Sprintf("file could not be scanned: %s", result.Unscannable)
+	case !result.Clean:
+		uc.logger.Warn("UserUploadedFileUseCase - scan : malware detected", "userUploadedFileID", userUploadedFile.ID, "signature", result.Signature)
+		reason = fmt.Sprintf("malware detected: %s", result.Signature)
+	}
+
+	if reason == "" {
+		err = uc.repo.UpdateStatus(ctx, userUploadedFile.ID, entity.FileStatusClean, nil)
+		if err != nil {
+			uc.logger.Error("UserUploadedFileUseCase - scan - repo.UpdateStatus : error updating status", "error", err)
+			return fmt.Errorf("UserUploadedFileUseCase - scan - s.repo.UpdateStatus: %w", err)
+		}
+		uc.logger.Info("UserUploadedFileUseCase - scan : file is clean", "userUploadedFileID", userUploadedFile.ID)
+		return nil
+	}
+
+	err = uc.repo.UpdateStatus(ctx, userUploadedFile.ID, entity.FileStatusQuarantined, &reason)
+	if err != nil {
+		uc.logger.Error("UserUploadedFileUseCase - scan - repo.UpdateStatus : error quarantining file", "error", err)
+		return fmt.Errorf("UserUploadedFileUseCase - scan - s.repo.UpdateStatus: %w", err)
+	}
+
+	uc.logger.Info("UserUploadedFileUseCase - scan : file quarantined", "userUploadedFileID", userUploadedFile.ID)
+	return apperrors.NewFileQuarantinedError(reason, "UserUploadedFileUseCase - scan")
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,9 +2,13 @@ package usecase
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/internal/usecase/dto"
 	"github.com/bgg/go-flow-gateway/pkg/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -22,7 +26,21 @@ type MockUserUploadedFileEmailSender struct {
 	mock.Mock
 }
 
-func (m *MockUserUploadedFileRepo) Create(ctx context.Context, u entity.UserUploadedFile) (int, error) {
+type MockFileScanner struct {
+	mock.Mock
+}
+
+// Create runs admit on the usage the test sets up with GetUsage, as the repo does under the lock of the user.
+func (m *MockUserUploadedFileRepo) Create(ctx context.Context, u entity.UserUploadedFile, admit func(usage entity.StorageUsage) error) (int, error) {
+	if admit != nil {
+		usage, err := m.GetUsage(ctx, u.UserID)
+		if err != nil {
+			return 0, err
+		}
+		if err := admit(usage); err != nil {
+			return 0, err
+		}
+	}
 	args := m.Called(ctx, u)
 	return args.Int(0), args.Error(1)
 }
@@ -32,9 +50,9 @@ func (m *MockUserUploadedFilePublisher) Publish(ctx context.Context, file entity
 	return args.Error(0)
 }
 
-func (m *MockUserUploadedFileEmailSender) Send(ctx context.Context, file entity.UserUploadedFile) error {
+func (m *MockUserUploadedFileEmailSender) Send(ctx context.Context, file entity.UserUploadedFile) (string, error) {
 	args := m.Called(ctx, file)
-	return args.Error(0)
+	return args.String(0), args.Error(1)
 }
 
 func (m *MockUserUploadedFileRepo) GetPaginatedFiles(ctx context.Context, lastID, userID, limit int) ([]entity.UserUploadedFile, int, error) {
@@ -42,19 +60,205 @@ func (m *MockUserUploadedFileRepo) GetPaginatedFiles(ctx context.Context, lastID
 	return args.Get(0).([]entity.UserUploadedFile), args.Get(1).(int), args.Error(2)
 }
 
-func (m *MockUserUploadedFileRepo) UpdateEmailSent(ctx context.Context, id int) error {
+func (m *MockUserUploadedFileRepo) UpdateEmailSent(ctx context.Context, id int, messageID string) error {
+	args := m.Called(ctx, id, messageID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) ClaimEmail(ctx context.Context, id int, now, staleBefore time.Time) error {
+	args := m.Called(ctx, id, now, staleBefore)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) ReleaseEmail(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) RequeueEmail(ctx context.Context, id, userID int, recipients []string) error {
+	args := m.Called(ctx, id, userID, recipients)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) GetFailedEmails(ctx context.Context, from, to time.Time, lastID, limit int) ([]entity.UserUploadedFile, error) {
+	args := m.Called(ctx, from, to, lastID, limit)
+	return args.Get(0).([]entity.UserUploadedFile), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) ClaimDelivery(ctx context.Context, deliveryID int, now, staleBefore time.Time) error {
+	args := m.Called(ctx, deliveryID, now, staleBefore)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) RequeueDelivery(ctx context.Context, deliveryID, userID int, recipients []string) error {
+	args := m.Called(ctx, deliveryID, userID, recipients)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) GetFailedDeliveries(ctx context.Context, from, to time.Time, lastID, limit int) ([]entity.Delivery, error) {
+	args := m.Called(ctx, from, to, lastID, limit)
+	return args.Get(0).([]entity.Delivery), args.Error(1)
+}
+
+// CreateResend passes the number of resends given to Return to admit, like the repository does with the
+// count it reads.
+func (m *MockUserUploadedFileRepo) CreateResend(ctx context.Context, userID, userUploadedFileID int, since time.Time, admit func(resends int64) error) (int, error) {
+	args := m.Called(ctx, userID, userUploadedFileID, since)
+	if err := admit(args.Get(0).(int64)); err != nil {
+		return 0, err
+	}
+	return args.Int(1), args.Error(2)
+}
+
+func (m *MockUserUploadedFileRepo) DeleteResend(ctx context.Context, resendID int) error {
+	args := m.Called(ctx, resendID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) ApplyMailEvent(ctx context.Context, event entity.MailEvent) (int, error) {
+	args := m.Called(ctx, event)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) UpdateStatus(ctx context.Context, id int, status string, errorMessage *string) error {
+	args := m.Called(ctx, id, status, errorMessage)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) GetBlobIDByChecksum(ctx context.Context, userID int, checksum string) (int, error) {
+	args := m.Called(ctx, userID, checksum)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) Delete(ctx context.Context, id, userID int) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) GetUsage(ctx context.Context, userID int) (entity.StorageUsage, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(entity.StorageUsage), args.Error(1)
+}
+
+// CreateDelivery runs admit like Create does.
+func (m *MockUserUploadedFileRepo) CreateDelivery(ctx context.Context, delivery entity.Delivery, admit func(usage entity.StorageUsage) ([]entity.UserUploadedFile, error)) (entity.Delivery, error) {
+	if admit != nil {
+		usage, err := m.GetUsage(ctx, delivery.UserID)
+		if err != nil {
+			return entity.Delivery{}, err
+		}
+		delivery.Files, err = admit(usage)
+		if err != nil {
+			return entity.Delivery{}, err
+		}
+	}
+	args := m.Called(ctx, delivery)
+	return args.Get(0).(entity.Delivery), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) GetDelivery(ctx context.Context, id int) (entity.Delivery, error) {
 	args := m.Called(ctx, id)
+	return args.Get(0).(entity.Delivery), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) UpdateDeliveryStatus(ctx context.Context, id int, status string, errorMessage *string) error {
+	args := m.Called(ctx, id, status, errorMessage)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) RescheduleDelivery(ctx context.Context, deliveryID, userID int, sendAt time.Time) error {
+	args := m.Called(ctx, deliveryID, userID, sendAt)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) CancelDelivery(ctx context.Context, deliveryID, userID int) error {
+	args := m.Called(ctx, deliveryID, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) ClaimDueDeliveries(ctx context.Context, now, staleBefore time.Time, limit int) ([]entity.Delivery, error) {
+	args := m.Called(ctx, now, staleBefore, limit)
+	return args.Get(0).([]entity.Delivery), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) MarkDeliveryPublished(ctx context.Context, deliveryID int) error {
+	args := m.Called(ctx, deliveryID)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) GetByID(ctx context.Context, id, userID int) (entity.UserUploadedFile, error) {
+	args := m.Called(ctx, id, userID)
+	return args.Get(0).(entity.UserUploadedFile), args.Error(1)
+}
+
+func (m *MockUserUploadedFileRepo) ExpireFiles(ctx context.Context, now time.Time, limit int) ([]int, error) {
+	args := m.Called(ctx, now, limit)
+	return args.Get(0).([]int), args.Error(1)
+}
+
+func (m *MockUserUploadedFilePublisher) PublishDelivery(ctx context.Context, delivery entity.Delivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFilePublisher) PublishFileEvent(ctx context.Context, event entity.FileEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+// fileEvent matches a published file event by its type and file.
+func fileEvent(eventType string, fileID int) interface{} {
+	return mock.MatchedBy(func(e entity.FileEvent) bool {
+		return e.Type == eventType && e.File.ID == fileID && e.ID != ""
+	})
+}
+
+func (m *MockUserUploadedFileRepo) GetBlobContent(ctx context.Context, blobID int) ([]byte, error) {
+	args := m.Called(ctx, blobID)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockUserUploadedFileEmailSender) ArchivePassword(delivery entity.Delivery) (string, error) {
+	args := m.Called(delivery)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockUserUploadedFileEmailSender) SendDelivery(ctx context.Context, delivery entity.Delivery, password string, load func(ctx context.Context, file entity.UserUploadedFile) ([]byte, error)) (string, error) {
+	args := m.Called(ctx, delivery, password)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockUserUploadedFileEmailSender) SendArchivePassword(ctx context.Context, delivery entity.Delivery, password string) error {
+	args := m.Called(ctx, delivery, password)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) SetArchivePassword(ctx context.Context, deliveryID int, password string) error {
+	args := m.Called(ctx, deliveryID, password)
+	return args.Error(0)
+}
+
+func (m *MockUserUploadedFileRepo) MarkArchiveSent(ctx context.Context, deliveryID int) error {
+	args := m.Called(ctx, deliveryID)
 	return args.Error(0)
 }
 
-func setupUserUploadedFileUseCase(t *testing.T) (*UserUploadedFileUseCase, *MockUserUploadedFileRepo, *MockUserUploadedFilePublisher, *MockUserUploadedFileEmailSender) {
+func (m *MockFileScanner) Scan(ctx context.Context, name string, content []byte) (dto.ScanResult, error) {
+	args := m.Called(ctx, name, content)
+	return args.Get(0).(dto.ScanResult), args.Error(1)
+}
+
+func setupUserUploadedFileUseCase(t *testing.T) (*UserUploadedFileUseCase, *MockUserUploadedFileRepo, *MockUserUploadedFilePublisher, *MockUserUploadedFileEmailSender, *MockFileScanner) {
 	t.Helper()
 
 	mockRepo := new(MockUserUploadedFileRepo)
 	mockPub := new(MockUserUploadedFilePublisher)
 	mockSender := new(MockUserUploadedFileEmailSender)
-	uc := NewUserUploadedFileUseCase(mockRepo, mockPub, mockSender, logger.New("debug"))
-	return uc, mockRepo, mockPub, mockSender
+	mockScanner := new(MockFileScanner)
+	// file events only feed notifications, tests asserting them check the calls afterwards
+	mockPub.On("PublishFileEvent", mock.Anything, mock.Anything).Return(nil).Maybe()
+	uc := NewUserUploadedFileUseCase(mockRepo, mockPub, mockSender, mockScanner, UploadPolicy{}, UploadQuota{}, logger.New("debug"))
+	return uc, mockRepo, mockPub, mockSender, mockScanner
 }
 
 func TestUserUploadedFileUseCase_Create(t *testing.T) {
@@ -68,15 +272,17 @@ func TestUserUploadedFileUseCase_Create(t *testing.T) {
 	)
 	t.Run("Create user uploaded file successfully", func(t *testing.T) {
 		// Arrange
-		uc, mockRepo, mockPub, _ := setupUserUploadedFileUseCase(t)
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
 		ctx := context.Background()
 
 		userUploadedFile := entity.UserUploadedFile{
-			ID:      ID,
-			Name:    name,
-			Size:    size,
-			Content: []byte(content),
-			UserID:  userID,
+			ID:          ID,
+			Name:        name,
+			Size:        size,
+			ContentType: "text/plain",
+			Checksum:    Checksum([]byte(content)),
+			Content:     []byte(content),
+			UserID:      userID,
 		}
 
 		mockRepo.On("Create", ctx, userUploadedFile).Return(ID, nil)
@@ -94,10 +300,10 @@ func TestUserUploadedFileUseCase_Create(t *testing.T) {
 
 	t.Run("Create user uploaded file with empty file", func(t *testing.T) {
 		// Arrange
-		uc, mockRepo, _, _ := setupUserUploadedFileUseCase(t)
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
 		ctx := context.Background()
 
-		userUploadedFile := entity.UserUploadedFile{}
+		userUploadedFile := entity.UserUploadedFile{ContentType: "text/plain", Checksum: Checksum(nil)}
 		mockRepo.On("Create", ctx, userUploadedFile).Return(0, assert.AnError)
 
 		// Act
@@ -109,6 +315,145 @@ func TestUserUploadedFileUseCase_Create(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("Create user uploaded file reusing stored content", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		uc.policy = UploadPolicy{Deduplicate: true}
+		ctx := context.Background()
+		const blobID = 7
+
+		userUploadedFile := entity.UserUploadedFile{
+			Name:        name,
+			Size:        size,
+			ContentType: "text/plain",
+			Checksum:    Checksum([]byte(content)),
+			Content:     []byte(content),
+			UserID:      userID,
+		}
+		deduplicated := userUploadedFile
+		deduplicated.BlobID = blobID
+
+		mockRepo.On("GetBlobIDByChecksum", ctx, userID, userUploadedFile.Checksum).Return(blobID, nil)
+		mockRepo.On("Create", ctx, deduplicated).Return(ID, nil)
+		deduplicated.ID = ID
+		mockPub.On("Publish", ctx, deduplicated).Return(nil)
+
+		// Act
+		result, err := uc.Create(ctx, userUploadedFile)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, deduplicated, result)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("Reject user uploaded file blocked by upload policy", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		uc.policy = UploadPolicy{BlockedExtensions: []string{".exe"}}
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{
+			Name:    "../../setup.exe",
+			Size:    size,
+			Content: []byte("MZ\x90\x00"),
+			UserID:  userID,
+		}
+
+		// Act
+		_, err := uc.Create(ctx, userUploadedFile)
+
+		// Assert
+		upve, ok := apperrors.AsUploadPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.UploadPolicyExtensionBlocked, upve.Reason)
+		mockRepo.AssertNotCalled(t, "Create")
+	})
+
+	t.Run("Reject user uploaded file over the upload rate", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		uc.quota = UploadQuota{MaxUploadsPerHour: 5}
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{
+			Name:    name,
+			Size:    size,
+			Content: []byte(content),
+			UserID:  userID,
+		}
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{UploadsLastHour: 5}, nil)
+
+		// Act
+		_, err := uc.Create(ctx, userUploadedFile)
+
+		// Assert
+		qee, ok := apperrors.AsQuotaExceededError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.QuotaUploadRateExceeded, qee.Reason)
+		mockRepo.AssertNotCalled(t, "Create")
+	})
+
+	t.Run("Reject user uploaded file over the storage quota", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		uc.quota = UploadQuota{MaxBytes: 1000}
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{
+			Name:    name,
+			Size:    size,
+			Content: []byte(content),
+			UserID:  userID,
+		}
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{BytesStored: 950}, nil)
+
+		// Act
+		_, err := uc.Create(ctx, userUploadedFile)
+
+		// Assert
+		qee, ok := apperrors.AsQuotaExceededError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.QuotaStorageExceeded, qee.Reason)
+		mockRepo.AssertNotCalled(t, "Create")
+	})
+
+	t.Run("Create user uploaded file sharing stored content at the storage quota", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		uc.policy = UploadPolicy{Deduplicate: true}
+		uc.quota = UploadQuota{MaxBytes: 1000}
+		ctx := context.Background()
+		const blobID = 7
+
+		userUploadedFile := entity.UserUploadedFile{
+			Name:        name,
+			Size:        size,
+			ContentType: "text/plain",
+			Checksum:    Checksum([]byte(content)),
+			Content:     []byte(content),
+			UserID:      userID,
+		}
+		deduplicated := userUploadedFile
+		deduplicated.BlobID = blobID
+
+		mockRepo.On("GetBlobIDByChecksum", ctx, userID, userUploadedFile.Checksum).Return(blobID, nil)
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{BytesStored: 1000}, nil)
+		mockRepo.On("Create", ctx, deduplicated).Return(ID, nil)
+		deduplicated.ID = ID
+		mockPub.On("Publish", ctx, deduplicated).Return(nil)
+
+		// Act
+		_, err := uc.Create(ctx, userUploadedFile)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
 }
 
 func TestUserUploadedFileUseCase_SendEmail(t *testing.T) {
@@ -122,7 +467,7 @@ func TestUserUploadedFileUseCase_SendEmail(t *testing.T) {
 
 	t.Run("Send email successfully", func(t *testing.T) {
 		// Arrange
-		uc, mockRepo, _, mockSender := setupUserUploadedFileUseCase(t)
+		uc, mockRepo, mockPub, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
 		ctx := context.Background()
 
 		userUploadedFile := entity.UserUploadedFile{
@@ -133,8 +478,13 @@ func TestUserUploadedFileUseCase_SendEmail(t *testing.T) {
 			UserID:  userID,
 		}
 
-		mockRepo.On("UpdateEmailSent", ctx, userUploadedFile.ID).Return(nil)
-		mockSender.On("Send", ctx, userUploadedFile).Return(nil)
+		mockRepo.On("ClaimEmail", ctx, userUploadedFile.ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, userUploadedFile.ID, userUploadedFile.UserID).Return(entity.UserUploadedFile{ID: userUploadedFile.ID, Status: entity.FileStatusPending}, nil)
+		mockRepo.On("GetBlobContent", ctx, 0).Return([]byte(content), nil)
+		mockScanner.On("Scan", ctx, userUploadedFile.Name, userUploadedFile.Content).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, userUploadedFile.ID, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockRepo.On("UpdateEmailSent", ctx, userUploadedFile.ID, "msg-id").Return(nil)
+		mockSender.On("Send", ctx, userUploadedFile).Return("msg-id", nil)
 
 		// Act
 		err := uc.SendEmail(ctx, userUploadedFile)
@@ -143,11 +493,12 @@ func TestUserUploadedFileUseCase_SendEmail(t *testing.T) {
 		assert.NoError(t, err)
 		mockSender.AssertExpectations(t)
 		mockRepo.AssertExpectations(t)
+		mockPub.AssertCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventEmailed, ID))
 	})
 
 	t.Run("Send email with empty email recipient", func(t *testing.T) {
 		// Arrange
-		uc, _, _, mockSender := setupUserUploadedFileUseCase(t)
+		uc, mockRepo, mockPub, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
 		ctx := context.Background()
 
 		userUploadedFile := entity.UserUploadedFile{
@@ -159,7 +510,13 @@ func TestUserUploadedFileUseCase_SendEmail(t *testing.T) {
 			EmailRecipient: "",
 		}
 
-		mockSender.On("Send", ctx, userUploadedFile).Return(assert.AnError)
+		mockRepo.On("ClaimEmail", ctx, userUploadedFile.ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, userUploadedFile.ID, userUploadedFile.UserID).Return(entity.UserUploadedFile{ID: userUploadedFile.ID, Status: entity.FileStatusPending}, nil)
+		mockRepo.On("GetBlobContent", ctx, 0).Return([]byte(content), nil)
+		mockRepo.On("ReleaseEmail", ctx, userUploadedFile.ID).Return(nil)
+		mockScanner.On("Scan", ctx, userUploadedFile.Name, userUploadedFile.Content).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, userUploadedFile.ID, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("Send", ctx, userUploadedFile).Return("", assert.AnError)
 
 		// Act
 		err := uc.SendEmail(ctx, userUploadedFile)
@@ -167,56 +524,1291 @@ func TestUserUploadedFileUseCase_SendEmail(t *testing.T) {
 		// Assert
 		assert.Error(t, err)
 		mockSender.AssertExpectations(t)
+		mockPub.AssertCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventEmailFailed, ID))
+		mockPub.AssertNotCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventEmailed, ID))
 	})
-}
 
-func TestUserUploadedFileUseCase_GetPaginatedFiles(t *testing.T) {
-
-	const (
-		userID  = 123
-		lastID  = 0
-		limit   = 10
-		ID      = 1
-		name    = "test.txt"
-		size    = 100
-		content = "test"
-	)
-	t.Run("Get paginated files successfully", func(t *testing.T) {
+	t.Run("Fail email when the checksum does not match", func(t *testing.T) {
 		// Arrange
-		uc, mockRepo, _, _ := setupUserUploadedFileUseCase(t)
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
 		ctx := context.Background()
 
-		userUploadedFiles := []entity.UserUploadedFile{
-			{
-				ID:      ID,
-				Name:    name,
-				Size:    size,
-				Content: []byte(content),
-				UserID:  userID,
-			},
+		userUploadedFile := entity.UserUploadedFile{
+			ID:       ID,
+			Name:     name,
+			Size:     size,
+			Checksum: Checksum([]byte(content)),
+			Content:  []byte(content),
+			UserID:   userID,
 		}
+		reason := "checksum mismatch"
 
-		mockRepo.On("GetPaginatedFiles", ctx, lastID, userID, limit).Return(userUploadedFiles, len(userUploadedFiles), nil)
+		mockRepo.On("ClaimEmail", ctx, userUploadedFile.ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, userUploadedFile.ID, userUploadedFile.UserID).Return(entity.UserUploadedFile{ID: userUploadedFile.ID, BlobID: 11, Checksum: Checksum([]byte(content)), Status: entity.FileStatusPending}, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("corrupted content"), nil)
+		mockRepo.On("ReleaseEmail", ctx, userUploadedFile.ID).Return(nil)
+		mockRepo.On("UpdateStatus", ctx, userUploadedFile.ID, entity.FileStatusFailed, &reason).Return(nil)
 
 		// Act
-		result, totalRecords, err := uc.GetPaginatedFiles(ctx, lastID, userID, limit)
+		err := uc.SendEmail(ctx, userUploadedFile)
+
+		// Assert
+		assert.True(t, apperrors.IsChecksumMismatchError(err), "A corrupted blob should fail the file for good")
+		mockRepo.AssertExpectations(t)
+		mockScanner.AssertNotCalled(t, "Scan")
+		mockSender.AssertNotCalled(t, "Send")
+	})
+
+	t.Run("Send the stored content rather than the copy in the message", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{ID: ID, Name: name, Content: []byte("stale copy"), UserID: userID}
+		stored := entity.UserUploadedFile{ID: ID, BlobID: 11, Checksum: Checksum([]byte(content)), Status: entity.FileStatusClean}
+
+		mockRepo.On("ClaimEmail", ctx, ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, ID, userID).Return(stored, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte(content), nil)
+		mockScanner.On("Scan", ctx, name, []byte(content)).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, ID, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("Send", ctx, mock.MatchedBy(func(f entity.UserUploadedFile) bool {
+			return string(f.Content) == content
+		})).Return("msg-id", nil)
+		mockRepo.On("UpdateEmailSent", ctx, ID, "msg-id").Return(nil)
+
+		// Act
+		err := uc.SendEmail(ctx, userUploadedFile)
 
 		// Assert
-		assert.Equal(t, len(userUploadedFiles), totalRecords)
 		assert.NoError(t, err)
-		assert.Equal(t, userUploadedFiles, result)
+		mockSender.AssertExpectations(t)
 		mockRepo.AssertExpectations(t)
 	})
 
-	t.Run("Get paginated files with invalid user ID", func(t *testing.T) {
+	t.Run("Block email for an infected file", func(t *testing.T) {
 		// Arrange
-		uc, mockRepo, _, _ := setupUserUploadedFileUseCase(t)
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
 		ctx := context.Background()
 
-		mockRepo.On("GetPaginatedFiles", ctx, lastID, userID, limit).Return([]entity.UserUploadedFile{}, 0, assert.AnError)
+		userUploadedFile := entity.UserUploadedFile{
+			ID:      ID,
+			Name:    name,
+			Size:    size,
+			Content: []byte(content),
+			UserID:  userID,
+		}
+		reason := "malware detected: Eicar-Test-Signature"
+
+		mockRepo.On("ClaimEmail", ctx, userUploadedFile.ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, userUploadedFile.ID, userUploadedFile.UserID).Return(entity.UserUploadedFile{ID: userUploadedFile.ID, Status: entity.FileStatusPending}, nil)
+		mockRepo.On("GetBlobContent", ctx, 0).Return([]byte(content), nil)
+		mockRepo.On("ReleaseEmail", ctx, userUploadedFile.ID).Return(nil)
+		mockScanner.On("Scan", ctx, userUploadedFile.Name, userUploadedFile.Content).Return(dto.ScanResult{Clean: false, Signature: "Eicar-Test-Signature"}, nil)
+		mockRepo.On("UpdateStatus", ctx, userUploadedFile.ID, entity.FileStatusQuarantined, &reason).Return(nil)
 
 		// Act
-		_, _, err := uc.GetPaginatedFiles(ctx, lastID, userID, limit)
+		err := uc.SendEmail(ctx, userUploadedFile)
+
+		// Assert
+		assert.True(t, apperrors.IsFileQuarantinedError(err))
+		mockScanner.AssertExpectations(t)
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "Send", ctx, userUploadedFile)
+	})
+
+	t.Run("Retry email when the scanner cannot be reached", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{
+			ID:      ID,
+			Name:    name,
+			Size:    size,
+			Content: []byte(content),
+			UserID:  userID,
+		}
+
+		mockRepo.On("ClaimEmail", ctx, userUploadedFile.ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, userUploadedFile.ID, userUploadedFile.UserID).Return(entity.UserUploadedFile{ID: userUploadedFile.ID, Status: entity.FileStatusPending}, nil)
+		mockRepo.On("GetBlobContent", ctx, 0).Return([]byte(content), nil)
+		mockRepo.On("ReleaseEmail", ctx, userUploadedFile.ID).Return(nil)
+		mockScanner.On("Scan", ctx, userUploadedFile.Name, userUploadedFile.Content).Return(dto.ScanResult{}, assert.AnError)
+
+		// Act
+		err := uc.SendEmail(ctx, userUploadedFile)
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.False(t, apperrors.IsFileQuarantinedError(err), "A scanner outage should not block the email for good")
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockSender.AssertNotCalled(t, "Send", ctx, userUploadedFile)
+	})
+
+	t.Run("Block email for a file the scanner refuses to check", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{
+			ID:      ID,
+			Name:    name,
+			Size:    size,
+			Content: []byte(content),
+			UserID:  userID,
+		}
+		reason := "file could not be scanned: INSTREAM size limit exceeded."
+
+		mockRepo.On("ClaimEmail", ctx, userUploadedFile.ID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetByID", ctx, userUploadedFile.ID, userUploadedFile.UserID).Return(entity.UserUploadedFile{ID: userUploadedFile.ID, Status: entity.FileStatusPending}, nil)
+		mockRepo.On("GetBlobContent", ctx, 0).Return([]byte(content), nil)
+		mockRepo.On("ReleaseEmail", ctx, userUploadedFile.ID).Return(nil)
+		mockScanner.On("Scan", ctx, userUploadedFile.Name, userUploadedFile.Content).Return(dto.ScanResult{Unscannable: "INSTREAM size limit exceeded."}, nil)
+		mockRepo.On("UpdateStatus", ctx, userUploadedFile.ID, entity.FileStatusQuarantined, &reason).Return(nil)
+
+		// Act
+		err := uc.SendEmail(ctx, userUploadedFile)
+
+		// Assert
+		assert.True(t, apperrors.IsFileQuarantinedError(err))
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "Send", ctx, userUploadedFile)
+	})
+}
+
+func TestUserUploadedFileUseCase_SendEmail_Redelivered(t *testing.T) {
+
+	t.Run("Skip a file whose email is already sent or being sent", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		userUploadedFile := entity.UserUploadedFile{ID: 1, Name: "test.txt", Content: []byte("test")}
+		mockRepo.On("ClaimEmail", ctx, 1, mock.Anything, mock.Anything).
+			Return(apperrors.NewNoRowsAffectedError("email already sent or being sent", "test"))
+
+		// Act
+		err := uc.SendEmail(ctx, userUploadedFile)
+
+		// Assert
+		assert.NoError(t, err, "A redelivered message should be acknowledged")
+		mockScanner.AssertNotCalled(t, "Scan", mock.Anything, mock.Anything, mock.Anything)
+		mockSender.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+		mockPub.AssertNotCalled(t, "PublishFileEvent", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Claim the email with a stale limit in the past", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("ClaimEmail", ctx, 1, mock.Anything, mock.MatchedBy(func(staleBefore time.Time) bool {
+			return staleBefore.Before(time.Now().Add(-_emailClaimLease + time.Minute))
+		})).Return(assert.AnError)
+
+		// Act
+		err := uc.SendEmail(ctx, entity.UserUploadedFile{ID: 1})
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_SendEmail_NotSendable(t *testing.T) {
+
+	past := time.Now().Add(-time.Hour)
+	expiredAt := past
+	tests := []struct {
+		name    string
+		current entity.UserUploadedFile
+		isErr   func(error) bool
+	}{
+		{"Skip a file whose retention ended while queued", entity.UserUploadedFile{ID: 1, Status: entity.FileStatusClean, ExpiresAt: &past}, apperrors.IsFileExpiredError},
+		{"Skip a file whose content was purged while queued", entity.UserUploadedFile{ID: 1, Status: entity.FileStatusExpired, ExpiredAt: &expiredAt}, apperrors.IsFileExpiredError},
+		{"Skip a file quarantined while queued", entity.UserUploadedFile{ID: 1, Status: entity.FileStatusQuarantined}, apperrors.IsFileQuarantinedError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			uc, mockRepo, mockPub, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+			ctx := context.Background()
+
+			userUploadedFile := entity.UserUploadedFile{ID: 1, Name: "test.txt", Content: []byte("test"), UserID: 123, Status: entity.FileStatusClean}
+			mockRepo.On("ClaimEmail", ctx, 1, mock.Anything, mock.Anything).Return(nil)
+			mockRepo.On("GetByID", ctx, 1, 123).Return(tt.current, nil)
+			mockRepo.On("ReleaseEmail", ctx, 1).Return(nil)
+
+			// Act
+			err := uc.SendEmail(ctx, userUploadedFile)
+
+			// Assert
+			assert.True(t, tt.isErr(err), "unexpected error: %v", err)
+			mockRepo.AssertExpectations(t)
+			mockScanner.AssertNotCalled(t, "Scan", mock.Anything, mock.Anything, mock.Anything)
+			mockSender.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+			mockPub.AssertCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventEmailFailed, 1))
+		})
+	}
+}
+
+func TestUserUploadedFileUseCase_Resend(t *testing.T) {
+	const (
+		ID     = 1
+		userID = 123
+	)
+
+	t.Run("Queue the email of a file again", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		file := entity.UserUploadedFile{ID: ID, Name: "test.txt", BlobID: 11, UserID: userID, Status: entity.FileStatusClean, EmailSent: true}
+		mockRepo.On("GetByID", ctx, ID, userID).Return(file, nil)
+		mockRepo.On("RequeueEmail", ctx, ID, userID, []string(nil)).Return(nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockPub.On("Publish", ctx, mock.MatchedBy(func(f entity.UserUploadedFile) bool {
+			return f.ID == ID && string(f.Content) == "test"
+		})).Return(nil)
+		mockRepo.On("CreateResend", ctx, userID, ID, mock.AnythingOfType("time.Time")).Return(int64(0), 5, nil)
+
+		// Act
+		err := uc.Resend(ctx, ID, userID, nil)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("Queue the whole delivery of a file sent with others", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		deliveryID := 7
+		file := entity.UserUploadedFile{ID: ID, UserID: userID, DeliveryID: &deliveryID, Status: entity.FileStatusClean}
+		mockRepo.On("GetByID", ctx, ID, userID).Return(file, nil)
+		mockRepo.On("RequeueDelivery", ctx, deliveryID, userID, []string(nil)).Return(nil)
+		mockPub.On("PublishDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool { return d.ID == deliveryID })).Return(nil)
+		mockRepo.On("CreateResend", ctx, userID, ID, mock.AnythingOfType("time.Time")).Return(int64(0), 5, nil)
+
+		// Act
+		err := uc.Resend(ctx, ID, userID, nil)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "RequeueEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Report an email that is being sent", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UserUploadedFile{ID: ID, UserID: userID, Status: entity.FileStatusClean}, nil)
+		mockRepo.On("CreateResend", ctx, userID, ID, mock.AnythingOfType("time.Time")).Return(int64(0), 5, nil)
+		mockRepo.On("RequeueEmail", ctx, ID, userID, []string(nil)).Return(apperrors.NewNoRowsAffectedError("email being sent", "test"))
+		mockRepo.On("DeleteResend", ctx, 5).Return(nil)
+
+		// Act
+		err := uc.Resend(ctx, ID, userID, nil)
+
+		// Assert
+		assert.True(t, apperrors.IsEmailInProgressError(err))
+		mockPub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+		mockRepo.AssertCalled(t, "DeleteResend", ctx, 5)
+	})
+
+	t.Run("Refuse to resend a quarantined file", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UserUploadedFile{ID: ID, UserID: userID, Status: entity.FileStatusQuarantined}, nil)
+
+		// Act
+		err := uc.Resend(ctx, ID, userID, nil)
+
+		// Assert
+		assert.True(t, apperrors.IsFileQuarantinedError(err))
+		mockRepo.AssertNotCalled(t, "RequeueEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Send the email again to new recipients", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		recipients := []string{"johndoe@email.com", "janedoe@email.com"}
+		file := entity.UserUploadedFile{ID: ID, BlobID: 11, UserID: userID, Status: entity.FileStatusClean, EmailRecipient: "old@email.com"}
+		mockRepo.On("GetByID", ctx, ID, userID).Return(file, nil)
+		mockRepo.On("RequeueEmail", ctx, ID, userID, recipients).Return(nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockPub.On("Publish", ctx, mock.MatchedBy(func(f entity.UserUploadedFile) bool {
+			return f.EmailRecipient == "johndoe@email.com, janedoe@email.com"
+		})).Return(nil)
+		mockRepo.On("CreateResend", ctx, userID, ID, mock.AnythingOfType("time.Time")).Return(int64(0), 5, nil)
+
+		// Act
+		err := uc.Resend(ctx, ID, userID, recipients)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("Refuse to resend over the hourly resend limit", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		uc.quota = UploadQuota{MaxResendsPerHour: 3}
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UserUploadedFile{ID: ID, UserID: userID, Status: entity.FileStatusClean}, nil)
+		mockRepo.On("CreateResend", ctx, userID, ID, mock.AnythingOfType("time.Time")).Return(int64(3), 0, nil)
+
+		// Act
+		err := uc.Resend(ctx, ID, userID, nil)
+
+		// Assert
+		qee, ok := apperrors.AsQuotaExceededError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.QuotaResendRateExceeded, qee.Reason)
+		mockRepo.AssertNotCalled(t, "RequeueEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockPub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserUploadedFileUseCase_RequeueFailed(t *testing.T) {
+	from := time.Now().Add(-24 * time.Hour)
+	to := time.Now()
+
+	t.Run("Queue the failed deliveries and emails of the window again", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetFailedDeliveries", ctx, from, to, 0, _failedEmailsBatchSize).Return([]entity.Delivery{{ID: 7, UserID: 123}, {ID: 8, UserID: 456}}, nil)
+		mockRepo.On("RequeueDelivery", ctx, 7, 123, []string(nil)).Return(nil)
+		mockRepo.On("RequeueDelivery", ctx, 8, 456, []string(nil)).Return(apperrors.NewNoRowsAffectedError("delivery being sent", "test"))
+		mockPub.On("PublishDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool { return d.ID == 7 })).Return(nil)
+		mockRepo.On("GetFailedEmails", ctx, from, to, 0, _failedEmailsBatchSize).Return([]entity.UserUploadedFile{{ID: 1, BlobID: 11, UserID: 123}}, nil)
+		mockRepo.On("RequeueEmail", ctx, 1, 123, []string(nil)).Return(nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockPub.On("Publish", ctx, mock.MatchedBy(func(f entity.UserUploadedFile) bool { return f.ID == 1 })).Return(nil)
+
+		// Act
+		result, err := uc.RequeueFailed(ctx, from, to)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, dto.RequeueResult{Files: 1, Deliveries: 1, Skipped: 1}, result)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "CreateResend", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Stop when a delivery cannot be published", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetFailedDeliveries", ctx, from, to, 0, _failedEmailsBatchSize).Return([]entity.Delivery{{ID: 7, UserID: 123}}, nil)
+		mockRepo.On("RequeueDelivery", ctx, 7, 123, []string(nil)).Return(nil)
+		mockPub.On("PublishDelivery", ctx, mock.Anything).Return(assert.AnError)
+
+		// Act
+		_, err := uc.RequeueFailed(ctx, from, to)
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError)
+		mockRepo.AssertNotCalled(t, "GetFailedEmails", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserUploadedFileUseCase_CreateDelivery(t *testing.T) {
+	const userID = 123
+	recipients := []string{"johndoe@email.com", "janedoe@email.com"}
+
+	t.Run("Create delivery and report the rejected files", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		uc.policy = UploadPolicy{BlockedExtensions: []string{".exe"}}
+		ctx := context.Background()
+
+		delivery := entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: recipients,
+			Files: []entity.UserUploadedFile{
+				{Name: "notes.txt", Size: 4, Content: []byte("test")},
+				{Name: "setup.exe", Size: 4, Content: []byte("test")},
+			},
+		}
+
+		mockRepo.On("CreateDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool {
+			return len(d.Files) == 1 && d.Files[0].Name == "notes.txt" && d.Files[0].EmailRecipient == "johndoe@email.com, janedoe@email.com" && d.Status == entity.DeliveryStatusPending
+		})).Return(entity.Delivery{ID: 7, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt"}}}, nil)
+		mockPub.On("PublishDelivery", ctx, mock.AnythingOfType("entity.Delivery")).Return(nil)
+
+		// Act
+		result, results, err := uc.CreateDelivery(ctx, delivery)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 7, result.ID)
+		assert.Equal(t, []dto.DeliveryFileResult{
+			{Name: "notes.txt", ID: 1},
+			{Name: "setup.exe", Code: apperrors.UploadPolicyExtensionBlocked, Error: results[1].Error},
+		}, results)
+		assert.NotEmpty(t, results[1].Error)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("Do not create a delivery when no file is accepted", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		uc.policy = UploadPolicy{BlockedExtensions: []string{".exe"}}
+		ctx := context.Background()
+
+		delivery := entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: recipients,
+			Files:           []entity.UserUploadedFile{{Name: "setup.exe", Size: 4, Content: []byte("test")}},
+		}
+
+		// Act
+		result, results, err := uc.CreateDelivery(ctx, delivery)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Zero(t, result.ID)
+		assert.Len(t, results, 1)
+		mockRepo.AssertNotCalled(t, "CreateDelivery")
+		mockPub.AssertNotCalled(t, "PublishDelivery")
+	})
+
+	t.Run("Reject a batch with too many files", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		uc.policy = UploadPolicy{MaxBatchFiles: 1}
+		ctx := context.Background()
+
+		delivery := entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: recipients,
+			Files:           []entity.UserUploadedFile{{Name: "a.txt"}, {Name: "b.txt"}},
+		}
+
+		// Act
+		_, _, err := uc.CreateDelivery(ctx, delivery)
+
+		// Assert
+		upve, ok := apperrors.AsUploadPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.UploadPolicyTooManyFiles, upve.Reason)
+		mockRepo.AssertNotCalled(t, "CreateDelivery")
+	})
+
+	t.Run("Reject the files of a batch that exceed the storage quota", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		uc.quota = UploadQuota{MaxFiles: 1}
+		ctx := context.Background()
+
+		delivery := entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: recipients,
+			Files: []entity.UserUploadedFile{
+				{Name: "a.txt", Size: 1, Content: []byte("a")},
+				{Name: "b.txt", Size: 1, Content: []byte("b")},
+			},
+		}
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{}, nil)
+		mockRepo.On("CreateDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool {
+			return len(d.Files) == 1 && d.Files[0].Name == "a.txt"
+		})).Return(entity.Delivery{ID: 7, Files: []entity.UserUploadedFile{{ID: 1, Name: "a.txt"}}}, nil)
+		mockPub.On("PublishDelivery", ctx, mock.AnythingOfType("entity.Delivery")).Return(nil)
+
+		// Act
+		_, results, err := uc.CreateDelivery(ctx, delivery)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, results[0].ID)
+		assert.Equal(t, apperrors.QuotaFileCountExceeded, results[1].Code)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_CreateDelivery_Scheduled(t *testing.T) {
+	const userID = 123
+
+	t.Run("Store a delivery with a future send time as scheduled without publishing it", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+		sendAt := time.Now().Add(time.Hour)
+
+		delivery := entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: []string{"johndoe@email.com"},
+			Files:           []entity.UserUploadedFile{{Name: "notes.txt", Size: 4, Content: []byte("test")}},
+			SendAt:          &sendAt,
+		}
+
+		mockRepo.On("CreateDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool {
+			return d.Status == entity.DeliveryStatusScheduled && d.SendAt == &sendAt
+		})).Return(entity.Delivery{ID: 7, Status: entity.DeliveryStatusScheduled, SendAt: &sendAt, Files: []entity.UserUploadedFile{{ID: 1}}}, nil)
+
+		// Act
+		result, _, err := uc.CreateDelivery(ctx, delivery)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, entity.DeliveryStatusScheduled, result.Status)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertNotCalled(t, "PublishDelivery")
+	})
+
+	t.Run("Publish a delivery with a past send time right away", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+		sendAt := time.Now().Add(-time.Minute)
+
+		delivery := entity.Delivery{
+			UserID:          userID,
+			EmailRecipients: []string{"johndoe@email.com"},
+			Files:           []entity.UserUploadedFile{{Name: "notes.txt", Size: 4, Content: []byte("test")}},
+			SendAt:          &sendAt,
+		}
+
+		mockRepo.On("CreateDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool {
+			return d.Status == entity.DeliveryStatusPending && d.SendAt == nil
+		})).Return(entity.Delivery{ID: 7, Status: entity.DeliveryStatusPending, Files: []entity.UserUploadedFile{{ID: 1}}}, nil)
+		mockPub.On("PublishDelivery", ctx, mock.AnythingOfType("entity.Delivery")).Return(nil)
+
+		// Act
+		_, _, err := uc.CreateDelivery(ctx, delivery)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_PublishDueDeliveries(t *testing.T) {
+
+	t.Run("Publish the due deliveries", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+		due := []entity.Delivery{{ID: 7}, {ID: 8}}
+
+		mockRepo.On("ClaimDueDeliveries", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), _dueDeliveriesBatchSize).Return(due, nil)
+		mockPub.On("PublishDelivery", ctx, due[0]).Return(nil)
+		mockPub.On("PublishDelivery", ctx, due[1]).Return(nil)
+		mockRepo.On("MarkDeliveryPublished", ctx, 7).Return(nil)
+		mockRepo.On("MarkDeliveryPublished", ctx, 8).Return(nil)
+
+		// Act
+		err := uc.PublishDueDeliveries(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("Put a delivery that cannot be published back to scheduled", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+		due := []entity.Delivery{{ID: 7}, {ID: 8}}
+
+		mockRepo.On("ClaimDueDeliveries", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), _dueDeliveriesBatchSize).Return(due, nil)
+		mockPub.On("PublishDelivery", ctx, due[0]).Return(assert.AnError)
+		mockPub.On("PublishDelivery", ctx, due[1]).Return(nil)
+		mockRepo.On("MarkDeliveryPublished", ctx, 8).Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, 7, entity.DeliveryStatusScheduled, (*string)(nil)).Return(nil)
+
+		// Act
+		err := uc.PublishDueDeliveries(ctx)
+
+		// Assert
+		assert.Error(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "UpdateDeliveryStatus", ctx, 8, entity.DeliveryStatusScheduled, (*string)(nil))
+	})
+}
+
+func TestUserUploadedFileUseCase_RescheduleDelivery(t *testing.T) {
+	const (
+		deliveryID = 7
+		userID     = 123
+	)
+
+	t.Run("Reschedule a delivery whose files outlive the new send time", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+		sendAt := time.Now().Add(time.Hour)
+		expiresAt := sendAt.Add(time.Hour)
+
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(entity.Delivery{ID: deliveryID, UserID: userID, Files: []entity.UserUploadedFile{{ID: 1, ExpiresAt: &expiresAt}}}, nil)
+		mockRepo.On("RescheduleDelivery", ctx, deliveryID, userID, sendAt).Return(nil)
+
+		// Act
+		err := uc.RescheduleDelivery(ctx, deliveryID, userID, sendAt)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reject a send time after a file of the delivery expires", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+		sendAt := time.Now().Add(48 * time.Hour)
+		expiresAt := time.Now().Add(24 * time.Hour)
+
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(entity.Delivery{ID: deliveryID, UserID: userID, Files: []entity.UserUploadedFile{{ID: 1}, {ID: 2, ExpiresAt: &expiresAt}}}, nil)
+
+		// Act
+		err := uc.RescheduleDelivery(ctx, deliveryID, userID, sendAt)
+
+		// Assert
+		upve, ok := apperrors.AsUploadPolicyViolationError(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperrors.UploadPolicyInvalidExpiry, upve.Reason)
+		mockRepo.AssertNotCalled(t, "RescheduleDelivery", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Report a delivery of another user as not found", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(entity.Delivery{ID: deliveryID, UserID: 456}, nil)
+
+		// Act
+		err := uc.RescheduleDelivery(ctx, deliveryID, userID, time.Now().Add(time.Hour))
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		mockRepo.AssertNotCalled(t, "RescheduleDelivery", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserUploadedFileUseCase_CancelDelivery(t *testing.T) {
+
+	t.Run("Report a delivery that is no longer scheduled", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("CancelDelivery", ctx, 7, 123).Return(apperrors.NewNoRowsAffectedError("scheduled delivery not found", "test"))
+
+		// Act
+		err := uc.CancelDelivery(ctx, 7, 123)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_SendDeliveryEmail(t *testing.T) {
+	const deliveryID = 7
+
+	t.Run("Send delivery and withhold the infected file", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		delivery := entity.Delivery{
+			ID:              deliveryID,
+			EmailRecipients: []string{"johndoe@email.com"},
+			Files: []entity.UserUploadedFile{
+				{ID: 1, Name: "notes.txt", BlobID: 11},
+				{ID: 2, Name: "eicar.txt", BlobID: 12},
+			},
+		}
+		reason := "malware detected: Eicar-Test-Signature"
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockRepo.On("GetBlobContent", ctx, 12).Return([]byte("virus"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockScanner.On("Scan", ctx, "eicar.txt", []byte("virus")).Return(dto.ScanResult{Clean: false, Signature: "Eicar-Test-Signature"}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockRepo.On("UpdateStatus", ctx, 2, entity.FileStatusQuarantined, &reason).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("", nil)
+		mockSender.On("SendDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool {
+			return d.Files[0].Status == entity.FileStatusClean && d.Files[1].Status == entity.FileStatusQuarantined
+		}), "").Return("msg-id", nil)
+		mockRepo.On("UpdateEmailSent", ctx, 1, "msg-id").Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusSent, (*string)(nil)).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "UpdateEmailSent", ctx, 2, "msg-id")
+	})
+
+	t.Run("Withhold a file that expired before the delivery", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		expiresAt := time.Now().Add(-time.Minute)
+		delivery := entity.Delivery{
+			ID: deliveryID,
+			Files: []entity.UserUploadedFile{
+				{ID: 1, Name: "notes.txt", BlobID: 11},
+				{ID: 2, Name: "old.txt", BlobID: 12, ExpiresAt: &expiresAt},
+			},
+		}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("", nil)
+		mockSender.On("SendDelivery", ctx, mock.MatchedBy(func(d entity.Delivery) bool {
+			return d.Files[0].Status == entity.FileStatusClean && d.Files[1].Status == entity.FileStatusExpired
+		}), "").Return("msg-id", nil)
+		mockRepo.On("UpdateEmailSent", ctx, 1, "msg-id").Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusSent, (*string)(nil)).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "GetBlobContent", ctx, 12)
+		mockPub.AssertCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventEmailed, 1))
+		mockPub.AssertCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventEmailFailed, 2))
+	})
+
+	t.Run("Fail the delivery when every file is withheld", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		delivery := entity.Delivery{
+			ID:    deliveryID,
+			Files: []entity.UserUploadedFile{{ID: 2, Name: "eicar.txt", BlobID: 12}},
+		}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 12).Return([]byte("virus"), nil)
+		mockScanner.On("Scan", ctx, "eicar.txt", []byte("virus")).Return(dto.ScanResult{Clean: false, Signature: "Eicar-Test-Signature"}, nil)
+		mockRepo.On("UpdateStatus", ctx, 2, entity.FileStatusQuarantined, mock.Anything).Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusFailed, mock.Anything).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.True(t, apperrors.IsNothingDeliverableError(err))
+		assert.True(t, apperrors.IsFileQuarantinedError(err))
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "SendDelivery")
+	})
+
+	t.Run("Report the reason of each withheld file when nothing can be delivered", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		expiredAt := time.Now().Add(-time.Hour)
+		delivery := entity.Delivery{
+			ID: deliveryID,
+			Files: []entity.UserUploadedFile{
+				{ID: 1, Name: "old.txt", BlobID: 11, ExpiresAt: &expiredAt},
+				{ID: 2, Name: "tampered.txt", BlobID: 12, Checksum: Checksum([]byte("original"))},
+			},
+		}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 12).Return([]byte("tampered"), nil)
+		mockRepo.On("UpdateStatus", ctx, 2, entity.FileStatusFailed, mock.Anything).Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusFailed, mock.MatchedBy(func(reason *string) bool {
+			return reason != nil && strings.Contains(*reason, "old.txt: the file has expired") && strings.Contains(*reason, "tampered.txt: ")
+		})).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.True(t, apperrors.IsNothingDeliverableError(err))
+		assert.True(t, apperrors.IsFileExpiredError(err))
+		assert.True(t, apperrors.IsChecksumMismatchError(err))
+		assert.False(t, apperrors.IsFileQuarantinedError(err), "No file was quarantined")
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "SendDelivery")
+	})
+}
+
+func TestUserUploadedFileUseCase_SendDeliveryEmail_Redelivered(t *testing.T) {
+	const deliveryID = 7
+
+	t.Run("Skip a delivery that is already sent or being sent", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).
+			Return(apperrors.NewNoRowsAffectedError("delivery already sent or being sent", "test"))
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err, "A redelivered message should be acknowledged")
+		mockRepo.AssertNotCalled(t, "GetDelivery", mock.Anything, mock.Anything)
+		mockSender.AssertNotCalled(t, "SendDelivery", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Put the delivery back to pending when the email cannot be sent", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		delivery := entity.Delivery{ID: deliveryID, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt", BlobID: 11}}}
+		reason := assert.AnError.Error()
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("", nil)
+		mockSender.On("SendDelivery", ctx, mock.Anything, "").Return("", assert.AnError)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusPending, &reason).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "UpdateEmailSent", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Record the password of the archive before sending it separately", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		delivery := entity.Delivery{ID: deliveryID, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt", BlobID: 11}}}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("secret", nil)
+		mockRepo.On("SetArchivePassword", ctx, deliveryID, "secret").Return(nil)
+		mockSender.On("SendDelivery", ctx, mock.Anything, "secret").Return("msg-id", nil)
+		mockRepo.On("MarkArchiveSent", ctx, deliveryID).Return(nil)
+		mockRepo.On("UpdateEmailSent", ctx, 1, "msg-id").Return(nil)
+		mockSender.On("SendArchivePassword", ctx, mock.Anything, "secret").Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusSent, (*string)(nil)).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("Keep the recorded password when its email cannot be sent", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		delivery := entity.Delivery{ID: deliveryID, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt", BlobID: 11}}}
+		reason := assert.AnError.Error()
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("secret", nil)
+		mockRepo.On("SetArchivePassword", ctx, deliveryID, "secret").Return(nil)
+		mockSender.On("SendDelivery", ctx, mock.Anything, "secret").Return("msg-id", nil)
+		mockRepo.On("MarkArchiveSent", ctx, deliveryID).Return(nil)
+		mockRepo.On("UpdateEmailSent", ctx, 1, "msg-id").Return(nil)
+		mockSender.On("SendArchivePassword", ctx, mock.Anything, "secret").Return(assert.AnError)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusPending, &reason).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError, "The message should be retried")
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusSent, (*string)(nil))
+	})
+
+	t.Run("Only send the password when the archive went out in an earlier attempt", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		password, sentAt := "secret", time.Now()
+		delivery := entity.Delivery{ID: deliveryID, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt", BlobID: 11}}, ArchivePassword: &password, ArchiveSentAt: &sentAt}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockSender.On("SendArchivePassword", ctx, mock.Anything, "secret").Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusSent, (*string)(nil)).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "SendDelivery", mock.Anything, mock.Anything, mock.Anything)
+		mockScanner.AssertNotCalled(t, "Scan", mock.Anything, mock.Anything, mock.Anything)
+		mockRepo.AssertNotCalled(t, "UpdateEmailSent", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Send the archive again with the recorded password when it did not go out", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		password := "secret"
+		delivery := entity.Delivery{ID: deliveryID, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt", BlobID: 11}}, ArchivePassword: &password}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("other", nil)
+		mockSender.On("SendDelivery", ctx, mock.Anything, "secret").Return("msg-id", nil)
+		mockRepo.On("MarkArchiveSent", ctx, deliveryID).Return(nil)
+		mockRepo.On("UpdateEmailSent", ctx, 1, "msg-id").Return(nil)
+		mockSender.On("SendArchivePassword", ctx, mock.Anything, "secret").Return(nil)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusSent, (*string)(nil)).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "SetArchivePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Release the delivery without sending when the archive password cannot be recorded", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, mockSender, mockScanner := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		delivery := entity.Delivery{ID: deliveryID, Files: []entity.UserUploadedFile{{ID: 1, Name: "notes.txt", BlobID: 11}}}
+
+		mockRepo.On("ClaimDelivery", ctx, deliveryID, mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("GetDelivery", ctx, deliveryID).Return(delivery, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+		mockScanner.On("Scan", ctx, "notes.txt", []byte("test")).Return(dto.ScanResult{Clean: true}, nil)
+		mockRepo.On("UpdateStatus", ctx, 1, entity.FileStatusClean, (*string)(nil)).Return(nil)
+		mockSender.On("ArchivePassword", mock.Anything).Return("secret", nil)
+		mockRepo.On("SetArchivePassword", ctx, deliveryID, "secret").Return(assert.AnError)
+		mockRepo.On("UpdateDeliveryStatus", ctx, deliveryID, entity.DeliveryStatusPending, mock.Anything).Return(nil)
+
+		// Act
+		err := uc.SendDeliveryEmail(ctx, deliveryID)
+
+		// Assert
+		assert.ErrorIs(t, err, assert.AnError, "The message should be retried")
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertNotCalled(t, "SendDelivery", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserUploadedFileUseCase_GetPaginatedFiles(t *testing.T) {
+
+	const (
+		userID  = 123
+		lastID  = 0
+		limit   = 10
+		ID      = 1
+		name    = "test.txt"
+		size    = 100
+		content = "test"
+	)
+	t.Run("Get paginated files successfully", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		userUploadedFiles := []entity.UserUploadedFile{
+			{
+				ID:      ID,
+				Name:    name,
+				Size:    size,
+				Content: []byte(content),
+				UserID:  userID,
+			},
+		}
+
+		mockRepo.On("GetPaginatedFiles", ctx, lastID, userID, limit).Return(userUploadedFiles, len(userUploadedFiles), nil)
+
+		// Act
+		result, totalRecords, err := uc.GetPaginatedFiles(ctx, lastID, userID, limit)
+
+		// Assert
+		assert.Equal(t, len(userUploadedFiles), totalRecords)
+		assert.NoError(t, err)
+		assert.Equal(t, userUploadedFiles, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Show files past their expiry as expired", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		expiresAt := time.Now().Add(-time.Minute)
+		userUploadedFiles := []entity.UserUploadedFile{
+			{ID: ID, Name: name, UserID: userID, Status: entity.FileStatusClean, ExpiresAt: &expiresAt},
+		}
+
+		mockRepo.On("GetPaginatedFiles", ctx, lastID, userID, limit).Return(userUploadedFiles, len(userUploadedFiles), nil)
+
+		// Act
+		result, _, err := uc.GetPaginatedFiles(ctx, lastID, userID, limit)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, entity.FileStatusExpired, result[0].Status)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Get paginated files with invalid user ID", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetPaginatedFiles", ctx, lastID, userID, limit).Return([]entity.UserUploadedFile{}, 0, assert.AnError)
+
+		// Act
+		_, _, err := uc.GetPaginatedFiles(ctx, lastID, userID, limit)
+
+		// Assert
+		assert.Error(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_Download(t *testing.T) {
+
+	const (
+		ID     = 1
+		userID = 123
+	)
+
+	t.Run("Download user uploaded file successfully", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		expiresAt := time.Now().Add(time.Hour)
+		file := entity.UserUploadedFile{ID: ID, Name: "test.txt", BlobID: 11, UserID: userID, Status: entity.FileStatusClean, ExpiresAt: &expiresAt}
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(file, nil)
+		mockRepo.On("GetBlobContent", ctx, 11).Return([]byte("test"), nil)
+
+		// Act
+		result, err := uc.Download(ctx, ID, userID)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("test"), result.Content)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Report an expired file", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetByID", ctx, ID, userID).Return(entity.UserUploadedFile{ID: ID, UserID: userID, Status: entity.FileStatusExpired}, nil)
+
+		// Act
+		_, err := uc.Download(ctx, ID, userID)
+
+		// Assert
+		assert.True(t, apperrors.IsFileExpiredError(err))
+		mockRepo.AssertNotCalled(t, "GetBlobContent", mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserUploadedFileUseCase_PurgeExpiredFiles(t *testing.T) {
+
+	t.Run("Purge expired files until no full batch is left", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		fullBatch := make([]int, _expiredFilesBatchSize)
+		mockRepo.On("ExpireFiles", ctx, mock.Anything, _expiredFilesBatchSize).Return(fullBatch, nil).Once()
+		mockRepo.On("ExpireFiles", ctx, mock.Anything, _expiredFilesBatchSize).Return([]int{1}, nil).Once()
+
+		// Act
+		err := uc.PurgeExpiredFiles(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertNumberOfCalls(t, "ExpireFiles", 2)
+	})
+}
+
+func TestUserUploadedFileUseCase_Delete(t *testing.T) {
+
+	const (
+		ID     = 1
+		userID = 123
+	)
+
+	t.Run("Delete user uploaded file successfully", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockPub, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("Delete", ctx, ID, userID).Return(nil)
+
+		// Act
+		err := uc.Delete(ctx, ID, userID)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockPub.AssertCalled(t, "PublishFileEvent", ctx, fileEvent(entity.FileEventDeleted, ID))
+	})
+
+	t.Run("Delete user uploaded file that does not exist", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("Delete", ctx, ID, userID).Return(apperrors.NewNoRowsAffectedError("test", "test"))
+
+		// Act
+		err := uc.Delete(ctx, ID, userID)
+
+		// Assert
+		assert.True(t, apperrors.IsNoRowsAffectedError(err))
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_GetUsage(t *testing.T) {
+
+	const userID = 123
+
+	t.Run("Get usage against the configured quotas", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		uc.quota = UploadQuota{MaxBytes: 1000, MaxFiles: 10}
+		ctx := context.Background()
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{BytesStored: 500, FileCount: 2, UploadsLastHour: 1}, nil)
+
+		// Act
+		usage, err := uc.GetUsage(ctx, userID)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, dto.UserUsage{
+			BytesStored:    dto.QuotaUsage{Used: 500, Limit: 1000},
+			FileCount:      dto.QuotaUsage{Used: 2, Limit: 10},
+			UploadsPerHour: dto.QuotaUsage{Used: 1, Limit: 0},
+		}, usage)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Get usage with repository error", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("GetUsage", ctx, userID).Return(entity.StorageUsage{}, assert.AnError)
+
+		// Act
+		_, err := uc.GetUsage(ctx, userID)
+
+		// Assert
+		assert.Error(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestUserUploadedFileUseCase_HandleMailEvents(t *testing.T) {
+
+	occurredAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("Apply normalised events and skip unknown emails", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		events := []entity.MailEvent{
+			{Type: entity.EmailStatusBounced, MessageID: " <abc@mail.com> ", Recipient: "JohnDoe@Email.com", OccurredAt: occurredAt},
+			{Type: entity.EmailStatusDelivered, MessageID: "unknown@mail.com", Recipient: "janedoe@email.com", OccurredAt: occurredAt},
+		}
+
+		mockRepo.On("ApplyMailEvent", ctx, entity.MailEvent{Type: entity.EmailStatusBounced, MessageID: "abc@mail.com", Recipient: "johndoe@email.com", OccurredAt: occurredAt}).Return(2, nil)
+		mockRepo.On("ApplyMailEvent", ctx, events[1]).Return(0, apperrors.NewNoRowsAffectedError("ApplyMailEvent", "unknown@mail.com"))
+
+		// Act
+		err := uc.HandleMailEvents(ctx, events)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Handle mail events with repository error", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _, _, _ := setupUserUploadedFileUseCase(t)
+		ctx := context.Background()
+
+		event := entity.MailEvent{Type: entity.EmailStatusDelivered, MessageID: "abc@mail.com", Recipient: "johndoe@email.com", OccurredAt: occurredAt}
+		mockRepo.On("ApplyMailEvent", ctx, event).Return(0, assert.AnError)
+
+		// Act
+		err := uc.HandleMailEvents(ctx, []entity.MailEvent{event})
 
 		// Assert
 		assert.Error(t, err)
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+)
+
+const (
+	// _dueWebhookDeliveriesBatchSize is the number of due webhook deliveries claimed at once by DispatchDue.
+	_dueWebhookDeliveriesBatchSize = 50
+	// _webhookClaimLease is how long a claimed delivery is hidden from other dispatchers. A dispatcher that
+	// stops before recording the attempt leaves the delivery to be retried once the lease is over.
+	_webhookClaimLease = 15 * time.Minute
+)
+
+type WebhookUseCase struct {
+	repo   WebhookRepo
+	sender WebhookSender
+	policy WebhookPolicy
+	logger logger.Logger
+}
+
+func NewWebhookUseCase(r WebhookRepo, s WebhookSender, policy WebhookPolicy, l logger.Logger) *WebhookUseCase {
+	return &WebhookUseCase{repo: r, sender: s, policy: policy, logger: l}
+}
+
+// CreateEndpoint registers a webhook endpoint with a generated secret. The secret is only returned here,
+// the user needs it to verify the signature of the payloads.
+func (uc *WebhookUseCase) CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (entity.WebhookEndpoint, error) {
+	if !uc.policy.AllowsURL(endpoint.URL) {
+		return entity.WebhookEndpoint{}, apperrors.NewInvalidWebhookURLError("webhook endpoint URL must be an absolute https URL", "WebhookUseCase - CreateEndpoint")
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - CreateEndpoint - newWebhookSecret : error generating secret", "error", err)
+		return entity.WebhookEndpoint{}, fmt.Errorf("WebhookUseCase - CreateEndpoint - newWebhookSecret: %w", err)
+	}
+	endpoint.Secret = secret
+	endpoint.Enabled = true
+
+	endpoint, err = uc.repo.CreateEndpoint(ctx, endpoint)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - CreateEndpoint - repo.CreateEndpoint : error creating webhook endpoint", "error", err)
+		return entity.WebhookEndpoint{}, fmt.Errorf("WebhookUseCase - CreateEndpoint - s.repo.CreateEndpoint: %w", err)
+	}
+
+	uc.logger.Info("WebhookUseCase - CreateEndpoint : webhook endpoint created", "endpointID", endpoint.ID)
+	return endpoint, nil
+}
+
+func (uc *WebhookUseCase) GetEndpoints(ctx context.Context, userID int) ([]entity.WebhookEndpoint, error) {
+	endpoints, err := uc.repo.GetEndpoints(ctx, userID)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - GetEndpoints - repo.GetEndpoints : error getting webhook endpoints", "error", err)
+		return nil, fmt.Errorf("WebhookUseCase - GetEndpoints - s.repo.GetEndpoints: %w", err)
+	}
+	return endpoints, nil
+}
+
+// EnableEndpoint enables an endpoint again after it was disabled for failing too often. Deliveries that
+// are still pending are sent once it is enabled.
+func (uc *WebhookUseCase) EnableEndpoint(ctx context.Context, endpointID, userID int) error {
+	err := uc.repo.EnableEndpoint(ctx, endpointID, userID)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - EnableEndpoint - repo.EnableEndpoint : error enabling webhook endpoint", "error", err)
+		return fmt.Errorf("WebhookUseCase - EnableEndpoint - s.repo.EnableEndpoint: %w", err)
+	}
+
+	uc.logger.Info("WebhookUseCase - EnableEndpoint : webhook endpoint enabled", "endpointID", endpointID)
+	return nil
+}
+
+func (uc *WebhookUseCase) DeleteEndpoint(ctx context.Context, endpointID, userID int) error {
+	err := uc.repo.DeleteEndpoint(ctx, endpointID, userID)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - DeleteEndpoint - repo.DeleteEndpoint : error deleting webhook endpoint", "error", err)
+		return fmt.Errorf("WebhookUseCase - DeleteEndpoint - s.repo.DeleteEndpoint: %w", err)
+	}
+
+	uc.logger.Info("WebhookUseCase - DeleteEndpoint : webhook endpoint deleted", "endpointID", endpointID)
+	return nil
+}
+
+func (uc *WebhookUseCase) GetPaginatedDeliveries(ctx context.Context, endpointID, userID, lastID, limit int) ([]entity.WebhookDelivery, int, error) {
+	deliveries, totalRecords, err := uc.repo.GetPaginatedDeliveries(ctx, endpointID, userID, lastID, limit)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - GetPaginatedDeliveries - repo.GetPaginatedDeliveries : error getting webhook deliveries", "error", err)
+		return nil, 0, fmt.Errorf("WebhookUseCase - GetPaginatedDeliveries - s.repo.GetPaginatedDeliveries: %w", err)
+	}
+	return deliveries, totalRecords, nil
+}
+
+// Enqueue queues a delivery of the event for every enabled endpoint of the file owner subscribed to it.
+// The dispatcher sends them on its next run.
+func (uc *WebhookUseCase) Enqueue(ctx context.Context, event entity.FileEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - Enqueue - json.Marshal : error marshalling event", "error", err)
+		return fmt.Errorf("WebhookUseCase - Enqueue - json.Marshal: %w", err)
+	}
+
+	queued, err := uc.repo.CreateDeliveries(ctx, event, payload)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - Enqueue - repo.CreateDeliveries : error queueing webhook deliveries", "error", err)
+		return fmt.Errorf("WebhookUseCase - Enqueue - s.repo.CreateDeliveries: %w", err)
+	}
+
+	if queued > 0 {
+		uc.logger.Info("WebhookUseCase - Enqueue : webhook deliveries queued", "eventID", event.ID, "type", event.Type, "deliveries", queued)
+	}
+	return nil
+}
+
+// DispatchDue sends the webhook deliveries whose next attempt is due. A failed attempt is retried with an
+// exponential backoff until the policy gives up, and an endpoint failing too many attempts in a row is
+// disabled.
+func (uc *WebhookUseCase) DispatchDue(ctx context.Context) error {
+	for {
+		now := time.Now()
+		deliveries, err := uc.repo.ClaimDueDeliveries(ctx, now, now.Add(_webhookClaimLease), _dueWebhookDeliveriesBatchSize)
+		if err != nil {
+			uc.logger.Error("WebhookUseCase - DispatchDue - repo.ClaimDueDeliveries : error claiming due webhook deliveries", "error", err)
+			return fmt.Errorf("WebhookUseCase - DispatchDue - s.repo.ClaimDueDeliveries: %w", err)
+		}
+
+		failed := 0
+		for _, delivery := range deliveries {
+			err = uc.attempt(ctx, delivery)
+			if err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("WebhookUseCase - DispatchDue - uc.attempt: %d of %d attempts could not be recorded", failed, len(deliveries))
+		}
+
+		if len(deliveries) < _dueWebhookDeliveriesBatchSize {
+			return nil
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome.
+func (uc *WebhookUseCase) attempt(ctx context.Context, delivery entity.WebhookDelivery) error {
+	statusCode, sendErr := uc.sender.Send(ctx, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = nil
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+	switch {
+	case sendErr == nil:
+		delivery.Status = entity.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.LastError = nil
+		delivery.DeliveredAt = &now
+	case uc.policy.GiveUp(delivery.Attempts):
+		uc.logger.Warn("WebhookUseCase - attempt - sender.Send : giving up webhook delivery", "webhookDeliveryID", delivery.ID, "attempts", delivery.Attempts, "error", sendErr)
+		lastError := sendErr.Error()
+		delivery.Status = entity.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.LastError = &lastError
+	default:
+		uc.logger.Warn("WebhookUseCase - attempt - sender.Send : webhook delivery failed, retrying later", "webhookDeliveryID", delivery.ID, "attempts", delivery.Attempts, "error", sendErr)
+		lastError := sendErr.Error()
+		next := now.Add(uc.policy.Backoff(delivery.Attempts))
+		delivery.Status = entity.WebhookDeliveryPending
+		delivery.NextAttemptAt = &next
+		delivery.LastError = &lastError
+	}
+
+	disabled, err := uc.repo.RecordAttempt(ctx, delivery, uc.policy.DisableAfter)
+	if err != nil {
+		uc.logger.Error("WebhookUseCase - attempt - repo.RecordAttempt : error recording webhook attempt", "error", err)
+		return fmt.Errorf("WebhookUseCase - attempt - s.repo.RecordAttempt: %w", err)
+	}
+	if disabled {
+		uc.logger.Warn("WebhookUseCase - attempt : webhook endpoint disabled after consecutive failures", "endpointID", delivery.EndpointID)
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
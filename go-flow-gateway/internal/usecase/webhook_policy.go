@@ -0,0 +1,46 @@
+package usecase
+
+import (
+	"net/url"
+	"time"
+)
+
+// WebhookPolicy controls how failing webhook deliveries are retried and when an endpoint is disabled.
+type WebhookPolicy struct {
+	MaxAttempts  int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+	DisableAfter int  // consecutive failed attempts before an endpoint is disabled, 0 never disables
+	AllowHTTP    bool // accept plain http endpoints besides https
+}
+
+// AllowsURL reports whether an endpoint may be registered with the URL: an absolute https URL, or http
+// when AllowHTTP is set. Where the host points to is checked by the sender when it connects.
+func (p WebhookPolicy) AllowsURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+	return u.Scheme == "https" || (u.Scheme == "http" && p.AllowHTTP)
+}
+
+// Backoff returns the wait before the next attempt of a delivery that failed the given number of times.
+// The wait doubles with every failed attempt, capped at BackoffMax.
+func (p WebhookPolicy) Backoff(attempts int) time.Duration {
+	wait := p.BackoffBase
+	for i := 1; i < attempts; i++ {
+		if p.BackoffMax > 0 && wait >= p.BackoffMax {
+			break
+		}
+		wait *= 2
+	}
+	if p.BackoffMax > 0 && wait > p.BackoffMax {
+		wait = p.BackoffMax
+	}
+	return wait
+}
+
+// GiveUp reports whether a delivery that failed the given number of times is not retried anymore.
+func (p WebhookPolicy) GiveUp(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
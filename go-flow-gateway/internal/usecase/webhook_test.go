@@ -0,0 +1,220 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgg/go-flow-gateway/internal/entity"
+	"github.com/bgg/go-flow-gateway/internal/usecase/apperrors"
+	"github.com/bgg/go-flow-gateway/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookRepo struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepo) CreateEndpoint(ctx context.Context, endpoint entity.WebhookEndpoint) (entity.WebhookEndpoint, error) {
+	args := m.Called(ctx, endpoint)
+	return args.Get(0).(entity.WebhookEndpoint), args.Error(1)
+}
+
+func (m *MockWebhookRepo) GetEndpoints(ctx context.Context, userID int) ([]entity.WebhookEndpoint, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]entity.WebhookEndpoint), args.Error(1)
+}
+
+func (m *MockWebhookRepo) EnableEndpoint(ctx context.Context, endpointID, userID int) error {
+	args := m.Called(ctx, endpointID, userID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) DeleteEndpoint(ctx context.Context, endpointID, userID int) error {
+	args := m.Called(ctx, endpointID, userID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) GetPaginatedDeliveries(ctx context.Context, endpointID, userID, lastID, limit int) ([]entity.WebhookDelivery, int, error) {
+	args := m.Called(ctx, endpointID, userID, lastID, limit)
+	return args.Get(0).([]entity.WebhookDelivery), args.Int(1), args.Error(2)
+}
+
+func (m *MockWebhookRepo) CreateDeliveries(ctx context.Context, event entity.FileEvent, payload []byte) (int, error) {
+	args := m.Called(ctx, event, payload)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWebhookRepo) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	args := m.Called(ctx, now, leaseUntil, limit)
+	return args.Get(0).([]entity.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepo) RecordAttempt(ctx context.Context, delivery entity.WebhookDelivery, disableAfter int) (bool, error) {
+	args := m.Called(ctx, delivery, disableAfter)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockWebhookSender struct {
+	mock.Mock
+}
+
+func (m *MockWebhookSender) Send(ctx context.Context, delivery entity.WebhookDelivery) (int, error) {
+	args := m.Called(ctx, delivery)
+	return args.Int(0), args.Error(1)
+}
+
+func setupWebhookUseCase(t *testing.T) (*WebhookUseCase, *MockWebhookRepo, *MockWebhookSender) {
+	t.Helper()
+
+	mockRepo := new(MockWebhookRepo)
+	mockSender := new(MockWebhookSender)
+	policy := WebhookPolicy{MaxAttempts: 3, BackoffBase: time.Minute, BackoffMax: time.Hour, DisableAfter: 10}
+	uc := NewWebhookUseCase(mockRepo, mockSender, policy, logger.New("debug"))
+	return uc, mockRepo, mockSender
+}
+
+func TestWebhookUseCase_CreateEndpoint(t *testing.T) {
+
+	t.Run("Create an enabled endpoint with a generated secret", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		endpoint := entity.WebhookEndpoint{UserID: 123, URL: "https://example.com/hook", Events: []string{entity.FileEventCreated}}
+		mockRepo.On("CreateEndpoint", ctx, mock.MatchedBy(func(e entity.WebhookEndpoint) bool {
+			return e.Enabled && strings.HasPrefix(e.Secret, "whsec_") && len(e.Secret) == len("whsec_")+64
+		})).Return(entity.WebhookEndpoint{ID: 1, Secret: "whsec_test"}, nil)
+
+		// Act
+		created, err := uc.CreateEndpoint(ctx, endpoint)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, created.ID)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reject a plain http endpoint", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		endpoint := entity.WebhookEndpoint{UserID: 123, URL: "http://example.com/hook", Events: []string{entity.FileEventCreated}}
+
+		// Act
+		_, err := uc.CreateEndpoint(ctx, endpoint)
+
+		// Assert
+		assert.True(t, apperrors.IsInvalidWebhookURLError(err))
+		mockRepo.AssertNotCalled(t, "CreateEndpoint", mock.Anything, mock.Anything)
+	})
+}
+
+func TestWebhookUseCase_Enqueue(t *testing.T) {
+
+	t.Run("Queue the event with its JSON payload", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, _ := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		event := entity.FileEvent{ID: "abc", Type: entity.FileEventDeleted, File: entity.UserUploadedFile{ID: 1, UserID: 123}}
+		payload, _ := json.Marshal(event)
+		mockRepo.On("CreateDeliveries", ctx, event, payload).Return(2, nil)
+
+		// Act
+		err := uc.Enqueue(ctx, event)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestWebhookUseCase_DispatchDue(t *testing.T) {
+
+	delivery := entity.WebhookDelivery{ID: 7, EndpointID: 1, Status: entity.WebhookDeliveryPending, Attempts: 1, URL: "https://example.com/hook"}
+
+	t.Run("Record a successful attempt", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockSender := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("ClaimDueDeliveries", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), _dueWebhookDeliveriesBatchSize).Return([]entity.WebhookDelivery{delivery}, nil)
+		mockSender.On("Send", ctx, delivery).Return(204, nil)
+		mockRepo.On("RecordAttempt", ctx, mock.MatchedBy(func(d entity.WebhookDelivery) bool {
+			return d.Status == entity.WebhookDeliverySucceeded && d.Attempts == 2 && *d.LastStatusCode == 204 && d.DeliveredAt != nil && d.NextAttemptAt == nil
+		}), 10).Return(false, nil)
+
+		// Act
+		err := uc.DispatchDue(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+		mockSender.AssertExpectations(t)
+	})
+
+	t.Run("Retry a failed attempt with backoff", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockSender := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		before := time.Now()
+		mockRepo.On("ClaimDueDeliveries", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), _dueWebhookDeliveriesBatchSize).Return([]entity.WebhookDelivery{delivery}, nil)
+		mockSender.On("Send", ctx, delivery).Return(500, assert.AnError)
+		mockRepo.On("RecordAttempt", ctx, mock.MatchedBy(func(d entity.WebhookDelivery) bool {
+			// the second failure waits twice the base backoff
+			return d.Status == entity.WebhookDeliveryPending && d.Attempts == 2 && d.LastError != nil &&
+				!d.NextAttemptAt.Before(before.Add(2*time.Minute))
+		}), 10).Return(false, nil)
+
+		// Act
+		err := uc.DispatchDue(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Give up after the last attempt", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockSender := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		last := delivery
+		last.Attempts = 2
+		mockRepo.On("ClaimDueDeliveries", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), _dueWebhookDeliveriesBatchSize).Return([]entity.WebhookDelivery{last}, nil)
+		mockSender.On("Send", ctx, last).Return(0, assert.AnError)
+		mockRepo.On("RecordAttempt", ctx, mock.MatchedBy(func(d entity.WebhookDelivery) bool {
+			return d.Status == entity.WebhookDeliveryFailed && d.Attempts == 3 && d.LastStatusCode == nil && d.NextAttemptAt == nil
+		}), 10).Return(true, nil)
+
+		// Act
+		err := uc.DispatchDue(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Report attempts that could not be recorded", func(t *testing.T) {
+		// Arrange
+		uc, mockRepo, mockSender := setupWebhookUseCase(t)
+		ctx := context.Background()
+
+		mockRepo.On("ClaimDueDeliveries", ctx, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), _dueWebhookDeliveriesBatchSize).Return([]entity.WebhookDelivery{delivery}, nil)
+		mockSender.On("Send", ctx, delivery).Return(204, nil)
+		mockRepo.On("RecordAttempt", ctx, mock.Anything, 10).Return(false, assert.AnError)
+
+		// Act
+		err := uc.DispatchDue(ctx)
+
+		// Assert
+		assert.Error(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+}
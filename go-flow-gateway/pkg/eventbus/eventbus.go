@@ -0,0 +1,157 @@
+// Package eventbus implements publishing and consuming of typed events over a topic exchange.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownQueue is returned when subscribing to a queue that is not part of the topology.
+	ErrUnknownQueue = errors.New("eventbus - unknown queue")
+	// ErrNoDeadLetters is returned when browsing dead letters of a topology without a dead letter queue.
+	ErrNoDeadLetters = errors.New("eventbus - no dead letter queue")
+	// ErrDeadLetterNotFound is returned when no dead letter has the requested ID.
+	ErrDeadLetterNotFound = errors.New("eventbus - dead letter not found")
+)
+
+// Event is a typed message, its name is the routing key it is published with.
+type Event interface {
+	EventName() string
+}
+
+// Identified is implemented by events carrying their own ID, it is sent as the message ID.
+type Identified interface {
+	EventID() string
+}
+
+// Message is an event as received by a subscriber.
+type Message struct {
+	ID   string
+	Name string
+	Body []byte
+}
+
+// Handler processes a message, a message whose handler fails is rejected and not redelivered. It is
+// kept as a dead letter when the topology has a dead letter queue.
+type Handler func(ctx context.Context, msg Message) error
+
+// HandlerOf decodes the body of the messages into T before passing them to fn.
+func HandlerOf[T any](fn func(ctx context.Context, event T) error) Handler {
+	return func(ctx context.Context, msg Message) error {
+		var event T
+		err := json.Unmarshal(msg.Body, &event)
+		if err != nil {
+			return fmt.Errorf("eventbus - HandlerOf - json.Unmarshal: %w", err)
+		}
+		return fn(ctx, event)
+	}
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+type Subscriber interface {
+	// Subscribe passes the messages of the queue to the handler until ctx is done.
+	Subscribe(ctx context.Context, queue string, handler Handler) error
+}
+
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+// Topology is the exchange the events are published on and the queues bound to it.
+type Topology struct {
+	Exchange string
+	Queues   []Queue
+	// DeadLetter names the exchange and the queue keeping the messages whose handler failed, empty
+	// drops them. Messages of per instance queues are not kept.
+	DeadLetter string
+	// Prefetch is the number of messages a consumer holds without acknowledging them, 0 is unlimited.
+	Prefetch int
+}
+
+// Queue receives the events whose name matches one of its bindings. Bindings follow the topic exchange
+// rules, words are separated by dots, * matches exactly one word and # matches zero or more words.
+type Queue struct {
+	Name     string
+	Bindings []string
+	// PerInstance queues are declared for each process and go away with it, so every instance receives
+	// every event instead of sharing them.
+	PerInstance bool
+}
+
+func (t Topology) queue(name string) (Queue, bool) {
+	for _, q := range t.Queues {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return Queue{}, false
+}
+
+// Matches reports whether the queue is bound to the event name.
+func (q Queue) Matches(name string) bool {
+	for _, binding := range q.Bindings {
+		if matchTopic(strings.Split(binding, "."), strings.Split(name, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTopic(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchTopic(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchTopic(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchTopic(pattern[1:], words[1:])
+	}
+}
+
+func messageID(event Event) string {
+	if e, ok := event.(Identified); ok {
+		return e.EventID()
+	}
+	return ""
+}
+
+// DeadLetter is a message whose handler failed, kept with the reason of the failure.
+type DeadLetter struct {
+	ID       string
+	Name     string // event name, the message is replayed with it
+	Queue    string // queue whose handler failed
+	Error    string
+	FailedAt time.Time
+	Headers  map[string]string
+	Body     []byte
+}
+
+// DeadLetters browses the dead letter queue. Messages are replayed on the exchange of the topology,
+// so every queue bound to the event receives them again.
+type DeadLetters interface {
+	// List returns up to limit dead letters, the oldest first.
+	List(ctx context.Context, limit int) ([]DeadLetter, error)
+	Get(ctx context.Context, id string) (DeadLetter, error)
+	// Replay publishes the dead letters with the given IDs again to the queue they failed in and removes
+	// them, it returns how many were found.
+	Replay(ctx context.Context, ids []string) (int, error)
+	// Purge removes the dead letters that failed before the given time and returns how many there were.
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
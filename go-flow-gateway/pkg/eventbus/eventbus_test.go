@@ -0,0 +1,210 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testEvent struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (e testEvent) EventName() string { return e.Name }
+func (e testEvent) EventID() string   { return e.ID }
+
+func TestQueue_Matches(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		binding  string
+		event    string
+		expected bool
+	}{
+		{"matches the exact name", "file.created", "file.created", true},
+		{"does not match another name", "file.created", "file.deleted", false},
+		{"matches one word with a star", "file.*", "file.deleted", true},
+		{"does not match two words with a star", "file.*", "file.email.failed", false},
+		{"matches many words with a hash", "file.#", "file.email.failed", true},
+		{"matches no word with a hash", "file.#", "file", true},
+		{"does not match a longer name", "file", "file.created", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Queue{Bindings: []string{tt.binding}}
+			assert.Equal(t, tt.expected, q.Matches(tt.event))
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+
+	topology := Topology{
+		Exchange: "test",
+		Queues: []Queue{
+			{Name: "created", Bindings: []string{"file.created"}},
+			{Name: "all", Bindings: []string{"file.*"}},
+		},
+	}
+
+	t.Run("should route the events to the queues bound to them", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(topology)
+
+		// Act
+		err := b.Publish(context.Background(), testEvent{ID: "evt-1", Name: "file.created"})
+		assert.NoError(t, err)
+		err = b.Publish(context.Background(), testEvent{ID: "evt-2", Name: "file.deleted"})
+		assert.NoError(t, err)
+
+		// Assert
+		created := b.Pending("created")
+		assert.Len(t, created, 1)
+		assert.Equal(t, "evt-1", created[0].ID)
+		assert.Equal(t, "file.created", created[0].Name)
+		assert.Len(t, b.Pending("all"), 2)
+	})
+
+	t.Run("should decode the messages for the handler until the context is done", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(topology)
+		ctx, cancel := context.WithCancel(context.Background())
+		received := make(chan testEvent, 1)
+		handler := HandlerOf(func(ctx context.Context, event testEvent) error {
+			received <- event
+			return nil
+		})
+		done := make(chan error)
+		go func() { done <- b.Subscribe(ctx, "created", handler) }()
+
+		// Act
+		err := b.Publish(context.Background(), testEvent{ID: "evt-1", Name: "file.created"})
+
+		// Assert
+		assert.NoError(t, err)
+		select {
+		case event := <-received:
+			assert.Equal(t, testEvent{ID: "evt-1", Name: "file.created"}, event)
+		case <-time.After(time.Second):
+			t.Fatal("The handler should have received the event")
+		}
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("should refuse to subscribe to a queue outside the topology", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(topology)
+
+		// Act
+		err := b.Subscribe(context.Background(), "unknown", func(ctx context.Context, msg Message) error { return nil })
+
+		// Assert
+		assert.True(t, errors.Is(err, ErrUnknownQueue))
+	})
+}
+
+func TestMemory_DeadLetters(t *testing.T) {
+
+	topology := Topology{
+		Exchange:   "test",
+		Queues:     []Queue{{Name: "created", Bindings: []string{"file.created"}}, {Name: "audit", Bindings: []string{"file.*"}}},
+		DeadLetter: "test.dead-letter",
+	}
+
+	// fail consumes the queue with a failing handler until the given number of messages was handled
+	fail := func(b *Memory, n int) {
+		ctx, cancel := context.WithCancel(context.Background())
+		handled := make(chan struct{}, n)
+		done := make(chan error)
+		go func() {
+			done <- b.Subscribe(ctx, "created", func(ctx context.Context, msg Message) error {
+				defer func() { handled <- struct{}{} }()
+				return errors.New("mail server down")
+			})
+		}()
+		for i := 0; i < n; i++ {
+			<-handled
+		}
+		// the dead letter is recorded right after the handler returns
+		cancel()
+		<-done
+	}
+
+	t.Run("should keep the messages whose handler failed with the reason", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(topology)
+		assert.NoError(t, b.Publish(context.Background(), testEvent{ID: "evt-1", Name: "file.created"}))
+
+		// Act
+		fail(b, 1)
+
+		// Assert
+		letters, err := b.List(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Len(t, letters, 1)
+		assert.Equal(t, "evt-1", letters[0].ID)
+		assert.Equal(t, "file.created", letters[0].Name)
+		assert.Equal(t, "created", letters[0].Queue)
+		assert.Equal(t, "mail server down", letters[0].Error)
+	})
+
+	t.Run("should replay the selected dead letters to the queue they failed in", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(topology)
+		assert.NoError(t, b.Publish(context.Background(), testEvent{ID: "evt-1", Name: "file.created"}))
+		assert.NoError(t, b.Publish(context.Background(), testEvent{ID: "evt-2", Name: "file.created"}))
+		fail(b, 2)
+		audited := len(b.Pending("audit"))
+
+		// Act
+		replayed, err := b.Replay(context.Background(), []string{"evt-2", "unknown"})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+		pending := b.Pending("created")
+		assert.Len(t, pending, 1)
+		assert.Equal(t, "evt-2", pending[0].ID)
+		assert.Len(t, b.Pending("audit"), audited, "The other queues bound to the event should not get it again")
+		_, err = b.Get(context.Background(), "evt-2")
+		assert.True(t, errors.Is(err, ErrDeadLetterNotFound))
+		_, err = b.Get(context.Background(), "evt-1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("should purge the dead letters that failed before the given time", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(topology)
+		assert.NoError(t, b.Publish(context.Background(), testEvent{ID: "evt-1", Name: "file.created"}))
+		fail(b, 1)
+
+		// Act
+		kept, err := b.Purge(context.Background(), time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		purged, err2 := b.Purge(context.Background(), time.Now().Add(time.Second))
+
+		// Assert
+		assert.NoError(t, err2)
+		assert.Equal(t, 0, kept)
+		assert.Equal(t, 1, purged)
+		letters, _ := b.List(context.Background(), 10)
+		assert.Empty(t, letters)
+	})
+
+	t.Run("should refuse to browse without a dead letter queue", func(t *testing.T) {
+		// Arrange
+		b := NewMemory(Topology{Exchange: "test"})
+
+		// Act
+		_, err := b.List(context.Background(), 10)
+
+		// Assert
+		assert.True(t, errors.Is(err, ErrNoDeadLetters))
+	})
+}
@@ -0,0 +1,180 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const _memoryQueueSize = 100
+
+// ErrQueueFull is returned by the in-memory bus when a queue holds too many unconsumed messages.
+var ErrQueueFull = errors.New("eventbus - queue full")
+
+// Memory is an in-memory bus routing the events like the topic exchange would, meant for tests. It
+// keeps the dead letters as well when the topology has a dead letter queue.
+type Memory struct {
+	topology Topology
+	queues   map[string]chan Message
+
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+}
+
+func NewMemory(t Topology) *Memory {
+	b := &Memory{topology: t, queues: make(map[string]chan Message)}
+	for _, q := range t.Queues {
+		b.queues[q.Name] = make(chan Message, _memoryQueueSize)
+	}
+	return b
+}
+
+func (b *Memory) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("eventbus - Publish - json.Marshal: %w", err)
+	}
+
+	return b.route(Message{ID: messageID(event), Name: event.EventName(), Body: body})
+}
+
+func (b *Memory) route(msg Message) error {
+	for _, q := range b.topology.Queues {
+		if !q.Matches(msg.Name) {
+			continue
+		}
+		select {
+		case b.queues[q.Name] <- msg:
+		default:
+			return fmt.Errorf("eventbus - Publish - %s: %w", q.Name, ErrQueueFull)
+		}
+	}
+	return nil
+}
+
+func (b *Memory) Subscribe(ctx context.Context, queue string, handler Handler) error {
+	msgs, ok := b.queues[queue]
+	if !ok {
+		return fmt.Errorf("eventbus - Subscribe - %s: %w", queue, ErrUnknownQueue)
+	}
+	q, _ := b.topology.queue(queue)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-msgs:
+			// like a rejected message, a failed one is not redelivered
+			err := handler(ctx, msg)
+			if err != nil && b.topology.DeadLetter != "" && !q.PerInstance {
+				b.mu.Lock()
+				b.deadLetters = append(b.deadLetters, DeadLetter{ID: msg.ID, Name: msg.Name, Queue: queue, Error: err.Error(), FailedAt: time.Now(), Body: msg.Body})
+				b.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (b *Memory) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	if b.topology.DeadLetter == "" {
+		return nil, ErrNoDeadLetters
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := min(limit, len(b.deadLetters))
+	return append([]DeadLetter(nil), b.deadLetters[:n]...), nil
+}
+
+func (b *Memory) Get(ctx context.Context, id string) (DeadLetter, error) {
+	if b.topology.DeadLetter == "" {
+		return DeadLetter{}, ErrNoDeadLetters
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, dl := range b.deadLetters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+	return DeadLetter{}, fmt.Errorf("eventbus - Get - %s: %w", id, ErrDeadLetterNotFound)
+}
+
+func (b *Memory) Replay(ctx context.Context, ids []string) (int, error) {
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	replayed := 0
+	err := b.remove(func(dl DeadLetter) (bool, error) {
+		if !selected[dl.ID] {
+			return false, nil
+		}
+		// only the queue the message failed in gets it again
+		queue, ok := b.queues[dl.Queue]
+		if !ok {
+			return false, fmt.Errorf("eventbus - Replay - %s: %w", dl.Queue, ErrUnknownQueue)
+		}
+		select {
+		case queue <- Message{ID: dl.ID, Name: dl.Name, Body: dl.Body}:
+		default:
+			return false, fmt.Errorf("eventbus - Replay - %s: %w", dl.Queue, ErrQueueFull)
+		}
+		replayed++
+		return true, nil
+	})
+	return replayed, err
+}
+
+func (b *Memory) Purge(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	err := b.remove(func(dl DeadLetter) (bool, error) {
+		if !dl.FailedAt.Before(before) {
+			return false, nil
+		}
+		purged++
+		return true, nil
+	})
+	return purged, err
+}
+
+// remove drops the dead letters fn reports to be removed, the others are kept in order.
+func (b *Memory) remove(fn func(dl DeadLetter) (bool, error)) error {
+	if b.topology.DeadLetter == "" {
+		return ErrNoDeadLetters
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.deadLetters[:0]
+	for i, dl := range b.deadLetters {
+		removed, err := fn(dl)
+		if err != nil {
+			b.deadLetters = append(kept, b.deadLetters[i:]...)
+			return err
+		}
+		if !removed {
+			kept = append(kept, dl)
+		}
+	}
+	b.deadLetters = kept
+	return nil
+}
+
+// Pending returns the messages waiting in the queue without consuming them, the queue must not be
+// subscribed to meanwhile.
+func (b *Memory) Pending(queue string) []Message {
+	msgs := b.queues[queue]
+	pending := make([]Message, 0, len(msgs))
+	for i := len(msgs); i > 0; i-- {
+		msg := <-msgs
+		pending = append(pending, msg)
+		msgs <- msg
+	}
+	return pending
+}
@@ -0,0 +1,229 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQ is a bus over a topic exchange of RabbitMQ.
+type RabbitMQ struct {
+	ch       *amqp.Channel
+	topology Topology
+	queues   map[string]string // name in the topology -> name of the declared queue
+	tags     atomic.Int64
+}
+
+// NewRabbitMQ declares the topology and returns a bus publishing and consuming through it.
+func NewRabbitMQ(ch *amqp.Channel, t Topology) (*RabbitMQ, error) {
+	b := &RabbitMQ{ch: ch, topology: t, queues: make(map[string]string)}
+
+	err := ch.ExchangeDeclare(
+		t.Exchange,
+		"topic",
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return nil, fmt.Errorf("eventbus - NewRabbitMQ - ch.ExchangeDeclare: %w", err)
+	}
+
+	if t.Prefetch > 0 {
+		// applies to every consumer started on the channel afterwards
+		err = ch.Qos(t.Prefetch, 0, false)
+		if err != nil {
+			return nil, fmt.Errorf("eventbus - NewRabbitMQ - ch.Qos: %w", err)
+		}
+	}
+
+	err = declareDeadLetter(ch, t)
+	if err != nil {
+		return nil, fmt.Errorf("eventbus - NewRabbitMQ - declareDeadLetter: %w", err)
+	}
+
+	for _, queue := range t.Queues {
+		name := queue.Name
+		var args amqp.Table
+		if queue.PerInstance {
+			name = "" // named by the server
+		} else if t.DeadLetter != "" {
+			// rejected messages go to the dead letter queue should republishing them fail, see deadLetter.
+			// Arguments of a declared queue cannot change, a queue declared without them needs a new name.
+			args = amqp.Table{"x-dead-letter-exchange": t.DeadLetter}
+		}
+		q, err := ch.QueueDeclare(
+			name,
+			!queue.PerInstance, // durable
+			queue.PerInstance,  // delete when unused
+			queue.PerInstance,  // exclusive
+			false,              // no-wait
+			args,               // arguments
+		)
+		if err != nil {
+			return nil, fmt.Errorf("eventbus - NewRabbitMQ - ch.QueueDeclare: %w", err)
+		}
+		b.queues[queue.Name] = q.Name
+
+		for _, binding := range queue.Bindings {
+			err = ch.QueueBind(q.Name, binding, t.Exchange, false, nil)
+			if err != nil {
+				return nil, fmt.Errorf("eventbus - NewRabbitMQ - ch.QueueBind: %w", err)
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// declareDeadLetter declares the fanout exchange of the dead letters and the queue keeping them.
+func declareDeadLetter(ch *amqp.Channel, t Topology) error {
+	if t.DeadLetter == "" {
+		return nil
+	}
+
+	err := ch.ExchangeDeclare(t.DeadLetter, "fanout", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("eventbus - declareDeadLetter - ch.ExchangeDeclare: %w", err)
+	}
+	_, err = ch.QueueDeclare(t.DeadLetter, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("eventbus - declareDeadLetter - ch.QueueDeclare: %w", err)
+	}
+	err = ch.QueueBind(t.DeadLetter, "", t.DeadLetter, false, nil)
+	if err != nil {
+		return fmt.Errorf("eventbus - declareDeadLetter - ch.QueueBind: %w", err)
+	}
+	return nil
+}
+
+func (b *RabbitMQ) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("eventbus - Publish - json.Marshal: %w", err)
+	}
+
+	err = b.ch.PublishWithContext(
+		ctx,
+		b.topology.Exchange,
+		event.EventName(),
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    messageID(event),
+			Type:         event.EventName(),
+			Timestamp:    time.Now(),
+			Body:         body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("eventbus - Publish - ch.PublishWithContext: %w", err)
+	}
+	return nil
+}
+
+func (b *RabbitMQ) Subscribe(ctx context.Context, queue string, handler Handler) error {
+	name, ok := b.queues[queue]
+	if !ok {
+		return fmt.Errorf("eventbus - Subscribe - %s: %w", queue, ErrUnknownQueue)
+	}
+
+	tag := fmt.Sprintf("%s-%d", queue, b.tags.Add(1))
+	msgs, err := b.ch.Consume(
+		name,
+		tag,   // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return fmt.Errorf("eventbus - Subscribe - ch.Consume: %w", err)
+	}
+
+	q, _ := b.topology.queue(queue)
+	for {
+		select {
+		case <-ctx.Done():
+			return b.ch.Cancel(tag, false)
+		case d, ok := <-msgs:
+			if !ok {
+				return errors.New("eventbus - Subscribe: delivery channel closed")
+			}
+			err = handler(ctx, Message{ID: d.MessageId, Name: d.RoutingKey, Body: d.Body})
+			switch {
+			case err == nil:
+				err = d.Ack(false)
+			case b.topology.DeadLetter != "" && !q.PerInstance && b.deadLetter(ctx, queue, d, err) == nil:
+				err = d.Ack(false)
+			default:
+				err = d.Nack(false, false)
+			}
+			if err != nil {
+				return fmt.Errorf("eventbus - Subscribe - d.Ack: %w", err)
+			}
+		}
+	}
+}
+
+// Headers a dead letter is republished with.
+const (
+	_headerError    = "x-error"
+	_headerQueue    = "x-queue"
+	_headerFailedAt = "x-failed-at"
+)
+
+// deadLetter republishes a failed message to the dead letter exchange together with the reason of the
+// failure, which rejecting it would not keep. A message without ID gets one so it can be replayed.
+func (b *RabbitMQ) deadLetter(ctx context.Context, queue string, d amqp.Delivery, cause error) error {
+	id := d.MessageId
+	if id == "" {
+		var err error
+		id, err = newDeadLetterID()
+		if err != nil {
+			return fmt.Errorf("eventbus - deadLetter - newDeadLetterID: %w", err)
+		}
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[_headerError] = cause.Error()
+	headers[_headerQueue] = queue
+	headers[_headerFailedAt] = time.Now()
+
+	err := b.ch.PublishWithContext(ctx, b.topology.DeadLetter, d.RoutingKey, false, false, amqp.Publishing{
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    id,
+		Type:         d.Type,
+		Timestamp:    d.Timestamp,
+		Headers:      headers,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("eventbus - deadLetter - ch.PublishWithContext: %w", err)
+	}
+	return nil
+}
+
+func newDeadLetterID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
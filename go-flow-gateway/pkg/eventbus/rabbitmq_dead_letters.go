@@ -0,0 +1,217 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQDeadLetters browses the dead letter queue of a topology declared by NewRabbitMQ. Every call
+// walks the queue on a channel of its own, the messages it does not remove go back to the queue when
+// the channel closes. Messages being walked by one call are hidden from another one meanwhile.
+type RabbitMQDeadLetters struct {
+	conn     *amqp.Connection
+	topology Topology
+}
+
+func NewRabbitMQDeadLetters(conn *amqp.Connection, t Topology) *RabbitMQDeadLetters {
+	return &RabbitMQDeadLetters{conn: conn, topology: t}
+}
+
+func (b *RabbitMQDeadLetters) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := b.walk(ctx, func(ch *amqp.Channel, d amqp.Delivery) (bool, bool, error) {
+		letters = append(letters, deadLetterOf(d))
+		return false, len(letters) >= limit, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("eventbus - List - b.walk: %w", err)
+	}
+	return letters, nil
+}
+
+func (b *RabbitMQDeadLetters) Get(ctx context.Context, id string) (DeadLetter, error) {
+	var letter *DeadLetter
+	err := b.walk(ctx, func(ch *amqp.Channel, d amqp.Delivery) (bool, bool, error) {
+		if d.MessageId != id {
+			return false, false, nil
+		}
+		dl := deadLetterOf(d)
+		letter = &dl
+		return false, true, nil
+	})
+	if err != nil {
+		return DeadLetter{}, fmt.Errorf("eventbus - Get - b.walk: %w", err)
+	}
+	if letter == nil {
+		return DeadLetter{}, fmt.Errorf("eventbus - Get - %s: %w", id, ErrDeadLetterNotFound)
+	}
+	return *letter, nil
+}
+
+// Replay publishes the dead letters back to the queue they failed in, through the default exchange so the
+// other queues bound to the event do not receive it again. A dead letter is removed once the broker
+// confirmed the publishing.
+func (b *RabbitMQDeadLetters) Replay(ctx context.Context, ids []string) (int, error) {
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	replayed := 0
+	confirming := false
+	err := b.walk(ctx, func(ch *amqp.Channel, d amqp.Delivery) (bool, bool, error) {
+		if !selected[d.MessageId] {
+			return false, false, nil
+		}
+		queue, ok := b.topology.queue(deadLetterOf(d).Queue)
+		if !ok || queue.PerInstance {
+			return false, true, fmt.Errorf("eventbus - Replay - %s: %w", d.MessageId, ErrUnknownQueue)
+		}
+		if !confirming {
+			err := ch.Confirm(false)
+			if err != nil {
+				return false, true, fmt.Errorf("eventbus - Replay - ch.Confirm: %w", err)
+			}
+			confirming = true
+		}
+
+		confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", queue.Name, false, false, amqp.Publishing{
+			ContentType:  d.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    d.MessageId,
+			Type:         d.Type,
+			Timestamp:    time.Now(),
+			Headers:      originalHeaders(d.Headers),
+			Body:         d.Body,
+		})
+		if err != nil {
+			return false, true, fmt.Errorf("eventbus - Replay - ch.PublishWithDeferredConfirmWithContext: %w", err)
+		}
+		acked, err := confirmation.WaitContext(ctx)
+		if err != nil {
+			return false, true, fmt.Errorf("eventbus - Replay - confirmation.WaitContext: %w", err)
+		}
+		if !acked {
+			return false, true, fmt.Errorf("eventbus - Replay - %s: publishing not confirmed by the broker", d.MessageId)
+		}
+		replayed++
+		delete(selected, d.MessageId)
+		return true, len(selected) == 0, nil
+	})
+	if err != nil {
+		return replayed, fmt.Errorf("eventbus - Replay - b.walk: %w", err)
+	}
+	return replayed, nil
+}
+
+func (b *RabbitMQDeadLetters) Purge(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	err := b.walk(ctx, func(ch *amqp.Channel, d amqp.Delivery) (bool, bool, error) {
+		if !deadLetterOf(d).FailedAt.Before(before) {
+			return false, false, nil
+		}
+		purged++
+		return true, false, nil
+	})
+	if err != nil {
+		return purged, fmt.Errorf("eventbus - Purge - b.walk: %w", err)
+	}
+	return purged, nil
+}
+
+// walk passes the messages of the dead letter queue to fn, which reports whether to remove the message
+// and whether to stop.
+func (b *RabbitMQDeadLetters) walk(ctx context.Context, fn func(ch *amqp.Channel, d amqp.Delivery) (remove, stop bool, err error)) error {
+	if b.topology.DeadLetter == "" {
+		return ErrNoDeadLetters
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("eventbus - walk - conn.Channel: %w", err)
+	}
+	// closing the channel puts back every message that has not been acknowledged
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(b.topology.DeadLetter, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("eventbus - walk - ch.QueueDeclarePassive: %w", err)
+	}
+
+	// messages are left unacknowledged until the end, so each one is seen once
+	for i := 0; i < q.Messages; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d, ok, err := ch.Get(q.Name, false)
+		if err != nil {
+			return fmt.Errorf("eventbus - walk - ch.Get: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		remove, stop, err := fn(ch, d)
+		if err != nil {
+			return err
+		}
+		if remove {
+			err = d.Ack(false)
+			if err != nil {
+				return fmt.Errorf("eventbus - walk - d.Ack: %w", err)
+			}
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// originalHeaders returns the headers of a dead letter without the ones added when it was dead-lettered.
+func originalHeaders(headers amqp.Table) amqp.Table {
+	original := amqp.Table{}
+	for k, v := range headers {
+		switch {
+		case k == _headerError, k == _headerQueue, k == _headerFailedAt:
+		case strings.HasPrefix(k, "x-death"), strings.HasPrefix(k, "x-first-death-"), strings.HasPrefix(k, "x-last-death-"):
+		default:
+			original[k] = v
+		}
+	}
+	return original
+}
+
+// deadLetterOf reads a message of the dead letter queue. Messages rejected by the broker instead of
+// republished by Subscribe carry its x-death headers only.
+func deadLetterOf(d amqp.Delivery) DeadLetter {
+	dl := DeadLetter{
+		ID:       d.MessageId,
+		Name:     d.RoutingKey,
+		Headers:  make(map[string]string, len(d.Headers)),
+		Body:     d.Body,
+		FailedAt: d.Timestamp,
+	}
+	for k, v := range d.Headers {
+		dl.Headers[k] = fmt.Sprint(v)
+	}
+
+	if queue, ok := d.Headers[_headerQueue].(string); ok {
+		dl.Queue = queue
+	} else if queue, ok := d.Headers["x-first-death-queue"].(string); ok {
+		dl.Queue = queue
+	}
+	if reason, ok := d.Headers[_headerError].(string); ok {
+		dl.Error = reason
+	} else if reason, ok := d.Headers["x-first-death-reason"].(string); ok {
+		dl.Error = reason
+	}
+	if failedAt, ok := d.Headers[_headerFailedAt].(time.Time); ok {
+		dl.FailedAt = failedAt
+	}
+	return dl
+}
@@ -0,0 +1,28 @@
+// Package redis implements the redis connection pool.
+package redis
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	_defaultIdleTimeout = 240 * time.Second
+)
+
+// NewPool returns a pool of connections to the redis server at address, keeping up to maxIdle connections
+// open. Connections are checked with a PING when they are borrowed.
+func NewPool(address, password string, maxIdle int) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     maxIdle,
+		IdleTimeout: _defaultIdleTimeout,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", address, redis.DialPassword(password))
+		},
+	}
+}
@@ -0,0 +1,71 @@
+// Package totp implements the time-based one-time passwords of RFC 6238, as generated by authenticator
+// apps: HMAC-SHA1, 6 digits and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	_secretSize = 20 // bytes, the size of an HMAC-SHA1 key recommended by RFC 4226
+)
+
+var _encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random secret encoded in base32, the form authenticator apps accept.
+func GenerateSecret() (string, error) {
+	b := make([]byte, _secretSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("totp - GenerateSecret - rand.Read: %w", err)
+	}
+	return _encoding.EncodeToString(b), nil
+}
+
+// Step returns the time step of t, the counter the code of t is derived from.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of the base32 secret for a time step.
+func Code(secret string, step int64) (string, error) {
+	key, err := _encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("totp - Code - DecodeString: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation of RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1_000_000), nil
+}
+
+// URI returns the otpauth URI of the secret, which authenticator apps add an account from when it is
+// scanned as a QR code.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
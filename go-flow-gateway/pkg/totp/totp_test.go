@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+
+	// the SHA1 test vectors of RFC 6238, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		t.Run(want, func(t *testing.T) {
+			// Act
+			code, err := Code(secret, Step(time.Unix(unix, 0)))
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, want, code)
+		})
+	}
+
+	t.Run("rejects a secret that is not base32", func(t *testing.T) {
+		_, err := Code("not base32!", 1)
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateSecret(t *testing.T) {
+
+	t.Run("returns distinct secrets that codes can be derived from", func(t *testing.T) {
+		// Act
+		a, errA := GenerateSecret()
+		b, errB := GenerateSecret()
+		_, errCode := Code(a, 1)
+
+		// Assert
+		assert.NoError(t, errA)
+		assert.NoError(t, errB)
+		assert.NoError(t, errCode)
+		assert.NotEqual(t, a, b)
+		assert.Len(t, a, 32)
+	})
+}
+
+func TestURI(t *testing.T) {
+
+	t.Run("labels the account with the issuer", func(t *testing.T) {
+		// Act
+		uri := URI("Go Flow", "hank", "JBSWY3DPEHPK3PXP")
+
+		// Assert
+		assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Go%20Flow:hank?"))
+		assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+		assert.Contains(t, uri, "issuer=Go+Flow")
+	})
+}
@@ -19,19 +19,203 @@ CREATE TABLE user_credentials (
     credential_id SERIAL PRIMARY KEY,
     user_id INT NOT NULL REFERENCES user_profiles(user_id),
     username VARCHAR(255) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL
+    password_hash VARCHAR(255) NOT NULL,
+    email VARCHAR(255) UNIQUE,                      -- stored in lower case
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE
 );
 
+-- Email Verifications, single-use tokens proving that a user owns the email of their credential
+CREATE TABLE email_verifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    email VARCHAR(255) NOT NULL,                    -- the email being verified, a changed email invalidates the token
+    token_hash CHAR(64) UNIQUE NOT NULL,            -- hex SHA-256 of the token, the token itself is only emailed
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX email_verifications_user_id_created_at_idx ON email_verifications (user_id, created_at);
+
+-- Password Resets, single-use tokens emailed to users who forgot their password
+CREATE TABLE password_resets (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    token_hash CHAR(64) UNIQUE NOT NULL,            -- hex SHA-256 of the token, the token itself is only emailed
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX password_resets_user_id_created_at_idx ON password_resets (user_id, created_at);
+
+-- TOTP Factors, the authenticator app a user signs in with as a second factor
+CREATE TABLE totp_factors (
+    user_id INT PRIMARY KEY REFERENCES user_profiles(user_id),
+    secret VARCHAR(64) NOT NULL,                    -- base32 secret shared with the authenticator app
+    confirmed_at TIMESTAMPTZ,                       -- NULL while the enrollment waits for a first code
+    last_used_step BIGINT NOT NULL DEFAULT 0,       -- time step of the last accepted code, a code is never accepted twice
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+-- Recovery Codes, single-use codes replacing the authenticator app when it is lost
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    code_hash CHAR(64) NOT NULL,                    -- hex SHA-256 of the code, the code itself is only shown once
+    used_at TIMESTAMPTZ,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Personal Access Tokens, bearer tokens users create for their scripts and integrations
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,            -- hex SHA-256 of the token, the token itself is only shown once
+    scopes TEXT[] NOT NULL,                         -- what the token may do, such as files:read
+    expires_at TIMESTAMPTZ,                         -- NULL never expires
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
+
+-- File Blobs, content shared by identical uploads of the same user
+CREATE TABLE file_blobs (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    checksum CHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    content BYTEA NOT NULL,
+    ref_count INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX file_blobs_user_id_checksum_idx ON file_blobs (user_id, checksum);
+
+-- Deliveries, files sent together in one email
+CREATE TABLE deliveries (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    email_recipients TEXT[] NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    send_at TIMESTAMPTZ,
+    claimed_at TIMESTAMPTZ, -- when a consumer started sending the email, a stale claim can be taken over
+    publish_claimed_at TIMESTAMPTZ, -- when the scheduler made the delivery pending, cleared once it is published
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    email_sent BOOLEAN NOT NULL DEFAULT FALSE,
+    email_sent_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ, -- last failed attempt, cleared once the email is sent
+    error_message TEXT,
+    archive_password VARCHAR(64), -- password of the archive, recorded before the archive is sent and kept until its own email is sent
+    archive_sent_at TIMESTAMPTZ -- when the archive went out, a retry then only sends the password
+);
+CREATE INDEX deliveries_scheduled_send_at_idx ON deliveries (send_at) WHERE status = 'scheduled';
+CREATE INDEX deliveries_publish_claimed_at_idx ON deliveries (publish_claimed_at) WHERE publish_claimed_at IS NOT NULL;
+CREATE INDEX deliveries_failed_at_idx ON deliveries (failed_at) WHERE failed_at IS NOT NULL;
+
 -- User File
 CREATE TABLE user_uploaded_files (
     id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     size BIGINT NOT NULL,
-    content BYTEA NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT 'application/octet-stream',
+    checksum CHAR(64) NOT NULL,
+    blob_id INT REFERENCES file_blobs(id), -- NULL once the content is purged, the row stays as a tombstone
     user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    delivery_id INT REFERENCES deliveries(id),
     created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    expires_at TIMESTAMPTZ,
+    expired_at TIMESTAMPTZ,
     email_sent BOOLEAN NOT NULL,
     email_sent_at TIMESTAMPTZ,
-    email_recipient VARCHAR(255),
-    error_message TEXT
+    email_state VARCHAR(20) NOT NULL DEFAULT 'queued', -- processing of the email, a sent one is not sent again
+    email_claimed_at TIMESTAMPTZ,
+    email_failed_at TIMESTAMPTZ, -- last failed attempt, cleared once the email is sent
+    email_recipient TEXT,
+    message_id VARCHAR(255), -- Message-ID of the email, delivery status callbacks refer to it
+    email_status VARCHAR(20),
+    error_message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+);
+CREATE INDEX user_uploaded_files_user_id_created_at_idx ON user_uploaded_files (user_id, created_at);
+CREATE INDEX user_uploaded_files_delivery_id_idx ON user_uploaded_files (delivery_id);
+CREATE INDEX user_uploaded_files_expires_at_idx ON user_uploaded_files (expires_at) WHERE expired_at IS NULL;
+CREATE INDEX user_uploaded_files_message_id_idx ON user_uploaded_files (message_id);
+CREATE INDEX user_uploaded_files_email_failed_at_idx ON user_uploaded_files (email_failed_at) WHERE email_failed_at IS NOT NULL;
+
+-- File Uploads, append-only log of the files users stored, counted against the upload rate limit
+CREATE TABLE file_uploads (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX file_uploads_user_id_created_at_idx ON file_uploads (user_id, created_at);
+
+-- Email Recipient Statuses, delivery state reported by the mail provider for each recipient of a file
+CREATE TABLE email_recipient_statuses (
+    user_uploaded_file_id INT NOT NULL REFERENCES user_uploaded_files(id) ON DELETE CASCADE,
+    recipient TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    reason TEXT,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_uploaded_file_id, recipient)
+);
+
+-- Email Resends, emails a user asked to send again, counted against the resend rate limit
+CREATE TABLE email_resends (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    user_uploaded_file_id INT REFERENCES user_uploaded_files(id) ON DELETE SET NULL, -- kept after the file is deleted, so deleting does not reset the rate limit
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX email_resends_user_id_created_at_idx ON email_resends (user_id, created_at);
+
+-- Upload Sessions, resumable uploads whose content arrives in chunks
+CREATE TABLE upload_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    name VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    email_recipient VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- 'finalizing' once a request claimed it to create the file
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX upload_sessions_expires_at_idx ON upload_sessions (expires_at);
+
+-- Upload Session Chunks, each chunk is stored as a blob
+CREATE TABLE upload_session_chunks (
+    session_id VARCHAR(64) NOT NULL REFERENCES upload_sessions(id),
+    chunk_offset BIGINT NOT NULL,
+    blob_id INT NOT NULL REFERENCES file_blobs(id),
+    PRIMARY KEY (session_id, chunk_offset)
+);
+
+-- Webhook Endpoints, URLs of a user notified about file events
+CREATE TABLE webhook_endpoints (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES user_profiles(user_id),
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events TEXT[] NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    disabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+CREATE INDEX webhook_endpoints_user_id_idx ON webhook_endpoints (user_id);
+
+-- Webhook Deliveries, log of the events sent to the endpoints and their retries
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    endpoint_id INT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,
+    last_status_code INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    delivered_at TIMESTAMPTZ,
+    UNIQUE (endpoint_id, event_id)
 );
+CREATE INDEX webhook_deliveries_pending_next_attempt_at_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';